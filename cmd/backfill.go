@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// runBackfillCache 从数据库重新填充Redis中的票数缓存、排行榜和最近已知票数，用于Redis数据丢失或切换实例之后
+// Redis中缺失的当前票据同样从数据库补回；已有的票据不覆盖，Redis中的剩余使用次数比数据库更新
+func runBackfillCache(args []string) {
+	fs, configPath := newFlagSet("backfill-cache")
+	pollID := fs.String("poll", "", "填充的投票活动，为空时填充所有投票活动")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	store, err := repository.NewStorage(logger)
+	if err != nil {
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
+	}
+	defer store.Close()
+
+	redisRepo, err := repository.NewRedisRepository(logger)
+	if err != nil {
+		fatal("初始化Redis仓库失败", "error", err)
+	}
+	defer redisRepo.Close()
+
+	pollIDs := []string{*pollID}
+	if *pollID == "" {
+		polls, err := store.ListPolls()
+		if err != nil {
+			fatal("查询投票活动失败", "error", err)
+		}
+		pollIDs = pollIDs[:0]
+		for _, poll := range polls {
+			pollIDs = append(pollIDs, poll.ID)
+		}
+	}
+
+	failed := 0
+	for _, id := range pollIDs {
+		users, err := backfillPoll(store, redisRepo, id)
+		if err != nil {
+			logger.Error("填充投票活动的缓存失败", "poll_id", id, "error", err)
+			failed++
+			continue
+		}
+		logger.Info("已填充投票活动的缓存", "poll_id", id, "users", users)
+	}
+	if failed > 0 {
+		fatal("部分投票活动的缓存填充失败", "failed", failed, "polls", len(pollIDs))
+	}
+}
+
+// backfillPoll 填充一个投票活动的缓存，返回填充的用户数；票数从主库读取，缓存中更新的票数不会被覆盖
+func backfillPoll(store repository.Storage, redisRepo *repository.RedisRepository, pollID string) (int, error) {
+	listed, err := store.GetAllUserVotes(pollID)
+	if err != nil {
+		return 0, err
+	}
+	usernames := make([]string, len(listed))
+	for i, userVote := range listed {
+		usernames[i] = userVote.Username
+	}
+	var userVotes []*model.UserVote
+	if len(usernames) > 0 {
+		if userVotes, err = store.GetUserVotesFromMaster(pollID, usernames); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := redisRepo.WriteThroughUserVotes(pollID, userVotes); err != nil {
+		return 0, err
+	}
+	if err := redisRepo.ReplaceLeaderboard(pollID, userVotes); err != nil {
+		return 0, err
+	}
+	if err := redisRepo.SaveLastKnownUserVotes(pollID, userVotes); err != nil {
+		return 0, err
+	}
+
+	version, err := store.GetNewestTicketVersion(pollID)
+	if err != nil || version == "" {
+		return len(userVotes), nil
+	}
+	if _, err := redisRepo.GetTicket(version); err == nil {
+		return len(userVotes), nil
+	}
+	ticket, err := store.GetTicket(version)
+	if err != nil {
+		return 0, err
+	}
+	if err := redisRepo.CreateTicket(ticket); err != nil {
+		return 0, err
+	}
+	if current, err := redisRepo.GetNewestTicketVersion(pollID); err != nil || current == "" {
+		if err := redisRepo.SetNewestTicketVersion(pollID, version); err != nil {
+			return 0, err
+		}
+	}
+	return len(userVotes), nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+)
+
+// runCleanupTickets 立即执行一次过期票据清理
+func runCleanupTickets(args []string) {
+	fs, configPath := newFlagSet("cleanup-tickets")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	store, err := repository.NewStorage(logger)
+	if err != nil {
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
+	}
+	defer store.Close()
+
+	purged, err := ticket.NewCleanupJob(store, nil, logger).RunOnce()
+	if err != nil {
+		fatal("清理过期票据失败", "error", err)
+	}
+	logger.Info("过期票据清理完成", "purged", purged)
+}
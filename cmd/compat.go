@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/api/graph"
+	"github.com/lvdashuaibi/littlevote/internal/buildinfo"
+	"github.com/lvdashuaibi/littlevote/internal/compat"
+	"github.com/lvdashuaibi/littlevote/internal/kafka"
+)
+
+// runSchema 以JSON输出本版本对外的接口契约（GraphQL Schema和投票事件格式版本），不需要配置文件
+func runSchema(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Parse(args)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(currentManifest()); err != nil {
+		fatal("输出接口契约失败", "error", err)
+	}
+}
+
+func currentManifest() *compat.Manifest {
+	minVersion, maxVersion := kafka.SupportedSchemaVersions()
+	return &compat.Manifest{
+		Version:     buildinfo.Version,
+		Commit:      buildinfo.Commit,
+		GraphQL:     graph.SchemaString(),
+		EventSchema: compat.EventSchema{MinVersion: minVersion, MaxVersion: maxVersion},
+	}
+}
+
+// runCompatCheck 比较两个版本的接口契约，存在不能混合部署的改动时以状态码1退出
+func runCompatCheck(args []string) {
+	fs := flag.NewFlagSet("compat-check", flag.ExitOnError)
+	oldPath := fs.String("old", "", "当前线上版本的二进制文件，或其schema子命令输出的JSON文件")
+	newPath := fs.String("new", "", "待发布版本的二进制文件或JSON文件，缺省为当前程序")
+	fs.Parse(args)
+
+	if *oldPath == "" {
+		fatal("必须通过-old指定当前线上版本")
+	}
+	oldManifest, err := loadManifest(*oldPath)
+	if err != nil {
+		fatal("读取旧版本的接口契约失败", "error", err)
+	}
+	newManifest := currentManifest()
+	if *newPath != "" {
+		if newManifest, err = loadManifest(*newPath); err != nil {
+			fatal("读取新版本的接口契约失败", "error", err)
+		}
+	}
+
+	problems, err := compat.Compare(oldManifest, newManifest)
+	if err != nil {
+		fatal("比较接口契约失败", "error", err)
+	}
+	fmt.Printf("%s (%s) -> %s (%s)\n", oldManifest.Version, oldManifest.Commit, newManifest.Version, newManifest.Commit)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if compat.HasBreaking(problems) {
+		fmt.Println("存在不兼容的改动，不能与旧版本混合部署")
+		os.Exit(1)
+	}
+	fmt.Println("可以与旧版本混合部署")
+}
+
+// loadManifest 读取JSON文件，或执行二进制文件的schema子命令
+func loadManifest(path string) (*compat.Manifest, error) {
+	var data []byte
+	var err error
+	if strings.HasSuffix(path, ".json") {
+		data, err = os.ReadFile(path)
+	} else {
+		var stderr bytes.Buffer
+		cmd := exec.Command(path, "schema")
+		cmd.Stderr = &stderr
+		if data, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("执行 %s schema 失败: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest compat.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	if manifest.GraphQL == "" {
+		return nil, fmt.Errorf("%s 中没有GraphQL Schema，旧版本可能不支持schema子命令", path)
+	}
+	return &manifest, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+)
+
+// runCheckConsistency 比较各投票活动user_votes中的票数与按投票日志统计的票数、Redis中缓存的票数与主库的票数，
+// 并列出各分区的消费积压；票数或缓存不一致时以状态码1退出
+// -repair时以投票日志为准修正不一致的票数，并删除不一致的用户的票数缓存
+func runCheckConsistency(args []string) {
+	fs, configPath := newFlagSet("check-consistency")
+	pollID := fs.String("poll", "", "检查的投票活动，为空时检查所有投票活动")
+	repair := fs.Bool("repair", false, "以投票日志为准修正不一致的票数并删除不一致的缓存")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	store, err := repository.NewStorage(logger)
+	if err != nil {
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
+	}
+	defer store.Close()
+
+	redisRepo, err := repository.NewRedisRepository(logger)
+	if err != nil {
+		fatal("初始化Redis仓库失败", "error", err)
+	}
+	defer redisRepo.Close()
+
+	checker := service.NewConsistencyChecker(store, redisRepo, logger)
+	report, err := checker.Check(context.Background(), *pollID, *repair)
+	if err != nil {
+		fatal("一致性检查失败", "error", err)
+	}
+
+	for _, m := range report.VoteMismatches {
+		logger.Warn("用户票数与投票日志不一致", "poll_id", m.PollID, "username", m.Username,
+			"votes", m.Votes, "logged_votes", m.LoggedVotes)
+	}
+	for _, m := range report.CacheMismatches {
+		logger.Warn("用户票数缓存与主库不一致", "poll_id", m.PollID, "username", m.Username,
+			"cached_votes", m.CachedVotes, "votes", m.Votes)
+	}
+	for _, lag := range report.Lags {
+		logger.Info("消费积压", "topic", lag.Topic, "group_id", lag.GroupID, "partition", lag.Partition,
+			"committed", lag.Committed, "end", lag.End, "lag", lag.Lag)
+	}
+	if report.LagError != "" {
+		logger.Warn("查询消费积压失败", "error", report.LagError)
+	}
+
+	switch {
+	case report.Consistent():
+		logger.Info("票数和缓存一致", "total_lag", report.TotalLag)
+	case report.Repaired:
+		logger.Info("已修正不一致的票数和缓存", "vote_mismatches", len(report.VoteMismatches),
+			"cache_mismatches", len(report.CacheMismatches), "repaired_votes", report.RepairedVotes,
+			"invalidated_caches", report.InvalidatedCaches)
+	default:
+		fatal("存在不一致的票数或缓存，可使用-repair修正", "vote_mismatches", len(report.VoteMismatches),
+			"cache_mismatches", len(report.CacheMismatches))
+	}
+}
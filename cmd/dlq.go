@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	intkafka "github.com/lvdashuaibi/littlevote/internal/kafka"
+)
+
+// runReplayDLQ 把死信主题中的消息写回原主题重新计票，用于修复消费失败的原因（如升级到能解析新格式版本的程序）之后
+func runReplayDLQ(args []string) {
+	fs, configPath := newFlagSet("replay-dlq")
+	maxMessages := fs.Int("max", 0, "最多重放的消息数，为0时不限制")
+	idle := fs.Duration("idle", 10*time.Second, "超过该时长没有新消息时结束，包含加入消费者组的时间")
+	dryRun := fs.Bool("dry-run", false, "只读取并统计死信消息，不写回也不提交")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	result, err := intkafka.ReplayDeadLetters(context.Background(), *maxMessages, *idle, *dryRun, logger)
+	if err != nil {
+		replayed := 0
+		if result != nil {
+			replayed = result.Replayed
+		}
+		fatal("重放死信消息失败", "replayed", replayed, "error", err)
+	}
+	logger.Info("死信消息重放完成", "replayed", result.Replayed, "by_topic", result.ByTopic, "dry_run", *dryRun)
+}
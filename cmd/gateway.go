@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/gateway"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/registry"
+)
+
+// runGateway 以网关模式启动，只依赖etcd中的实例注册表
+func runGateway(cfg *config.Config, logger *slog.Logger) {
+	instanceRegistry, err := registry.NewRegistry(logger)
+	if err != nil {
+		fatal("初始化集群注册表失败", "error", err)
+	}
+	defer instanceRegistry.Close()
+
+	gw := gateway.NewGateway(instanceRegistry, logger)
+	defer gw.Stop()
+
+	go func() {
+		if err := gw.Start(cfg.Gateway.Port); err != nil {
+			fatal("启动网关失败", "error", err)
+		}
+	}()
+
+	logger.Info("Little Vote 网关已启动", "url", fmt.Sprintf("http://localhost:%d", cfg.Gateway.Port))
+
+	// 网关只使用日志级别这一项可热加载的配置
+	config.OnReload("log", logging.ReloadConfig)
+	config.Watch(logger)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	logger.Info("正在关闭网关")
+}
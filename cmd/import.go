@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	intkafka "github.com/lvdashuaibi/littlevote/internal/kafka"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// ImportActor 命令行导入的投票在投票日志中的调用方
+const ImportActor = "import"
+
+// runImport 从旧系统导出的CSV导入投票结果：写入发件箱后立即发送到Kafka，由运行中的消费者写入投票日志并计票
+// 文件中任一行不合法时列出所有错误并以状态码1退出，不导入任何投票
+func runImport(args []string) {
+	fs, configPath := newFlagSet("import")
+	pollID := fs.String("poll", model.DefaultPollID, "文件中没有poll_id列时导入的投票活动")
+	importID := fs.String("id", "", "导入批次，缺省为文件内容的哈希；相同批次重复导入不会重复计票")
+	dryRun := fs.Bool("dry-run", false, "只校验文件，不导入")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "用法: import [-config 配置文件] [-poll 投票活动] [-id 导入批次] [-dry-run] votes.csv")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fatal("读取导入文件失败", "error", err)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	store, err := repository.NewStorage(logger)
+	if err != nil {
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
+	}
+	defer store.Close()
+
+	// 试运行不需要Kafka
+	var producer *intkafka.Producer
+	if !*dryRun {
+		if producer, err = intkafka.NewProducer(logger); err != nil {
+			fatal("初始化Kafka生产者失败", "error", err)
+		}
+		defer producer.Close()
+	}
+	relay := service.NewOutboxRelay(store, producer, logger)
+
+	// 导入的投票事件共用一个请求ID，消费者落库时的日志可以追溯到本次导入
+	requestID := requestctx.NewRequestID()
+	ctx := logging.WithRequestID(context.Background(), requestID)
+	result, err := service.NewVoteImporter(store, relay, logger).Import(ctx, data, service.ImportOptions{
+		ImportID: *importID,
+		PollID:   *pollID,
+		DryRun:   *dryRun,
+		Audit:    model.VoteAudit{Actor: ImportActor, RequestID: requestID},
+	})
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		for _, fe := range fieldErrs {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", fe.Field, fe.Message)
+		}
+		store.Close()
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal("导入投票失败", "error", err)
+	}
+
+	fmt.Printf("导入批次: %s\n票据版本: %s\n行数: %d\n票数: %d\n投票事件: %d\n",
+		result.ID, result.TicketVersion, result.Rows, result.Votes, result.Events)
+	if result.DryRun {
+		fmt.Println("试运行，未导入任何投票")
+		return
+	}
+
+	// 中继未发送的事件留在发件箱中，由运行中的实例继续发送
+	if _, err := relay.Flush(); err != nil {
+		logger.Warn("发送发件箱失败，投票已写入发件箱，将由运行中的实例发送", "error", err)
+	}
+}
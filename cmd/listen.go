@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+// 监听端口的分配方式
+const (
+	portModeOffset  = "offset"  // port + 实例ID - 1
+	portModeFixed   = "fixed"   // 所有实例都使用port
+	portModeDynamic = "dynamic" // 由系统分配空闲端口
+)
+
+// listenConfig 本实例的监听端口和注册地址
+type listenConfig struct {
+	port          int // GraphQL服务端口，0表示由系统分配
+	grpcPort      int // gRPC服务端口，0表示由系统分配
+	advertiseHost string
+}
+
+// resolveListenConfig 按server.instances和server.port_mode确定本实例的监听端口，
+// 实际端口在监听之后写入实例注册表，反向代理和网关不需要知道实例编号与端口的对应关系
+func resolveListenConfig(instanceID int) (*listenConfig, error) {
+	cfg := config.AppConfig
+	lc := &listenConfig{advertiseHost: cfg.Server.AdvertiseHost}
+
+	switch cfg.Server.PortMode {
+	case "", portModeOffset:
+		lc.port = cfg.Server.Port + instanceID - 1
+		lc.grpcPort = cfg.GRPC.Port + instanceID - 1
+	case portModeFixed:
+		lc.port = cfg.Server.Port
+		lc.grpcPort = cfg.GRPC.Port
+	case portModeDynamic:
+	default:
+		return nil, fmt.Errorf("不支持的server.port_mode: %s", cfg.Server.PortMode)
+	}
+
+	if instance, ok := cfg.Server.Instances[strconv.Itoa(instanceID)]; ok {
+		if instance.Port > 0 {
+			lc.port = instance.Port
+		}
+		if instance.GRPCPort > 0 {
+			lc.grpcPort = instance.GRPCPort
+		}
+		if instance.AdvertiseHost != "" {
+			lc.advertiseHost = instance.AdvertiseHost
+		}
+	}
+
+	if lc.advertiseHost == "" {
+		lc.advertiseHost, _ = os.Hostname()
+	}
+	return lc, nil
+}
+
+// listen 监听TCP端口，返回监听器和实际端口，port为0时由系统分配
+func listen(port int) (net.Listener, int, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, 0, fmt.Errorf("监听端口 %d 失败: %w", port, err)
+	}
+	return listener, listener.Addr().(*net.TCPAddr).Port, nil
+}
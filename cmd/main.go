@@ -1,134 +1,460 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/analytics"
 	"github.com/lvdashuaibi/littlevote/internal/api/graph"
+	intgrpc "github.com/lvdashuaibi/littlevote/internal/api/grpc"
+	"github.com/lvdashuaibi/littlevote/internal/api/rest"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/buildinfo"
+	"github.com/lvdashuaibi/littlevote/internal/cache"
+	"github.com/lvdashuaibi/littlevote/internal/control"
+	"github.com/lvdashuaibi/littlevote/internal/health"
 	intkafka "github.com/lvdashuaibi/littlevote/internal/kafka"
 	"github.com/lvdashuaibi/littlevote/internal/lock"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/push"
+	"github.com/lvdashuaibi/littlevote/internal/registry"
 	"github.com/lvdashuaibi/littlevote/internal/repository"
 	"github.com/lvdashuaibi/littlevote/internal/service"
 	"github.com/lvdashuaibi/littlevote/internal/ticket"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+	"github.com/lvdashuaibi/littlevote/internal/webhook"
 )
 
 const (
-	ServiceStartLockName = "littlevote:service:start:lock"
-	LockAcquireTimeout   = 30 * time.Second
-)
-
-var (
-	configPath = flag.String("config", "config/config.yaml", "配置文件路径")
-	instanceID = flag.Int("instance", 1, "实例ID，用于区分多个实例")
+	ProducerElectionName = "littlevote:producer:election"
 )
 
 func main() {
+	// 第一个非flag参数作为子命令，缺省为serve以兼容原有启动方式
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "serve":
+		runServe(args)
+	case "cleanup-tickets":
+		runCleanupTickets(args)
+	case "rebuild-projection":
+		runRebuildProjection(args)
+	case "selfcheck":
+		runSelfcheck(args)
+	case "schema":
+		runSchema(args)
+	case "compat-check":
+		runCompatCheck(args)
+	case "import":
+		runImport(args)
+	case "migrate":
+		runMigrate(args)
+	case "produce-ticket":
+		runProduceTicket(args)
+	case "replay-dlq":
+		runReplayDLQ(args)
+	case "backfill-cache":
+		runBackfillCache(args)
+	case "check-consistency":
+		runCheckConsistency(args)
+	case "help":
+		printUsage()
+	default:
+		printUsage()
+		fatal("未知的子命令", "command", cmd)
+	}
+}
+
+// subcommands 子命令及说明，help输出的顺序；各子命令的参数用 <子命令> -h 查看
+var subcommands = [][2]string{
+	{"serve", "启动投票服务（缺省）"},
+	{"migrate", "执行、回滚或查看数据库迁移：migrate up|down|status"},
+	{"produce-ticket", "立即为投票活动签发一张新票据"},
+	{"replay-dlq", "把死信主题中的消息写回原主题重新计票"},
+	{"backfill-cache", "从数据库重新填充Redis中的票数缓存、排行榜和当前票据"},
+	{"check-consistency", "检查票数与投票日志是否一致，可选修正"},
+	{"cleanup-tickets", "立即清理一次过期票据"},
+	{"rebuild-projection", "事件溯源模式下从投票日志重建票数"},
+	{"selfcheck", "端到端自检投票链路"},
+	{"import", "从旧系统导入投票结果"},
+	{"schema", "输出本版本的接口契约"},
+	{"compat-check", "检查新旧版本能否混合部署"},
+}
+
+// printUsage 输出子命令列表
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法: littlevote <子命令> [参数]")
+	for _, sub := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", sub[0], sub[1])
+	}
+}
+
+// newFlagSet 创建子命令的参数集合，所有子命令都支持-config
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	configPath := fs.String("config", "config/config.yaml", "配置文件路径")
+	return fs, configPath
+}
+
+// setupLogging 按log配置设置默认日志，子命令加载配置后调用
+func setupLogging(cfg *config.Config) *slog.Logger {
+	logger, err := logging.Setup(cfg.Log)
+	if err != nil {
+		fatal("日志配置错误", "error", err)
+	}
+	return logger
+}
+
+// fatal 记录错误后退出，用于启动阶段无法继续的错误
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// storageDriver 日志中展示的持久化存储名称
+func storageDriver() string {
+	if config.AppConfig.Storage.Driver == repository.DriverPostgres {
+		return "PostgreSQL"
+	}
+	return "MySQL"
+}
+
+// lockBackend 返回分布式锁后端的名称，用于日志和健康检查
+func lockBackend() string {
+	if config.AppConfig.Lock.Backend == lock.BackendConsul {
+		return lock.BackendConsul
+	}
+	return lock.BackendETCD
+}
+
+// runServe 启动投票服务
+func runServe(args []string) {
 	// 解析命令行参数
-	flag.Parse()
+	fs, configPath := newFlagSet("serve")
+	instanceID := fs.Int("instance", 1, "实例ID，用于区分多个实例")
+	gatewayMode := fs.Bool("gateway", false, "以网关模式启动，将请求负载均衡到注册表中的实例")
+	readOnly := fs.Bool("read-only", false, "以只读副本模式启动，只提供查询")
+	fs.Parse(args)
 
 	// 加载配置
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("加载配置失败: %v", err)
+		fatal("加载配置失败", "error", err)
 	}
-	log.Printf("配置加载成功，当前实例ID: %d", *instanceID)
+	logger := setupLogging(cfg)
+
+	if *gatewayMode {
+		runGateway(cfg, logger)
+		return
+	}
+	cfg.Server.InstanceID = *instanceID
+	config.MarkFlagOverride("server.instance_id")
+	if *readOnly {
+		cfg.Server.ReadOnly = true
+		config.MarkFlagOverride("server.read_only")
+	}
+	if _, err := validation.CurrentUsernameRule(); err != nil {
+		fatal("用户名规则配置错误", "error", err)
+	}
+	if cfg.GraphQL.Disabled && !cfg.REST.Enabled && !cfg.GRPC.Enabled {
+		fatal("关闭GraphQL接口时需要开启REST或gRPC接口")
+	}
+	logger.Info("配置加载成功", "instance", *instanceID)
 
 	// 创建数据库连接
-	mysqlRepo, err := repository.NewMySQLRepository()
+	store, err := repository.NewStorage(logger)
 	if err != nil {
-		log.Fatalf("初始化MySQL仓库失败: %v", err)
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
 	}
-	defer mysqlRepo.Close()
-	log.Printf("MySQL仓库初始化成功")
+	defer store.Close()
+	logger.Info("持久化存储初始化成功", "driver", storageDriver())
 
 	// 创建Redis连接
-	redisRepo, err := repository.NewRedisRepository()
+	redisRepo, err := repository.NewRedisRepository(logger)
 	if err != nil {
-		log.Fatalf("初始化Redis仓库失败: %v", err)
+		fatal("初始化Redis仓库失败", "error", err)
 	}
 	defer redisRepo.Close()
-	log.Printf("Redis仓库初始化成功")
+	logger.Info("Redis仓库初始化成功")
 
-	// 创建分布式锁
-	distributedLock, err := lock.NewETCDLock()
-	if err != nil {
-		log.Fatalf("初始化ETCD分布式锁失败: %v", err)
+	// 票据服务和投票服务读取用户票数、最新票据版本时先查询进程内缓存
+	var cacheRepo repository.CacheRepository = redisRepo
+	if cfg.Cache.Local.Enabled {
+		localCache := cache.NewLocal(redisRepo, redisRepo, logger)
+		localCache.Start()
+		defer localCache.Stop()
+		cacheRepo = localCache
 	}
-	defer distributedLock.Close()
-	log.Printf("ETCD分布式锁初始化成功")
 
-	// 获取服务启动锁
-	lockAcquired, err := distributedLock.AcquireLock(ServiceStartLockName, LockAcquireTimeout)
+	// 创建分布式锁
+	distributedLock, err := lock.NewBackend(logger)
 	if err != nil {
-		log.Printf("获取服务启动锁失败: %v，将以非票据生产者模式启动", err)
-	}
-
-	var isTicketProducer bool
-	if lockAcquired {
-		log.Printf("实例 %d 获取服务启动锁成功，将作为票据生产者启动", *instanceID)
-		isTicketProducer = true
-		defer distributedLock.ReleaseLock(ServiceStartLockName)
-	} else {
-		log.Printf("实例 %d 未获取到服务启动锁，以普通节点模式启动", *instanceID)
-		isTicketProducer = false
+		fatal("初始化分布式锁失败", "backend", lockBackend(), "error", err)
 	}
+	defer distributedLock.Close()
+	logger.Info("分布式锁初始化成功", "backend", lockBackend())
 
 	// 创建Kafka生产者
-	producer, err := intkafka.NewProducer()
+	producer, err := intkafka.NewProducer(logger)
 	if err != nil {
-		log.Fatalf("初始化Kafka生产者失败: %v", err)
+		fatal("初始化Kafka生产者失败", "error", err)
 	}
 	defer producer.Close()
-	log.Printf("Kafka生产者初始化成功")
+	logger.Info("Kafka生产者初始化成功")
 
 	// 创建Kafka消费者
-	consumer, err := intkafka.NewConsumer()
+	consumer, err := intkafka.NewConsumer(logger)
 	if err != nil {
-		log.Fatalf("初始化Kafka消费者失败: %v", err)
+		fatal("初始化Kafka消费者失败", "error", err)
 	}
 	defer consumer.Stop()
-	log.Printf("Kafka消费者初始化成功")
+	logger.Info("Kafka消费者初始化成功")
 
-	// 创建票据服务
-	ticketService := ticket.NewTicketService(redisRepo, mysqlRepo, distributedLock, isTicketProducer)
+	// 创建票据服务，票据生产者由选举产生，启动时均以普通节点模式启动
+	ticketService := ticket.NewTicketService(cacheRepo, store, distributedLock, false, logger)
+	// 票据即将耗尽时通过webhook推送预警
+	ticketService.SetWarningNotifier(webhook.NewPublisher(logger))
 
-	// 启动票据生产器 (只有获取锁的实例才会真正生成票据)
+	// 启动票据生产器 (只有当选的实例才会真正生成票据)
 	ticketService.StartTicketProducer()
 	defer ticketService.StopTicketProducer()
-	log.Printf("票据服务初始化成功，票据生产者模式: %v", isTicketProducer)
+	logger.Info("票据服务初始化成功")
+
+	// 过期票据和票据历史的清理由各实例通过分布式锁选主执行，只读副本不参与
+	if !cfg.Server.ReadOnly {
+		cleanupJob := ticket.NewCleanupJob(store, distributedLock, logger)
+		cleanupJob.Start()
+		defer cleanupJob.Stop()
+	}
+
+	// 发件箱中继把已受理的投票事件发送到Kafka，只读副本不受理投票
+	outboxRelay := service.NewOutboxRelay(store, producer, logger)
+	// 集群范围的中继开关，暂停期间投票事件留在发件箱中
+	outboxControl, err := control.NewOutboxControl(logger)
+	if err != nil {
+		fatal("初始化发件箱中继开关失败", "error", err)
+	}
+	defer outboxControl.Close()
+	outboxRelay.SetControl(outboxControl)
+	if !cfg.Server.ReadOnly {
+		outboxRelay.Start()
+		defer outboxRelay.Stop()
+	}
 
 	// 创建投票服务
-	voteService := service.NewVoteService(mysqlRepo, redisRepo, ticketService, producer)
-	log.Printf("投票服务初始化成功")
+	voteService := service.NewVoteService(store, cacheRepo, ticketService, outboxRelay, logger)
+	defer voteService.Stop()
+	logger.Info("投票服务初始化成功")
 
-	// 启动Kafka消费者
-	consumer.StartConsuming(voteService.ProcessVoteEvent)
-	log.Printf("Kafka消费者已启动")
+	// 一致性检查直接读取Redis，不经过本实例的进程内缓存
+	consistencyChecker := service.NewConsistencyChecker(store, redisRepo, logger)
 
-	// 创建GraphQL服务
-	graphqlServer := graph.NewGraphQLServer(voteService)
-	log.Printf("GraphQL服务初始化成功")
+	// 票据生产者同时负责定期保存排名快照、对账排行榜、事件溯源模式下把投票日志投影到票数、释放超时未确认的投票预约、检查票数一致性
+	// 这些任务随生产者身份启停，生产者切换后由新当选的实例接手
+	jobs := newProducerJobs(func() []producerJob {
+		return []producerJob{
+			service.NewSnapshotJob(store, logger),
+			service.NewLeaderboardJob(store, redisRepo, ticketService, logger),
+			service.NewProjector(store, redisRepo, logger),
+			service.NewReservationSweeper(redisRepo, logger),
+			service.NewConsistencyJob(consistencyChecker, logger),
+		}
+	})
+	defer jobs.stop()
+
+	// 参与票据生产者选举，生产者宕机后其他实例自动当选；只读副本不参与
+	if cfg.Server.ReadOnly {
+		logger.Info("以只读副本模式启动", "instance", *instanceID)
+	} else {
+		election := distributedLock.NewElection(ProducerElectionName, logger)
+		ticketService.JoinElection(election, jobs.start, jobs.stop)
+		logger.Info("已参与票据生产者选举", "instance", *instanceID)
+	}
+
+	// 集群范围的消费开关，暂停期间消费者不再拉取消息
+	consumption, err := control.NewConsumptionControl(logger)
+	if err != nil {
+		fatal("初始化消费开关失败", "error", err)
+	}
+	defer consumption.Close()
+	consumer.SetGate(consumption)
+	consumer.SetOffsetStore(store)
+	// 配置了死信主题时，无法处理的消息写入死信主题，由replay-dlq子命令重放
+	consumer.SetDeadLetter(intkafka.NewDeadLetter(logger))
+
+	// 启动Kafka消费者，只读副本不写入数据库；开启推送时把落库的投票事件发布给所有实例
+	if !cfg.Server.ReadOnly {
+		if cfg.Push.Enabled {
+			voteService.SetVotePublisher(redisRepo)
+		}
+		consumer.SetBatchHandler(func(ctx context.Context, events []*model.VoteEvent) error {
+			return voteService.ProcessVoteEventBatch(ctx, events)
+		})
+		consumer.StartConsuming(voteService.ProcessVoteEvent)
+		logger.Info("Kafka消费者已启动")
+	}
+
+	// 把投票事件镜像到分析存储，只读副本不参与
+	if cfg.Analytics.Enabled && !cfg.Server.ReadOnly {
+		sink, err := analytics.NewSink()
+		if err != nil {
+			fatal("初始化分析存储失败", "error", err)
+		}
+		mirror := analytics.NewMirror(sink, logger)
+		mirror.Start()
+		defer mirror.Stop()
+	}
+
+	// 定期统计投票积压并上报指标
+	queueInspector := service.NewQueueInspector(producer, consumer, store, logger)
+	queueInspector.Start()
+	defer queueInspector.Stop()
+
+	// 确定监听端口并开始监听，注册到集群的是实际监听的端口
+	listenCfg, err := resolveListenConfig(*instanceID)
+	if err != nil {
+		fatal("解析监听配置失败", "error", err)
+	}
+	httpListener, serverPort, err := listen(listenCfg.port)
+	if err != nil {
+		fatal("启动GraphQL服务器失败", "error", err)
+	}
+	var grpcListener net.Listener
+	grpcPort := 0
+	if cfg.GRPC.Enabled {
+		if grpcListener, grpcPort, err = listen(listenCfg.grpcPort); err != nil {
+			fatal("启动gRPC服务器失败", "error", err)
+		}
+	}
+
+	// 注册到集群成员表，并周期性上报心跳
+	instanceRegistry, err := registry.NewRegistry(logger)
+	if err != nil {
+		fatal("初始化集群注册表失败", "error", err)
+	}
+	defer instanceRegistry.Close()
+
+	self := &model.Instance{
+		ID:        *instanceID,
+		Host:      listenCfg.advertiseHost,
+		Port:      serverPort,
+		GRPCPort:  grpcPort,
+		Version:   buildinfo.Version,
+		StartedAt: buildinfo.StartedAt,
+	}
+	role := func() string {
+		if cfg.Server.ReadOnly {
+			return registry.RoleReplica
+		}
+		if ticketService.IsLeading() {
+			return registry.RoleProducer
+		}
+		return registry.RoleWorker
+	}
+	if err := instanceRegistry.Register(self, role); err != nil {
+		logger.Error("注册实例失败", "error", err)
+	}
+
+	// 存活和就绪检查覆盖本实例依赖的所有外部服务
+	healthChecker := health.NewChecker()
+	healthChecker.Register(strings.ToLower(storageDriver()), func(ctx context.Context) error { return store.Ping() })
+	healthChecker.Register("redis", redisRepo.Ping)
+	healthChecker.Register("kafka", producer.Ping)
+	healthChecker.Register(lockBackend(), distributedLock.Ping)
 
-	// 计算端口，支持多实例
-	serverPort := cfg.Server.Port + *instanceID - 1
+	// 配置文件修改后热加载日志级别、缓存有效期、票据刷新间隔和使用次数、投票限流
+	rateLimiter := service.NewRateLimiter(redisRepo, logger)
+	config.OnReload("log", logging.ReloadConfig)
+	config.OnReload("redis", redisRepo.ReloadConfig)
+	config.OnReload("ticket", ticketService.ReloadConfig)
+	config.OnReload("ratelimit", rateLimiter.ReloadConfig)
+	config.Watch(logger)
+
+	// REST接口与GraphQL接口共用HTTP端口和同一个投票服务
+	var restHandler http.Handler
+	if cfg.REST.Enabled {
+		restHandler = rest.NewHandler(voteService, rateLimiter, logger)
+		logger.Info("REST接口已开启", "prefix", rest.Prefix())
+	}
+
+	// 各实例通过Redis频道接收所有实例落库的投票事件，推送给连接到本实例的WebSocket客户端
+	var pushHandler http.Handler
+	if cfg.Push.Enabled {
+		hub := push.NewHub(redisRepo, logger)
+		hub.Start()
+		defer hub.Stop()
+		pushHandler = hub
+	}
+
+	// GraphQL、REST和gRPC接口共用同一个API密钥认证器
+	authenticator := auth.NewAuthenticator(store, logger)
+
+	// 创建GraphQL服务
+	graphqlServer := graph.NewGraphQLServer(graph.Services{
+		VoteService:   voteService,
+		TicketService: ticketService,
+		Registry:      instanceRegistry,
+		Queue:         queueInspector,
+		Consumption:   consumption,
+		Outbox:        outboxRelay,
+		OutboxControl: outboxControl,
+		Health:        healthChecker,
+		RateLimiter:   rateLimiter,
+		Auth:          authenticator,
+		Importer:      service.NewVoteImporter(store, outboxRelay, logger),
+		Consistency:   consistencyChecker,
+		REST:          restHandler,
+		Push:          pushHandler,
+		Role:          role,
+		Logger:        logger,
+	})
+	logger.Info("GraphQL服务初始化成功")
 
 	// 启动HTTP服务器(异步)
 	go func() {
-		if err := graphqlServer.Start(serverPort); err != nil {
-			log.Fatalf("启动GraphQL服务器失败: %v", err)
+		if err := graphqlServer.Serve(httpListener); err != nil {
+			fatal("启动GraphQL服务器失败", "error", err)
 		}
 	}()
 
-	log.Printf("Little Vote 系统 (实例 %d) 已启动，服务地址: http://localhost:%d", *instanceID, serverPort)
+	// 启动gRPC服务(异步)，与GraphQL共用同一个投票服务
+	if cfg.GRPC.Enabled {
+		grpcServer := intgrpc.NewServer(voteService, authenticator, rateLimiter, logger)
+		go func() {
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				fatal("启动gRPC服务器失败", "error", err)
+			}
+		}()
+		defer grpcServer.Stop()
+	}
+
+	logger.Info("Little Vote 系统已启动", "instance", *instanceID, "url", fmt.Sprintf("http://localhost:%d", serverPort))
 
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("正在关闭服务...")
+
+	// 先让/readyz返回不可用，等待负载均衡摘除本实例后再关闭各组件
+	healthChecker.Shutdown()
+	if delay := cfg.Health.DrainDelay; delay > 0 {
+		logger.Info("停止接收新流量，等待后关闭服务", "delay", delay)
+		time.Sleep(delay)
+	}
+	logger.Info("正在关闭服务")
 }
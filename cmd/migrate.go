@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// runMigrate 管理数据库表结构：littlevote migrate up|down|status
+// up执行尚未执行的迁移，down从最新的版本开始回滚-steps个迁移，status列出各迁移的执行状态
+// serve启动时也会执行up，部署流程可以先单独执行migrate up，迁移失败时不启动新版本
+func runMigrate(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fatal("缺少迁移操作，可选 up、down、status")
+	}
+	action, args := args[0], args[1:]
+
+	fs, configPath := newFlagSet("migrate " + action)
+	steps := fs.Int("steps", 1, "down回滚的迁移个数")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	migrator, closeDB, err := repository.OpenMigrator(logger)
+	if err != nil {
+		fatal("连接数据库失败", "driver", storageDriver(), "error", err)
+	}
+	defer closeDB()
+
+	ctx := context.Background()
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fatal("执行数据库迁移失败", "applied", applied, "error", err)
+		}
+		logger.Info("数据库迁移完成", "driver", storageDriver(), "applied", applied)
+	case "down":
+		if *steps < 1 {
+			fatal("-steps 必须大于0", "steps", *steps)
+		}
+		reverted, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			fatal("回滚数据库迁移失败", "reverted", reverted, "error", err)
+		}
+		logger.Info("数据库迁移已回滚", "driver", storageDriver(), "reverted", reverted)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fatal("查询迁移状态失败", "error", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED_AT\tREVERSIBLE")
+		for _, status := range statuses {
+			state, appliedAt := "pending", "-"
+			if status.Applied {
+				state, appliedAt = "applied", status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Unknown {
+				state = "applied (unknown)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", status.Version, state, appliedAt, status.Reversible)
+		}
+		w.Flush()
+	default:
+		fatal("未知的迁移操作，可选 up、down、status", "action", action)
+	}
+}
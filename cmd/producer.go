@@ -0,0 +1,43 @@
+package main
+
+import "sync"
+
+// producerJob 只在票据生产者上运行的后台任务
+type producerJob interface {
+	Start()
+	Stop()
+}
+
+// producerJobs 随票据生产者身份启停后台任务，任务停止后不能再次启动，每次当选时重新创建
+type producerJobs struct {
+	mu      sync.Mutex
+	create  func() []producerJob
+	running []producerJob
+}
+
+func newProducerJobs(create func() []producerJob) *producerJobs {
+	return &producerJobs{create: create}
+}
+
+// start 当选票据生产者时启动任务，已在运行时不重复启动
+func (p *producerJobs) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running != nil {
+		return
+	}
+	p.running = p.create()
+	for _, job := range p.running {
+		job.Start()
+	}
+}
+
+// stop 失去票据生产者身份或退出时停止任务，重复调用不会产生影响
+func (p *producerJobs) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, job := range p.running {
+		job.Stop()
+	}
+	p.running = nil
+}
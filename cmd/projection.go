@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// runRebuildProjection 从投票日志完整重建用户票数和票据剩余次数
+func runRebuildProjection(args []string) {
+	fs, configPath := newFlagSet("rebuild-projection")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	store, err := repository.NewStorage(logger)
+	if err != nil {
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
+	}
+	defer store.Close()
+
+	redisRepo, err := repository.NewRedisRepository(logger)
+	if err != nil {
+		fatal("初始化Redis仓库失败", "error", err)
+	}
+	defer redisRepo.Close()
+
+	lastLogID, err := store.RebuildVoteProjection()
+	if err != nil {
+		fatal("重建投影失败", "error", err)
+	}
+
+	// 重建可能修正了票数，清除用户票数缓存
+	userVotes, err := store.GetAllUserVotes("")
+	if err != nil {
+		fatal("查询用户票数失败", "error", err)
+	}
+	for _, userVote := range userVotes {
+		if err := redisRepo.DeleteUserVoteCache(userVote.PollID, userVote.Username); err != nil {
+			logger.Warn("删除用户缓存失败", "poll_id", userVote.PollID, "username", userVote.Username, "error", err)
+		}
+	}
+	logger.Info("投影重建完成", "last_log_id", lastLogID)
+}
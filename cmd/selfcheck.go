@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	intkafka "github.com/lvdashuaibi/littlevote/internal/kafka"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/receipt"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+const (
+	// SelfcheckCandidate 探测投票的候选人，不符合用户名规则，正常投票无法投给它
+	SelfcheckCandidate = "__healthcheck"
+	// SelfcheckActor 探测投票在投票日志中的调用方
+	SelfcheckActor = "selfcheck"
+
+	selfcheckPollInterval = 200 * time.Millisecond
+)
+
+// runSelfcheck 端到端检查投票链路：读取当前票据，向Kafka发送一次探测投票，等待消费者写入投票日志后删除
+// 探测投票以影子模式写入，不计入票数和统计，也不扣减票据使用次数；任一步失败时以非0状态退出，可用作深度就绪探针
+func runSelfcheck(args []string) {
+	fs, configPath := newFlagSet("selfcheck")
+	pollID := fs.String("poll", model.DefaultPollID, "检查的投票活动")
+	timeout := fs.Duration("timeout", 30*time.Second, "等待探测投票落库的最长时间")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+	if _, err := validation.ValidatePollID("poll", *pollID); err != nil {
+		fatal("投票活动不合法", "error", err)
+	}
+
+	store, err := repository.NewStorage(logger)
+	if err != nil {
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
+	}
+	defer store.Close()
+
+	redisRepo, err := repository.NewRedisRepository(logger)
+	if err != nil {
+		fatal("初始化Redis仓库失败", "error", err)
+	}
+	defer redisRepo.Close()
+
+	producer, err := intkafka.NewProducer(logger)
+	if err != nil {
+		fatal("初始化Kafka生产者失败", "error", err)
+	}
+	defer producer.Close()
+
+	start := time.Now()
+	if err := selfcheck(logger, store, redisRepo, producer, *pollID, *timeout); err != nil {
+		logger.Error("自检失败", "error", err)
+		store.Close()
+		redisRepo.Close()
+		producer.Close()
+		os.Exit(1)
+	}
+	logger.Info("自检通过", "elapsed", time.Since(start).Round(time.Millisecond))
+}
+
+// selfcheck 依次执行自检的各个步骤，返回第一个失败的步骤
+func selfcheck(logger *slog.Logger, store repository.Storage, redisRepo *repository.RedisRepository,
+	producer *intkafka.Producer, pollID string, timeout time.Duration) error {
+	// 步骤1: 读取当前票据，确认票据生产者在正常轮换
+	version, err := redisRepo.GetNewestTicketVersion(pollID)
+	if err != nil {
+		return fmt.Errorf("获取票据: %w", err)
+	}
+	if version == "" {
+		return fmt.Errorf("获取票据: 投票活动 %s 尚未生成票据", pollID)
+	}
+	if version == repository.PollClosedVersion {
+		return fmt.Errorf("获取票据: %w", repository.ErrPollClosed)
+	}
+	ticket, err := redisRepo.GetTicket(version)
+	if err != nil {
+		return fmt.Errorf("获取票据: %w", err)
+	}
+	if time.Now().After(ticket.ExpiresAt.Add(config.AppConfig.Ticket.ClockSkew)) {
+		return fmt.Errorf("获取票据: 当前票据 %s 已于 %s 过期，票据生产者可能未在运行",
+			version, ticket.ExpiresAt.Format(time.RFC3339))
+	}
+	logger.Info("[1/3] 获取票据成功", "version", version, "remaining_usages", ticket.RemainingUsages)
+
+	// 步骤2: 发送探测投票，绕过发件箱直接写入Kafka
+	eventID, err := receipt.NewEventID()
+	if err != nil {
+		return fmt.Errorf("生成投票事件ID失败: %w", err)
+	}
+	event := &model.VoteEvent{
+		EventID:       eventID,
+		PollID:        pollID,
+		Usernames:     []string{SelfcheckCandidate},
+		TicketVersion: version,
+		Audit:         model.VoteAudit{Actor: SelfcheckActor},
+		VotedAt:       time.Now(),
+		// 探测投票不占用票据的使用次数
+		TicketConsumed: true,
+		Shadow:         true,
+	}
+	if err := producer.SendVoteEvent(event); err != nil {
+		return fmt.Errorf("发送探测投票: %w", err)
+	}
+	logger.Info("[2/3] 探测投票已写入Kafka", "event_id", eventID)
+
+	// 步骤3: 等待消费者写入投票日志，确认后删除
+	defer func() {
+		deleted, err := store.DeleteVoteLogsByEventID(eventID)
+		if err != nil {
+			logger.Error("清理探测投票失败，请手动删除该事件的投票日志", "event_id", eventID, "error", err)
+			return
+		}
+		logger.Info("已清理探测投票的投票日志", "deleted", deleted)
+	}()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		logs, err := store.GetVoteLogsByEventID(eventID)
+		if err != nil {
+			return fmt.Errorf("查询投票日志: %w", err)
+		}
+		if len(logs) > 0 {
+			logger.Info("[3/3] 探测投票已落库", "vote_log_id", logs[0].ID,
+				"latency", time.Since(event.VotedAt).Round(time.Millisecond))
+			return nil
+		}
+		if time.Now().After(deadline) {
+			// 之后才落库的探测投票是影子投票，不影响票数，可按actor=selfcheck清理
+			return fmt.Errorf("探测投票在 %s 内未落库，请检查消费者是否在运行或被暂停", timeout)
+		}
+		time.Sleep(selfcheckPollInterval)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/lock"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+)
+
+// produceTicketRetryInterval 票据生成器锁被占用时重试的间隔
+const produceTicketRetryInterval = 500 * time.Millisecond
+
+// runProduceTicket 立即为投票活动签发一张新票据，不需要等待下一次轮换，例如票据值泄露后
+func runProduceTicket(args []string) {
+	fs, configPath := newFlagSet("produce-ticket")
+	pollID := fs.String("poll", model.DefaultPollID, "签发票据的投票活动")
+	wait := fs.Duration("wait", 10*time.Second, "票据生成器锁被占用时最多等待的时长")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fatal("加载配置失败", "error", err)
+	}
+	logger := setupLogging(cfg)
+
+	store, err := repository.NewStorage(logger)
+	if err != nil {
+		fatal("初始化持久化存储失败", "driver", storageDriver(), "error", err)
+	}
+	defer store.Close()
+
+	redisRepo, err := repository.NewRedisRepository(logger)
+	if err != nil {
+		fatal("初始化Redis仓库失败", "error", err)
+	}
+	defer redisRepo.Close()
+
+	distributedLock, err := lock.NewBackend(logger)
+	if err != nil {
+		fatal("初始化分布式锁失败", "backend", lockBackend(), "error", err)
+	}
+	defer distributedLock.Close()
+
+	// 与票据生产者竞争同一把锁，生产者刷新期间短暂持有，等待后重试
+	ticketService := ticket.NewTicketService(redisRepo, store, distributedLock, false, logger)
+	deadline := time.Now().Add(*wait)
+	for {
+		version, err := ticketService.ProduceTicket(*pollID)
+		if err == nil {
+			logger.Info("已签发新票据", "poll_id", *pollID, "version", version)
+			return
+		}
+		if !errors.Is(err, ticket.ErrProducerBusy) || time.Now().After(deadline) {
+			fatal("签发票据失败", "poll_id", *pollID, "error", err)
+		}
+		time.Sleep(produceTicketRetryInterval)
+	}
+}
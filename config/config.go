@@ -8,17 +8,63 @@ import (
 )
 
 type Config struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	MySQL   MySQLConfig   `mapstructure:"mysql"`
-	Redis   RedisConfig   `mapstructure:"redis"`
-	Kafka   KafkaConfig   `mapstructure:"kafka"`
-	Ticket  TicketConfig  `mapstructure:"ticket"`
-	ETCD    ETCDConfig    `mapstructure:"etcd"`
-	GraphQL GraphQLConfig `mapstructure:"graphql"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	MySQL       MySQLConfig       `mapstructure:"mysql"`
+	Postgres    PostgresConfig    `mapstructure:"postgres"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Kafka       KafkaConfig       `mapstructure:"kafka"`
+	Ticket      TicketConfig      `mapstructure:"ticket"`
+	ETCD        ETCDConfig        `mapstructure:"etcd"`
+	Lock        LockConfig        `mapstructure:"lock"`
+	Consul      ConsulConfig      `mapstructure:"consul"`
+	GraphQL     GraphQLConfig     `mapstructure:"graphql"`
+	GRPC        GRPCConfig        `mapstructure:"grpc"`
+	REST        RESTConfig        `mapstructure:"rest"`
+	Push        PushConfig        `mapstructure:"push"`
+	Cleanup     CleanupConfig     `mapstructure:"cleanup"`
+	Gateway     GatewayConfig     `mapstructure:"gateway"`
+	Health      HealthConfig      `mapstructure:"health"`
+	RateLimit   RateLimitConfig   `mapstructure:"ratelimit"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Vote        VoteConfig        `mapstructure:"vote"`
+	Snapshot    SnapshotConfig    `mapstructure:"snapshot"`
+	Leaderboard LeaderboardConfig `mapstructure:"leaderboard"`
+	Projection  ProjectionConfig  `mapstructure:"projection"`
+	Analytics   AnalyticsConfig   `mapstructure:"analytics"`
+	Outbox      OutboxConfig      `mapstructure:"outbox"`
+	Webhook     WebhookConfig     `mapstructure:"webhook"`
+	Log         LogConfig         `mapstructure:"log"`
+
+	// ConsistencyCheck 票据生产者定期检查票数、缓存和消费积压，与查询使用的一致性级别无关
+	ConsistencyCheck ConsistencyCheckConfig `mapstructure:"consistency_check"`
 }
 
 type ServerConfig struct {
-	Port int `mapstructure:"port"`
+	Port          int    `mapstructure:"port"`
+	InstanceID    int    `mapstructure:"instance_id"`    // 启动时由-instance参数设置
+	AdvertiseHost string `mapstructure:"advertise_host"` // 注册到集群的主机地址，为空时使用主机名
+	ReadOnly      bool   `mapstructure:"read_only"`      // 只读副本模式，只提供查询，拒绝所有变更
+	PrimaryURL    string `mapstructure:"primary_url"`    // 只读模式下拒绝变更时提示客户端改用的可写地址
+	// PortMode 实例监听端口的分配方式: offset（port + 实例ID - 1，兼容原有部署）/ fixed（所有实例都使用port）/ dynamic（由系统分配空闲端口）
+	PortMode string `mapstructure:"port_mode"`
+	// Instances 按实例ID显式配置的监听端口和注册地址，优先于port_mode
+	Instances map[string]InstanceServerConfig `mapstructure:"instances"`
+	// TrustedProxies 可信代理（如网关）的CIDR或IP，只有来自这些地址的连接才读取X-Forwarded-For；为空时始终使用连接的远端IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// InstanceServerConfig 单个实例的监听端口和注册地址，未配置的项沿用server的全局配置
+type InstanceServerConfig struct {
+	Port          int    `mapstructure:"port"`           // GraphQL服务端口
+	GRPCPort      int    `mapstructure:"grpc_port"`      // gRPC服务端口
+	AdvertiseHost string `mapstructure:"advertise_host"` // 注册到集群的主机地址
+}
+
+// StorageConfig 持久化存储的选择
+type StorageConfig struct {
+	Driver string `mapstructure:"driver"` // mysql / postgres，为空时为mysql
 }
 
 type MySQLConfig struct {
@@ -28,6 +74,14 @@ type MySQLConfig struct {
 	MaxIdleConns int    `mapstructure:"max_idle_conns"`
 }
 
+// PostgresConfig storage.driver为postgres时使用，表结构在启动时由内置的迁移脚本创建
+type PostgresConfig struct {
+	Master       string `mapstructure:"master"`
+	Slave        string `mapstructure:"slave"` // 只读副本，为空时读写都走主库
+	MaxOpenConns int    `mapstructure:"max_open_conns"`
+	MaxIdleConns int    `mapstructure:"max_idle_conns"`
+}
+
 type RedisConfig struct {
 	// 数据存储Redis
 	DataAddress string        `mapstructure:"data_address"`
@@ -38,7 +92,28 @@ type RedisConfig struct {
 	Timeout     time.Duration `mapstructure:"timeout"`
 
 	// Redlock使用的Redis节点
-	LockAddresses []string `mapstructure:"lock_addresses"`
+	LockAddresses      []string      `mapstructure:"lock_addresses"`
+	LockHealthInterval time.Duration `mapstructure:"lock_health_interval"` // 检查锁节点可达性的间隔
+}
+
+// CacheConfig Redis中用户票数和票据缓存的有效期与更新策略
+type CacheConfig struct {
+	UserVoteTTL time.Duration `mapstructure:"user_vote_ttl"` // 用户票数缓存的有效期，为0时为1小时
+	TicketTTL   time.Duration `mapstructure:"ticket_ttl"`    // 票据在Redis中的保留时长，为0时为10秒
+	// Jitter 用户票数缓存有效期的随机抖动比例(0-1)，有效期在ttl*(1±jitter)之间，避免同时写入的缓存同时过期
+	Jitter float64 `mapstructure:"jitter"`
+	// Strategy 投票落库后用户票数缓存的更新方式: cache_aside（删除缓存，查询时回源，默认）/ write_through（从主库读取最新票数写入缓存）
+	Strategy string `mapstructure:"strategy"`
+	// Local Redis之前的进程内缓存
+	Local LocalCacheConfig `mapstructure:"local"`
+}
+
+// LocalCacheConfig 用户票数和最新票据版本的进程内LRU缓存，通过Redis频道接收其他实例的失效通知
+type LocalCacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Size    int           `mapstructure:"size"`    // 每类数据最多缓存的条目数，为0时为10000
+	TTL     time.Duration `mapstructure:"ttl"`     // 条目的有效期，错过失效通知时最多读到该时长之前的数据，为0时为1秒
+	Channel string        `mapstructure:"channel"` // 失效通知使用的Redis频道，为空时为littlevote:cache:invalidate
 }
 
 type KafkaConfig struct {
@@ -46,13 +121,109 @@ type KafkaConfig struct {
 	Topic     string   `mapstructure:"topic"`
 	Partition int      `mapstructure:"partition"`
 	GroupID   string   `mapstructure:"group_id"`
+
+	KeyStrategy string `mapstructure:"key_strategy"` // 投票事件的分区策略: username / ticket_version / round_robin
+	FanOut      bool   `mapstructure:"fan_out"`      // 是否把多用户投票拆分为每个用户一条事件
+
+	// EventSchemaVersion 生产者写入的投票事件格式版本，1为JSON，2允许压缩，3为Protobuf，所有消费者升级后再提高
+	EventSchemaVersion int `mapstructure:"event_schema_version"`
+	// CompressMinUsernames 格式版本为2或3时，用户名数量达到该值的事件以gzip压缩，为0时不压缩
+	CompressMinUsernames int `mapstructure:"compress_min_usernames"`
+
+	LagCheckInterval time.Duration `mapstructure:"lag_check_interval"` // 更新投票队列积压指标的间隔
+
+	// ConsumerDedupeSize 计票消费者记住的最近处理过的事件数，重投的事件直接跳过，为0时不过滤
+	ConsumerDedupeSize int `mapstructure:"consumer_dedupe_size"`
+	// ConsumerSlowThreshold 处理单个事件超过该时长时记录慢事件日志，为0时不记录
+	ConsumerSlowThreshold time.Duration `mapstructure:"consumer_slow_threshold"`
+	// ConsumerMode 默认主题的消费方式：group为消费者组（默认）；partition按分区静态分配，只在需要固定分区归属时使用
+	ConsumerMode string `mapstructure:"consumer_mode"`
+	// ConsumerWorkers 消费者组模式下本实例消费默认主题的工作线程数，每个工作线程是组内的一个成员，为0时为8
+	ConsumerWorkers int `mapstructure:"consumer_workers"`
+	// ConsumerPartitions 静态分配模式下本实例读取的分区，每个分区一个工作线程，为空时读取所有分区
+	ConsumerPartitions []int `mapstructure:"consumer_partitions"`
+	// ConsumerPoolSize 处理线程池的线程数，同一分区的消息由同一个线程按顺序处理，为0时不启用，各工作线程自己处理拉取的消息
+	ConsumerPoolSize int `mapstructure:"consumer_pool_size"`
+	// ConsumerMaxInFlight 启用处理线程池时本实例已拉取、尚未处理完的消息数上限，达到上限时停止拉取，为0时为处理线程数的16倍
+	ConsumerMaxInFlight int `mapstructure:"consumer_max_in_flight"`
+	// ConsumerBatchSize 批量消费模式下一个数据库事务最多处理的事件数，为0或1时逐条处理
+	ConsumerBatchSize int `mapstructure:"consumer_batch_size"`
+	// ConsumerBatchInterval 批量消费模式下收到第一条消息后最多等待的时长，不足一批时也开始处理
+	ConsumerBatchInterval time.Duration `mapstructure:"consumer_batch_interval"`
+
+	// DeadLetterTopic 计票消费者无法解析或最终处理失败的消息写入该主题，由replay-dlq子命令写回原主题；为空时只记录日志后跳过
+	DeadLetterTopic string `mapstructure:"dead_letter_topic"`
+
+	// Polls 为高流量投票活动指定专属的主题和消费者组，键为投票活动ID
+	Polls map[string]KafkaPollConfig `mapstructure:"polls"`
+	// ConsumeTopics 本实例计票消费的主题，为空时消费默认主题和所有专属主题
+	ConsumeTopics []string `mapstructure:"consume_topics"`
+}
+
+// KafkaPollConfig 投票活动专属的主题，该活动的投票事件只写入这个主题
+type KafkaPollConfig struct {
+	Topic   string `mapstructure:"topic"`
+	GroupID string `mapstructure:"group_id"` // 为空时使用"<kafka.group_id>-<投票活动ID>"
+	Workers int    `mapstructure:"workers"`  // 本实例消费该主题的并发数，为0时为8
 }
 
 type TicketConfig struct {
-	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
-	MaxUsageCount   int           `mapstructure:"max_usage_count"`
-	LockTimeout     time.Duration `mapstructure:"lock_timeout"`
-	LockRetryCount  int           `mapstructure:"lock_retry_count"`
+	RefreshInterval   time.Duration `mapstructure:"refresh_interval"`
+	MaxUsageCount     int           `mapstructure:"max_usage_count"`
+	LockTimeout       time.Duration `mapstructure:"lock_timeout"`
+	LockRetryCount    int           `mapstructure:"lock_retry_count"`    // Redlock获取锁的最大尝试次数
+	LockRetryDelay    time.Duration `mapstructure:"lock_retry_delay"`    // Redlock重试的基础等待时间，每次重试翻倍
+	LockRetryJitter   time.Duration `mapstructure:"lock_retry_jitter"`   // 每次重试等待时间上附加的随机抖动上限
+	LockAcquireMax    time.Duration `mapstructure:"lock_acquire_max"`    // 单次获取锁（含所有重试）的总耗时上限，为0时不限制
+	ClockSkew         time.Duration `mapstructure:"clock_skew"`          // 校验过期时间时允许的时钟偏差
+	LowUsageThreshold int           `mapstructure:"low_usage_threshold"` // 当前票据剩余使用次数降到该值以下时发出预警，为0时不预警
+	UsageHoldTTL      time.Duration `mapstructure:"usage_hold_ttl"`      // 投票扣减的使用次数等待受理确认的时长，超时未确认时由释放任务归还，为0时为30秒
+
+	PollSyncInterval time.Duration `mapstructure:"poll_sync_interval"` // 从数据库同步其他实例创建的投票活动的间隔
+
+	// 票据签名密钥，集群内所有实例必须一致；配置后票据值附带HMAC签名，签名不匹配的票据不查询Redis直接拒绝
+	SigningSecret string `mapstructure:"signing_secret"`
+
+	// 票据校验失败次数过多的客户端暂时禁止使用票据，防止穷举票据值
+	BruteForce TicketBruteForceConfig `mapstructure:"brute_force"`
+
+	// 把票据绑定到获取它的客户端，限制每个客户端在一张票据上的使用次数
+	ClientBinding TicketClientBindingConfig `mapstructure:"client_binding"`
+
+	// 每个实例在一张票据上最多返回的票据次数（getTicket和ticketAndVote），计数保存在Redis中，为0时不限制
+	InstanceIssueQuota int `mapstructure:"instance_issue_quota"`
+
+	// 预生成下一张票据，并在轮换后的一段时间内继续接受上一张票据
+	Pipeline TicketPipelineConfig `mapstructure:"pipeline"`
+
+	// 各投票活动的票据策略，未配置的字段继承上面的全局配置
+	Polls map[string]PollTicketConfig `mapstructure:"polls"`
+}
+
+// TicketPipelineConfig 票据流水线，避免票据轮换时正在使用上一张票据的投票失败
+type TicketPipelineConfig struct {
+	Enabled bool `mapstructure:"enabled"` // 开启后每次轮换时预生成下一张票据，下次轮换只需切换最新版本
+	// Grace 轮换后上一张票据仍可使用的时长，为0时只接受最新版本；刷新间隔加上该时长应小于cache.ticket_ttl
+	Grace time.Duration `mapstructure:"grace"`
+}
+
+type TicketClientBindingConfig struct {
+	Enabled      bool `mapstructure:"enabled"`        // 开启后只有通过getTicket获取过票据的调用方（API密钥的调用方或客户端IP）才能使用该票据
+	MaxPerClient int  `mapstructure:"max_per_client"` // 每个客户端在一张票据上最多使用的次数，为0时只校验绑定关系
+}
+
+type TicketBruteForceConfig struct {
+	MaxFailures   int           `mapstructure:"max_failures"`   // 窗口内同一客户端ID或IP允许的票据校验失败次数，为0时不限制
+	Window        time.Duration `mapstructure:"window"`         // 统计失败次数的窗口，从第一次失败开始计算
+	BlockDuration time.Duration `mapstructure:"block_duration"` // 达到失败次数后禁止使用票据的时长
+}
+
+type PollTicketConfig struct {
+	MaxUsageCount     int           `mapstructure:"max_usage_count"`
+	RefreshInterval   time.Duration `mapstructure:"refresh_interval"`
+	TotalBudget       int           `mapstructure:"total_budget"`        // 活动可发放的票据使用次数上限，0表示不限制
+	LowUsageThreshold int           `mapstructure:"low_usage_threshold"` // 未配置时使用全局ticket.low_usage_threshold
+	Shadow            bool          `mapstructure:"shadow"`              // 影子模式，投票照常受理并记录日志，但不计入票数
 }
 
 type ETCDConfig struct {
@@ -62,8 +233,168 @@ type ETCDConfig struct {
 	SessionTTL     time.Duration `mapstructure:"session_ttl"`
 }
 
+// LockConfig 票据生产者锁和生产者选举使用的分布式锁后端
+type LockConfig struct {
+	Backend string `mapstructure:"backend"` // etcd / consul，为空时为etcd
+}
+
+// ConsulConfig lock.backend为consul时使用的Consul集群
+type ConsulConfig struct {
+	Address        string        `mapstructure:"address"`         // Consul agent的HTTP地址
+	Token          string        `mapstructure:"token"`           // ACL令牌，未开启ACL时为空
+	Datacenter     string        `mapstructure:"datacenter"`      // 为空时使用agent所在的数据中心
+	KeyPrefix      string        `mapstructure:"key_prefix"`      // 锁和选举键的前缀
+	SessionTTL     time.Duration `mapstructure:"session_ttl"`     // 会话TTL，取值10s到24h，持有者宕机后最长约2倍TTL锁才释放
+	LockDelay      time.Duration `mapstructure:"lock_delay"`      // 会话失效后锁键暂不可获取的时长，为0时使用Consul默认的15s
+	RequestTimeout time.Duration `mapstructure:"request_timeout"` // 健康检查和释放锁的超时时间
+}
+
 type GraphQLConfig struct {
-	Path string `mapstructure:"path"`
+	Path     string `mapstructure:"path"`
+	Disabled bool   `mapstructure:"disabled"`  // 为true时不提供GraphQL接口和Playground，只通过REST或gRPC接口访问
+	MaxDepth int    `mapstructure:"max_depth"` // 请求中字段的最大嵌套深度，由GraphQL库在校验时拒绝，为0时不限制
+	// MaxComplexity 请求的最大复杂度，每个字段计1，带limit或first参数的字段其子字段按该参数的值倍乘，为0时不限制
+	MaxComplexity int `mapstructure:"max_complexity"`
+	// MaxBodyBytes 请求体的最大字节数，超出时拒绝请求，为0时为1MB
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+}
+
+// RESTConfig JSON REST接口，与GraphQL接口共用同一个端口
+type RESTConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // 是否同时提供REST接口
+	Prefix  string `mapstructure:"prefix"`  // 路径前缀，为空时为/api/v1
+}
+
+// PushConfig 通过WebSocket向客户端推送已落库的投票事件，各实例通过Redis频道接收所有实例落库的事件
+type PushConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`       // 是否提供WebSocket推送
+	Path         string        `mapstructure:"path"`          // WebSocket端点路径，为空时为/ws
+	Channel      string        `mapstructure:"channel"`       // 投票事件使用的Redis频道，为空时为littlevote:votes:processed
+	SendBuffer   int           `mapstructure:"send_buffer"`   // 每个连接待发送的事件数上限，写满时断开该连接，为0时为256
+	PingInterval time.Duration `mapstructure:"ping_interval"` // 向客户端发送ping的间隔，超过两个间隔未收到pong时断开，为0时为30秒
+}
+
+type GRPCConfig struct {
+	Enabled bool `mapstructure:"enabled"` // 是否同时提供gRPC接口
+	Port    int  `mapstructure:"port"`    // 多实例时与HTTP端口一样按实例ID递增
+}
+
+type CleanupConfig struct {
+	Interval             time.Duration `mapstructure:"interval"`
+	TicketRetention      time.Duration `mapstructure:"ticket_retention"`  // 票据过期超过该时长后才会被清理
+	HistoryRetention     time.Duration `mapstructure:"history_retention"` // ticket_history保留时长，为0时不清理
+	BatchSize            int           `mapstructure:"batch_size"`
+	Archive              bool          `mapstructure:"archive"`               // 删除前是否把尚未记录历史的票据归档到ticket_history
+	IdempotencyRetention time.Duration `mapstructure:"idempotency_retention"` // vote_idempotency_keys保留时长，为0时不清理
+}
+
+// HealthConfig /healthz和/readyz的依赖检查
+type HealthConfig struct {
+	CheckTimeout time.Duration `mapstructure:"check_timeout"` // 单个依赖检查的超时时间
+	DrainDelay   time.Duration `mapstructure:"drain_delay"`   // 收到停止信号后/readyz先返回不可用，等待负载均衡摘除本实例的时长
+}
+
+// RateLimitConfig 按客户端IP限制vote和ticketAndVote的频率，令牌桶保存在Redis中，所有实例共享同一个限额
+type RateLimitConfig struct {
+	Enabled bool    `mapstructure:"enabled"`
+	Rate    float64 `mapstructure:"rate"`  // 每秒补充的令牌数，即长期允许的每秒投票数
+	Burst   int     `mapstructure:"burst"` // 令牌桶容量，即允许的突发投票数
+}
+
+// AuthConfig GraphQL接口的API密钥认证
+type AuthConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`   // 开启后所有GraphQL请求都需要携带API密钥
+	AdminKey string        `mapstructure:"admin_key"` // 管理密钥，拥有所有权限，只有它能创建和吊销API密钥
+	CacheTTL time.Duration `mapstructure:"cache_ttl"` // 校验通过的API密钥在进程内缓存的时长，吊销后最长经过该时长在其他实例上失效
+}
+
+type GatewayConfig struct {
+	Port                int           `mapstructure:"port"`
+	RefreshInterval     time.Duration `mapstructure:"refresh_interval"`      // 从注册表刷新实例列表的间隔
+	HealthCheckInterval time.Duration `mapstructure:"health_check_interval"` // 主动健康检查间隔
+	UnhealthyCooldown   time.Duration `mapstructure:"unhealthy_cooldown"`    // 实例被判定不健康后的摘除时长
+}
+
+type VoteConfig struct {
+	ReceiptSecret            string        `mapstructure:"receipt_secret"`             // 投票回执签名密钥，集群内所有实例必须一致，为空时不签发回执
+	DedupWindow              time.Duration `mapstructure:"dedup_window"`               // 重复投票请求的抑制窗口，为0时不抑制
+	ResultsSecret            string        `mapstructure:"results_secret"`             // 投票活动结果快照的签名密钥
+	FinalizeGrace            time.Duration `mapstructure:"finalize_grace"`             // 结束投票后等待已受理投票落库的时长
+	Concurrency              int           `mapstructure:"concurrency"`                // 同时执行的投票数量，为0时不限制
+	QueueLength              int           `mapstructure:"queue_length"`               // 等待执行的投票请求上限，超出时直接拒绝
+	AllVotesCacheTTL         time.Duration `mapstructure:"all_votes_cache_ttl"`        // 所有用户票数聚合缓存的有效期，为0时不缓存
+	IdempotencyTTL           time.Duration `mapstructure:"idempotency_ttl"`            // 携带幂等键的投票结果在Redis中的保留时长，为0时使用默认值
+	ReservationTTL           time.Duration `mapstructure:"reservation_ttl"`            // 两阶段投票中预约等待确认的时长，超时后归还占用的使用次数
+	ReservationSweepInterval time.Duration `mapstructure:"reservation_sweep_interval"` // 检查并释放过期投票预约的间隔
+	CandidateValidator       string        `mapstructure:"candidate_validator"`        // 投票对象的校验方式: pattern（默认，匹配username_pattern）/ registry（必须是登记过的候选人）
+	CandidateCacheTTL        time.Duration `mapstructure:"candidate_cache_ttl"`        // registry模式下候选人集合在Redis中的缓存时长，为0时为1分钟
+	UsernamePattern          string        `mapstructure:"username_pattern"`           // pattern模式下候选人用户名必须匹配的正则表达式，为空时为A-Z之间的单个字母
+	UsernameMinLength        int           `mapstructure:"username_min_length"`        // 用户名的最小字符数，为0时为1
+	UsernameMaxLength        int           `mapstructure:"username_max_length"`        // 用户名的最大字符数，为0或超过64时为64
+	BatchMaxSize             int           `mapstructure:"batch_max_size"`             // voteBatch一次最多包含的投票数，为0时为100
+	StrongReadTimeout        time.Duration `mapstructure:"strong_read_timeout"`        // STRONG一致性查询等待投票落库的最长时间，为0时为5秒
+}
+
+type SnapshotConfig struct {
+	Interval time.Duration `mapstructure:"interval"` // 保存排名快照的间隔，为0时不保存
+}
+
+// ConsistencyCheckConfig 定期一致性检查
+type ConsistencyCheckConfig struct {
+	Interval   time.Duration `mapstructure:"interval"`    // 检查的间隔，为0时不定期检查
+	AutoRepair bool          `mapstructure:"auto_repair"` // 发现不一致时以投票日志为准修正票数并删除不一致的缓存
+}
+
+// LeaderboardConfig Redis有序集合维护的排行榜
+type LeaderboardConfig struct {
+	ReconcileInterval time.Duration `mapstructure:"reconcile_interval"` // 用数据库中的票数重建排行榜的间隔，为0时不对账
+	MaxLimit          int           `mapstructure:"max_limit"`          // leaderboard查询的limit上限，为0时为100
+}
+
+// ProjectionConfig 事件溯源模式：vote_logs是唯一的事实来源，user_votes和票据剩余次数由投影任务从投票日志推导
+type ProjectionConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`      // 开启后消费者只写投票日志，不直接更新票数
+	Interval    time.Duration `mapstructure:"interval"`     // 投影任务的执行间隔
+	BatchSize   int           `mapstructure:"batch_size"`   // 每个事务投影的投票日志条数
+	SettleDelay time.Duration `mapstructure:"settle_delay"` // 只投影写入超过该时长的日志，避免跳过尚未提交的较小id
+}
+
+// LogConfig 结构化日志的级别和输出格式
+type LogConfig struct {
+	Level  string `mapstructure:"level"`  // debug / info / warn / error，为空时为info
+	Format string `mapstructure:"format"` // json / console，为空时为console
+}
+
+// WebhookConfig 向外部系统推送事件通知，例如票据即将耗尽
+type WebhookConfig struct {
+	URLs    []string      `mapstructure:"urls"`    // 接收通知的地址，为空时不推送
+	Secret  string        `mapstructure:"secret"`  // 请求体的HMAC-SHA256签名密钥，为空时不签名
+	Timeout time.Duration `mapstructure:"timeout"` // 单次推送的超时时间
+}
+
+// OutboxConfig 投票事件发件箱的中继任务，把已提交的投票事件发送到Kafka
+type OutboxConfig struct {
+	Interval  time.Duration `mapstructure:"interval"`   // 发件箱为空时的轮询间隔，本实例写入投票事件时立即唤醒
+	BatchSize int           `mapstructure:"batch_size"` // 每次发送的最大事件数
+}
+
+// AnalyticsConfig 投票事件的分析镜像，以独立的消费者组把事件写入分析型存储
+type AnalyticsConfig struct {
+	Enabled       bool             `mapstructure:"enabled"`
+	Sink          string           `mapstructure:"sink"`           // 分析存储类型，目前支持clickhouse
+	GroupID       string           `mapstructure:"group_id"`       // 镜像使用的Kafka消费者组
+	BatchSize     int              `mapstructure:"batch_size"`     // 每批写入的最大事件数
+	FlushInterval time.Duration    `mapstructure:"flush_interval"` // 未凑满一批时的最长等待时间
+	ClickHouse    ClickHouseConfig `mapstructure:"clickhouse"`
+}
+
+type ClickHouseConfig struct {
+	URL      string        `mapstructure:"url"` // HTTP接口地址
+	Database string        `mapstructure:"database"`
+	Table    string        `mapstructure:"table"`
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	Timeout  time.Duration `mapstructure:"timeout"`
 }
 
 var AppConfig Config
@@ -71,6 +402,7 @@ var AppConfig Config
 // LoadConfig 加载配置文件
 func LoadConfig(configPath string) (*Config, error) {
 	viper.SetConfigFile(configPath)
+	viper.SetEnvKeyReplacer(envKeyReplacer)
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// ReloadHook 配置热加载后调用，prev为加载前的配置副本，next为加载后的配置
+type ReloadHook func(prev, next *Config)
+
+type reloadHook struct {
+	name string
+	hook ReloadHook
+}
+
+var (
+	reloadMu    sync.Mutex
+	reloadHooks []reloadHook
+	reloaded    atomic.Pointer[Config] // 热加载后生效的配置快照，未热加载过时为nil
+)
+
+// Current 返回生效的配置，包括热加载后的可热加载配置项；返回的配置只读，热加载时整体替换
+// 热加载不修改AppConfig，读取可热加载配置项的代码应通过Current读取
+func Current() *Config {
+	if cfg := reloaded.Load(); cfg != nil {
+		return cfg
+	}
+	return &AppConfig
+}
+
+// reloadableKeys 支持热加载的配置项，其他配置项的修改需要重启后生效
+var reloadableKeys = map[string]bool{
+	"ticket.refresh_interval": true,
+	"ticket.max_usage_count":  true,
+	"cache.user_vote_ttl":     true,
+	"cache.ticket_ttl":        true,
+	"cache.jitter":            true,
+	"ratelimit.enabled":       true,
+	"ratelimit.rate":          true,
+	"ratelimit.burst":         true,
+	"log.level":               true,
+}
+
+// OnReload 登记配置热加载的回调，回调按登记顺序在监听协程中依次调用，不能阻塞
+func OnReload(name string, hook ReloadHook) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, reloadHook{name: name, hook: hook})
+}
+
+// Watch 监听配置文件，修改后重新加载可热加载的配置项并调用OnReload登记的回调
+// 新配置不合法时保持原配置；其他配置项的修改只记录警告，需要重启后生效
+func Watch(logger *slog.Logger) {
+	viper.OnConfigChange(func(event fsnotify.Event) {
+		reload(logger)
+	})
+	viper.WatchConfig()
+	logger.Info("已开始监听配置文件", "file", viper.ConfigFileUsed())
+}
+
+// reload 重新解析配置文件，把可热加载的配置项写入新的配置快照后整体替换，不修改正在被读取的配置
+// 其他字段沿用原配置，命令行参数设置的配置项不会被配置文件覆盖
+func reload(logger *slog.Logger) {
+	var next Config
+	if err := viper.Unmarshal(&next); err != nil {
+		logger.Error("重新加载配置失败，保持原配置", "error", err)
+		return
+	}
+	if err := validateReloadable(&next); err != nil {
+		logger.Error("重新加载的配置不合法，保持原配置", "error", err)
+		return
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	prev := Current()
+	updated := *prev
+	applyReloadable(&updated, &next)
+
+	if restart := changedKeys(&updated, &next, false); len(restart) > 0 {
+		logger.Warn("配置修改需要重启后生效", "keys", restart)
+	}
+	changed := changedKeys(prev, &updated, true)
+	if len(changed) == 0 {
+		return
+	}
+
+	reloaded.Store(&updated)
+	logger.Info("配置已热加载", "keys", changed)
+	for _, h := range reloadHooks {
+		h.hook(prev, &updated)
+		logger.Debug("已调用配置热加载回调", "hook", h.name)
+	}
+}
+
+// validateReloadable 检查可热加载的配置项，票据刷新间隔和使用次数必须为正数
+func validateReloadable(cfg *Config) error {
+	if cfg.Ticket.RefreshInterval <= 0 {
+		return errors.New("ticket.refresh_interval必须大于0")
+	}
+	if cfg.Ticket.MaxUsageCount <= 0 {
+		return errors.New("ticket.max_usage_count必须大于0")
+	}
+	return nil
+}
+
+// applyReloadable 把src中可热加载的配置项复制到dst，与reloadableKeys保持一致
+func applyReloadable(dst, src *Config) {
+	dst.Ticket.RefreshInterval = src.Ticket.RefreshInterval
+	dst.Ticket.MaxUsageCount = src.Ticket.MaxUsageCount
+	dst.Cache.UserVoteTTL = src.Cache.UserVoteTTL
+	dst.Cache.TicketTTL = src.Cache.TicketTTL
+	dst.Cache.Jitter = src.Cache.Jitter
+	dst.RateLimit = src.RateLimit
+	dst.Log.Level = src.Log.Level
+}
+
+// changedKeys 返回a、b之间取值不同的配置项，reloadable为false时只返回不可热加载且不是由命令行参数设置的配置项
+func changedKeys(a, b *Config, reloadable bool) []string {
+	var before, after []Entry
+	walk("", reflect.ValueOf(*a), &before)
+	walk("", reflect.ValueOf(*b), &after)
+
+	var keys []string
+	for i := range before {
+		key := before[i].Key
+		if before[i].Value == after[i].Value || reloadableKeys[key] != reloadable {
+			continue
+		}
+		if !reloadable && source(key) == SourceFlag {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,85 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+// clickHouseTimeFormat ClickHouse的DateTime64(3)以JSONEachRow写入时接受的格式
+const clickHouseTimeFormat = "2006-01-02 15:04:05.000"
+
+// ClickHouseSink 通过ClickHouse的HTTP接口以JSONEachRow格式批量写入
+// 表使用ReplacingMergeTree按(event_id, event_index)去重，重试产生的重复行在合并后消除
+type ClickHouseSink struct {
+	client   *http.Client
+	endpoint string
+	username string
+	password string
+}
+
+func NewClickHouseSink() *ClickHouseSink {
+	cfg := config.AppConfig.Analytics.ClickHouse
+
+	query := url.Values{}
+	query.Set("database", cfg.Database)
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", cfg.Table))
+
+	return &ClickHouseSink{
+		client:   &http.Client{Timeout: cfg.Timeout},
+		endpoint: cfg.URL + "/?" + query.Encode(),
+		username: cfg.Username,
+		password: cfg.Password,
+	}
+}
+
+// clickHouseRow 写入ClickHouse的行，时间按ClickHouse可解析的格式序列化
+type clickHouseRow struct {
+	*VoteRow
+	VotedAt string `json:"voted_at"`
+}
+
+func (s *ClickHouseSink) Write(ctx context.Context, rows []*VoteRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := encoder.Encode(clickHouseRow{VoteRow: row, VotedAt: row.VotedAt.UTC().Format(clickHouseTimeFormat)}); err != nil {
+			return fmt.Errorf("序列化分析记录失败: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("创建ClickHouse请求失败: %w", err)
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("写入ClickHouse失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("写入ClickHouse失败: %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+func (s *ClickHouseSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,68 @@
+package analytics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/kafka"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+const (
+	defaultAnalyticsGroupID       = "littlevote-analytics"
+	defaultAnalyticsBatchSize     = 500
+	defaultAnalyticsFlushInterval = time.Second
+)
+
+// Mirror 以独立的Kafka消费者组读取投票事件并批量写入分析存储，不影响计票消费者
+type Mirror struct {
+	sink     Sink
+	consumer *kafka.BatchConsumer
+	logger   *slog.Logger
+}
+
+func NewMirror(sink Sink, logger *slog.Logger) *Mirror {
+	logger = logging.Component(logger, "analytics")
+	groupID := config.AppConfig.Analytics.GroupID
+	if groupID == "" {
+		groupID = defaultAnalyticsGroupID
+	}
+	batchSize := config.AppConfig.Analytics.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultAnalyticsBatchSize
+	}
+	flushInterval := config.AppConfig.Analytics.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultAnalyticsFlushInterval
+	}
+
+	return &Mirror{
+		sink:     sink,
+		consumer: kafka.NewBatchConsumer(groupID, batchSize, flushInterval, logger),
+		logger:   logger,
+	}
+}
+
+// Start 启动镜像
+func (m *Mirror) Start() {
+	m.consumer.Start(m.write)
+	m.logger.Info("投票事件分析镜像已启动")
+}
+
+// Stop 停止镜像并关闭分析存储
+func (m *Mirror) Stop() {
+	if err := m.consumer.Stop(); err != nil {
+		m.logger.Error("停止投票事件分析镜像失败", "error", err)
+	}
+	if err := m.sink.Close(); err != nil {
+		m.logger.Error("关闭分析存储失败", "error", err)
+	}
+	m.logger.Info("投票事件分析镜像已停止")
+}
+
+func (m *Mirror) write(ctx context.Context, events []*model.VoteEvent) error {
+	return m.sink.Write(ctx, toRows(events))
+}
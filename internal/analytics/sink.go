@@ -0,0 +1,74 @@
+// Package analytics 将投票事件镜像到分析型存储，重量级的统计查询不再访问事务型的MySQL
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// 支持的分析存储类型
+const (
+	SinkClickHouse = "clickhouse"
+)
+
+// Sink 分析型存储，接收按用户展开的投票记录
+// 同一批记录可能因重试被重复写入，实现需按(EventID, EventIndex)去重或容忍重复
+type Sink interface {
+	Write(ctx context.Context, rows []*VoteRow) error
+	Close() error
+}
+
+// VoteRow 一个用户的一票，与vote_logs的一行对应
+type VoteRow struct {
+	EventID       string    `json:"event_id"`
+	EventIndex    int       `json:"event_index"`
+	PollID        string    `json:"poll_id"`
+	Username      string    `json:"username"`
+	TicketVersion string    `json:"ticket_version"`
+	Actor         string    `json:"actor"`
+	SourceIP      string    `json:"source_ip"`
+	UserAgent     string    `json:"user_agent"`
+	VotedAt       time.Time `json:"voted_at"`
+}
+
+// NewSink 按配置创建分析存储
+func NewSink() (Sink, error) {
+	switch sinkType := config.AppConfig.Analytics.Sink; sinkType {
+	case SinkClickHouse, "":
+		return NewClickHouseSink(), nil
+	default:
+		return nil, fmt.Errorf("不支持的分析存储类型: %s", sinkType)
+	}
+}
+
+// toRows 将投票事件按用户展开，序号与写入vote_logs时一致，影子模式下的投票不计入分析
+func toRows(events []*model.VoteEvent) []*VoteRow {
+	var rows []*VoteRow
+	for _, event := range events {
+		if event.Shadow {
+			continue
+		}
+		pollID := event.PollID
+		if pollID == "" {
+			pollID = model.DefaultPollID
+		}
+		for i, username := range event.Usernames {
+			rows = append(rows, &VoteRow{
+				EventID:       event.EventID,
+				EventIndex:    event.Index + i,
+				PollID:        pollID,
+				Username:      username,
+				TicketVersion: event.TicketVersion,
+				Actor:         event.Audit.Actor,
+				SourceIP:      event.Audit.SourceIP,
+				UserAgent:     event.Audit.UserAgent,
+				VotedAt:       event.VotedAt,
+			})
+		}
+	}
+	return rows
+}
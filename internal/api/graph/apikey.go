@@ -0,0 +1,95 @@
+package graph
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// CreateApiKey 创建API密钥（需要管理密钥）
+func (r *Resolver) CreateApiKey(ctx context.Context, args struct {
+	Name  string
+	Scope string
+}) (*CreatedApiKeyResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	name, err := validation.ValidateAPIKeyName("name", args.Name)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, key, err := r.auth.CreateKey(name, strings.ToLower(args.Scope))
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &CreatedApiKeyResolver{apiKey: apiKey, key: key}, nil
+}
+
+// RevokeApiKey 吊销API密钥（需要管理密钥）
+func (r *Resolver) RevokeApiKey(ctx context.Context, args struct{ Id string }) (*ApiKeyResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	id, err := validation.ValidateAPIKeyID("id", args.Id)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, err := r.auth.RevokeKey(id)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &ApiKeyResolver{apiKey: apiKey}, nil
+}
+
+// ApiKeyResolver API密钥解析器，不返回密钥的哈希
+type ApiKeyResolver struct {
+	apiKey *model.APIKey
+}
+
+func (r *ApiKeyResolver) Id() string {
+	return strconv.FormatInt(r.apiKey.ID, 10)
+}
+
+func (r *ApiKeyResolver) Name() string {
+	return r.apiKey.Name
+}
+
+func (r *ApiKeyResolver) Prefix() string {
+	return r.apiKey.Prefix
+}
+
+func (r *ApiKeyResolver) Scope() string {
+	return strings.ToUpper(r.apiKey.Scope)
+}
+
+func (r *ApiKeyResolver) CreatedAt() string {
+	return *formatOptionalTime(&r.apiKey.CreatedAt)
+}
+
+func (r *ApiKeyResolver) RevokedAt() *string {
+	return formatOptionalTime(r.apiKey.RevokedAt)
+}
+
+// CreatedApiKeyResolver 新创建的API密钥解析器
+type CreatedApiKeyResolver struct {
+	apiKey *model.APIKey
+	key    string
+}
+
+func (r *CreatedApiKeyResolver) ApiKey() *ApiKeyResolver {
+	return &ApiKeyResolver{apiKey: r.apiKey}
+}
+
+func (r *CreatedApiKeyResolver) Key() string {
+	return r.key
+}
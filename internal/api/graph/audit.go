@@ -0,0 +1,90 @@
+package graph
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// VoteLogs 按条件审计投票日志，结果包含客户端IP等来源信息，只对管理密钥开放
+func (r *Resolver) VoteLogs(ctx context.Context, args validation.VoteLogArgs) (*VoteLogConnectionResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	filter, err := validation.ValidateVoteLogQuery(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多查询一条用于判断是否还有下一页
+	limit := filter.Limit
+	filter.Limit++
+	logs, err := r.voteService.QueryVoteLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	hasNextPage := len(logs) > limit
+	if hasNextPage {
+		logs = logs[:limit]
+	}
+	return &VoteLogConnectionResolver{logs: logs, hasNextPage: hasNextPage}, nil
+}
+
+// VoteLogConnectionResolver 投票日志审计结果解析器
+type VoteLogConnectionResolver struct {
+	logs        []*model.VoteLog
+	hasNextPage bool
+}
+
+func (r *VoteLogConnectionResolver) Edges() []*VoteLogEdgeResolver {
+	resolvers := make([]*VoteLogEdgeResolver, len(r.logs))
+	for i, voteLog := range r.logs {
+		resolvers[i] = &VoteLogEdgeResolver{log: voteLog}
+	}
+	return resolvers
+}
+
+func (r *VoteLogConnectionResolver) PageInfo() *PageInfoResolver {
+	info := &PageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.logs) > 0 {
+		cursor := voteLogCursor(r.logs[len(r.logs)-1])
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+// VoteLogEdgeResolver 投票日志审计结果中的一条
+type VoteLogEdgeResolver struct {
+	log *model.VoteLog
+}
+
+func (r *VoteLogEdgeResolver) Cursor() string {
+	return voteLogCursor(r.log)
+}
+
+func (r *VoteLogEdgeResolver) Node() *VoteLogResolver {
+	return &VoteLogResolver{log: r.log}
+}
+
+// PageInfoResolver 翻页信息解析器
+type PageInfoResolver struct {
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (r *PageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+func (r *PageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+// voteLogCursor 投票日志的游标即其id，与exportVoteLogs相同
+func voteLogCursor(voteLog *model.VoteLog) string {
+	return strconv.FormatInt(voteLog.ID, 10)
+}
@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// RegisterCandidate 登记候选人（管理接口）
+func (r *Resolver) RegisterCandidate(ctx context.Context, args struct{ Name string }) (*CandidateResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	name, err := validation.ValidateCandidateName("name", args.Name)
+	if err != nil {
+		return nil, err
+	}
+	candidate, err := r.voteService.RegisterCandidate(name)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &CandidateResolver{candidate: candidate}, nil
+}
+
+// Candidates 查询登记的候选人
+func (r *Resolver) Candidates(ctx context.Context) ([]*CandidateResolver, error) {
+	candidates, err := r.voteService.ListCandidates()
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*CandidateResolver, len(candidates))
+	for i, candidate := range candidates {
+		resolvers[i] = &CandidateResolver{candidate: candidate}
+	}
+	return resolvers, nil
+}
+
+// CandidateResolver 候选人解析器
+type CandidateResolver struct {
+	candidate *model.Candidate
+}
+
+func (r *CandidateResolver) Name() string {
+	return r.candidate.Name
+}
+
+func (r *CandidateResolver) CreatedAt() string {
+	return r.candidate.CreatedAt.Format(time.RFC3339)
+}
@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+)
+
+const (
+	// ClientIDHeader 客户端可通过该请求头声明自身标识，未提供时使用客户端IP
+	ClientIDHeader = "X-Client-ID"
+	// RequestIDHeader 请求ID，未提供时由服务端生成，并在响应头中返回
+	RequestIDHeader = "X-Request-ID"
+	// TenantHeader 租户标识
+	TenantHeader = "X-Tenant-ID"
+)
+
+// 请求头的最大长度，超出部分截断
+const (
+	maxHeaderValueLength = 128 // 客户端标识、请求ID等
+	maxUserAgentLength   = 255 // 与vote_logs.user_agent字段长度保持一致
+)
+
+// defaultLocale 客户端未声明语言时使用的语言区域
+const defaultLocale = "zh-CN"
+
+// withRequestContext 构建请求上下文信息，解析器通过requestctx.From(ctx)获取
+func withRequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &requestctx.Info{
+			RequestID: headerValue(r, RequestIDHeader),
+			ClientID:  clientIDFromRequest(r),
+			SourceIP:  sourceIPFromRequest(r),
+			UserAgent: truncate(r.UserAgent(), maxUserAgentLength),
+			Tenant:    headerValue(r, TenantHeader),
+			Locale:    localeFromRequest(r),
+		}
+		if info.RequestID == "" {
+			info.RequestID = requestctx.NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, info.RequestID)
+
+		next.ServeHTTP(w, r.WithContext(requestctx.With(r.Context(), info)))
+	})
+}
+
+// headerValue 读取并截断请求头
+func headerValue(r *http.Request, name string) string {
+	return truncate(strings.TrimSpace(r.Header.Get(name)), maxHeaderValueLength)
+}
+
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
+
+// clientIDFromRequest 优先使用请求头中的客户端标识，其次是客户端IP
+func clientIDFromRequest(r *http.Request) string {
+	if clientID := headerValue(r, ClientIDHeader); clientID != "" {
+		return clientID
+	}
+	return sourceIPFromRequest(r)
+}
+
+// sourceIPFromRequest 返回客户端IP：连接来自server.trusted_proxies中的代理时，从右向左跳过X-Forwarded-For中的可信代理，
+// 取第一个不可信的地址；否则取连接的远端IP。X-Forwarded-For最左侧的地址由客户端任意填写，不能直接使用
+func sourceIPFromRequest(r *http.Request) string {
+	remote := remoteIP(r.RemoteAddr)
+	proxies, _ := trustedProxies()
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrustedProxy(proxies, addr) {
+		return remote
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// 格式不正确的地址不是可信代理添加的，以最后一个可信代理看到的地址为准
+			break
+		}
+		client = hop.Unmap().String()
+		if !isTrustedProxy(proxies, hop) {
+			break
+		}
+	}
+	return client
+}
+
+// remoteIP 去掉连接地址中的端口
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// trustedProxies 解析server.trusted_proxies，只在首次调用时解析，修改后需要重启生效
+var trustedProxies = sync.OnceValues(func() ([]netip.Prefix, error) {
+	return parseTrustedProxies(config.AppConfig.Server.TrustedProxies)
+})
+
+// parseTrustedProxies 解析可信代理列表，每一项为CIDR或单个IP
+func parseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("server.trusted_proxies中的%q不是合法的CIDR: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("server.trusted_proxies中的%q不是合法的IP: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(proxies []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// localeFromRequest 取Accept-Language中的第一个语言区域
+func localeFromRequest(r *http.Request) string {
+	first, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	locale, _, _ := strings.Cut(first, ";")
+	locale = strings.TrimSpace(locale)
+	if locale == "" || locale == "*" || len(locale) > maxHeaderValueLength {
+		return defaultLocale
+	}
+	return locale
+}
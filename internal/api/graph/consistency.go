@@ -0,0 +1,174 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// CheckConsistency 检查票数与投票日志、Redis缓存与主库是否一致，并统计各分区的消费积压
+func (r *Resolver) CheckConsistency(ctx context.Context, args struct{ PollId *string }) (*ConsistencyReportResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return r.checkConsistency(ctx, args.PollId, false)
+}
+
+// RepairConsistency 检查一致性，以投票日志为准修正不一致的票数并删除不一致的缓存
+func (r *Resolver) RepairConsistency(ctx context.Context, args struct{ PollId *string }) (*ConsistencyReportResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	return r.checkConsistency(ctx, args.PollId, true)
+}
+
+func (r *Resolver) checkConsistency(ctx context.Context, pollID *string, repair bool) (*ConsistencyReportResolver, error) {
+	id := ""
+	if pollID != nil {
+		id = *pollID
+	}
+	report, err := r.consistency.Check(ctx, id, repair)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsistencyReportResolver{report: report}, nil
+}
+
+// ConsistencyReportResolver 一致性检查结果解析器
+type ConsistencyReportResolver struct {
+	report *model.ConsistencyReport
+}
+
+func (r *ConsistencyReportResolver) Consistent() bool {
+	return r.report.Consistent()
+}
+
+func (r *ConsistencyReportResolver) VoteMismatches() []*VoteCountMismatchResolver {
+	resolvers := make([]*VoteCountMismatchResolver, len(r.report.VoteMismatches))
+	for i, mismatch := range r.report.VoteMismatches {
+		resolvers[i] = &VoteCountMismatchResolver{mismatch: mismatch}
+	}
+	return resolvers
+}
+
+func (r *ConsistencyReportResolver) CacheMismatches() []*CacheMismatchResolver {
+	resolvers := make([]*CacheMismatchResolver, len(r.report.CacheMismatches))
+	for i, mismatch := range r.report.CacheMismatches {
+		resolvers[i] = &CacheMismatchResolver{mismatch: mismatch}
+	}
+	return resolvers
+}
+
+func (r *ConsistencyReportResolver) Lags() []*PartitionLagResolver {
+	resolvers := make([]*PartitionLagResolver, len(r.report.Lags))
+	for i, lag := range r.report.Lags {
+		resolvers[i] = &PartitionLagResolver{lag: lag}
+	}
+	return resolvers
+}
+
+func (r *ConsistencyReportResolver) TotalLag() int32 {
+	return int32(r.report.TotalLag)
+}
+
+func (r *ConsistencyReportResolver) LagError() *string {
+	if r.report.LagError == "" {
+		return nil
+	}
+	return &r.report.LagError
+}
+
+func (r *ConsistencyReportResolver) Repaired() bool {
+	return r.report.Repaired
+}
+
+func (r *ConsistencyReportResolver) RepairedVotes() int32 {
+	return int32(r.report.RepairedVotes)
+}
+
+func (r *ConsistencyReportResolver) InvalidatedCaches() int32 {
+	return int32(r.report.InvalidatedCaches)
+}
+
+func (r *ConsistencyReportResolver) CheckedAt() string {
+	return r.report.CheckedAt.Format(time.RFC3339)
+}
+
+// VoteCountMismatchResolver 票数不一致的用户解析器
+type VoteCountMismatchResolver struct {
+	mismatch *model.VoteCountMismatch
+}
+
+func (r *VoteCountMismatchResolver) PollId() string {
+	return r.mismatch.PollID
+}
+
+func (r *VoteCountMismatchResolver) Username() string {
+	return r.mismatch.Username
+}
+
+func (r *VoteCountMismatchResolver) Votes() int32 {
+	return int32(r.mismatch.Votes)
+}
+
+func (r *VoteCountMismatchResolver) LoggedVotes() int32 {
+	return int32(r.mismatch.LoggedVotes)
+}
+
+// CacheMismatchResolver 缓存不一致的用户解析器
+type CacheMismatchResolver struct {
+	mismatch *model.CacheMismatch
+}
+
+func (r *CacheMismatchResolver) PollId() string {
+	return r.mismatch.PollID
+}
+
+func (r *CacheMismatchResolver) Username() string {
+	return r.mismatch.Username
+}
+
+func (r *CacheMismatchResolver) CachedVotes() int32 {
+	return int32(r.mismatch.CachedVotes)
+}
+
+func (r *CacheMismatchResolver) Votes() int32 {
+	return int32(r.mismatch.Votes)
+}
+
+// PartitionLagResolver 分区消费积压解析器
+type PartitionLagResolver struct {
+	lag *model.PartitionLag
+}
+
+func (r *PartitionLagResolver) Topic() string {
+	return r.lag.Topic
+}
+
+func (r *PartitionLagResolver) GroupId() *string {
+	if r.lag.GroupID == "" {
+		return nil
+	}
+	return &r.lag.GroupID
+}
+
+func (r *PartitionLagResolver) Partition() int32 {
+	return int32(r.lag.Partition)
+}
+
+func (r *PartitionLagResolver) Committed() int32 {
+	return int32(r.lag.Committed)
+}
+
+func (r *PartitionLagResolver) End() int32 {
+	return int32(r.lag.End)
+}
+
+func (r *PartitionLagResolver) Lag() int32 {
+	return int32(r.lag.Lag)
+}
@@ -0,0 +1,58 @@
+package graph
+
+import (
+	"context"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/ast"
+	"github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/trace/noop"
+
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+)
+
+// 接口改名或删除字段时，旧字段以@deprecated标记并继续由解析器提供至少一个版本，
+// 滚动升级期间和之后仍在使用旧字段的客户端不受影响；各字段的使用情况通过
+// littlevote_graphql_deprecated_field_resolutions_total{field}上报，降到0后再删除
+
+// deprecationTracer 统计已废弃字段的解析次数，其他追踪点沿用noop.Tracer
+type deprecationTracer struct {
+	noop.Tracer
+	fields map[string]map[string]bool // 类型名 -> 已废弃的字段名
+}
+
+// newDeprecationTracer 从Schema中收集标记了@deprecated的字段
+func newDeprecationTracer(schema string) *deprecationTracer {
+	t := &deprecationTracer{fields: make(map[string]map[string]bool)}
+	parsed, err := graphql.ParseSchema(schema, nil)
+	if err != nil {
+		// Schema错误由随后的MustParseSchema报告
+		return t
+	}
+	for name, namedType := range parsed.AST().Types {
+		var fields ast.FieldsDefinition
+		switch typ := namedType.(type) {
+		case *ast.ObjectTypeDefinition:
+			fields = typ.Fields
+		case *ast.InterfaceTypeDefinition:
+			fields = typ.Fields
+		}
+		for _, field := range fields {
+			if field.Directives.Get("deprecated") == nil {
+				continue
+			}
+			if t.fields[name] == nil {
+				t.fields[name] = make(map[string]bool)
+			}
+			t.fields[name][field.Name] = true
+		}
+	}
+	return t
+}
+
+func (t *deprecationTracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, func(*errors.QueryError)) {
+	if t.fields[typeName][fieldName] {
+		metrics.DeprecatedFieldResolutions.WithLabelValues(typeName + "." + fieldName).Inc()
+	}
+	return t.Tracer.TraceField(ctx, label, typeName, fieldName, trivial, args)
+}
@@ -0,0 +1,444 @@
+package graph
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+)
+
+// schemaLocale schemaString中的注释即为该语言的文档
+const schemaLocale = "zh"
+
+// schemaDocs 各语言的Schema文档，键为"类型名"或"类型名.字段名"，枚举值与字段相同
+// 缺失的键沿用schemaString中的中文注释
+var schemaDocs = map[string]map[string]string{
+	"en": {
+		"UserVote":           "Vote count of a user",
+		"UserVote.pollId":    "Poll the vote count belongs to",
+		"UserVote.username":  "Username",
+		"UserVote.votes":     "Persisted vote count",
+		"UserVote.updatedAt": "Time the vote count was last updated (RFC3339)",
+		"UserVote.stale":     "True when the database is unavailable and the last known count is returned; updatedAt is the time of that count",
+
+		"Ticket":                      "Voting credential; every vote must carry the currently valid ticket",
+		"Ticket.pollId":               "Poll the ticket belongs to",
+		"Ticket.value":                "Ticket value",
+		"Ticket.version":              "Ticket version, a new one is issued on every rotation",
+		"Ticket.remainingUsages":      "Remaining usages of the ticket",
+		"Ticket.expiresAt":            "Ticket expiry time (RFC3339)",
+		"Ticket.createdAt":            "Ticket issue time (RFC3339)",
+		"Ticket.holder":               "Caller the ticket is bound to in client binding mode (API key caller or client IP), where remainingUsages is that caller's remaining count; null in other modes",
+		"Ticket.serverTime":           "Server time when the field was resolved (RFC3339)",
+		"Ticket.secondsUntilRotation": "Seconds until the ticket is rotated",
+
+		"VoteResponse":                 "Result of a vote",
+		"VoteResponse.success":         "Whether the vote succeeded",
+		"VoteResponse.message":         "Description of the result, the failure reason when the vote failed",
+		"VoteResponse.usernames":       "Usernames voted for",
+		"VoteResponse.timestamp":       "Time the vote was processed (RFC3339)",
+		"VoteResponse.remainingUsages": "Remaining usages of the ticket after the vote, null when the vote failed",
+		"VoteResponse.receipt":         "Signed vote receipt, verifiable with verifyReceipt; null when the vote failed or no receipt secret is configured",
+		"VoteResponse.reasonCode":      "Reason code of a failed vote, null on success or when the failure cannot be classified",
+		"VoteResponse.eventId":         "ID of the vote event, pass it to getUserVotes afterEventId to wait until the vote is persisted; null when the vote failed",
+
+		"ReadConsistency":          "Consistency level of a vote count query",
+		"ReadConsistency.STRONG":   "Bypass the caches and the read replica and read from the master",
+		"ReadConsistency.EVENTUAL": "Prefer the caches and the read replica; a just-accepted vote may not be reflected yet",
+
+		"VoteReservation":                 "A vote in the two-phase flow that holds one ticket usage and awaits confirmation",
+		"VoteReservation.token":           "Reservation token to pass to confirmVote",
+		"VoteReservation.pollId":          "Poll the reservation belongs to",
+		"VoteReservation.usernames":       "Usernames to vote for",
+		"VoteReservation.remainingUsages": "Remaining usages of the ticket after the reservation",
+		"VoteReservation.expiresAt":       "Unconfirmed reservations expire at this time and their usage is returned",
+		"VoteRetraction":                  "An accepted vote retraction; the vote is deducted once the compensating event is stored",
+		"VoteRetraction.voteLogId":        "ID of the retracted vote log",
+		"VoteRetraction.eventId":          "ID of the compensating vote event",
+		"VoteRetraction.pollId":           "Poll of the retracted vote",
+		"VoteRetraction.username":         "Username the retracted vote was cast for",
+
+		"AdminAction":               "Audit entry of an administrative vote count adjustment",
+		"AdminAction.id":            "Audit entry ID",
+		"AdminAction.action":        "Action type; set_user_votes for adminSetUserVotes",
+		"AdminAction.actor":         "Caller that performed the action",
+		"AdminAction.pollId":        "Poll that was adjusted",
+		"AdminAction.username":      "Username that was adjusted",
+		"AdminAction.previousVotes": "Vote count before the adjustment",
+		"AdminAction.votes":         "Vote count after the adjustment",
+		"AdminAction.createdAt":     "Time of the action (RFC3339)",
+
+		"VoteReasonCode":                     "Reason code of a failed vote",
+		"VoteReasonCode.TICKET_EXPIRED":      "The ticket has expired or was replaced by a newer version",
+		"VoteReasonCode.TICKET_EXHAUSTED":    "The ticket usages or the poll's ticket budget are exhausted",
+		"VoteReasonCode.INVALID_CANDIDATE":   "The username list is empty or contains an invalid candidate",
+		"VoteReasonCode.WINDOW_CLOSED":       "The poll has not started or has closed",
+		"VoteReasonCode.RATE_LIMITED":        "Too many requests",
+		"VoteReasonCode.DUPLICATE":           "An identical vote request is already being processed",
+		"VoteReasonCode.RESERVATION_EXPIRED": "The reservation does not exist, was already confirmed or has expired",
+
+		"PollResults":             "Results of a poll",
+		"PollResults.pollId":      "Poll ID",
+		"PollResults.finalized":   "Whether the poll is finalized; finalized results are an immutable snapshot",
+		"PollResults.finalizedAt": "Finalization time (RFC3339), null when not finalized",
+		"PollResults.totalVotes":  "Total number of votes",
+		"PollResults.results":     "Vote counts ordered by votes descending",
+		"PollResults.signature":   "HMAC-SHA256 signature of the result snapshot, null when not finalized",
+		"PollResults.reconciled":  "Number of vote count records corrected by reconciliation before finalization",
+
+		"PollStats":                   "Statistics of a poll",
+		"PollStats.pollId":            "Poll ID",
+		"PollStats.totalVotes":        "Persisted vote count",
+		"PollStats.votesPerHour":      "Votes per hour, in chronological order",
+		"PollStats.uniqueVoters":      "Estimated number of distinct voters by caller or client IP",
+		"PollStats.ticketsIssued":     "Sum of issued ticket usages",
+		"PollStats.ticketsUsed":       "Ticket usages actually consumed",
+		"PollStats.ticketUtilization": "ticketsUsed / ticketsIssued, 0 before any ticket is issued",
+		"PollStats.rejections":        "Rejected votes per reason code, unclassified ones counted as OTHER",
+
+		"TicketStats":             "Utilization of a single ticket version",
+		"TicketStats.version":     "Ticket version",
+		"TicketStats.pollId":      "Poll the ticket belongs to",
+		"TicketStats.issued":      "Issued usages",
+		"TicketStats.consumed":    "Usages actually consumed, null until the ticket is rotated",
+		"TicketStats.utilization": "consumed / issued, null until the ticket is rotated",
+		"TicketStats.createdAt":   "Ticket issue time (RFC3339)",
+		"TicketStats.expiresAt":   "Ticket expiry time (RFC3339)",
+		"TicketStats.rotatedAt":   "Time the ticket was replaced by a newer version",
+
+		"HourlyVotes":       "Votes within one hour",
+		"HourlyVotes.hour":  "Start of the hour (RFC3339)",
+		"HourlyVotes.votes": "Votes within the hour",
+
+		"RejectionCount":            "Rejected votes for one reason code",
+		"RejectionCount.reasonCode": "Reason code, OTHER for unclassified failures",
+		"RejectionCount.count":      "Number of rejections",
+
+		"ResultSnapshot":            "Standings at a point in time",
+		"ResultSnapshot.takenAt":    "Snapshot time (RFC3339)",
+		"ResultSnapshot.totalVotes": "Total votes at snapshot time",
+		"ResultSnapshot.standings":  "Vote counts at snapshot time, ordered by votes descending",
+
+		"ReceiptVerification":               "Verification result of a vote receipt",
+		"ReceiptVerification.eventId":       "Vote event ID",
+		"ReceiptVerification.ticketVersion": "Ticket version used for the vote",
+		"ReceiptVerification.usernames":     "Usernames in the receipt",
+		"ReceiptVerification.recorded":      "Whether every vote in the receipt has been written to the vote log",
+		"ReceiptVerification.recordedAt":    "Time the vote log was written, null when not yet recorded",
+
+		"ProducerInfo":            "Lease of the ticket producer",
+		"ProducerInfo.instanceId": "Producer instance ID",
+		"ProducerInfo.since":      "Time the instance became producer (RFC3339)",
+		"ProducerInfo.renewedAt":  "Time of the last lease renewal (RFC3339)",
+
+		"SystemStatus":                 "System status",
+		"SystemStatus.instanceId":      "ID of this instance",
+		"SystemStatus.isProducer":      "Whether this instance is the ticket producer",
+		"SystemStatus.currentProducer": "Current ticket producer of the cluster, null when there is none",
+
+		"Instance":             "An instance registered in the cluster",
+		"Instance.id":          "Instance ID",
+		"Instance.host":        "Host name",
+		"Instance.port":        "GraphQL port the instance actually listens on",
+		"Instance.grpcPort":    "gRPC port the instance actually listens on, null when gRPC is disabled",
+		"Instance.role":        "Current role: producer / worker / replica",
+		"Instance.version":     "Build version",
+		"Instance.startedAt":   "Process start time (RFC3339)",
+		"Instance.heartbeatAt": "Time of the last heartbeat (RFC3339)",
+
+		"QueueDepth":           "Vote backlog of one source",
+		"QueueDepth.source":    "Backlog source: outbox / producer / kafka",
+		"QueueDepth.partition": "Kafka partition, null for other sources",
+		"QueueDepth.depth":     "Number of pending vote events",
+
+		"VoteQueueStatus":            "Votes of this instance not yet persisted",
+		"VoteQueueStatus.instanceId": "Instance ID",
+		"VoteQueueStatus.total":      "Sum of all sources",
+		"VoteQueueStatus.depths":     "Backlog per source",
+		"VoteQueueStatus.checkedAt":  "Time of the check (RFC3339)",
+
+		"VoteCountMismatch":             "A user whose count in user_votes differs from the count derived from vote logs",
+		"VoteCountMismatch.pollId":      "Poll ID",
+		"VoteCountMismatch.username":    "Username",
+		"VoteCountMismatch.votes":       "Count in user_votes",
+		"VoteCountMismatch.loggedVotes": "Count derived from vote logs",
+
+		"CacheMismatch":             "A user whose count cached in Redis differs from the primary database",
+		"CacheMismatch.pollId":      "Poll ID",
+		"CacheMismatch.username":    "Username",
+		"CacheMismatch.cachedVotes": "Count cached in Redis",
+		"CacheMismatch.votes":       "Count in user_votes on the primary",
+
+		"PartitionLag":           "Consumer lag on one partition of a vote topic",
+		"PartitionLag.topic":     "Topic",
+		"PartitionLag.groupId":   "Consumer group, null with static partition assignment",
+		"PartitionLag.partition": "Partition",
+		"PartitionLag.committed": "Offset of the next message to consume, -1 if nothing was committed",
+		"PartitionLag.end":       "Offset at the end of the partition",
+		"PartitionLag.lag":       "Messages not consumed yet",
+
+		"ConsistencyReport":                   "Result of a consistency check",
+		"ConsistencyReport.consistent":        "Whether vote counts match the vote logs and caches match the primary",
+		"ConsistencyReport.voteMismatches":    "Users whose counts differ from the vote logs",
+		"ConsistencyReport.cacheMismatches":   "Users whose caches differ from the primary",
+		"ConsistencyReport.lags":              "Consumer lag per partition",
+		"ConsistencyReport.totalLag":          "Sum of the lag of all partitions",
+		"ConsistencyReport.lagError":          "Why the consumer lag could not be read, null on success",
+		"ConsistencyReport.repaired":          "Whether the mismatches were repaired",
+		"ConsistencyReport.repairedVotes":     "user_votes rows corrected",
+		"ConsistencyReport.invalidatedCaches": "User vote caches deleted",
+		"ConsistencyReport.checkedAt":         "Time of the check (RFC3339)",
+
+		"ServerInfo":            "Build and runtime information of this instance",
+		"ServerInfo.version":    "Build version",
+		"ServerInfo.commit":     "Git commit of the build",
+		"ServerInfo.buildTime":  "Build time (RFC3339), null when not injected",
+		"ServerInfo.startedAt":  "Process start time",
+		"ServerInfo.instanceId": "Instance ID",
+		"ServerInfo.role":       "Current role: producer / worker / replica",
+
+		"ConsumptionState":          "Cluster-wide pause state, used for vote event consumption and the outbox relay",
+		"ConsumptionState.paused":   "Whether it is paused cluster-wide",
+		"ConsumptionState.reason":   "Pause reason, null when not paused",
+		"ConsumptionState.pausedBy": "ID of the instance that paused it, null when not paused",
+		"ConsumptionState.since":    "Time the pause started (RFC3339), null when not paused",
+
+		"OutboxStatus":                  "Outbox backlog and relay state",
+		"OutboxStatus.instanceId":       "Instance ID",
+		"OutboxStatus.backlog":          "Vote events in the outbox not yet sent to Kafka (cluster-wide)",
+		"OutboxStatus.oldestAt":         "Write time of the oldest unsent event (RFC3339), null when the outbox is empty",
+		"OutboxStatus.oldestAgeSeconds": "Seconds the oldest unsent event has waited, 0 when the outbox is empty",
+		"OutboxStatus.failed":           "Vote events marked failed because they could not be parsed; the relay no longer sends them (cluster-wide)",
+		"OutboxStatus.pause":            "Pause state of the relay (cluster-wide)",
+		"OutboxStatus.relayed":          "Vote events sent by this instance since it started",
+		"OutboxStatus.lastRelayAt":      "Time this instance last sent events (RFC3339), null if it has not sent any",
+		"OutboxStatus.checkedAt":        "Time of the check (RFC3339)",
+
+		"OutboxFlushResult":        "Result of a forced outbox flush",
+		"OutboxFlushResult.sent":   "Vote events sent by this flush",
+		"OutboxFlushResult.status": "Outbox state after the flush",
+
+		"ApiKeyScope":      "Permission scope of an API key",
+		"ApiKeyScope.READ": "Queries only",
+		"ApiKeyScope.VOTE": "Queries and votes",
+
+		"ApiKey":           "An API key for calling the API; the server only stores its hash",
+		"ApiKey.id":        "API key ID",
+		"ApiKey.name":      "What the key is used for",
+		"ApiKey.prefix":    "First characters of the key, for identifying it",
+		"ApiKey.scope":     "Permission scope",
+		"ApiKey.createdAt": "Creation time (RFC3339)",
+		"ApiKey.revokedAt": "Revocation time (RFC3339), null when not revoked",
+
+		"CreatedApiKey":        "A newly created API key",
+		"CreatedApiKey.apiKey": "The stored key record",
+		"CreatedApiKey.key":    "The full key, returned only this once",
+
+		"VoteImport":               "Result of a vote import",
+		"VoteImport.importId":      "Import batch; re-importing the same batch does not count votes twice",
+		"VoteImport.ticketVersion": "Ticket version of the imported votes in the vote logs, i.e. import-<batch>",
+		"VoteImport.dryRun":        "Whether the file was only validated",
+		"VoteImport.rows":          "Number of data rows in the file",
+		"VoteImport.votes":         "Total number of imported votes",
+		"VoteImport.events":        "Vote events written to the outbox; for a dry run, the events that would be written",
+
+		"ConfigEntry":        "An effective configuration entry",
+		"ConfigEntry.key":    "Configuration key, e.g. vote.idempotency_ttl",
+		"ConfigEntry.value":  "Configuration value with secrets redacted",
+		"ConfigEntry.source": "Where the value came from: file / env / flag / default",
+
+		"Candidate":           "A registered candidate; with vote.candidate_validator set to registry only registered candidates can receive votes",
+		"Candidate.name":      "Candidate name",
+		"Candidate.createdAt": "Registration time (RFC3339)",
+
+		"Poll":            "A poll; an empty candidate list accepts any username matching the username rule (any registered candidate in registry mode)",
+		"Poll.id":         "Poll ID",
+		"Poll.title":      "Title",
+		"Poll.candidates": "Candidates",
+		"Poll.startsAt":   "Time voting opens (RFC3339), null to open on creation",
+		"Poll.endsAt":     "Time voting closes (RFC3339), null to stay open until finalized",
+		"Poll.shadow":     "Whether the poll is in shadow mode; votes are accepted and logged but not counted",
+		"Poll.createdAt":  "Creation time (RFC3339), null for polls only defined in the configuration file",
+
+		"CreatePollInput":            "Parameters for creating a poll",
+		"CreatePollInput.id":         "Poll ID; letters, digits, underscores and hyphens only",
+		"CreatePollInput.title":      "Title",
+		"CreatePollInput.candidates": "Candidates; each must match the username rule and be unique",
+		"CreatePollInput.startsAt":   "Time voting opens (RFC3339), opens on creation when omitted",
+		"CreatePollInput.endsAt":     "Time voting closes (RFC3339), stays open until finalized when omitted",
+		"CreatePollInput.shadow":     "Create the poll in shadow mode for a rehearsal, defaults to false",
+
+		"VoteInput":                "Vote request",
+		"VoteInput.usernames":      "Usernames to vote for",
+		"VoteInput.ticket":         "The currently valid ticket",
+		"VoteInput.idempotencyKey": "Client-generated idempotency key; retries with the same key are counted only once",
+
+		"TicketInput":                 "Ticket carried by a vote, with the same fields as returned by getTicket",
+		"TicketInput.pollId":          "Poll the ticket belongs to, default when omitted",
+		"TicketInput.value":           "Ticket value",
+		"TicketInput.version":         "Ticket version",
+		"TicketInput.remainingUsages": "Remaining usages of the ticket",
+		"TicketInput.expiresAt":       "Ticket expiry time (RFC3339)",
+		"TicketInput.createdAt":       "Ticket issue time (RFC3339)",
+		"TicketInput.holder":          "Caller the ticket is bound to, as returned by getTicket; the requesting caller is used when omitted",
+
+		"VoteLog":               "A vote log entry",
+		"VoteLog.id":            "Vote log ID, used as the export cursor",
+		"VoteLog.eventId":       "Vote event ID",
+		"VoteLog.pollId":        "Poll ID",
+		"VoteLog.username":      "Username voted for",
+		"VoteLog.ticketVersion": "Ticket version used for the vote",
+		"VoteLog.actor":         "Caller that cast the vote",
+		"VoteLog.sourceIp":      "Client IP",
+		"VoteLog.userAgent":     "Client User-Agent",
+		"VoteLog.votedAt":       "Vote time (RFC3339)",
+		"VoteLog.shadow":        "Whether the vote was cast in shadow mode; shadow votes are not counted",
+		"VoteLog.retractedAt":   "When the vote was retracted (RFC3339); null if it was not retracted",
+
+		"VoteLogPage":           "A page of vote logs",
+		"VoteLogPage.entries":   "Vote logs of this page, in id order",
+		"VoteLogPage.endCursor": "Cursor of the last entry, null when the page is empty",
+		"VoteLogPage.hasMore":   "Whether there is a next page",
+
+		"PageInfo":             "Paging information",
+		"PageInfo.endCursor":   "Cursor of the last entry, null when the page is empty",
+		"PageInfo.hasNextPage": "Whether there is a next page",
+
+		"VoteLogEdge":        "An entry of a vote log audit query",
+		"VoteLogEdge.cursor": "Cursor of this vote log",
+		"VoteLogEdge.node":   "The vote log",
+
+		"VoteLogConnection":          "A page of a vote log audit query, newest vote log id first",
+		"VoteLogConnection.edges":    "Vote logs of this page",
+		"VoteLogConnection.pageInfo": "Paging information",
+
+		"Query":                  "Queries",
+		"Query.getTicket":        "Current ticket of a poll, default when pollId is omitted",
+		"Query.getUserVotes":     "Vote count of a user in a poll, default when pollId is omitted; STRONG consistency reads from the master, and with afterEventId first waits until that vote is persisted, returning the current count marked stale after vote.strong_read_timeout",
+		"Query.getAllUserVotes":  "Vote counts of all users in a poll, default when pollId is omitted",
+		"Query.leaderboard":      "Top limit users of a poll by votes, highest first and ties by username; default when pollId is omitted",
+		"Query.getPoll":          "Definition of a poll",
+		"Query.candidates":       "Registered candidates ordered by name",
+		"Query.getPollResults":   "Results of a poll, the result snapshot once finalized",
+		"Query.getPollStats":     "Statistics of a poll",
+		"Query.getTicketStats":   "Utilization per ticket version, newest first; all polls when pollId is omitted; limit defaults to 100, max 1000 (admin)",
+		"Query.voteLogs":         "Audit vote logs by username, ticket version and vote time (from inclusive, to exclusive, RFC3339), newest id first; first defaults to 50, max 500; after is the previous page's endCursor (requires the admin key)",
+		"Query.exportVoteLogs":   "Vote logs paged by id; after is the previous page's endCursor; limit defaults to 1000, max 10000 (admin)",
+		"Query.getSnapshots":     "Standing snapshots in chronological order; since/until are RFC3339 times; limit defaults to 100, max 1000",
+		"Query.verifyReceipt":    "Verify a vote receipt and check that the vote has been persisted",
+		"Query.systemStatus":     "System status",
+		"Query.serverInfo":       "Build version, start time and role of this instance",
+		"Query.listInstances":    "Live instances in the cluster (admin)",
+		"Query.voteQueueStatus":  "Votes of this instance not yet persisted (admin)",
+		"Query.consumptionState": "Pause state of vote event consumption (admin)",
+		"Query.outboxStatus":     "Outbox backlog and relay state (admin)",
+		"Query.configDump":       "Effective configuration with secrets redacted (admin)",
+		"Query.checkConsistency": "Compare vote counts with the vote logs and Redis caches with the primary, and report consumer lag per partition; checks every poll when pollId is null (admin)",
+
+		"Mutation":                   "Mutations",
+		"Mutation.vote":              "Cast a vote",
+		"Mutation.ticketAndVote":     "Fetch the current ticket and vote with it immediately",
+		"Mutation.voteBatch":         "Cast up to vote.batch_max_size votes, rate limited by vote count; returns one result per input in order, and a failed item does not affect the others",
+		"Mutation.reserveVote":       "Two-phase vote, step one: validate the ticket and hold one usage, returning a reservation token; the usage is returned if not confirmed in time",
+		"Mutation.confirmVote":       "Two-phase vote, step two: confirm the reservation so the vote is counted",
+		"Mutation.createPoll":        "Create a poll; candidate vote counts start at 0; in registry mode every candidate must be registered (admin)",
+		"Mutation.registerCandidate": "Register a candidate; the name is trimmed and checked against the username length limits, and in pattern mode against vote.username_pattern too (admin)",
+		"Mutation.setPollShadow":     "Turn shadow mode on or off for a poll; once off, new votes are counted but earlier shadow votes stay excluded (admin)",
+		"Mutation.finalizePoll":      "Close a poll and produce a signed result snapshot after reconciliation (admin)",
+		"Mutation.pauseConsumption":  "Pause vote event consumption on every instance, e.g. during database maintenance (admin)",
+		"Mutation.resumeConsumption": "Resume vote event consumption on every instance (admin)",
+		"Mutation.pauseOutboxRelay":  "Pause the outbox relay on every instance; votes are still accepted and stay in the outbox (admin)",
+		"Mutation.resumeOutboxRelay": "Resume the outbox relay on every instance (admin)",
+		"Mutation.flushOutbox":       "Send every vote event in the outbox from this instance now, even while the relay is paused (admin)",
+		"Mutation.repairConsistency": "Run a consistency check, correct mismatched vote counts from the vote logs and delete mismatched caches; covers every poll when pollId is null (admin)",
+		"Mutation.createApiKey":      "Create an API key; the full key is returned only in the response (requires the admin key)",
+		"Mutation.revokeApiKey":      "Revoke an API key; takes effect on this instance immediately and on others within auth.cache_ttl (requires the admin key)",
+		"Mutation.importVotes":       "Import vote results from a legacy system. The CSV starts with a header: username is required, votes defaults to 1, poll_id defaults to the pollId argument; nothing is imported if any row is invalid (admin)",
+		"Mutation.retractVote":       "Retract one vote. The compensating event deducts the vote and marks the vote log once stored; non-admin callers can only retract their own votes, matched by API key or, with auth disabled, by client IP",
+		"Mutation.adminSetUserVotes": "Set a user's vote count directly and record an audit entry; the adjustment survives reconciliation and finalization (admin)",
+	},
+}
+
+var (
+	typeLinePattern  = regexp.MustCompile(`^(?:type|input|enum|interface|union|scalar)\s+(\w+)`)
+	fieldLinePattern = regexp.MustCompile(`^\s+(\w+)`)
+)
+
+// localizeSchema 用指定语言的文档替换schemaString中的注释，缺失的键保留原注释
+func localizeSchema(schema string, docs map[string]string) string {
+	var out, comments []string
+	typeName := ""
+	for _, line := range strings.Split(schema, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") {
+			comments = append(comments, line)
+			continue
+		}
+
+		key := ""
+		if m := typeLinePattern.FindStringSubmatch(line); m != nil {
+			key = m[1]
+			if strings.HasSuffix(trimmed, "{") {
+				typeName = m[1]
+			}
+		} else if trimmed == "}" {
+			typeName = ""
+		} else if m := fieldLinePattern.FindStringSubmatch(line); m != nil && typeName != "" {
+			key = typeName + "." + m[1]
+		}
+
+		if doc, ok := docs[key]; ok && key != "" {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			out = append(out, indent+"# "+doc)
+		} else {
+			out = append(out, comments...)
+		}
+		comments = comments[:0]
+		out = append(out, line)
+	}
+	out = append(out, comments...)
+	return strings.Join(out, "\n")
+}
+
+// missingDocs 返回schemaString中在指定语言下没有文档的类型和字段
+func missingDocs(schema string, docs map[string]string) []string {
+	var missing []string
+	typeName := ""
+	for _, line := range strings.Split(schema, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "schema") {
+			continue
+		}
+		if m := typeLinePattern.FindStringSubmatch(line); m != nil {
+			if strings.HasSuffix(trimmed, "{") {
+				typeName = m[1]
+			}
+			if _, ok := docs[m[1]]; !ok {
+				missing = append(missing, m[1])
+			}
+		} else if trimmed == "}" {
+			typeName = ""
+		} else if m := fieldLinePattern.FindStringSubmatch(line); m != nil && typeName != "" {
+			if _, ok := docs[typeName+"."+m[1]]; !ok {
+				missing = append(missing, typeName+"."+m[1])
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// docLocale 选择Schema文档的语言，?lang=参数优先，其次是请求上下文中的语言区域，都不支持时使用中文
+func docLocale(req *http.Request, supported func(lang string) bool) string {
+	for _, candidate := range []string{req.URL.Query().Get("lang"), requestctx.From(req.Context()).Locale} {
+		// 只比较主语言标签，如en-US按en处理
+		lang, _, _ := strings.Cut(candidate, "-")
+		lang = strings.ToLower(lang)
+		if lang != "" && supported(lang) {
+			return lang
+		}
+	}
+	return schemaLocale
+}
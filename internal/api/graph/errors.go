@@ -0,0 +1,118 @@
+package graph
+
+import (
+	"errors"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/receipt"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+)
+
+// codedError 携带错误码的GraphQL错误，错误码通过extensions返回给客户端
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+func (e *codedError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// reasonError 投票失败的错误，在extensions中附加投票失败原因码
+type reasonError struct {
+	err        error
+	reasonCode model.VoteReasonCode
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+func (e *reasonError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{}
+	if inner, ok := e.err.(interface{ Extensions() map[string]interface{} }); ok {
+		for key, value := range inner.Extensions() {
+			extensions[key] = value
+		}
+	}
+	extensions["reasonCode"] = string(e.reasonCode)
+	return extensions
+}
+
+// withReasonCode 为投票失败的错误附加原因码，没有原因码时原样返回
+func withReasonCode(err error, reasonCode model.VoteReasonCode) error {
+	if err == nil || reasonCode == "" {
+		return err
+	}
+	return &reasonError{err: err, reasonCode: reasonCode}
+}
+
+// toGraphQLError 为已知的业务错误附加错误码
+func toGraphQLError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return &codedError{code: "UNAUTHENTICATED", err: err}
+	case errors.Is(err, auth.ErrForbidden):
+		return &codedError{code: "FORBIDDEN", err: err}
+	case errors.Is(err, repository.ErrAPIKeyNotFound):
+		return &codedError{code: "API_KEY_NOT_FOUND", err: err}
+	case errors.Is(err, repository.ErrTicketExpired):
+		return &codedError{code: "TICKET_EXPIRED", err: err}
+	case errors.Is(err, repository.ErrTicketExhausted):
+		return &codedError{code: "TICKET_EXHAUSTED", err: err}
+	case errors.Is(err, repository.ErrClientQuotaExhausted):
+		return &codedError{code: "CLIENT_QUOTA_EXHAUSTED", err: err}
+	case errors.Is(err, repository.ErrTicketNotHolder):
+		return &codedError{code: "TICKET_NOT_HOLDER", err: err}
+	case errors.Is(err, repository.ErrInstanceQuotaExhausted):
+		return &codedError{code: "INSTANCE_QUOTA_EXHAUSTED", err: err}
+	case errors.Is(err, service.ErrRateLimited):
+		return &codedError{code: "RATE_LIMITED", err: err}
+	case errors.Is(err, service.ErrVoteQueueFull):
+		return &codedError{code: "VOTE_QUEUE_FULL", err: err}
+	case errors.Is(err, ticket.ErrClientBlocked):
+		return &codedError{code: "TICKET_BLOCKED", err: err}
+	case errors.Is(err, service.ErrReservationExpired):
+		return &codedError{code: "RESERVATION_EXPIRED", err: err}
+	case errors.Is(err, repository.ErrPollClosed):
+		return &codedError{code: "POLL_CLOSED", err: err}
+	case errors.Is(err, repository.ErrPollFinalized):
+		return &codedError{code: "POLL_FINALIZED", err: err}
+	case errors.Is(err, ticket.ErrPollNotStarted):
+		return &codedError{code: "POLL_NOT_STARTED", err: err}
+	case errors.Is(err, repository.ErrPollExists):
+		return &codedError{code: "POLL_EXISTS", err: err}
+	case errors.Is(err, repository.ErrCandidateExists):
+		return &codedError{code: "CANDIDATE_EXISTS", err: err}
+	case errors.Is(err, service.ErrInvalidCandidate):
+		return &codedError{code: "INVALID_CANDIDATE", err: err}
+	case errors.Is(err, receipt.ErrResultsNotConfigured):
+		return &codedError{code: "RESULTS_SIGNING_DISABLED", err: err}
+	case errors.Is(err, receipt.ErrInvalid):
+		return &codedError{code: "INVALID_RECEIPT", err: err}
+	case errors.Is(err, receipt.ErrNotConfigured):
+		return &codedError{code: "RECEIPTS_DISABLED", err: err}
+	case errors.Is(err, repository.ErrVoteLogNotFound):
+		return &codedError{code: "VOTE_LOG_NOT_FOUND", err: err}
+	case errors.Is(err, service.ErrVoteNotOwned):
+		return &codedError{code: "VOTE_NOT_OWNED", err: err}
+	case errors.Is(err, service.ErrVoteRetracted):
+		return &codedError{code: "VOTE_ALREADY_RETRACTED", err: err}
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// ExportVoteLogs 以游标分页导出投票日志，结果包含客户端IP等来源信息，只对管理密钥开放
+func (r *Resolver) ExportVoteLogs(ctx context.Context, args struct {
+	PollId *string
+	After  *string
+	Limit  *int32
+}) (*VoteLogPageResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	query, err := validation.ValidateVoteLogExportQuery(args.PollId, args.After, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多查询一条用于判断是否还有下一页
+	logs, err := r.voteService.ExportVoteLogs(query.PollID, query.AfterID, query.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(logs) > query.Limit
+	if hasMore {
+		logs = logs[:query.Limit]
+	}
+	return &VoteLogPageResolver{logs: logs, hasMore: hasMore}, nil
+}
+
+// serveVoteLogExport 以NDJSON流式导出投票日志，每行一条，按id分批读取并逐批写出
+// 参数：pollId（可选）、after（从该游标之后开始）、limit（每批条数）
+// 导出中断时，客户端以收到的最后一条日志的id作为after重新请求即可继续；与VoteLogs相同，只对管理密钥开放
+func (r *Resolver) serveVoteLogExport(w http.ResponseWriter, req *http.Request) {
+	if err := auth.Authorize(req.Context(), auth.ScopeAdmin); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	params := req.URL.Query()
+	pollID, after := params.Get("pollId"), params.Get("after")
+	var limit *int32
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			http.Error(w, "limit: 必须是整数", http.StatusBadRequest)
+			return
+		}
+		l := int32(n)
+		limit = &l
+	}
+
+	query, err := validation.ValidateVoteLogExportQuery(&pollID, &after, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 导出是管理接口，只允许客户端自身缓存，每次凭ETag重新验证；没有新投票日志时返回304
+	version, err := r.voteService.VoteLogExportVersion(query.PollID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	tag := etag(fmt.Sprintf("%s-%d-%d", version, query.AfterID, query.Limit))
+	if setCacheHeaders(w, req, tag, "private, no-cache") {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	afterID := query.AfterID
+	for {
+		if req.Context().Err() != nil {
+			return
+		}
+
+		logs, err := r.voteService.ExportVoteLogs(query.PollID, afterID, query.Limit)
+		if err != nil {
+			// 响应头已发送，只能中断输出，客户端从最后一条继续
+			r.logger.ErrorContext(req.Context(), "导出投票日志失败", "after_id", afterID, "error", err)
+			return
+		}
+
+		for _, voteLog := range logs {
+			if err := encoder.Encode(voteLog); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if len(logs) < query.Limit {
+			return
+		}
+		afterID = logs[len(logs)-1].ID
+	}
+}
+
+// VoteLogPageResolver 投票日志分页解析器
+type VoteLogPageResolver struct {
+	logs    []*model.VoteLog
+	hasMore bool
+}
+
+func (r *VoteLogPageResolver) Entries() []*VoteLogResolver {
+	resolvers := make([]*VoteLogResolver, len(r.logs))
+	for i, voteLog := range r.logs {
+		resolvers[i] = &VoteLogResolver{log: voteLog}
+	}
+	return resolvers
+}
+
+// EndCursor 本页最后一条投票日志的游标，作为下一页的after参数
+func (r *VoteLogPageResolver) EndCursor() *string {
+	if len(r.logs) == 0 {
+		return nil
+	}
+	cursor := strconv.FormatInt(r.logs[len(r.logs)-1].ID, 10)
+	return &cursor
+}
+
+func (r *VoteLogPageResolver) HasMore() bool {
+	return r.hasMore
+}
+
+// VoteLogResolver 投票日志解析器
+type VoteLogResolver struct {
+	log *model.VoteLog
+}
+
+func (r *VoteLogResolver) Id() string {
+	return strconv.FormatInt(r.log.ID, 10)
+}
+
+func (r *VoteLogResolver) EventId() string {
+	return r.log.EventID
+}
+
+func (r *VoteLogResolver) PollId() string {
+	return r.log.PollID
+}
+
+func (r *VoteLogResolver) Username() string {
+	return r.log.Username
+}
+
+func (r *VoteLogResolver) TicketVersion() string {
+	return r.log.TicketVersion
+}
+
+func (r *VoteLogResolver) Actor() string {
+	return r.log.Actor
+}
+
+func (r *VoteLogResolver) SourceIp() string {
+	return r.log.SourceIP
+}
+
+func (r *VoteLogResolver) UserAgent() string {
+	return r.log.UserAgent
+}
+
+func (r *VoteLogResolver) VotedAt() string {
+	return r.log.VotedAt.Format(time.RFC3339)
+}
+
+func (r *VoteLogResolver) Shadow() bool {
+	return r.log.Shadow
+}
+
+func (r *VoteLogResolver) RetractedAt() *string {
+	if r.log.RetractedAt == nil {
+		return nil
+	}
+	retractedAt := r.log.RetractedAt.Format(time.RFC3339)
+	return &retractedAt
+}
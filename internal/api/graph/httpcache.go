@@ -0,0 +1,42 @@
+package graph
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// immutableMaxAge 已定稿结果的缓存时长，定稿后结果不会再变化
+const immutableMaxAge = 365 * 24 * time.Hour
+
+// etag 由数据版本号生成弱ETag，同一版本号的响应语义相同但不保证逐字节一致
+func etag(version string) string {
+	return `W/"` + version + `"`
+}
+
+// notModified 请求的If-None-Match包含当前ETag时返回true，调用方直接返回304
+func notModified(req *http.Request, tag string) bool {
+	header := req.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match使用弱比较
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheHeaders 设置ETag和Cache-Control，命中条件请求时写入304并返回true
+func setCacheHeaders(w http.ResponseWriter, req *http.Request, tag, cacheControl string) bool {
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if notModified(req, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
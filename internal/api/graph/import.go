@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+)
+
+// ImportVotes 导入旧系统的投票结果（管理接口）
+func (r *Resolver) ImportVotes(ctx context.Context, args struct {
+	Csv      string
+	PollId   *string
+	ImportId *string
+	DryRun   *bool
+}) (*VoteImportResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+
+	opts := service.ImportOptions{
+		PollID: pollIDOrDefault(args.PollId),
+		DryRun: args.DryRun != nil && *args.DryRun,
+		Audit:  requestctx.From(ctx).VoteAudit(),
+	}
+	if args.ImportId != nil {
+		opts.ImportID = *args.ImportId
+	}
+	result, err := r.importer.Import(ctx, []byte(args.Csv), opts)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &VoteImportResolver{result: result}, nil
+}
+
+// VoteImportResolver 投票导入结果解析器
+type VoteImportResolver struct {
+	result *model.VoteImport
+}
+
+func (r *VoteImportResolver) ImportId() string {
+	return r.result.ID
+}
+
+func (r *VoteImportResolver) TicketVersion() string {
+	return r.result.TicketVersion
+}
+
+func (r *VoteImportResolver) DryRun() bool {
+	return r.result.DryRun
+}
+
+func (r *VoteImportResolver) Rows() int32 {
+	return int32(r.result.Rows)
+}
+
+func (r *VoteImportResolver) Votes() int32 {
+	return int32(r.result.Votes)
+}
+
+func (r *VoteImportResolver) Events() int32 {
+	return int32(r.result.Events)
+}
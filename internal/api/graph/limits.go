@@ -0,0 +1,200 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// maxCost 复杂度计算的上限，避免limit参数层层倍乘后溢出
+const maxCost = 1 << 40
+
+// multiplierArgs 按参数值倍乘子字段复杂度的分页参数
+var multiplierArgs = map[string]bool{
+	"limit": true,
+	"first": true,
+}
+
+// errQueryInvalid 文档无法解析、找不到要执行的操作或片段相互引用，GraphQL处理器同样会拒绝这些请求
+var errQueryInvalid = errors.New("GraphQL文档无法解析")
+
+// withQueryLimits 在执行解析器之前拒绝复杂度超过graphql.max_complexity的请求，嵌套深度由Schema的MaxDepth在校验时限制
+// 超限或无法解析的请求返回400，不会跳过检查交给GraphQL处理器；其他请求的请求体原样交给GraphQL处理器
+// 请求体的大小由外层的withBodyLimit限制
+func withQueryLimits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxComplexity := config.AppConfig.GraphQL.MaxComplexity
+		if maxComplexity <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			http.Error(w, "读取请求失败", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var params struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if err := json.Unmarshal(body, &params); err != nil {
+			metrics.GraphQLRejectedQueries.WithLabelValues("invalid").Inc()
+			writeQueryRejected(w, "INVALID_QUERY", "解析请求失败: "+err.Error())
+			return
+		}
+		complexity, err := queryComplexity(params.Query, params.OperationName, params.Variables)
+		if err != nil {
+			metrics.GraphQLRejectedQueries.WithLabelValues("invalid").Inc()
+			writeQueryRejected(w, "INVALID_QUERY", err.Error())
+			return
+		}
+		if complexity > int64(maxComplexity) {
+			metrics.GraphQLRejectedQueries.WithLabelValues("complexity").Inc()
+			writeQueryRejected(w, "QUERY_TOO_COMPLEX", fmt.Sprintf("请求的复杂度%d超过上限%d", complexity, maxComplexity))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeQueryRejected 以GraphQL错误的格式返回400
+func writeQueryRejected(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]interface{}{
+			{"message": message, "extensions": map[string]interface{}{"code": code}},
+		},
+	})
+}
+
+// queryComplexity 计算请求执行的操作的复杂度，片段展开按其内容计入；文档由gqlparser解析，不校验字段是否存在
+func queryComplexity(query, operationName string, variables map[string]interface{}) (int64, error) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", errQueryInvalid, err.Error())
+	}
+
+	var op *ast.OperationDefinition
+	if operationName == "" && len(doc.Operations) == 1 {
+		op = doc.Operations[0]
+	} else if operationName != "" {
+		op = doc.Operations.ForName(operationName)
+	}
+	if op == nil {
+		return 0, fmt.Errorf("%w: 找不到要执行的操作", errQueryInvalid)
+	}
+
+	a := &complexityAnalyzer{
+		fragments: doc.Fragments,
+		variables: variables,
+		defaults:  make(map[string]int64),
+		costs:     make(map[string]int64),
+		visiting:  make(map[string]bool),
+	}
+	for _, definition := range op.VariableDefinitions {
+		if definition.DefaultValue != nil && definition.DefaultValue.Kind == ast.IntValue {
+			a.defaults[definition.Variable], _ = strconv.ParseInt(definition.DefaultValue.Raw, 10, 64)
+		}
+	}
+	return a.cost(op.SelectionSet)
+}
+
+// complexityAnalyzer 计算选择集的复杂度，片段的结果按名称缓存，相互引用的片段视为无法解析
+type complexityAnalyzer struct {
+	fragments ast.FragmentDefinitionList
+	variables map[string]interface{}
+	defaults  map[string]int64
+	costs     map[string]int64
+	visiting  map[string]bool
+}
+
+func (a *complexityAnalyzer) cost(set ast.SelectionSet) (int64, error) {
+	var total int64
+	for _, sel := range set {
+		var cost int64
+		var err error
+		switch sel := sel.(type) {
+		case *ast.Field:
+			cost, err = a.cost(sel.SelectionSet)
+			cost = 1 + saturatingMul(cost, a.multiplier(sel.Arguments))
+		case *ast.InlineFragment:
+			cost, err = a.cost(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			cost, err = a.fragmentCost(sel.Name)
+		}
+		if err != nil {
+			return 0, err
+		}
+		total = min(total+cost, maxCost)
+	}
+	return total, nil
+}
+
+func (a *complexityAnalyzer) fragmentCost(name string) (int64, error) {
+	if cost, ok := a.costs[name]; ok {
+		return cost, nil
+	}
+	fragment := a.fragments.ForName(name)
+	if fragment == nil {
+		return 0, fmt.Errorf("%w: 未定义的片段%s", errQueryInvalid, name)
+	}
+	if a.visiting[name] {
+		return 0, fmt.Errorf("%w: 片段%s引用了自身", errQueryInvalid, name)
+	}
+	a.visiting[name] = true
+	cost, err := a.cost(fragment.SelectionSet)
+	delete(a.visiting, name)
+	if err != nil {
+		return 0, err
+	}
+	a.costs[name] = cost
+	return cost, nil
+}
+
+// multiplier 字段的limit或first参数（字面值、变量或变量默认值），未指定或不是正数时为1
+func (a *complexityAnalyzer) multiplier(args ast.ArgumentList) int64 {
+	var limit int64
+	for _, arg := range args {
+		if !multiplierArgs[arg.Name] || arg.Value == nil {
+			continue
+		}
+		switch arg.Value.Kind {
+		case ast.IntValue:
+			value, err := strconv.ParseInt(arg.Value.Raw, 10, 64)
+			if err != nil {
+				value = maxCost
+			}
+			limit = value
+		case ast.Variable:
+			limit = a.defaults[arg.Value.Raw]
+			// JSON中的数字解码为float64
+			if value, ok := a.variables[arg.Value.Raw].(float64); ok {
+				limit = int64(min(value, maxCost))
+			}
+		}
+	}
+	return min(max(limit, 1), maxCost)
+}
+
+// saturatingMul 两个不超过maxCost的非负数相乘，结果超过maxCost时取maxCost
+func saturatingMul(a, b int64) int64 {
+	if a != 0 && b > maxCost/a {
+		return maxCost
+	}
+	return a * b
+}
@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// OutboxStatus 查询发件箱积压和中继状态，只有管理密钥可以查询
+func (r *Resolver) OutboxStatus(ctx context.Context) (*OutboxStatusResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	status, err := r.outbox.Status()
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxStatusResolver{status: status}, nil
+}
+
+// PauseOutboxRelay 暂停集群内所有实例的发件箱中继
+func (r *Resolver) PauseOutboxRelay(ctx context.Context, args struct{ Reason *string }) (*OutboxStatusResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	reason := ""
+	if args.Reason != nil {
+		reason = *args.Reason
+	}
+	if _, err := r.outboxControl.Pause(reason); err != nil {
+		return nil, err
+	}
+	return r.OutboxStatus(ctx)
+}
+
+// ResumeOutboxRelay 恢复集群内所有实例的发件箱中继
+func (r *Resolver) ResumeOutboxRelay(ctx context.Context) (*OutboxStatusResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	if _, err := r.outboxControl.Resume(); err != nil {
+		return nil, err
+	}
+	r.outbox.Notify()
+	return r.OutboxStatus(ctx)
+}
+
+// FlushOutbox 在本实例立即发送发件箱中的所有投票事件
+func (r *Resolver) FlushOutbox(ctx context.Context) (*OutboxFlushResultResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	sent, err := r.outbox.Flush()
+	if err != nil {
+		return nil, err
+	}
+	status, err := r.outbox.Status()
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxFlushResultResolver{sent: sent, status: status}, nil
+}
+
+// OutboxStatusResolver 发件箱状态解析器
+type OutboxStatusResolver struct {
+	status *model.OutboxStatus
+}
+
+func (r *OutboxStatusResolver) InstanceId() int32 {
+	return int32(r.status.InstanceID)
+}
+
+func (r *OutboxStatusResolver) Backlog() int32 {
+	return int32(r.status.Backlog)
+}
+
+func (r *OutboxStatusResolver) OldestAt() *string {
+	if r.status.OldestAt == nil {
+		return nil
+	}
+	oldestAt := r.status.OldestAt.Format(time.RFC3339)
+	return &oldestAt
+}
+
+func (r *OutboxStatusResolver) OldestAgeSeconds() float64 {
+	if r.status.OldestAt == nil {
+		return 0
+	}
+	return r.status.CheckedAt.Sub(*r.status.OldestAt).Seconds()
+}
+
+func (r *OutboxStatusResolver) Failed() int32 {
+	return int32(r.status.Failed)
+}
+
+func (r *OutboxStatusResolver) Pause() *ConsumptionStateResolver {
+	return &ConsumptionStateResolver{state: &r.status.Pause}
+}
+
+func (r *OutboxStatusResolver) Relayed() int32 {
+	return int32(r.status.Relayed)
+}
+
+func (r *OutboxStatusResolver) LastRelayAt() *string {
+	if r.status.LastRelay == nil {
+		return nil
+	}
+	lastRelayAt := r.status.LastRelay.Format(time.RFC3339)
+	return &lastRelayAt
+}
+
+func (r *OutboxStatusResolver) CheckedAt() string {
+	return r.status.CheckedAt.Format(time.RFC3339)
+}
+
+// OutboxFlushResultResolver 强制发送发件箱的结果解析器
+type OutboxFlushResultResolver struct {
+	sent   int
+	status *model.OutboxStatus
+}
+
+func (r *OutboxFlushResultResolver) Sent() int32 {
+	return int32(r.sent)
+}
+
+func (r *OutboxFlushResultResolver) Status() *OutboxStatusResolver {
+	return &OutboxStatusResolver{status: r.status}
+}
@@ -0,0 +1,129 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// CreatePollInput 创建投票活动的参数
+type CreatePollInput struct {
+	Id         string
+	Title      string
+	Candidates []string
+	StartsAt   *string
+	EndsAt     *string
+	Shadow     *bool
+}
+
+// CreatePoll 创建投票活动（管理接口）
+func (r *Resolver) CreatePoll(ctx context.Context, args struct{ Input CreatePollInput }) (*PollResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	poll, err := validation.ValidatePoll("input", validation.PollFields{
+		ID:         args.Input.Id,
+		Title:      args.Input.Title,
+		Candidates: args.Input.Candidates,
+		StartsAt:   args.Input.StartsAt,
+		EndsAt:     args.Input.EndsAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	poll.Shadow = args.Input.Shadow != nil && *args.Input.Shadow
+
+	created, err := r.voteService.CreatePoll(poll)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &PollResolver{poll: created}, nil
+}
+
+// SetPollShadow 开启或关闭投票活动的影子模式（管理接口）
+func (r *Resolver) SetPollShadow(ctx context.Context, args struct {
+	PollId string
+	Shadow bool
+}) (*PollResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	pollID, err := validation.ValidatePollID("pollId", args.PollId)
+	if err != nil {
+		return nil, err
+	}
+	poll, err := r.voteService.SetPollShadow(pollID, args.Shadow)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &PollResolver{poll: poll}, nil
+}
+
+// GetPoll 查询投票活动
+func (r *Resolver) GetPoll(ctx context.Context, args struct{ Id string }) (*PollResolver, error) {
+	pollID, err := validation.ValidatePollID("id", args.Id)
+	if err != nil {
+		return nil, err
+	}
+	poll, err := r.voteService.GetPoll(pollID)
+	if err != nil {
+		return nil, err
+	}
+	return &PollResolver{poll: poll}, nil
+}
+
+// PollResolver 投票活动解析器
+type PollResolver struct {
+	poll *model.Poll
+}
+
+func (r *PollResolver) Id() string {
+	return r.poll.ID
+}
+
+func (r *PollResolver) Title() string {
+	return r.poll.Title
+}
+
+func (r *PollResolver) Candidates() []string {
+	if r.poll.Candidates == nil {
+		return []string{}
+	}
+	return r.poll.Candidates
+}
+
+func (r *PollResolver) StartsAt() *string {
+	return formatOptionalTime(r.poll.StartsAt)
+}
+
+func (r *PollResolver) EndsAt() *string {
+	return formatOptionalTime(r.poll.EndsAt)
+}
+
+func (r *PollResolver) Shadow() bool {
+	return r.poll.Shadow
+}
+
+func (r *PollResolver) CreatedAt() *string {
+	if r.poll.CreatedAt.IsZero() {
+		return nil
+	}
+	return formatOptionalTime(&r.poll.CreatedAt)
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
@@ -0,0 +1,62 @@
+package graph
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+)
+
+// defaultMaxBodyBytes graphql.max_body_bytes为0时的请求体上限
+const defaultMaxBodyBytes = 1 << 20
+
+// withBodyLimit 限制请求体大小，超出上限时读取请求体返回错误，服务端不会缓冲任意大的请求
+func withBodyLimit(next http.Handler) http.Handler {
+	limit := config.AppConfig.GraphQL.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowVotes 按客户端IP为cost次投票扣减限流令牌，所有消耗票据使用次数的变更在执行前调用
+// 在解析器中扣减，别名、内联片段和命名片段中的投票字段都会计入
+func (r *Resolver) allowVotes(ctx context.Context, cost int) error {
+	if r.rateLimiter == nil {
+		return nil
+	}
+	wait, err := r.rateLimiter.Allow(requestctx.From(ctx).SourceIP, cost)
+	if err != nil {
+		return withReasonCode(&rateLimitedError{err: err, wait: wait}, model.VoteReasonRateLimited)
+	}
+	return nil
+}
+
+// rateLimitedError 被限流的投票，extensions.retryAfter为建议等待的秒数
+type rateLimitedError struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rateLimitedError) Unwrap() error {
+	return e.err
+}
+
+func (e *rateLimitedError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": "RATE_LIMITED"}
+	if e.wait > 0 {
+		extensions["retryAfter"] = int(math.Ceil(e.wait.Seconds()))
+	}
+	return extensions
+}
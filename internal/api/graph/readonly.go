@@ -0,0 +1,39 @@
+package graph
+
+import (
+	"errors"
+
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+// ErrReadOnly 只读副本不接受变更操作
+var ErrReadOnly = errors.New("READ_ONLY: 当前实例为只读副本，不接受变更操作")
+
+// readOnlyError 只读副本拒绝变更的错误，extensions中附带可写实例地址
+type readOnlyError struct {
+	redirect string
+}
+
+func (e *readOnlyError) Error() string {
+	return ErrReadOnly.Error()
+}
+
+func (e *readOnlyError) Unwrap() error {
+	return ErrReadOnly
+}
+
+func (e *readOnlyError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": "READ_ONLY"}
+	if e.redirect != "" {
+		extensions["redirect"] = e.redirect
+	}
+	return extensions
+}
+
+// checkWritable 只读副本模式下拒绝变更，提示客户端改用server.primary_url
+func checkWritable() error {
+	if !config.AppConfig.Server.ReadOnly {
+		return nil
+	}
+	return &readOnlyError{redirect: config.AppConfig.Server.PrimaryURL}
+}
@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// VerifyReceipt 校验投票回执并确认投票已落库
+func (r *Resolver) VerifyReceipt(ctx context.Context, args struct{ Receipt string }) (*ReceiptVerificationResolver, error) {
+	verification, err := r.voteService.VerifyReceipt(args.Receipt)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &ReceiptVerificationResolver{verification: verification}, nil
+}
+
+// ReceiptVerificationResolver 投票回执校验结果解析器
+type ReceiptVerificationResolver struct {
+	verification *model.ReceiptVerification
+}
+
+func (r *ReceiptVerificationResolver) EventId() string {
+	return r.verification.EventID
+}
+
+func (r *ReceiptVerificationResolver) TicketVersion() string {
+	return r.verification.TicketVersion
+}
+
+func (r *ReceiptVerificationResolver) Usernames() []string {
+	return r.verification.Usernames
+}
+
+func (r *ReceiptVerificationResolver) Recorded() bool {
+	return r.verification.Recorded
+}
+
+func (r *ReceiptVerificationResolver) RecordedAt() *string {
+	if r.verification.RecordedAt == nil {
+		return nil
+	}
+	recordedAt := r.verification.RecordedAt.Format(time.RFC3339)
+	return &recordedAt
+}
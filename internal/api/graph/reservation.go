@@ -0,0 +1,75 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+)
+
+// ReserveVote 两阶段投票第一步：校验票据并占用一次使用次数，限流令牌在这一步扣减，确认时不再扣减
+func (r *Resolver) ReserveVote(ctx context.Context, args struct{ Input VoteInput }) (*VoteReservationResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeVote); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := r.allowVotes(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	request, err := voteRequestFromInput(ctx, args.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation, err := r.voteService.ReserveVote(ctx, request)
+	if err != nil {
+		return nil, withReasonCode(toGraphQLError(err), service.VoteReasonCode(err))
+	}
+	return &VoteReservationResolver{reservation: reservation}, nil
+}
+
+// ConfirmVote 两阶段投票第二步：确认预约
+func (r *Resolver) ConfirmVote(ctx context.Context, args struct{ Token string }) (*VoteResponseResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeVote); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+
+	response, err := r.voteService.ConfirmVote(ctx, args.Token)
+	if err != nil {
+		return &VoteResponseResolver{response: response}, withReasonCode(toGraphQLError(err), service.VoteReasonCode(err))
+	}
+	return &VoteResponseResolver{response: response}, nil
+}
+
+// VoteReservationResolver 投票预约解析器
+type VoteReservationResolver struct {
+	reservation *model.VoteReservation
+}
+
+func (r *VoteReservationResolver) Token() string {
+	return r.reservation.Token
+}
+
+func (r *VoteReservationResolver) PollId() string {
+	return r.reservation.PollID
+}
+
+func (r *VoteReservationResolver) Usernames() []string {
+	return r.reservation.Usernames
+}
+
+func (r *VoteReservationResolver) RemainingUsages() int32 {
+	return int32(r.reservation.RemainingUsages)
+}
+
+func (r *VoteReservationResolver) ExpiresAt() string {
+	return r.reservation.ExpiresAt.Format(time.RFC3339)
+}
@@ -0,0 +1,162 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// GetPollResults 查询投票活动的结果
+func (r *Resolver) GetPollResults(ctx context.Context, args struct{ PollId string }) (*PollResultsResolver, error) {
+	results, err := r.voteService.GetPollResults(args.PollId)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &PollResultsResolver{results: results}, nil
+}
+
+// FinalizePoll 结束投票活动并生成结果快照，未开启认证时同样需要管理密钥
+func (r *Resolver) FinalizePoll(ctx context.Context, args struct{ PollId string }) (*PollResultsResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	results, err := r.voteService.FinalizePoll(args.PollId)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &PollResultsResolver{results: results}, nil
+}
+
+// serveResults 以JSON返回投票活动的结果，供CDN和浏览器缓存
+// 未定稿的结果每次凭ETag重新验证，结果版本号未变化时返回304；已定稿的结果永久缓存
+func (r *Resolver) serveResults(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "只支持GET请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pollID, err := validation.ValidatePollID("pollId", req.URL.Query().Get("pollId"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, finalized, err := r.voteService.PollResultsVersion(pollID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	cacheControl := "public, no-cache"
+	if finalized {
+		cacheControl = fmt.Sprintf("public, max-age=%d, immutable", int(immutableMaxAge/time.Second))
+	}
+	if setCacheHeaders(w, req, etag(version), cacheControl) {
+		return
+	}
+
+	results, err := r.voteService.GetPollResults(pollID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// PollResultsResolver 投票活动结果解析器
+type PollResultsResolver struct {
+	results *model.PollResults
+}
+
+func (r *PollResultsResolver) PollId() string {
+	return r.results.PollID
+}
+
+func (r *PollResultsResolver) Finalized() bool {
+	return r.results.Finalized
+}
+
+func (r *PollResultsResolver) FinalizedAt() *string {
+	if r.results.FinalizedAt == nil {
+		return nil
+	}
+	finalizedAt := r.results.FinalizedAt.Format(time.RFC3339)
+	return &finalizedAt
+}
+
+func (r *PollResultsResolver) TotalVotes() int32 {
+	return int32(r.results.TotalVotes)
+}
+
+func (r *PollResultsResolver) Results() []*UserVoteResolver {
+	resolvers := make([]*UserVoteResolver, len(r.results.Results))
+	for i, userVote := range r.results.Results {
+		resolvers[i] = &UserVoteResolver{userVote: userVote}
+	}
+	return resolvers
+}
+
+func (r *PollResultsResolver) Signature() *string {
+	if r.results.Signature == "" {
+		return nil
+	}
+	return &r.results.Signature
+}
+
+func (r *PollResultsResolver) Reconciled() int32 {
+	return int32(r.results.Reconciled)
+}
+
+// GetSnapshots 按时间顺序查询排名快照
+func (r *Resolver) GetSnapshots(ctx context.Context, args struct {
+	Since *string
+	Until *string
+	Limit *int32
+}) ([]*ResultSnapshotResolver, error) {
+	query, err := validation.ValidateSnapshotQuery(args.Since, args.Until, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := r.voteService.GetSnapshots(query.Since, query.Until, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*ResultSnapshotResolver, len(snapshots))
+	for i, snapshot := range snapshots {
+		resolvers[i] = &ResultSnapshotResolver{snapshot: snapshot}
+	}
+	return resolvers, nil
+}
+
+// ResultSnapshotResolver 排名快照解析器
+type ResultSnapshotResolver struct {
+	snapshot *model.ResultSnapshot
+}
+
+func (r *ResultSnapshotResolver) TakenAt() string {
+	return r.snapshot.TakenAt.Format(time.RFC3339)
+}
+
+func (r *ResultSnapshotResolver) TotalVotes() int32 {
+	return int32(r.snapshot.TotalVotes)
+}
+
+func (r *ResultSnapshotResolver) Standings() []*UserVoteResolver {
+	resolvers := make([]*UserVoteResolver, len(r.snapshot.Standings))
+	for i, userVote := range r.snapshot.Standings {
+		resolvers[i] = &UserVoteResolver{userVote: userVote}
+	}
+	return resolvers
+}
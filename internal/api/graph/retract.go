@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// RetractVote 撤销一票，非管理密钥只能撤销自己的投票，未开启认证时按客户端IP判断
+func (r *Resolver) RetractVote(ctx context.Context, args struct{ VoteLogId graphql.ID }) (*VoteRetractionResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeVote); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+
+	voteLogID, err := validation.ValidateVoteLogID("voteLogId", string(args.VoteLogId))
+	if err != nil {
+		return nil, err
+	}
+
+	info := requestctx.From(ctx)
+	response, err := r.voteService.RetractVote(voteLogID, info.VoteAudit(), info.HasRole(auth.ScopeAdmin))
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &VoteRetractionResolver{response: response}, nil
+}
+
+// VoteRetractionResolver 撤销投票结果解析器
+type VoteRetractionResolver struct {
+	response *model.RetractVoteResponse
+}
+
+func (r *VoteRetractionResolver) VoteLogId() graphql.ID {
+	return graphql.ID(strconv.FormatInt(r.response.VoteLogID, 10))
+}
+
+func (r *VoteRetractionResolver) EventId() string {
+	return r.response.EventID
+}
+
+func (r *VoteRetractionResolver) PollId() string {
+	return r.response.PollID
+}
+
+func (r *VoteRetractionResolver) Username() string {
+	return r.response.Username
+}
@@ -3,77 +3,756 @@ package graph
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
 	graphql "github.com/graph-gophers/graphql-go"
 	"github.com/graph-gophers/graphql-go/relay"
 	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/api/rest"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/control"
+	"github.com/lvdashuaibi/littlevote/internal/health"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
 	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/push"
+	"github.com/lvdashuaibi/littlevote/internal/registry"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
 	"github.com/lvdashuaibi/littlevote/internal/service"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
 )
 
 // GraphQLServer GraphQL服务器
 type GraphQLServer struct {
 	schema   *graphql.Schema
 	handler  *relay.Handler
+	handlers map[string]*relay.Handler // 按文档语言区分的处理器，只有内省返回的描述不同
 	resolver *Resolver
 }
 
 // 读取GraphQL Schema定义
 const schemaString = `
+# 用户的票数
 type UserVote {
+  # 票数所属的投票活动
+  pollId: String!
+  # 用户名
   username: String!
+  # 已落库的票数
   votes: Int!
+  # 票数的最后更新时间（RFC3339）
   updatedAt: String!
+  # 数据库不可用时返回的是最近一次已知票数，updatedAt为该票数的最后更新时间
+  stale: Boolean!
 }
 
+# 投票凭证，投票时需要携带当前有效的票据
 type Ticket {
+  # 票据所属的投票活动
+  pollId: String!
+  # 票据值
   value: String!
+  # 票据版本，每次轮换生成新版本
   version: String!
+  # 票据剩余的使用次数
   remainingUsages: Int!
+  # 票据过期时间（RFC3339）
   expiresAt: String!
+  # 票据签发时间（RFC3339）
   createdAt: String!
+  # 客户端绑定模式下票据绑定的调用方（API密钥的调用方或客户端IP），此时remainingUsages为该调用方的剩余次数；其他模式为空
+  holder: String
+  # 解析时的服务器时间（RFC3339）
+  serverTime: String!
+  # 距离票据轮换还剩的秒数
+  secondsUntilRotation: Float!
 }
 
+# 投票结果
 type VoteResponse {
+  # 是否投票成功
   success: Boolean!
+  # 投票结果说明，失败时为失败原因
   message: String!
+  # 本次投票的用户名列表
   usernames: [String!]!
+  # 投票处理时间（RFC3339）
   timestamp: String!
+  # 投票后票据的剩余使用次数，投票失败时为空
+  remainingUsages: Int
+  # 签名的投票回执，可通过verifyReceipt确认投票已落库；投票失败或未配置回执密钥时为空
+  receipt: String
+  # 投票失败的原因码，投票成功或无法归类时为空
+  reasonCode: VoteReasonCode
+  # 投票事件ID，可传给getUserVotes的afterEventId等待该投票落库；投票失败时为空
+  eventId: String
 }
 
+# 两阶段投票中已占用一次票据使用次数、等待确认的投票
+type VoteReservation {
+  # 确认投票时使用的预约令牌
+  token: String!
+  # 预约所属的投票活动
+  pollId: String!
+  # 预约投票的用户名列表
+  usernames: [String!]!
+  # 占用后票据的剩余使用次数
+  remainingUsages: Int!
+  # 超过该时间未确认时预约失效，占用的使用次数被归还
+  expiresAt: String!
+}
+
+# 已受理的撤销投票，补偿事件落库后被撤销的一票才从票数中扣减
+type VoteRetraction {
+  # 被撤销的投票日志ID
+  voteLogId: ID!
+  # 补偿事件ID
+  eventId: String!
+  # 被撤销投票所属的投票活动
+  pollId: String!
+  # 被撤销投票的用户名
+  username: String!
+}
+
+# 管理员调整用户票数的审计记录
+type AdminAction {
+  # 审计记录ID
+  id: ID!
+  # 操作类型，设置票数为set_user_votes
+  action: String!
+  # 执行操作的调用方
+  actor: String!
+  # 调整的投票活动
+  pollId: String!
+  # 调整的用户名
+  username: String!
+  # 调整前的票数
+  previousVotes: Int!
+  # 调整后的票数
+  votes: Int!
+  # 操作时间（RFC3339）
+  createdAt: String!
+}
+
+# 查询票数的一致性级别
+enum ReadConsistency {
+  # 不经过缓存和从库，直接读主库
+  STRONG
+  # 优先读缓存和从库，刚受理的投票可能尚未体现
+  EVENTUAL
+}
+
+# 投票失败的原因码
+enum VoteReasonCode {
+  # 票据已过期或已被新版本替换
+  TICKET_EXPIRED
+  # 票据使用次数或投票活动的票据预算已耗尽
+  TICKET_EXHAUSTED
+  # 用户名列表为空或包含不合法的候选人
+  INVALID_CANDIDATE
+  # 投票活动未开始或已结束
+  WINDOW_CLOSED
+  # 请求过于频繁
+  RATE_LIMITED
+  # 相同的投票请求正在处理中
+  DUPLICATE
+  # 投票预约不存在、已确认或已超时释放
+  RESERVATION_EXPIRED
+}
+
+# 投票活动的结果
+type PollResults {
+  # 投票活动ID
+  pollId: String!
+  # 是否已定稿，定稿后结果为不可变的快照
+  finalized: Boolean!
+  # 定稿时间（RFC3339），未定稿时为空
+  finalizedAt: String
+  # 总票数
+  totalVotes: Int!
+  # 按票数倒序排列的用户票数
+  results: [UserVote!]!
+  # 结果快照的HMAC-SHA256签名，未定稿时为空
+  signature: String
+  # 定稿前对账修正的用户票数记录数
+  reconciled: Int!
+}
+
+# 投票活动的统计数据
+type PollStats {
+  # 投票活动ID
+  pollId: String!
+  # 已落库的票数
+  totalVotes: Int!
+  # 按整点小时统计的票数，按时间顺序
+  votesPerHour: [HourlyVotes!]!
+  # 按调用方或客户端IP估算的去重投票者数量
+  uniqueVoters: Int!
+  # 签发的票据使用次数之和
+  ticketsIssued: Int!
+  # 实际消耗的票据使用次数
+  ticketsUsed: Int!
+  # ticketsUsed / ticketsIssued，尚未签发票据时为0
+  ticketUtilization: Float!
+  # 按原因码统计的投票拒绝次数，无法归类的计为OTHER
+  rejections: [RejectionCount!]!
+}
+
+# 单个票据版本的利用率
+type TicketStats {
+  # 票据版本
+  version: String!
+  # 票据所属的投票活动
+  pollId: String!
+  # 签发的使用次数
+  issued: Int!
+  # 实际消耗的使用次数，票据轮换前为空
+  consumed: Int
+  # consumed / issued，票据轮换前为空
+  utilization: Float
+  # 票据签发时间（RFC3339）
+  createdAt: String!
+  # 票据过期时间（RFC3339）
+  expiresAt: String!
+  # 票据被新版本替换的时间
+  rotatedAt: String
+}
+
+# 一个整点小时内的票数
+type HourlyVotes {
+  # 整点时间（RFC3339）
+  hour: String!
+  # 该小时内的票数
+  votes: Int!
+}
+
+# 某个原因码的投票拒绝次数
+type RejectionCount {
+  # 投票失败的原因码，无法归类的为OTHER
+  reasonCode: String!
+  # 拒绝次数
+  count: Int!
+}
+
+# 某一时刻的排名快照
+type ResultSnapshot {
+  # 快照时间（RFC3339）
+  takenAt: String!
+  # 快照时的总票数
+  totalVotes: Int!
+  # 快照时按票数倒序排列的用户票数
+  standings: [UserVote!]!
+}
+
+# 投票回执的校验结果
+type ReceiptVerification {
+  # 投票事件ID
+  eventId: String!
+  # 投票时使用的票据版本
+  ticketVersion: String!
+  # 回执中的用户名列表
+  usernames: [String!]!
+  # 回执中的投票是否已全部写入投票日志
+  recorded: Boolean!
+  # 投票日志的写入时间，未写入时为空
+  recordedAt: String
+}
+
+# 票据生产者的租约信息
+type ProducerInfo {
+  # 生产者实例ID
+  instanceId: Int!
+  # 成为生产者的时间（RFC3339）
+  since: String!
+  # 最近一次续约时间（RFC3339）
+  renewedAt: String!
+}
+
+# 系统状态
+type SystemStatus {
+  # 当前实例ID
+  instanceId: Int!
+  # 当前实例是否为票据生产者
+  isProducer: Boolean!
+  # 集群当前的票据生产者，没有生产者时为空
+  currentProducer: ProducerInfo
+}
+
+# 集群中注册的实例
+type Instance {
+  # 实例ID
+  id: Int!
+  # 主机名
+  host: String!
+  # 实际监听的GraphQL服务端口
+  port: Int!
+  # 实际监听的gRPC服务端口，未开启gRPC时为空
+  grpcPort: Int
+  # 当前角色: producer / worker / replica
+  role: String!
+  # 构建版本
+  version: String!
+  # 进程启动时间（RFC3339）
+  startedAt: String!
+  # 最近一次心跳时间（RFC3339）
+  heartbeatAt: String!
+}
+
+# 单个来源的投票积压
+type QueueDepth {
+  # 积压来源: outbox / producer / kafka
+  source: String!
+  # Kafka分区，其他来源为空
+  partition: Int
+  # 积压的投票事件数
+  depth: Int!
+}
+
+# 本实例尚未落库的投票积压
+type VoteQueueStatus {
+  # 实例ID
+  instanceId: Int!
+  # 各来源积压之和
+  total: Int!
+  # 各来源的积压明细
+  depths: [QueueDepth!]!
+  # 统计时间（RFC3339）
+  checkedAt: String!
+}
+
+# user_votes中的票数与按投票日志统计的票数不一致的用户
+type VoteCountMismatch {
+  # 投票活动ID
+  pollId: String!
+  # 用户名
+  username: String!
+  # user_votes中的票数
+  votes: Int!
+  # 按投票日志统计的票数
+  loggedVotes: Int!
+}
+
+# Redis中缓存的票数与主库不一致的用户
+type CacheMismatch {
+  # 投票活动ID
+  pollId: String!
+  # 用户名
+  username: String!
+  # Redis中缓存的票数
+  cachedVotes: Int!
+  # 主库user_votes中的票数
+  votes: Int!
+}
+
+# 计票主题一个分区的消费积压
+type PartitionLag {
+  # 主题
+  topic: String!
+  # 消费者组，静态分配模式下为空
+  groupId: String
+  # 分区
+  partition: Int!
+  # 下一条待消费消息的偏移量，没有提交过时为-1
+  committed: Int!
+  # 分区末尾的偏移量
+  end: Int!
+  # 尚未消费的消息数
+  lag: Int!
+}
+
+# 一致性检查的结果
+type ConsistencyReport {
+  # 票数与投票日志、缓存与主库是否都一致
+  consistent: Boolean!
+  # 票数与投票日志不一致的用户
+  voteMismatches: [VoteCountMismatch!]!
+  # 缓存与主库不一致的用户
+  cacheMismatches: [CacheMismatch!]!
+  # 各分区的消费积压
+  lags: [PartitionLag!]!
+  # 各分区积压之和
+  totalLag: Int!
+  # 查询消费积压失败的原因，成功时为空
+  lagError: String
+  # 是否已修正
+  repaired: Boolean!
+  # 修正的user_votes记录数
+  repairedVotes: Int!
+  # 删除的用户票数缓存数
+  invalidatedCaches: Int!
+  # 检查时间（RFC3339）
+  checkedAt: String!
+}
+
+# 发件箱积压和中继状态
+type OutboxStatus {
+  # 实例ID
+  instanceId: Int!
+  # 发件箱中尚未发送到Kafka的投票事件数（集群范围）
+  backlog: Int!
+  # 最早一条未发送事件的写入时间（RFC3339），发件箱为空时为空
+  oldestAt: String
+  # 最早一条未发送事件的等待秒数，发件箱为空时为0
+  oldestAgeSeconds: Float!
+  # 无法解析而标记为失败、中继不再发送的投票事件数（集群范围）
+  failed: Int!
+  # 中继的暂停状态（集群范围）
+  pause: ConsumptionState!
+  # 本实例启动以来发送的投票事件数
+  relayed: Int!
+  # 本实例最近一次发送的时间（RFC3339），尚未发送时为空
+  lastRelayAt: String
+  # 统计时间（RFC3339）
+  checkedAt: String!
+}
+
+# 强制发送发件箱的结果
+type OutboxFlushResult {
+  # 本次发送的投票事件数
+  sent: Int!
+  # 发送后的发件箱状态
+  status: OutboxStatus!
+}
+
+# 本实例的构建和运行信息
+type ServerInfo {
+  # 构建版本
+  version: String!
+  # 构建时的Git提交
+  commit: String!
+  # 构建时间（RFC3339），未注入时为空
+  buildTime: String
+  # 进程启动时间
+  startedAt: String!
+  # 实例ID
+  instanceId: Int!
+  # 当前角色: producer / worker / replica
+  role: String!
+}
+
+# 集群范围的暂停状态，用于投票事件消费和发件箱中继
+type ConsumptionState {
+  # 集群是否已暂停
+  paused: Boolean!
+  # 暂停原因，未暂停时为空
+  reason: String
+  # 发起暂停的实例ID，未暂停时为空
+  pausedBy: Int
+  # 暂停开始时间（RFC3339），未暂停时为空
+  since: String
+}
+
+# 生效的配置项
+type ConfigEntry {
+  # 配置键，如vote.idempotency_ttl
+  key: String!
+  # 配置值，敏感信息已脱敏
+  value: String!
+  # 配置来源: file / env / flag / default
+  source: String!
+}
+
+# 登记的候选人，vote.candidate_validator为registry时只能给登记过的候选人投票
+type Candidate {
+  # 候选人名称
+  name: String!
+  # 登记时间（RFC3339）
+  createdAt: String!
+}
+
+# 投票活动，候选人列表为空时接受符合用户名规则的任意用户名（registry模式下为任意登记过的候选人）
+type Poll {
+  # 投票活动ID
+  id: String!
+  # 标题
+  title: String!
+  # 候选人列表
+  candidates: [String!]!
+  # 开始投票的时间（RFC3339），为空时创建后立即开始
+  startsAt: String
+  # 结束投票的时间（RFC3339），为空时直到定稿
+  endsAt: String
+  # 是否处于影子模式，影子模式下投票照常受理并记录日志，但不计入票数
+  shadow: Boolean!
+  # 创建时间（RFC3339），只在配置文件中配置的活动为空
+  createdAt: String
+}
+
+# 创建投票活动的参数
+input CreatePollInput {
+  # 投票活动ID，只能包含字母、数字、下划线和连字符
+  id: String!
+  # 标题
+  title: String!
+  # 候选人列表，每个候选人需要符合用户名规则且不能重复
+  candidates: [String!]!
+  # 开始投票的时间（RFC3339），不传时创建后立即开始
+  startsAt: String
+  # 结束投票的时间（RFC3339），不传时直到定稿
+  endsAt: String
+  # 是否以影子模式创建，用于上线前演练，不传时为false
+  shadow: Boolean
+}
+
+# 投票请求
 input VoteInput {
+  # 投票的用户名列表
   usernames: [String!]!
+  # 当前有效的票据
   ticket: TicketInput!
+  # 客户端生成的幂等键，超时重试时携带相同的键，同一个键只计票一次
+  idempotencyKey: String
 }
 
+# 投票时携带的票据，与getTicket返回的字段一致
 input TicketInput {
+  # 票据所属的投票活动，不传时为default
+  pollId: String
+  # 票据值
   value: String!
+  # 票据版本
   version: String!
+  # 票据剩余的使用次数
   remainingUsages: Int!
+  # 票据过期时间（RFC3339）
   expiresAt: String!
+  # 票据签发时间（RFC3339）
   createdAt: String!
+  # 票据绑定的调用方，与getTicket返回的一致，不传时以请求的调用方为准
+  holder: String
 }
 
+# 一条投票日志
+type VoteLog {
+  # 投票日志ID，用作导出游标
+  id: String!
+  # 投票事件ID
+  eventId: String!
+  # 投票活动ID
+  pollId: String!
+  # 被投票的用户名
+  username: String!
+  # 投票时使用的票据版本
+  ticketVersion: String!
+  # 发起投票的调用方
+  actor: String!
+  # 客户端IP
+  sourceIp: String!
+  # 客户端User-Agent
+  userAgent: String!
+  # 投票时间（RFC3339）
+  votedAt: String!
+  # 是否为影子模式下的投票，影子投票不计入票数
+  shadow: Boolean!
+  # 投票被撤销的时间（RFC3339），未撤销时为空
+  retractedAt: String
+}
+
+# 一页投票日志
+type VoteLogPage {
+  # 本页的投票日志，按id顺序
+  entries: [VoteLog!]!
+  # 本页最后一条的游标，没有数据时为空
+  endCursor: String
+  # 是否还有下一页
+  hasMore: Boolean!
+}
+
+# 翻页信息
+type PageInfo {
+  # 本页最后一条的游标，没有数据时为空
+  endCursor: String
+  # 是否还有下一页
+  hasNextPage: Boolean!
+}
+
+# 投票日志审计查询结果中的一条
+type VoteLogEdge {
+  # 该条投票日志的游标
+  cursor: String!
+  node: VoteLog!
+}
+
+# 投票日志审计查询的一页结果，按投票日志ID从新到旧排列
+type VoteLogConnection {
+  edges: [VoteLogEdge!]!
+  pageInfo: PageInfo!
+}
+
+# API密钥的权限范围
+enum ApiKeyScope {
+  # 只能执行查询
+  READ
+  # 查询和投票
+  VOTE
+}
+
+# 调用接口的API密钥，服务端只保存密钥的哈希
+type ApiKey {
+  id: String!
+  # 密钥的用途说明
+  name: String!
+  # 密钥的前几个字符，用于辨认
+  prefix: String!
+  scope: ApiKeyScope!
+  createdAt: String!
+  # 吊销时间，未吊销时为空
+  revokedAt: String
+}
+
+# 新创建的API密钥
+type CreatedApiKey {
+  apiKey: ApiKey!
+  # 完整的密钥，只在创建时返回这一次
+  key: String!
+}
+
+# 投票导入的结果
+type VoteImport {
+  # 导入批次，相同批次重复导入不会重复计票
+  importId: String!
+  # 导入的投票在投票日志中的票据版本，即import-<导入批次>
+  ticketVersion: String!
+  # 是否只校验不导入
+  dryRun: Boolean!
+  rows: Int!
+  votes: Int!
+  # 写入发件箱的投票事件数，试运行时为将要写入的事件数
+  events: Int!
+}
+
+# 查询接口
 type Query {
-  # 获取当前票据
-  getTicket: Ticket!
+  # 获取投票活动的当前票据，不传pollId时为default
+  getTicket(pollId: String): Ticket!
   
-  # 查询用户票数
-  getUserVotes(username: String!): UserVote!
+  # 查询投票活动中用户的票数，不传pollId时为default
+  # consistency为STRONG时直接读主库；同时传afterEventId时先等待该投票落库，超过vote.strong_read_timeout时返回当前票数并标记stale
+  getUserVotes(username: String!, pollId: String, consistency: ReadConsistency = EVENTUAL, afterEventId: String): UserVote!
   
-  # 查询所有用户票数
-  getAllUserVotes: [UserVote!]!
+  # 查询投票活动中所有用户的票数，不传pollId时为default
+  getAllUserVotes(pollId: String): [UserVote!]!
+
+  # 查询投票活动票数最高的limit个用户，按票数从高到低排列，票数相同时按用户名排列；不传pollId时为default
+  leaderboard(limit: Int!, pollId: String): [UserVote!]!
+
+  # 查询投票活动的定义
+  getPoll(id: String!): Poll!
+
+  # 查询登记的候选人，按名称排列
+  candidates: [Candidate!]!
+
+  # 查询投票活动的结果，已定稿时返回结果快照
+  getPollResults(pollId: String!): PollResults!
+
+  # 查询投票活动的统计数据
+  getPollStats(pollId: String!): PollStats!
+
+  # 按签发时间倒序查询各票据版本的利用率，不传pollId时查询所有活动，limit默认100、最大1000（管理接口）
+  getTicketStats(pollId: String, limit: Int): [TicketStats!]!
+
+  # 按id顺序分页导出投票日志，after为上一页的endCursor，limit默认1000、最大10000（管理接口）
+  exportVoteLogs(pollId: String, after: String, limit: Int): VoteLogPage!
+
+  # 按用户名、票据版本和投票时间（from含、to不含，RFC3339）审计投票日志，按id从新到旧分页，first默认50、最大500，after为上一页的endCursor（需要管理密钥）
+  voteLogs(username: String, ticketVersion: String, from: String, to: String, first: Int, after: String): VoteLogConnection!
+
+  # 按时间顺序查询排名快照，since/until为RFC3339时间，limit默认100、最大1000
+  getSnapshots(since: String, until: String, limit: Int): [ResultSnapshot!]!
+
+  # 校验投票回执并确认投票已落库
+  verifyReceipt(receipt: String!): ReceiptVerification!
+
+  # 查询系统状态
+  systemStatus: SystemStatus!
+
+  # 查询本实例的构建版本、启动时间和角色
+  serverInfo: ServerInfo!
+
+  # 查询集群中存活的实例（管理接口）
+  listInstances: [Instance!]!
+
+  # 查询本实例尚未落库的投票积压（管理接口）
+  voteQueueStatus: VoteQueueStatus!
+
+  # 查询投票事件消费的暂停状态（管理接口）
+  consumptionState: ConsumptionState!
+
+  # 查询发件箱积压和中继状态（管理接口）
+  outboxStatus: OutboxStatus!
+
+  # 查询生效的配置，敏感信息已脱敏（管理接口）
+  configDump: [ConfigEntry!]!
+
+  # 检查票数与投票日志、Redis缓存与主库是否一致，并统计各分区的消费积压，pollId为空时检查所有投票活动（管理接口）
+  checkConsistency(pollId: String): ConsistencyReport!
 }
 
+# 变更接口
 type Mutation {
   # 投票
   vote(input: VoteInput!): VoteResponse!
   
   # 获取票据并立即投票
-  ticketAndVote(usernames: [String!]!): VoteResponse!
+  ticketAndVote(usernames: [String!]!, pollId: String): VoteResponse!
+
+  # 批量投票，最多vote.batch_max_size个，按投票数限流；返回与inputs一一对应的结果，一项失败不影响其他项
+  voteBatch(inputs: [VoteInput!]!): [VoteResponse!]!
+
+  # 两阶段投票第一步：校验票据并占用一次使用次数，返回预约令牌；超时未确认时自动归还
+  reserveVote(input: VoteInput!): VoteReservation!
+
+  # 两阶段投票第二步：确认预约，投票计入
+  confirmVote(token: String!): VoteResponse!
+
+  # 创建投票活动，候选人的票数从0开始；registry模式下候选人必须都已登记（管理接口）
+  createPoll(input: CreatePollInput!): Poll!
+
+  # 登记候选人，名称去除首尾空白后按用户名的长度限制校验，pattern模式下还需匹配vote.username_pattern（管理接口）
+  registerCandidate(name: String!): Candidate!
+
+  # 开启或关闭投票活动的影子模式，关闭后新的投票开始计入票数，之前的影子投票仍不计入（管理接口）
+  setPollShadow(pollId: String!, shadow: Boolean!): Poll!
+
+  # 结束投票活动，对账后生成签名的结果快照（管理接口）
+  finalizePoll(pollId: String!): PollResults!
+
+  # 暂停集群内所有实例的投票事件消费，例如数据库维护期间（管理接口）
+  pauseConsumption(reason: String): ConsumptionState!
+
+  # 恢复集群内所有实例的投票事件消费（管理接口）
+  resumeConsumption: ConsumptionState!
+
+  # 暂停集群内所有实例的发件箱中继，投票仍被受理并留在发件箱中（管理接口）
+  pauseOutboxRelay(reason: String): OutboxStatus!
+
+  # 恢复集群内所有实例的发件箱中继（管理接口）
+  resumeOutboxRelay: OutboxStatus!
+
+  # 在本实例立即发送发件箱中的所有投票事件，中继暂停时同样执行（管理接口）
+  flushOutbox: OutboxFlushResult!
+
+  # 检查一致性，以投票日志为准修正不一致的票数并删除不一致的缓存，pollId为空时检查所有投票活动（管理接口）
+  repairConsistency(pollId: String): ConsistencyReport!
+
+  # 创建API密钥，完整的密钥只在响应中返回一次（需要管理密钥）
+  createApiKey(name: String!, scope: ApiKeyScope!): CreatedApiKey!
+
+  # 吊销API密钥，本实例立即生效，其他实例在auth.cache_ttl内生效（需要管理密钥）
+  revokeApiKey(id: String!): ApiKey!
+
+  # 导入旧系统的投票结果，csv第1行为表头：username必填，votes缺省为1，poll_id缺省为pollId参数；任一行不合法时不导入（管理接口）
+  importVotes(csv: String!, pollId: String, importId: String, dryRun: Boolean): VoteImport!
+
+  # 撤销一票，补偿事件经Kafka落库后扣减票数并标记投票日志；非管理密钥只能撤销自己的投票，未开启认证时按客户端IP判断
+  retractVote(voteLogId: ID!): VoteRetraction!
+
+  # 把用户票数直接设置为votes并记录审计，调整量在对账和定稿时保留（管理接口）
+  adminSetUserVotes(username: String!, votes: Int!, pollId: String): AdminAction!
 }
 
 schema {
@@ -82,58 +761,195 @@ schema {
 }
 `
 
+// SchemaString 返回中文文档的GraphQL Schema定义，compat-check据此比较两个版本的接口
+func SchemaString() string {
+	return schemaString
+}
+
 // NewGraphQLServer 创建新的GraphQL服务器
-func NewGraphQLServer(voteService *service.VoteService) *GraphQLServer {
-	resolver := NewResolver(voteService)
+func NewGraphQLServer(services Services) *GraphQLServer {
+	resolver := NewResolver(services)
+	tracer := newDeprecationTracer(schemaString)
 
 	// 解析Schema并创建GraphQL实例
 	schema := graphql.MustParseSchema(schemaString, resolver,
 		graphql.UseFieldResolvers(),
+		graphql.Tracer(tracer),
+		graphql.MaxDepth(config.AppConfig.GraphQL.MaxDepth),
 	)
 
 	handler := &relay.Handler{Schema: schema}
 
+	// 为每种语言解析一份Schema，注释即字段描述，Playground和内省工具按请求的语言展示文档
+	handlers := map[string]*relay.Handler{schemaLocale: handler}
+	for locale, docs := range schemaDocs {
+		if missing := missingDocs(schemaString, docs); len(missing) > 0 {
+			resolver.logger.Warn("GraphQL文档缺少翻译，沿用中文描述", "locale", locale, "missing", missing)
+		}
+		localized := graphql.MustParseSchema(localizeSchema(schemaString, docs), resolver,
+			graphql.UseFieldResolvers(),
+			graphql.Tracer(tracer),
+			graphql.MaxDepth(config.AppConfig.GraphQL.MaxDepth),
+		)
+		handlers[locale] = &relay.Handler{Schema: localized}
+	}
+
 	return &GraphQLServer{
 		schema:   schema,
 		handler:  handler,
+		handlers: handlers,
 		resolver: resolver,
 	}
 }
 
-// Start 启动GraphQL服务器
-func (s *GraphQLServer) Start(port int) error {
+// ServeHTTP 按请求的语言选择处理器执行GraphQL请求
+func (s *GraphQLServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	locale := docLocale(r, func(lang string) bool {
+		_, ok := s.handlers[lang]
+		return ok
+	})
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	s.handlers[locale].ServeHTTP(w, r)
+}
+
+// Serve 在监听器上提供GraphQL服务，阻塞直到服务停止
+func (s *GraphQLServer) Serve(listener net.Listener) error {
+	if _, err := trustedProxies(); err != nil {
+		return err
+	}
+
 	// 创建路由
 	mux := http.NewServeMux()
 
 	// 设置GraphQL API端点
-	mux.Handle(config.AppConfig.GraphQL.Path, s.handler)
+	var handler http.Handler = withBodyLimit(withQueryLimits(s))
+	if s.resolver.auth != nil {
+		handler = s.resolver.auth.Middleware(handler)
+	}
+	if !config.AppConfig.GraphQL.Disabled {
+		mux.Handle(config.AppConfig.GraphQL.Path, withRequestContext(handler))
+	}
+
+	// 设置REST接口，与GraphQL接口使用相同的请求上下文和API密钥认证
+	if s.resolver.rest != nil {
+		var restHandler http.Handler = s.resolver.rest
+		if s.resolver.auth != nil {
+			restHandler = s.resolver.auth.Middleware(restHandler)
+		}
+		mux.Handle(rest.Prefix()+"/", withRequestContext(restHandler))
+	}
+
+	// 设置WebSocket推送端点，连接建立时校验API密钥
+	if s.resolver.push != nil {
+		var pushHandler http.Handler = s.resolver.push
+		if s.resolver.auth != nil {
+			pushHandler = s.resolver.auth.Middleware(pushHandler)
+		}
+		mux.Handle(push.Path(), withRequestContext(pushHandler))
+	}
+
+	// 设置运行信息端点
+	mux.HandleFunc("/version", s.resolver.serveVersion)
+
+	// 设置投票活动结果端点，带有缓存头供CDN缓存
+	mux.HandleFunc("/results", s.resolver.serveResults)
+
+	// 设置投票日志流式导出端点，需要管理密钥
+	var exportHandler http.Handler = http.HandlerFunc(s.resolver.serveVoteLogExport)
+	if s.resolver.auth != nil {
+		exportHandler = s.resolver.auth.Middleware(exportHandler)
+	}
+	mux.Handle("/export/vote-logs", withRequestContext(exportHandler))
+
+	// 设置Prometheus指标端点
+	mux.Handle("/metrics", metrics.Handler())
+
+	// 设置存活和就绪检查端点，返回各依赖的状态
+	if s.resolver.health != nil {
+		mux.HandleFunc("/healthz", s.resolver.health.ServeHealthz)
+		mux.HandleFunc("/readyz", s.resolver.health.ServeReadyz)
+	}
 
 	// 设置GraphQL Playground
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(playgroundHTML))
-	})
+	if !config.AppConfig.GraphQL.Disabled {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(playgroundHTML))
+		})
+	}
 
 	// 启动服务器
-	addr := fmt.Sprintf(":%d", port)
-	log.Printf("GraphQL服务已启动，API端点: %s, Playground: http://localhost%s/",
-		config.AppConfig.GraphQL.Path, addr)
+	s.resolver.logger.Info("GraphQL服务已启动", "addr", listener.Addr().String(), "path", config.AppConfig.GraphQL.Path,
+		"graphql", !config.AppConfig.GraphQL.Disabled, "rest", s.resolver.rest != nil, "push", s.resolver.push != nil)
 
-	return http.ListenAndServe(addr, mux)
+	return http.Serve(listener, mux)
 }
 
 // Resolver GraphQL解析器
 type Resolver struct {
-	voteService *service.VoteService
+	voteService   *service.VoteService
+	ticketService *ticket.TicketService
+	registry      *registry.Registry
+	queue         *service.QueueInspector
+	consumption   *control.PauseControl
+	outbox        *service.OutboxRelay
+	outboxControl *control.PauseControl
+	health        *health.Checker
+	rateLimiter   *service.RateLimiter
+	auth          *auth.Authenticator
+	importer      *service.VoteImporter
+	consistency   *service.ConsistencyChecker
+	rest          http.Handler
+	push          http.Handler
+	role          func() string
+	logger        *slog.Logger
+}
+
+// Services 解析器依赖的服务
+type Services struct {
+	VoteService   *service.VoteService
+	TicketService *ticket.TicketService
+	Registry      *registry.Registry
+	Queue         *service.QueueInspector
+	Consumption   *control.PauseControl
+	Outbox        *service.OutboxRelay
+	OutboxControl *control.PauseControl
+	Health        *health.Checker
+	RateLimiter   *service.RateLimiter // 按客户端IP的投票限流
+	Auth          *auth.Authenticator  // API密钥认证
+	Importer      *service.VoteImporter
+	Consistency   *service.ConsistencyChecker
+	REST          http.Handler  // REST接口，为nil时不提供
+	Push          http.Handler  // WebSocket推送，为nil时不提供
+	Role          func() string // 本实例当前的角色
+	Logger        *slog.Logger  // 为nil时使用默认日志
 }
 
 // NewResolver 创建新的解析器
-func NewResolver(voteService *service.VoteService) *Resolver {
-	return &Resolver{voteService: voteService}
+func NewResolver(services Services) *Resolver {
+	return &Resolver{
+		voteService:   services.VoteService,
+		ticketService: services.TicketService,
+		queue:         services.Queue,
+		consumption:   services.Consumption,
+		outbox:        services.Outbox,
+		outboxControl: services.OutboxControl,
+		health:        services.Health,
+		rateLimiter:   services.RateLimiter,
+		auth:          services.Auth,
+		importer:      services.Importer,
+		consistency:   services.Consistency,
+		rest:          services.REST,
+		push:          services.Push,
+		registry:      services.Registry,
+		role:          services.Role,
+		logger:        logging.Component(services.Logger, "graphql"),
+	}
 }
 
-// GetTicket 获取当前票据 ok
-func (r *Resolver) GetTicket(ctx context.Context) (*TicketResolver, error) {
+// GetTicket 获取投票活动的当前票据 ok
+func (r *Resolver) GetTicket(ctx context.Context, args struct{ PollId *string }) (*TicketResolver, error) {
 	failResponse := &TicketResolver{
 		ticket: &model.Ticket{
 			Value:           "",
@@ -143,27 +959,44 @@ func (r *Resolver) GetTicket(ctx context.Context) (*TicketResolver, error) {
 			CreatedAt:       time.Now(),
 		},
 	}
-	// 生成客户端ID
-	clientID := fmt.Sprintf("client-%d", time.Now().UnixNano())
-
-	ticket, err := r.voteService.GetTicket(clientID)
+	ticket, err := r.voteService.GetTicket(pollIDOrDefault(args.PollId), requestctx.From(ctx).VoteAudit().Principal())
 	if err != nil {
-		return failResponse, err
+		return failResponse, toGraphQLError(err)
 	}
 
 	return &TicketResolver{ticket: ticket}, nil
 }
 
-// GetUserVotes 获取用户票数 ok
-func (r *Resolver) GetUserVotes(ctx context.Context, args struct{ Username string }) (*UserVoteResolver, error) {
+// GetUserVotes 获取投票活动中用户的票数
+func (r *Resolver) GetUserVotes(ctx context.Context, args struct {
+	Username     string
+	PollId       *string
+	Consistency  string
+	AfterEventId *string
+}) (*UserVoteResolver, error) {
 	failResponse := &UserVoteResolver{
 		userVote: &model.UserVote{
+			PollID:    pollIDOrDefault(args.PollId),
 			Username:  args.Username,
 			Votes:     0,
 			UpdatedAt: time.Now(),
 		},
 	}
-	userVote, err := r.voteService.GetUserVote(args.Username)
+	pollID, err := validation.ValidatePollID("pollId", pollIDOrDefault(args.PollId))
+	if err != nil {
+		return failResponse, err
+	}
+	afterEventID := stringOrEmpty(args.AfterEventId)
+	consistency, err := validation.ValidateReadConsistency(args.Consistency, afterEventID)
+	if err != nil {
+		return failResponse, err
+	}
+	var userVote *model.UserVote
+	if consistency == model.ReadStrong {
+		userVote, err = r.voteService.GetUserVoteStrong(ctx, pollID, args.Username, afterEventID)
+	} else {
+		userVote, err = r.voteService.GetUserVote(pollID, args.Username)
+	}
 	if err != nil {
 		return failResponse, err
 	}
@@ -171,9 +1004,13 @@ func (r *Resolver) GetUserVotes(ctx context.Context, args struct{ Username strin
 	return &UserVoteResolver{userVote: userVote}, nil
 }
 
-// GetAllUserVotes 获取所有用户票数 delete
-func (r *Resolver) GetAllUserVotes(ctx context.Context) ([]*UserVoteResolver, error) {
-	userVotes, err := r.voteService.GetAllUserVotes()
+// GetAllUserVotes 获取投票活动中所有用户的票数
+func (r *Resolver) GetAllUserVotes(ctx context.Context, args struct{ PollId *string }) ([]*UserVoteResolver, error) {
+	pollID, err := validation.ValidatePollID("pollId", pollIDOrDefault(args.PollId))
+	if err != nil {
+		return nil, err
+	}
+	userVotes, err := r.voteService.GetAllUserVotes(pollID)
 	if err != nil {
 		return nil, err
 	}
@@ -186,8 +1023,39 @@ func (r *Resolver) GetAllUserVotes(ctx context.Context) ([]*UserVoteResolver, er
 	return resolvers, nil
 }
 
+// Leaderboard 查询投票活动票数最高的用户
+func (r *Resolver) Leaderboard(ctx context.Context, args struct {
+	Limit  int32
+	PollId *string
+}) ([]*UserVoteResolver, error) {
+	limit, err := validation.ValidateLeaderboardLimit(args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	pollID, err := validation.ValidatePollID("pollId", pollIDOrDefault(args.PollId))
+	if err != nil {
+		return nil, err
+	}
+	userVotes, err := r.voteService.GetLeaderboard(pollID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*UserVoteResolver, len(userVotes))
+	for i, userVote := range userVotes {
+		resolvers[i] = &UserVoteResolver{userVote: userVote}
+	}
+	return resolvers, nil
+}
+
 // Vote 投票
 func (r *Resolver) Vote(ctx context.Context, args struct{ Input VoteInput }) (*VoteResponseResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeVote); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
 	failResponse := &VoteResponseResolver{
 		response: &model.VoteResponse{
 			Success:   false,
@@ -196,78 +1064,81 @@ func (r *Resolver) Vote(ctx context.Context, args struct{ Input VoteInput }) (*V
 			Timestamp: time.Now(),
 		},
 	}
-	fmt.Printf("failResponse: %v", failResponse.response)
-	// 转换票据
-	expiresAt, err := time.Parse(time.RFC3339, args.Input.Ticket.ExpiresAt)
+	if err := r.allowVotes(ctx, 1); err != nil {
+		return failResponse, err
+	}
+	// 校验输入并创建投票请求
+	request, err := voteRequestFromInput(ctx, args.Input)
 	if err != nil {
-		return failResponse, fmt.Errorf("解析票据过期时间失败: %w", err)
+		return failResponse, err
 	}
 
-	createdAt, err := time.Parse(time.RFC3339, args.Input.Ticket.CreatedAt)
+	// 执行投票
+	response, err := r.voteService.Vote(ctx, request)
 	if err != nil {
-		return failResponse, fmt.Errorf("解析票据创建时间失败: %w", err)
+		return failResponse, withReasonCode(toGraphQLError(err), service.VoteReasonCode(err))
 	}
 
-	ticket := model.Ticket{
-		Value:           args.Input.Ticket.Value,
-		Version:         args.Input.Ticket.Version,
-		RemainingUsages: int(args.Input.Ticket.RemainingUsages),
-		ExpiresAt:       expiresAt,
-		CreatedAt:       createdAt,
-	}
+	return &VoteResponseResolver{response: response}, nil
+}
 
-	// 创建投票请求
-	request := &model.VoteRequest{
-		Usernames: args.Input.Usernames,
-		Ticket:    ticket,
+// voteRequestFromInput 校验并转换投票输入，在调用后端之前拒绝非法输入
+func voteRequestFromInput(ctx context.Context, input VoteInput) (*model.VoteRequest, error) {
+	holder := ""
+	if input.Ticket.Holder != nil {
+		holder = *input.Ticket.Holder
 	}
-
-	// 执行投票
-	response, err := r.voteService.Vote(request)
-	fmt.Printf("Vote: %v", response)
+	ticket, err := validation.ValidateTicket("input.ticket", validation.TicketFields{
+		PollID:          pollIDOrDefault(input.Ticket.PollId),
+		Value:           input.Ticket.Value,
+		Version:         input.Ticket.Version,
+		RemainingUsages: int(input.Ticket.RemainingUsages),
+		ExpiresAt:       input.Ticket.ExpiresAt,
+		CreatedAt:       input.Ticket.CreatedAt,
+		Holder:          holder,
+	})
 	if err != nil {
-		fmt.Printf("Vote error: %v", err)
-		fmt.Printf("Vote failed response: %v", failResponse.response)
-		return failResponse, err
+		return nil, err
+	}
+	idempotencyKey, err := validation.ValidateIdempotencyKey("input.idempotencyKey", input.IdempotencyKey)
+	if err != nil {
+		return nil, err
 	}
 
-	return &VoteResponseResolver{response: response}, nil
+	info := requestctx.From(ctx)
+	return &model.VoteRequest{
+		Usernames:      input.Usernames,
+		Ticket:         *ticket,
+		ClientID:       info.ClientID,
+		Audit:          info.VoteAudit(),
+		IdempotencyKey: idempotencyKey,
+	}, nil
 }
 
 // TicketAndVote 获取票据并立即投票
-func (r *Resolver) TicketAndVote(ctx context.Context, args struct{ Usernames []string }) (*VoteResponseResolver, error) {
-	// 验证用户名列表非空
-	if len(args.Usernames) == 0 {
-		response := &model.VoteResponse{
-			Success:   false,
-			Message:   "投票失败: 用户名列表不能为空",
-			Usernames: []string{},
-			Timestamp: time.Now(),
-		}
-		return &VoteResponseResolver{response: response}, nil
-	}
-
-	// 验证用户名是否符合规范（A-Z）
-	for _, username := range args.Usernames {
-		if len(username) != 1 || username[0] < 'A' || username[0] > 'Z' {
-			response := &model.VoteResponse{
-				Success:   false,
-				Message:   fmt.Sprintf("投票失败: 无效的用户名: %s, 用户名必须是A-Z之间的单个字母", username),
-				Usernames: args.Usernames,
-				Timestamp: time.Now(),
-			}
-			return &VoteResponseResolver{response: response}, nil
-		}
+func (r *Resolver) TicketAndVote(ctx context.Context, args struct {
+	Usernames []string
+	PollId    *string
+}) (*VoteResponseResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeVote); err != nil {
+		return nil, toGraphQLError(err)
 	}
-
-	// 调用服务方法
-	response, err := r.voteService.TicketAndVote(args.Usernames)
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := r.allowVotes(ctx, 1); err != nil {
+		return nil, err
+	}
+	// 候选人由投票服务按vote.candidate_validator校验，不合法时不获取票据
+	info := requestctx.From(ctx)
+	response, err := r.voteService.TicketAndVote(ctx, pollIDOrDefault(args.PollId), info.ClientID, info.VoteAudit(), args.Usernames)
 	if err != nil {
 		response = &model.VoteResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("投票失败: %v", err),
-			Usernames: args.Usernames,
-			Timestamp: time.Now(),
+			Success:    false,
+			Message:    fmt.Sprintf("投票失败: %v", err),
+			Usernames:  args.Usernames,
+			Timestamp:  time.Now(),
+			ReasonCode: service.VoteReasonCode(err),
 		}
 	}
 
@@ -279,6 +1150,10 @@ type TicketResolver struct {
 	ticket *model.Ticket
 }
 
+func (r *TicketResolver) PollId() string {
+	return r.ticket.PollID
+}
+
 func (r *TicketResolver) Value() string {
 	return r.ticket.Value
 }
@@ -299,11 +1174,39 @@ func (r *TicketResolver) CreatedAt() string {
 	return r.ticket.CreatedAt.Format(time.RFC3339)
 }
 
+func (r *TicketResolver) Holder() *string {
+	if r.ticket.Holder == "" {
+		return nil
+	}
+	return &r.ticket.Holder
+}
+
+// ServerTime 返回解析时的服务器时间（RFC3339），客户端无需依赖本地时钟
+func (r *TicketResolver) ServerTime() string {
+	return time.Now().Format(time.RFC3339)
+}
+
+// SecondsUntilRotation 返回距离票据轮换的剩余秒数，票据在过期时轮换
+func (r *TicketResolver) SecondsUntilRotation() float64 {
+	remaining := time.Until(r.ticket.ExpiresAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining.Seconds()
+}
+
 // UserVoteResolver 用户票数解析器
 type UserVoteResolver struct {
 	userVote *model.UserVote
 }
 
+func (r *UserVoteResolver) PollId() string {
+	if r.userVote.PollID == "" {
+		return model.DefaultPollID
+	}
+	return r.userVote.PollID
+}
+
 func (r *UserVoteResolver) Username() string {
 	return r.userVote.Username
 }
@@ -316,6 +1219,10 @@ func (r *UserVoteResolver) UpdatedAt() string {
 	return r.userVote.UpdatedAt.Format(time.RFC3339)
 }
 
+func (r *UserVoteResolver) Stale() bool {
+	return r.userVote.Stale
+}
+
 // VoteResponseResolver 投票响应解析器
 type VoteResponseResolver struct {
 	response *model.VoteResponse
@@ -337,20 +1244,52 @@ func (r *VoteResponseResolver) Timestamp() string {
 	return r.response.Timestamp.Format(time.RFC3339)
 }
 
+func (r *VoteResponseResolver) Receipt() *string {
+	if r.response.Receipt == "" {
+		return nil
+	}
+	return &r.response.Receipt
+}
+
+func (r *VoteResponseResolver) RemainingUsages() *int32 {
+	if r.response.RemainingUsages == nil {
+		return nil
+	}
+	remaining := int32(*r.response.RemainingUsages)
+	return &remaining
+}
+
+func (r *VoteResponseResolver) EventId() *string {
+	if r.response.EventID == "" {
+		return nil
+	}
+	return &r.response.EventID
+}
+
+func (r *VoteResponseResolver) ReasonCode() *string {
+	if r.response.ReasonCode == "" {
+		return nil
+	}
+	reasonCode := string(r.response.ReasonCode)
+	return &reasonCode
+}
+
 // 投票输入类型
 type VoteInput struct {
-	Usernames []string
-	Ticket    TicketInput
+	Usernames      []string
+	Ticket         TicketInput
+	IdempotencyKey *string
 }
 
 // 票据输入类型
 type TicketInput struct {
+	PollId          *string
 	Value           string
 	Version         string
 	RemainingUsages int32
 	ExpiresAt       string
-	Holder          string
 	CreatedAt       string
+	Holder          *string
 }
 
 // playgroundHTML GraphQL Playground HTML
@@ -407,3 +1346,19 @@ const playgroundHTML = `
 </body>
 </html>
 `
+
+// pollIDOrDefault 未指定投票活动时使用默认活动
+func pollIDOrDefault(pollID *string) string {
+	if pollID == nil || *pollID == "" {
+		return model.DefaultPollID
+	}
+	return *pollID
+}
+
+// stringOrEmpty 返回可选参数的值，未传时为空字符串
+func stringOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
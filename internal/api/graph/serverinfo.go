@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/buildinfo"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// ServerInfo 查询本实例的运行信息
+func (r *Resolver) ServerInfo(ctx context.Context) *ServerInfoResolver {
+	return &ServerInfoResolver{info: r.serverInfo()}
+}
+
+// serveVersion 以JSON返回本实例的运行信息，供运维脚本直接访问/version
+func (r *Resolver) serveVersion(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.serverInfo())
+}
+
+func (r *Resolver) serverInfo() *model.ServerInfo {
+	info := &model.ServerInfo{
+		Version:    buildinfo.Version,
+		Commit:     buildinfo.Commit,
+		BuildTime:  buildinfo.BuildTime,
+		StartedAt:  buildinfo.StartedAt,
+		InstanceID: config.AppConfig.Server.InstanceID,
+	}
+	if r.role != nil {
+		info.Role = r.role()
+	}
+	return info
+}
+
+// ServerInfoResolver 运行信息解析器
+type ServerInfoResolver struct {
+	info *model.ServerInfo
+}
+
+func (r *ServerInfoResolver) Version() string {
+	return r.info.Version
+}
+
+func (r *ServerInfoResolver) Commit() string {
+	return r.info.Commit
+}
+
+func (r *ServerInfoResolver) BuildTime() *string {
+	if r.info.BuildTime == "" {
+		return nil
+	}
+	return &r.info.BuildTime
+}
+
+func (r *ServerInfoResolver) StartedAt() string {
+	return r.info.StartedAt.Format(time.RFC3339)
+}
+
+func (r *ServerInfoResolver) InstanceId() int32 {
+	return int32(r.info.InstanceID)
+}
+
+func (r *ServerInfoResolver) Role() string {
+	return r.info.Role
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// GetPollStats 查询投票活动的统计数据
+func (r *Resolver) GetPollStats(ctx context.Context, args struct{ PollId string }) (*PollStatsResolver, error) {
+	stats, err := r.voteService.GetPollStats(args.PollId)
+	if err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &PollStatsResolver{stats: stats}, nil
+}
+
+// PollStatsResolver 投票活动统计解析器
+type PollStatsResolver struct {
+	stats *model.PollStats
+}
+
+func (r *PollStatsResolver) PollId() string {
+	return r.stats.PollID
+}
+
+func (r *PollStatsResolver) TotalVotes() int32 {
+	return int32(r.stats.TotalVotes)
+}
+
+func (r *PollStatsResolver) VotesPerHour() []*HourlyVotesResolver {
+	resolvers := make([]*HourlyVotesResolver, len(r.stats.VotesPerHour))
+	for i, hourly := range r.stats.VotesPerHour {
+		resolvers[i] = &HourlyVotesResolver{hourly: hourly}
+	}
+	return resolvers
+}
+
+func (r *PollStatsResolver) UniqueVoters() int32 {
+	return int32(r.stats.UniqueVoters)
+}
+
+func (r *PollStatsResolver) TicketsIssued() int32 {
+	return int32(r.stats.TicketsIssued)
+}
+
+func (r *PollStatsResolver) TicketsUsed() int32 {
+	return int32(r.stats.TicketsUsed)
+}
+
+func (r *PollStatsResolver) TicketUtilization() float64 {
+	return r.stats.TicketUtilization
+}
+
+func (r *PollStatsResolver) Rejections() []*RejectionCountResolver {
+	resolvers := make([]*RejectionCountResolver, len(r.stats.Rejections))
+	for i, rejection := range r.stats.Rejections {
+		resolvers[i] = &RejectionCountResolver{rejection: rejection}
+	}
+	return resolvers
+}
+
+// HourlyVotesResolver 每小时票数解析器
+type HourlyVotesResolver struct {
+	hourly *model.HourlyVotes
+}
+
+func (r *HourlyVotesResolver) Hour() string {
+	return r.hourly.Hour.Format(time.RFC3339)
+}
+
+func (r *HourlyVotesResolver) Votes() int32 {
+	return int32(r.hourly.Votes)
+}
+
+// RejectionCountResolver 拒绝次数解析器
+type RejectionCountResolver struct {
+	rejection *model.RejectionCount
+}
+
+func (r *RejectionCountResolver) ReasonCode() string {
+	return r.rejection.ReasonCode
+}
+
+func (r *RejectionCountResolver) Count() int32 {
+	return int32(r.rejection.Count)
+}
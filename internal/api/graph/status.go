@@ -0,0 +1,283 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// SystemStatus 查询系统状态
+func (r *Resolver) SystemStatus(ctx context.Context) (*SystemStatusResolver, error) {
+	producer, err := r.ticketService.CurrentProducer()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SystemStatusResolver{
+		instanceID: config.AppConfig.Server.InstanceID,
+		isProducer: r.ticketService.IsLeading(),
+		producer:   producer,
+	}, nil
+}
+
+// SystemStatusResolver 系统状态解析器
+type SystemStatusResolver struct {
+	instanceID int
+	isProducer bool
+	producer   *model.ProducerInfo
+}
+
+func (r *SystemStatusResolver) InstanceId() int32 {
+	return int32(r.instanceID)
+}
+
+func (r *SystemStatusResolver) IsProducer() bool {
+	return r.isProducer
+}
+
+func (r *SystemStatusResolver) CurrentProducer() *ProducerInfoResolver {
+	if r.producer == nil {
+		return nil
+	}
+	return &ProducerInfoResolver{info: r.producer}
+}
+
+// ProducerInfoResolver 票据生产者信息解析器
+type ProducerInfoResolver struct {
+	info *model.ProducerInfo
+}
+
+func (r *ProducerInfoResolver) InstanceId() int32 {
+	return int32(r.info.InstanceID)
+}
+
+func (r *ProducerInfoResolver) Since() string {
+	return r.info.Since.Format(time.RFC3339)
+}
+
+func (r *ProducerInfoResolver) RenewedAt() string {
+	return r.info.RenewedAt.Format(time.RFC3339)
+}
+
+// ListInstances 查询集群中存活的实例，只有管理密钥可以查询
+func (r *Resolver) ListInstances(ctx context.Context) ([]*InstanceResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	instances, err := r.registry.ListInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*InstanceResolver, len(instances))
+	for i, instance := range instances {
+		resolvers[i] = &InstanceResolver{instance: instance}
+	}
+	return resolvers, nil
+}
+
+// InstanceResolver 集群实例解析器
+type InstanceResolver struct {
+	instance *model.Instance
+}
+
+func (r *InstanceResolver) Id() int32 {
+	return int32(r.instance.ID)
+}
+
+func (r *InstanceResolver) Host() string {
+	return r.instance.Host
+}
+
+func (r *InstanceResolver) Port() int32 {
+	return int32(r.instance.Port)
+}
+
+func (r *InstanceResolver) GrpcPort() *int32 {
+	if r.instance.GRPCPort == 0 {
+		return nil
+	}
+	port := int32(r.instance.GRPCPort)
+	return &port
+}
+
+func (r *InstanceResolver) Role() string {
+	return r.instance.Role
+}
+
+func (r *InstanceResolver) Version() string {
+	return r.instance.Version
+}
+
+func (r *InstanceResolver) StartedAt() string {
+	return r.instance.StartedAt.Format(time.RFC3339)
+}
+
+func (r *InstanceResolver) HeartbeatAt() string {
+	return r.instance.HeartbeatAt.Format(time.RFC3339)
+}
+
+// ConfigDump 查询生效的配置，只有管理密钥可以查询
+func (r *Resolver) ConfigDump(ctx context.Context) ([]*ConfigEntryResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	entries := config.Dump()
+	resolvers := make([]*ConfigEntryResolver, len(entries))
+	for i := range entries {
+		resolvers[i] = &ConfigEntryResolver{entry: entries[i]}
+	}
+	return resolvers, nil
+}
+
+// ConfigEntryResolver 配置项解析器
+type ConfigEntryResolver struct {
+	entry config.Entry
+}
+
+func (r *ConfigEntryResolver) Key() string {
+	return r.entry.Key
+}
+
+func (r *ConfigEntryResolver) Value() string {
+	return r.entry.Value
+}
+
+func (r *ConfigEntryResolver) Source() string {
+	return r.entry.Source
+}
+
+// VoteQueueStatus 查询本实例尚未落库的投票积压，只有管理密钥可以查询
+func (r *Resolver) VoteQueueStatus(ctx context.Context) (*VoteQueueStatusResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	status, err := r.queue.Inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &VoteQueueStatusResolver{status: status}, nil
+}
+
+// VoteQueueStatusResolver 投票积压解析器
+type VoteQueueStatusResolver struct {
+	status *model.QueueStatus
+}
+
+func (r *VoteQueueStatusResolver) InstanceId() int32 {
+	return int32(r.status.InstanceID)
+}
+
+func (r *VoteQueueStatusResolver) Total() int32 {
+	return int32(r.status.Total)
+}
+
+func (r *VoteQueueStatusResolver) Depths() []*QueueDepthResolver {
+	resolvers := make([]*QueueDepthResolver, len(r.status.Depths))
+	for i, depth := range r.status.Depths {
+		resolvers[i] = &QueueDepthResolver{depth: depth}
+	}
+	return resolvers
+}
+
+func (r *VoteQueueStatusResolver) CheckedAt() string {
+	return r.status.CheckedAt.Format(time.RFC3339)
+}
+
+// QueueDepthResolver 单个来源的积压解析器
+type QueueDepthResolver struct {
+	depth *model.QueueDepth
+}
+
+func (r *QueueDepthResolver) Source() string {
+	return r.depth.Source
+}
+
+func (r *QueueDepthResolver) Partition() *int32 {
+	if r.depth.Partition == nil {
+		return nil
+	}
+	partition := int32(*r.depth.Partition)
+	return &partition
+}
+
+func (r *QueueDepthResolver) Depth() int32 {
+	return int32(r.depth.Depth)
+}
+
+// ConsumptionState 查询投票事件消费的暂停状态
+func (r *Resolver) ConsumptionState(ctx context.Context) (*ConsumptionStateResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	return &ConsumptionStateResolver{state: r.consumption.State()}, nil
+}
+
+// PauseConsumption 暂停集群内所有实例的投票事件消费，未开启认证时同样需要管理密钥
+func (r *Resolver) PauseConsumption(ctx context.Context, args struct{ Reason *string }) (*ConsumptionStateResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	reason := ""
+	if args.Reason != nil {
+		reason = *args.Reason
+	}
+	state, err := r.consumption.Pause(reason)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsumptionStateResolver{state: state}, nil
+}
+
+// ResumeConsumption 恢复集群内所有实例的投票事件消费，未开启认证时同样需要管理密钥
+func (r *Resolver) ResumeConsumption(ctx context.Context) (*ConsumptionStateResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	state, err := r.consumption.Resume()
+	if err != nil {
+		return nil, err
+	}
+	return &ConsumptionStateResolver{state: state}, nil
+}
+
+// ConsumptionStateResolver 消费状态解析器
+type ConsumptionStateResolver struct {
+	state *model.ConsumptionState
+}
+
+func (r *ConsumptionStateResolver) Paused() bool {
+	return r.state.Paused
+}
+
+func (r *ConsumptionStateResolver) Reason() *string {
+	if r.state.Reason == "" {
+		return nil
+	}
+	return &r.state.Reason
+}
+
+func (r *ConsumptionStateResolver) PausedBy() *int32 {
+	if !r.state.Paused {
+		return nil
+	}
+	pausedBy := int32(r.state.PausedBy)
+	return &pausedBy
+}
+
+func (r *ConsumptionStateResolver) Since() *string {
+	if r.state.Since == nil {
+		return nil
+	}
+	since := r.state.Since.Format(time.RFC3339)
+	return &since
+}
@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// GetTicketStats 按签发时间倒序查询票据利用率，未开启认证时同样需要管理密钥
+func (r *Resolver) GetTicketStats(ctx context.Context, args struct {
+	PollId *string
+	Limit  *int32
+}) ([]*TicketStatsResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeAdmin); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	query, err := validation.ValidateTicketStatsQuery(args.PollId, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := r.ticketService.GetTicketStats(query.PollID, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*TicketStatsResolver, len(stats))
+	for i, s := range stats {
+		resolvers[i] = &TicketStatsResolver{stats: s}
+	}
+	return resolvers, nil
+}
+
+// TicketStatsResolver 票据利用率解析器
+type TicketStatsResolver struct {
+	stats *model.TicketStats
+}
+
+func (r *TicketStatsResolver) Version() string {
+	return r.stats.Version
+}
+
+func (r *TicketStatsResolver) PollId() string {
+	return r.stats.PollID
+}
+
+func (r *TicketStatsResolver) Issued() int32 {
+	return int32(r.stats.Issued)
+}
+
+func (r *TicketStatsResolver) Consumed() *int32 {
+	if r.stats.Consumed == nil {
+		return nil
+	}
+	consumed := int32(*r.stats.Consumed)
+	return &consumed
+}
+
+func (r *TicketStatsResolver) Utilization() *float64 {
+	if r.stats.Consumed == nil || r.stats.Issued == 0 {
+		return nil
+	}
+	utilization := float64(*r.stats.Consumed) / float64(r.stats.Issued)
+	return &utilization
+}
+
+func (r *TicketStatsResolver) CreatedAt() string {
+	return r.stats.CreatedAt.Format(time.RFC3339)
+}
+
+func (r *TicketStatsResolver) ExpiresAt() string {
+	return r.stats.ExpiresAt.Format(time.RFC3339)
+}
+
+func (r *TicketStatsResolver) RotatedAt() *string {
+	if r.stats.RotatedAt == nil {
+		return nil
+	}
+	rotatedAt := r.stats.RotatedAt.Format(time.RFC3339)
+	return &rotatedAt
+}
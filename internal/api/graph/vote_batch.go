@@ -0,0 +1,53 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// VoteBatch 批量投票，供压测工具和汇聚客户端请求的代理网关使用
+// 某项输入校验失败或投票失败时只有该项返回失败结果；批次大小超限或被限流时整个请求失败
+func (r *Resolver) VoteBatch(ctx context.Context, args struct{ Inputs []VoteInput }) ([]*VoteResponseResolver, error) {
+	if err := auth.Authorize(ctx, auth.ScopeVote); err != nil {
+		return nil, toGraphQLError(err)
+	}
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := validation.ValidateVoteBatchSize("inputs", len(args.Inputs)); err != nil {
+		return nil, err
+	}
+
+	// 批量投票按包含的投票数扣减限流令牌
+	if err := r.allowVotes(ctx, len(args.Inputs)); err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*VoteResponseResolver, len(args.Inputs))
+	var requests []*model.VoteRequest
+	var pending []int // 输入校验通过的下标
+	for i, input := range args.Inputs {
+		request, err := voteRequestFromInput(ctx, input)
+		if err != nil {
+			resolvers[i] = &VoteResponseResolver{response: &model.VoteResponse{
+				Success:   false,
+				Message:   "投票失败: " + err.Error(),
+				Usernames: input.Usernames,
+				Timestamp: time.Now(),
+			}}
+			continue
+		}
+		requests = append(requests, request)
+		pending = append(pending, i)
+	}
+
+	responses := r.voteService.VoteBatch(ctx, requests)
+	for j, i := range pending {
+		resolvers[i] = &VoteResponseResolver{response: responses[j]}
+	}
+	return resolvers, nil
+}
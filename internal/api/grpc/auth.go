@@ -0,0 +1,88 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/api/grpc/votepb"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 与HTTP接口一致的API密钥元数据，也可以使用authorization: Bearer <key>
+const (
+	apiKeyKey        = "x-api-key"
+	authorizationKey = "authorization"
+	retryAfterKey    = "retry-after"
+)
+
+// methodScopes 各方法需要的权限范围，与GraphQL和REST接口一致；未列出的方法需要管理权限
+var methodScopes = map[string]string{
+	votepb.VoteService_GetTicket_FullMethodName:     auth.ScopeRead,
+	votepb.VoteService_GetUserVotes_FullMethodName:  auth.ScopeRead,
+	votepb.VoteService_Vote_FullMethodName:          auth.ScopeVote,
+	votepb.VoteService_TicketAndVote_FullMethodName: auth.ScopeVote,
+}
+
+// rateLimitedMethods 受投票限流约束的方法，每次调用消耗一个令牌
+var rateLimitedMethods = map[string]bool{
+	votepb.VoteService_Vote_FullMethodName:          true,
+	votepb.VoteService_TicketAndVote_FullMethodName: true,
+}
+
+// withAuth 校验元数据中的API密钥并检查方法需要的权限范围，需位于withRequestContext之后
+// 缺少或无效的密钥返回Unauthenticated，权限不足返回PermissionDenied
+func (s *Server) withAuth(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+	if s.auth != nil {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if err := s.auth.Identify(ctx, keyFromMetadata(md)); err != nil {
+			if errors.Is(err, auth.ErrUnauthenticated) {
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
+			return nil, status.Error(codes.Unavailable, "API密钥校验暂不可用，请稍后重试")
+		}
+	}
+
+	scope, ok := methodScopes[info.FullMethod]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+	if err := auth.Authorize(ctx, scope); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return handler(ctx, req)
+}
+
+// withRateLimit 按客户端IP限制投票方法的频率，与GraphQL和REST接口共用同一个限额，需位于withRequestContext之后
+// 超出限额时返回ResourceExhausted，响应头retry-after为建议等待的秒数
+func (s *Server) withRateLimit(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+	if s.rateLimiter == nil || !rateLimitedMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	wait, err := s.rateLimiter.Allow(requestctx.From(ctx).SourceIP, 1)
+	if err != nil {
+		if wait > 0 {
+			grpclib.SetHeader(ctx, metadata.Pairs(retryAfterKey, strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+		}
+		return nil, toStatusError(err)
+	}
+	return handler(ctx, req)
+}
+
+// keyFromMetadata 优先读取x-api-key，其次是authorization: Bearer
+func keyFromMetadata(md metadata.MD) string {
+	if key := metadataValue(md, apiKeyKey, math.MaxInt); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(metadataValue(md, authorizationKey, math.MaxInt), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
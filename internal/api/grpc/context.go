@@ -0,0 +1,75 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// 与HTTP接口一致的请求元数据，gRPC元数据的键均为小写
+const (
+	clientIDKey  = "x-client-id"
+	requestIDKey = "x-request-id"
+	tenantKey    = "x-tenant-id"
+	userAgentKey = "user-agent"
+)
+
+// 元数据的最大长度，超出部分截断
+const (
+	maxMetadataValueLength = 128
+	maxUserAgentLength     = 255 // 与vote_logs.user_agent字段长度保持一致
+)
+
+// withRequestContext 从gRPC元数据和对端地址构建请求上下文，服务层通过requestctx.From(ctx)获取
+func withRequestContext(ctx context.Context, req interface{}, _ *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	info := &requestctx.Info{
+		RequestID: metadataValue(md, requestIDKey, maxMetadataValueLength),
+		SourceIP:  peerIP(ctx),
+		UserAgent: metadataValue(md, userAgentKey, maxUserAgentLength),
+		Tenant:    metadataValue(md, tenantKey, maxMetadataValueLength),
+	}
+	if info.RequestID == "" {
+		info.RequestID = requestctx.NewRequestID()
+	}
+	info.ClientID = metadataValue(md, clientIDKey, maxMetadataValueLength)
+	if info.ClientID == "" {
+		info.ClientID = info.SourceIP
+	}
+
+	// 在响应头中返回请求ID
+	grpclib.SetHeader(ctx, metadata.Pairs(requestIDKey, info.RequestID))
+
+	return handler(requestctx.With(ctx, info), req)
+}
+
+func metadataValue(md metadata.MD, key string, max int) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	value := strings.TrimSpace(values[0])
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
+
+// peerIP 返回对端的IP地址
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"errors"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain 错误详情中的错误域
+const errorDomain = "littlevote"
+
+// toStatusError 将业务错误转换为gRPC状态，投票失败的原因码通过ErrorInfo.Reason返回
+func toStatusError(err error) error {
+	var validationErrs validation.Errors
+	if errors.As(err, &validationErrs) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		code = codes.NotFound
+	case errors.Is(err, service.ErrInvalidCandidate):
+		code = codes.InvalidArgument
+	case errors.Is(err, service.ErrVoteQueueFull), errors.Is(err, service.ErrDuplicateVote), errors.Is(err, service.ErrRateLimited),
+		errors.Is(err, ticket.ErrClientBlocked), errors.Is(err, repository.ErrInstanceQuotaExhausted):
+		code = codes.ResourceExhausted
+	case errors.Is(err, repository.ErrTicketNotHolder):
+		code = codes.PermissionDenied
+	case errors.Is(err, repository.ErrTicketExpired), errors.Is(err, repository.ErrTicketExhausted),
+		errors.Is(err, repository.ErrClientQuotaExhausted),
+		errors.Is(err, repository.ErrPollClosed), errors.Is(err, repository.ErrPollFinalized),
+		errors.Is(err, ticket.ErrPollNotStarted):
+		code = codes.FailedPrecondition
+	}
+
+	st := status.New(code, err.Error())
+	if reasonCode := service.VoteReasonCode(err); reasonCode != "" {
+		if detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{
+			Reason: string(reasonCode),
+			Domain: errorDomain,
+		}); detailErr == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// checkWritable 只读副本模式下拒绝变更，ErrorInfo中附带可写实例地址
+func checkWritable() error {
+	if !config.AppConfig.Server.ReadOnly {
+		return nil
+	}
+
+	st := status.New(codes.FailedPrecondition, "READ_ONLY: 当前实例为只读副本，不接受变更操作")
+	info := &errdetails.ErrorInfo{Reason: "READ_ONLY", Domain: errorDomain}
+	if primaryURL := config.AppConfig.Server.PrimaryURL; primaryURL != "" {
+		info.Metadata = map[string]string{"redirect": primaryURL}
+	}
+	if detailed, err := st.WithDetails(info); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
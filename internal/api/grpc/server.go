@@ -0,0 +1,180 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/api/grpc/votepb"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Server 投票服务的gRPC接口，与GraphQL接口共用同一个VoteService
+type Server struct {
+	votepb.UnimplementedVoteServiceServer
+
+	voteService *service.VoteService
+	auth        *auth.Authenticator
+	rateLimiter *service.RateLimiter
+	server      *grpclib.Server
+	logger      *slog.Logger
+}
+
+// NewServer 创建gRPC接口，与GraphQL和REST接口使用相同的API密钥认证和投票限流；rateLimiter为nil时投票不限流
+func NewServer(voteService *service.VoteService, authenticator *auth.Authenticator, rateLimiter *service.RateLimiter, logger *slog.Logger) *Server {
+	s := &Server{
+		voteService: voteService,
+		auth:        authenticator,
+		rateLimiter: rateLimiter,
+		logger:      logging.Component(logger, "grpc"),
+	}
+	s.server = grpclib.NewServer(grpclib.ChainUnaryInterceptor(withRequestContext, s.withAuth, s.withRateLimit))
+	votepb.RegisterVoteServiceServer(s.server, s)
+	// 支持grpcurl等工具直接查询接口定义
+	reflection.Register(s.server)
+	return s
+}
+
+// Serve 在监听器上提供gRPC服务，阻塞直到服务停止
+func (s *Server) Serve(listener net.Listener) error {
+	s.logger.Info("gRPC服务已启动", "addr", listener.Addr().String())
+	return s.server.Serve(listener)
+}
+
+// Stop 停止接收新请求，等待进行中的请求完成
+func (s *Server) Stop() {
+	s.server.GracefulStop()
+}
+
+// GetTicket 获取投票活动的当前票据
+func (s *Server) GetTicket(ctx context.Context, req *votepb.GetTicketRequest) (*votepb.Ticket, error) {
+	ticket, err := s.voteService.GetTicket(pollIDOrDefault(req.GetPollId()), requestctx.From(ctx).VoteAudit().Principal())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toTicket(ticket), nil
+}
+
+// Vote 使用票据投票
+func (s *Server) Vote(ctx context.Context, req *votepb.VoteRequest) (*votepb.VoteResponse, error) {
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+
+	// 与GraphQL接口使用相同的票据校验
+	in := req.GetTicket()
+	ticket, err := validation.ValidateTicket("ticket", validation.TicketFields{
+		PollID:          pollIDOrDefault(in.GetPollId()),
+		Value:           in.GetValue(),
+		Version:         in.GetVersion(),
+		RemainingUsages: int(in.GetRemainingUsages()),
+		ExpiresAt:       formatTimestamp(in.GetExpiresAt()),
+		CreatedAt:       formatTimestamp(in.GetCreatedAt()),
+		Holder:          in.GetHolder(),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	idempotencyKey := req.GetIdempotencyKey()
+	if _, err := validation.ValidateIdempotencyKey("idempotency_key", &idempotencyKey); err != nil {
+		return nil, toStatusError(err)
+	}
+
+	info := requestctx.From(ctx)
+	response, err := s.voteService.Vote(ctx, &model.VoteRequest{
+		Usernames:      req.GetUsernames(),
+		Ticket:         *ticket,
+		ClientID:       info.ClientID,
+		Audit:          info.VoteAudit(),
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toVoteResponse(response), nil
+}
+
+// TicketAndVote 获取票据并立即投票
+func (s *Server) TicketAndVote(ctx context.Context, req *votepb.TicketAndVoteRequest) (*votepb.VoteResponse, error) {
+	if err := checkWritable(); err != nil {
+		return nil, err
+	}
+
+	info := requestctx.From(ctx)
+	response, err := s.voteService.TicketAndVote(ctx, pollIDOrDefault(req.GetPollId()), info.ClientID, info.VoteAudit(), req.GetUsernames())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return toVoteResponse(response), nil
+}
+
+// GetUserVotes 查询投票活动中用户的票数
+func (s *Server) GetUserVotes(ctx context.Context, req *votepb.GetUserVotesRequest) (*votepb.UserVote, error) {
+	pollID, err := validation.ValidatePollID("poll_id", pollIDOrDefault(req.GetPollId()))
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	userVote, err := s.voteService.GetUserVote(pollID, req.GetUsername())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &votepb.UserVote{
+		PollId:    pollID,
+		Username:  userVote.Username,
+		Votes:     int32(userVote.Votes),
+		UpdatedAt: timestamppb.New(userVote.UpdatedAt),
+		Stale:     userVote.Stale,
+	}, nil
+}
+
+func pollIDOrDefault(pollID string) string {
+	if pollID == "" {
+		return model.DefaultPollID
+	}
+	return pollID
+}
+
+// formatTimestamp 转换为票据校验使用的RFC3339格式，未设置时为空交由校验报错
+func formatTimestamp(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().Format(time.RFC3339)
+}
+
+func toTicket(ticket *model.Ticket) *votepb.Ticket {
+	return &votepb.Ticket{
+		PollId:          ticket.PollID,
+		Value:           ticket.Value,
+		Version:         ticket.Version,
+		RemainingUsages: int32(ticket.RemainingUsages),
+		ExpiresAt:       timestamppb.New(ticket.ExpiresAt),
+		CreatedAt:       timestamppb.New(ticket.CreatedAt),
+		Holder:          ticket.Holder,
+	}
+}
+
+func toVoteResponse(response *model.VoteResponse) *votepb.VoteResponse {
+	out := &votepb.VoteResponse{
+		Success:    response.Success,
+		Message:    response.Message,
+		Usernames:  response.Usernames,
+		Timestamp:  timestamppb.New(response.Timestamp),
+		Receipt:    response.Receipt,
+		ReasonCode: string(response.ReasonCode),
+	}
+	if response.RemainingUsages != nil {
+		remaining := int32(*response.RemainingUsages)
+		out.RemainingUsages = &remaining
+	}
+	return out
+}
@@ -0,0 +1,4 @@
+// Package votepb 投票服务gRPC接口的消息和服务定义，由vote.proto生成
+package votepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative vote.proto
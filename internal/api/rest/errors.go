@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// errorBody 错误响应，投票失败时附带原因码
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code       string                  `json:"code"`
+	Message    string                  `json:"message"`
+	ReasonCode string                  `json:"reasonCode,omitempty"`
+	Fields     []validation.FieldError `json:"fields,omitempty"`     // 参数校验失败的字段
+	Redirect   string                  `json:"redirect,omitempty"`   // 只读副本拒绝变更时的可写实例地址
+	RetryAfter int                     `json:"retryAfter,omitempty"` // 被限流时建议的重试等待秒数
+}
+
+// knownErrors 已知的业务错误对应的HTTP状态码和错误码，GraphQL接口中有错误码的错误使用相同的错误码
+var knownErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{auth.ErrForbidden, http.StatusForbidden, "FORBIDDEN"},
+	{repository.ErrUserNotFound, http.StatusNotFound, "USER_NOT_FOUND"},
+	{service.ErrInvalidCandidate, http.StatusBadRequest, "INVALID_CANDIDATE"},
+	{repository.ErrTicketExpired, http.StatusConflict, "TICKET_EXPIRED"},
+	{repository.ErrTicketExhausted, http.StatusConflict, "TICKET_EXHAUSTED"},
+	{repository.ErrClientQuotaExhausted, http.StatusConflict, "CLIENT_QUOTA_EXHAUSTED"},
+	{repository.ErrTicketNotHolder, http.StatusForbidden, "TICKET_NOT_HOLDER"},
+	{repository.ErrInstanceQuotaExhausted, http.StatusTooManyRequests, "INSTANCE_QUOTA_EXHAUSTED"},
+	{service.ErrVoteQueueFull, http.StatusServiceUnavailable, "VOTE_QUEUE_FULL"},
+	{service.ErrDuplicateVote, http.StatusConflict, "DUPLICATE_VOTE"},
+	{ticket.ErrClientBlocked, http.StatusTooManyRequests, "TICKET_BLOCKED"},
+	{repository.ErrPollClosed, http.StatusConflict, "POLL_CLOSED"},
+	{repository.ErrPollFinalized, http.StatusConflict, "POLL_FINALIZED"},
+	{ticket.ErrPollNotStarted, http.StatusConflict, "POLL_NOT_STARTED"},
+}
+
+// writeError 将业务错误转换为HTTP状态码和错误响应，未知错误返回500，返回响应的状态码
+func writeError(w http.ResponseWriter, err error) int {
+	var validationErrs validation.Errors
+	if errors.As(err, &validationErrs) {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: errorDetail{Code: "INVALID_INPUT", Message: err.Error(), Fields: validationErrs}})
+		return http.StatusBadRequest
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL"
+	for _, known := range knownErrors {
+		if errors.Is(err, known.err) {
+			status, code = known.status, known.code
+			break
+		}
+	}
+
+	writeJSON(w, status, errorBody{Error: errorDetail{
+		Code:       code,
+		Message:    err.Error(),
+		ReasonCode: string(service.VoteReasonCode(err)),
+	}})
+	return status
+}
+
+// checkWritable 只读副本模式下拒绝变更，响应中附带可写实例地址，返回是否可以继续处理
+func checkWritable(w http.ResponseWriter) bool {
+	if !config.AppConfig.Server.ReadOnly {
+		return true
+	}
+	writeJSON(w, http.StatusConflict, errorBody{Error: errorDetail{
+		Code:     "READ_ONLY",
+		Message:  "READ_ONLY: 当前实例为只读副本，不接受变更操作",
+		Redirect: config.AppConfig.Server.PrimaryURL,
+	}})
+	return false
+}
+
+// writeRateLimited 返回429和Retry-After
+func writeRateLimited(w http.ResponseWriter, wait time.Duration, err error) {
+	detail := errorDetail{
+		Code:       "RATE_LIMITED",
+		Message:    err.Error(),
+		ReasonCode: string(model.VoteReasonRateLimited),
+	}
+	if wait > 0 {
+		detail.RetryAfter = int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(detail.RetryAfter))
+	}
+	writeJSON(w, http.StatusTooManyRequests, errorBody{Error: detail})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,224 @@
+package rest
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+	"github.com/lvdashuaibi/littlevote/internal/service"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// DefaultPrefix rest.prefix为空时REST接口的路径前缀
+const DefaultPrefix = "/api/v1"
+
+// maxBodyBytes 投票请求体的最大字节数
+const maxBodyBytes = 64 << 10
+
+// Handler 投票服务的JSON REST接口，与GraphQL、gRPC接口共用同一个VoteService，供无法使用GraphQL的客户端调用
+// 需位于请求上下文和API密钥认证中间件之内
+type Handler struct {
+	voteService *service.VoteService
+	rateLimiter *service.RateLimiter
+	mux         *http.ServeMux
+	logger      *slog.Logger
+}
+
+// NewHandler 创建REST接口，rateLimiter为nil时投票不限流
+func NewHandler(voteService *service.VoteService, rateLimiter *service.RateLimiter, logger *slog.Logger) *Handler {
+	h := &Handler{
+		voteService: voteService,
+		rateLimiter: rateLimiter,
+		mux:         http.NewServeMux(),
+		logger:      logging.Component(logger, "rest"),
+	}
+
+	prefix := Prefix()
+	h.mux.HandleFunc("POST "+prefix+"/votes", h.vote)
+	h.mux.HandleFunc("GET "+prefix+"/tickets/current", h.getCurrentTicket)
+	h.mux.HandleFunc("GET "+prefix+"/users/{name}/votes", h.getUserVotes)
+	h.mux.HandleFunc("GET "+prefix+"/users", h.getAllUserVotes)
+	return h
+}
+
+// Prefix 返回REST接口的路径前缀，不以/结尾
+func Prefix() string {
+	prefix := strings.TrimSuffix(config.AppConfig.REST.Prefix, "/")
+	if prefix == "" {
+		return DefaultPrefix
+	}
+	return prefix
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// ticketBody 票据，时间为RFC3339格式
+type ticketBody struct {
+	PollID          string    `json:"pollId"`
+	Value           string    `json:"value"`
+	Version         string    `json:"version"`
+	RemainingUsages int       `json:"remainingUsages"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	CreatedAt       time.Time `json:"createdAt"`
+	Holder          string    `json:"holder,omitempty"`
+}
+
+// voteBody POST /votes的请求体，ticket为GET /tickets/current返回的票据
+type voteBody struct {
+	Usernames []string `json:"usernames"`
+	Ticket    struct {
+		PollID          string `json:"pollId"`
+		Value           string `json:"value"`
+		Version         string `json:"version"`
+		RemainingUsages int    `json:"remainingUsages"`
+		ExpiresAt       string `json:"expiresAt"`
+		CreatedAt       string `json:"createdAt"`
+		Holder          string `json:"holder"`
+	} `json:"ticket"`
+	IdempotencyKey *string `json:"idempotencyKey"`
+}
+
+// vote 使用票据投票，与GraphQL的vote变更使用相同的校验、权限和限流
+func (h *Handler) vote(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := auth.Authorize(ctx, auth.ScopeVote); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if !checkWritable(w) {
+		return
+	}
+
+	var body voteBody
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err := decoder.Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: errorDetail{Code: "INVALID_INPUT", Message: "解析请求体失败: " + err.Error()}})
+		return
+	}
+
+	ticket, err := validation.ValidateTicket("ticket", validation.TicketFields{
+		PollID:          pollIDOrDefault(body.Ticket.PollID),
+		Value:           body.Ticket.Value,
+		Version:         body.Ticket.Version,
+		RemainingUsages: body.Ticket.RemainingUsages,
+		ExpiresAt:       body.Ticket.ExpiresAt,
+		CreatedAt:       body.Ticket.CreatedAt,
+		Holder:          body.Ticket.Holder,
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	idempotencyKey, err := validation.ValidateIdempotencyKey("idempotencyKey", body.IdempotencyKey)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	info := requestctx.From(ctx)
+	if h.rateLimiter != nil {
+		if wait, err := h.rateLimiter.Allow(info.SourceIP, 1); err != nil {
+			writeRateLimited(w, wait, err)
+			return
+		}
+	}
+
+	response, err := h.voteService.Vote(ctx, &model.VoteRequest{
+		Usernames:      body.Usernames,
+		Ticket:         *ticket,
+		ClientID:       info.ClientID,
+		Audit:          info.VoteAudit(),
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getCurrentTicket 获取投票活动的当前票据，pollId查询参数为空时为默认活动
+func (h *Handler) getCurrentTicket(w http.ResponseWriter, r *http.Request) {
+	ticket, err := h.voteService.GetTicket(pollIDOrDefault(r.URL.Query().Get("pollId")), requestctx.From(r.Context()).VoteAudit().Principal())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ticketBody{
+		PollID:          ticket.PollID,
+		Value:           ticket.Value,
+		Version:         ticket.Version,
+		RemainingUsages: ticket.RemainingUsages,
+		ExpiresAt:       ticket.ExpiresAt,
+		CreatedAt:       ticket.CreatedAt,
+		Holder:          ticket.Holder,
+	})
+}
+
+// getUserVotes 查询投票活动中用户的票数，查询参数consistency和afterEventId与GraphQL的getUserVotes相同
+func (h *Handler) getUserVotes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pollID, err := validation.ValidatePollID("pollId", pollIDOrDefault(query.Get("pollId")))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	afterEventID := query.Get("afterEventId")
+	consistency, err := validation.ValidateReadConsistency(query.Get("consistency"), afterEventID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	var userVote *model.UserVote
+	if consistency == model.ReadStrong {
+		userVote, err = h.voteService.GetUserVoteStrong(r.Context(), pollID, r.PathValue("name"), afterEventID)
+	} else {
+		userVote, err = h.voteService.GetUserVote(pollID, r.PathValue("name"))
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userVote)
+}
+
+// getAllUserVotes 查询投票活动中所有用户的票数
+func (h *Handler) getAllUserVotes(w http.ResponseWriter, r *http.Request) {
+	pollID, err := validation.ValidatePollID("pollId", pollIDOrDefault(r.URL.Query().Get("pollId")))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	userVotes, err := h.voteService.GetAllUserVotes(pollID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if userVotes == nil {
+		userVotes = []*model.UserVote{}
+	}
+	writeJSON(w, http.StatusOK, userVotes)
+}
+
+// writeError 返回错误响应，未知错误记录日志
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if status := writeError(w, err); status == http.StatusInternalServerError {
+		h.logger.ErrorContext(r.Context(), "处理REST请求失败", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+}
+
+func pollIDOrDefault(pollID string) string {
+	if pollID == "" {
+		return model.DefaultPollID
+	}
+	return pollID
+}
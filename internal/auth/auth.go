@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+)
+
+// API密钥的权限范围，高一级的范围包含低一级的所有权限
+const (
+	ScopeRead  = "read"  // 只能执行查询
+	ScopeVote  = "vote"  // 查询和投票
+	ScopeAdmin = "admin" // 所有操作，只有配置中的管理密钥拥有
+)
+
+var scopeLevels = map[string]int{ScopeRead: 1, ScopeVote: 2, ScopeAdmin: 3}
+
+const (
+	// APIKeyHeader 客户端携带API密钥的请求头，也可以使用Authorization: Bearer
+	APIKeyHeader = "X-API-Key"
+	// AdminActor 使用管理密钥的请求在投票日志中记录的调用方
+	AdminActor = "admin"
+
+	keyPrefix       = "lv_"
+	keyRandomBytes  = 32
+	displayedPrefix = len(keyPrefix) + 8 // 保存并展示的密钥前缀长度
+	defaultCacheTTL = 30 * time.Second
+)
+
+var (
+	// ErrUnauthenticated 缺少API密钥，或密钥不存在、已吊销
+	ErrUnauthenticated = errors.New("UNAUTHENTICATED: 缺少或无效的API密钥")
+	// ErrForbidden API密钥的权限范围不允许执行该操作
+	ErrForbidden = errors.New("FORBIDDEN: API密钥没有执行该操作的权限")
+)
+
+// KeyStore API密钥的持久化存储，由repository.Storage实现
+type KeyStore interface {
+	CreateAPIKey(key *model.APIKey) error
+	GetAPIKeyByHash(hash string) (*model.APIKey, error)
+	RevokeAPIKey(id int64) (*model.APIKey, error)
+}
+
+type cachedKey struct {
+	key       *model.APIKey
+	expiresAt time.Time
+}
+
+// Authenticator 校验GraphQL请求携带的API密钥，校验结果在进程内缓存auth.cache_ttl
+type Authenticator struct {
+	store  KeyStore
+	logger *slog.Logger
+	mu     sync.Mutex
+	cache  map[string]cachedKey // 密钥哈希 -> 数据库中的记录，只缓存存在的密钥
+}
+
+// NewAuthenticator 创建API密钥认证器
+func NewAuthenticator(store KeyStore, logger *slog.Logger) *Authenticator {
+	return &Authenticator{
+		store:  store,
+		logger: logging.Component(logger, "auth"),
+		cache:  make(map[string]cachedKey),
+	}
+}
+
+// Enabled 是否开启了API密钥认证
+func Enabled() bool {
+	return config.AppConfig.Auth.Enabled
+}
+
+// Middleware 校验请求携带的API密钥，并把调用方和权限范围写入请求上下文，需位于withRequestContext之内
+// 未开启认证时只识别管理密钥，其他请求直接放行；开启认证后缺少或无效的密钥返回401，不再执行GraphQL请求
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.Identify(r.Context(), keyFromRequest(r)); err != nil {
+			writeUnauthenticated(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Identify 校验密钥，并把调用方和权限范围写入ctx中的请求上下文，HTTP中间件和gRPC拦截器共用
+// 未开启认证时只识别管理密钥，其他密钥忽略；开启认证后缺少或无效的密钥返回ErrUnauthenticated，数据库不可用时返回其他错误
+func (a *Authenticator) Identify(ctx context.Context, key string) error {
+	if !Enabled() {
+		// 管理接口始终需要管理密钥，与是否开启认证无关
+		if isAdminKey(key) {
+			info := requestctx.From(ctx)
+			info.Actor = AdminActor
+			info.Roles = []string{ScopeAdmin}
+		}
+		return nil
+	}
+
+	actor, scope, err := a.authenticate(key)
+	if err != nil {
+		if !errors.Is(err, ErrUnauthenticated) {
+			a.logger.ErrorContext(ctx, "校验API密钥失败", "error", err)
+		}
+		return err
+	}
+	info := requestctx.From(ctx)
+	info.Actor = actor
+	info.Roles = []string{scope}
+	return nil
+}
+
+// authenticate 返回密钥对应的调用方和权限范围
+func (a *Authenticator) authenticate(key string) (string, string, error) {
+	if key == "" {
+		return "", "", ErrUnauthenticated
+	}
+	if isAdminKey(key) {
+		return AdminActor, ScopeAdmin, nil
+	}
+
+	apiKey, err := a.lookup(HashKey(key))
+	if err != nil {
+		return "", "", err
+	}
+	if apiKey == nil || apiKey.RevokedAt != nil {
+		return "", "", ErrUnauthenticated
+	}
+	return "apikey:" + apiKey.Name, apiKey.Scope, nil
+}
+
+// lookup 先查缓存再查数据库，不存在的密钥不缓存，避免随机密钥占满内存
+func (a *Authenticator) lookup(hash string) (*model.APIKey, error) {
+	now := time.Now()
+	a.mu.Lock()
+	cached, ok := a.cache[hash]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.key, nil
+	}
+
+	apiKey, err := a.store.GetAPIKeyByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	if apiKey != nil {
+		a.cache[hash] = cachedKey{key: apiKey, expiresAt: now.Add(cacheTTL())}
+	} else {
+		delete(a.cache, hash)
+	}
+	a.mu.Unlock()
+	return apiKey, nil
+}
+
+// CreateKey 生成并保存一个新的API密钥，返回的明文密钥只有这一次机会获取
+func (a *Authenticator) CreateKey(name, scope string) (*model.APIKey, string, error) {
+	if scope != ScopeRead && scope != ScopeVote {
+		return nil, "", fmt.Errorf("不支持的权限范围: %s", scope)
+	}
+	key, err := generateKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	apiKey := &model.APIKey{
+		Name:      name,
+		Prefix:    key[:displayedPrefix],
+		KeyHash:   HashKey(key),
+		Scope:     scope,
+		CreatedAt: time.Now(),
+	}
+	if err := a.store.CreateAPIKey(apiKey); err != nil {
+		return nil, "", err
+	}
+	return apiKey, key, nil
+}
+
+// RevokeKey 吊销API密钥，本实例立即生效，其他实例在缓存过期后生效
+func (a *Authenticator) RevokeKey(id int64) (*model.APIKey, error) {
+	apiKey, err := a.store.RevokeAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	delete(a.cache, apiKey.KeyHash)
+	a.mu.Unlock()
+	return apiKey, nil
+}
+
+// Authorize 检查请求的调用方是否拥有scope权限
+// 管理权限始终需要配置中的管理密钥，未配置auth.admin_key时拒绝所有管理操作；其他权限只在开启认证后检查
+func Authorize(ctx context.Context, scope string) error {
+	if scope == ScopeAdmin && config.AppConfig.Auth.AdminKey == "" {
+		return fmt.Errorf("%w，未配置管理密钥auth.admin_key，不能执行管理操作", ErrForbidden)
+	}
+	if !Enabled() && scope != ScopeAdmin {
+		return nil
+	}
+	required := scopeLevels[scope]
+	for _, role := range requestctx.From(ctx).Roles {
+		if scopeLevels[role] >= required {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w，需要%s权限", ErrForbidden, scope)
+}
+
+// isAdminKey 密钥是否为配置中的管理密钥，未配置管理密钥时总是返回false
+func isAdminKey(key string) bool {
+	adminKey := config.AppConfig.Auth.AdminKey
+	return key != "" && adminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1
+}
+
+// HashKey 数据库中只保存密钥的SHA-256哈希
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateKey() (string, error) {
+	random := make([]byte, keyRandomBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("生成API密钥失败: %w", err)
+	}
+	return keyPrefix + hex.EncodeToString(random), nil
+}
+
+// keyFromRequest 优先读取X-API-Key，其次是Authorization: Bearer
+func keyFromRequest(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get(APIKeyHeader)); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func cacheTTL() time.Duration {
+	if ttl := config.AppConfig.Auth.CacheTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultCacheTTL
+}
+
+// writeUnauthenticated 以GraphQL错误的格式返回401，数据库不可用时返回503
+func writeUnauthenticated(w http.ResponseWriter, err error) {
+	status, code, message := http.StatusUnauthorized, "UNAUTHENTICATED", err.Error()
+	if !errors.Is(err, ErrUnauthenticated) {
+		status, code, message = http.StatusServiceUnavailable, "INTERNAL", "API密钥校验暂不可用，请稍后重试"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]interface{}{
+			{"message": message, "extensions": map[string]interface{}{"code": code}},
+		},
+	})
+}
@@ -0,0 +1,19 @@
+package buildinfo
+
+import "time"
+
+// 构建信息，可通过 -ldflags 注入，例如:
+// -ldflags "-X github.com/lvdashuaibi/littlevote/internal/buildinfo.Version=v1.0.0
+// -X github.com/lvdashuaibi/littlevote/internal/buildinfo.Commit=$(git rev-parse --short HEAD)
+// -X github.com/lvdashuaibi/littlevote/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	// Version 构建版本
+	Version = "dev"
+	// Commit 构建时的git提交
+	Commit = "unknown"
+	// BuildTime 构建时间（RFC3339），未注入时为空
+	BuildTime = ""
+)
+
+// StartedAt 进程启动时间
+var StartedAt = time.Now()
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// defaultSize 未配置cache.local.size时每类数据最多缓存的条目数
+	defaultSize = 10000
+	// defaultTTL 未配置cache.local.ttl时条目的有效期
+	defaultTTL = time.Second
+	// resubscribeDelay 订阅失效通知失败后重新订阅的等待时间
+	resubscribeDelay = time.Second
+)
+
+// Subscriber 接收其他实例发布的缓存失效通知，由RedisRepository实现
+type Subscriber interface {
+	SubscribeCacheInvalidations(ctx context.Context, handle func(*repository.CacheInvalidation)) error
+}
+
+// Local Redis之前的进程内缓存，缓存用户票数和最新票据版本，其余方法直接调用被包装的CacheRepository
+// 本实例修改这两类数据时直接删除本地条目，其他实例的修改通过Redis频道的失效通知同步
+type Local struct {
+	repository.CacheRepository
+	subscriber Subscriber
+
+	userVotes *LRU[userVoteKey, model.UserVote]
+	versions  *LRU[string, string]
+	group     singleflight.Group
+	// generation 每次失效时递增，加载期间发生过失效的结果不写入本地缓存，避免旧数据在失效后重新缓存
+	generation atomic.Uint64
+	logger     *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type userVoteKey struct {
+	pollID   string
+	username string
+}
+
+// NewLocal 创建包装cacheRepo的进程内缓存，调用Start后开始接收失效通知
+func NewLocal(cacheRepo repository.CacheRepository, subscriber Subscriber, logger *slog.Logger) *Local {
+	size := config.AppConfig.Cache.Local.Size
+	if size <= 0 {
+		size = defaultSize
+	}
+	ttl := config.AppConfig.Cache.Local.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Local{
+		CacheRepository: cacheRepo,
+		subscriber:      subscriber,
+		userVotes:       NewLRU[userVoteKey, model.UserVote](size, ttl),
+		versions:        NewLRU[string, string](size, ttl),
+		logger:          logging.Component(logger, "local_cache"),
+		ctx:             ctx,
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}
+}
+
+// Start 开始接收失效通知
+func (l *Local) Start() {
+	go l.subscribe()
+	l.logger.Info("进程内缓存已启用")
+}
+
+// Stop 停止接收失效通知
+func (l *Local) Stop() {
+	l.cancel()
+	<-l.done
+}
+
+// subscribe 订阅失效通知，订阅中断期间可能错过通知，重新订阅前清空本地缓存
+func (l *Local) subscribe() {
+	defer close(l.done)
+	for {
+		err := l.subscriber.SubscribeCacheInvalidations(l.ctx, l.handleInvalidation)
+		if l.ctx.Err() != nil {
+			return
+		}
+		l.logger.Warn("接收缓存失效通知中断，清空本地缓存后重新订阅", "delay", resubscribeDelay, "error", err)
+		l.purge()
+
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// handleInvalidation 删除失效通知涉及的本地条目
+func (l *Local) handleInvalidation(invalidation *repository.CacheInvalidation) {
+	metrics.LocalCacheInvalidations.WithLabelValues(invalidation.Kind).Inc()
+	switch invalidation.Kind {
+	case repository.InvalidateUserVote, repository.InvalidateVoteAdjustment:
+		l.invalidateUserVotes(invalidation.PollID, invalidation.Usernames...)
+	case repository.InvalidateTicketVersion:
+		l.invalidateVersion(invalidation.PollID)
+	}
+}
+
+// GetUserVote 先查询本地缓存，未命中时从Redis读取，同一用户的并发未命中只查询一次
+func (l *Local) GetUserVote(pollID, username string) (*model.UserVote, bool, error) {
+	key := userVoteKey{pollID: normalizePollID(pollID), username: username}
+	if userVote, ok := l.userVotes.Get(key); ok {
+		metrics.LocalCacheRequests.WithLabelValues(repository.InvalidateUserVote, "hit").Inc()
+		return &userVote, true, nil
+	}
+	metrics.LocalCacheRequests.WithLabelValues(repository.InvalidateUserVote, "miss").Inc()
+
+	generation := l.generation.Load()
+	result, err, _ := l.group.Do("user_vote:"+key.pollID+":"+username, func() (interface{}, error) {
+		userVote, found, err := l.CacheRepository.GetUserVote(pollID, username)
+		if err != nil || !found {
+			return nil, err
+		}
+		if l.generation.Load() == generation {
+			l.userVotes.Set(key, *userVote)
+		}
+		return *userVote, nil
+	})
+	if err != nil || result == nil {
+		return nil, false, err
+	}
+	// 每个调用方得到独立的副本
+	userVote := result.(model.UserVote)
+	return &userVote, true, nil
+}
+
+// GetNewestTicketVersion 先查询本地缓存，未命中时从Redis读取，同一投票活动的并发未命中只查询一次
+// 尚未生成票据时不缓存，生产者写入首张票据后立即可见
+func (l *Local) GetNewestTicketVersion(pollID string) (string, error) {
+	key := normalizePollID(pollID)
+	if version, ok := l.versions.Get(key); ok {
+		metrics.LocalCacheRequests.WithLabelValues(repository.InvalidateTicketVersion, "hit").Inc()
+		return version, nil
+	}
+	metrics.LocalCacheRequests.WithLabelValues(repository.InvalidateTicketVersion, "miss").Inc()
+
+	generation := l.generation.Load()
+	result, err, _ := l.group.Do("ticket_version:"+key, func() (interface{}, error) {
+		version, err := l.CacheRepository.GetNewestTicketVersion(pollID)
+		if err != nil {
+			return "", err
+		}
+		if version != "" && l.generation.Load() == generation {
+			l.versions.Set(key, version)
+		}
+		return version, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.(string), nil
+}
+
+// SetUserVote 写入Redis后删除本地条目，下次查询时读取Redis中的值
+func (l *Local) SetUserVote(userVote *model.UserVote) error {
+	err := l.CacheRepository.SetUserVote(userVote)
+	l.invalidateUserVotes(userVote.PollID, userVote.Username)
+	return err
+}
+
+// DeleteUserVoteCache 删除Redis中的用户票数缓存和本地条目
+func (l *Local) DeleteUserVoteCache(pollID, username string) error {
+	err := l.CacheRepository.DeleteUserVoteCache(pollID, username)
+	l.invalidateUserVotes(pollID, username)
+	return err
+}
+
+// InvalidateAdjustedUserVote 删除Redis中调整过票数的用户缓存和本地条目
+func (l *Local) InvalidateAdjustedUserVote(pollID, username string) error {
+	err := l.CacheRepository.InvalidateAdjustedUserVote(pollID, username)
+	l.invalidateUserVotes(pollID, username)
+	return err
+}
+
+// WriteThroughUserVotes 回写Redis中的用户票数缓存后删除本地条目
+func (l *Local) WriteThroughUserVotes(pollID string, userVotes []*model.UserVote) error {
+	err := l.CacheRepository.WriteThroughUserVotes(pollID, userVotes)
+	for _, userVote := range userVotes {
+		l.invalidateUserVotes(pollID, userVote.Username)
+	}
+	return err
+}
+
+// SetNewestTicketVersion 更新Redis中的最新票据版本后删除本地条目
+func (l *Local) SetNewestTicketVersion(pollID, version string) error {
+	err := l.CacheRepository.SetNewestTicketVersion(pollID, version)
+	l.invalidateVersion(pollID)
+	return err
+}
+
+// ClosePoll 结束投票活动后删除本地的最新票据版本
+func (l *Local) ClosePoll(pollID string) error {
+	err := l.CacheRepository.ClosePoll(pollID)
+	l.invalidateVersion(pollID)
+	return err
+}
+
+func (l *Local) invalidateUserVotes(pollID string, usernames ...string) {
+	l.generation.Add(1)
+	pollID = normalizePollID(pollID)
+	for _, username := range usernames {
+		l.userVotes.Delete(userVoteKey{pollID: pollID, username: username})
+	}
+}
+
+func (l *Local) invalidateVersion(pollID string) {
+	l.generation.Add(1)
+	l.versions.Delete(normalizePollID(pollID))
+}
+
+func (l *Local) purge() {
+	l.generation.Add(1)
+	l.userVotes.Purge()
+	l.versions.Purge()
+}
+
+// normalizePollID 默认投票活动在Redis中与空活动ID使用相同的键
+func normalizePollID(pollID string) string {
+	if pollID == "" {
+		return model.DefaultPollID
+	}
+	return pollID
+}
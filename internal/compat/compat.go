@@ -0,0 +1,256 @@
+package compat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/ast"
+)
+
+// 滚动升级期间集群中同时运行新旧两个版本：网关和负载均衡会把同一个客户端的请求发给任一版本，
+// 任一版本写入Kafka的投票事件也可能被另一个版本消费。compat-check比较两个版本对外的接口契约，
+// 找出混合部署时会拒绝或错误处理流量的改动
+
+// Manifest 一个构建版本对外的接口契约，由schema子命令以JSON输出
+type Manifest struct {
+	Version     string      `json:"version"`
+	Commit      string      `json:"commit"`
+	GraphQL     string      `json:"graphql"`
+	EventSchema EventSchema `json:"eventSchema"`
+}
+
+// EventSchema 能解析的投票事件格式版本范围
+type EventSchema struct {
+	MinVersion int `json:"minVersion"`
+	MaxVersion int `json:"maxVersion"`
+}
+
+// 不兼容项的严重程度
+const (
+	SeverityBreaking = "breaking" // 混合部署期间会拒绝或错误处理流量
+	SeverityWarning  = "warning"  // 可以混合部署，但需要运维或客户端配合
+)
+
+// Problem 一个不兼容项
+type Problem struct {
+	Severity string `json:"severity"`
+	Path     string `json:"path"` // 如Mutation.vote(input)、VoteReasonCode.DUPLICATE、event.schemaVersion
+	Message  string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("[%s] %s: %s", p.Severity, p.Path, p.Message)
+}
+
+// HasBreaking 是否存在不能混合部署的改动
+func HasBreaking(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Severity == SeverityBreaking {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare 比较从旧版本滚动升级到新版本时的兼容性，按严重程度和路径排序返回不兼容项
+func Compare(oldManifest, newManifest *Manifest) ([]Problem, error) {
+	c := &comparison{}
+	c.compareEventSchema(oldManifest.EventSchema, newManifest.EventSchema)
+
+	oldSchema, err := parseSchema(oldManifest.GraphQL)
+	if err != nil {
+		return nil, fmt.Errorf("解析旧版本的GraphQL Schema失败: %w", err)
+	}
+	newSchema, err := parseSchema(newManifest.GraphQL)
+	if err != nil {
+		return nil, fmt.Errorf("解析新版本的GraphQL Schema失败: %w", err)
+	}
+	c.compareGraphQL(oldSchema, newSchema)
+
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		if c.problems[i].Severity != c.problems[j].Severity {
+			return c.problems[i].Severity == SeverityBreaking
+		}
+		return c.problems[i].Path < c.problems[j].Path
+	})
+	return c.problems, nil
+}
+
+func parseSchema(sdl string) (*ast.Schema, error) {
+	schema, err := graphql.ParseSchema(sdl, nil)
+	if err != nil {
+		return nil, err
+	}
+	return schema.AST(), nil
+}
+
+type comparison struct {
+	problems []Problem
+}
+
+func (c *comparison) breaking(path, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Severity: SeverityBreaking, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *comparison) warning(path, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Severity: SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// compareEventSchema 新旧版本写入的事件都要能被对方消费
+func (c *comparison) compareEventSchema(oldEvents, newEvents EventSchema) {
+	const path = "event.schemaVersion"
+	switch {
+	case newEvents.MinVersion > oldEvents.MaxVersion:
+		c.breaking(path, "新版本只解析版本 %d 及以上的事件，旧版本最高只写入版本 %d", newEvents.MinVersion, oldEvents.MaxVersion)
+	case newEvents.MinVersion > oldEvents.MinVersion:
+		c.warning(path, "新版本不再解析版本 %d 以下的事件，升级前确认所有实例的kafka.event_schema_version不低于 %d",
+			newEvents.MinVersion, newEvents.MinVersion)
+	}
+	switch {
+	case newEvents.MaxVersion < oldEvents.MaxVersion:
+		c.breaking(path, "新版本最高只解析版本 %d 的事件，旧版本可能写入版本 %d", newEvents.MaxVersion, oldEvents.MaxVersion)
+	case newEvents.MaxVersion > oldEvents.MaxVersion:
+		c.warning(path, "新版本支持版本 %d 的事件，所有实例升级完成之前不要把kafka.event_schema_version提高到 %d",
+			newEvents.MaxVersion, newEvents.MaxVersion)
+	}
+}
+
+func (c *comparison) compareGraphQL(oldSchema, newSchema *ast.Schema) {
+	names := make([]string, 0, len(oldSchema.Types))
+	for name := range oldSchema.Types {
+		if !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		oldType := oldSchema.Types[name]
+		newType, ok := newSchema.Types[name]
+		if !ok {
+			c.breaking(name, "类型被删除")
+			continue
+		}
+		if oldType.Kind() != newType.Kind() {
+			c.breaking(name, "类型从 %s 变为 %s", oldType.Kind(), newType.Kind())
+			continue
+		}
+		switch o := oldType.(type) {
+		case *ast.ObjectTypeDefinition:
+			c.compareFields(name, o.Fields, newType.(*ast.ObjectTypeDefinition).Fields)
+		case *ast.InterfaceTypeDefinition:
+			c.compareFields(name, o.Fields, newType.(*ast.InterfaceTypeDefinition).Fields)
+		case *ast.InputObject:
+			c.compareInputValues(name, "输入字段", o.Values, newType.(*ast.InputObject).Values)
+		case *ast.EnumTypeDefinition:
+			c.compareEnum(name, o, newType.(*ast.EnumTypeDefinition))
+		case *ast.Union:
+			c.compareUnion(name, o, newType.(*ast.Union))
+		}
+	}
+}
+
+// compareFields 输出字段不能删除，类型只能变得更严格（如可空变为非空）
+func (c *comparison) compareFields(typeName string, oldFields, newFields ast.FieldsDefinition) {
+	for _, oldField := range oldFields {
+		path := typeName + "." + oldField.Name
+		newField := newFields.Get(oldField.Name)
+		if newField == nil {
+			if oldField.Directives.Get("deprecated") != nil {
+				c.warning(path, "删除了已废弃的字段，仍在使用的旧客户端会报错")
+			} else {
+				c.breaking(path, "字段被删除，应先以@deprecated标记废弃并保留至少一个版本")
+			}
+			continue
+		}
+		if !outputTypeCompatible(oldField.Type, newField.Type) {
+			c.breaking(path, "字段类型从 %s 变为 %s", oldField.Type, newField.Type)
+		}
+		c.compareInputValues(path, "参数", oldField.Arguments, newField.Arguments)
+	}
+}
+
+// compareInputValues 参数和输入字段不能删除，类型只能变得更宽松，不能新增没有默认值的必填项
+func (c *comparison) compareInputValues(parent, kind string, oldValues, newValues ast.ArgumentsDefinition) {
+	for _, oldValue := range oldValues {
+		path := inputPath(parent, kind, oldValue.Name.Name)
+		newValue := newValues.Get(oldValue.Name.Name)
+		if newValue == nil {
+			c.breaking(path, "%s被删除，携带它的旧客户端请求会被拒绝", kind)
+			continue
+		}
+		if !outputTypeCompatible(newValue.Type, oldValue.Type) {
+			c.breaking(path, "%s类型从 %s 变为 %s", kind, oldValue.Type, newValue.Type)
+		}
+	}
+	for _, newValue := range newValues {
+		if oldValues.Get(newValue.Name.Name) != nil {
+			continue
+		}
+		if _, required := newValue.Type.(*ast.NonNull); required && newValue.Default == nil {
+			c.breaking(inputPath(parent, kind, newValue.Name.Name), "新增了没有默认值的必填%s，旧客户端的请求会被拒绝", kind)
+		}
+	}
+}
+
+func inputPath(parent, kind, name string) string {
+	if kind == "参数" {
+		return parent + "(" + name + ")"
+	}
+	return parent + "." + name
+}
+
+func (c *comparison) compareEnum(typeName string, oldEnum, newEnum *ast.EnumTypeDefinition) {
+	newValues := make(map[string]bool, len(newEnum.EnumValuesDefinition))
+	for _, v := range newEnum.EnumValuesDefinition {
+		newValues[v.EnumValue] = true
+	}
+	oldValues := make(map[string]bool, len(oldEnum.EnumValuesDefinition))
+	for _, v := range oldEnum.EnumValuesDefinition {
+		oldValues[v.EnumValue] = true
+		if !newValues[v.EnumValue] {
+			c.breaking(typeName+"."+v.EnumValue, "枚举值被删除")
+		}
+	}
+	for _, v := range newEnum.EnumValuesDefinition {
+		if !oldValues[v.EnumValue] {
+			c.warning(typeName+"."+v.EnumValue, "新增了枚举值，只认识旧枚举值的客户端需要能处理未知取值")
+		}
+	}
+}
+
+func (c *comparison) compareUnion(typeName string, oldUnion, newUnion *ast.Union) {
+	members := make(map[string]bool, len(newUnion.UnionMemberTypes))
+	for _, t := range newUnion.UnionMemberTypes {
+		members[t.Name] = true
+	}
+	for _, t := range oldUnion.UnionMemberTypes {
+		if !members[t.Name] {
+			c.breaking(typeName, "联合类型删除了成员 %s", t.Name)
+		}
+	}
+}
+
+// outputTypeCompatible 读取to类型值的客户端能否处理from类型的值：from可以比to更严格（非空），
+// 列表和类型名必须一致。比较输入类型时参数互换，新版本接受的值只能比旧版本更宽松
+func outputTypeCompatible(to, from ast.Type) bool {
+	if fromNonNull, ok := from.(*ast.NonNull); ok {
+		if toNonNull, ok := to.(*ast.NonNull); ok {
+			return outputTypeCompatible(toNonNull.OfType, fromNonNull.OfType)
+		}
+		return outputTypeCompatible(to, fromNonNull.OfType)
+	}
+	switch t := to.(type) {
+	case *ast.NonNull:
+		return false
+	case *ast.List:
+		fromList, ok := from.(*ast.List)
+		return ok && outputTypeCompatible(t.OfType, fromList.OfType)
+	case ast.NamedType:
+		fromNamed, ok := from.(ast.NamedType)
+		return ok && t.TypeName() == fromNamed.TypeName()
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package control
+
+import (
+	"log/slog"
+
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+)
+
+// OutboxPausedKey 暂停发件箱中继的状态在etcd中的键，键存在即表示暂停
+const OutboxPausedKey = "/littlevote/outbox/paused"
+
+// NewOutboxControl 创建发件箱中继的开关，暂停期间投票事件留在发件箱中，不再发送到Kafka
+func NewOutboxControl(logger *slog.Logger) (*PauseControl, error) {
+	return newPauseControl(OutboxPausedKey, "发件箱中继", metrics.OutboxRelayPaused, logger)
+}
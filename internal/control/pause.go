@@ -0,0 +1,231 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/prometheus/client_golang/prometheus"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ConsumptionPausedKey 暂停消费的状态在etcd中的键，键存在即表示暂停
+const ConsumptionPausedKey = "/littlevote/consumer/paused"
+
+// PauseControl 集群范围的暂停开关，状态保存在etcd中，所有实例共同遵守
+type PauseControl struct {
+	key    string           // 状态在etcd中的键，键存在即表示暂停
+	name   string           // 开关控制的任务，用于日志
+	gauge  prometheus.Gauge // 暂停时为1
+	client *clientv3.Client
+	cancel context.CancelFunc
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	state   model.ConsumptionState
+	changed chan struct{} // 状态变化时关闭并替换，用于唤醒等待中的消费者
+}
+
+// NewConsumptionControl 创建投票事件消费的开关，暂停期间消费者不再拉取消息
+func NewConsumptionControl(logger *slog.Logger) (*PauseControl, error) {
+	return newPauseControl(ConsumptionPausedKey, "投票事件消费", metrics.ConsumerPaused, logger)
+}
+
+func newPauseControl(key, name string, gauge prometheus.Gauge, logger *slog.Logger) (*PauseControl, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   config.AppConfig.ETCD.Endpoints,
+		DialTimeout: config.AppConfig.ETCD.DialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建etcd客户端失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &PauseControl{
+		key:     key,
+		name:    name,
+		gauge:   gauge,
+		client:  cli,
+		cancel:  cancel,
+		logger:  logging.Component(logger, "control").With("task", name),
+		changed: make(chan struct{}),
+	}
+
+	revision, err := c.load(ctx)
+	if err != nil {
+		cancel()
+		cli.Close()
+		return nil, err
+	}
+	go c.watch(ctx, revision)
+
+	return c, nil
+}
+
+// Pause 暂停集群内所有实例的任务
+func (c *PauseControl) Pause(reason string) (*model.ConsumptionState, error) {
+	now := time.Now()
+	state := model.ConsumptionState{
+		Paused:   true,
+		Reason:   reason,
+		PausedBy: config.AppConfig.Server.InstanceID,
+		Since:    &now,
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return nil, fmt.Errorf("序列化%s状态失败: %v", c.name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+	defer cancel()
+	if _, err := c.client.Put(ctx, c.key, string(data)); err != nil {
+		return nil, fmt.Errorf("暂停%s失败: %v", c.name, err)
+	}
+
+	c.setState(state)
+	c.logger.Info("已暂停集群内所有实例的任务", "instance", state.PausedBy, "reason", reason)
+	return &state, nil
+}
+
+// Resume 恢复集群内所有实例的任务
+func (c *PauseControl) Resume() (*model.ConsumptionState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+	defer cancel()
+	if _, err := c.client.Delete(ctx, c.key); err != nil {
+		return nil, fmt.Errorf("恢复%s失败: %v", c.name, err)
+	}
+
+	state := model.ConsumptionState{}
+	c.setState(state)
+	c.logger.Info("已恢复集群内所有实例的任务", "instance", config.AppConfig.Server.InstanceID)
+	return &state, nil
+}
+
+// State 返回当前的暂停状态
+func (c *PauseControl) State() *model.ConsumptionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.state
+	return &state
+}
+
+// Paused 返回当前是否暂停
+func (c *PauseControl) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Paused
+}
+
+// Wait 暂停期间阻塞，恢复后返回；ctx取消时返回其错误
+func (c *PauseControl) Wait(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		paused := c.state.Paused
+		changed := c.changed
+		c.mu.Unlock()
+
+		if !paused {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close 停止监听并关闭etcd客户端
+func (c *PauseControl) Close() error {
+	c.cancel()
+	return c.client.Close()
+}
+
+// load 从etcd读取当前状态，返回读取时的版本号
+func (c *PauseControl) load(ctx context.Context) (int64, error) {
+	getCtx, cancel := context.WithTimeout(ctx, config.AppConfig.ETCD.RequestTimeout)
+	defer cancel()
+
+	resp, err := c.client.Get(getCtx, c.key)
+	if err != nil {
+		return 0, fmt.Errorf("获取%s状态失败: %v", c.name, err)
+	}
+
+	state := model.ConsumptionState{}
+	if len(resp.Kvs) > 0 {
+		state = c.decodeState(resp.Kvs[0].Value)
+	}
+	c.setState(state)
+	return resp.Header.Revision, nil
+}
+
+// watch 监听其他实例对暂停状态的修改，监听中断时重新读取状态后继续监听
+func (c *PauseControl) watch(ctx context.Context, revision int64) {
+	for {
+		watchChan := c.client.Watch(ctx, c.key, clientv3.WithRev(revision+1))
+		for watchResp := range watchChan {
+			if err := watchResp.Err(); err != nil {
+				c.logger.Warn("监听开关状态失败", "error", err)
+				break
+			}
+			for _, ev := range watchResp.Events {
+				if ev.Type == clientv3.EventTypePut {
+					c.setState(c.decodeState(ev.Kv.Value))
+				} else {
+					c.setState(model.ConsumptionState{})
+				}
+				revision = ev.Kv.ModRevision
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+		time.Sleep(time.Second)
+		if next, err := c.load(ctx); err != nil {
+			c.logger.Warn("重新读取开关状态失败", "error", err)
+		} else {
+			revision = next
+		}
+	}
+}
+
+func (c *PauseControl) setState(state model.ConsumptionState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state.Paused != state.Paused {
+		if state.Paused {
+			c.logger.Info("任务已暂停", "reason", state.Reason)
+		} else {
+			c.logger.Info("任务已恢复")
+		}
+	}
+	c.state = state
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	if state.Paused {
+		c.gauge.Set(1)
+	} else {
+		c.gauge.Set(0)
+	}
+}
+
+// decodeState 解析etcd中的状态，键存在但内容无法解析时仍视为暂停
+func (c *PauseControl) decodeState(data []byte) model.ConsumptionState {
+	var state model.ConsumptionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		c.logger.Warn("解析开关状态失败，按已暂停处理", "error", err)
+	}
+	state.Paused = true
+	return state
+}
@@ -0,0 +1,249 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/registry"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+)
+
+const (
+	defaultRefreshInterval     = 5 * time.Second
+	defaultHealthCheckInterval = 3 * time.Second
+	defaultUnhealthyCooldown   = 10 * time.Second
+
+	healthCheckTimeout = 2 * time.Second
+	healthCheckQuery   = `{"query":"{ __typename }"}`
+
+	// requestIDHeader 请求ID，未提供时由网关生成并转发给后端，后端沿用同一个ID
+	requestIDHeader = "X-Request-ID"
+)
+
+// backend 网关后端实例
+type backend struct {
+	instanceID int
+	target     *url.URL
+	proxy      *httputil.ReverseProxy
+
+	// 不健康的截止时间（UnixNano），在此之前不再转发请求
+	unhealthyUntil atomic.Int64
+}
+
+func (b *backend) healthy(now time.Time) bool {
+	return now.UnixNano() >= b.unhealthyUntil.Load()
+}
+
+func (b *backend) markUnhealthy(cooldown time.Duration) {
+	b.unhealthyUntil.Store(time.Now().Add(cooldown).UnixNano())
+}
+
+// Gateway 从集群注册表发现实例，并在健康实例之间轮询转发GraphQL请求
+type Gateway struct {
+	registry *registry.Registry
+	client   *http.Client
+	logger   *slog.Logger
+
+	mu       sync.RWMutex
+	backends []*backend
+	next     atomic.Uint64
+
+	cancel context.CancelFunc
+}
+
+func NewGateway(reg *registry.Registry, logger *slog.Logger) *Gateway {
+	return &Gateway{
+		registry: reg,
+		client:   &http.Client{Timeout: healthCheckTimeout},
+		logger:   logging.Component(logger, "gateway"),
+	}
+}
+
+// Start 启动实例发现和健康检查，并在指定端口提供网关服务
+func (g *Gateway) Start(port int) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+
+	g.refreshBackends()
+	go g.discoveryLoop(ctx)
+	go g.healthCheckLoop(ctx)
+
+	addr := fmt.Sprintf(":%d", port)
+	g.logger.Info("网关已启动", "addr", addr)
+	return http.ListenAndServe(addr, g)
+}
+
+// Stop 停止实例发现和健康检查
+func (g *Gateway) Stop() {
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// ServeHTTP 选择一个健康的后端转发请求，请求没有请求ID时生成一个，网关和后端的日志使用同一个请求ID
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = requestctx.NewRequestID()
+		r.Header.Set(requestIDHeader, requestID)
+	}
+	r = r.WithContext(logging.WithRequestID(r.Context(), requestID))
+
+	b := g.pick()
+	if b == nil {
+		http.Error(w, "没有可用的后端实例", http.StatusServiceUnavailable)
+		return
+	}
+	b.proxy.ServeHTTP(w, r)
+}
+
+// pick 轮询选择健康的后端，全部不健康时返回nil
+func (g *Gateway) pick() *backend {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	n := len(g.backends)
+	if n == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	start := g.next.Add(1)
+	for i := 0; i < n; i++ {
+		b := g.backends[(start+uint64(i))%uint64(n)]
+		if b.healthy(now) {
+			return b
+		}
+	}
+	return nil
+}
+
+// discoveryLoop 定期从注册表刷新后端列表
+func (g *Gateway) discoveryLoop(ctx context.Context) {
+	interval := config.AppConfig.Gateway.RefreshInterval
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			g.refreshBackends()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshBackends 按注册表重建后端列表，保留已有后端的健康状态
+func (g *Gateway) refreshBackends() {
+	instances, err := g.registry.ListInstances()
+	if err != nil {
+		g.logger.Error("网关刷新后端实例失败", "error", err)
+		return
+	}
+
+	g.mu.RLock()
+	existing := make(map[string]*backend, len(g.backends))
+	for _, b := range g.backends {
+		existing[b.target.String()] = b
+	}
+	g.mu.RUnlock()
+
+	backends := make([]*backend, 0, len(instances))
+	for _, instance := range instances {
+		// 只读副本拒绝变更，由看板等只读流量直接访问，不参与网关转发
+		if instance.Role == registry.RoleReplica {
+			continue
+		}
+		target := &url.URL{Scheme: "http", Host: fmt.Sprintf("%s:%d", instance.Host, instance.Port)}
+		if b, ok := existing[target.String()]; ok {
+			backends = append(backends, b)
+			continue
+		}
+		backends = append(backends, g.newBackend(instance.ID, target))
+	}
+
+	g.mu.Lock()
+	g.backends = backends
+	g.mu.Unlock()
+}
+
+func (g *Gateway) newBackend(instanceID int, target *url.URL) *backend {
+	b := &backend{
+		instanceID: instanceID,
+		target:     target,
+		proxy:      httputil.NewSingleHostReverseProxy(target),
+	}
+
+	// 转发失败时立即将后端标记为不健康，避免后续请求继续打到故障实例
+	b.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		g.logger.ErrorContext(r.Context(), "网关转发请求失败", "instance", b.instanceID, "target", b.target.String(), "error", err)
+		b.markUnhealthy(unhealthyCooldown())
+		http.Error(w, "后端实例不可用", http.StatusBadGateway)
+	}
+	return b
+}
+
+// healthCheckLoop 定期主动探测所有后端
+func (g *Gateway) healthCheckLoop(ctx context.Context) {
+	interval := config.AppConfig.Gateway.HealthCheckInterval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			g.mu.RLock()
+			backends := append([]*backend(nil), g.backends...)
+			g.mu.RUnlock()
+
+			for _, b := range backends {
+				if err := g.probe(b); err != nil {
+					g.logger.Warn("实例健康检查失败", "instance", b.instanceID, "target", b.target.String(), "error", err)
+					b.markUnhealthy(unhealthyCooldown())
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// probe 向后端发送一个最简单的GraphQL查询确认其可用
+func (g *Gateway) probe(b *backend) error {
+	endpoint := b.target.ResolveReference(&url.URL{Path: config.AppConfig.GraphQL.Path})
+	resp, err := g.client.Post(endpoint.String(), "application/json", bytes.NewBufferString(healthCheckQuery))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 开启API密钥认证时探测请求不带密钥，返回401同样说明实例在正常提供服务
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func unhealthyCooldown() time.Duration {
+	if cooldown := config.AppConfig.Gateway.UnhealthyCooldown; cooldown > 0 {
+		return cooldown
+	}
+	return defaultUnhealthyCooldown
+}
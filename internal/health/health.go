@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+// 检查结果的状态
+const (
+	StatusOK           = "ok"
+	StatusDown         = "down"
+	StatusShuttingDown = "shutting_down"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+// Check 检查一个依赖是否可用，ctx带有检查超时
+type Check func(ctx context.Context) error
+
+// DependencyStatus 单个依赖的检查结果
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// Report /healthz和/readyz返回的JSON，任一依赖不可用时status为down
+type Report struct {
+	Status       string                       `json:"status"`
+	Dependencies map[string]*DependencyStatus `json:"dependencies,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker 汇总本实例各依赖的可用性，提供存活和就绪检查
+type Checker struct {
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+// NewChecker 创建依赖检查器，依赖通过Register添加
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Register 添加一个依赖检查，需在开始提供服务之前调用
+func (c *Checker) Register(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown 标记本实例正在关闭，此后/readyz返回503，负载均衡据此摘除本实例
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready 本实例是否仍在接收流量
+func (c *Checker) Ready() bool {
+	return !c.shuttingDown.Load()
+}
+
+// Run 并发执行所有依赖检查，每项检查单独计时
+func (c *Checker) Run(ctx context.Context) *Report {
+	timeout := config.AppConfig.Health.CheckTimeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+
+	statuses := make([]*DependencyStatus, len(c.checks))
+	var wg sync.WaitGroup
+	for i, nc := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			status := &DependencyStatus{Status: StatusOK, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = StatusDown
+				status.Error = err.Error()
+			}
+			statuses[i] = status
+		}(i, nc.check)
+	}
+	wg.Wait()
+
+	report := &Report{Status: StatusOK, Dependencies: make(map[string]*DependencyStatus, len(c.checks))}
+	for i, nc := range c.checks {
+		report.Dependencies[nc.name] = statuses[i]
+		if statuses[i].Status != StatusOK {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// ServeHealthz 返回各依赖的状态，任一依赖不可用时返回503
+func (c *Checker) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.Run(r.Context()))
+}
+
+// ServeReadyz 与/healthz相同，但关闭期间不再检查依赖，直接返回503
+func (c *Checker) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	if !c.Ready() {
+		writeReport(w, &Report{Status: StatusShuttingDown})
+		return
+	}
+	writeReport(w, c.Run(r.Context()))
+}
+
+func writeReport(w http.ResponseWriter, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,138 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// BatchHandler 批量处理投票事件，返回nil后这批消息的偏移量才会提交
+type BatchHandler func(ctx context.Context, events []*model.VoteEvent) error
+
+// BatchConsumer 以独立的消费者组批量读取投票事件，与计票消费者互不影响
+// 组内多个实例分摊分区，每条消息只被处理一次；处理失败时退避重试同一批，不会跳过
+type BatchConsumer struct {
+	reader        *kafka.Reader
+	batchSize     int
+	flushInterval time.Duration
+	logger        *slog.Logger
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+// NewBatchConsumer 创建以groupID消费所有主题的批量消费者
+func NewBatchConsumer(groupID string, batchSize int, flushInterval time.Duration, logger *slog.Logger) *BatchConsumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	// 同时读取默认主题和所有专属主题，不遗漏配置了专属主题的投票活动
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     config.AppConfig.Kafka.Brokers,
+		GroupTopics: AllTopics(),
+		GroupID:     groupID,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+	})
+
+	return &BatchConsumer{
+		reader:        reader,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		logger:        logging.Component(logger, "batch_consumer").With("group_id", groupID),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start 开始批量消费
+func (c *BatchConsumer) Start(handler BatchHandler) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run(handler)
+	}()
+}
+
+func (c *BatchConsumer) run(handler BatchHandler) {
+	for c.ctx.Err() == nil {
+		messages, events := c.fetchBatch()
+		if len(messages) == 0 {
+			continue
+		}
+
+		if !c.handleBatch(handler, events) {
+			return
+		}
+		if err := c.reader.CommitMessages(c.ctx, messages...); err != nil && c.ctx.Err() == nil {
+			c.logger.Error("提交消费者组的偏移量失败", "error", err)
+		}
+	}
+}
+
+// fetchBatch 读取消息直到达到批量大小或刷新间隔，解析失败的消息仍会提交以免阻塞
+func (c *BatchConsumer) fetchBatch() ([]kafka.Message, []*model.VoteEvent) {
+	ctx, cancel := context.WithTimeout(c.ctx, c.flushInterval)
+	defer cancel()
+
+	var messages []kafka.Message
+	var events []*model.VoteEvent
+	for len(messages) < c.batchSize {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+				c.logger.Error("消费者组读取消息失败", "error", err)
+				time.Sleep(time.Second)
+			}
+			break
+		}
+		messages = append(messages, m)
+
+		event, err := decodeVoteEvent(m)
+		if err != nil {
+			c.logger.Error("消费者组解析消息失败", "partition", m.Partition, "offset", m.Offset, "error", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return messages, events
+}
+
+// handleBatch 处理一批事件，失败时退避重试，返回false表示消费者已停止
+func (c *BatchConsumer) handleBatch(handler BatchHandler, events []*model.VoteEvent) bool {
+	if len(events) == 0 {
+		return true
+	}
+
+	backoff := retryInitialBackoff
+	for {
+		err := handler(c.ctx, events)
+		if err == nil {
+			return true
+		}
+
+		c.logger.Warn("消费者组处理一批消息失败，退避后重试", "events", len(events), "backoff", backoff, "error", err)
+		select {
+		case <-c.ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+// Stop 停止消费，尚未提交的消息会在下次启动后重新处理
+func (c *BatchConsumer) Stop() error {
+	c.cancel()
+	c.wg.Wait()
+	return c.reader.Close()
+}
@@ -2,188 +2,515 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
 	"github.com/lvdashuaibi/littlevote/internal/model"
 	"github.com/segmentio/kafka-go"
 )
 
 type Consumer struct {
-	readers    []*kafka.Reader
-	ctx        context.Context
-	cancel     context.CancelFunc
-	numWorkers int
-	wg         sync.WaitGroup
+	// configs 各工作线程的Reader配置，StartConsuming时才创建Reader：消费者组的成员在创建时即加入组并分到分区，
+	// 不启动消费的实例（如只读副本）不能占用分区
+	configs     []kafka.ReaderConfig
+	mu          sync.RWMutex
+	readers     []*kafka.Reader
+	gate        Gate
+	offsets     OffsetStore
+	batch       BatchHandler
+	middlewares []Middleware
+	pool        *dispatcher
+	deadLetter  *DeadLetter
+	logger      *slog.Logger
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
 }
 
-type MessageHandler func(event *model.VoteEvent) error
+// 默认主题的消费方式
+const (
+	ConsumerModeGroup     = "group"     // 消费者组，组内的实例和工作线程分摊分区（默认）
+	ConsumerModePartition = "partition" // 按分区静态分配，每个实例读取kafka.consumer_partitions中的分区
+)
 
-func NewConsumer() (*Consumer, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	numWorkers := 8 // 使用8个goroutine并发消费
+// defaultConsumerWorkers 未配置kafka.consumer_workers时本实例消费默认主题的并发数
+const defaultConsumerWorkers = 8
 
-	// 获取Kafka主题的分区数量
-	conn, err := kafka.DialLeader(ctx, "tcp", config.AppConfig.Kafka.Brokers[0], config.AppConfig.Kafka.Topic, 0)
-	if err != nil {
+type MessageHandler func(ctx context.Context, event *model.VoteEvent) error
+
+// ErrRetryable 处理函数返回包装了该错误的错误时，消费者会退避后重新处理同一条消息
+var ErrRetryable = errors.New("依赖暂不可用，稍后重试")
+
+// 可重试错误的退避时间
+const (
+	retryInitialBackoff = 500 * time.Millisecond
+	retryMaxBackoff     = 30 * time.Second
+)
+
+// Gate 决定消费者是否继续拉取消息，Wait在暂停期间阻塞
+type Gate interface {
+	Wait(ctx context.Context) error
+}
+
+// OffsetStore 保存计票消费者已落库的偏移量，由repository.Storage实现
+// 偏移量与计票在同一个数据库事务中写入，见model.VoteEvent.Source
+type OffsetStore interface {
+	GetConsumerOffsets(topic string) (map[int]int64, error)
+}
+
+// NewConsumer 创建计票消费者，按kafka.consume_topics消费默认主题和各投票活动的专属主题
+// 默认主题按kafka.consumer_mode以消费者组或静态分配的分区消费，专属主题始终使用各自的消费者组
+func NewConsumer(logger *slog.Logger) (*Consumer, error) {
+	logger = logging.Component(logger, "consumer")
+	if err := validatePollTopics(); err != nil {
 		return nil, err
 	}
-	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
 
-	partitions, err := conn.ReadPartitions()
-	if err != nil {
-		return nil, err
+	var configs []kafka.ReaderConfig
+	if topic := config.AppConfig.Kafka.Topic; consumesTopic(topic) {
+		switch mode := consumerMode(); mode {
+		case ConsumerModeGroup:
+			workers := consumerWorkers()
+			for i := 0; i < workers; i++ {
+				configs = append(configs, groupReaderConfig(topic, config.AppConfig.Kafka.GroupID))
+			}
+			logger.Info("默认主题由消费者组消费", "topic", topic, "group_id", config.AppConfig.Kafka.GroupID, "workers", workers)
+		case ConsumerModePartition:
+			partitions, err := staticPartitions(ctx, topic)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			for _, partition := range partitions {
+				configs = append(configs, kafka.ReaderConfig{
+					Brokers:   config.AppConfig.Kafka.Brokers,
+					Topic:     topic,
+					Partition: partition,
+					MinBytes:  10e3, // 10KB
+					MaxBytes:  10e6, // 10MB
+				})
+			}
+			logger.Info("默认主题按静态分配的分区消费，每个分区一个工作线程", "topic", topic, "partitions", partitions)
+		default:
+			cancel()
+			return nil, fmt.Errorf("kafka.consumer_mode 只能是 %s 或 %s: %s", ConsumerModeGroup, ConsumerModePartition, mode)
+		}
 	}
 
-	// 统计主题的分区数量
-	var topicPartitions []int
-	for _, p := range partitions {
-		if p.Topic == config.AppConfig.Kafka.Topic {
-			topicPartitions = append(topicPartitions, p.ID)
+	// 专属主题使用各自的消费者组，组内多个实例分摊分区，可以单独扩容
+	for _, pt := range pollTopics() {
+		if !consumesTopic(pt.topic) {
+			continue
+		}
+		for i := 0; i < pt.workers; i++ {
+			configs = append(configs, groupReaderConfig(pt.topic, pt.groupID))
 		}
+		logger.Info("投票活动的专属主题由独立的消费者组消费", "poll_id", pt.pollID, "topic", pt.topic, "group_id", pt.groupID, "workers", pt.workers)
+	}
+	if len(configs) == 0 {
+		cancel()
+		return nil, fmt.Errorf("kafka.consume_topics %v 不包含任何已配置的主题", config.AppConfig.Kafka.ConsumeTopics)
 	}
 
-	log.Printf("检测到Kafka主题 %s 有 %d 个分区", config.AppConfig.Kafka.Topic, len(topicPartitions))
+	return &Consumer{
+		configs:     configs,
+		middlewares: DefaultMiddlewares(logger),
+		pool:        newDispatcher(),
+		logger:      logger,
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
 
-	// 创建多个reader，每个reader负责一个或多个分区
-	readers := make([]*kafka.Reader, 0, numWorkers)
+// consumerMode 默认主题的消费方式，未配置时为消费者组
+func consumerMode() string {
+	if mode := config.AppConfig.Kafka.ConsumerMode; mode != "" {
+		return mode
+	}
+	return ConsumerModeGroup
+}
 
-	// 如果分区数量小于worker数量，需要调整并发消费的worker数量
-	actualWorkers := min(numWorkers, len(topicPartitions))
-	if actualWorkers < numWorkers {
-		log.Printf("分区数量(%d)小于期望的goroutine数量(%d), 将使用%d个goroutine消费",
-			len(topicPartitions), numWorkers, actualWorkers)
-		numWorkers = actualWorkers
+// consumerWorkers 消费者组模式下本实例消费默认主题的工作线程数
+func consumerWorkers() int {
+	if workers := config.AppConfig.Kafka.ConsumerWorkers; workers > 0 {
+		return workers
 	}
+	return defaultConsumerWorkers
+}
 
-	// 方案1: 每个工作线程处理自己的特定分区
-	if len(topicPartitions) > 0 {
-		for i := 0; i < numWorkers; i++ {
-			// 为每个工作线程确定要处理的分区
-			partitionIndex := i % len(topicPartitions)
-			partition := topicPartitions[partitionIndex]
+// groupReaderConfig 消费者组成员的Reader配置。每个工作线程是组内的一个成员，Kafka把每个分区只分配给一个成员，
+// 成员数超过分区数时多出的成员空闲，不会重复消费；新的消费者组从分区最早的消息开始
+func groupReaderConfig(topic, groupID string) kafka.ReaderConfig {
+	return kafka.ReaderConfig{
+		Brokers:     config.AppConfig.Kafka.Brokers,
+		Topic:       topic,
+		GroupID:     groupID,
+		StartOffset: kafka.FirstOffset,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+	}
+}
 
-			// 为每个分区创建一个独立的reader
-			reader := kafka.NewReader(kafka.ReaderConfig{
-				Brokers:   config.AppConfig.Kafka.Brokers,
-				Topic:     config.AppConfig.Kafka.Topic,
-				Partition: partition,
-				MinBytes:  10e3, // 10KB
-				MaxBytes:  10e6, // 10MB
-			})
+// staticPartitions 静态分配模式下本实例读取的分区：kafka.consumer_partitions中的分区，为空时为主题的所有分区
+// 多个实例配置相同的分区时会重复读取，由数据库中已落库的偏移量跳过，但浪费资源
+func staticPartitions(ctx context.Context, topic string) ([]int, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", config.AppConfig.Kafka.Brokers[0], topic, 0)
+	if err != nil {
+		return nil, fmt.Errorf("连接Kafka获取主题 %s 的分区失败: %w", topic, err)
+	}
+	defer conn.Close()
 
-			readers = append(readers, reader)
-			log.Printf("消费者工作线程 #%d 将处理分区: %d", i, partition)
+	partitions, err := conn.ReadPartitions()
+	if err != nil {
+		return nil, fmt.Errorf("获取主题 %s 的分区失败: %w", topic, err)
+	}
+	existing := make(map[int]bool)
+	var all []int
+	for _, p := range partitions {
+		if p.Topic == topic {
+			existing[p.ID] = true
+			all = append(all, p.ID)
 		}
 	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("主题 %s 没有分区", topic)
+	}
 
-	// 方案2(备选): 使用消费者组模式，但会失去对分区的精确控制
-	// 如果分区数为0或者分区Reader创建失败，使用消费者组模式
-	if len(readers) == 0 {
-		log.Printf("未检测到分区或分区Reader创建失败，将使用消费者组模式")
-		groupReader := kafka.NewReader(kafka.ReaderConfig{
-			Brokers:  config.AppConfig.Kafka.Brokers,
-			Topic:    config.AppConfig.Kafka.Topic,
-			GroupID:  config.AppConfig.Kafka.GroupID,
-			MinBytes: 10e3, // 10KB
-			MaxBytes: 10e6, // 10MB
-		})
-		readers = append(readers, groupReader)
-		log.Printf("创建消费者组Reader，GroupID: %s", config.AppConfig.Kafka.GroupID)
-		numWorkers = 1 // 消费者组模式只使用一个Reader
+	assigned := config.AppConfig.Kafka.ConsumerPartitions
+	if len(assigned) == 0 {
+		sort.Ints(all)
+		return all, nil
+	}
+	for _, partition := range assigned {
+		if !existing[partition] {
+			return nil, fmt.Errorf("kafka.consumer_partitions 中的分区 %d 不存在于主题 %s", partition, topic)
+		}
 	}
+	return assigned, nil
+}
 
-	return &Consumer{
-		readers:    readers,
-		ctx:        ctx,
-		cancel:     cancel,
-		numWorkers: numWorkers,
-	}, nil
+// SetGate 设置消费开关，需要在StartConsuming之前调用
+func (c *Consumer) SetGate(gate Gate) {
+	c.gate = gate
 }
 
-// min 返回两个整数中的较小值
-func min(a, b int) int {
-	if a < b {
-		return a
+// SetOffsetStore 设置已落库偏移量的存储，需要在StartConsuming之前调用
+// 按分区读取的Reader不属于消费者组，启动时从已落库的偏移量之后继续读取，未设置时从分区最早的消息开始；
+// 消费者组没有提交过偏移量的分区同样以已落库的偏移量初始化
+func (c *Consumer) SetOffsetStore(store OffsetStore) {
+	c.offsets = store
+}
+
+// SetBatchHandler 设置批量消费模式的处理函数，需要在StartConsuming之前调用
+// kafka.consumer_batch_size大于1时各工作线程攒批后交给它在一个数据库事务中处理，否则仍逐条处理
+func (c *Consumer) SetBatchHandler(handler BatchHandler) {
+	c.batch = handler
+}
+
+// SetDeadLetter 设置死信写入器，解析失败和最终处理失败的消息写入死信主题，需要在StartConsuming之前调用；Stop时关闭
+func (c *Consumer) SetDeadLetter(deadLetter *DeadLetter) {
+	if deadLetter == nil {
+		return
 	}
-	return b
+	c.deadLetter = deadLetter
+	c.Use(deadLetter.Middleware())
 }
 
-// StartConsuming 开始消费消息，使用多个goroutine并发消费
+// Use 在默认中间件之后追加中间件，需要在StartConsuming之前调用
+// 追加的中间件位于Retry之内，每次重试都会经过
+func (c *Consumer) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+// StartConsuming 创建Reader并开始消费消息，每个Reader由一个goroutine消费
 func (c *Consumer) StartConsuming(handler MessageHandler) {
-	for i := 0; i < len(c.readers); i++ {
-		reader := c.readers[i]
-		if reader == nil {
-			continue
-		}
+	c.seedGroupOffsets()
+	c.mu.Lock()
+	for _, readerConfig := range c.configs {
+		c.readers = append(c.readers, kafka.NewReader(readerConfig))
+	}
+	c.mu.Unlock()
+	c.restoreOffsets()
 
+	pipeline := Chain(handler, c.middlewares...)
+	batchSize := config.AppConfig.Kafka.ConsumerBatchSize
+	if c.pool != nil && (c.batch == nil || batchSize <= 1) {
+		c.startDispatcher(pipeline)
+	}
+	for i, reader := range c.readers {
 		c.wg.Add(1)
 		go func(workerID int, r *kafka.Reader) {
 			defer c.wg.Done()
-			c.consumeMessages(workerID, r, handler)
+			if c.batch != nil && batchSize > 1 {
+				c.consumeBatches(workerID, r, batchSize, pipeline)
+				return
+			}
+			c.consumeMessages(workerID, r, pipeline)
 		}(i, reader)
 	}
 
-	log.Printf("已启动 %d 个Kafka消费者工作线程", len(c.readers))
+	if c.batch != nil && batchSize > 1 {
+		c.logger.Info("已启动Kafka消费者工作线程，批量消费模式", "workers", len(c.readers), "batch_size", batchSize)
+		return
+	}
+	c.logger.Info("已启动Kafka消费者工作线程", "workers", len(c.readers))
 }
 
-// consumeMessages 单个消费者goroutine的消费逻辑
-func (c *Consumer) consumeMessages(workerID int, reader *kafka.Reader, handler MessageHandler) {
-	log.Printf("消费者工作线程 #%d 已启动", workerID)
+// consumeMessages 单个消费者goroutine的消费逻辑，启用处理线程池时只拉取和解析消息，处理和提交由处理线程完成
+func (c *Consumer) consumeMessages(workerID int, reader *kafka.Reader, handler Handler) {
+	c.logger.Debug("消费者工作线程已启动", "worker", workerID)
 
 	for {
 		select {
 		case <-c.ctx.Done():
-			log.Printf("消费者工作线程 #%d 收到停止信号", workerID)
+			c.logger.Debug("消费者工作线程收到停止信号", "worker", workerID)
 			return
 		default:
-			m, err := reader.ReadMessage(c.ctx)
+			// 消费暂停期间不再拉取消息，消息保留在Kafka中
+			if c.gate != nil {
+				if err := c.gate.Wait(c.ctx); err != nil {
+					c.logger.Debug("消费者工作线程上下文已取消", "worker", workerID)
+					return
+				}
+			}
+
+			// 积压的消息达到上限时停止拉取，等待处理线程处理完成
+			if c.pool != nil && !c.pool.acquire(c.ctx) {
+				c.logger.Debug("消费者工作线程上下文已取消", "worker", workerID)
+				return
+			}
+
+			// 消费者组模式下处理完成后才提交偏移量，处理前重启会重新投递，不会丢失
+			m, err := reader.FetchMessage(c.ctx)
 			if err != nil {
+				if c.pool != nil {
+					c.pool.release()
+				}
 				if err == context.Canceled {
-					log.Printf("消费者工作线程 #%d 上下文已取消", workerID)
+					c.logger.Debug("消费者工作线程上下文已取消", "worker", workerID)
 					return
 				}
-				log.Printf("消费者工作线程 #%d 读取消息失败: %v", workerID, err)
+				c.logger.Error("消费者工作线程读取消息失败", "worker", workerID, "error", err)
 				time.Sleep(time.Second)
 				continue
 			}
 
-			var event model.VoteEvent
-			if err := json.Unmarshal(m.Value, &event); err != nil {
-				log.Printf("消费者工作线程 #%d 解析消息失败: %v", workerID, err)
+			event, err := decodeVoteEvent(m)
+			if err != nil {
+				c.logger.Error("消费者工作线程解析消息失败", "worker", workerID, "partition", m.Partition, "offset", m.Offset, "error", err)
+				c.deadLetter.publish(c.ctx, m, err)
+				if c.pool != nil {
+					if !c.submit(&dispatchItem{workerID: workerID, reader: reader, message: m}) {
+						return
+					}
+					continue
+				}
+				c.commit(workerID, reader, m)
 				continue
 			}
+			event.Source = &model.EventSource{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
 
-			//log.Printf("消费者工作线程 #%d 收到消息: 分区=%d, 偏移量=%d, 版本=%s",
-			//workerID, m.Partition, m.Offset, event.TicketVersion)
+			delivery := &Delivery{
+				Event:     event,
+				WorkerID:  workerID,
+				Partition: m.Partition,
+				Offset:    m.Offset,
+				Message:   m,
+			}
+			if c.pool != nil {
+				if !c.submit(&dispatchItem{workerID: workerID, reader: reader, message: m, delivery: delivery}) {
+					return
+				}
+				continue
+			}
 
-			if err := handler(&event); err != nil {
-				//log.Printf("消费者工作线程 #%d 处理消息失败: %v", workerID, err)
+			// 失败的日志、指标和重试由中间件处理；消费者停止时正在重试的消息不提交，重启后重新处理
+			handler(logging.WithRequestID(c.ctx, event.Audit.RequestID), delivery)
+			if c.ctx.Err() != nil {
+				return
 			}
+			c.commit(workerID, reader, m)
 		}
 	}
 }
 
+// commit 向消费者组提交已处理消息的偏移量，按分区读取的Reader以数据库中的偏移量为准，不需要提交
+// 重平衡期间分区已分配给其他成员时提交失败，这些消息由新的成员重放，落库时按已落库的偏移量跳过
+func (c *Consumer) commit(workerID int, reader *kafka.Reader, messages ...kafka.Message) {
+	if reader.Config().GroupID == "" || len(messages) == 0 {
+		return
+	}
+	if err := reader.CommitMessages(c.ctx, messages...); err != nil && c.ctx.Err() == nil {
+		last := messages[len(messages)-1]
+		c.logger.Warn("消费者工作线程提交偏移量失败，分区可能已重新分配", "worker", workerID, "topic", last.Topic,
+			"partition", last.Partition, "offset", last.Offset, "error", err)
+	}
+}
+
+// restoreOffsets 按分区读取的Reader从数据库中已落库的偏移量之后继续读取，查询失败时从分区最早的消息开始，重放的消息在落库时跳过
+func (c *Consumer) restoreOffsets() {
+	if c.offsets == nil {
+		return
+	}
+	stored := make(map[string]map[int]int64)
+	for _, reader := range c.readers {
+		if reader.Config().GroupID != "" {
+			continue
+		}
+		readerConfig := reader.Config()
+		offsets, ok := stored[readerConfig.Topic]
+		if !ok {
+			var err error
+			if offsets, err = c.offsets.GetConsumerOffsets(readerConfig.Topic); err != nil {
+				c.logger.Error("查询已落库的偏移量失败，将从分区最早的消息开始消费", "topic", readerConfig.Topic, "error", err)
+			}
+			stored[readerConfig.Topic] = offsets
+		}
+		offset, ok := offsets[readerConfig.Partition]
+		if !ok {
+			continue
+		}
+		if err := reader.SetOffset(offset + 1); err != nil {
+			c.logger.Error("设置分区的起始偏移量失败", "topic", readerConfig.Topic, "partition", readerConfig.Partition, "error", err)
+			continue
+		}
+		c.logger.Info("从已落库的偏移量之后继续消费", "topic", readerConfig.Topic, "partition", readerConfig.Partition, "offset", offset)
+	}
+}
+
+// seedGroupOffsets 消费者组在某个分区还没有提交过偏移量时（如从静态分配切换到消费者组），以数据库中已落库的偏移量初始化，
+// 避免新的消费者组从分区开头重放整个主题；需要在本实例的成员加入组之前执行，组内已有其他成员时Kafka拒绝提交，此时从分区开头消费，
+// 重放的消息在落库时跳过
+func (c *Consumer) seedGroupOffsets() {
+	if c.offsets == nil {
+		return
+	}
+	client := &kafka.Client{Addr: kafka.TCP(config.AppConfig.Kafka.Brokers...), Timeout: 10 * time.Second}
+	seeded := make(map[[2]string]bool)
+	for _, readerConfig := range c.configs {
+		key := [2]string{readerConfig.GroupID, readerConfig.Topic}
+		if readerConfig.GroupID == "" || seeded[key] {
+			continue
+		}
+		seeded[key] = true
+		if err := c.seedGroupOffset(client, readerConfig.GroupID, readerConfig.Topic); err != nil {
+			c.logger.Warn("初始化消费者组的偏移量失败，没有提交过偏移量的分区从最早的消息开始消费", "group_id", readerConfig.GroupID,
+				"topic", readerConfig.Topic, "error", err)
+		}
+	}
+}
+
+func (c *Consumer) seedGroupOffset(client *kafka.Client, groupID, topic string) error {
+	stored, err := c.offsets.GetConsumerOffsets(topic)
+	if err != nil {
+		return err
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	partitions := make([]int, 0, len(stored))
+	for partition := range stored {
+		partitions = append(partitions, partition)
+	}
+
+	fetched, err := client.OffsetFetch(c.ctx, &kafka.OffsetFetchRequest{
+		GroupID: groupID,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return fmt.Errorf("查询消费者组的偏移量失败: %w", err)
+	}
+	if fetched.Error != nil {
+		return fmt.Errorf("查询消费者组的偏移量失败: %w", fetched.Error)
+	}
+	var commits []kafka.OffsetCommit
+	for _, p := range fetched.Topics[topic] {
+		// 已有提交的偏移量以消费者组为准
+		if p.Error != nil || p.CommittedOffset >= 0 {
+			continue
+		}
+		commits = append(commits, kafka.OffsetCommit{Partition: p.Partition, Offset: stored[p.Partition] + 1})
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+
+	// 不属于任何一代成员的提交，只在组内没有成员时被接受
+	committed, err := client.OffsetCommit(c.ctx, &kafka.OffsetCommitRequest{
+		GroupID:      groupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("提交消费者组的偏移量失败: %w", err)
+	}
+	for _, p := range committed.Topics[topic] {
+		if p.Error != nil {
+			return fmt.Errorf("提交分区 %d 的偏移量失败: %w", p.Partition, p.Error)
+		}
+	}
+	c.logger.Info("以已落库的偏移量初始化消费者组的偏移量", "group_id", groupID, "topic", topic, "partitions", len(commits))
+	return nil
+}
+
+// Lag 查询本实例各Reader尚未消费的消息数，开始消费之前为空
+func (c *Consumer) Lag(ctx context.Context) ([]*model.QueueDepth, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	depths := make([]*model.QueueDepth, 0, len(c.readers))
+	for _, reader := range c.readers {
+		readerConfig := reader.Config()
+		if readerConfig.GroupID != "" {
+			// 消费者组模式无法直接查询积压，使用最近一次拉取时的统计值；未分到分区的成员为0
+			depths = append(depths, &model.QueueDepth{
+				Source: model.QueueSourceKafka,
+				Depth:  reader.Stats().Lag,
+			})
+			continue
+		}
+
+		lag, err := reader.ReadLag(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("查询分区 %d 的消费积压失败: %w", readerConfig.Partition, err)
+		}
+		partition := readerConfig.Partition
+		depths = append(depths, &model.QueueDepth{
+			Source:    model.QueueSourceKafka,
+			Partition: &partition,
+			Depth:     lag,
+		})
+	}
+	return depths, nil
+}
+
 // Stop 停止消费
 func (c *Consumer) Stop() error {
-	log.Println("正在停止所有Kafka消费者工作线程...")
+	c.logger.Info("正在停止所有Kafka消费者工作线程")
 	c.cancel()
 
 	// 等待所有工作线程结束
 	c.wg.Wait()
 
-	// 关闭所有reader
+	// 关闭所有reader，消费者组的成员离开组，分区立即重新分配给其他实例
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for i, reader := range c.readers {
-		if reader != nil {
-			if err := reader.Close(); err != nil {
-				log.Printf("关闭消费者 #%d 失败: %v", i, err)
-			}
+		if err := reader.Close(); err != nil {
+			c.logger.Error("关闭消费者失败", "worker", i, "error", err)
 		}
 	}
+	c.readers = nil
+	if err := c.deadLetter.Close(); err != nil {
+		c.logger.Error("关闭死信写入器失败", "error", err)
+	}
 
-	log.Println("所有Kafka消费者工作线程已停止")
+	c.logger.Info("所有Kafka消费者工作线程已停止")
 	return nil
 }
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// defaultConsumerBatchInterval 未配置kafka.consumer_batch_interval时攒批的最长等待
+const defaultConsumerBatchInterval = 50 * time.Millisecond
+
+// consumeBatches 批量消费模式下单个工作线程的消费逻辑：收到第一条消息后最多攒batchSize条或等待
+// kafka.consumer_batch_interval，整批交给批量处理函数，处理完成后才提交偏移量
+func (c *Consumer) consumeBatches(workerID int, reader *kafka.Reader, batchSize int, fallback Handler) {
+	c.logger.Debug("消费者工作线程已启动（批量消费）", "worker", workerID)
+
+	for c.ctx.Err() == nil {
+		// 消费暂停期间不再拉取消息，消息保留在Kafka中
+		if c.gate != nil {
+			if err := c.gate.Wait(c.ctx); err != nil {
+				break
+			}
+		}
+
+		messages, deliveries := c.fetchBatch(workerID, reader, batchSize)
+		if len(messages) == 0 {
+			continue
+		}
+		// 启用处理线程池时同时处理的批次数不超过处理线程数
+		if c.pool != nil && !c.pool.acquireBatch(c.ctx) {
+			break
+		}
+		c.handleBatch(workerID, deliveries, fallback)
+		if c.pool != nil {
+			c.pool.releaseBatch()
+		}
+		// 消费者停止时正在重试的批次不提交，重启后重新处理
+		if c.ctx.Err() != nil {
+			break
+		}
+		c.commit(workerID, reader, messages...)
+	}
+	c.logger.Debug("消费者工作线程收到停止信号", "worker", workerID)
+}
+
+// fetchBatch 阻塞等待第一条消息，之后继续读取直到攒满一批或超过攒批等待时长
+// 解析失败的消息记录日志后跳过，仍会随这一批提交
+func (c *Consumer) fetchBatch(workerID int, reader *kafka.Reader, batchSize int) ([]kafka.Message, []*Delivery) {
+	first, err := reader.FetchMessage(c.ctx)
+	if err != nil {
+		if c.ctx.Err() == nil {
+			c.logger.Error("消费者工作线程读取消息失败", "worker", workerID, "error", err)
+			time.Sleep(time.Second)
+		}
+		return nil, nil
+	}
+
+	interval := config.AppConfig.Kafka.ConsumerBatchInterval
+	if interval <= 0 {
+		interval = defaultConsumerBatchInterval
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, interval)
+	defer cancel()
+
+	messages := []kafka.Message{first}
+	for len(messages) < batchSize {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+				c.logger.Error("消费者工作线程读取消息失败", "worker", workerID, "error", err)
+			}
+			break
+		}
+		messages = append(messages, m)
+	}
+
+	deliveries := make([]*Delivery, 0, len(messages))
+	for _, m := range messages {
+		event, err := decodeVoteEvent(m)
+		if err != nil {
+			c.logger.Error("消费者工作线程解析消息失败", "worker", workerID, "partition", m.Partition, "offset", m.Offset, "error", err)
+			c.deadLetter.publish(c.ctx, m, err)
+			continue
+		}
+		event.Source = &model.EventSource{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
+		deliveries = append(deliveries, &Delivery{Event: event, WorkerID: workerID, Partition: m.Partition, Offset: m.Offset, Message: m})
+	}
+	return messages, deliveries
+}
+
+// handleBatch 批量处理一批事件，可重试的失败（如数据库不可用）退避后重试整批；
+// 其他失败说明批中有无法写入的事件，改为逐条经中间件处理，只跳过出错的事件
+func (c *Consumer) handleBatch(workerID int, deliveries []*Delivery, fallback Handler) {
+	if len(deliveries) == 0 {
+		return
+	}
+	events := make([]*model.VoteEvent, len(deliveries))
+	for i, d := range deliveries {
+		events[i] = d.Event
+	}
+
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		metrics.ConsumerBatchSize.Observe(float64(len(events)))
+		metrics.ConsumerBatchDuration.Observe(elapsed.Seconds())
+		if threshold := config.AppConfig.Kafka.ConsumerSlowThreshold; threshold > 0 && elapsed >= threshold {
+			first, last := deliveries[0], deliveries[len(deliveries)-1]
+			c.logger.Warn("消费者批量处理投票事件较慢", "worker", workerID, "events", len(events),
+				"elapsed", elapsed.Round(time.Millisecond), "partition", first.Partition, "first_offset", first.Offset, "last_offset", last.Offset)
+		}
+	}()
+
+	backoff := retryInitialBackoff
+	for {
+		err := c.batch(c.ctx, events)
+		if err == nil {
+			metrics.ConsumerEvents.WithLabelValues("ok").Add(float64(len(events)))
+			return
+		}
+		if !errors.Is(err, ErrRetryable) {
+			c.logger.Warn("消费者批量处理投票事件失败，改为逐条处理", "worker", workerID, "events", len(events), "error", err)
+			for _, d := range deliveries {
+				fallback(logging.WithRequestID(c.ctx, d.Event.Audit.RequestID), d)
+			}
+			return
+		}
+
+		c.logger.Warn("消费者批量处理投票事件失败，退避后重试", "worker", workerID, "events", len(events), "backoff", backoff, "error", err)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+// 死信消息头，记录消息的来源和失败原因，replay-dlq据此把消息写回原主题
+const (
+	headerDeadLetterPrefix    = "dlq-"
+	headerDeadLetterTopic     = "dlq-topic"
+	headerDeadLetterPartition = "dlq-partition"
+	headerDeadLetterOffset    = "dlq-offset"
+	headerDeadLetterError     = "dlq-error"
+)
+
+// deadLetterReplayGroupSuffix replay-dlq读取死信主题使用的消费者组为kafka.group_id加上该后缀，已写回的消息不会重复写回
+const deadLetterReplayGroupSuffix = "-dlq-replay"
+
+// DeadLetter 把计票消费者无法处理的消息原样写入kafka.dead_letter_topic，修复原因后由replay-dlq子命令写回原主题重新计票
+// 可重试的失败由Retry中间件重试，不会进入死信主题；未配置死信主题时NewDeadLetter返回nil，失败的消息只记录日志后跳过
+type DeadLetter struct {
+	writer *kafka.Writer
+	logger *slog.Logger
+}
+
+// NewDeadLetter 创建死信写入器，未配置kafka.dead_letter_topic时返回nil
+func NewDeadLetter(logger *slog.Logger) *DeadLetter {
+	topic := config.AppConfig.Kafka.DeadLetterTopic
+	if topic == "" {
+		return nil
+	}
+	return &DeadLetter{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(config.AppConfig.Kafka.Brokers...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+		},
+		logger: logging.Component(logger, "dead-letter"),
+	}
+}
+
+// publish 把原始消息连同来源和失败原因写入死信主题，写入失败时记录日志，消息仍会被提交跳过
+func (d *DeadLetter) publish(ctx context.Context, source kafka.Message, cause error) {
+	if d == nil {
+		return
+	}
+	headers := make([]kafka.Header, 0, len(source.Headers)+4)
+	for _, h := range source.Headers {
+		if !strings.HasPrefix(h.Key, headerDeadLetterPrefix) {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers,
+		kafka.Header{Key: headerDeadLetterTopic, Value: []byte(source.Topic)},
+		kafka.Header{Key: headerDeadLetterPartition, Value: []byte(strconv.Itoa(source.Partition))},
+		kafka.Header{Key: headerDeadLetterOffset, Value: []byte(strconv.FormatInt(source.Offset, 10))},
+		kafka.Header{Key: headerDeadLetterError, Value: []byte(cause.Error())},
+	)
+
+	err := d.writer.WriteMessages(ctx, kafka.Message{Key: source.Key, Value: source.Value, Headers: headers})
+	if err != nil {
+		d.logger.ErrorContext(ctx, "写入死信主题失败，消息将被跳过", "topic", source.Topic, "partition", source.Partition,
+			"offset", source.Offset, "error", err)
+		return
+	}
+	d.logger.WarnContext(ctx, "消息已写入死信主题", "topic", source.Topic, "partition", source.Partition,
+		"offset", source.Offset, "cause", cause)
+}
+
+// Middleware 把最终处理失败的事件写入死信主题，可重试的失败和消费者停止时的失败不写入
+// 通过Consumer.Use安装在Retry之内，每次重试都会经过，因此按错误类型过滤
+func (d *DeadLetter) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, delivery *Delivery) error {
+			err := next(ctx, delivery)
+			if err != nil && !errors.Is(err, ErrRetryable) && ctx.Err() == nil {
+				d.publish(ctx, delivery.Message, err)
+			}
+			return err
+		}
+	}
+}
+
+// Close 关闭死信写入器
+func (d *DeadLetter) Close() error {
+	if d == nil {
+		return nil
+	}
+	return d.writer.Close()
+}
+
+// DeadLetterReplay 一次死信重放的结果
+type DeadLetterReplay struct {
+	Replayed int            // 写回原主题的消息数，dryRun时为读到的消息数
+	ByTopic  map[string]int // 按原主题统计
+}
+
+// ReplayDeadLetters 把死信主题中的消息写回各自的原主题，由计票消费者重新处理；已落库的事件按(eventId, index)去重，不会重复计票
+// 以独立的消费者组读取死信主题，写回成功后提交偏移量；max为0时不限制条数，idle内没有新消息时结束
+// dryRun时只读取并统计，不写回也不提交，下次重放仍会读到这些消息
+func ReplayDeadLetters(ctx context.Context, max int, idle time.Duration, dryRun bool, logger *slog.Logger) (*DeadLetterReplay, error) {
+	topic := config.AppConfig.Kafka.DeadLetterTopic
+	if topic == "" {
+		return nil, fmt.Errorf("未配置 kafka.dead_letter_topic")
+	}
+	reader := kafka.NewReader(groupReaderConfig(topic, config.AppConfig.Kafka.GroupID+deadLetterReplayGroupSuffix))
+	defer reader.Close()
+	// 写回时保留原消息的Key，按Key分区的策略下事件回到原来的分区
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(config.AppConfig.Kafka.Brokers...),
+		Balancer: &kafka.Hash{},
+	}
+	defer writer.Close()
+
+	result := &DeadLetterReplay{ByTopic: make(map[string]int)}
+	for max <= 0 || result.Replayed < max {
+		fetchCtx, cancel := context.WithTimeout(ctx, idle)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return result, nil
+			}
+			return result, fmt.Errorf("读取死信主题失败: %w", err)
+		}
+
+		original := kafka.Message{Key: m.Key, Value: m.Value}
+		var cause string
+		for _, h := range m.Headers {
+			switch {
+			case h.Key == headerDeadLetterTopic:
+				original.Topic = string(h.Value)
+			case h.Key == headerDeadLetterError:
+				cause = string(h.Value)
+			case !strings.HasPrefix(h.Key, headerDeadLetterPrefix):
+				original.Headers = append(original.Headers, h)
+			}
+		}
+		if original.Topic == "" {
+			original.Topic = config.AppConfig.Kafka.Topic
+		}
+		logger.Info("重放死信消息", "offset", m.Offset, "topic", original.Topic, "cause", cause, "dry_run", dryRun)
+
+		if !dryRun {
+			if err := writer.WriteMessages(ctx, original); err != nil {
+				return result, fmt.Errorf("写回主题 %s 失败: %w", original.Topic, err)
+			}
+			if err := reader.CommitMessages(ctx, m); err != nil {
+				return result, fmt.Errorf("提交死信主题偏移量失败: %w", err)
+			}
+		}
+		result.Replayed++
+		result.ByTopic[original.Topic]++
+	}
+	return result, nil
+}
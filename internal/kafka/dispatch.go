@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// defaultInFlightPerWorker 未配置kafka.consumer_max_in_flight时每个处理线程平均可以积压的消息数
+const defaultInFlightPerWorker = 16
+
+// dispatcher 计票消费者的处理线程池，位于Reader拉取消息和处理函数之间
+// 消息按(主题, 分区)哈希到固定的处理线程，同一分区的消息按偏移量顺序处理和提交：consumer_offsets只记录分区已落库的最大偏移量，
+// 同一分区乱序处理会让较小偏移量的消息被当作重放跳过，因此不按用户名哈希；username分区策略下同一候选人的事件本就在同一分区，顺序同样保留
+// 处理线程数限制计票同时占用的数据库连接数，已拉取未处理完的消息达到上限时所有Reader停止拉取，消息留在Kafka中
+type dispatcher struct {
+	lanes    []chan *dispatchItem
+	inFlight chan struct{}
+	// batchSlots 批量消费模式下同时处理的批次数上限，批次在拉取它的工作线程上处理
+	batchSlots chan struct{}
+}
+
+// dispatchItem 一条已拉取、等待处理线程处理的消息
+type dispatchItem struct {
+	workerID int // 拉取该消息的工作线程
+	reader   *kafka.Reader
+	message  kafka.Message
+	delivery *Delivery // 解析失败的消息为nil，只按顺序提交，不能越过同一分区尚未处理完的消息
+}
+
+// newDispatcher 按kafka.consumer_pool_size创建处理线程池，为0时返回nil，各工作线程自己处理拉取的消息
+func newDispatcher() *dispatcher {
+	size := config.AppConfig.Kafka.ConsumerPoolSize
+	if size <= 0 {
+		return nil
+	}
+	maxInFlight := config.AppConfig.Kafka.ConsumerMaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = size * defaultInFlightPerWorker
+	}
+
+	d := &dispatcher{
+		lanes:      make([]chan *dispatchItem, size),
+		inFlight:   make(chan struct{}, maxInFlight),
+		batchSlots: make(chan struct{}, size),
+	}
+	for i := range d.lanes {
+		// 已拉取的消息总数受inFlight限制，单个处理线程的队列不会超过它
+		d.lanes[i] = make(chan *dispatchItem, maxInFlight)
+	}
+	return d
+}
+
+// acquire 拉取一条消息之前占用一个积压名额，积压已满时阻塞，消费者停止时返回false
+func (d *dispatcher) acquire(ctx context.Context) bool {
+	select {
+	case d.inFlight <- struct{}{}:
+		metrics.ConsumerInFlight.Inc()
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release 归还积压名额
+func (d *dispatcher) release() {
+	<-d.inFlight
+	metrics.ConsumerInFlight.Dec()
+}
+
+// acquireBatch 批量消费模式下处理一批消息之前占用一个处理名额，消费者停止时返回false
+func (d *dispatcher) acquireBatch(ctx context.Context) bool {
+	select {
+	case d.batchSlots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseBatch 归还批次处理名额
+func (d *dispatcher) releaseBatch() {
+	<-d.batchSlots
+}
+
+// lane 返回处理该分区消息的处理线程的队列
+func (d *dispatcher) lane(m kafka.Message) chan *dispatchItem {
+	h := fnv.New32a()
+	h.Write([]byte(m.Topic))
+	h.Write([]byte(strconv.Itoa(m.Partition)))
+	return d.lanes[h.Sum32()%uint32(len(d.lanes))]
+}
+
+// startDispatcher 启动处理线程，消费者停止时退出，队列中尚未处理的消息不提交，重启或重平衡后重新投递
+func (c *Consumer) startDispatcher(handler Handler) {
+	for _, lane := range c.pool.lanes {
+		c.wg.Add(1)
+		go func(items <-chan *dispatchItem) {
+			defer c.wg.Done()
+			for {
+				select {
+				case <-c.ctx.Done():
+					return
+				case item := <-items:
+					c.process(item, handler)
+				}
+			}
+		}(lane)
+	}
+	c.logger.Info("计票消费者使用处理线程池", "pool_size", len(c.pool.lanes), "max_in_flight", cap(c.pool.inFlight))
+}
+
+// process 处理一条消息，处理完成后提交偏移量并归还积压名额
+func (c *Consumer) process(item *dispatchItem, handler Handler) {
+	defer c.pool.release()
+	if item.delivery != nil {
+		handler(logging.WithRequestID(c.ctx, item.delivery.Event.Audit.RequestID), item.delivery)
+	}
+	// 消费者停止时正在重试的消息不提交，重启后重新处理
+	if c.ctx.Err() != nil {
+		return
+	}
+	c.commit(item.workerID, item.reader, item.message)
+}
+
+// submit 把消息交给处理该分区的处理线程，队列已满时阻塞，消费者停止时返回false
+func (c *Consumer) submit(item *dispatchItem) bool {
+	select {
+	case c.pool.lane(item.message) <- item:
+		return true
+	case <-c.ctx.Done():
+		c.pool.release()
+		return false
+	}
+}
@@ -0,0 +1,217 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/kafka/schema"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// 投票事件的消息格式版本
+const (
+	SchemaVersionJSON       = 1 // 消息体为JSON，不带消息头
+	SchemaVersionCompressed = 2 // 消息头标注版本和编码，消息体可以是gzip压缩的JSON
+	SchemaVersionProtobuf   = 3 // 消息体为schema包定义的Protobuf，可以gzip压缩
+
+	// supportedSchemaVersion 本实例能解析的最高格式版本
+	supportedSchemaVersion = SchemaVersionProtobuf
+	// minSupportedSchemaVersion 本实例能解析的最低格式版本。消费者至少兼容当前版本和上一个版本，
+	// 滚动升级期间新旧实例写入的事件都能被任一实例消费；迁移到Protobuf期间主题中仍有JSON消息，继续兼容所有JSON版本
+	minSupportedSchemaVersion = SchemaVersionJSON
+)
+
+// SupportedSchemaVersions 返回本实例能解析的投票事件格式版本范围
+func SupportedSchemaVersions() (min, max int) {
+	return minSupportedSchemaVersion, supportedSchemaVersion
+}
+
+// producedSchemaVersion 生产者按配置写入的格式版本，未配置时为版本1
+func producedSchemaVersion() int {
+	if version := config.AppConfig.Kafka.EventSchemaVersion; version > 0 {
+		return version
+	}
+	return SchemaVersionJSON
+}
+
+// validateSchemaVersion 生产者写入的版本必须是本实例自己能解析的版本，
+// 否则提高版本后回滚到旧版本的实例会无法消费已写入的事件
+func validateSchemaVersion() error {
+	version := producedSchemaVersion()
+	if version < minSupportedSchemaVersion || version > supportedSchemaVersion {
+		return fmt.Errorf("kafka.event_schema_version 为 %d，本实例只支持 %d 到 %d",
+			version, minSupportedSchemaVersion, supportedSchemaVersion)
+	}
+	return nil
+}
+
+// 投票事件的消息头
+const (
+	headerSchemaVersion   = "schema-version"
+	headerContentEncoding = "content-encoding"
+
+	encodingJSON     = "json"
+	encodingGzip     = "gzip"
+	encodingProtobuf = "protobuf" // 只用于指标，消息头中没有content-encoding即为未压缩
+)
+
+// 各格式共用的消息头，只读，不能被修改
+var (
+	schemaV2Headers = []kafka.Header{
+		{Key: headerSchemaVersion, Value: []byte(strconv.Itoa(SchemaVersionCompressed))},
+	}
+	schemaV2GzipHeaders = []kafka.Header{
+		{Key: headerSchemaVersion, Value: []byte(strconv.Itoa(SchemaVersionCompressed))},
+		{Key: headerContentEncoding, Value: []byte(encodingGzip)},
+	}
+	schemaV3Headers = []kafka.Header{
+		{Key: headerSchemaVersion, Value: []byte(strconv.Itoa(SchemaVersionProtobuf))},
+	}
+	schemaV3GzipHeaders = []kafka.Header{
+		{Key: headerSchemaVersion, Value: []byte(strconv.Itoa(SchemaVersionProtobuf))},
+		{Key: headerContentEncoding, Value: []byte(encodingGzip)},
+	}
+)
+
+// encodeVoteEvent 按配置的格式版本把投票事件序列化到buf，返回的消息体引用buf，归还buf之前不能再修改
+// 版本为1时保持旧格式以兼容未升级的消费者
+func encodeVoteEvent(event *model.VoteEvent, buf *bytes.Buffer) ([]byte, []kafka.Header, error) {
+	if producedSchemaVersion() >= SchemaVersionProtobuf {
+		return encodeVoteEventProtobuf(event, buf)
+	}
+	if producedSchemaVersion() < SchemaVersionCompressed {
+		data, err := marshalVoteEvent(event, buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		metrics.VoteEventBytes.WithLabelValues(encodingJSON).Add(float64(len(data)))
+		return data, nil, nil
+	}
+
+	minUsernames := config.AppConfig.Kafka.CompressMinUsernames
+	if minUsernames <= 0 || len(event.Usernames) < minUsernames {
+		data, err := marshalVoteEvent(event, buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		metrics.VoteEventBytes.WithLabelValues(encodingJSON).Add(float64(len(data)))
+		return data, schemaV2Headers, nil
+	}
+
+	scratch := getBuffer()
+	defer putBuffer(scratch)
+	data, err := marshalVoteEvent(event, scratch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zw := getGzipWriter(buf)
+	defer gzipWriterPool.Put(zw)
+	if _, err := zw.Write(data); err != nil {
+		return nil, nil, fmt.Errorf("压缩投票事件失败: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("压缩投票事件失败: %w", err)
+	}
+	metrics.VoteEventBytes.WithLabelValues(encodingGzip).Add(float64(buf.Len()))
+	return buf.Bytes(), schemaV2GzipHeaders, nil
+}
+
+// encodeVoteEventProtobuf 以版本3的Protobuf格式序列化投票事件，用户名数量达到kafka.compress_min_usernames时压缩
+func encodeVoteEventProtobuf(event *model.VoteEvent, buf *bytes.Buffer) ([]byte, []kafka.Header, error) {
+	minUsernames := config.AppConfig.Kafka.CompressMinUsernames
+	if minUsernames <= 0 || len(event.Usernames) < minUsernames {
+		buf.Write(schema.AppendVoteEvent(buf.AvailableBuffer(), event))
+		metrics.VoteEventBytes.WithLabelValues(encodingProtobuf).Add(float64(buf.Len()))
+		return buf.Bytes(), schemaV3Headers, nil
+	}
+
+	scratch := getBuffer()
+	defer putBuffer(scratch)
+	scratch.Write(schema.AppendVoteEvent(scratch.AvailableBuffer(), event))
+
+	zw := getGzipWriter(buf)
+	defer gzipWriterPool.Put(zw)
+	if _, err := zw.Write(scratch.Bytes()); err != nil {
+		return nil, nil, fmt.Errorf("压缩投票事件失败: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("压缩投票事件失败: %w", err)
+	}
+	metrics.VoteEventBytes.WithLabelValues(encodingGzip).Add(float64(buf.Len()))
+	return buf.Bytes(), schemaV3GzipHeaders, nil
+}
+
+// marshalVoteEvent 把投票事件以JSON写入buf，结果与json.Marshal相同
+func marshalVoteEvent(event *model.VoteEvent, buf *bytes.Buffer) ([]byte, error) {
+	if err := json.NewEncoder(buf).Encode(event); err != nil {
+		return nil, fmt.Errorf("序列化投票事件失败: %w", err)
+	}
+	// Encode在末尾追加了换行
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// decodeVoteEvent 按消息头解析投票事件，没有版本头的消息按版本1处理，版本3的消息体为Protobuf
+// 消息体中本实例不认识的字段被忽略，新版本只能向事件追加字段，不能修改已有字段的含义
+func decodeVoteEvent(m kafka.Message) (*model.VoteEvent, error) {
+	version := SchemaVersionJSON
+	encoding := encodingJSON
+	for _, h := range m.Headers {
+		switch h.Key {
+		case headerSchemaVersion:
+			v, err := strconv.Atoi(string(h.Value))
+			if err != nil {
+				return nil, fmt.Errorf("投票事件格式版本无效: %q", h.Value)
+			}
+			version = v
+		case headerContentEncoding:
+			encoding = string(h.Value)
+		}
+	}
+	if version < minSupportedSchemaVersion || version > supportedSchemaVersion {
+		return nil, fmt.Errorf("不支持的投票事件格式版本 %d，本实例支持 %d 到 %d",
+			version, minSupportedSchemaVersion, supportedSchemaVersion)
+	}
+
+	data := m.Value
+	switch encoding {
+	case encodingJSON:
+	case encodingGzip:
+		// 解压到复用的缓冲区，json.Unmarshal和Protobuf解析都会复制字符串，解析后即可归还
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if err := gunzip(buf, m.Value); err != nil {
+			return nil, fmt.Errorf("解压投票事件失败: %w", err)
+		}
+		data = buf.Bytes()
+	default:
+		return nil, fmt.Errorf("不支持的投票事件编码: %s", encoding)
+	}
+
+	if version >= SchemaVersionProtobuf {
+		return schema.UnmarshalVoteEvent(data)
+	}
+	var event model.VoteEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// gunzip 把gzip压缩的数据解压到buf
+func gunzip(buf *bytes.Buffer, compressed []byte) error {
+	zr, err := getGzipReader(bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	defer gzipReaderPool.Put(zr)
+	if _, err := buf.ReadFrom(zr); err != nil {
+		return err
+	}
+	return zr.Close()
+}
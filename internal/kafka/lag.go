@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// lagRequestTimeout 查询分区和偏移量的单个请求的超时
+const lagRequestTimeout = 10 * time.Second
+
+// consumedTopic 一个计票主题及消费它的消费者组，groupID为空时为静态分配模式
+type consumedTopic struct {
+	topic   string
+	groupID string
+}
+
+// consumedTopics 集群内所有实例计票消费的主题，与本实例的kafka.consume_topics无关
+func consumedTopics() []consumedTopic {
+	groupID := config.AppConfig.Kafka.GroupID
+	if consumerMode() == ConsumerModePartition {
+		groupID = ""
+	}
+	topics := []consumedTopic{{topic: config.AppConfig.Kafka.Topic, groupID: groupID}}
+	for _, pt := range pollTopics() {
+		topics = append(topics, consumedTopic{topic: pt.topic, groupID: pt.groupID})
+	}
+	return topics
+}
+
+// GroupLag 查询所有计票主题在各分区上的消费积压，覆盖整个集群而不只是本实例的Reader
+// 消费者组模式以组提交的偏移量为准；静态分配模式不向Kafka提交偏移量，以offsets中已落库的偏移量为准，offsets为nil时不统计
+func GroupLag(ctx context.Context, offsets OffsetStore) ([]*model.PartitionLag, error) {
+	client := &kafka.Client{Addr: kafka.TCP(config.AppConfig.Kafka.Brokers...), Timeout: lagRequestTimeout}
+
+	var lags []*model.PartitionLag
+	for _, ct := range consumedTopics() {
+		if ct.groupID == "" && offsets == nil {
+			continue
+		}
+		topicLags, err := topicLag(ctx, client, ct, offsets)
+		if err != nil {
+			return nil, fmt.Errorf("查询主题 %s 的消费积压失败: %w", ct.topic, err)
+		}
+		lags = append(lags, topicLags...)
+	}
+	return lags, nil
+}
+
+func topicLag(ctx context.Context, client *kafka.Client, ct consumedTopic, offsets OffsetStore) ([]*model.PartitionLag, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{ct.topic}})
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata.Topics) == 0 {
+		return nil, fmt.Errorf("主题不存在")
+	}
+	if metadata.Topics[0].Error != nil {
+		return nil, metadata.Topics[0].Error
+	}
+	partitions := make([]int, 0, len(metadata.Topics[0].Partitions))
+	requests := make([]kafka.OffsetRequest, 0, 2*len(metadata.Topics[0].Partitions))
+	for _, p := range metadata.Topics[0].Partitions {
+		partitions = append(partitions, p.ID)
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+	sort.Ints(partitions)
+
+	listed, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{ct.topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+	bounds := make(map[int]kafka.PartitionOffsets, len(partitions))
+	for _, p := range listed.Topics[ct.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("查询分区 %d 的偏移量失败: %w", p.Partition, p.Error)
+		}
+		bounds[p.Partition] = p
+	}
+
+	committed, err := committedOffsets(ctx, client, ct, partitions, offsets)
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]*model.PartitionLag, 0, len(partitions))
+	for _, partition := range partitions {
+		lag := &model.PartitionLag{
+			Topic:     ct.topic,
+			GroupID:   ct.groupID,
+			Partition: partition,
+			Committed: -1,
+			End:       bounds[partition].LastOffset,
+		}
+		// 没有提交过偏移量的分区从最早的消息开始消费，已过期删除的消息不计入积压
+		next := bounds[partition].FirstOffset
+		if offset, ok := committed[partition]; ok && offset >= 0 {
+			lag.Committed = offset
+			next = max(offset, next)
+		}
+		lag.Lag = max(lag.End-next, 0)
+		lags = append(lags, lag)
+	}
+	return lags, nil
+}
+
+// committedOffsets 各分区下一条待消费消息的偏移量，没有记录的分区不在结果中
+func committedOffsets(ctx context.Context, client *kafka.Client, ct consumedTopic, partitions []int, offsets OffsetStore) (map[int]int64, error) {
+	committed := make(map[int]int64, len(partitions))
+	if ct.groupID == "" {
+		stored, err := offsets.GetConsumerOffsets(ct.topic)
+		if err != nil {
+			return nil, fmt.Errorf("查询已落库的偏移量失败: %w", err)
+		}
+		// consumer_offsets记录的是最后一条已落库消息的偏移量
+		for partition, offset := range stored {
+			committed[partition] = offset + 1
+		}
+		return committed, nil
+	}
+
+	fetched, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: ct.groupID,
+		Topics:  map[string][]int{ct.topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询消费者组 %s 的偏移量失败: %w", ct.groupID, err)
+	}
+	if fetched.Error != nil {
+		return nil, fmt.Errorf("查询消费者组 %s 的偏移量失败: %w", ct.groupID, fetched.Error)
+	}
+	for _, p := range fetched.Topics[ct.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("查询分区 %d 已提交的偏移量失败: %w", p.Partition, p.Error)
+		}
+		committed[p.Partition] = p.CommittedOffset
+	}
+	return committed, nil
+}
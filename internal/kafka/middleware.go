@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/segmentio/kafka-go"
+)
+
+// Delivery 一条待处理的投票事件及其来源
+type Delivery struct {
+	Event     *model.VoteEvent
+	WorkerID  int
+	Partition int
+	Offset    int64
+	Message   kafka.Message // 原始消息，写入死信主题时原样保留
+}
+
+// Handler 处理一条投票事件，ctx在消费者停止时取消
+type Handler func(ctx context.Context, d *Delivery) error
+
+// Middleware 包装Handler，在处理前后附加日志、指标、重试等通用逻辑
+type Middleware func(next Handler) Handler
+
+// Chain 依次用middlewares包装核心处理函数，第一个中间件在最外层
+func Chain(handler MessageHandler, middlewares ...Middleware) Handler {
+	h := func(ctx context.Context, d *Delivery) error {
+		return handler(ctx, d.Event)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// DefaultMiddlewares 计票消费者默认的中间件：日志、指标、慢事件追踪、可重试错误的退避重试和重复事件过滤
+func DefaultMiddlewares(logger *slog.Logger) []Middleware {
+	cfg := config.AppConfig.Kafka
+	return []Middleware{
+		Logging(logger),
+		Metrics(),
+		Tracing(logger, cfg.ConsumerSlowThreshold),
+		Retry(logger),
+		Dedupe(cfg.ConsumerDedupeSize),
+	}
+}
+
+// Logging 记录最终处理失败的事件，可重试的失败由Retry记录
+func Logging(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, d *Delivery) error {
+			err := next(ctx, d)
+			if err != nil && ctx.Err() == nil {
+				logger.ErrorContext(ctx, "消费者处理投票事件失败", "worker", d.WorkerID, "event_id", d.Event.EventID,
+					"partition", d.Partition, "offset", d.Offset, "error", err)
+			}
+			return err
+		}
+	}
+}
+
+// Metrics 按处理结果统计事件数和处理耗时，耗时包含重试等待
+func Metrics() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, d *Delivery) error {
+			start := time.Now()
+			err := next(ctx, d)
+			result := "ok"
+			if err != nil {
+				result = "failed"
+			}
+			metrics.ConsumerEvents.WithLabelValues(result).Inc()
+			metrics.ConsumerHandleDuration.Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// Tracing 处理耗时超过threshold时记录事件的来源和耗时，便于定位慢事件，threshold为0时不记录
+func Tracing(logger *slog.Logger, threshold time.Duration) Middleware {
+	return func(next Handler) Handler {
+		if threshold <= 0 {
+			return next
+		}
+		return func(ctx context.Context, d *Delivery) error {
+			start := time.Now()
+			err := next(ctx, d)
+			if elapsed := time.Since(start); elapsed >= threshold {
+				logger.WarnContext(ctx, "消费者处理投票事件较慢", "worker", d.WorkerID, "elapsed", elapsed.Round(time.Millisecond),
+					"event_id", d.Event.EventID, "poll_id", d.Event.PollID, "usernames", len(d.Event.Usernames),
+					"partition", d.Partition, "offset", d.Offset)
+			}
+			return err
+		}
+	}
+}
+
+// Retry 可重试的失败（如数据库不可用）退避后重试，消息保留在本线程中不被跳过，直到成功、不可重试或消费者停止
+func Retry(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, d *Delivery) error {
+			backoff := retryInitialBackoff
+			for {
+				err := next(ctx, d)
+				if err == nil || !errors.Is(err, ErrRetryable) {
+					return err
+				}
+
+				logger.WarnContext(ctx, "消费者处理投票事件失败，退避后重试", "worker", d.WorkerID, "event_id", d.Event.EventID,
+					"backoff", backoff, "error", err)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(backoff):
+				}
+
+				backoff *= 2
+				if backoff > retryMaxBackoff {
+					backoff = retryMaxBackoff
+				}
+			}
+		}
+	}
+}
+
+// Dedupe 跳过本实例最近成功处理过的事件，减少消息重投时对数据库的重复写入；size为记住的事件数，为0时不过滤
+// 只是优化，事件仍由数据库按(eventId, index)去重；没有eventId的旧事件不过滤
+func Dedupe(size int) Middleware {
+	return func(next Handler) Handler {
+		if size <= 0 {
+			return next
+		}
+		seen := newRecentSet(size)
+		return func(ctx context.Context, d *Delivery) error {
+			if d.Event.EventID == "" {
+				return next(ctx, d)
+			}
+			key := d.Event.EventID + ":" + strconv.Itoa(d.Event.Index)
+			if seen.contains(key) {
+				metrics.ConsumerDuplicatesSkipped.Inc()
+				return nil
+			}
+			if err := next(ctx, d); err != nil {
+				return err
+			}
+			seen.add(key)
+			return nil
+		}
+	}
+}
+
+// recentSet 容量固定的集合，满后淘汰最早加入的元素，在所有消费者线程间共享
+type recentSet struct {
+	mu    sync.Mutex
+	keys  map[string]struct{}
+	order []string
+	next  int
+}
+
+func newRecentSet(size int) *recentSet {
+	return &recentSet{
+		keys:  make(map[string]struct{}, size),
+		order: make([]string, size),
+	}
+}
+
+func (s *recentSet) contains(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *recentSet) add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; ok {
+		return
+	}
+	if evicted := s.order[s.next]; evicted != "" {
+		delete(s.keys, evicted)
+	}
+	s.order[s.next] = key
+	s.keys[key] = struct{}{}
+	s.next = (s.next + 1) % len(s.order)
+}
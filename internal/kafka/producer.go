@@ -1,25 +1,42 @@
 package kafka
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
 	"github.com/lvdashuaibi/littlevote/internal/model"
 	"github.com/segmentio/kafka-go"
 )
 
+// 投票事件的分区策略
+const (
+	KeyStrategyUsername      = "username"       // 按第一个用户名分区
+	KeyStrategyTicketVersion = "ticket_version" // 按票据版本分区
+	KeyStrategyRoundRobin    = "round_robin"    // 轮询分区，不使用消息Key
+)
+
 type Producer struct {
 	writer         *kafka.Writer
+	keyStrategy    string
+	fanOut         bool
 	ctx            context.Context
 	partitionCount int // 主题的分区数量
 }
 
-func NewProducer() (*Producer, error) {
+func NewProducer(logger *slog.Logger) (*Producer, error) {
+	logger = logging.Component(logger, "producer")
 	ctx := context.Background()
+	if err := validatePollTopics(); err != nil {
+		return nil, err
+	}
+	if err := validateSchemaVersion(); err != nil {
+		return nil, err
+	}
 
 	// 获取分区数量
 	conn, err := kafka.DialLeader(ctx, "tcp", config.AppConfig.Kafka.Brokers[0], config.AppConfig.Kafka.Topic, 0)
@@ -40,55 +57,154 @@ func NewProducer() (*Producer, error) {
 		}
 	}
 
-	log.Printf("生产者检测到Kafka主题 %s 有 %d 个分区", config.AppConfig.Kafka.Topic, topicPartitions)
+	logger.Info("生产者检测到Kafka主题的分区", "topic", config.AppConfig.Kafka.Topic, "partitions", topicPartitions)
+
+	keyStrategy := config.AppConfig.Kafka.KeyStrategy
+	if keyStrategy == "" {
+		keyStrategy = KeyStrategyUsername
+	}
+
+	// 按Key分区的策略使用Hash分区器，轮询策略使用RoundRobin分区器
+	var balancer kafka.Balancer
+	switch keyStrategy {
+	case KeyStrategyUsername, KeyStrategyTicketVersion:
+		balancer = &kafka.Hash{}
+	case KeyStrategyRoundRobin:
+		balancer = &kafka.RoundRobin{}
+	default:
+		return nil, fmt.Errorf("不支持的分区策略: %s", keyStrategy)
+	}
+	logger.Info("投票事件分区策略", "key_strategy", keyStrategy)
 
-	// 使用Hash分区器，基于消息Key进行分区路由
+	// 主题由每条消息按投票活动指定，配置了专属主题的活动写入专属主题
 	writer := &kafka.Writer{
 		Addr:     kafka.TCP(config.AppConfig.Kafka.Brokers...),
-		Topic:    config.AppConfig.Kafka.Topic,
-		Balancer: &kafka.Hash{}, // 使用基于消息Key的Hash分区器
+		Balancer: balancer,
 	}
 
 	return &Producer{
 		writer:         writer,
+		keyStrategy:    keyStrategy,
+		fanOut:         config.AppConfig.Kafka.FanOut,
 		ctx:            ctx,
 		partitionCount: topicPartitions,
 	}, nil
 }
 
-// SendVoteEvent 发送投票事件到Kafka
+// Pending 返回尚未写入Kafka的投票事件数
+func (p *Producer) Pending() int64 {
+	return p.writer.Stats().QueueLength
+}
+
+// SendVoteEvent 发送投票事件到Kafka，拆分模式下每个用户一条消息
 func (p *Producer) SendVoteEvent(event *model.VoteEvent) error {
-	data, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("序列化投票事件失败: %w", err)
-	}
+	return p.SendVoteEvents([]*model.VoteEvent{event})
+}
 
-	// 使用username作为分区key，确保相同用户的投票事件进入同一分区
-	// 如果有多个username，选择第一个作为路由key
-	var key []byte
-	if len(event.Usernames) > 0 {
-		key = []byte(event.Usernames[0])
-	} else {
-		key = []byte(event.TicketVersion)
+// SendVoteEvents 一次写入多个投票事件，拆分模式下每个用户一条消息
+func (p *Producer) SendVoteEvents(voteEvents []*model.VoteEvent) error {
+	var events []*model.VoteEvent
+	for _, event := range voteEvents {
+		if p.fanOut && len(event.Usernames) > 1 {
+			events = append(events, splitVoteEvent(event)...)
+		} else {
+			events = append(events, event)
+		}
 	}
 
-	// 创建Kafka消息
-	msg := kafka.Message{
-		Key:   key,
-		Value: data,
-		Time:  time.Now(),
+	// 消息体和消息切片来自池，同步模式下p.ctx不会取消，WriteMessages返回时所有批次都已结束，kafka-go不再引用它们
+	now := time.Now()
+	msgs := getMessages()
+	defer putMessages(msgs)
+	bufs := make([]*bytes.Buffer, 0, len(events))
+	defer func() {
+		for _, buf := range bufs {
+			putBuffer(buf)
+		}
+	}()
+	for _, e := range events {
+		buf := getBuffer()
+		bufs = append(bufs, buf)
+		data, headers, err := encodeVoteEvent(e, buf)
+		if err != nil {
+			return err
+		}
+
+		// 创建Kafka消息
+		*msgs = append(*msgs, kafka.Message{
+			Topic:   TopicForPoll(e.PollID),
+			Key:     p.messageKey(e),
+			Value:   data,
+			Headers: headers,
+			Time:    now,
+		})
 	}
 
-	// 发送消息
-	if err := p.writer.WriteMessages(p.ctx, msg); err != nil {
+	// 发送消息，部分失败时调用方会整体重试，已写入的部分由消费端按(eventId, index)去重
+	if err := p.writer.WriteMessages(p.ctx, *msgs...); err != nil {
 		return fmt.Errorf("发送投票事件失败: %w", err)
 	}
 
-	//log.Printf("已发送投票事件: 路由键=%s, 票据版本=%s, 用户数=%d",
-	//	string(key), event.TicketVersion, len(event.Usernames))
+	//log.Printf("已发送投票事件: 票据版本=%s, 用户数=%d, 消息数=%d",
+	//	event.TicketVersion, len(event.Usernames), len(msgs))
 	return nil
 }
 
+// splitVoteEvent 把多用户投票拆分为每个用户一条事件，共享eventId并以index标识用户在原投票中的序号
+func splitVoteEvent(event *model.VoteEvent) []*model.VoteEvent {
+	events := make([]*model.VoteEvent, len(event.Usernames))
+	for i, username := range event.Usernames {
+		part := *event
+		part.Index = event.Index + i
+		part.Usernames = []string{username}
+		events[i] = &part
+	}
+	return events
+}
+
+// messageKey 按分区策略计算消息Key
+func (p *Producer) messageKey(event *model.VoteEvent) []byte {
+	switch p.keyStrategy {
+	case KeyStrategyRoundRobin:
+		return nil
+	case KeyStrategyTicketVersion:
+		return []byte(event.TicketVersion)
+	default:
+		// 使用username作为分区key，确保相同用户的投票事件进入同一分区
+		// 如果有多个username，选择第一个作为路由key
+		if len(event.Usernames) > 0 {
+			return []byte(event.Usernames[0])
+		}
+		// 撤销投票的补偿事件按被撤销投票的用户分区
+		if event.Retraction != nil {
+			return []byte(event.Retraction.Username)
+		}
+		return []byte(event.TicketVersion)
+	}
+}
+
+// Ping 检查Kafka集群是否可达，任一broker能建立连接并返回集群元数据即视为可达
+func (p *Producer) Ping(ctx context.Context) error {
+	lastErr := fmt.Errorf("未配置Kafka broker")
+	for _, broker := range config.AppConfig.Kafka.Brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			lastErr = fmt.Errorf("连接Kafka broker %s 失败: %w", broker, err)
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		_, err = conn.Brokers()
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+		lastErr = fmt.Errorf("读取Kafka broker %s 元数据失败: %w", broker, err)
+	}
+	return lastErr
+}
+
 // Close 关闭Kafka生产者
 func (p *Producer) Close() error {
 	return p.writer.Close()
@@ -0,0 +1,299 @@
+// Package schema 投票事件在Kafka中的Protobuf消息格式，定义见vote_event.proto
+// 编解码基于protowire按proto文件手写，直接追加到生产者复用的缓冲区，不经过反射；修改字段时同步修改proto文件
+package schema
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// VoteEvent的字段编号，与vote_event.proto一致
+const (
+	fieldEventID        protowire.Number = 1
+	fieldIndex          protowire.Number = 2
+	fieldPollID         protowire.Number = 3
+	fieldUsernames      protowire.Number = 4
+	fieldTicketVersion  protowire.Number = 5
+	fieldAudit          protowire.Number = 6
+	fieldVotedAt        protowire.Number = 7
+	fieldIdempotencyKey protowire.Number = 8
+	fieldTicketConsumed protowire.Number = 9
+	fieldShadow         protowire.Number = 10
+	fieldRetraction     protowire.Number = 11
+)
+
+// VoteAudit、VoteRetraction和google.protobuf.Timestamp的字段编号
+const (
+	fieldAuditActor     protowire.Number = 1
+	fieldAuditSourceIP  protowire.Number = 2
+	fieldAuditUserAgent protowire.Number = 3
+	fieldAuditRequestID protowire.Number = 4
+
+	fieldRetractionVoteLogID protowire.Number = 1
+	fieldRetractionUsername  protowire.Number = 2
+
+	fieldTimestampSeconds protowire.Number = 1
+	fieldTimestampNanos   protowire.Number = 2
+)
+
+// AppendVoteEvent 把投票事件按Protobuf编码追加到b并返回追加后的切片，与proto3一样省略零值字段
+// 只在消费者本地使用的Source不编码
+func AppendVoteEvent(b []byte, event *model.VoteEvent) []byte {
+	b = appendString(b, fieldEventID, event.EventID)
+	if event.Index != 0 {
+		b = protowire.AppendTag(b, fieldIndex, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(event.Index)))
+	}
+	b = appendString(b, fieldPollID, event.PollID)
+	for _, username := range event.Usernames {
+		// repeated字段的空字符串也要编码，否则会丢失元素
+		b = protowire.AppendTag(b, fieldUsernames, protowire.BytesType)
+		b = protowire.AppendString(b, username)
+	}
+	b = appendString(b, fieldTicketVersion, event.TicketVersion)
+
+	if size := auditSize(&event.Audit); size > 0 {
+		b = protowire.AppendTag(b, fieldAudit, protowire.BytesType)
+		b = protowire.AppendVarint(b, uint64(size))
+		b = appendString(b, fieldAuditActor, event.Audit.Actor)
+		b = appendString(b, fieldAuditSourceIP, event.Audit.SourceIP)
+		b = appendString(b, fieldAuditUserAgent, event.Audit.UserAgent)
+		b = appendString(b, fieldAuditRequestID, event.Audit.RequestID)
+	}
+
+	if !event.VotedAt.IsZero() {
+		seconds, nanos := event.VotedAt.Unix(), int64(event.VotedAt.Nanosecond())
+		b = protowire.AppendTag(b, fieldVotedAt, protowire.BytesType)
+		b = protowire.AppendVarint(b, uint64(varintFieldSize(fieldTimestampSeconds, seconds)+varintFieldSize(fieldTimestampNanos, nanos)))
+		b = appendVarintField(b, fieldTimestampSeconds, seconds)
+		b = appendVarintField(b, fieldTimestampNanos, nanos)
+	}
+
+	b = appendString(b, fieldIdempotencyKey, event.IdempotencyKey)
+	b = appendBool(b, fieldTicketConsumed, event.TicketConsumed)
+	b = appendBool(b, fieldShadow, event.Shadow)
+
+	if r := event.Retraction; r != nil {
+		b = protowire.AppendTag(b, fieldRetraction, protowire.BytesType)
+		b = protowire.AppendVarint(b, uint64(varintFieldSize(fieldRetractionVoteLogID, r.VoteLogID)+stringFieldSize(fieldRetractionUsername, r.Username)))
+		b = appendVarintField(b, fieldRetractionVoteLogID, r.VoteLogID)
+		b = appendString(b, fieldRetractionUsername, r.Username)
+	}
+	return b
+}
+
+// UnmarshalVoteEvent 解析Protobuf编码的投票事件，返回的事件不引用data
+// 本实例不认识的字段被跳过，新版本追加的字段不影响旧版本的消费者
+func UnmarshalVoteEvent(data []byte) (*model.VoteEvent, error) {
+	var event model.VoteEvent
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch num {
+		case fieldEventID:
+			return consumeString(typ, data, &event.EventID)
+		case fieldIndex:
+			var index int64
+			n := consumeInt64(typ, data, &index)
+			event.Index = int(index)
+			return n
+		case fieldPollID:
+			return consumeString(typ, data, &event.PollID)
+		case fieldUsernames:
+			var username string
+			n := consumeString(typ, data, &username)
+			if n > 0 {
+				event.Usernames = append(event.Usernames, username)
+			}
+			return n
+		case fieldTicketVersion:
+			return consumeString(typ, data, &event.TicketVersion)
+		case fieldAudit:
+			return consumeMessage(typ, data, func(msg []byte) error {
+				return unmarshalAudit(msg, &event.Audit)
+			})
+		case fieldVotedAt:
+			return consumeMessage(typ, data, func(msg []byte) error {
+				votedAt, err := unmarshalTimestamp(msg)
+				event.VotedAt = votedAt
+				return err
+			})
+		case fieldIdempotencyKey:
+			return consumeString(typ, data, &event.IdempotencyKey)
+		case fieldTicketConsumed:
+			return consumeBool(typ, data, &event.TicketConsumed)
+		case fieldShadow:
+			return consumeBool(typ, data, &event.Shadow)
+		case fieldRetraction:
+			return consumeMessage(typ, data, func(msg []byte) error {
+				event.Retraction = &model.VoteRetraction{}
+				return unmarshalRetraction(msg, event.Retraction)
+			})
+		}
+		return 0
+	})
+	if err != nil {
+		return nil, fmt.Errorf("解析投票事件失败: %w", err)
+	}
+	return &event, nil
+}
+
+func unmarshalAudit(data []byte, audit *model.VoteAudit) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch num {
+		case fieldAuditActor:
+			return consumeString(typ, data, &audit.Actor)
+		case fieldAuditSourceIP:
+			return consumeString(typ, data, &audit.SourceIP)
+		case fieldAuditUserAgent:
+			return consumeString(typ, data, &audit.UserAgent)
+		case fieldAuditRequestID:
+			return consumeString(typ, data, &audit.RequestID)
+		}
+		return 0
+	})
+}
+
+func unmarshalRetraction(data []byte, retraction *model.VoteRetraction) error {
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch num {
+		case fieldRetractionVoteLogID:
+			return consumeInt64(typ, data, &retraction.VoteLogID)
+		case fieldRetractionUsername:
+			return consumeString(typ, data, &retraction.Username)
+		}
+		return 0
+	})
+}
+
+func unmarshalTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, data []byte) int {
+		switch num {
+		case fieldTimestampSeconds:
+			return consumeInt64(typ, data, &seconds)
+		case fieldTimestampNanos:
+			return consumeInt64(typ, data, &nanos)
+		}
+		return 0
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, nanos), nil
+}
+
+// consumeFields 依次解析data中的字段，field返回已解析的字节数，返回0表示不认识该字段，跳过
+func consumeFields(data []byte, field func(num protowire.Number, typ protowire.Type, data []byte) int) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		n = field(num, typ, data)
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("字段 %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// consumeString 等函数解析一个字段的值，线路类型与定义不符时返回0，按未知字段跳过
+func consumeString(typ protowire.Type, data []byte, dst *string) int {
+	if typ != protowire.BytesType {
+		return 0
+	}
+	v, n := protowire.ConsumeString(data)
+	if n >= 0 {
+		*dst = v
+	}
+	return n
+}
+
+func consumeInt64(typ protowire.Type, data []byte, dst *int64) int {
+	if typ != protowire.VarintType {
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(data)
+	if n >= 0 {
+		*dst = int64(v)
+	}
+	return n
+}
+
+func consumeBool(typ protowire.Type, data []byte, dst *bool) int {
+	if typ != protowire.VarintType {
+		return 0
+	}
+	v, n := protowire.ConsumeVarint(data)
+	if n >= 0 {
+		*dst = protowire.DecodeBool(v)
+	}
+	return n
+}
+
+func consumeMessage(typ protowire.Type, data []byte, unmarshal func([]byte) error) int {
+	if typ != protowire.BytesType {
+		return 0
+	}
+	msg, n := protowire.ConsumeBytes(data)
+	if n < 0 {
+		return n
+	}
+	if err := unmarshal(msg); err != nil {
+		return -1
+	}
+	return n
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendVarintField(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+func stringFieldSize(num protowire.Number, s string) int {
+	if s == "" {
+		return 0
+	}
+	return protowire.SizeTag(num) + protowire.SizeBytes(len(s))
+}
+
+func varintFieldSize(num protowire.Number, v int64) int {
+	if v == 0 {
+		return 0
+	}
+	return protowire.SizeTag(num) + protowire.SizeVarint(uint64(v))
+}
+
+func auditSize(audit *model.VoteAudit) int {
+	return stringFieldSize(fieldAuditActor, audit.Actor) +
+		stringFieldSize(fieldAuditSourceIP, audit.SourceIP) +
+		stringFieldSize(fieldAuditUserAgent, audit.UserAgent) +
+		stringFieldSize(fieldAuditRequestID, audit.RequestID)
+}
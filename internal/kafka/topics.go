@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// defaultPollWorkers 专属主题未配置workers时本实例的消费并发数
+const defaultPollWorkers = 8
+
+// pollTopic 一个投票活动的专属主题
+type pollTopic struct {
+	pollID  string
+	topic   string
+	groupID string
+	workers int
+}
+
+// TopicForPoll 返回投票活动的投票事件写入的主题，未配置专属主题的活动使用默认主题
+func TopicForPoll(pollID string) string {
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+	if cfg, ok := config.AppConfig.Kafka.Polls[pollID]; ok && cfg.Topic != "" {
+		return cfg.Topic
+	}
+	return config.AppConfig.Kafka.Topic
+}
+
+// AllTopics 返回默认主题和所有专属主题
+func AllTopics() []string {
+	topics := []string{config.AppConfig.Kafka.Topic}
+	for _, pt := range pollTopics() {
+		topics = append(topics, pt.topic)
+	}
+	return topics
+}
+
+// pollTopics 按投票活动ID排序返回配置的专属主题
+func pollTopics() []pollTopic {
+	cfg := config.AppConfig.Kafka
+	topics := make([]pollTopic, 0, len(cfg.Polls))
+	for pollID, pollCfg := range cfg.Polls {
+		if pollCfg.Topic == "" {
+			continue
+		}
+		pt := pollTopic{
+			pollID:  pollID,
+			topic:   pollCfg.Topic,
+			groupID: pollCfg.GroupID,
+			workers: pollCfg.Workers,
+		}
+		if pt.groupID == "" {
+			pt.groupID = cfg.GroupID + "-" + pollID
+		}
+		if pt.workers <= 0 {
+			pt.workers = defaultPollWorkers
+		}
+		topics = append(topics, pt)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].pollID < topics[j].pollID })
+	return topics
+}
+
+// validatePollTopics 专属主题不能与默认主题或其他活动的专属主题相同，否则事件会被多个消费者组重复计票
+func validatePollTopics() error {
+	seen := map[string]string{config.AppConfig.Kafka.Topic: ""}
+	for _, pt := range pollTopics() {
+		if other, ok := seen[pt.topic]; ok {
+			if other == "" {
+				return fmt.Errorf("投票活动 %s 的专属主题 %s 与默认主题相同", pt.pollID, pt.topic)
+			}
+			return fmt.Errorf("投票活动 %s 和 %s 使用了相同的专属主题 %s", other, pt.pollID, pt.topic)
+		}
+		seen[pt.topic] = pt.pollID
+	}
+	return nil
+}
+
+// consumesTopic 本实例的计票消费者是否消费该主题
+func consumesTopic(topic string) bool {
+	consumeTopics := config.AppConfig.Kafka.ConsumeTopics
+	if len(consumeTopics) == 0 {
+		return true
+	}
+	for _, t := range consumeTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+)
+
+// errLeadershipLost 选举键已不由本参与者的会话持有
+var errLeadershipLost = errors.New("选举键已被释放或转移")
+
+// ConsulElection 基于Consul会话和KV acquire的领导者选举
+// 以会话acquire选举键成功的参与者为领导者，其会话失效后Consul释放选举键，其他参与者通过阻塞查询感知后重新竞选
+type ConsulElection struct {
+	lock   *ConsulLock
+	name   string
+	key    string
+	logger *slog.Logger
+}
+
+// NewElection 创建使用该Consul客户端的领导者选举
+func (cl *ConsulLock) NewElection(name string, logger *slog.Logger) Election {
+	return &ConsulElection{
+		lock:   cl,
+		name:   name,
+		key:    cl.prefix + "elections/" + name,
+		logger: logging.Component(logger, "election").With("election", name),
+	}
+}
+
+// Run 异步参与选举，失去领导者身份或选举出错后等待electionRetryInterval重新参与
+func (e *ConsulElection) Run(ctx context.Context, onGained, onLost func()) {
+	go func() {
+		for ctx.Err() == nil {
+			err := e.campaign(ctx, onGained, onLost)
+			if err == nil {
+				return
+			}
+			e.logger.Warn("参与选举失败，稍后重试", "error", err)
+
+			select {
+			case <-time.After(electionRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// campaign 参与一轮选举，阻塞到失去领导者身份或ctx结束，ctx结束时主动让出并返回nil
+func (e *ConsulElection) campaign(ctx context.Context, onGained, onLost func()) error {
+	sessionID, err := e.lock.createSession(ctx, "election:"+e.name)
+	if err != nil {
+		return err
+	}
+
+	// 会话续期不绑定ctx，ctx结束后仍能通过会话让出领导者身份；停止续期时Consul销毁会话
+	stopRenew := make(chan struct{})
+	renewed := make(chan error, 1)
+	go func() {
+		renewed <- e.lock.client.Session().RenewPeriodic(e.lock.sessionTTL.String(), sessionID, nil, stopRenew)
+	}()
+	defer close(stopRenew)
+
+	pair := &api.KVPair{Key: e.key, Value: []byte(e.lock.holder), Session: sessionID}
+	if err := e.acquire(ctx, pair, renewed); err != nil || ctx.Err() != nil {
+		return err
+	}
+
+	e.logger.Info("已当选领导者", "holder", e.lock.holder)
+	onGained()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lost := make(chan error, 1)
+	go func() {
+		lost <- e.watchLeadership(watchCtx, sessionID)
+	}()
+
+	select {
+	case err := <-renewed:
+		e.logger.Warn("选举会话已失效，失去领导者身份", "holder", e.lock.holder, "error", err)
+		onLost()
+		return errSessionExpired
+	case err := <-lost:
+		if ctx.Err() == nil {
+			e.logger.Warn("失去领导者身份", "holder", e.lock.holder, "error", err)
+			onLost()
+			return err
+		}
+	case <-ctx.Done():
+	}
+
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), e.lock.requestTimeout())
+	if _, _, err := e.lock.client.KV().Release(pair, (&api.WriteOptions{}).WithContext(releaseCtx)); err != nil {
+		e.logger.Warn("让出领导者身份失败，等待会话销毁", "error", err)
+	}
+	releaseCancel()
+	e.logger.Info("已让出领导者身份", "holder", e.lock.holder)
+	onLost()
+	return nil
+}
+
+// acquire 以会话竞争选举键，选举键被其他参与者持有时通过阻塞查询等待其释放，当选或ctx结束时返回nil
+func (e *ConsulElection) acquire(ctx context.Context, pair *api.KVPair, renewed <-chan error) error {
+	kv := e.lock.client.KV()
+	var index uint64
+	for {
+		acquired, _, err := kv.Acquire(pair, (&api.WriteOptions{}).WithContext(ctx))
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("竞选失败: %v", err)
+		}
+		if acquired {
+			return nil
+		}
+
+		select {
+		case err := <-renewed:
+			return fmt.Errorf("选举会话已失效: %v", err)
+		default:
+		}
+
+		current, meta, err := kv.Get(e.key, (&api.QueryOptions{WaitIndex: index, WaitTime: e.lock.sessionTTL}).WithContext(ctx))
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("查询选举 %s 当前领导者失败: %v", e.name, err)
+		}
+		index = meta.LastIndex
+
+		// 选举键没有持有者但获取失败时处于lock-delay期间，稍后重试
+		if current == nil || current.Session == "" {
+			select {
+			case <-time.After(electionRetryInterval):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// watchLeadership 通过阻塞查询监听选举键，选举键不再由sessionID持有时返回
+func (e *ConsulElection) watchLeadership(ctx context.Context, sessionID string) error {
+	kv := e.lock.client.KV()
+	var index uint64
+	for {
+		pair, meta, err := kv.Get(e.key, (&api.QueryOptions{WaitIndex: index}).WithContext(ctx))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// 查询失败不代表失去领导者身份，会话失效由续期协程感知
+			e.logger.Warn("查询选举键失败", "error", err)
+			select {
+			case <-time.After(electionRetryInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		if pair == nil || pair.Session != sessionID {
+			return errLeadershipLost
+		}
+		index = meta.LastIndex
+	}
+}
+
+// Observe 通过阻塞查询监听选举键，领导者变化时回调onChange
+func (e *ConsulElection) Observe(ctx context.Context, onChange func(leader string)) error {
+	kv := e.lock.client.KV()
+	pair, meta, err := kv.Get(e.key, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("获取选举 %s 当前领导者失败: %v", e.name, err)
+	}
+	leader := consulLeader(pair)
+	onChange(leader)
+
+	go func() {
+		index := meta.LastIndex
+		for ctx.Err() == nil {
+			pair, meta, err := kv.Get(e.key, (&api.QueryOptions{WaitIndex: index}).WithContext(ctx))
+			if err != nil {
+				select {
+				case <-time.After(electionRetryInterval):
+				case <-ctx.Done():
+				}
+				continue
+			}
+			index = meta.LastIndex
+			if next := consulLeader(pair); next != leader {
+				leader = next
+				onChange(leader)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// consulLeader 选举键由会话持有时返回其中的参与者标识，否则领导者为空
+func consulLeader(pair *api.KVPair) string {
+	if pair == nil || pair.Session == "" {
+		return ""
+	}
+	return string(pair.Value)
+}
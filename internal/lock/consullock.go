@@ -0,0 +1,276 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+)
+
+const (
+	defaultConsulSessionTTL     = 10 * time.Second // Consul允许的最小会话TTL
+	defaultConsulRequestTimeout = 10 * time.Second
+	defaultConsulKeyPrefix      = "littlevote/"
+)
+
+// ConsulLock 基于Consul会话和KV acquire/release实现的分布式锁
+// 每次获取锁创建一个绑定TTL的会话并以该会话acquire锁键，会话失效时Consul自动释放锁键
+type ConsulLock struct {
+	client     *api.Client
+	holder     string        // 写入锁键的持有者标识（实例ID）
+	prefix     string        // 锁和选举键的前缀
+	sessionTTL time.Duration // 会话TTL
+	lockDelay  time.Duration // 会话失效后锁键暂不可获取的时长
+	mu         sync.Mutex
+	handles    map[*consulHandle]struct{} // 尚未释放的锁句柄
+	logger     *slog.Logger
+}
+
+// consulHandle 一次成功获取的Consul锁，锁键绑定在独立的会话上
+type consulHandle struct {
+	lock        *ConsulLock
+	name        string
+	key         string
+	sessionID   string
+	stopRenew   chan struct{} // 关闭时停止自动续期
+	releaseOnce sync.Once
+	releaseErr  error
+	doneOnce    sync.Once
+	done        chan struct{}
+}
+
+// NewConsulLock 按consul配置创建分布式锁客户端
+func NewConsulLock(logger *slog.Logger) (*ConsulLock, error) {
+	cfg := config.AppConfig.Consul
+	apiCfg := api.DefaultConfig()
+	if cfg.Address != "" {
+		apiCfg.Address = cfg.Address
+	}
+	apiCfg.Token = cfg.Token
+	apiCfg.Datacenter = cfg.Datacenter
+
+	client, err := api.NewClient(apiCfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建Consul客户端失败: %v", err)
+	}
+
+	sessionTTL := cfg.SessionTTL
+	if sessionTTL < defaultConsulSessionTTL {
+		sessionTTL = defaultConsulSessionTTL
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultConsulKeyPrefix
+	}
+
+	return &ConsulLock{
+		client:     client,
+		holder:     strconv.Itoa(config.AppConfig.Server.InstanceID),
+		prefix:     prefix,
+		sessionTTL: sessionTTL,
+		lockDelay:  cfg.LockDelay,
+		handles:    make(map[*consulHandle]struct{}),
+		logger:     logging.Component(logger, "consullock"),
+	}, nil
+}
+
+func (cl *ConsulLock) AcquireLock(lockName string, timeout time.Duration) (LockHandle, error) {
+	handle, _, err := cl.AcquireLockWithToken(lockName, timeout)
+	return handle, err
+}
+
+// AcquireLockWithToken 获取锁并以acquire后锁键的ModifyIndex作为防护令牌，该索引为Raft日志索引，在整个集群内单调递增
+func (cl *ConsulLock) AcquireLockWithToken(lockName string, timeout time.Duration) (LockHandle, int64, error) {
+	key := cl.prefix + "locks/" + lockName
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sessionID, err := cl.createSession(ctx, lockName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 尝试获取锁
+	kv := cl.client.KV()
+	acquired, _, err := kv.Acquire(&api.KVPair{Key: key, Value: []byte(cl.holder), Session: sessionID},
+		(&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		cl.destroySession(sessionID)
+		return nil, 0, fmt.Errorf("获取锁 %s 失败: %v", lockName, err)
+	}
+	if !acquired {
+		cl.destroySession(sessionID)
+		return nil, 0, nil
+	}
+
+	// 读取获取锁时写入的索引作为防护令牌
+	pair, _, err := kv.Get(key, (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx))
+	if err != nil || pair == nil || pair.Session != sessionID {
+		cl.destroySession(sessionID)
+		if err == nil {
+			err = fmt.Errorf("锁键已被删除或转移")
+		}
+		return nil, 0, fmt.Errorf("读取锁 %s 的防护令牌失败: %v", lockName, err)
+	}
+
+	h := &consulHandle{
+		lock:      cl,
+		name:      lockName,
+		key:       key,
+		sessionID: sessionID,
+		stopRenew: make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	cl.mu.Lock()
+	cl.handles[h] = struct{}{}
+	cl.mu.Unlock()
+
+	go h.keepAlive()
+
+	return h, int64(pair.ModifyIndex), nil
+}
+
+// createSession 创建绑定TTL的会话，会话失效时释放其持有的锁键
+func (cl *ConsulLock) createSession(ctx context.Context, name string) (string, error) {
+	sessionID, _, err := cl.client.Session().Create(&api.SessionEntry{
+		Name:      name,
+		TTL:       cl.sessionTTL.String(),
+		LockDelay: cl.lockDelay,
+		Behavior:  api.SessionBehaviorRelease,
+	}, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("创建Consul会话失败: %v", err)
+	}
+	return sessionID, nil
+}
+
+// destroySession 销毁会话，会话持有的锁键随之释放
+func (cl *ConsulLock) destroySession(sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cl.requestTimeout())
+	defer cancel()
+	if _, err := cl.client.Session().Destroy(sessionID, (&api.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("销毁Consul会话失败: %v", err)
+	}
+	return nil
+}
+
+func (cl *ConsulLock) requestTimeout() time.Duration {
+	if timeout := config.AppConfig.Consul.RequestTimeout; timeout > 0 {
+		return timeout
+	}
+	return defaultConsulRequestTimeout
+}
+
+func (cl *ConsulLock) ReleaseAllLocks() {
+	cl.mu.Lock()
+	handles := make([]*consulHandle, 0, len(cl.handles))
+	for h := range cl.handles {
+		handles = append(handles, h)
+	}
+	cl.mu.Unlock()
+
+	for _, h := range handles {
+		h.Release()
+	}
+}
+
+// Ping 检查Consul集群是否可达，能够查询到Raft领导者即视为可达
+func (cl *ConsulLock) Ping(ctx context.Context) error {
+	leader, err := cl.client.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("查询Consul领导者失败: %v", err)
+	}
+	if leader == "" {
+		return fmt.Errorf("Consul集群没有领导者")
+	}
+	return nil
+}
+
+func (cl *ConsulLock) Close() error {
+	cl.ReleaseAllLocks()
+	return nil
+}
+
+func (h *consulHandle) Name() string {
+	return h.name
+}
+
+func (h *consulHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+func (h *consulHandle) Refresh(timeout time.Duration) (bool, error) {
+	select {
+	case <-h.done:
+		return false, fmt.Errorf("锁 %s 已释放或丢失", h.name)
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 续期会话
+	entry, _, err := h.lock.client.Session().Renew(h.sessionID, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("续期会话失败: %v", err)
+	}
+	if entry == nil {
+		h.finish()
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (h *consulHandle) Release() error {
+	h.releaseOnce.Do(func() {
+		h.releaseErr = h.release()
+	})
+	return h.releaseErr
+}
+
+// 内部自动续期方法，会话失效时视为丢失锁
+func (h *consulHandle) keepAlive() {
+	err := h.lock.client.Session().RenewPeriodic(h.lock.sessionTTL.String(), h.sessionID, nil, h.stopRenew)
+	if err != nil {
+		h.lock.logger.Warn("锁的会话已失效", "lock", h.name, "error", err)
+	}
+	h.finish()
+}
+
+// 内部释放锁方法
+func (h *consulHandle) release() error {
+	defer h.finish()
+
+	// 只释放仍由本句柄会话持有的键，会话失效后被其他持有者获取时不受影响
+	ctx, cancel := context.WithTimeout(context.Background(), h.lock.requestTimeout())
+	defer cancel()
+	_, _, err := h.lock.client.KV().Release(&api.KVPair{Key: h.key, Session: h.sessionID},
+		(&api.WriteOptions{}).WithContext(ctx))
+
+	// 停止自动续期并销毁会话，释放键失败时会话销毁后Consul同样会释放锁键
+	close(h.stopRenew)
+	if destroyErr := h.lock.destroySession(h.sessionID); destroyErr != nil && err == nil {
+		err = destroyErr
+	}
+	if err != nil {
+		return fmt.Errorf("释放锁 %s 失败: %v", h.name, err)
+	}
+	return nil
+}
+
+// finish 标记句柄结束，关闭Done通道
+func (h *consulHandle) finish() {
+	h.doneOnce.Do(func() {
+		h.lock.mu.Lock()
+		delete(h.lock.handles, h)
+		h.lock.mu.Unlock()
+		close(h.done)
+	})
+}
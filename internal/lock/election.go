@@ -0,0 +1,143 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// electionRetryInterval 参与选举失败或失去领导者身份后，重新参与选举前的等待时间
+const electionRetryInterval = 2 * time.Second
+
+// errSessionExpired 领导者的选举会话过期，租约已被etcd回收
+var errSessionExpired = errors.New("选举会话已过期")
+
+// EtcdElection 基于etcd concurrency.Election的领导者选举
+// 每个参与者以绑定在会话租约上的键参与选举，创建最早的键为领导者；实例宕机后租约过期，下一个参与者自动当选
+type EtcdElection struct {
+	client *clientv3.Client
+	name   string
+	prefix string // 选举键前缀，与concurrency.Election一致以"/"结尾
+	value  string // 写入选举键的参与者标识（实例ID）
+	logger *slog.Logger
+}
+
+// NewElection 创建使用该etcd客户端的领导者选举
+func (el *EtcdLock) NewElection(name string, logger *slog.Logger) Election {
+	prefix := fmt.Sprintf("/elections/%s", name)
+	return &EtcdElection{
+		client: el.client,
+		name:   name,
+		prefix: prefix + "/",
+		value:  el.holder,
+		logger: logging.Component(logger, "election").With("election", name),
+	}
+}
+
+// Run 异步参与选举，失去领导者身份或选举出错后等待electionRetryInterval重新参与
+func (e *EtcdElection) Run(ctx context.Context, onGained, onLost func()) {
+	go func() {
+		for ctx.Err() == nil {
+			err := e.campaign(ctx, onGained, onLost)
+			if err == nil {
+				return
+			}
+			e.logger.Warn("参与选举失败，稍后重试", "error", err)
+
+			select {
+			case <-time.After(electionRetryInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// campaign 参与一轮选举，阻塞到失去领导者身份或ctx结束，ctx结束时主动让出并返回nil
+func (e *EtcdElection) campaign(ctx context.Context, onGained, onLost func()) error {
+	// 会话不绑定ctx，ctx结束后仍能通过会话让出领导者身份并回收租约
+	session, err := concurrency.NewSession(e.client, concurrency.WithTTL(defaultTTL))
+	if err != nil {
+		return fmt.Errorf("创建选举会话失败: %v", err)
+	}
+	defer session.Close()
+
+	election := concurrency.NewElection(session, e.prefix)
+	if err := election.Campaign(ctx, e.value); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("竞选失败: %v", err)
+	}
+
+	e.logger.Info("已当选领导者", "holder", e.value)
+	onGained()
+
+	select {
+	case <-session.Done():
+		e.logger.Warn("选举会话已过期，失去领导者身份", "holder", e.value)
+		onLost()
+		return errSessionExpired
+	case <-ctx.Done():
+		resignCtx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+		if err := election.Resign(resignCtx); err != nil {
+			e.logger.Warn("让出领导者身份失败，等待租约过期", "error", err)
+		}
+		cancel()
+		e.logger.Info("已让出领导者身份", "holder", e.value)
+		onLost()
+		return nil
+	}
+}
+
+// Observe 监听选举键的变化，领导者变化时回调onChange
+func (e *EtcdElection) Observe(ctx context.Context, onChange func(leader string)) error {
+	leader, revision, err := e.leader(ctx)
+	if err != nil {
+		return fmt.Errorf("获取选举 %s 当前领导者失败: %v", e.name, err)
+	}
+	onChange(leader)
+
+	// 从读取到的版本之后开始监听，任一参与者的键变化后重新读取领导者
+	watchChan := e.client.Watch(ctx, e.prefix, clientv3.WithPrefix(), clientv3.WithRev(revision+1))
+	go func() {
+		for watchResp := range watchChan {
+			if err := watchResp.Err(); err != nil {
+				continue
+			}
+			next, _, err := e.leader(ctx)
+			if err != nil {
+				e.logger.Warn("获取当前领导者失败", "error", err)
+				continue
+			}
+			if next != leader {
+				leader = next
+				onChange(leader)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// leader 读取创建最早的选举键，返回领导者标识和读取时的版本，没有参与者时领导者为空
+func (e *EtcdElection) leader(ctx context.Context) (string, int64, error) {
+	getCtx, cancel := context.WithTimeout(ctx, config.AppConfig.ETCD.RequestTimeout)
+	defer cancel()
+
+	resp, err := e.client.Get(getCtx, e.prefix, clientv3.WithFirstCreate()...)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", resp.Header.Revision, nil
+	}
+	return string(resp.Kvs[0].Value), resp.Header.Revision, nil
+}
@@ -3,6 +3,7 @@ package lock
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,15 +18,23 @@ const (
 
 // EtcdLock 实现分布式锁接口
 type EtcdLock struct {
-	client *clientv3.Client
-	mu     sync.Mutex            // 保护locks的互斥锁
-	locks  map[string]*lockEntry // 当前持有的锁
+	client  *clientv3.Client
+	holder  string                   // 写入锁键的持有者标识（实例ID）
+	mu      sync.Mutex               // 保护handles的互斥锁
+	handles map[*etcdHandle]struct{} // 尚未释放的锁句柄
 }
 
-type lockEntry struct {
-	leaseID clientv3.LeaseID
-	key     string
-	cancel  context.CancelFunc // 用于停止自动续约
+// etcdHandle 一次成功获取的etcd锁，锁键绑定在独立的租约上
+type etcdHandle struct {
+	lock        *EtcdLock
+	name        string
+	key         string
+	leaseID     clientv3.LeaseID
+	cancel      context.CancelFunc // 用于停止自动续约
+	releaseOnce sync.Once
+	releaseErr  error
+	doneOnce    sync.Once
+	done        chan struct{}
 }
 
 func NewETCDLock() (*EtcdLock, error) {
@@ -38,20 +47,19 @@ func NewETCDLock() (*EtcdLock, error) {
 	}
 
 	return &EtcdLock{
-		client: cli,
-		locks:  make(map[string]*lockEntry),
+		client:  cli,
+		holder:  strconv.Itoa(config.AppConfig.Server.InstanceID),
+		handles: make(map[*etcdHandle]struct{}),
 	}, nil
 }
 
-func (el *EtcdLock) AcquireLock(lockName string, timeout time.Duration) (bool, error) {
-	el.mu.Lock()
-	defer el.mu.Unlock()
-
-	// 检查是否已持有锁
-	if _, ok := el.locks[lockName]; ok {
-		return false, fmt.Errorf("锁 %s 已被当前实例持有", lockName)
-	}
+func (el *EtcdLock) AcquireLock(lockName string, timeout time.Duration) (LockHandle, error) {
+	handle, _, err := el.AcquireLockWithToken(lockName, timeout)
+	return handle, err
+}
 
+// AcquireLockWithToken 获取锁并以写入锁键时的etcd修订号作为防护令牌，修订号在整个集群内单调递增
+func (el *EtcdLock) AcquireLockWithToken(lockName string, timeout time.Duration) (LockHandle, int64, error) {
 	key := fmt.Sprintf("/locks/%s", lockName)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 
@@ -60,59 +68,143 @@ func (el *EtcdLock) AcquireLock(lockName string, timeout time.Duration) (bool, e
 	grantResp, err := lease.Grant(ctx, defaultTTL)
 	if err != nil {
 		cancel()
-		return false, fmt.Errorf("创建租约失败: %v", err)
+		return nil, 0, fmt.Errorf("创建租约失败: %v", err)
 	}
 
 	// 尝试获取锁
 	txn := el.client.Txn(ctx).
 		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
-		Then(clientv3.OpPut(key, "", clientv3.WithLease(grantResp.ID))).
+		Then(clientv3.OpPut(key, el.holder, clientv3.WithLease(grantResp.ID))).
 		Else()
 
 	txnResp, err := txn.Commit()
 	if err != nil {
 		cancel()
 		lease.Revoke(context.Background(), grantResp.ID)
-		return false, fmt.Errorf("事务执行失败: %v", err)
+		return nil, 0, fmt.Errorf("事务执行失败: %v", err)
 	}
 
 	if !txnResp.Succeeded {
 		cancel()
 		lease.Revoke(context.Background(), grantResp.ID)
-		return false, nil
+		return nil, 0, nil
 	}
+	cancel()
 
-	// 启动自动续约
+	// 记录锁句柄并启动自动续约
 	keepAliveCtx, keepAliveCancel := context.WithCancel(context.Background())
-	go el.keepAlive(keepAliveCtx, grantResp.ID)
-
-	// 记录锁信息
-	el.locks[lockName] = &lockEntry{
-		leaseID: grantResp.ID,
+	h := &etcdHandle{
+		lock:    el,
+		name:    lockName,
 		key:     key,
+		leaseID: grantResp.ID,
 		cancel:  keepAliveCancel,
+		done:    make(chan struct{}),
 	}
 
-	return true, nil
+	el.mu.Lock()
+	el.handles[h] = struct{}{}
+	el.mu.Unlock()
+
+	go h.keepAlive(keepAliveCtx)
+
+	return h, txnResp.Header.Revision, nil
 }
 
-func (el *EtcdLock) RefreshLock(lockName string, timeout time.Duration) (bool, error) {
+func (el *EtcdLock) ReleaseAllLocks() {
 	el.mu.Lock()
-	defer el.mu.Unlock()
+	handles := make([]*etcdHandle, 0, len(el.handles))
+	for h := range el.handles {
+		handles = append(handles, h)
+	}
+	el.mu.Unlock()
+
+	for _, h := range handles {
+		h.Release()
+	}
+}
+
+// Ping 检查etcd集群是否可达，任一节点返回状态即视为可达
+func (el *EtcdLock) Ping(ctx context.Context) error {
+	lastErr := fmt.Errorf("未配置etcd节点")
+	for _, endpoint := range el.client.Endpoints() {
+		if _, err := el.client.Status(ctx, endpoint); err != nil {
+			lastErr = fmt.Errorf("查询etcd节点 %s 状态失败: %v", endpoint, err)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func (el *EtcdLock) Close() error {
+	el.ReleaseAllLocks()
+	return el.client.Close()
+}
+
+// WatchLock 监听锁键的变化，持有者变化时回调onChange
+func (el *EtcdLock) WatchLock(ctx context.Context, lockName string, onChange func(holder string)) error {
+	key := fmt.Sprintf("/locks/%s", lockName)
+
+	getCtx, cancel := context.WithTimeout(ctx, config.AppConfig.ETCD.RequestTimeout)
+	resp, err := el.client.Get(getCtx, key)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("获取锁 %s 当前持有者失败: %v", lockName, err)
+	}
+
+	holder := ""
+	if len(resp.Kvs) > 0 {
+		holder = string(resp.Kvs[0].Value)
+	}
+	onChange(holder)
+
+	// 从读取到的版本之后开始监听，避免遗漏中间的变化
+	watchChan := el.client.Watch(ctx, key, clientv3.WithRev(resp.Header.Revision+1))
+	go func() {
+		for watchResp := range watchChan {
+			if err := watchResp.Err(); err != nil {
+				continue
+			}
+			for _, ev := range watchResp.Events {
+				next := ""
+				if ev.Type == clientv3.EventTypePut {
+					next = string(ev.Kv.Value)
+				}
+				if next != holder {
+					holder = next
+					onChange(holder)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (h *etcdHandle) Name() string {
+	return h.name
+}
+
+func (h *etcdHandle) Done() <-chan struct{} {
+	return h.done
+}
 
-	entry, ok := el.locks[lockName]
-	if !ok {
-		return false, fmt.Errorf("未持有锁 %s", lockName)
+func (h *etcdHandle) Refresh(timeout time.Duration) (bool, error) {
+	select {
+	case <-h.done:
+		return false, fmt.Errorf("锁 %s 已释放或丢失", h.name)
+	default:
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	// 续租约
-	_, err := clientv3.NewLease(el.client).KeepAliveOnce(ctx, entry.leaseID)
+	_, err := clientv3.NewLease(h.lock.client).KeepAliveOnce(ctx, h.leaseID)
 	if err != nil {
 		if err == rpctypes.ErrLeaseNotFound {
-			delete(el.locks, lockName)
+			h.finish()
 			return false, nil
 		}
 		return false, fmt.Errorf("续约失败: %v", err)
@@ -121,38 +213,28 @@ func (el *EtcdLock) RefreshLock(lockName string, timeout time.Duration) (bool, e
 	return true, nil
 }
 
-func (el *EtcdLock) ReleaseLock(lockName string) error {
-	el.mu.Lock()
-	defer el.mu.Unlock()
-
-	return el.releaseLock(lockName)
-}
-
-func (el *EtcdLock) ReleaseAllLocks() {
-	el.mu.Lock()
-	defer el.mu.Unlock()
-
-	for lockName := range el.locks {
-		el.releaseLock(lockName)
-	}
-}
-
-func (el *EtcdLock) Close() error {
-	el.ReleaseAllLocks()
-	return el.client.Close()
+func (h *etcdHandle) Release() error {
+	h.releaseOnce.Do(func() {
+		h.releaseErr = h.release()
+	})
+	return h.releaseErr
 }
 
-// 内部自动续约方法
-func (el *EtcdLock) keepAlive(ctx context.Context, leaseID clientv3.LeaseID) {
-	lease := clientv3.NewLease(el.client)
+// 内部自动续约方法，租约不存在时视为丢失锁
+func (h *etcdHandle) keepAlive(ctx context.Context) {
+	lease := clientv3.NewLease(h.lock.client)
 	ticker := time.NewTicker(time.Duration(defaultTTL/2) * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			_, err := lease.KeepAliveOnce(ctx, leaseID)
-			if err != nil {
+			_, err := lease.KeepAliveOnce(ctx, h.leaseID)
+			if err == rpctypes.ErrLeaseNotFound {
+				h.finish()
+				return
+			}
+			if err != nil && ctx.Err() != nil {
 				return
 			}
 		case <-ctx.Done():
@@ -162,27 +244,35 @@ func (el *EtcdLock) keepAlive(ctx context.Context, leaseID clientv3.LeaseID) {
 }
 
 // 内部释放锁方法
-func (el *EtcdLock) releaseLock(lockName string) error {
-	entry, ok := el.locks[lockName]
-	if !ok {
-		return nil
-	}
-
+func (h *etcdHandle) release() error {
 	// 停止自动续约
-	entry.cancel()
-
-	// 删除键
-	_, err := el.client.Delete(context.Background(), entry.key)
+	h.cancel()
+	defer h.finish()
+
+	// 只删除仍绑定在本句柄租约上的键，锁过期后被其他持有者获取时不受影响
+	_, err := h.lock.client.Txn(context.Background()).
+		If(clientv3.Compare(clientv3.LeaseValue(h.key), "=", h.leaseID)).
+		Then(clientv3.OpDelete(h.key)).
+		Commit()
 	if err != nil {
 		return fmt.Errorf("删除键失败: %v", err)
 	}
 
 	// 释放租约
-	_, err = clientv3.NewLease(el.client).Revoke(context.Background(), entry.leaseID)
-	if err != nil {
+	_, err = clientv3.NewLease(h.lock.client).Revoke(context.Background(), h.leaseID)
+	if err != nil && err != rpctypes.ErrLeaseNotFound {
 		return fmt.Errorf("释放租约失败: %v", err)
 	}
 
-	delete(el.locks, lockName)
 	return nil
 }
+
+// finish 标记句柄结束，关闭Done通道
+func (h *etcdHandle) finish() {
+	h.doneOnce.Do(func() {
+		h.lock.mu.Lock()
+		delete(h.lock.handles, h)
+		h.lock.mu.Unlock()
+		close(h.done)
+	})
+}
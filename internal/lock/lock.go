@@ -1,27 +1,120 @@
 package lock
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+// 票据生产者锁的后端
+const (
+	BackendETCD   = "etcd"
+	BackendConsul = "consul"
 )
 
+// ErrNoQuorum 可达的锁节点不足多数，不可能获取到锁
+var ErrNoQuorum = errors.New("可达的锁节点不足多数，无法获取锁")
+
 // Lock 分布式锁接口
 type Lock interface {
 	// AcquireLock 获取分布式锁
-	// 返回值：bool表示是否成功获取锁，error表示获取过程中的错误
-	AcquireLock(lockName string, timeout time.Duration) (bool, error)
+	// 返回值：成功时返回锁句柄，锁被其他持有者占用时句柄为nil，error表示获取过程中的错误
+	// 每次成功获取都返回独立的句柄，锁的刷新和释放都通过句柄进行
+	AcquireLock(lockName string, timeout time.Duration) (LockHandle, error)
 
-	// RefreshLock 刷新锁的过期时间
-	// 返回值：bool表示是否成功刷新锁，error表示刷新过程中的错误
-	RefreshLock(lockName string, timeout time.Duration) (bool, error)
+	// AcquireLockWithToken 与AcquireLock相同，同时返回单调递增的防护令牌（fencing token），获取失败时令牌为0
+	// 同一锁后获取的持有者得到更大的令牌；写入受保护的资源时携带令牌，资源拒绝小于已见最大值的令牌，
+	// 锁过期后仍在执行的旧持有者因此无法覆盖新持有者的写入
+	AcquireLockWithToken(lockName string, timeout time.Duration) (LockHandle, int64, error)
 
-	// ReleaseLock 释放分布式锁
-	// 返回值：error表示释放过程中的错误
-	ReleaseLock(lockName string) error
-
-	// ReleaseAllLocks 释放所有持有的锁
+	// ReleaseAllLocks 释放通过该客户端获取且尚未释放的所有锁
 	ReleaseAllLocks()
 
 	// Close 关闭分布式锁客户端
 	// 返回值：error表示关闭过程中的错误
 	Close() error
 }
+
+// LockHandle 一次成功获取的锁，由获取者负责刷新和释放
+type LockHandle interface {
+	// Name 返回锁名
+	Name() string
+
+	// Refresh 刷新锁的过期时间
+	// 返回值：bool表示是否仍持有锁，error表示刷新过程中的错误
+	Refresh(timeout time.Duration) (bool, error)
+
+	// Release 释放锁，重复释放不会产生影响
+	// 返回值：error表示释放过程中的错误
+	Release() error
+
+	// Done 返回一个通道，锁被释放或丢失（过期、被删除）时关闭
+	Done() <-chan struct{}
+}
+
+// QuorumChecker 可选接口，支持在获取锁之前判断锁节点是否可能达到多数
+type QuorumChecker interface {
+	// HasQuorum 最近一次健康检查时可达的节点是否达到多数
+	HasQuorum() bool
+}
+
+// Watcher 可选接口，支持监听锁持有者的变化
+type Watcher interface {
+	// WatchLock 异步监听锁持有者变化，建立监听时会先回调一次当前持有者
+	// holder为空表示锁当前未被持有，ctx结束时停止监听
+	WatchLock(ctx context.Context, lockName string, onChange func(holder string)) error
+}
+
+// Election 领导者选举，同一选举中同时最多一个参与者为领导者
+type Election interface {
+	// Run 异步参与选举直到ctx结束，成为领导者时回调onGained，会话过期等原因失去领导者身份时回调onLost，随后重新参与选举
+	// ctx结束时如为领导者则主动让出领导者身份并回调onLost
+	Run(ctx context.Context, onGained, onLost func())
+
+	// Observe 异步监听领导者变化，建立监听时会先回调一次当前领导者
+	// leader为空表示当前没有领导者，ctx结束时停止监听
+	Observe(ctx context.Context, onChange func(leader string)) error
+}
+
+// Backend 票据生产者使用的分布式锁后端，同时提供生产者选举和健康检查
+type Backend interface {
+	Lock
+
+	// NewElection 创建使用该后端的领导者选举
+	NewElection(name string, logger *slog.Logger) Election
+
+	// Ping 检查后端集群是否可达
+	Ping(ctx context.Context) error
+}
+
+// NewBackend 按lock.backend创建分布式锁后端
+func NewBackend(logger *slog.Logger) (Backend, error) {
+	// 创建失败时返回nil接口，而不是包含nil指针的接口
+	switch backend := config.AppConfig.Lock.Backend; backend {
+	case "", BackendETCD:
+		l, err := NewETCDLock()
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	case BackendConsul:
+		l, err := NewConsulLock(logger)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	default:
+		return nil, fmt.Errorf("不支持的分布式锁后端: %s", backend)
+	}
+}
+
+// 编译期检查具体实现满足接口
+var (
+	_ Backend = (*EtcdLock)(nil)
+	_ Backend = (*ConsulLock)(nil)
+	_ Lock    = (*RedLock)(nil)
+)
@@ -2,26 +2,48 @@ package lock
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
+	mrand "math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
 )
 
 type RedLock struct {
 	clients     []*redis.Client
 	ctx         context.Context
-	locks       map[string]string // key是锁名，value是token值
+	holder      string                      // 令牌中的持有者标识（实例ID），便于排查锁被谁持有
+	mu          sync.Mutex                  // 保护handles，网络请求不在锁内执行
+	handles     map[*redLockHandle]struct{} // 尚未释放的锁句柄
 	timeout     time.Duration
-	retries     int
+	retries     int           // 最大尝试次数
+	retryDelay  time.Duration // 重试的基础等待时间
+	retryJitter time.Duration // 重试等待的随机抖动上限
+	maxAcquire  time.Duration // 单次获取锁的总耗时上限，为0时不限制
 	clusterSize int
+	reachable   atomic.Int32  // 最近一次健康检查时可达的节点数
+	stopHealth  chan struct{} // 停止健康检查
+	logger      *slog.Logger
 }
 
+const (
+	defaultLockRetryDelay     = 100 * time.Millisecond
+	defaultLockHealthInterval = 5 * time.Second
+)
+
 // NewRedLock 创建新的分布式锁客户端
-func NewRedLock() (*RedLock, error) {
+func NewRedLock(logger *slog.Logger) (*RedLock, error) {
 	ctx := context.Background()
+	logger = logging.Component(logger, "redlock")
 
 	// 创建多个独立的Redis客户端
 	var clients []*redis.Client
@@ -40,7 +62,7 @@ func NewRedLock() (*RedLock, error) {
 
 		// 测试连接
 		if err := client.Ping(ctx).Err(); err != nil {
-			log.Printf("Redis锁节点 %s 连接测试失败: %v", addr, err)
+			logger.Error("Redis锁节点连接测试失败", "addr", addr, "error", err)
 			// 关闭已创建的客户端
 			for _, c := range clients {
 				c.Close()
@@ -51,21 +73,167 @@ func NewRedLock() (*RedLock, error) {
 		clients = append(clients, client)
 	}
 
-	return &RedLock{
+	retries := config.AppConfig.Ticket.LockRetryCount
+	if retries <= 0 {
+		retries = 1
+	}
+	retryDelay := config.AppConfig.Ticket.LockRetryDelay
+	if retryDelay <= 0 {
+		retryDelay = defaultLockRetryDelay
+	}
+
+	r := &RedLock{
 		clients:     clients,
 		ctx:         ctx,
-		locks:       make(map[string]string),
+		holder:      strconv.Itoa(config.AppConfig.Server.InstanceID),
+		handles:     make(map[*redLockHandle]struct{}),
 		timeout:     config.AppConfig.Ticket.LockTimeout,
-		retries:     config.AppConfig.Ticket.LockRetryCount,
+		retries:     retries,
+		retryDelay:  retryDelay,
+		retryJitter: config.AppConfig.Ticket.LockRetryJitter,
+		maxAcquire:  config.AppConfig.Ticket.LockAcquireMax,
 		clusterSize: len(config.AppConfig.Redis.LockAddresses),
-	}, nil
+		stopHealth:  make(chan struct{}),
+		logger:      logger,
+	}
+
+	// 创建时已确认所有节点可达
+	r.setReachable(len(clients))
+	go r.monitorHealth()
+
+	return r, nil
+}
+
+// monitorHealth 定期检查锁节点的可达性
+func (r *RedLock) monitorHealth() {
+	interval := config.AppConfig.Redis.LockHealthInterval
+	if interval <= 0 {
+		interval = defaultLockHealthInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.checkHealth()
+		case <-r.stopHealth:
+			return
+		}
+	}
 }
 
+// checkHealth 逐个Ping锁节点，更新可达节点数
+func (r *RedLock) checkHealth() {
+	reachable := 0
+	for i, client := range r.clients {
+		ctx, cancel := context.WithTimeout(r.ctx, config.AppConfig.Redis.Timeout)
+		err := client.Ping(ctx).Err()
+		cancel()
+		if err != nil {
+			r.logger.Warn("Redis锁节点不可达", "addr", config.AppConfig.Redis.LockAddresses[i], "error", err)
+			continue
+		}
+		reachable++
+	}
+
+	hadQuorum := r.HasQuorum()
+	r.setReachable(reachable)
+	if hadQuorum && !r.HasQuorum() {
+		r.logger.Warn("可达的Redis锁节点不足多数，暂停获取锁", "reachable", reachable, "cluster_size", r.clusterSize)
+	} else if !hadQuorum && r.HasQuorum() {
+		r.logger.Info("可达的Redis锁节点恢复到多数", "reachable", reachable, "cluster_size", r.clusterSize)
+	}
+}
+
+func (r *RedLock) setReachable(reachable int) {
+	r.reachable.Store(int32(reachable))
+	metrics.LockNodesReachable.Set(float64(reachable))
+	if r.HasQuorum() {
+		metrics.LockQuorum.Set(1)
+	} else {
+		metrics.LockQuorum.Set(0)
+	}
+}
+
+// HasQuorum 最近一次健康检查时可达的节点是否达到多数
+func (r *RedLock) HasQuorum() bool {
+	return int(r.reachable.Load()) >= r.clusterSize/2+1
+}
+
+// redLockHandle 一次成功获取的Redlock锁
+type redLockHandle struct {
+	lock        *RedLock
+	name        string
+	token       string
+	expiry      *time.Timer // 有效期结束时视为丢失锁，刷新成功后重置
+	releaseOnce sync.Once
+	doneOnce    sync.Once
+	done        chan struct{}
+}
+
+// fencingKeySuffix 防护令牌计数器的键后缀，计数器不过期
+const fencingKeySuffix = ":fencing"
+
 // AcquireLock 获取分布式锁
-func (r *RedLock) AcquireLock(lockName string, timeout time.Duration) (bool, error) {
-	// 生成随机令牌值
-	token := fmt.Sprintf("%d-%d", time.Now().UnixNano(), time.Now().Unix())
+func (r *RedLock) AcquireLock(lockName string, timeout time.Duration) (LockHandle, error) {
+	handle, err := r.acquire(lockName, timeout)
+	if handle == nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// AcquireLockWithToken 获取锁后在多数节点上递增该锁的计数器，以其中的最大值作为防护令牌
+// 任意两个多数派至少有一个公共节点，后获取锁的持有者得到的令牌一定更大；计数器未能在多数节点上递增时释放锁并返回错误
+func (r *RedLock) AcquireLockWithToken(lockName string, timeout time.Duration) (LockHandle, int64, error) {
+	handle, err := r.acquire(lockName, timeout)
+	if handle == nil || err != nil {
+		return nil, 0, err
+	}
+
+	token, err := r.nextFencingToken(lockName)
+	if err != nil {
+		handle.Release()
+		return nil, 0, err
+	}
+	return handle, token, nil
+}
+
+// nextFencingToken 在所有节点上递增锁的防护令牌计数器，返回多数节点中的最大值
+func (r *RedLock) nextFencingToken(lockName string) (int64, error) {
+	var token int64
+	success := 0
+	for i, client := range r.clients {
+		value, err := client.Incr(r.ctx, lockName+fencingKeySuffix).Result()
+		if err != nil {
+			r.logger.Warn("在节点递增防护令牌失败", "addr", config.AppConfig.Redis.LockAddresses[i], "lock", lockName, "error", err)
+			continue
+		}
+		success++
+		token = max(token, value)
+	}
+
+	if success < r.clusterSize/2+1 {
+		return 0, fmt.Errorf("锁 %s 的防护令牌只在 %d 个节点上递增成功，未达到多数", lockName, success)
+	}
+	return token, nil
+}
+
+// acquire 按Redlock算法获取锁，未获取到时句柄为nil
+func (r *RedLock) acquire(lockName string, timeout time.Duration) (*redLockHandle, error) {
+	// 每次获取生成独立的随机令牌，不同锁、同一锁的不同次获取互不影响
+	// 可达节点不足多数时不可能获取成功，直接拒绝
+	if !r.HasQuorum() {
+		return nil, ErrNoQuorum
+	}
+
+	token, err := r.newToken()
+	if err != nil {
+		return nil, err
+	}
 	success := 0
+	acquireStart := time.Now()
 
 	// Redlock算法: 尝试在多个节点上获取锁
 	for i := 0; i < r.retries; i++ {
@@ -77,7 +245,7 @@ func (r *RedLock) AcquireLock(lockName string, timeout time.Duration) (bool, err
 			// 使用SetNX设置锁
 			ok, err := client.SetNX(r.ctx, lockName, token, timeout).Result()
 			if err != nil {
-				log.Printf("在节点 %s 获取锁 %s 失败: %v", config.AppConfig.Redis.LockAddresses[i], lockName, err)
+				r.logger.Warn("在节点获取锁失败", "addr", config.AppConfig.Redis.LockAddresses[i], "lock", lockName, "error", err)
 				continue
 			}
 
@@ -91,27 +259,77 @@ func (r *RedLock) AcquireLock(lockName string, timeout time.Duration) (bool, err
 		validityTime := timeout - elapsed
 
 		if success >= (r.clusterSize/2+1) && validityTime > 0 {
-			// 保存锁信息
-			r.locks[lockName] = token
-			log.Printf("获取锁 %s 成功，Token: %s", lockName, token)
-			return true, nil
+			r.logger.Debug("获取锁成功", "lock", lockName, "token", token)
+			return r.track(lockName, token, validityTime), nil
 		}
 
 		// 获取失败，释放所有节点上的锁
 		r.unlockAll(lockName, token)
 
-		// 重试前等待一段时间
-		time.Sleep(time.Millisecond * 100)
+		if i == r.retries-1 {
+			break
+		}
+
+		// 重试前等待一段时间，等待后会超出总耗时上限时放弃
+		delay := r.backoff(i)
+		if r.maxAcquire > 0 && time.Since(acquireStart)+delay > r.maxAcquire {
+			r.logger.Warn("获取锁超出总耗时上限，放弃重试", "lock", lockName, "max_acquire", r.maxAcquire)
+			break
+		}
+		time.Sleep(delay)
 	}
 
-	return false, nil
+	return nil, nil
 }
 
-// RefreshLock 刷新锁的过期时间
-func (r *RedLock) RefreshLock(lockName string, timeout time.Duration) (bool, error) {
-	token, exists := r.locks[lockName]
-	if !exists {
-		return false, fmt.Errorf("锁 %s 不存在或未持有", lockName)
+// backoff 返回第attempt次失败后的等待时间：基础等待时间按指数增长并附加随机抖动
+func (r *RedLock) backoff(attempt int) time.Duration {
+	delay := r.retryDelay << min(attempt, 10)
+	if r.retryJitter > 0 {
+		delay += time.Duration(mrand.Int64N(int64(r.retryJitter)))
+	}
+	return delay
+}
+
+// track 为获取到的锁创建句柄并记录，有效期内未刷新时句柄的Done通道关闭
+func (r *RedLock) track(lockName, token string, validity time.Duration) *redLockHandle {
+	h := &redLockHandle{
+		lock:  r,
+		name:  lockName,
+		token: token,
+		done:  make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.handles[h] = struct{}{}
+	r.mu.Unlock()
+
+	h.expiry = time.AfterFunc(validity, h.finish)
+	return h
+}
+
+// untrack 移除已结束的锁句柄
+func (r *RedLock) untrack(h *redLockHandle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.handles, h)
+}
+
+func (h *redLockHandle) Name() string {
+	return h.name
+}
+
+func (h *redLockHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Refresh 刷新锁的过期时间
+func (h *redLockHandle) Refresh(timeout time.Duration) (bool, error) {
+	select {
+	case <-h.done:
+		return false, fmt.Errorf("锁 %s 已释放或丢失", h.name)
+	default:
 	}
 
 	// 使用Lua脚本刷新锁，确保只刷新自己持有的锁
@@ -123,11 +341,12 @@ func (r *RedLock) RefreshLock(lockName string, timeout time.Duration) (bool, err
 		end
 	`
 
+	r := h.lock
 	success := 0
 	for i, client := range r.clients {
-		result, err := client.Eval(r.ctx, script, []string{lockName}, token, int(timeout/time.Millisecond)).Result()
+		result, err := client.Eval(r.ctx, script, []string{h.name}, h.token, int(timeout/time.Millisecond)).Result()
 		if err != nil {
-			log.Printf("在节点 %s 刷新锁 %s 失败: %v", config.AppConfig.Redis.LockAddresses[i], lockName, err)
+			h.lock.logger.Warn("在节点刷新锁失败", "addr", config.AppConfig.Redis.LockAddresses[i], "lock", h.name, "error", err)
 			continue
 		}
 
@@ -137,27 +356,35 @@ func (r *RedLock) RefreshLock(lockName string, timeout time.Duration) (bool, err
 	}
 
 	if success >= (r.clusterSize/2 + 1) {
-		log.Printf("刷新锁 %s 成功", lockName)
+		h.expiry.Reset(timeout)
+		h.lock.logger.Debug("刷新锁成功", "lock", h.name)
 		return true, nil
 	}
 
-	delete(r.locks, lockName)
+	h.expiry.Stop()
+	h.finish()
 	return false, nil
 }
 
-// ReleaseLock 释放分布式锁
-func (r *RedLock) ReleaseLock(lockName string) error {
-	token, exists := r.locks[lockName]
-	if !exists {
-		return fmt.Errorf("锁 %s 不存在或未持有", lockName)
-	}
-
-	r.unlockAll(lockName, token)
-	delete(r.locks, lockName)
-	log.Printf("释放锁 %s 成功", lockName)
+// Release 释放分布式锁
+func (h *redLockHandle) Release() error {
+	h.releaseOnce.Do(func() {
+		h.expiry.Stop()
+		h.finish()
+		h.lock.unlockAll(h.name, h.token)
+		h.lock.logger.Debug("释放锁成功", "lock", h.name)
+	})
 	return nil
 }
 
+// finish 标记句柄结束，关闭Done通道
+func (h *redLockHandle) finish() {
+	h.doneOnce.Do(func() {
+		h.lock.untrack(h)
+		close(h.done)
+	})
+}
+
 // unlockAll 在所有节点上释放锁
 func (r *RedLock) unlockAll(lockName string, token string) {
 	// 使用Lua脚本释放锁，确保只释放自己持有的锁
@@ -172,29 +399,44 @@ func (r *RedLock) unlockAll(lockName string, token string) {
 	for i, client := range r.clients {
 		_, err := client.Eval(r.ctx, script, []string{lockName}, token).Result()
 		if err != nil {
-			log.Printf("在节点 %s 释放锁 %s 失败: %v", config.AppConfig.Redis.LockAddresses[i], lockName, err)
+			r.logger.Warn("在节点释放锁失败", "addr", config.AppConfig.Redis.LockAddresses[i], "lock", lockName, "error", err)
 		}
 	}
 }
 
 // ReleaseAllLocks 释放所有持有的锁
 func (r *RedLock) ReleaseAllLocks() {
-	for name, token := range r.locks {
-		r.unlockAll(name, token)
-		log.Printf("释放锁 %s 成功", name)
+	r.mu.Lock()
+	handles := make([]*redLockHandle, 0, len(r.handles))
+	for h := range r.handles {
+		handles = append(handles, h)
 	}
+	r.mu.Unlock()
 
-	r.locks = make(map[string]string)
+	for _, h := range handles {
+		h.Release()
+	}
+}
+
+// newToken 生成锁令牌，格式为"实例ID-128位随机数"
+// 随机部分来自crypto/rand，无法被其他实例猜测，同一时刻启动的实例也不会冲突
+func (r *RedLock) newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成锁令牌失败: %w", err)
+	}
+	return r.holder + "-" + hex.EncodeToString(buf), nil
 }
 
 // Close 关闭分布式锁客户端
 func (r *RedLock) Close() error {
+	close(r.stopHealth)
 	r.ReleaseAllLocks()
 
 	// 关闭所有Redis客户端
 	for _, client := range r.clients {
 		if err := client.Close(); err != nil {
-			log.Printf("关闭Redis客户端失败: %v", err)
+			r.logger.Error("关闭Redis客户端失败", "error", err)
 		}
 	}
 
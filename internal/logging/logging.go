@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/requestctx"
+)
+
+// 日志输出格式
+const (
+	FormatConsole = "console" // key=value文本，便于阅读
+	FormatJSON    = "json"    // 每行一个JSON对象，便于日志系统采集
+)
+
+// level 由New创建的日志共用的最低级别，配置热加载时修改
+var level = new(slog.LevelVar)
+
+// New 按log配置创建写入标准错误的日志，记录时ctx中带有请求ID的日志附加request_id
+func New(cfg config.LogConfig) (*slog.Logger, error) {
+	parsed, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	level.Set(parsed)
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", FormatConsole:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("不支持的日志格式: %s", cfg.Format)
+	}
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// Setup 创建日志并设为默认日志，此后标准库log包的输出也经由该日志
+// 配置不合法时返回错误，调用方仍可使用此前的默认日志报告
+func Setup(cfg config.LogConfig) (*slog.Logger, error) {
+	logger, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// ParseLevel 解析日志级别，为空时为info
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("不支持的日志级别: %s", level)
+	}
+}
+
+// ReloadConfig 配置热加载的回调，按log.level修改日志级别，级别不合法时保持原级别；日志格式需要重启后生效
+func ReloadConfig(prev, next *config.Config) {
+	if prev.Log.Level == next.Log.Level {
+		return
+	}
+	parsed, err := ParseLevel(next.Log.Level)
+	if err != nil {
+		slog.Error("日志级别不合法，保持原级别", "level", next.Log.Level, "error", err)
+		return
+	}
+	level.Set(parsed)
+	slog.Info("日志级别已修改", "level", parsed)
+}
+
+// Component 返回标记了组件名的子日志，logger为nil时使用默认日志
+func Component(logger *slog.Logger, name string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("component", name)
+}
+
+// WithRequestID 返回携带请求ID的上下文，用于在HTTP请求之外恢复请求ID，例如消费投票事件时
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	info := *requestctx.From(ctx)
+	info.RequestID = requestID
+	return requestctx.With(ctx, &info)
+}
+
+// contextHandler 从记录日志时的ctx中取出请求ID附加到日志
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestID := requestctx.From(ctx).RequestID; requestID != "" {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
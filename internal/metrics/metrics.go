@@ -0,0 +1,318 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "littlevote"
+
+var (
+	// CleanupPurgedRows 清理任务删除的记录数，按表区分
+	CleanupPurgedRows = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cleanup",
+		Name:      "purged_rows_total",
+		Help:      "清理任务删除的记录数",
+	}, []string{"table"})
+
+	// VoteQueueDepth 投票处理管道各环节积压的待处理数量
+	VoteQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "vote_queue",
+		Name:      "depth",
+		Help:      "投票处理管道各环节积压的待处理数量",
+	}, []string{"source", "partition"})
+
+	// VoteEventBytes 写入Kafka的投票事件消息体字节数，按编码区分
+	VoteEventBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "vote_event",
+		Name:      "bytes_total",
+		Help:      "写入Kafka的投票事件消息体字节数，encoding为json、protobuf或gzip",
+	}, []string{"encoding"})
+
+	// OutboxRelayPaused 发件箱中继是否被暂停
+	OutboxRelayPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "relay_paused",
+		Help:      "发件箱中继是否被暂停，1为暂停",
+	})
+
+	// OutboxOldestAge 发件箱中最早一条未发送事件的等待时长
+	OutboxOldestAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "oldest_age_seconds",
+		Help:      "发件箱中最早一条未发送事件的等待秒数，发件箱为空时为0",
+	})
+
+	// OutboxRelayed 本实例从发件箱发送到Kafka的投票事件数
+	OutboxRelayed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "outbox",
+		Name:      "relayed_total",
+		Help:      "本实例从发件箱发送到Kafka的投票事件数",
+	})
+
+	// VotePoolQueued 等待投票worker执行的请求数
+	VotePoolQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "vote_pool",
+		Name:      "queued",
+		Help:      "等待投票worker执行的请求数",
+	})
+
+	// VotePoolRejected 因投票排队已满被拒绝的请求数
+	VotePoolRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "vote_pool",
+		Name:      "rejected_total",
+		Help:      "因投票排队已满被拒绝的请求数",
+	})
+
+	// RateLimitRejected 因客户端IP投票过于频繁被拒绝的请求数
+	RateLimitRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ratelimit",
+		Name:      "rejected_total",
+		Help:      "因客户端IP投票过于频繁被拒绝的请求数",
+	})
+
+	// PushConnections 本实例当前的WebSocket推送连接数
+	PushConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "push",
+		Name:      "connections",
+		Help:      "本实例当前的WebSocket推送连接数",
+	})
+
+	// PushDisconnectedSlow 待发送事件写满而被断开的WebSocket连接数
+	PushDisconnectedSlow = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "push",
+		Name:      "slow_disconnects_total",
+		Help:      "待发送事件写满而被断开的WebSocket连接数",
+	})
+
+	// DeprecatedFieldResolutions 已废弃的GraphQL字段被解析的次数，降到0后才能在下一个版本删除
+	DeprecatedFieldResolutions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "deprecated_field_resolutions_total",
+		Help:      "已废弃的GraphQL字段被解析的次数",
+	}, []string{"field"})
+
+	// GraphQLRejectedQueries 执行前因复杂度超限或无法解析被拒绝的GraphQL请求数，reason为complexity或invalid
+	GraphQLRejectedQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "graphql",
+		Name:      "rejected_queries_total",
+		Help:      "执行前因复杂度超限或无法解析被拒绝的GraphQL请求数",
+	}, []string{"reason"})
+
+	// ConsumerPaused 投票事件消费是否被暂停
+	ConsumerPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "paused",
+		Help:      "投票事件消费是否被暂停，1为暂停",
+	})
+
+	// ConsumerInFlight 计票消费者已拉取、尚未处理完的消息数，启用处理线程池时统计
+	ConsumerInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "in_flight",
+		Help:      "计票消费者已拉取、尚未处理完的消息数，达到kafka.consumer_max_in_flight时停止拉取",
+	})
+
+	// ConsumerGroupLag 一致性检查统计的各计票主题分区的消费积压，覆盖整个集群
+	ConsumerGroupLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "group_lag",
+		Help:      "一致性检查统计的各分区尚未消费的消息数",
+	}, []string{"topic", "partition"})
+
+	// ConsistencyMismatches 最近一次一致性检查发现的不一致的用户数，kind为votes（票数与投票日志）或cache（缓存与主库）
+	ConsistencyMismatches = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "consistency",
+		Name:      "mismatches",
+		Help:      "最近一次一致性检查发现的不一致的用户数",
+	}, []string{"kind"})
+
+	// ConsumerEvents 计票消费者处理的投票事件数，按结果区分
+	ConsumerEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "events_total",
+		Help:      "计票消费者处理的投票事件数，result为ok或failed",
+	}, []string{"result"})
+
+	// ConsumerHandleDuration 计票消费者处理单个投票事件的耗时，包含重试等待
+	ConsumerHandleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "handle_duration_seconds",
+		Help:      "计票消费者处理单个投票事件的耗时（秒），包含重试等待",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// ConsumerDuplicatesSkipped 本实例最近已处理过、重投时直接跳过的投票事件数
+	ConsumerDuplicatesSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "duplicates_skipped_total",
+		Help:      "本实例最近已处理过、重投时直接跳过的投票事件数",
+	})
+
+	// ConsumerBatchSize 批量消费模式下每批处理的投票事件数
+	ConsumerBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "batch_size",
+		Help:      "批量消费模式下每批处理的投票事件数",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	// ConsumerBatchDuration 批量消费模式下处理一批投票事件的耗时，包含重试等待
+	ConsumerBatchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "consumer",
+		Name:      "batch_duration_seconds",
+		Help:      "批量消费模式下处理一批投票事件的耗时（秒），包含重试等待",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// LocalCacheRequests 进程内缓存的查询次数，按缓存类别和结果（hit/miss）区分
+	LocalCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "local_cache",
+		Name:      "requests_total",
+		Help:      "进程内缓存的查询次数，cache为user_vote或ticket_version，result为hit或miss",
+	}, []string{"cache", "result"})
+
+	// LocalCacheInvalidations 进程内缓存收到的失效通知数，按缓存类别区分
+	LocalCacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "local_cache",
+		Name:      "invalidations_total",
+		Help:      "进程内缓存收到的失效通知数",
+	}, []string{"cache"})
+
+	// ProducerAcquisitions 本实例成为票据生产者的次数
+	ProducerAcquisitions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "producer",
+		Name:      "acquisitions_total",
+		Help:      "本实例获得票据生产者身份的次数",
+	})
+
+	// ProducerLosses 本实例失去票据生产者身份的次数
+	ProducerLosses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "producer",
+		Name:      "losses_total",
+		Help:      "本实例失去票据生产者身份的次数",
+	})
+
+	// ProducerTakeovers 本实例从其他实例接管票据生产者身份的次数
+	ProducerTakeovers = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "producer",
+		Name:      "takeovers_total",
+		Help:      "本实例从其他实例接管票据生产者身份的次数",
+	})
+
+	// ProducerIsLeader 本实例当前是否为票据生产者
+	ProducerIsLeader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "producer",
+		Name:      "is_leader",
+		Help:      "本实例当前是否为票据生产者（1为是）",
+	})
+
+	// LockNodesReachable 可达的Redlock节点数
+	LockNodesReachable = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "lock",
+		Name:      "nodes_reachable",
+		Help:      "可达的Redlock节点数",
+	})
+
+	// LockQuorum 可达的Redlock节点是否达到多数
+	LockQuorum = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "lock",
+		Name:      "quorum",
+		Help:      "可达的Redlock节点是否达到多数（1为是）",
+	})
+
+	// TicketRemainingUsages 本实例最近一次使用票据后观测到的剩余使用次数
+	TicketRemainingUsages = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "ticket",
+		Name:      "remaining_usages",
+		Help:      "本实例最近一次使用票据后观测到的当前票据剩余使用次数",
+	}, []string{"poll_id"})
+
+	// TicketLowUsageAlerts 票据剩余使用次数降到预警值以下的次数
+	TicketLowUsageAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ticket",
+		Name:      "low_usage_alerts_total",
+		Help:      "票据剩余使用次数降到预警值以下的次数",
+	}, []string{"poll_id"})
+
+	// TicketValidationFailures 票据不存在或票据值不匹配导致的校验失败次数
+	TicketValidationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ticket",
+		Name:      "validation_failures_total",
+		Help:      "票据不存在或票据值不匹配导致的校验失败次数",
+	}, []string{"poll_id"})
+
+	// TicketClientsBlocked 因票据校验失败次数过多被暂时禁止使用票据的次数，按标识类型区分
+	TicketClientsBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ticket",
+		Name:      "clients_blocked_total",
+		Help:      "因票据校验失败次数过多被暂时禁止使用票据的次数",
+	}, []string{"kind"})
+
+	// TicketInstanceQuotaRejections 本实例在当前票据上的签发次数达到上限后拒绝签发的次数
+	TicketInstanceQuotaRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ticket",
+		Name:      "instance_quota_rejections_total",
+		Help:      "本实例在当前票据上的签发次数达到上限后拒绝签发的次数",
+	}, []string{"poll_id"})
+
+	// WebhookDeliveries webhook推送结果，按事件类型和结果区分
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "deliveries_total",
+		Help:      "webhook推送次数，result为success或failure",
+	}, []string{"event", "result"})
+
+	// ProducerHoldDuration 每次持有票据生产者身份的时长
+	ProducerHoldDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "producer",
+		Name:      "hold_duration_seconds",
+		Help:      "每次持有票据生产者身份的时长",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+	})
+)
+
+// Handler 返回Prometheus指标的HTTP处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
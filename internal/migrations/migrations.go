@@ -0,0 +1,348 @@
+// Package migrations 内置的数据库迁移脚本和执行器，MySQL和PostgreSQL各一套脚本，执行记录保存在schema_migrations中
+// 脚本按文件名顺序执行：NNNN_name.sql为升级脚本，NNNN_name.down.sql为对应的回滚脚本，版本号为去掉后缀的文件名
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+)
+
+//go:embed mysql/*.sql postgres/*.sql
+var scripts embed.FS
+
+// 支持的数据库，与storage.driver一致
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+const (
+	// lockName MySQL执行迁移时持有的命名锁，多个实例同时启动时依次迁移
+	lockName = "littlevote:schema_migrations"
+	// lockID PostgreSQL执行迁移时持有的advisory锁
+	lockID = 7_411_000_001
+	// lockTimeout 等待其他实例完成迁移的最长时间
+	lockTimeout = 5 * time.Minute
+)
+
+const downSuffix = ".down.sql"
+
+// migration 一个版本的升级脚本和回滚脚本，回滚脚本为空时该版本不能回滚
+type migration struct {
+	version string
+	up      string
+	down    string
+}
+
+// Status 一个迁移版本的执行状态
+type Status struct {
+	Version    string    `json:"version"`
+	Applied    bool      `json:"applied"`
+	AppliedAt  time.Time `json:"appliedAt,omitempty"`
+	Reversible bool      `json:"reversible"`
+	// Unknown 数据库中有执行记录，但本版本没有内置该脚本，通常是更新的版本执行过的迁移
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Migrator 在主库上执行迁移脚本
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []migration
+	logger     *slog.Logger
+}
+
+// New 创建driver对应数据库的迁移执行器
+func New(db *sql.DB, driver string, logger *slog.Logger) (*Migrator, error) {
+	if driver != DriverMySQL && driver != DriverPostgres {
+		return nil, fmt.Errorf("不支持的数据库: %s", driver)
+	}
+	migrations, err := load(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		driver:     driver,
+		migrations: migrations,
+		logger:     logging.Component(logger, "migrations"),
+	}, nil
+}
+
+// load 读取driver目录下的脚本，按版本号排序
+func load(driver string) ([]migration, error) {
+	files, err := scripts.ReadDir(driver)
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移脚本失败: %w", err)
+	}
+
+	byVersion := make(map[string]*migration)
+	for _, file := range files {
+		name := file.Name()
+		data, err := scripts.ReadFile(path.Join(driver, name))
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移脚本 %s 失败: %w", name, err)
+		}
+		version := strings.TrimSuffix(name, ".sql")
+		isDown := strings.HasSuffix(name, downSuffix)
+		if isDown {
+			version = strings.TrimSuffix(name, downSuffix)
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version}
+			byVersion[version] = m
+		}
+		if isDown {
+			m.down = string(data)
+		} else {
+			m.up = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("迁移 %s 只有回滚脚本", m.version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// Up 按顺序执行尚未执行的迁移，返回本次执行的版本
+func (m *Migrator) Up(ctx context.Context) ([]string, error) {
+	var applied []string
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, mig.version, mig.up, m.recordSQL()); err != nil {
+				return err
+			}
+			m.logger.Info("已执行数据库迁移", "version", mig.version)
+			applied = append(applied, mig.version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down 从最新的版本开始回滚steps个已执行的迁移，返回本次回滚的版本
+// 没有回滚脚本或本版本没有内置的迁移不能回滚，遇到时停止并返回错误
+func (m *Migrator) Down(ctx context.Context, steps int) ([]string, error) {
+	var reverted []string
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]string, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+
+		for _, version := range versions {
+			if len(reverted) >= steps {
+				break
+			}
+			mig := m.find(version)
+			if mig == nil {
+				return fmt.Errorf("迁移 %s 不是本版本内置的脚本，请使用执行该迁移的版本回滚", version)
+			}
+			if mig.down == "" {
+				return fmt.Errorf("迁移 %s 没有回滚脚本", version)
+			}
+			if err := m.run(ctx, conn, version, mig.down, m.forgetSQL()); err != nil {
+				return err
+			}
+			m.logger.Info("已回滚数据库迁移", "version", version)
+			reverted = append(reverted, version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status 返回所有内置迁移和数据库中已有执行记录的迁移的状态，按版本号排序
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	defer conn.Close()
+
+	done, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		appliedAt, applied := done[mig.version]
+		statuses = append(statuses, &Status{Version: mig.version, Applied: applied, AppliedAt: appliedAt, Reversible: mig.down != ""})
+		delete(done, mig.version)
+	}
+	for version, appliedAt := range done {
+		statuses = append(statuses, &Status{Version: version, Applied: true, AppliedAt: appliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+func (m *Migrator) find(version string) *migration {
+	for i := range m.migrations {
+		if m.migrations[i].version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// withLock 在持有迁移锁的连接上执行fn，锁与连接绑定，连接归还前释放
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	defer conn.Close()
+
+	lockCtx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+	if m.driver == DriverMySQL {
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(lockCtx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&got); err != nil {
+			return fmt.Errorf("获取迁移锁失败: %w", err)
+		}
+		if got.Int64 != 1 {
+			return fmt.Errorf("获取迁移锁失败: 等待 %s 后其他实例仍在执行迁移", lockTimeout)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	} else {
+		if _, err := conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return fmt.Errorf("获取迁移锁失败: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	}
+	return fn(conn)
+}
+
+// applied 返回已执行的迁移版本和执行时间，迁移记录表不存在时先创建
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[string]time.Time, error) {
+	createSQL := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version VARCHAR(128) NOT NULL PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+	if m.driver == DriverPostgres {
+		createSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(128) PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`
+	}
+	if _, err := conn.ExecContext(ctx, createSQL); err != nil {
+		return nil, fmt.Errorf("创建迁移记录表失败: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("查询迁移记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[string]time.Time)
+	for rows.Next() {
+		var version string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("读取迁移记录失败: %w", err)
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+func (m *Migrator) recordSQL() string {
+	if m.driver == DriverPostgres {
+		return "INSERT INTO schema_migrations (version) VALUES ($1)"
+	}
+	return "INSERT INTO schema_migrations (version) VALUES (?)"
+}
+
+func (m *Migrator) forgetSQL() string {
+	if m.driver == DriverPostgres {
+		return "DELETE FROM schema_migrations WHERE version = $1"
+	}
+	return "DELETE FROM schema_migrations WHERE version = ?"
+}
+
+// run 执行脚本并更新迁移记录
+// PostgreSQL的脚本和记录在同一个事务中执行，失败时整体回滚；MySQL的DDL会隐式提交，逐条执行语句，
+// 失败时已执行的语句保留，脚本按可重复执行编写（IF NOT EXISTS等），修复后重新执行即可
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, version, script, recordSQL string) error {
+	if m.driver == DriverPostgres {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("开始事务失败: %w", err)
+		}
+		defer tx.Rollback()
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("执行迁移 %s 失败: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, recordSQL, version); err != nil {
+			return fmt.Errorf("记录迁移 %s 失败: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("提交事务失败: %w", err)
+		}
+		return nil
+	}
+
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("执行迁移 %s 失败: %w", version, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, recordSQL, version); err != nil {
+		return fmt.Errorf("记录迁移 %s 失败: %w", version, err)
+	}
+	return nil
+}
+
+// splitStatements 把MySQL脚本拆分为单条语句：跳过--注释行，以行尾的分号结束一条语句
+// MySQL驱动默认不允许一次执行多条语句，脚本中的语句不能在行尾以外的位置出现分号结尾
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
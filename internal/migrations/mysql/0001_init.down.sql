@@ -0,0 +1,17 @@
+-- 删除所有表，投票数据一并删除，只用于回滚到空库
+DROP TABLE IF EXISTS `admin_actions`;
+DROP TABLE IF EXISTS `vote_retractions`;
+DROP TABLE IF EXISTS `consumer_offsets`;
+DROP TABLE IF EXISTS `api_keys`;
+DROP TABLE IF EXISTS `result_snapshots`;
+DROP TABLE IF EXISTS `poll_results`;
+DROP TABLE IF EXISTS `vote_idempotency_keys`;
+DROP TABLE IF EXISTS `outbox`;
+DROP TABLE IF EXISTS `vote_logs`;
+DROP TABLE IF EXISTS `projection_state`;
+DROP TABLE IF EXISTS `ticket_stats`;
+DROP TABLE IF EXISTS `ticket_fences`;
+DROP TABLE IF EXISTS `tickets`;
+DROP TABLE IF EXISTS `ticket_history`;
+DROP TABLE IF EXISTS `user_votes`;
+DROP TABLE IF EXISTS `polls`;
@@ -0,0 +1,215 @@
+-- 初始表结构，与引入迁移之前scripts/mysql-master/init.sql创建的表一致，已有的库执行时不做改动
+
+-- 创建投票活动表，candidates为空数组时接受符合vote.username_pattern的任意用户名
+CREATE TABLE IF NOT EXISTS `polls` (
+  `id` VARCHAR(64) NOT NULL,
+  `title` VARCHAR(255) NOT NULL,
+  `candidates` JSON NOT NULL,
+  `starts_at` TIMESTAMP NULL,
+  `ends_at` TIMESTAMP NULL,
+  `shadow` TINYINT(1) NOT NULL DEFAULT 0,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 默认投票活动，不限制候选人
+INSERT IGNORE INTO `polls` (`id`, `title`, `candidates`) VALUES ('default', '默认投票活动', JSON_ARRAY());
+
+-- 创建用户票数表，按投票活动区分，候选人在创建活动或首次得票时插入
+CREATE TABLE IF NOT EXISTS `user_votes` (
+  `poll_id` VARCHAR(64) NOT NULL DEFAULT 'default',
+  `username` VARCHAR(64) NOT NULL,
+  `votes` INT NOT NULL DEFAULT 0,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`poll_id`, `username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 插入默认活动的预设候选人A-Z，修改vote.username_pattern后其他候选人在首次得票时插入
+INSERT IGNORE INTO `user_votes` (`poll_id`, `username`, `votes`) VALUES
+('default', 'A', 0), ('default', 'B', 0), ('default', 'C', 0), ('default', 'D', 0), ('default', 'E', 0),
+('default', 'F', 0), ('default', 'G', 0), ('default', 'H', 0), ('default', 'I', 0), ('default', 'J', 0),
+('default', 'K', 0), ('default', 'L', 0), ('default', 'M', 0), ('default', 'N', 0), ('default', 'O', 0),
+('default', 'P', 0), ('default', 'Q', 0), ('default', 'R', 0), ('default', 'S', 0), ('default', 'T', 0),
+('default', 'U', 0), ('default', 'V', 0), ('default', 'W', 0), ('default', 'X', 0), ('default', 'Y', 0),
+('default', 'Z', 0);
+
+-- 创建票据历史表
+CREATE TABLE IF NOT EXISTS `ticket_history` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `version` VARCHAR(64) NOT NULL,
+  `ticket_value` VARCHAR(128) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expired_at` TIMESTAMP NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_version` (`version`),
+  INDEX `idx_expired_at` (`expired_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建当前活跃票据表
+CREATE TABLE IF NOT EXISTS `tickets` (
+  `version` VARCHAR(64) NOT NULL,
+  `poll_id` VARCHAR(64) NOT NULL DEFAULT 'default',
+  `value` VARCHAR(128) NOT NULL,
+  `remaining_usages` INT NOT NULL,
+  `expires_at` TIMESTAMP NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `fencing_token` BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`version`),
+  INDEX `idx_expires_at` (`expires_at`),
+  INDEX `idx_poll_created_at` (`poll_id`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建票据防护令牌表，记录每个投票活动已写入票据的最大防护令牌，拒绝锁已过期的旧生产者写入
+CREATE TABLE IF NOT EXISTS `ticket_fences` (
+  `poll_id` VARCHAR(64) NOT NULL,
+  `token` BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`poll_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建票据利用率表，票据生成时记录签发次数，轮换时记录实际消耗次数
+CREATE TABLE IF NOT EXISTS `ticket_stats` (
+  `version` VARCHAR(64) NOT NULL,
+  `poll_id` VARCHAR(64) NOT NULL DEFAULT 'default',
+  `issued` INT NOT NULL,
+  `consumed` INT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expires_at` TIMESTAMP NOT NULL,
+  `rotated_at` TIMESTAMP NULL,
+  PRIMARY KEY (`version`),
+  INDEX `idx_poll_created_at` (`poll_id`, `created_at`),
+  INDEX `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建投影进度表，事件溯源模式下记录已投影到user_votes和tickets的最大vote_logs.id
+CREATE TABLE IF NOT EXISTS `projection_state` (
+  `name` VARCHAR(64) NOT NULL,
+  `last_log_id` BIGINT NOT NULL DEFAULT 0,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT IGNORE INTO `projection_state` (`name`, `last_log_id`) VALUES ('votes', 0);
+
+-- 创建投票日志表，actor/source_ip/user_agent记录投票的发起者，用于追溯可疑投票；shadow标记影子模式下的投票，不计入票数；
+-- retracted_at为投票被retractVote撤销的时间，撤销的投票不计入票数
+CREATE TABLE IF NOT EXISTS `vote_logs` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `event_id` VARCHAR(64) NOT NULL,
+  `event_index` INT NOT NULL DEFAULT 0,
+  `poll_id` VARCHAR(64) NOT NULL DEFAULT 'default',
+  `username` VARCHAR(64) NOT NULL,
+  `ticket_version` VARCHAR(64) NOT NULL,
+  `actor` VARCHAR(128) NOT NULL DEFAULT '',
+  `source_ip` VARCHAR(64) NOT NULL DEFAULT '',
+  `user_agent` VARCHAR(255) NOT NULL DEFAULT '',
+  `voted_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `shadow` TINYINT(1) NOT NULL DEFAULT 0,
+  `retracted_at` TIMESTAMP NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_event` (`event_id`, `event_index`),
+  INDEX `idx_actor` (`actor`),
+  INDEX `idx_source_ip` (`source_ip`),
+  INDEX `idx_poll_username` (`poll_id`, `username`),
+  INDEX `idx_poll_id` (`poll_id`, `id`),
+  INDEX `idx_username` (`username`),
+  INDEX `idx_ticket_version` (`ticket_version`),
+  INDEX `idx_voted_at` (`voted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建投票事件发件箱表，投票时与票据扣减在同一事务中写入，由中继任务按id顺序发送到Kafka后删除
+CREATE TABLE IF NOT EXISTS `outbox` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `event_id` VARCHAR(64) NOT NULL,
+  `payload` JSON NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建投票幂等键表，记录已落库投票请求的幂等键，客户端超时重试产生的重复投票不再计票
+-- 拆分后的投票事件共享event_id，同一次投票的各部分可以重复登记同一个键
+CREATE TABLE IF NOT EXISTS `vote_idempotency_keys` (
+  `idempotency_key` VARCHAR(128) NOT NULL,
+  `event_id` VARCHAR(64) NOT NULL,
+  `poll_id` VARCHAR(64) NOT NULL DEFAULT 'default',
+  `ticket_version` VARCHAR(64) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`idempotency_key`),
+  INDEX `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建投票活动结果快照表，定稿后不可修改
+CREATE TABLE IF NOT EXISTS `poll_results` (
+  `poll_id` VARCHAR(64) NOT NULL,
+  `results` JSON NOT NULL,
+  `total_votes` BIGINT NOT NULL,
+  `reconciled_rows` BIGINT NOT NULL DEFAULT 0,
+  `signature` VARCHAR(128) NOT NULL,
+  `finalized_at` TIMESTAMP NOT NULL,
+  PRIMARY KEY (`poll_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TRIGGER IF NOT EXISTS `poll_results_no_update` BEFORE UPDATE ON `poll_results`
+  FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'poll_results is immutable';
+
+CREATE TRIGGER IF NOT EXISTS `poll_results_no_delete` BEFORE DELETE ON `poll_results`
+  FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'poll_results is immutable';
+
+-- 创建排名快照表，定期记录各候选人的票数
+CREATE TABLE IF NOT EXISTS `result_snapshots` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `taken_at` TIMESTAMP NOT NULL,
+  `total_votes` BIGINT NOT NULL,
+  `standings` JSON NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_taken_at` (`taken_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建API密钥表，只保存密钥的SHA-256哈希，明文只在创建时返回一次；scope为read或vote
+CREATE TABLE IF NOT EXISTS `api_keys` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(64) NOT NULL,
+  `key_prefix` VARCHAR(16) NOT NULL,
+  `key_hash` CHAR(64) NOT NULL,
+  `scope` VARCHAR(16) NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `revoked_at` TIMESTAMP NULL DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_key_hash` (`key_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建消费偏移量表，记录计票消费者各分区已落库的最大偏移量，与计票在同一个事务中更新，重放的消息据此跳过
+CREATE TABLE IF NOT EXISTS `consumer_offsets` (
+  `topic` VARCHAR(255) NOT NULL,
+  `partition_id` INT NOT NULL,
+  `last_offset` BIGINT NOT NULL,
+  `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`topic`, `partition_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建投票撤销记录表，只追加不修改，每条投票日志最多撤销一次；id与投票日志id一起作为结果缓存的版本号
+CREATE TABLE IF NOT EXISTS `vote_retractions` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `vote_log_id` BIGINT NOT NULL,
+  `event_id` VARCHAR(64) NOT NULL,
+  `poll_id` VARCHAR(64) NOT NULL DEFAULT 'default',
+  `actor` VARCHAR(128) NOT NULL DEFAULT '',
+  `retracted_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_vote_log` (`vote_log_id`),
+  INDEX `idx_poll_id` (`poll_id`, `id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 创建管理操作审计表，只追加不修改；adminSetUserVotes记录调整前后的票数，delta与投票日志一起计入对账和定稿的票数
+CREATE TABLE IF NOT EXISTS `admin_actions` (
+  `id` BIGINT NOT NULL AUTO_INCREMENT,
+  `action` VARCHAR(32) NOT NULL,
+  `actor` VARCHAR(128) NOT NULL DEFAULT '',
+  `poll_id` VARCHAR(64) NOT NULL DEFAULT 'default',
+  `username` VARCHAR(64) NOT NULL,
+  `previous_votes` INT NOT NULL,
+  `votes` INT NOT NULL,
+  `delta` INT NOT NULL,
+  `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  INDEX `idx_poll_user` (`poll_id`, `username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+ALTER TABLE `outbox`
+  DROP COLUMN `failed_at`,
+  DROP COLUMN `last_error`,
+  DROP COLUMN `attempts`;
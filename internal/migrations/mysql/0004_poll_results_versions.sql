@@ -0,0 +1,6 @@
+-- 投票活动结果的版本号，计票、撤销、管理员调整、投影和对账在改变票数的同一个事务中递增，作为/results的ETag
+CREATE TABLE IF NOT EXISTS `poll_results_versions` (
+  `poll_id` VARCHAR(64) NOT NULL,
+  `version` BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`poll_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+-- 删除初始表结构，投票数据一并删除，只用于回滚到空库
+DROP TABLE IF EXISTS result_snapshots;
+DROP TABLE IF EXISTS poll_results;
+DROP FUNCTION IF EXISTS poll_results_immutable();
+DROP TABLE IF EXISTS vote_idempotency_keys;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS vote_logs;
+DROP TABLE IF EXISTS projection_state;
+DROP TABLE IF EXISTS ticket_stats;
+DROP TABLE IF EXISTS tickets;
+DROP TABLE IF EXISTS ticket_history;
+DROP TABLE IF EXISTS user_votes;
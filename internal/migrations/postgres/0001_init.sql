@@ -0,0 +1,123 @@
+-- 用户票数表，候选人在首次得票时插入
+CREATE TABLE IF NOT EXISTS user_votes (
+  username VARCHAR(64) PRIMARY KEY,
+  votes INT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 预设用户A-Z，与MySQL的初始化脚本一致
+INSERT INTO user_votes (username, votes)
+SELECT chr(code), 0 FROM generate_series(ascii('A'), ascii('Z')) AS code
+ON CONFLICT DO NOTHING;
+
+-- 票据历史表
+CREATE TABLE IF NOT EXISTS ticket_history (
+  id BIGSERIAL PRIMARY KEY,
+  version VARCHAR(64) NOT NULL,
+  ticket_value VARCHAR(128) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expired_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_ticket_history_version ON ticket_history (version);
+CREATE INDEX IF NOT EXISTS idx_ticket_history_expired_at ON ticket_history (expired_at);
+
+-- 当前活跃票据表
+CREATE TABLE IF NOT EXISTS tickets (
+  version VARCHAR(64) PRIMARY KEY,
+  poll_id VARCHAR(64) NOT NULL DEFAULT 'default',
+  value VARCHAR(128) NOT NULL,
+  remaining_usages INT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_tickets_expires_at ON tickets (expires_at);
+CREATE INDEX IF NOT EXISTS idx_tickets_poll_created_at ON tickets (poll_id, created_at);
+
+-- 票据利用率表，票据生成时记录签发次数，轮换时记录实际消耗次数
+CREATE TABLE IF NOT EXISTS ticket_stats (
+  version VARCHAR(64) PRIMARY KEY,
+  poll_id VARCHAR(64) NOT NULL DEFAULT 'default',
+  issued INT NOT NULL,
+  consumed INT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  rotated_at TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS idx_ticket_stats_poll_created_at ON ticket_stats (poll_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ticket_stats_created_at ON ticket_stats (created_at);
+
+-- 投影进度表，事件溯源模式下记录已投影到user_votes和tickets的最大vote_logs.id
+CREATE TABLE IF NOT EXISTS projection_state (
+  name VARCHAR(64) PRIMARY KEY,
+  last_log_id BIGINT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+INSERT INTO projection_state (name, last_log_id) VALUES ('votes', 0) ON CONFLICT DO NOTHING;
+
+-- 投票日志表，actor/source_ip/user_agent记录投票的发起者，用于追溯可疑投票
+CREATE TABLE IF NOT EXISTS vote_logs (
+  id BIGSERIAL PRIMARY KEY,
+  event_id VARCHAR(64) NOT NULL,
+  event_index INT NOT NULL DEFAULT 0,
+  poll_id VARCHAR(64) NOT NULL DEFAULT 'default',
+  username VARCHAR(64) NOT NULL,
+  ticket_version VARCHAR(64) NOT NULL,
+  actor VARCHAR(128) NOT NULL DEFAULT '',
+  source_ip VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent VARCHAR(255) NOT NULL DEFAULT '',
+  voted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT uk_vote_logs_event UNIQUE (event_id, event_index)
+);
+CREATE INDEX IF NOT EXISTS idx_vote_logs_actor ON vote_logs (actor);
+CREATE INDEX IF NOT EXISTS idx_vote_logs_source_ip ON vote_logs (source_ip);
+CREATE INDEX IF NOT EXISTS idx_vote_logs_poll_username ON vote_logs (poll_id, username);
+CREATE INDEX IF NOT EXISTS idx_vote_logs_poll_id ON vote_logs (poll_id, id);
+CREATE INDEX IF NOT EXISTS idx_vote_logs_username ON vote_logs (username);
+CREATE INDEX IF NOT EXISTS idx_vote_logs_ticket_version ON vote_logs (ticket_version);
+
+-- 投票事件发件箱表，投票时与票据扣减在同一事务中写入，由中继任务按id顺序发送到Kafka后删除
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGSERIAL PRIMARY KEY,
+  event_id VARCHAR(64) NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 投票幂等键表，拆分后的投票事件共享event_id，同一次投票的各部分可以重复登记同一个键
+CREATE TABLE IF NOT EXISTS vote_idempotency_keys (
+  idempotency_key VARCHAR(128) PRIMARY KEY,
+  event_id VARCHAR(64) NOT NULL,
+  poll_id VARCHAR(64) NOT NULL DEFAULT 'default',
+  ticket_version VARCHAR(64) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_vote_idempotency_keys_created_at ON vote_idempotency_keys (created_at);
+
+-- 投票活动结果快照表，定稿后不可修改
+CREATE TABLE IF NOT EXISTS poll_results (
+  poll_id VARCHAR(64) PRIMARY KEY,
+  results JSONB NOT NULL,
+  total_votes BIGINT NOT NULL,
+  reconciled_rows BIGINT NOT NULL DEFAULT 0,
+  signature VARCHAR(128) NOT NULL,
+  finalized_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION poll_results_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'poll_results is immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS poll_results_no_update ON poll_results;
+CREATE TRIGGER poll_results_no_update BEFORE UPDATE OR DELETE ON poll_results
+  FOR EACH ROW EXECUTE FUNCTION poll_results_immutable();
+
+-- 排名快照表，定期记录各候选人的票数
+CREATE TABLE IF NOT EXISTS result_snapshots (
+  id BIGSERIAL PRIMARY KEY,
+  taken_at TIMESTAMPTZ NOT NULL,
+  total_votes BIGINT NOT NULL,
+  standings JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_result_snapshots_taken_at ON result_snapshots (taken_at);
@@ -0,0 +1,6 @@
+-- 用户票数恢复为不区分投票活动，其他投票活动的票数被删除
+DELETE FROM user_votes WHERE poll_id <> 'default';
+ALTER TABLE user_votes DROP CONSTRAINT IF EXISTS user_votes_pkey;
+ALTER TABLE user_votes DROP COLUMN IF EXISTS poll_id;
+ALTER TABLE user_votes ADD PRIMARY KEY (username);
+DROP TABLE IF EXISTS polls;
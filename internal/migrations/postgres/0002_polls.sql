@@ -0,0 +1,18 @@
+-- 投票活动表，candidates为空数组时接受符合vote.username_pattern的任意用户名
+CREATE TABLE IF NOT EXISTS polls (
+  id VARCHAR(64) PRIMARY KEY,
+  title VARCHAR(255) NOT NULL,
+  candidates JSONB NOT NULL,
+  starts_at TIMESTAMPTZ NULL,
+  ends_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 默认投票活动，不限制候选人
+INSERT INTO polls (id, title, candidates) VALUES ('default', '默认投票活动', '[]')
+ON CONFLICT DO NOTHING;
+
+-- 用户票数按投票活动区分，已有记录归入默认活动
+ALTER TABLE user_votes ADD COLUMN IF NOT EXISTS poll_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE user_votes DROP CONSTRAINT IF EXISTS user_votes_pkey;
+ALTER TABLE user_votes ADD PRIMARY KEY (poll_id, username);
@@ -0,0 +1,2 @@
+ALTER TABLE vote_logs DROP COLUMN IF EXISTS shadow;
+ALTER TABLE polls DROP COLUMN IF EXISTS shadow;
@@ -0,0 +1,3 @@
+-- 影子模式：投票照常受理并记录日志，但不计入票数
+ALTER TABLE polls ADD COLUMN IF NOT EXISTS shadow BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE vote_logs ADD COLUMN IF NOT EXISTS shadow BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_vote_logs_voted_at;
@@ -0,0 +1,2 @@
+-- 投票日志审计查询按投票时间范围过滤，按用户名和票据版本过滤使用已有的索引
+CREATE INDEX IF NOT EXISTS idx_vote_logs_voted_at ON vote_logs (voted_at);
@@ -0,0 +1,8 @@
+-- 计票消费者各分区已落库的最大偏移量，与计票在同一个事务中更新，重放的消息据此跳过
+CREATE TABLE IF NOT EXISTS consumer_offsets (
+  topic VARCHAR(255) NOT NULL,
+  partition_id INT NOT NULL,
+  last_offset BIGINT NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (topic, partition_id)
+);
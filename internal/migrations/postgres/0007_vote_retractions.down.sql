@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS vote_retractions;
+ALTER TABLE vote_logs DROP COLUMN IF EXISTS retracted_at;
@@ -0,0 +1,13 @@
+-- 撤销投票：retracted_at标记被retractVote撤销的投票日志，撤销的投票不计入票数
+ALTER TABLE vote_logs ADD COLUMN IF NOT EXISTS retracted_at TIMESTAMPTZ;
+
+-- 投票撤销记录，只追加不修改，每条投票日志最多撤销一次；id与投票日志id一起作为结果缓存的版本号
+CREATE TABLE IF NOT EXISTS vote_retractions (
+  id BIGSERIAL PRIMARY KEY,
+  vote_log_id BIGINT NOT NULL UNIQUE,
+  event_id VARCHAR(64) NOT NULL,
+  poll_id VARCHAR(64) NOT NULL DEFAULT 'default',
+  actor VARCHAR(128) NOT NULL DEFAULT '',
+  retracted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_vote_retractions_poll_id ON vote_retractions (poll_id, id);
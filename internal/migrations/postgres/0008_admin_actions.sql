@@ -0,0 +1,13 @@
+-- 管理操作审计，只追加不修改；adminSetUserVotes记录调整前后的票数，delta与投票日志一起计入对账和定稿的票数
+CREATE TABLE IF NOT EXISTS admin_actions (
+  id BIGSERIAL PRIMARY KEY,
+  action VARCHAR(32) NOT NULL,
+  actor VARCHAR(128) NOT NULL DEFAULT '',
+  poll_id VARCHAR(64) NOT NULL DEFAULT 'default',
+  username VARCHAR(64) NOT NULL,
+  previous_votes INT NOT NULL,
+  votes INT NOT NULL,
+  delta INT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_admin_actions_poll_user ON admin_actions (poll_id, username);
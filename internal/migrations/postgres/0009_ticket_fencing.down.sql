@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ticket_fences;
+ALTER TABLE tickets DROP COLUMN IF EXISTS fencing_token;
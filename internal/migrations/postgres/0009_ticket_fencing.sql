@@ -0,0 +1,7 @@
+-- 票据防护令牌，保存票据时拒绝小于已见最大值的令牌，锁已过期的旧生产者不能覆盖新票据
+ALTER TABLE tickets ADD COLUMN IF NOT EXISTS fencing_token BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS ticket_fences (
+  poll_id VARCHAR(64) PRIMARY KEY,
+  token BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,11 @@
+-- 登记的候选人，vote.candidate_validator为registry时只能给登记过的候选人投票，名称长度与user_votes.username一致
+CREATE TABLE IF NOT EXISTS candidates (
+  name VARCHAR(64) PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- 登记原有的候选人A-Z，切换到registry后仍可以给它们投票
+INSERT INTO candidates (name) VALUES
+('A'), ('B'), ('C'), ('D'), ('E'), ('F'), ('G'), ('H'), ('I'), ('J'), ('K'), ('L'), ('M'),
+('N'), ('O'), ('P'), ('Q'), ('R'), ('S'), ('T'), ('U'), ('V'), ('W'), ('X'), ('Y'), ('Z')
+ON CONFLICT (name) DO NOTHING;
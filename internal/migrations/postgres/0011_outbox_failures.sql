@@ -0,0 +1,5 @@
+-- 发件箱中无法解析的事件不再阻塞中继：标记为失败并记录尝试次数和最后一次错误，中继跳过这些行
+ALTER TABLE outbox
+  ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS last_error VARCHAR(512),
+  ADD COLUMN IF NOT EXISTS failed_at TIMESTAMPTZ;
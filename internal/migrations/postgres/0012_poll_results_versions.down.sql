@@ -0,0 +1 @@
+DROP TABLE IF EXISTS poll_results_versions;
@@ -1,23 +1,87 @@
 package model
 
 import (
+	"sort"
 	"time"
 )
 
 // UserVote 用户票数模型
 type UserVote struct {
+	PollID    string    `json:"pollId,omitempty"`
 	Username  string    `json:"username"`
 	Votes     int       `json:"votes"`
 	UpdatedAt time.Time `json:"updatedAt"`
+	// Stale 数据库不可用时返回的最近一次已知票数
+	Stale bool `json:"stale,omitempty"`
+}
+
+// ReadConsistency 查询票数的一致性级别
+type ReadConsistency string
+
+const (
+	// ReadEventual 优先读缓存和从库，刚受理的投票可能尚未体现
+	ReadEventual ReadConsistency = "EVENTUAL"
+	// ReadStrong 不经过缓存和从库，直接读主库
+	ReadStrong ReadConsistency = "STRONG"
+)
+
+// RankUserVotes 按票数从高到低排序，票数相同时按用户名排序
+func RankUserVotes(userVotes []*UserVote) {
+	sort.SliceStable(userVotes, func(i, j int) bool {
+		if userVotes[i].Votes != userVotes[j].Votes {
+			return userVotes[i].Votes > userVotes[j].Votes
+		}
+		return userVotes[i].Username < userVotes[j].Username
+	})
+}
+
+// DefaultPollID 默认投票活动
+const DefaultPollID = "default"
+
+// Candidate 登记的候选人，vote.candidate_validator为registry时只能给登记过的候选人投票
+type Candidate struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Poll 投票活动，候选人列表为空时接受vote.candidate_validator认可的任意用户名
+type Poll struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Candidates []string   `json:"candidates"`
+	StartsAt   *time.Time `json:"startsAt,omitempty"` // 开始投票的时间，为空时创建后立即开始
+	EndsAt     *time.Time `json:"endsAt,omitempty"`   // 结束投票的时间，为空时直到手动定稿
+	Shadow     bool       `json:"shadow"`             // 影子模式下投票照常受理并记录日志，但不计入票数
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// HasCandidate 用户名是否为该活动的候选人，候选人列表为空时不限制
+func (p *Poll) HasCandidate(username string) bool {
+	if len(p.Candidates) == 0 {
+		return true
+	}
+	for _, candidate := range p.Candidates {
+		if candidate == username {
+			return true
+		}
+	}
+	return false
 }
 
 // Ticket 票据模型
 type Ticket struct {
+	PollID          string    `json:"pollId"`
 	Value           string    `json:"value"`
 	Version         string    `json:"version"`
 	RemainingUsages int       `json:"remainingUsages"`
 	ExpiresAt       time.Time `json:"expiresAt"`
-	CreatedAt       time.Time `json:"createdAt"`
+	CreatedAt       time.Time `json:"createdAt"` // 生效时间，预生成的票据在上一张票据过期时生效
+	// FencingToken 生成票据时生产者锁的防护令牌，保存票据时拒绝小于已见最大值的令牌
+	FencingToken int64 `json:"fencingToken,omitempty"`
+	// Holder 客户端绑定模式下票据绑定的客户端，其他模式为空
+	Holder string `json:"holder,omitempty"`
+	// MaxUsages 签发时的最大使用次数，之后修改ticket.max_usage_count不影响已签发的票据；升级前签发的票据为0
+	MaxUsages int `json:"maxUsages,omitempty"`
 }
 
 // TicketHistory 票据历史记录
@@ -29,18 +93,186 @@ type TicketHistory struct {
 	ExpiredAt   time.Time `json:"expiredAt"`
 }
 
+// ProducerInfo 当前票据生产者信息
+type ProducerInfo struct {
+	InstanceID int       `json:"instanceId"`
+	Since      time.Time `json:"since"`
+	RenewedAt  time.Time `json:"renewedAt"`
+}
+
+// PollStats 投票活动的统计数据
+type PollStats struct {
+	PollID            string            `json:"pollId"`
+	TotalVotes        int64             `json:"totalVotes"`
+	VotesPerHour      []*HourlyVotes    `json:"votesPerHour"`
+	UniqueVoters      int64             `json:"uniqueVoters"`      // 按调用方或客户端IP估算的去重投票者数量
+	TicketsIssued     int64             `json:"ticketsIssued"`     // 签发的票据使用次数之和
+	TicketsUsed       int64             `json:"ticketsUsed"`       // 实际消耗的票据使用次数
+	TicketUtilization float64           `json:"ticketUtilization"` // TicketsUsed / TicketsIssued
+	Rejections        []*RejectionCount `json:"rejections"`
+}
+
+// TicketStats 单个票据版本签发与实际消耗的使用次数
+type TicketStats struct {
+	Version   string     `json:"version"`
+	PollID    string     `json:"pollId"`
+	Issued    int        `json:"issued"`
+	Consumed  *int       `json:"consumed,omitempty"` // 票据轮换前为空
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+}
+
+// HourlyVotes 某个整点小时内计入的票数
+type HourlyVotes struct {
+	Hour  time.Time `json:"hour"`
+	Votes int64     `json:"votes"`
+}
+
+// RejectionCount 按原因码统计的投票拒绝次数
+type RejectionCount struct {
+	ReasonCode string `json:"reasonCode"`
+	Count      int64  `json:"count"`
+}
+
+// ServerInfo 进程的运行信息，用于确认每个实例部署的版本
+type ServerInfo struct {
+	Version    string    `json:"version"`
+	Commit     string    `json:"commit"`
+	BuildTime  string    `json:"buildTime,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	InstanceID int       `json:"instanceId"`
+	Role       string    `json:"role"`
+}
+
+// Instance 集群中的服务实例
+type Instance struct {
+	ID          int       `json:"id"`
+	Host        string    `json:"host"`
+	Port        int       `json:"port"`
+	GRPCPort    int       `json:"grpcPort,omitempty"` // 未开启gRPC时为0
+	Role        string    `json:"role"`
+	Version     string    `json:"version"`
+	StartedAt   time.Time `json:"startedAt"`
+	HeartbeatAt time.Time `json:"heartbeatAt"`
+}
+
+// 投票处理管道中的积压来源
+const (
+	QueueSourceKafka    = "kafka"    // 本实例消费的Kafka分区尚未消费的消息
+	QueueSourceProducer = "producer" // 本实例尚未写入Kafka的投票事件
+	QueueSourceOutbox   = "outbox"   // 发件箱中尚未发送到Kafka的投票事件，为集群范围的数量
+)
+
+// QueueDepth 投票处理管道中某一环节积压的待处理数量
+type QueueDepth struct {
+	Source    string `json:"source"`
+	Partition *int   `json:"partition,omitempty"` // Kafka分区，其他来源为空
+	Depth     int64  `json:"depth"`
+}
+
+// QueueStatus 本实例投票处理管道的积压情况
+type QueueStatus struct {
+	InstanceID int           `json:"instanceId"`
+	Depths     []*QueueDepth `json:"depths"`
+	Total      int64         `json:"total"`
+	CheckedAt  time.Time     `json:"checkedAt"`
+}
+
+// OutboxStats 发件箱中尚未发送到Kafka的积压
+type OutboxStats struct {
+	Backlog  int64      `json:"backlog"`
+	OldestAt *time.Time `json:"oldestAt,omitempty"` // 最早一条未发送事件的写入时间，发件箱为空时为空
+	Failed   int64      `json:"failed"`             // 无法解析而标记为失败、中继不再发送的事件数
+}
+
+// OutboxStatus 发件箱中继的状态
+type OutboxStatus struct {
+	OutboxStats
+	Pause      ConsumptionState `json:"pause"`
+	InstanceID int              `json:"instanceId"`
+	Relayed    int64            `json:"relayed"` // 本实例启动以来发送的事件数
+	LastRelay  *time.Time       `json:"lastRelay,omitempty"`
+	CheckedAt  time.Time        `json:"checkedAt"`
+}
+
+// ConsumptionState 集群范围暂停开关的状态，用于投票事件消费和发件箱中继
+type ConsumptionState struct {
+	Paused   bool       `json:"paused"`
+	Reason   string     `json:"reason,omitempty"`
+	PausedBy int        `json:"pausedBy,omitempty"` // 发起暂停的实例ID
+	Since    *time.Time `json:"since,omitempty"`
+}
+
 // VoteLog 投票日志
 type VoteLog struct {
 	ID            int64     `json:"id"`
+	EventID       string    `json:"eventId"`
+	PollID        string    `json:"pollId"`
 	Username      string    `json:"username"`
 	TicketVersion string    `json:"ticketVersion"`
+	Actor         string    `json:"actor,omitempty"`
+	SourceIP      string    `json:"sourceIp,omitempty"`
+	UserAgent     string    `json:"userAgent,omitempty"`
 	VotedAt       time.Time `json:"votedAt"`
+	Shadow        bool      `json:"shadow"` // 影子模式下的投票，不计入票数
+	// RetractedAt 投票被撤销的时间，未撤销时为nil
+	RetractedAt *time.Time `json:"retractedAt,omitempty"`
+}
+
+// VoteLogFilter 投票日志审计查询的条件，结果按id从新到旧排列
+type VoteLogFilter struct {
+	Username      string    // 为空时不限制
+	TicketVersion string    // 为空时不限制
+	From          time.Time // 投票时间下限（含），为零值时不限制
+	To            time.Time // 投票时间上限（不含），为零值时不限制
+	BeforeID      int64     // 只返回id小于该值的投票日志，为0时从最新一条开始
+	Limit         int
+}
+
+// VoteImport 一次投票导入的结果，导入的投票以合成的票据版本写入投票日志
+type VoteImport struct {
+	ID            string // 导入批次，相同批次重复导入不会重复计票
+	TicketVersion string // 合成的票据版本，import-<批次>
+	DryRun        bool   // 只校验不导入
+	Rows          int
+	Votes         int
+	Events        int // 写入发件箱的投票事件数，试运行时为将要写入的事件数
+}
+
+// VoteAudit 投票的来源信息，随投票事件写入投票日志，用于追溯投票的发起者
+type VoteAudit struct {
+	Actor     string `json:"actor,omitempty"`     // 已认证的调用方，未认证时为空
+	SourceIP  string `json:"sourceIp,omitempty"`  // 客户端IP
+	UserAgent string `json:"userAgent,omitempty"` // 客户端User-Agent
+	RequestID string `json:"requestId,omitempty"` // 受理投票的请求ID，随投票事件进入Kafka，消费时附加到日志
+}
+
+// Principal 客户端绑定模式下票据绑定的调用方，由服务端确定而不采信客户端声明的X-Client-ID：
+// 已认证时为API密钥的调用方，否则为客户端IP；两者都为空时返回空
+func (a VoteAudit) Principal() string {
+	if a.Actor != "" {
+		return a.Actor
+	}
+	if a.SourceIP != "" {
+		return "ip:" + a.SourceIP
+	}
+	return ""
+}
+
+// Principal 投票时的调用方，与VoteAudit.Principal相同：已认证时为API密钥的调用方，否则为客户端IP
+func (l *VoteLog) Principal() string {
+	return VoteAudit{Actor: l.Actor, SourceIP: l.SourceIP}.Principal()
 }
 
 // VoteRequest 投票请求
 type VoteRequest struct {
-	Usernames []string `json:"usernames"`
-	Ticket    Ticket   `json:"ticket"`
+	Usernames []string  `json:"usernames"`
+	Ticket    Ticket    `json:"ticket"`
+	ClientID  string    `json:"-"` // 发起请求的客户端，用于抑制重复提交
+	Audit     VoteAudit `json:"-"`
+	// IdempotencyKey 客户端生成的幂等键，超时重试时携带相同的键，同一个键只计票一次
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
 }
 
 // VoteResponse 投票响应
@@ -49,11 +281,221 @@ type VoteResponse struct {
 	Message   string    `json:"message"`
 	Usernames []string  `json:"usernames"`
 	Timestamp time.Time `json:"timestamp"`
+	// RemainingUsages 投票后票据的剩余使用次数，未使用票据时为空
+	RemainingUsages *int `json:"remainingUsages,omitempty"`
+	// Receipt 签名的投票回执，可通过verifyReceipt确认投票已落库
+	Receipt string `json:"receipt,omitempty"`
+	// EventID 投票事件ID，以STRONG一致性查询票数时可通过afterEventId等待该投票落库
+	EventID string `json:"eventId,omitempty"`
+	// ReasonCode 投票失败的原因码，投票成功时为空
+	ReasonCode VoteReasonCode `json:"reasonCode,omitempty"`
+}
+
+// VoteReasonCode 投票失败原因码，前端据此展示对应的提示而不必解析message
+type VoteReasonCode string
+
+const (
+	VoteReasonTicketExpired    VoteReasonCode = "TICKET_EXPIRED"    // 票据已过期或已被新版本替换
+	VoteReasonTicketExhausted  VoteReasonCode = "TICKET_EXHAUSTED"  // 票据使用次数或活动预算已耗尽
+	VoteReasonInvalidCandidate VoteReasonCode = "INVALID_CANDIDATE" // 候选人不合法
+	VoteReasonWindowClosed     VoteReasonCode = "WINDOW_CLOSED"     // 投票活动未开始或已结束
+	VoteReasonRateLimited      VoteReasonCode = "RATE_LIMITED"      // 请求过于频繁
+	VoteReasonDuplicate        VoteReasonCode = "DUPLICATE"         // 相同的投票请求正在处理中
+	// VoteReasonReservationExpired 投票预约不存在、已确认或已超时释放
+	VoteReasonReservationExpired VoteReasonCode = "RESERVATION_EXPIRED"
+)
+
+// TicketWarning 当前票据剩余使用次数降到预警值以下
+type TicketWarning struct {
+	PollID          string    `json:"pollId"`
+	TicketVersion   string    `json:"ticketVersion"`
+	RemainingUsages int       `json:"remainingUsages"`
+	Threshold       int       `json:"threshold"`
+	ExpiresAt       time.Time `json:"expiresAt"` // 票据过期时间，之前会轮换出新票据
+}
+
+// TicketAbuse 客户端票据校验失败次数过多，已被暂时禁止使用票据
+type TicketAbuse struct {
+	PollID       string    `json:"pollId"`
+	ClientID     string    `json:"clientId,omitempty"`
+	SourceIP     string    `json:"sourceIp,omitempty"`
+	Subject      string    `json:"subject"`  // 达到阈值的标识，client:<客户端ID>或ip:<IP>
+	Failures     int       `json:"failures"` // 窗口内的失败次数
+	BlockedUntil time.Time `json:"blockedUntil"`
+}
+
+// VoteReservation 两阶段投票中已占用一次票据使用次数、等待确认的投票
+type VoteReservation struct {
+	Token           string    `json:"token"`
+	PollID          string    `json:"pollId"`
+	Usernames       []string  `json:"usernames"`
+	TicketVersion   string    `json:"ticketVersion"`
+	RemainingUsages int       `json:"remainingUsages"` // 占用后票据的剩余使用次数
+	Audit           VoteAudit `json:"audit"`
+	IdempotencyKey  string    `json:"idempotencyKey,omitempty"`
+	ExpiresAt       time.Time `json:"expiresAt"` // 超过该时间未确认时自动释放占用的使用次数
+	// Holder 客户端绑定模式下占用配额的客户端，释放时一并归还
+	Holder string `json:"holder,omitempty"`
 }
 
 // VoteEvent Kafka投票事件
 type VoteEvent struct {
+	EventID       string    `json:"eventId"`
+	Index         int       `json:"index"` // 拆分后的事件中第一个用户在原投票中的序号，未拆分时为0
+	PollID        string    `json:"pollId"`
 	Usernames     []string  `json:"usernames"`
 	TicketVersion string    `json:"ticketVersion"`
+	Audit         VoteAudit `json:"audit"`
 	VotedAt       time.Time `json:"votedAt"`
+	// IdempotencyKey 投票请求的幂等键，落库时登记，已被其他投票事件使用的键不再计票
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// TicketConsumed 票据剩余次数已在写入发件箱时扣减，消费时不再扣减
+	TicketConsumed bool `json:"ticketConsumed,omitempty"`
+	// Shadow 受理时投票活动处于影子模式，只记录投票日志，不计入票数和统计
+	Shadow bool `json:"shadow,omitempty"`
+	// Retraction 撤销投票的补偿事件携带被撤销的投票日志，此时Usernames为空，升级前的消费者会当作空投票忽略
+	Retraction *VoteRetraction `json:"retraction,omitempty"`
+	// Source 消费者读取该事件的Kafka消息位置，不随事件序列化，落库时与计票一起登记
+	Source *EventSource `json:"-"`
+}
+
+// ProcessedVote 已落库的投票事件，通过WebSocket推送给订阅的客户端
+type ProcessedVote struct {
+	EventID   string   `json:"eventId"`
+	PollID    string   `json:"pollId"`
+	Usernames []string `json:"usernames"` // 撤销投票时为被撤销投票的用户
+	Applied   int      `json:"applied"`   // 实际生效的票数，部分投票此前已落库时小于用户数
+	// Retracted 撤销投票的补偿事件，票数已扣减
+	Retracted   bool      `json:"retracted,omitempty"`
+	VotedAt     time.Time `json:"votedAt"`
+	ProcessedAt time.Time `json:"processedAt"`
+}
+
+// VoteRetraction 被撤销的一票
+type VoteRetraction struct {
+	VoteLogID int64  `json:"voteLogId"`
+	Username  string `json:"username"` // 被撤销投票的用户，补偿事件据此分区，与该用户的投票保持顺序
+}
+
+// RetractVoteResponse 撤销投票的受理结果，补偿事件经Kafka落库后票数才会扣减
+type RetractVoteResponse struct {
+	VoteLogID int64  `json:"voteLogId"`
+	EventID   string `json:"eventId"` // 补偿事件的ID
+	PollID    string `json:"pollId"`
+	Username  string `json:"username"`
+}
+
+// AdminActionSetUserVotes 管理员直接设置用户票数
+const AdminActionSetUserVotes = "set_user_votes"
+
+// AdminAction 管理操作的审计记录，只追加不修改
+type AdminAction struct {
+	ID            int64     `json:"id"`
+	Action        string    `json:"action"`
+	Actor         string    `json:"actor"`
+	PollID        string    `json:"pollId"`
+	Username      string    `json:"username"`
+	PreviousVotes int       `json:"previousVotes"` // 调整前的票数
+	Votes         int       `json:"votes"`         // 调整后的票数
+	Delta         int       `json:"delta"`         // Votes-PreviousVotes，对账和定稿时与投票日志一起计入票数
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// EventSource 投票事件所在的Kafka分区和偏移量
+type EventSource struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// VoteIdempotencyRecord 已落库投票的幂等键
+type VoteIdempotencyRecord struct {
+	Key           string
+	EventID       string
+	PollID        string
+	TicketVersion string
+	CreatedAt     time.Time
+}
+
+// ReceiptVerification 投票回执校验结果
+type ReceiptVerification struct {
+	EventID       string     `json:"eventId"`
+	TicketVersion string     `json:"ticketVersion"`
+	Usernames     []string   `json:"usernames"`
+	Recorded      bool       `json:"recorded"`             // 回执中的所有投票均已写入vote_logs
+	RecordedAt    *time.Time `json:"recordedAt,omitempty"` // 最后一条投票日志的写入时间
+}
+
+// ResultSnapshot 某一时刻各候选人的票数
+type ResultSnapshot struct {
+	ID         int64       `json:"id"`
+	TakenAt    time.Time   `json:"takenAt"`
+	TotalVotes int64       `json:"totalVotes"`
+	Standings  []*UserVote `json:"standings"`
+}
+
+// PollResults 投票活动的结果，定稿后为不可变的签名快照
+type PollResults struct {
+	PollID      string      `json:"pollId"`
+	Results     []*UserVote `json:"results"`
+	TotalVotes  int64       `json:"totalVotes"`
+	Finalized   bool        `json:"finalized"`
+	FinalizedAt *time.Time  `json:"finalizedAt,omitempty"`
+	Signature   string      `json:"signature,omitempty"`
+	Reconciled  int64       `json:"reconciled"` // 定稿前对账修正的用户票数记录数
+}
+
+// APIKey 调用GraphQL接口的API密钥，服务端只保存密钥的哈希
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"` // 密钥的前几个字符，用于辨认
+	KeyHash   string     `json:"-"`
+	Scope     string     `json:"scope"` // read: 只能查询; vote: 查询和投票
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// VoteCountMismatch user_votes中的票数与按投票日志统计的票数（计入管理员调整）不一致的用户
+type VoteCountMismatch struct {
+	PollID      string `json:"pollId"`
+	Username    string `json:"username"`
+	Votes       int    `json:"votes"`       // user_votes中的票数
+	LoggedVotes int    `json:"loggedVotes"` // 按投票日志统计的票数
+}
+
+// CacheMismatch Redis中缓存的票数与主库user_votes中的票数不一致的用户
+type CacheMismatch struct {
+	PollID      string `json:"pollId"`
+	Username    string `json:"username"`
+	CachedVotes int    `json:"cachedVotes"` // Redis中缓存的票数
+	Votes       int    `json:"votes"`       // 主库user_votes中的票数
+}
+
+// PartitionLag 消费者组在一个分区上尚未消费的消息数
+type PartitionLag struct {
+	Topic     string `json:"topic"`
+	GroupID   string `json:"groupId"` // 静态分配模式下为空，已消费的偏移量取自consumer_offsets
+	Partition int    `json:"partition"`
+	Committed int64  `json:"committed"` // 下一条待消费消息的偏移量，没有提交过时为-1
+	End       int64  `json:"end"`       // 分区末尾的偏移量
+	Lag       int64  `json:"lag"`
+}
+
+// ConsistencyReport 一次一致性检查的结果
+type ConsistencyReport struct {
+	VoteMismatches    []*VoteCountMismatch `json:"voteMismatches"`
+	CacheMismatches   []*CacheMismatch     `json:"cacheMismatches"`
+	Lags              []*PartitionLag      `json:"lags"`
+	TotalLag          int64                `json:"totalLag"`
+	LagError          string               `json:"lagError,omitempty"` // 查询消费积压失败的原因，此时Lags为空
+	Repaired          bool                 `json:"repaired"`
+	RepairedVotes     int64                `json:"repairedVotes"`     // 修正的user_votes记录数
+	InvalidatedCaches int                  `json:"invalidatedCaches"` // 删除的用户票数缓存数
+	CheckedAt         time.Time            `json:"checkedAt"`
+}
+
+// Consistent 票数和缓存是否都一致，消费积压不影响结果
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.VoteMismatches) == 0 && len(r.CacheMismatches) == 0
 }
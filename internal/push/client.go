@@ -0,0 +1,91 @@
+package push
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeTimeout 向客户端写入一条消息的超时时间
+	writeTimeout = 10 * time.Second
+	// maxMessageBytes 客户端发来的消息的最大字节数，客户端只需回复pong
+	maxMessageBytes = 512
+)
+
+// client 一个WebSocket连接，写入只在writeLoop中进行
+type client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	filter    filter
+	remote    string
+	send      chan []byte
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, filter filter, remote string) *client {
+	return &client{
+		hub:    hub,
+		conn:   conn,
+		filter: filter,
+		remote: remote,
+		send:   make(chan []byte, hub.sendBuffer),
+		closed: make(chan struct{}),
+	}
+}
+
+// close 通知writeLoop发送关闭帧并关闭连接，可重复调用
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+}
+
+// readLoop 读取并丢弃客户端消息以处理pong和关闭帧，超过两个ping间隔未收到任何消息时断开
+func (c *client) readLoop() {
+	defer c.hub.unregister(c)
+
+	c.conn.SetReadLimit(maxMessageBytes)
+	deadline := 2 * c.hub.pingInterval
+	c.conn.SetReadDeadline(time.Now().Add(deadline))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(deadline))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(deadline))
+	}
+}
+
+// writeLoop 发送投票事件和定时ping，连接关闭或写入失败时退出并关闭连接
+func (c *client) writeLoop() {
+	ticker := time.NewTicker(c.hub.pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.hub.unregister(c)
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				c.hub.unregister(c)
+				return
+			}
+		case <-c.closed:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeTimeout))
+			return
+		}
+	}
+}
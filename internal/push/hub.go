@@ -0,0 +1,263 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/auth"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+const (
+	// DefaultPath push.path为空时WebSocket端点的路径
+	DefaultPath = "/ws"
+	// defaultSendBuffer 未配置push.send_buffer时每个连接待发送的事件数上限
+	defaultSendBuffer = 256
+	// defaultPingInterval 未配置push.ping_interval时向客户端发送ping的间隔
+	defaultPingInterval = 30 * time.Second
+	// resubscribeDelay 订阅投票事件失败后重新订阅的等待时间
+	resubscribeDelay = time.Second
+)
+
+// Subscriber 接收各实例落库后发布的投票事件，由RedisRepository实现
+type Subscriber interface {
+	SubscribeProcessedVotes(ctx context.Context, handle func(*model.ProcessedVote)) error
+}
+
+// Hub 通过Redis频道接收所有实例落库的投票事件，推送给连接到本实例的WebSocket客户端
+// 需位于请求上下文和API密钥认证中间件之内
+type Hub struct {
+	subscriber   Subscriber
+	upgrader     websocket.Upgrader
+	sendBuffer   int
+	pingInterval time.Duration
+
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+	logger  *slog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewHub 创建推送中心，调用Start后开始接收投票事件
+func NewHub(subscriber Subscriber, logger *slog.Logger) *Hub {
+	sendBuffer := config.AppConfig.Push.SendBuffer
+	if sendBuffer <= 0 {
+		sendBuffer = defaultSendBuffer
+	}
+	pingInterval := config.AppConfig.Push.PingInterval
+	if pingInterval <= 0 {
+		pingInterval = defaultPingInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Hub{
+		subscriber: subscriber,
+		// 认证只使用请求头中的API密钥而不使用Cookie，允许跨域页面连接
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		sendBuffer:   sendBuffer,
+		pingInterval: pingInterval,
+		clients:      make(map[*client]struct{}),
+		logger:       logging.Component(logger, "push"),
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+}
+
+// Path 返回WebSocket端点的路径
+func Path() string {
+	if config.AppConfig.Push.Path != "" {
+		return config.AppConfig.Push.Path
+	}
+	return DefaultPath
+}
+
+// Start 开始接收投票事件
+func (h *Hub) Start() {
+	go h.subscribe()
+	h.logger.Info("WebSocket推送已启用", "path", Path())
+}
+
+// Stop 停止接收投票事件并断开所有客户端
+func (h *Hub) Stop() {
+	h.cancel()
+	<-h.done
+
+	h.mu.Lock()
+	clients := h.clients
+	h.clients = make(map[*client]struct{})
+	h.mu.Unlock()
+	for c := range clients {
+		c.close()
+	}
+	metrics.PushConnections.Set(0)
+}
+
+// subscribe 订阅投票事件，订阅中断期间的事件不会补发
+func (h *Hub) subscribe() {
+	defer close(h.done)
+	for {
+		err := h.subscriber.SubscribeProcessedVotes(h.ctx, h.broadcast)
+		if h.ctx.Err() != nil {
+			return
+		}
+		h.logger.Warn("接收投票事件中断，稍后重新订阅", "delay", resubscribeDelay, "error", err)
+
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// broadcast 把投票事件发送给过滤条件匹配的客户端，待发送事件已写满的客户端直接断开，不阻塞其他客户端
+func (h *Hub) broadcast(vote *model.ProcessedVote) {
+	var message []byte
+	var slow []*client
+
+	h.mu.RLock()
+	for c := range h.clients {
+		if !c.filter.matches(vote) {
+			continue
+		}
+		if message == nil {
+			data, err := json.Marshal(vote)
+			if err != nil {
+				h.mu.RUnlock()
+				h.logger.Error("序列化投票事件失败", "event_id", vote.EventID, "error", err)
+				return
+			}
+			message = data
+		}
+		select {
+		case c.send <- message:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range slow {
+		h.logger.Warn("WebSocket客户端接收过慢，断开连接", "remote", c.remote)
+		metrics.PushDisconnectedSlow.Inc()
+		h.unregister(c)
+	}
+}
+
+// ServeHTTP 把请求升级为WebSocket连接并推送投票事件
+// 查询参数pollId只接收该投票活动的事件，usernames（逗号分隔，可重复）只接收涉及这些用户的事件，均为空时接收全部事件
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := auth.Authorize(r.Context(), auth.ScopeRead); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade已向客户端返回错误
+		h.logger.Debug("升级WebSocket连接失败", "error", err)
+		return
+	}
+
+	c := newClient(h, conn, filter, r.RemoteAddr)
+	if !h.register(c) {
+		conn.Close()
+		return
+	}
+	go c.writeLoop()
+	c.readLoop()
+}
+
+// register 登记客户端，推送中心已停止时返回false
+func (h *Hub) register(c *client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ctx.Err() != nil {
+		return false
+	}
+	h.clients[c] = struct{}{}
+	metrics.PushConnections.Set(float64(len(h.clients)))
+	return true
+}
+
+// unregister 移除并断开客户端，可重复调用
+func (h *Hub) unregister(c *client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	metrics.PushConnections.Set(float64(len(h.clients)))
+	h.mu.Unlock()
+	c.close()
+}
+
+// filter 客户端订阅的投票事件，字段为空时不按该字段过滤
+type filter struct {
+	pollID    string
+	usernames map[string]struct{}
+}
+
+func parseFilter(r *http.Request) (filter, error) {
+	params := r.URL.Query()
+	var f filter
+	if pollID := params.Get("pollId"); pollID != "" {
+		validated, err := validation.ValidatePollID("pollId", pollID)
+		if err != nil {
+			return f, err
+		}
+		f.pollID = validated
+	}
+
+	var usernames []string
+	for _, value := range params["usernames"] {
+		for _, username := range strings.Split(value, ",") {
+			if username = strings.TrimSpace(username); username != "" {
+				usernames = append(usernames, username)
+			}
+		}
+	}
+	if len(usernames) > 0 {
+		if err := validation.ValidateUsernames("usernames", usernames); err != nil {
+			return f, err
+		}
+		f.usernames = make(map[string]struct{}, len(usernames))
+		for _, username := range usernames {
+			f.usernames[username] = struct{}{}
+		}
+	}
+	return f, nil
+}
+
+func (f filter) matches(vote *model.ProcessedVote) bool {
+	if f.pollID != "" && f.pollID != vote.PollID {
+		return false
+	}
+	if len(f.usernames) == 0 {
+		return true
+	}
+	for _, username := range vote.Usernames {
+		if _, ok := f.usernames[username]; ok {
+			return true
+		}
+	}
+	return false
+}
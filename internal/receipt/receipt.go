@@ -0,0 +1,97 @@
+package receipt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+var (
+	// ErrNotConfigured 未配置回执签名密钥
+	ErrNotConfigured = errors.New("未配置投票回执密钥")
+	// ErrInvalid 回执格式错误或签名不匹配
+	ErrInvalid = errors.New("投票回执无效")
+)
+
+// Receipt 投票回执内容
+type Receipt struct {
+	EventID       string
+	TicketVersion string
+	Usernames     []string
+}
+
+// NewEventID 生成投票事件ID，同一次投票写入的所有投票日志共用该ID
+func NewEventID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// Sign 生成回执令牌，格式为 base64(回执内容).base64(HMAC-SHA256签名)
+func Sign(r *Receipt) (string, error) {
+	secret := config.AppConfig.Vote.ReceiptSecret
+	if secret == "" {
+		return "", ErrNotConfigured
+	}
+
+	payload := encodePayload(r)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(sign(secret, payload)), nil
+}
+
+// Parse 校验回执令牌的签名并解析回执内容
+func Parse(token string) (*Receipt, error) {
+	secret := config.AppConfig.Vote.ReceiptSecret
+	if secret == "" {
+		return nil, ErrNotConfigured
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	if !hmac.Equal(signature, sign(secret, payload)) {
+		return nil, ErrInvalid
+	}
+
+	return decodePayload(payload)
+}
+
+// encodePayload 回执内容: eventId|ticketVersion|A,B,...
+func encodePayload(r *Receipt) []byte {
+	return []byte(r.EventID + "|" + r.TicketVersion + "|" + strings.Join(r.Usernames, ","))
+}
+
+func decodePayload(payload []byte) (*Receipt, error) {
+	parts := strings.SplitN(string(payload), "|", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, ErrInvalid
+	}
+	return &Receipt{
+		EventID:       parts[0],
+		TicketVersion: parts[1],
+		Usernames:     strings.Split(parts[2], ","),
+	}, nil
+}
+
+func sign(secret string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
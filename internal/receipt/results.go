@@ -0,0 +1,34 @@
+package receipt
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// ErrResultsNotConfigured 未配置结果快照签名密钥
+var ErrResultsNotConfigured = errors.New("未配置结果快照签名密钥")
+
+// SignResults 对投票活动的结果快照签名，签名内容为 pollId|定稿时间|A=票数,B=票数,...|总票数
+func SignResults(results *model.PollResults) (string, error) {
+	secret := config.AppConfig.Vote.ResultsSecret
+	if secret == "" {
+		return "", ErrResultsNotConfigured
+	}
+	if results.FinalizedAt == nil {
+		return "", fmt.Errorf("结果快照缺少定稿时间")
+	}
+
+	counts := make([]string, 0, len(results.Results))
+	for _, userVote := range results.Results {
+		counts = append(counts, fmt.Sprintf("%s=%d", userVote.Username, userVote.Votes))
+	}
+	payload := fmt.Sprintf("%s|%d|%s|%d",
+		results.PollID, results.FinalizedAt.Unix(), strings.Join(counts, ","), results.TotalVotes)
+
+	return hex.EncodeToString(sign(secret, []byte(payload))), nil
+}
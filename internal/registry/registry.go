@@ -0,0 +1,208 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// InstancePrefix 实例注册信息在etcd中的键前缀
+	InstancePrefix = "/littlevote/instances/"
+
+	defaultInstanceTTL = 30 * time.Second
+)
+
+// 实例角色
+const (
+	RoleProducer = "producer" // 当前的票据生产者
+	RoleWorker   = "worker"   // 普通读写节点
+	RoleReplica  = "replica"  // 只读副本，只提供查询
+)
+
+// Registry 基于etcd租约的集群成员注册表，实例下线或心跳中断后注册信息随租约自动过期
+type Registry struct {
+	client *clientv3.Client
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	self     *model.Instance
+	roleFunc func() string
+	leaseID  clientv3.LeaseID
+	cancel   context.CancelFunc
+}
+
+func NewRegistry(logger *slog.Logger) (*Registry, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   config.AppConfig.ETCD.Endpoints,
+		DialTimeout: config.AppConfig.ETCD.DialTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建etcd客户端失败: %v", err)
+	}
+
+	return &Registry{client: cli, logger: logging.Component(logger, "registry")}, nil
+}
+
+// Register 注册当前实例并启动心跳，roleFunc在每次心跳时提供实例的最新角色
+func (r *Registry) Register(self *model.Instance, roleFunc func() string) error {
+	ttl := config.AppConfig.ETCD.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultInstanceTTL
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+	grantResp, err := r.client.Grant(ctx, int64(ttl/time.Second))
+	cancel()
+	if err != nil {
+		return fmt.Errorf("创建实例租约失败: %v", err)
+	}
+
+	r.mu.Lock()
+	r.self = self
+	r.roleFunc = roleFunc
+	r.leaseID = grantResp.ID
+	r.mu.Unlock()
+
+	if err := r.heartbeat(); err != nil {
+		return err
+	}
+
+	keepAliveCtx, keepAliveCancel := context.WithCancel(context.Background())
+	r.cancel = keepAliveCancel
+	go r.keepAlive(keepAliveCtx, ttl/3)
+
+	r.logger.Info("实例已注册到集群", "instance", self.ID, "host", self.Host, "port", self.Port)
+	return nil
+}
+
+// heartbeat 续约并刷新实例的注册信息
+func (r *Registry) heartbeat() error {
+	r.mu.Lock()
+	instance := *r.self
+	if r.roleFunc != nil {
+		instance.Role = r.roleFunc()
+	}
+	instance.HeartbeatAt = time.Now()
+	leaseID := r.leaseID
+	r.mu.Unlock()
+
+	data, err := json.Marshal(&instance)
+	if err != nil {
+		return fmt.Errorf("序列化实例信息失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+	defer cancel()
+
+	if _, err := r.client.KeepAliveOnce(ctx, leaseID); err != nil {
+		return fmt.Errorf("实例租约续约失败: %v", err)
+	}
+	if _, err := r.client.Put(ctx, instanceKey(instance.ID), string(data), clientv3.WithLease(leaseID)); err != nil {
+		return fmt.Errorf("写入实例信息失败: %v", err)
+	}
+	return nil
+}
+
+// keepAlive 定期发送心跳，租约丢失时重新注册
+func (r *Registry) keepAlive(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.heartbeat(); err != nil {
+				r.logger.Warn("实例心跳失败，尝试重新注册", "error", err)
+				r.reRegister()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reRegister 租约过期后申请新租约
+func (r *Registry) reRegister() {
+	ttl := config.AppConfig.ETCD.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultInstanceTTL
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+	grantResp, err := r.client.Grant(ctx, int64(ttl/time.Second))
+	cancel()
+	if err != nil {
+		r.logger.Error("重新创建实例租约失败", "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	r.leaseID = grantResp.ID
+	r.mu.Unlock()
+
+	if err := r.heartbeat(); err != nil {
+		r.logger.Error("重新注册实例失败", "error", err)
+	}
+}
+
+// ListInstances 列出集群中所有存活的实例，按实例ID排序
+func (r *Registry) ListInstances() ([]*model.Instance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+	defer cancel()
+
+	resp, err := r.client.Get(ctx, InstancePrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("查询集群实例失败: %v", err)
+	}
+
+	instances := make([]*model.Instance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var instance model.Instance
+		if err := json.Unmarshal(kv.Value, &instance); err != nil {
+			r.logger.Warn("解析实例信息失败", "key", string(kv.Key), "error", err)
+			continue
+		}
+		instances = append(instances, &instance)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances, nil
+}
+
+// Close 注销当前实例并关闭etcd客户端
+func (r *Registry) Close() error {
+	if r.cancel != nil {
+		r.cancel()
+	}
+
+	r.mu.Lock()
+	leaseID := r.leaseID
+	r.mu.Unlock()
+
+	if leaseID != 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), config.AppConfig.ETCD.RequestTimeout)
+		if _, err := r.client.Revoke(ctx, leaseID); err != nil {
+			r.logger.Error("注销实例失败", "error", err)
+		}
+		cancel()
+	}
+
+	return r.client.Close()
+}
+
+func instanceKey(id int) string {
+	return InstancePrefix + strconv.Itoa(id)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// SetUserVotes 在一个事务中把用户票数设置为action.Votes并追加审计记录，回填调整前的票数、差值、ID和时间
+// 用户尚无票数记录时按0票插入；行锁保证与并发计票串行，差值以锁定后读到的票数计算
+func (r *MySQLRepository) SetUserVotes(action *model.AdminAction) error {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+
+	if _, err := tx.Exec("INSERT IGNORE INTO user_votes (poll_id, username, votes) VALUES (?, ?, 0)",
+		action.PollID, action.Username); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("补齐用户 %s 票数记录失败: %w", action.Username, err)
+	}
+	if err := tx.QueryRow("SELECT votes FROM user_votes WHERE poll_id = ? AND username = ? FOR UPDATE",
+		action.PollID, action.Username).Scan(&action.PreviousVotes); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("查询用户 %s 票数失败: %w", action.Username, err)
+	}
+	action.Delta = action.Votes - action.PreviousVotes
+
+	if _, err := tx.Exec("UPDATE user_votes SET votes = ? WHERE poll_id = ? AND username = ?",
+		action.Votes, action.PollID, action.Username); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("设置用户 %s 票数失败: %w", action.Username, err)
+	}
+	if err := bumpResultsVersionTx(tx, action.PollID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	action.CreatedAt = time.Now()
+	result, err := tx.Exec(`INSERT INTO admin_actions (action, actor, poll_id, username, previous_votes, votes, delta, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, action.Action, action.Actor, action.PollID, action.Username,
+		action.PreviousVotes, action.Votes, action.Delta, action.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("记录管理操作失败: %w", err)
+	}
+	if action.ID, err = result.LastInsertId(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("获取管理操作ID失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
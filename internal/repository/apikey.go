@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// ErrAPIKeyNotFound API密钥不存在或已吊销
+var ErrAPIKeyNotFound = errors.New("API_KEY_NOT_FOUND: API密钥不存在或已吊销")
+
+const selectAPIKeySQL = "SELECT id, name, key_prefix, key_hash, scope, created_at, revoked_at FROM api_keys"
+
+// CreateAPIKey 保存API密钥的哈希，写入后回填ID和创建时间
+func (r *MySQLRepository) CreateAPIKey(key *model.APIKey) error {
+	result, err := r.masterDB.Exec("INSERT INTO api_keys (name, key_prefix, key_hash, scope, created_at) VALUES (?, ?, ?, ?, ?)",
+		key.Name, key.Prefix, key.KeyHash, key.Scope, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("保存API密钥失败: %w", err)
+	}
+	if key.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("获取API密钥ID失败: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash 按哈希查询API密钥，包括已吊销的，不存在时返回nil；读主库以便创建后立即可用
+func (r *MySQLRepository) GetAPIKeyByHash(hash string) (*model.APIKey, error) {
+	key, err := scanAPIKey(r.masterDB.QueryRow(selectAPIKeySQL+" WHERE key_hash = ?", hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询API密钥失败: %w", err)
+	}
+	return key, nil
+}
+
+// RevokeAPIKey 吊销API密钥并返回吊销后的记录，不存在或已吊销时返回ErrAPIKeyNotFound
+func (r *MySQLRepository) RevokeAPIKey(id int64) (*model.APIKey, error) {
+	result, err := r.masterDB.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL", id)
+	if err != nil {
+		return nil, fmt.Errorf("吊销API密钥失败: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("获取API密钥吊销结果失败: %w", err)
+	}
+	if updated == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id)
+	}
+
+	key, err := scanAPIKey(r.masterDB.QueryRow(selectAPIKeySQL+" WHERE id = ?", id))
+	if err != nil {
+		return nil, fmt.Errorf("查询API密钥失败: %w", err)
+	}
+	return key, nil
+}
+
+func scanAPIKey(row *sql.Row) (*model.APIKey, error) {
+	var key model.APIKey
+	var revokedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scope, &key.CreatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
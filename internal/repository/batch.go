@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// maxBatchUpsertRows 批量更新票数时单条语句最多包含的用户数
+const maxBatchUpsertRows = 1000
+
+// voteKey 投票活动中的一个用户
+type voteKey struct {
+	pollID   string
+	username string
+}
+
+// voteIncrements 一批投票事件中各用户新增的票数
+type voteIncrements map[voteKey]int
+
+// sortedKeys 按投票活动和用户名排序，多个事务批量更新时以相同顺序加锁，避免死锁
+func (v voteIncrements) sortedKeys() []voteKey {
+	keys := make([]voteKey, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].pollID != keys[j].pollID {
+			return keys[i].pollID < keys[j].pollID
+		}
+		return keys[i].username < keys[j].username
+	})
+	return keys
+}
+
+// IncrementVotesBatch 在一个事务中处理一批投票事件，返回每个事件实际生效的票数
+// 每个事件的去重规则与IncrementVotes相同，各用户新增的票数合并后以多行INSERT一次更新
+func (r *MySQLRepository) IncrementVotesBatch(events []*model.VoteEvent) ([]int, error) {
+	return r.writeVoteEventsBatch(events, true)
+}
+
+// AppendVoteLogsBatch 事件溯源模式下在一个事务中追加一批投票事件的投票日志，返回每个事件新写入的日志数
+func (r *MySQLRepository) AppendVoteLogsBatch(events []*model.VoteEvent) ([]int, error) {
+	return r.writeVoteEventsBatch(events, false)
+}
+
+// writeVoteEventsBatch 写入一批投票事件的投票日志，countVotes为true时同时更新票数和票据剩余次数
+// 投票日志逐行写入以确定哪些是新写入的，重放或幂等键重复的事件跳过，不影响同一批的其他事件
+func (r *MySQLRepository) writeVoteEventsBatch(events []*model.VoteEvent, countVotes bool) ([]int, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	logStmt := tx.Stmt(r.logStmt)
+	defer logStmt.Close()
+
+	applied := make([]int, len(events))
+	increments := make(voteIncrements)
+	var pollIDs []string
+	for i, event := range events {
+		pollID := event.PollID
+		if pollID == "" {
+			pollID = model.DefaultPollID
+		}
+
+		replayed, err := claimConsumerOffset(tx, event)
+		if err != nil {
+			return nil, err
+		}
+		if replayed {
+			continue
+		}
+		// 撤销事件标记被撤销的日志，扣减的一票与同一批新增的票数合并更新
+		if event.Retraction != nil {
+			retracted, key, err := retractVoteTx(tx, event)
+			if err != nil {
+				return nil, err
+			}
+			if retracted {
+				applied[i] = 1
+			}
+			if key != nil {
+				increments[*key]--
+				pollIDs = append(pollIDs, key.pollID)
+			}
+			continue
+		}
+		duplicate, err := claimIdempotencyKey(tx, event, pollID)
+		if err != nil {
+			return nil, err
+		}
+		if duplicate {
+			continue
+		}
+
+		for j, username := range event.Usernames {
+			result, err := logStmt.Exec(event.EventID, event.Index+j, pollID, username, event.TicketVersion,
+				event.Audit.Actor, event.Audit.SourceIP, event.Audit.UserAgent, event.Shadow)
+			if err != nil {
+				return nil, fmt.Errorf("记录用户 %s 投票日志失败: %w", username, err)
+			}
+			inserted, err := result.RowsAffected()
+			if err != nil {
+				return nil, fmt.Errorf("获取投票日志写入结果失败: %w", err)
+			}
+			if inserted == 0 {
+				continue
+			}
+			applied[i]++
+			// 影子投票只记录日志，不计入票数
+			if event.Shadow {
+				continue
+			}
+			if countVotes {
+				increments[voteKey{pollID: pollID, username: username}]++
+			}
+			pollIDs = append(pollIDs, pollID)
+		}
+
+		if countVotes {
+			if err := decrementTicketUsageTx(tx, event, applied[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	keys := increments.sortedKeys()
+	for start := 0; start < len(keys); start += maxBatchUpsertRows {
+		chunk := keys[start:min(start+maxBatchUpsertRows, len(keys))]
+		args := make([]interface{}, 0, len(chunk)*3)
+		for _, key := range chunk {
+			args = append(args, key.pollID, key.username, increments[key])
+		}
+		query := "INSERT INTO user_votes (poll_id, username, votes) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?),", len(chunk)), ",") +
+			" ON DUPLICATE KEY UPDATE votes = votes + VALUES(votes)"
+		if _, err := tx.Exec(query, args...); err != nil {
+			return nil, fmt.Errorf("批量更新 %d 个用户的票数失败: %w", len(chunk), err)
+		}
+	}
+	if err := bumpResultsVersionTx(tx, pollIDs...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand/v2"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// 投票落库后用户票数缓存的更新策略
+const (
+	CacheStrategyCacheAside   = "cache_aside"   // 删除缓存，查询时从数据库回填
+	CacheStrategyWriteThrough = "write_through" // 从主库读取最新票数写入缓存
+)
+
+const (
+	// defaultUserVoteCacheTTL 未配置cache.user_vote_ttl时用户票数缓存的有效期
+	defaultUserVoteCacheTTL = time.Hour
+	// defaultTicketCacheTTL 未配置cache.ticket_ttl时票据在Redis中的保留时长
+	defaultTicketCacheTTL = 10 * time.Second
+)
+
+// 进程内缓存失效通知的类别
+const (
+	InvalidateUserVote       = "user_vote"       // 用户票数缓存
+	InvalidateTicketVersion  = "ticket_version"  // 最新票据版本
+	InvalidateVoteAdjustment = "vote_adjustment" // 管理员调整了用户票数，与user_vote一样使用户票数缓存失效
+)
+
+// defaultCacheInvalidationChannel 未配置cache.local.channel时失效通知使用的Redis频道
+const defaultCacheInvalidationChannel = "littlevote:cache:invalidate"
+
+// CacheInvalidation 进程内缓存的失效通知，修改Redis中的用户票数缓存或最新票据版本后发布到所有实例
+type CacheInvalidation struct {
+	Kind      string   `json:"kind"`
+	PollID    string   `json:"pollId"`
+	Usernames []string `json:"usernames,omitempty"` // kind为user_vote时失效的用户
+}
+
+// cacheInvalidationChannel 缓存失效通知使用的Redis频道
+func cacheInvalidationChannel() string {
+	if config.AppConfig.Cache.Local.Channel != "" {
+		return config.AppConfig.Cache.Local.Channel
+	}
+	return defaultCacheInvalidationChannel
+}
+
+// SetUserVoteIfNewerScript 缓存中已有票数更高的值时不写入，避免并发回写或只读副本的延迟数据覆盖较新的票数
+// KEYS[1]为用户票数缓存，KEYS[2]为最近已知票数；ARGV依次为缓存值、票数、有效期毫秒数和用户名
+const SetUserVoteIfNewerScript = `
+	local cached = redis.call('GET', KEYS[1])
+	if cached then
+		local ok, decoded = pcall(cjson.decode, cached)
+		if ok and type(decoded) == 'table' and tonumber(decoded['votes']) and tonumber(decoded['votes']) > tonumber(ARGV[2]) then
+			return 0
+		end
+	end
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+	redis.call('HSET', KEYS[2], ARGV[4], ARGV[1])
+	return 1
+`
+
+// cacheStrategy 配置的用户票数缓存策略，为空时为cache_aside
+func cacheStrategy() string {
+	if config.AppConfig.Cache.Strategy == "" {
+		return CacheStrategyCacheAside
+	}
+	return config.AppConfig.Cache.Strategy
+}
+
+// CacheWriteThrough 是否在投票落库后把最新票数写入缓存，而不是删除缓存
+func CacheWriteThrough() bool {
+	return cacheStrategy() == CacheStrategyWriteThrough
+}
+
+// cacheTTLs 缓存有效期的配置，支持热加载
+type cacheTTLs struct {
+	userVote time.Duration
+	ticket   time.Duration
+	jitter   float64
+}
+
+func newCacheTTLs(cfg config.CacheConfig) *cacheTTLs {
+	return &cacheTTLs{userVote: cfg.UserVoteTTL, ticket: cfg.TicketTTL, jitter: cfg.Jitter}
+}
+
+// ReloadConfig 配置热加载的回调，之后写入的用户票数缓存和票据使用新的有效期，已写入的键保持原有效期
+func (r *RedisRepository) ReloadConfig(prev, next *config.Config) {
+	if prev.Cache.UserVoteTTL == next.Cache.UserVoteTTL && prev.Cache.TicketTTL == next.Cache.TicketTTL &&
+		prev.Cache.Jitter == next.Cache.Jitter {
+		return
+	}
+	r.ttls.Store(newCacheTTLs(next.Cache))
+	r.logger.Info("缓存有效期已修改", "user_vote_ttl", next.Cache.UserVoteTTL,
+		"ticket_ttl", next.Cache.TicketTTL, "jitter", next.Cache.Jitter)
+}
+
+// userVoteCacheTTL 用户票数缓存的有效期，按cache.jitter附加随机抖动
+func (r *RedisRepository) userVoteCacheTTL() time.Duration {
+	ttls := r.ttls.Load()
+	ttl := ttls.userVote
+	if ttl <= 0 {
+		ttl = defaultUserVoteCacheTTL
+	}
+	jitter := min(ttls.jitter, 1)
+	if jitter <= 0 {
+		return ttl
+	}
+	ttl = time.Duration(float64(ttl) * (1 + jitter*(2*mrand.Float64()-1)))
+	// 抖动比例为1时有效期可能接近0，至少保留1秒
+	return max(ttl, time.Second)
+}
+
+// ticketCacheTTL 票据在Redis中的保留时长
+func (r *RedisRepository) ticketCacheTTL() time.Duration {
+	if ttl := r.ttls.Load().ticket; ttl > 0 {
+		return ttl
+	}
+	return defaultTicketCacheTTL
+}
+
+// setUserVoteIfNewer 以SetUserVoteIfNewerScript写入用户票数缓存和最近已知票数
+func (r *RedisRepository) setUserVoteIfNewer(userVote *model.UserVote) error {
+	data, err := json.Marshal(userVote)
+	if err != nil {
+		return fmt.Errorf("序列化用户票数失败: %w", err)
+	}
+	keys := []string{userVoteKey(userVote.PollID, userVote.Username), pollScopedKey(UserVoteLastKey, userVote.PollID)}
+	if _, err := r.evalScript("setUserVoteIfNewer", SetUserVoteIfNewerScript, keys,
+		data, userVote.Votes, r.userVoteCacheTTL().Milliseconds(), userVote.Username); err != nil {
+		return fmt.Errorf("设置用户票数缓存失败: %w", err)
+	}
+	return nil
+}
+
+// WriteThroughUserVotes write_through策略下把投票落库后的最新票数写入缓存，同时使该投票活动的聚合缓存失效
+func (r *RedisRepository) WriteThroughUserVotes(pollID string, userVotes []*model.UserVote) error {
+	for _, userVote := range userVotes {
+		if err := r.setUserVoteIfNewer(userVote); err != nil {
+			return fmt.Errorf("回写用户 %s 票数缓存失败: %w", userVote.Username, err)
+		}
+	}
+	if err := r.client.Del(r.ctx, pollScopedKey(UserVoteAllKey, pollID)).Err(); err != nil {
+		return fmt.Errorf("删除所有用户票数缓存失败: %w", err)
+	}
+
+	usernames := make([]string, len(userVotes))
+	for i, userVote := range userVotes {
+		usernames[i] = userVote.Username
+	}
+	r.publishInvalidation(&CacheInvalidation{Kind: InvalidateUserVote, PollID: pollID, Usernames: usernames})
+	return nil
+}
+
+// publishInvalidation 开启进程内缓存时广播失效通知；发布失败只记录日志，其他实例的本地条目最多在cache.local.ttl后过期
+func (r *RedisRepository) publishInvalidation(invalidation *CacheInvalidation) {
+	if !config.AppConfig.Cache.Local.Enabled {
+		return
+	}
+	if invalidation.PollID == "" {
+		invalidation.PollID = model.DefaultPollID
+	}
+	data, err := json.Marshal(invalidation)
+	if err != nil {
+		r.logger.Error("序列化缓存失效通知失败", "error", err)
+		return
+	}
+	if err := r.client.Publish(r.ctx, cacheInvalidationChannel(), data).Err(); err != nil {
+		r.logger.Warn("发布缓存失效通知失败", "kind", invalidation.Kind, "poll_id", invalidation.PollID, "error", err)
+	}
+}
+
+// SubscribeCacheInvalidations 接收其他实例发布的缓存失效通知，直到ctx取消
+// 连接断开后由客户端自动重连并重新订阅，断开期间的通知会丢失
+func (r *RedisRepository) SubscribeCacheInvalidations(ctx context.Context, handle func(*CacheInvalidation)) error {
+	pubsub := r.client.Subscribe(ctx, cacheInvalidationChannel())
+	defer pubsub.Close()
+	// 等待订阅确认，频道不可用时立即返回错误
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("订阅缓存失效通知失败: %w", err)
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var invalidation CacheInvalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &invalidation); err != nil {
+				r.logger.Warn("解析缓存失效通知失败", "error", err)
+				continue
+			}
+			handle(&invalidation)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// GetUnregisteredCandidates 返回names中不在候选人集合中的名称，集合未缓存时found为false
+func (r *RedisRepository) GetUnregisteredCandidates(names []string) ([]string, bool, error) {
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	result, err := r.evalScript("getUnregisteredCandidates", GetUnregisteredCandidatesScript, []string{CandidatesKey}, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("校验候选人失败: %w", err)
+	}
+	members, ok := result.([]interface{})
+	if !ok {
+		return nil, false, nil
+	}
+	unregistered := make([]string, 0, len(members))
+	for _, member := range members {
+		if name, ok := member.(string); ok {
+			unregistered = append(unregistered, name)
+		}
+	}
+	return unregistered, true, nil
+}
+
+// SetCandidates 用数据库中登记的候选人替换候选人集合，ttl后过期重新加载，以修正登记与加载同时发生时遗漏的候选人
+func (r *RedisRepository) SetCandidates(names []string, ttl time.Duration) error {
+	members := make([]interface{}, 0, len(names)+1)
+	members = append(members, "")
+	for _, name := range names {
+		members = append(members, name)
+	}
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(r.ctx, CandidatesKey)
+		pipe.SAdd(r.ctx, CandidatesKey, members...)
+		if ttl > 0 {
+			pipe.Expire(r.ctx, CandidatesKey, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("缓存候选人集合失败: %w", err)
+	}
+	return nil
+}
+
+// AddCandidate 把新登记的候选人加入已缓存的候选人集合
+func (r *RedisRepository) AddCandidate(name string) error {
+	if _, err := r.evalScript("addCandidate", AddCandidateScript, []string{CandidatesKey}, name); err != nil {
+		return fmt.Errorf("缓存候选人 %s 失败: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// claimIdempotencyKey 在落库事务内登记投票事件的幂等键，返回该键是否已被其他投票事件使用
+// 拆分后的事件共享eventId，同一次投票的各部分可以重复登记同一个键
+func claimIdempotencyKey(tx *sql.Tx, event *model.VoteEvent, pollID string) (bool, error) {
+	if event.IdempotencyKey == "" {
+		return false, nil
+	}
+
+	result, err := tx.Exec(`INSERT IGNORE INTO vote_idempotency_keys (idempotency_key, event_id, poll_id, ticket_version)
+		VALUES (?, ?, ?, ?)`, event.IdempotencyKey, event.EventID, pollID, event.TicketVersion)
+	if err != nil {
+		return false, fmt.Errorf("登记幂等键失败: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("获取幂等键登记结果失败: %w", err)
+	}
+	if inserted > 0 {
+		return false, nil
+	}
+
+	// 读取已提交的登记记录，而不是事务开始时的快照
+	var eventID string
+	err = tx.QueryRow("SELECT event_id FROM vote_idempotency_keys WHERE idempotency_key = ? LOCK IN SHARE MODE",
+		event.IdempotencyKey).Scan(&eventID)
+	if err != nil {
+		return false, fmt.Errorf("查询幂等键失败: %w", err)
+	}
+	return eventID != event.EventID, nil
+}
+
+// GetVoteIdempotencyKey 查询幂等键的登记记录，读主库以确认已持久化，不存在时返回nil
+func (r *MySQLRepository) GetVoteIdempotencyKey(key string) (*model.VoteIdempotencyRecord, error) {
+	record := &model.VoteIdempotencyRecord{Key: key}
+	err := r.masterDB.QueryRow(`SELECT event_id, poll_id, ticket_version, created_at
+		FROM vote_idempotency_keys WHERE idempotency_key = ?`, key).
+		Scan(&record.EventID, &record.PollID, &record.TicketVersion, &record.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询幂等键失败: %w", err)
+	}
+	return record, nil
+}
+
+// PurgeVoteIdempotencyKeys 删除登记时间早于before的幂等键，返回删除的行数
+func (r *MySQLRepository) PurgeVoteIdempotencyKeys(before time.Time, batchSize int) (int64, error) {
+	result, err := r.masterDB.Exec(`DELETE FROM vote_idempotency_keys
+			WHERE created_at < ?
+			ORDER BY created_at
+			LIMIT ?`, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("删除幂等键失败: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取删除结果失败: %w", err)
+	}
+	return deleted, nil
+}
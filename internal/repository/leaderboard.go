@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// IncrLeaderboard 为投票事件中的每个用户加1票，排行榜尚未建立时不写入
+func (r *RedisRepository) IncrLeaderboard(pollID string, usernames []string) error {
+	args := make([]interface{}, 0, len(usernames)+1)
+	args = append(args, time.Now().Unix())
+	for _, username := range usernames {
+		args = append(args, username)
+	}
+	if _, err := r.evalScript("incrLeaderboard", IncrLeaderboardScript,
+		[]string{pollScopedKey(LeaderboardKey, pollID), pollScopedKey(LeaderboardUpdatedKey, pollID)}, args...); err != nil {
+		return fmt.Errorf("更新投票活动 %s 的排行榜失败: %w", pollID, err)
+	}
+	return nil
+}
+
+// GetLeaderboard 获取投票活动票数最高的limit个用户，票数相同时按用户名排序；排行榜尚未建立时返回false
+func (r *RedisRepository) GetLeaderboard(pollID string, limit int) ([]*model.UserVote, bool, error) {
+	key := pollScopedKey(LeaderboardKey, pollID)
+	entries, err := r.client.ZRevRangeWithScores(r.ctx, key, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("获取投票活动 %s 的排行榜失败: %w", pollID, err)
+	}
+	if len(entries) == 0 {
+		return nil, false, nil
+	}
+
+	usernames := make([]string, len(entries))
+	for i, entry := range entries {
+		usernames[i], _ = entry.Member.(string)
+	}
+	updated, err := r.client.HMGet(r.ctx, pollScopedKey(LeaderboardUpdatedKey, pollID), usernames...).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("获取投票活动 %s 的排行榜更新时间失败: %w", pollID, err)
+	}
+
+	userVotes := make([]*model.UserVote, len(entries))
+	for i, entry := range entries {
+		userVote := &model.UserVote{
+			PollID:   pollID,
+			Username: usernames[i],
+			Votes:    int(entry.Score),
+		}
+		if value, ok := updated[i].(string); ok {
+			if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+				userVote.UpdatedAt = time.Unix(unix, 0)
+			}
+		}
+		userVotes[i] = userVote
+	}
+	model.RankUserVotes(userVotes)
+	return userVotes, true, nil
+}
+
+// ReplaceLeaderboard 用数据库中的票数重建投票活动的排行榜，先写入临时键再整体替换，查询不会看到写了一半的排行榜
+func (r *RedisRepository) ReplaceLeaderboard(pollID string, userVotes []*model.UserVote) error {
+	key := pollScopedKey(LeaderboardKey, pollID)
+	updatedKey := pollScopedKey(LeaderboardUpdatedKey, pollID)
+	if len(userVotes) == 0 {
+		if err := r.client.Del(r.ctx, key, updatedKey).Err(); err != nil {
+			return fmt.Errorf("清除投票活动 %s 的排行榜失败: %w", pollID, err)
+		}
+		return nil
+	}
+
+	members := make([]*redis.Z, len(userVotes))
+	updated := make(map[string]interface{}, len(userVotes))
+	for i, userVote := range userVotes {
+		members[i] = &redis.Z{Score: float64(userVote.Votes), Member: userVote.Username}
+		updated[userVote.Username] = userVote.UpdatedAt.Unix()
+	}
+
+	tmpKey, tmpUpdatedKey := key+":rebuild", updatedKey+":rebuild"
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(r.ctx, tmpKey, tmpUpdatedKey)
+		pipe.ZAdd(r.ctx, tmpKey, members...)
+		pipe.HSet(r.ctx, tmpUpdatedKey, updated)
+		pipe.Rename(r.ctx, tmpKey, key)
+		pipe.Rename(r.ctx, tmpUpdatedKey, updatedKey)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("重建投票活动 %s 的排行榜失败: %w", pollID, err)
+	}
+	return nil
+}
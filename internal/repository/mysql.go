@@ -1,22 +1,54 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
 	"github.com/lvdashuaibi/littlevote/internal/model"
 )
 
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("用户不存在")
+
+// ErrPollFinalized 投票活动已定稿，结果快照不可再修改
+var ErrPollFinalized = errors.New("POLL_FINALIZED: 投票活动已定稿")
+
+// ErrStaleFencingToken 写入票据的防护令牌小于已见的最大令牌，写入者持有的锁已过期并被其他生产者获取
+var ErrStaleFencingToken = errors.New("STALE_FENCING_TOKEN: 票据生产者锁已过期")
+
+// pingTimeout 检查主库可用性的超时时间
+const pingTimeout = 2 * time.Second
+
+// 热路径上复用的预编译语句
+const (
+	// 候选人由投票活动和vote.candidate_validator约束，首次得票时插入用户
+	incrementVotesSQL = "INSERT INTO user_votes (poll_id, username, votes) VALUES (?, ?, 1) ON DUPLICATE KEY UPDATE votes = votes + 1"
+	insertVoteLogSQL  = `INSERT IGNORE INTO vote_logs (event_id, event_index, poll_id, username, ticket_version, actor, source_ip, user_agent, shadow)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	selectUserVoteSQL = "SELECT poll_id, username, votes, updated_at FROM user_votes WHERE poll_id = ? AND username = ?"
+)
+
 type MySQLRepository struct {
 	masterDB *sql.DB
 	slaveDB  *sql.DB
+	logger   *slog.Logger
+
+	incrementStmt  *sql.Stmt // 主库: 增加用户票数
+	logStmt        *sql.Stmt // 主库: 写入投票日志
+	selectUserStmt *sql.Stmt // 从库: 查询用户票数
 }
 
-func NewMySQLRepository() (*MySQLRepository, error) {
+func NewMySQLRepository(logger *slog.Logger) (*MySQLRepository, error) {
+	logger = logging.Component(logger, "mysql")
 	masterDB, err := sql.Open("mysql", config.AppConfig.MySQL.Master)
 	if err != nil {
 		return nil, fmt.Errorf("连接主数据库失败: %w", err)
@@ -40,26 +72,55 @@ func NewMySQLRepository() (*MySQLRepository, error) {
 	slaveDB.SetConnMaxLifetime(time.Hour)
 
 	if err = slaveDB.Ping(); err != nil {
-		log.Printf("从数据库连接测试失败: %v，将使用主数据库代替", err)
+		logger.Warn("从数据库连接测试失败，将使用主数据库代替", "error", err)
 		slaveDB = masterDB
 	}
 
-	return &MySQLRepository{
+	repo := &MySQLRepository{
 		masterDB: masterDB,
 		slaveDB:  slaveDB,
-	}, nil
+		logger:   logger,
+	}
+
+	// 表结构由内置的迁移脚本维护，预编译语句之前必须完成迁移
+	if err := migrate(masterDB, DriverMySQL, logger); err != nil {
+		repo.Close()
+		return nil, err
+	}
+
+	// 预编译热路径语句，避免每个事务重复准备
+	if err := repo.prepareStatements(); err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("预编译SQL语句失败: %w", err)
+	}
+
+	return repo, nil
 }
 
-// GetUserVote 获取用户票数
-func (r *MySQLRepository) GetUserVote(username string) (*model.UserVote, error) {
-	query := "SELECT username, votes, updated_at FROM user_votes WHERE username = ?"
-	row := r.slaveDB.QueryRow(query, username)
+// prepareStatements 预编译投票和查询票数使用的语句，连接池中的连接会按需重新准备
+func (r *MySQLRepository) prepareStatements() error {
+	var err error
+	if r.incrementStmt, err = r.masterDB.Prepare(incrementVotesSQL); err != nil {
+		return fmt.Errorf("准备更新票数语句失败: %w", err)
+	}
+	if r.logStmt, err = r.masterDB.Prepare(insertVoteLogSQL); err != nil {
+		return fmt.Errorf("准备投票日志语句失败: %w", err)
+	}
+	if r.selectUserStmt, err = r.slaveDB.Prepare(selectUserVoteSQL); err != nil {
+		return fmt.Errorf("准备查询用户票数语句失败: %w", err)
+	}
+	return nil
+}
+
+// GetUserVote 获取投票活动中用户的票数
+func (r *MySQLRepository) GetUserVote(pollID, username string) (*model.UserVote, error) {
+	row := r.selectUserStmt.QueryRow(pollID, username)
 
 	var userVote model.UserVote
-	err := row.Scan(&userVote.Username, &userVote.Votes, &userVote.UpdatedAt)
+	err := row.Scan(&userVote.PollID, &userVote.Username, &userVote.Votes, &userVote.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("用户 %s 不存在", username)
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, username)
 		}
 		return nil, fmt.Errorf("查询用户票数失败: %w", err)
 	}
@@ -67,10 +128,16 @@ func (r *MySQLRepository) GetUserVote(username string) (*model.UserVote, error)
 	return &userVote, nil
 }
 
-// GetAllUserVotes 获取所有用户票数
-func (r *MySQLRepository) GetAllUserVotes() ([]*model.UserVote, error) {
-	query := "SELECT username, votes, updated_at FROM user_votes ORDER BY username"
-	rows, err := r.slaveDB.Query(query)
+// GetAllUserVotes 获取投票活动所有用户的票数，pollID为空时返回所有投票活动的票数
+func (r *MySQLRepository) GetAllUserVotes(pollID string) ([]*model.UserVote, error) {
+	query := "SELECT poll_id, username, votes, updated_at FROM user_votes"
+	var args []interface{}
+	if pollID != "" {
+		query += " WHERE poll_id = ?"
+		args = append(args, pollID)
+	}
+	query += " ORDER BY poll_id, username"
+	rows, err := r.slaveDB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("查询所有用户票数失败: %w", err)
 	}
@@ -79,7 +146,7 @@ func (r *MySQLRepository) GetAllUserVotes() ([]*model.UserVote, error) {
 	var userVotes []*model.UserVote
 	for rows.Next() {
 		var userVote model.UserVote
-		if err := rows.Scan(&userVote.Username, &userVote.Votes, &userVote.UpdatedAt); err != nil {
+		if err := rows.Scan(&userVote.PollID, &userVote.Username, &userVote.Votes, &userVote.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("扫描用户票数失败: %w", err)
 		}
 		userVotes = append(userVotes, &userVote)
@@ -92,64 +159,309 @@ func (r *MySQLRepository) GetAllUserVotes() ([]*model.UserVote, error) {
 	return userVotes, nil
 }
 
-// IncrementVotes 增加用户票数
-func (r *MySQLRepository) IncrementVotes(usernames []string, ticketVersion string) error {
+// GetUserVotesFromMaster 从主库读取投票活动中一组用户的票数，write_through策略下投票落库后回写缓存使用，
+// 不受只读副本复制延迟的影响；没有票数记录的用户不返回
+func (r *MySQLRepository) GetUserVotesFromMaster(pollID string, usernames []string) ([]*model.UserVote, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(usernames)+1)
+	args = append(args, pollID)
+	for _, username := range usernames {
+		args = append(args, username)
+	}
+	rows, err := r.masterDB.Query("SELECT poll_id, username, votes, updated_at FROM user_votes WHERE poll_id = ? AND username IN ("+
+		strings.TrimSuffix(strings.Repeat("?,", len(usernames)), ",")+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("从主库查询用户票数失败: %w", err)
+	}
+	defer rows.Close()
+
+	var userVotes []*model.UserVote
+	for rows.Next() {
+		var userVote model.UserVote
+		if err := rows.Scan(&userVote.PollID, &userVote.Username, &userVote.Votes, &userVote.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("扫描用户票数失败: %w", err)
+		}
+		userVotes = append(userVotes, &userVote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("迭代用户票数失败: %w", err)
+	}
+	return userVotes, nil
+}
+
+// IncrementVotes 增加投票事件中各用户的票数并记录投票日志，返回本次实际生效的票数
+// 投票日志以(event_id, event_index)去重，重复投递的事件不会重复计票
+func (r *MySQLRepository) IncrementVotes(event *model.VoteEvent) (int, error) {
+	pollID := event.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+
 	tx, err := r.masterDB.Begin()
 	if err != nil {
-		return fmt.Errorf("开始事务失败: %w", err)
+		return 0, fmt.Errorf("开始事务失败: %w", err)
 	}
 
-	// 更新用户票数
-	incrementStmt, err := tx.Prepare("UPDATE user_votes SET votes = votes + 1 WHERE username = ?")
+	// 消息已经落库过，说明是消费者重启或分区重新分配后的重放
+	replayed, err := claimConsumerOffset(tx, event)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("准备更新票数语句失败: %w", err)
+		return 0, err
+	}
+	if replayed {
+		tx.Rollback()
+		return 0, nil
 	}
-	defer incrementStmt.Close()
 
-	// 记录投票日志
-	logStmt, err := tx.Prepare("INSERT INTO vote_logs (username, ticket_version) VALUES (?, ?)")
+	// 撤销事件不写入投票日志，标记被撤销的日志并扣减票数
+	if event.Retraction != nil {
+		applied, err := applyRetractionTx(tx, event)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("提交事务失败: %w", err)
+		}
+		return applied, nil
+	}
+
+	// 幂等键已被其他投票事件使用，说明是客户端重试产生的重复投票，不再计票
+	duplicate, err := claimIdempotencyKey(tx, event, pollID)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("准备投票日志语句失败: %w", err)
+		return 0, err
+	}
+	if duplicate {
+		tx.Rollback()
+		return 0, nil
 	}
+
+	// 复用预编译语句，记录投票日志时已存在的日志说明该票已计入
+	incrementStmt := tx.Stmt(r.incrementStmt)
+	defer incrementStmt.Close()
+	logStmt := tx.Stmt(r.logStmt)
 	defer logStmt.Close()
 
 	// 执行投票操作
-	for _, username := range usernames {
-		// 更新票数
-		result, err := incrementStmt.Exec(username)
+	applied := 0
+	for i, username := range event.Usernames {
+		// 插入投票日志
+		result, err := logStmt.Exec(event.EventID, event.Index+i, pollID, username, event.TicketVersion,
+			event.Audit.Actor, event.Audit.SourceIP, event.Audit.UserAgent, event.Shadow)
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("更新用户 %s 票数失败: %w", username, err)
+			return 0, fmt.Errorf("记录用户 %s 投票日志失败: %w", username, err)
 		}
-
-		// 检查是否找到用户
-		rowsAffected, err := result.RowsAffected()
+		inserted, err := result.RowsAffected()
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("获取更新结果失败: %w", err)
+			return 0, fmt.Errorf("获取投票日志写入结果失败: %w", err)
+		}
+		if inserted == 0 {
+			continue
+		}
+		applied++
+
+		// 影子投票只记录日志，不计入票数
+		if event.Shadow {
+			continue
 		}
-		if rowsAffected == 0 {
+
+		// 更新票数
+		if _, err := incrementStmt.Exec(pollID, username); err != nil {
 			tx.Rollback()
-			return fmt.Errorf("用户 %s 不存在", username)
+			return 0, fmt.Errorf("更新用户 %s 票数失败: %w", username, err)
 		}
+	}
 
-		// 插入投票日志
-		_, err = logStmt.Exec(username, ticketVersion)
-		if err != nil {
+	// 未经发件箱扣减过的事件在同一事务中扣减票据剩余次数，崩溃或重投时票数和剩余次数不会不一致
+	if err := decrementTicketUsageTx(tx, event, applied); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if applied > 0 && !event.Shadow {
+		if err := bumpResultsVersionTx(tx, pollID); err != nil {
 			tx.Rollback()
-			return fmt.Errorf("记录用户 %s 投票日志失败: %w", username, err)
+			return 0, err
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("提交事务失败: %w", err)
+		return 0, fmt.Errorf("提交事务失败: %w", err)
 	}
 
+	return applied, nil
+}
+
+// decrementTicketUsageTx 在计票事务中扣减一次票据剩余次数，一次投票只由index为0的事件扣减
+// 票据使用次数已在Redis中原子扣减，这里只同步剩余次数：不低于0，已清理的票据不再更新，都不影响计票
+func decrementTicketUsageTx(tx *sql.Tx, event *model.VoteEvent, applied int) error {
+	if applied == 0 || event.Index != 0 || event.TicketConsumed {
+		return nil
+	}
+	if _, err := tx.Exec("UPDATE tickets SET remaining_usages = GREATEST(remaining_usages - 1, 0) WHERE version = ?",
+		event.TicketVersion); err != nil {
+		return fmt.Errorf("扣减票据 %s 使用次数失败: %w", event.TicketVersion, err)
+	}
 	return nil
 }
 
+// DeleteVoteLogsByEventID 删除一次投票的投票日志，返回删除的行数
+func (r *MySQLRepository) DeleteVoteLogsByEventID(eventID string) (int64, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 结果从投票日志统计，删除日志同样改变票数
+	pollIDs, err := eventPollIDs(tx, "SELECT DISTINCT poll_id FROM vote_logs WHERE event_id = ? AND shadow = 0", eventID)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("DELETE FROM vote_logs WHERE event_id = ?", eventID)
+	if err != nil {
+		return 0, fmt.Errorf("删除投票日志失败: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取投票日志删除结果失败: %w", err)
+	}
+	if err := bumpResultsVersionTx(tx, pollIDs...); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return deleted, nil
+}
+
+// eventPollIDs 在事务中查询一次投票涉及的投票活动
+func eventPollIDs(tx *sql.Tx, query, eventID string) ([]string, error) {
+	rows, err := tx.Query(query, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志所属的投票活动失败: %w", err)
+	}
+	defer rows.Close()
+
+	var pollIDs []string
+	for rows.Next() {
+		var pollID string
+		if err := rows.Scan(&pollID); err != nil {
+			return nil, fmt.Errorf("扫描投票活动失败: %w", err)
+		}
+		pollIDs = append(pollIDs, pollID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历投票活动失败: %w", err)
+	}
+	return pollIDs, nil
+}
+
+// GetVoteLogsByEventID 查询同一次投票写入的投票日志，读主库以确认已持久化
+func (r *MySQLRepository) GetVoteLogsByEventID(eventID string) ([]*model.VoteLog, error) {
+	query := `SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs WHERE event_id = ?`
+	rows, err := r.masterDB.Query(query, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	return scanVoteLogs(rows)
+}
+
+// GetReplicaLatestVoteLogID 返回投票活动在从库中最新投票日志的id，pollID为空时不限制投票活动，与从库上的导出保持一致
+// 投票日志只追加，除撤销外不修改，该版本号不变时导出的投票日志也不变，可作为HTTP缓存的版本号
+func (r *MySQLRepository) GetReplicaLatestVoteLogID(pollID string) (int64, error) {
+	return latestVoteLogID(r.slaveDB, pollID)
+}
+
+func latestVoteLogID(db *sql.DB, pollID string) (int64, error) {
+	// 撤销投票不写入投票日志，撤销记录的id一并计入；自增id可能乱序提交，删除日志也不改变最大id，
+	// 因此再计入在同一事务中递增的结果版本号，之后版本号同样会变化
+	logs := "SELECT COALESCE(MAX(id), 0) FROM vote_logs"
+	retractions := "SELECT COALESCE(MAX(id), 0) FROM vote_retractions"
+	versions := "SELECT COALESCE(SUM(version), 0) FROM poll_results_versions"
+	var args []interface{}
+	if pollID != "" {
+		logs += " WHERE poll_id = ?"
+		retractions += " WHERE poll_id = ?"
+		versions += " WHERE poll_id = ?"
+		args = append(args, pollID, pollID, pollID)
+	}
+	query := "SELECT (" + logs + ") + (" + retractions + ") + (" + versions + ")"
+
+	var id int64
+	if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("查询最新投票日志id失败: %w", err)
+	}
+	return id, nil
+}
+
+// GetVoteLogsAfter 按id顺序返回id大于afterID的投票日志，pollID为空时不限制投票活动
+// 使用主键做游标分页，翻页开销与导出位置无关，适合分批导出大量数据
+func (r *MySQLRepository) GetVoteLogsAfter(pollID string, afterID int64, limit int) ([]*model.VoteLog, error) {
+	query := `SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs WHERE id > ?`
+	args := []interface{}{afterID}
+	if pollID != "" {
+		query += " AND poll_id = ?"
+		args = append(args, pollID)
+	}
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	return scanVoteLogs(rows)
+}
+
+// QueryVoteLogs 按条件从从库查询投票日志，按id从新到旧排列
+// 按用户名、票据版本过滤时分别走idx_username、idx_ticket_version，只按时间过滤时走idx_voted_at
+func (r *MySQLRepository) QueryVoteLogs(filter *model.VoteLogFilter) ([]*model.VoteLog, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Username != "" {
+		conditions = append(conditions, "username = ?")
+		args = append(args, filter.Username)
+	}
+	if filter.TicketVersion != "" {
+		conditions = append(conditions, "ticket_version = ?")
+		args = append(args, filter.TicketVersion)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "voted_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "voted_at < ?")
+		args = append(args, filter.To)
+	}
+	if filter.BeforeID > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	query := `SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	return scanVoteLogs(rows)
+}
+
 // SaveTicketHistory 保存票据历史
 func (r *MySQLRepository) SaveTicketHistory(ticketHistory *model.TicketHistory) error {
 	query := "INSERT INTO ticket_history (version, ticket_value, created_at, expired_at) VALUES (?, ?, ?, ?)"
@@ -166,79 +478,159 @@ func (r *MySQLRepository) SaveTicketHistory(ticketHistory *model.TicketHistory)
 }
 
 // SaveTicket 保存当前活跃票据
+// 防护令牌小于该投票活动已见的最大令牌时返回ErrStaleFencingToken，锁已过期的旧生产者不能覆盖新生产者的票据
 func (r *MySQLRepository) SaveTicket(ticket *model.Ticket) error {
-	query := `INSERT INTO tickets (version, value, remaining_usages, expires_at) 
-			 VALUES (?, ?, ?, ?) 
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+
+	if _, err := tx.Exec("INSERT IGNORE INTO ticket_fences (poll_id, token) VALUES (?, 0)", ticket.PollID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("补齐投票活动 %s 的防护令牌失败: %w", ticket.PollID, err)
+	}
+	var latest int64
+	if err := tx.QueryRow("SELECT token FROM ticket_fences WHERE poll_id = ? FOR UPDATE", ticket.PollID).Scan(&latest); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("查询投票活动 %s 的防护令牌失败: %w", ticket.PollID, err)
+	}
+	if ticket.FencingToken < latest {
+		tx.Rollback()
+		return fmt.Errorf("%w, 票据令牌: %d, 最新令牌: %d", ErrStaleFencingToken, ticket.FencingToken, latest)
+	}
+	if _, err := tx.Exec("UPDATE ticket_fences SET token = ? WHERE poll_id = ?", ticket.FencingToken, ticket.PollID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("更新投票活动 %s 的防护令牌失败: %w", ticket.PollID, err)
+	}
+
+	// created_at为票据的生效时间，预生成的票据在生效前不会被查询为最新票据
+	query := `INSERT INTO tickets (version, poll_id, value, remaining_usages, expires_at, created_at, fencing_token) 
+			 VALUES (?, ?, ?, ?, ?, ?, ?) 
 			 ON DUPLICATE KEY UPDATE 
 			 value = VALUES(value), 
 			 remaining_usages = VALUES(remaining_usages), 
-			 expires_at = VALUES(expires_at)`
+			 expires_at = VALUES(expires_at), 
+			 fencing_token = VALUES(fencing_token)`
 
-	_, err := r.masterDB.Exec(query,
+	_, err = tx.Exec(query,
 		ticket.Version,
+		ticket.PollID,
 		ticket.Value,
 		ticket.RemainingUsages,
 		ticket.ExpiresAt,
+		ticket.CreatedAt,
+		ticket.FencingToken,
 	)
 
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("保存票据到MySQL失败: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
 	return nil
 }
 
-// DecrementTicketUsage 减少票据使用次数
-func (r *MySQLRepository) DecrementTicketUsage(version string) (int, error) {
-	// 开始事务
+// PurgeExpiredTickets 分批删除过期时间早于before的票据，archive为true时先把尚未记录的票据归档到ticket_history
+// 返回本批次删除的记录数
+func (r *MySQLRepository) PurgeExpiredTickets(before time.Time, batchSize int, archive bool) (int64, error) {
 	tx, err := r.masterDB.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("开始事务失败: %w", err)
 	}
 
-	// 获取当前使用次数
-	var remainingUsages int
-	query := "SELECT remaining_usages FROM tickets WHERE version = ? FOR UPDATE"
-	err = tx.QueryRow(query, version).Scan(&remainingUsages)
+	// 先锁定本批次要清理的票据，保证归档与删除的是同一批记录
+	rows, err := tx.Query(`SELECT version FROM tickets
+			WHERE expires_at < ?
+			ORDER BY expires_at
+			LIMIT ? FOR UPDATE`, before, batchSize)
 	if err != nil {
 		tx.Rollback()
-		if err == sql.ErrNoRows {
-			return 0, fmt.Errorf("票据不存在")
+		return 0, fmt.Errorf("查询过期票据失败: %w", err)
+	}
+
+	var versions []interface{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, fmt.Errorf("扫描过期票据失败: %w", err)
 		}
-		return 0, fmt.Errorf("查询票据使用次数失败: %w", err)
+		versions = append(versions, version)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("迭代过期票据失败: %w", err)
 	}
 
-	// 检查是否还有剩余使用次数
-	if remainingUsages <= 0 {
+	if len(versions) == 0 {
 		tx.Rollback()
-		return 0, fmt.Errorf("票据使用次数已耗尽")
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(versions)), ",")
+
+	if archive {
+		// 签发时已经写入历史的票据不再重复归档
+		archiveQuery := `INSERT INTO ticket_history (version, ticket_value, created_at, expired_at)
+				SELECT t.version, t.value, t.created_at, t.expires_at FROM tickets t
+				WHERE t.version IN (` + placeholders + `)
+				AND NOT EXISTS (SELECT 1 FROM ticket_history h WHERE h.version = t.version)`
+		if _, err := tx.Exec(archiveQuery, versions...); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("归档过期票据失败: %w", err)
+		}
 	}
 
-	// 减少使用次数
-	remainingUsages--
-	updateQuery := "UPDATE tickets SET remaining_usages = ? WHERE version = ?"
-	_, err = tx.Exec(updateQuery, remainingUsages, version)
+	result, err := tx.Exec("DELETE FROM tickets WHERE version IN ("+placeholders+")", versions...)
 	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("更新票据使用次数失败: %w", err)
+		return 0, fmt.Errorf("删除过期票据失败: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("获取删除结果失败: %w", err)
 	}
 
-	// 提交事务
 	if err := tx.Commit(); err != nil {
 		return 0, fmt.Errorf("提交事务失败: %w", err)
 	}
 
-	return remainingUsages, nil
+	return deleted, nil
+}
+
+// PurgeTicketHistory 删除一批过期时间早于before的票据历史，返回删除的记录数
+func (r *MySQLRepository) PurgeTicketHistory(before time.Time, batchSize int) (int64, error) {
+	result, err := r.masterDB.Exec(`DELETE FROM ticket_history
+			WHERE expired_at < ?
+			ORDER BY expired_at
+			LIMIT ?`, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("删除票据历史失败: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取删除结果失败: %w", err)
+	}
+	return deleted, nil
 }
 
 // GetTicket 获取当前活跃票据
 func (r *MySQLRepository) GetTicket(version string) (*model.Ticket, error) {
-	query := `SELECT version, value, remaining_usages, expires_at, created_at 
+	query := `SELECT version, poll_id, value, remaining_usages, expires_at, created_at 
 			 FROM tickets 
 			 WHERE version = ?`
 
 	var ticket model.Ticket
 	err := r.slaveDB.QueryRow(query, version).Scan(
 		&ticket.Version,
+		&ticket.PollID,
 		&ticket.Value,
 		&ticket.RemainingUsages,
 		&ticket.ExpiresAt,
@@ -255,15 +647,15 @@ func (r *MySQLRepository) GetTicket(version string) (*model.Ticket, error) {
 	return &ticket, nil
 }
 
-// GetNewestTicketVersion 获取最新的票据版本
-func (r *MySQLRepository) GetNewestTicketVersion() (string, error) {
+// GetNewestTicketVersion 获取投票活动最新的票据版本
+func (r *MySQLRepository) GetNewestTicketVersion(pollID string) (string, error) {
 	query := `SELECT version FROM tickets 
-			  WHERE expires_at > NOW() 
+			  WHERE poll_id = ? AND expires_at > NOW() AND created_at <= NOW() 
 			  ORDER BY created_at DESC 
 			  LIMIT 1`
 
 	var version string
-	err := r.slaveDB.QueryRow(query).Scan(&version)
+	err := r.slaveDB.QueryRow(query, pollID).Scan(&version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", nil // 没有有效票据
@@ -274,8 +666,219 @@ func (r *MySQLRepository) GetNewestTicketVersion() (string, error) {
 	return version, nil
 }
 
-// Close 关闭数据库连接
+// ReconcileUserVotes 以投票日志和管理员的票数调整为准修正用户票数，返回修正的记录数
+func (r *MySQLRepository) ReconcileUserVotes() (int64, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 补齐有投票日志但没有票数记录的用户，补齐的记录票数为0，随后按日志修正并计入修正数；影子投票不计入
+	// 补齐的记录使这些用户出现在结果中，同样需要递增结果版本号
+	inserted, err := tx.Exec(`INSERT IGNORE INTO user_votes (poll_id, username, votes)
+		SELECT DISTINCT poll_id, username, 0 FROM vote_logs WHERE shadow = 0`)
+	if err != nil {
+		return 0, fmt.Errorf("补齐用户票数记录失败: %w", err)
+	}
+	added, err := inserted.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取补齐结果失败: %w", err)
+	}
+
+	result, err := tx.Exec(`UPDATE user_votes u
+		LEFT JOIN (SELECT poll_id, username, COUNT(*) AS votes FROM vote_logs WHERE shadow = 0 AND retracted_at IS NULL GROUP BY poll_id, username) l
+			ON l.poll_id = u.poll_id AND l.username = u.username
+		LEFT JOIN (SELECT poll_id, username, SUM(delta) AS delta FROM admin_actions GROUP BY poll_id, username) a
+			ON a.poll_id = u.poll_id AND a.username = u.username
+		SET u.votes = COALESCE(l.votes, 0) + COALESCE(a.delta, 0)
+		WHERE u.votes <> COALESCE(l.votes, 0) + COALESCE(a.delta, 0)`)
+	if err != nil {
+		return 0, fmt.Errorf("对账用户票数失败: %w", err)
+	}
+	reconciled, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取对账结果失败: %w", err)
+	}
+	if added > 0 || reconciled > 0 {
+		if err := bumpAllResultsVersionsTx(tx); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return reconciled, nil
+}
+
+// CountPollVotes 从主库的投票日志统计投票活动中各用户的票数，不含影子投票，计入管理员的票数调整
+func (r *MySQLRepository) CountPollVotes(pollID string) ([]*model.UserVote, error) {
+	rows, err := r.masterDB.Query(`SELECT u.username, COUNT(l.id) + COALESCE((SELECT CAST(SUM(a.delta) AS SIGNED) FROM admin_actions a
+			WHERE a.poll_id = ? AND a.username = u.username), 0)
+		FROM user_votes u
+		LEFT JOIN vote_logs l ON l.poll_id = u.poll_id AND l.username = u.username AND l.shadow = 0 AND l.retracted_at IS NULL
+		WHERE u.poll_id = ?
+		GROUP BY u.username
+		ORDER BY u.username`, pollID, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("统计投票活动票数失败: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var results []*model.UserVote
+	for rows.Next() {
+		userVote := &model.UserVote{PollID: pollID, UpdatedAt: now}
+		if err := rows.Scan(&userVote.Username, &userVote.Votes); err != nil {
+			return nil, fmt.Errorf("扫描投票活动票数失败: %w", err)
+		}
+		results = append(results, userVote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历投票活动票数失败: %w", err)
+	}
+
+	return results, nil
+}
+
+// SavePollResults 写入投票活动的结果快照，快照已存在时返回ErrPollFinalized
+func (r *MySQLRepository) SavePollResults(pollResults *model.PollResults) error {
+	data, err := json.Marshal(pollResults.Results)
+	if err != nil {
+		return fmt.Errorf("序列化结果快照失败: %w", err)
+	}
+
+	result, err := r.masterDB.Exec(`INSERT IGNORE INTO poll_results
+		(poll_id, results, total_votes, reconciled_rows, signature, finalized_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		pollResults.PollID, data, pollResults.TotalVotes, pollResults.Reconciled,
+		pollResults.Signature, pollResults.FinalizedAt)
+	if err != nil {
+		return fmt.Errorf("保存结果快照失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取保存结果失败: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrPollFinalized
+	}
+	return nil
+}
+
+// GetPollResults 获取投票活动的结果快照，未定稿时返回nil
+func (r *MySQLRepository) GetPollResults(pollID string) (*model.PollResults, error) {
+	var data []byte
+	var finalizedAt time.Time
+	pollResults := &model.PollResults{PollID: pollID, Finalized: true}
+	err := r.masterDB.QueryRow(`SELECT results, total_votes, reconciled_rows, signature, finalized_at
+		FROM poll_results WHERE poll_id = ?`, pollID).Scan(
+		&data, &pollResults.TotalVotes, &pollResults.Reconciled, &pollResults.Signature, &finalizedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询结果快照失败: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &pollResults.Results); err != nil {
+		return nil, fmt.Errorf("解析结果快照失败: %w", err)
+	}
+	pollResults.FinalizedAt = &finalizedAt
+	return pollResults, nil
+}
+
+// ListFinalizedPollIDs 获取所有已定稿的投票活动
+func (r *MySQLRepository) ListFinalizedPollIDs() ([]string, error) {
+	rows, err := r.masterDB.Query("SELECT poll_id FROM poll_results")
+	if err != nil {
+		return nil, fmt.Errorf("查询已定稿的投票活动失败: %w", err)
+	}
+	defer rows.Close()
+
+	var pollIDs []string
+	for rows.Next() {
+		var pollID string
+		if err := rows.Scan(&pollID); err != nil {
+			return nil, fmt.Errorf("扫描已定稿的投票活动失败: %w", err)
+		}
+		pollIDs = append(pollIDs, pollID)
+	}
+	return pollIDs, rows.Err()
+}
+
+// SaveResultSnapshot 保存排名快照
+func (r *MySQLRepository) SaveResultSnapshot(snapshot *model.ResultSnapshot) error {
+	data, err := json.Marshal(snapshot.Standings)
+	if err != nil {
+		return fmt.Errorf("序列化排名快照失败: %w", err)
+	}
+
+	result, err := r.masterDB.Exec("INSERT INTO result_snapshots (taken_at, total_votes, standings) VALUES (?, ?, ?)",
+		snapshot.TakenAt, snapshot.TotalVotes, data)
+	if err != nil {
+		return fmt.Errorf("保存排名快照失败: %w", err)
+	}
+	snapshot.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetResultSnapshots 按时间顺序查询[since, until]内的排名快照，零值表示不限制
+func (r *MySQLRepository) GetResultSnapshots(since, until time.Time, limit int) ([]*model.ResultSnapshot, error) {
+	query := "SELECT id, taken_at, total_votes, standings FROM result_snapshots WHERE 1 = 1"
+	var args []interface{}
+	if !since.IsZero() {
+		query += " AND taken_at >= ?"
+		args = append(args, since)
+	}
+	if !until.IsZero() {
+		query += " AND taken_at <= ?"
+		args = append(args, until)
+	}
+	query += " ORDER BY taken_at LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询排名快照失败: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*model.ResultSnapshot
+	for rows.Next() {
+		var snapshot model.ResultSnapshot
+		var data []byte
+		if err := rows.Scan(&snapshot.ID, &snapshot.TakenAt, &snapshot.TotalVotes, &data); err != nil {
+			return nil, fmt.Errorf("扫描排名快照失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &snapshot.Standings); err != nil {
+			return nil, fmt.Errorf("解析排名快照失败: %w", err)
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历排名快照失败: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// Ping 检查主库是否可用
+func (r *MySQLRepository) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return r.masterDB.PingContext(ctx)
+}
+
+// Close 关闭预编译语句和数据库连接
 func (r *MySQLRepository) Close() {
+	for _, stmt := range []*sql.Stmt{r.incrementStmt, r.logStmt, r.selectUserStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
 	if r.masterDB != nil {
 		r.masterDB.Close()
 	}
@@ -283,3 +886,84 @@ func (r *MySQLRepository) Close() {
 		r.slaveDB.Close()
 	}
 }
+
+// SaveTicketStats 记录新票据签发的使用次数
+func (r *MySQLRepository) SaveTicketStats(ticket *model.Ticket) error {
+	_, err := r.masterDB.Exec(`INSERT IGNORE INTO ticket_stats (version, poll_id, issued, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		ticket.Version, ticket.PollID, ticket.RemainingUsages, ticket.CreatedAt, ticket.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("保存票据利用率失败: %w", err)
+	}
+	return nil
+}
+
+// RecordTicketConsumption 票据轮换时按剩余使用次数记录实际消耗的次数，每个版本只记录一次
+func (r *MySQLRepository) RecordTicketConsumption(version string, remaining int, rotatedAt time.Time) error {
+	_, err := r.masterDB.Exec(`UPDATE ticket_stats
+		SET consumed = GREATEST(issued - ?, 0), rotated_at = ?
+		WHERE version = ? AND rotated_at IS NULL`,
+		remaining, rotatedAt, version)
+	if err != nil {
+		return fmt.Errorf("记录票据 %s 的消耗次数失败: %w", version, err)
+	}
+	return nil
+}
+
+// GetTicketStats 按签发时间倒序查询票据利用率，pollID为空时查询所有投票活动
+func (r *MySQLRepository) GetTicketStats(pollID string, limit int) ([]*model.TicketStats, error) {
+	query := "SELECT version, poll_id, issued, consumed, created_at, expires_at, rotated_at FROM ticket_stats"
+	var args []interface{}
+	if pollID != "" {
+		query += " WHERE poll_id = ?"
+		args = append(args, pollID)
+	}
+	query += " ORDER BY created_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询票据利用率失败: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*model.TicketStats
+	for rows.Next() {
+		var s model.TicketStats
+		var consumed sql.NullInt64
+		var rotatedAt sql.NullTime
+		if err := rows.Scan(&s.Version, &s.PollID, &s.Issued, &consumed, &s.CreatedAt, &s.ExpiresAt, &rotatedAt); err != nil {
+			return nil, fmt.Errorf("扫描票据利用率失败: %w", err)
+		}
+		if consumed.Valid {
+			value := int(consumed.Int64)
+			s.Consumed = &value
+		}
+		if rotatedAt.Valid {
+			s.RotatedAt = &rotatedAt.Time
+		}
+		stats = append(stats, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历票据利用率失败: %w", err)
+	}
+
+	return stats, nil
+}
+
+// PurgeTicketStats 删除签发时间早于before的票据利用率记录，返回删除的行数
+func (r *MySQLRepository) PurgeTicketStats(before time.Time, batchSize int) (int64, error) {
+	result, err := r.masterDB.Exec(`DELETE FROM ticket_stats
+			WHERE created_at < ?
+			ORDER BY created_at
+			LIMIT ?`, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("删除票据利用率失败: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取删除结果失败: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// claimConsumerOffset 在落库事务内推进投票事件来源分区的已落库偏移量，返回该消息是否已经落库过
+// 偏移量与计票在同一个事务中提交，消费者重启或分区重新分配后重放的消息直接跳过；不是从Kafka读取的事件不登记
+func claimConsumerOffset(tx *sql.Tx, event *model.VoteEvent) (bool, error) {
+	if event.Source == nil {
+		return false, nil
+	}
+
+	// 偏移量不大于已登记的值时不修改，影响行数为0
+	result, err := tx.Exec(`INSERT INTO consumer_offsets (topic, partition_id, last_offset) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE last_offset = IF(VALUES(last_offset) > last_offset, VALUES(last_offset), last_offset)`,
+		event.Source.Topic, event.Source.Partition, event.Source.Offset)
+	if err != nil {
+		return false, fmt.Errorf("登记消费偏移量失败: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("获取消费偏移量登记结果失败: %w", err)
+	}
+	return affected == 0, nil
+}
+
+// GetConsumerOffsets 查询主题各分区已落库的最大偏移量，读主库
+func (r *MySQLRepository) GetConsumerOffsets(topic string) (map[int]int64, error) {
+	rows, err := r.masterDB.Query("SELECT partition_id, last_offset FROM consumer_offsets WHERE topic = ?", topic)
+	if err != nil {
+		return nil, fmt.Errorf("查询消费偏移量失败: %w", err)
+	}
+	defer rows.Close()
+	return scanConsumerOffsets(rows)
+}
+
+func scanConsumerOffsets(rows *sql.Rows) (map[int]int64, error) {
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, fmt.Errorf("扫描消费偏移量失败: %w", err)
+		}
+		offsets[partition] = offset
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历消费偏移量失败: %w", err)
+	}
+	return offsets, nil
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// EnqueueVoteEvent 在同一个事务中扣减MySQL中的票据剩余次数，并把投票事件写入发件箱，由中继任务异步发送到Kafka
+// consumeTicket为false时只写入发件箱，事件溯源模式下票据剩余次数由投影任务推导
+func (r *MySQLRepository) EnqueueVoteEvent(event *model.VoteEvent, consumeTicket bool) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化投票事件失败: %w", err)
+	}
+
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 票据使用次数已在Redis中原子扣减，这里只同步MySQL中的剩余次数，已清理的票据不再更新
+	if consumeTicket {
+		if _, err := tx.Exec("UPDATE tickets SET remaining_usages = GREATEST(remaining_usages - 1, 0) WHERE version = ?",
+			event.TicketVersion); err != nil {
+			return fmt.Errorf("扣减票据 %s 使用次数失败: %w", event.TicketVersion, err)
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO outbox (event_id, payload) VALUES (?, ?)", event.EventID, payload); err != nil {
+		return fmt.Errorf("写入发件箱失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// DrainOutbox 按写入顺序取出一批投票事件交给publish发送，发送成功后从发件箱删除，返回发送的事件数
+// 已被其他实例锁定的行直接跳过，多个实例可以同时中继；删除失败时事件会被再次发送，由消费端按(eventId, index)去重
+// 无法解析的行标记为失败（累加尝试次数并记录最后一次错误），之后的中继不再取出，由运维处理
+func (r *MySQLRepository) DrainOutbox(batchSize int, publish func([]*model.VoteEvent) error) (int, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, payload FROM outbox WHERE failed_at IS NULL ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED", batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("查询发件箱失败: %w", err)
+	}
+
+	var ids []interface{}
+	var events []*model.VoteEvent
+	var failed []outboxFailure
+	for rows.Next() {
+		var (
+			id      int64
+			payload []byte
+		)
+		if err := rows.Scan(&id, &payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描发件箱失败: %w", err)
+		}
+
+		var event model.VoteEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			failed = append(failed, outboxFailure{id: id, err: err})
+			continue
+		}
+		ids = append(ids, id)
+		events = append(events, &event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("遍历发件箱失败: %w", err)
+	}
+
+	// 无法解析的事件标记为失败后跳过，不阻塞后面的事件
+	for _, f := range failed {
+		if err := markOutboxFailed(tx, false, f.id, f.err); err != nil {
+			return 0, err
+		}
+		r.logger.Error("发件箱中的投票事件无法解析，已标记为失败", "id", f.id, "error", f.err)
+	}
+
+	if len(events) > 0 {
+		if err := publish(events); err != nil {
+			return 0, err
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+		if _, err := tx.Exec("DELETE FROM outbox WHERE id IN ("+placeholders+")", ids...); err != nil {
+			return 0, fmt.Errorf("删除已发送的发件箱事件失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return len(events), nil
+}
+
+// outboxFailure 发件箱中无法发送的事件及原因
+type outboxFailure struct {
+	id  int64
+	err error
+}
+
+// maxOutboxErrorLength 与outbox.last_error的列宽一致
+const maxOutboxErrorLength = 512
+
+// markOutboxFailed 把无法发送的发件箱事件标记为失败，postgres为true时使用PostgreSQL的占位符
+func markOutboxFailed(tx *sql.Tx, postgres bool, id int64, cause error) error {
+	query := "UPDATE outbox SET attempts = attempts + 1, last_error = ?, failed_at = CURRENT_TIMESTAMP WHERE id = ?"
+	if postgres {
+		query = "UPDATE outbox SET attempts = attempts + 1, last_error = $1, failed_at = CURRENT_TIMESTAMP WHERE id = $2"
+	}
+	lastError := cause.Error()
+	if len(lastError) > maxOutboxErrorLength {
+		lastError = strings.ToValidUTF8(lastError[:maxOutboxErrorLength], "")
+	}
+	if _, err := tx.Exec(query, lastError, id); err != nil {
+		return fmt.Errorf("标记发件箱事件 %d 失败: %w", id, err)
+	}
+	return nil
+}
+
+// GetOutboxStats 统计发件箱中尚未发送到Kafka的投票事件数、最早一条的写入时间和标记为失败的事件数
+func (r *MySQLRepository) GetOutboxStats() (*model.OutboxStats, error) {
+	var (
+		stats  model.OutboxStats
+		oldest sql.NullTime
+	)
+	if err := r.masterDB.QueryRow("SELECT COUNT(*), MIN(created_at) FROM outbox WHERE failed_at IS NULL").Scan(&stats.Backlog, &oldest); err != nil {
+		return nil, fmt.Errorf("统计发件箱失败: %w", err)
+	}
+	if oldest.Valid {
+		stats.OldestAt = &oldest.Time
+	}
+	if err := r.masterDB.QueryRow("SELECT COUNT(*) FROM outbox WHERE failed_at IS NOT NULL").Scan(&stats.Failed); err != nil {
+		return nil, fmt.Errorf("统计发件箱失败事件失败: %w", err)
+	}
+	return &stats, nil
+}
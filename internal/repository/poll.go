@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// ErrPollExists 投票活动ID已被使用
+var ErrPollExists = errors.New("POLL_EXISTS: 投票活动已存在")
+
+const selectPollSQL = "SELECT id, title, candidates, starts_at, ends_at, shadow, created_at FROM polls"
+
+// CreatePoll 创建投票活动，并为每个候选人插入票数为0的记录，ID已被使用时返回ErrPollExists
+func (r *MySQLRepository) CreatePoll(poll *model.Poll) error {
+	candidates, err := json.Marshal(poll.Candidates)
+	if err != nil {
+		return fmt.Errorf("序列化候选人列表失败: %w", err)
+	}
+
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT IGNORE INTO polls (id, title, candidates, starts_at, ends_at, shadow, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, poll.ID, poll.Title, candidates, poll.StartsAt, poll.EndsAt, poll.Shadow, poll.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("创建投票活动失败: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取投票活动写入结果失败: %w", err)
+	}
+	if inserted == 0 {
+		return fmt.Errorf("%w: %s", ErrPollExists, poll.ID)
+	}
+
+	for _, username := range poll.Candidates {
+		if _, err := tx.Exec("INSERT IGNORE INTO user_votes (poll_id, username, votes) VALUES (?, ?, 0)",
+			poll.ID, username); err != nil {
+			return fmt.Errorf("插入候选人 %s 失败: %w", username, err)
+		}
+	}
+	if err := bumpResultsVersionTx(tx, poll.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// GetPoll 查询投票活动，不存在时返回nil，读主库以便创建后立即可见
+func (r *MySQLRepository) GetPoll(pollID string) (*model.Poll, error) {
+	poll, err := scanPoll(r.masterDB.QueryRow(selectPollSQL+" WHERE id = ?", pollID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动失败: %w", err)
+	}
+	return poll, nil
+}
+
+// SetPollShadow 开启或关闭投票活动的影子模式，活动不存在时不做修改
+func (r *MySQLRepository) SetPollShadow(pollID string, shadow bool) error {
+	if _, err := r.masterDB.Exec("UPDATE polls SET shadow = ? WHERE id = ?", shadow, pollID); err != nil {
+		return fmt.Errorf("更新投票活动 %s 的影子模式失败: %w", pollID, err)
+	}
+	return nil
+}
+
+// ListPolls 查询所有投票活动，按ID排序
+func (r *MySQLRepository) ListPolls() ([]*model.Poll, error) {
+	rows, err := r.slaveDB.Query(selectPollSQL + " ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动失败: %w", err)
+	}
+	return scanPolls(rows)
+}
+
+// rowScanner *sql.Row和*sql.Rows共有的Scan方法
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPoll 扫描selectPollSQL查询的一行，MySQL与PostgreSQL共用
+func scanPoll(row rowScanner) (*model.Poll, error) {
+	var (
+		poll       model.Poll
+		candidates []byte
+		startsAt   sql.NullTime
+		endsAt     sql.NullTime
+	)
+	if err := row.Scan(&poll.ID, &poll.Title, &candidates, &startsAt, &endsAt, &poll.Shadow, &poll.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(candidates, &poll.Candidates); err != nil {
+		return nil, fmt.Errorf("解析投票活动 %s 的候选人列表失败: %w", poll.ID, err)
+	}
+	if startsAt.Valid {
+		poll.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		poll.EndsAt = &endsAt.Time
+	}
+	return &poll, nil
+}
+
+func scanPolls(rows *sql.Rows) ([]*model.Poll, error) {
+	defer rows.Close()
+
+	var polls []*model.Poll
+	for rows.Next() {
+		poll, err := scanPoll(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描投票活动失败: %w", err)
+		}
+		polls = append(polls, poll)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历投票活动失败: %w", err)
+	}
+	return polls, nil
+}
@@ -0,0 +1,894 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// 热路径上复用的预编译语句
+const (
+	pgIncrementVotesSQL = `INSERT INTO user_votes (poll_id, username, votes) VALUES ($1, $2, 1)
+		ON CONFLICT (poll_id, username) DO UPDATE SET votes = user_votes.votes + 1, updated_at = NOW()`
+	pgInsertVoteLogSQL = `INSERT INTO vote_logs (event_id, event_index, poll_id, username, ticket_version, actor, source_ip, user_agent, shadow)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (event_id, event_index) DO NOTHING`
+	pgSelectUserVoteSQL = "SELECT poll_id, username, votes, updated_at FROM user_votes WHERE poll_id = $1 AND username = $2"
+)
+
+// PostgresRepository 以PostgreSQL作为持久化存储，方法与MySQLRepository一一对应
+type PostgresRepository struct {
+	masterDB *sql.DB
+	slaveDB  *sql.DB
+	logger   *slog.Logger
+
+	incrementStmt  *sql.Stmt // 主库: 增加用户票数
+	logStmt        *sql.Stmt // 主库: 写入投票日志
+	selectUserStmt *sql.Stmt // 从库: 查询用户票数
+}
+
+func NewPostgresRepository(logger *slog.Logger) (*PostgresRepository, error) {
+	logger = logging.Component(logger, "postgres")
+	cfg := config.AppConfig.Postgres
+
+	masterDB, err := sql.Open("postgres", cfg.Master)
+	if err != nil {
+		return nil, fmt.Errorf("连接主数据库失败: %w", err)
+	}
+
+	masterDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	masterDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	masterDB.SetConnMaxLifetime(time.Hour)
+
+	if err = masterDB.Ping(); err != nil {
+		return nil, fmt.Errorf("主数据库连接测试失败: %w", err)
+	}
+
+	slaveDB := masterDB
+	if cfg.Slave != "" {
+		if slaveDB, err = sql.Open("postgres", cfg.Slave); err != nil {
+			return nil, fmt.Errorf("连接从数据库失败: %w", err)
+		}
+		slaveDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		slaveDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		slaveDB.SetConnMaxLifetime(time.Hour)
+
+		if err = slaveDB.Ping(); err != nil {
+			logger.Warn("从数据库连接测试失败，将使用主数据库代替", "error", err)
+			slaveDB = masterDB
+		}
+	}
+
+	repo := &PostgresRepository{
+		masterDB: masterDB,
+		slaveDB:  slaveDB,
+		logger:   logger,
+	}
+
+	// 表结构由内置的迁移脚本维护，预编译语句之前必须完成迁移
+	if err := migrate(masterDB, DriverPostgres, logger); err != nil {
+		repo.Close()
+		return nil, err
+	}
+
+	if err := repo.prepareStatements(); err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("预编译SQL语句失败: %w", err)
+	}
+
+	return repo, nil
+}
+
+// prepareStatements 预编译投票和查询票数使用的语句
+func (r *PostgresRepository) prepareStatements() error {
+	var err error
+	if r.incrementStmt, err = r.masterDB.Prepare(pgIncrementVotesSQL); err != nil {
+		return fmt.Errorf("准备更新票数语句失败: %w", err)
+	}
+	if r.logStmt, err = r.masterDB.Prepare(pgInsertVoteLogSQL); err != nil {
+		return fmt.Errorf("准备投票日志语句失败: %w", err)
+	}
+	if r.selectUserStmt, err = r.slaveDB.Prepare(pgSelectUserVoteSQL); err != nil {
+		return fmt.Errorf("准备查询用户票数语句失败: %w", err)
+	}
+	return nil
+}
+
+// GetUserVote 获取投票活动中用户的票数
+func (r *PostgresRepository) GetUserVote(pollID, username string) (*model.UserVote, error) {
+	var userVote model.UserVote
+	err := r.selectUserStmt.QueryRow(pollID, username).Scan(&userVote.PollID, &userVote.Username, &userVote.Votes, &userVote.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+		}
+		return nil, fmt.Errorf("查询用户票数失败: %w", err)
+	}
+	return &userVote, nil
+}
+
+// GetAllUserVotes 获取投票活动所有用户的票数，pollID为空时返回所有投票活动的票数
+func (r *PostgresRepository) GetAllUserVotes(pollID string) ([]*model.UserVote, error) {
+	query := "SELECT poll_id, username, votes, updated_at FROM user_votes"
+	var args []interface{}
+	if pollID != "" {
+		query += " WHERE poll_id = $1"
+		args = append(args, pollID)
+	}
+	query += " ORDER BY poll_id, username"
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询所有用户票数失败: %w", err)
+	}
+	defer rows.Close()
+
+	var userVotes []*model.UserVote
+	for rows.Next() {
+		var userVote model.UserVote
+		if err := rows.Scan(&userVote.PollID, &userVote.Username, &userVote.Votes, &userVote.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("扫描用户票数失败: %w", err)
+		}
+		userVotes = append(userVotes, &userVote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("迭代用户票数失败: %w", err)
+	}
+
+	return userVotes, nil
+}
+
+// GetUserVotesFromMaster 从主库读取投票活动中一组用户的票数，write_through策略下投票落库后回写缓存使用
+func (r *PostgresRepository) GetUserVotesFromMaster(pollID string, usernames []string) ([]*model.UserVote, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	rows, err := r.masterDB.Query("SELECT poll_id, username, votes, updated_at FROM user_votes WHERE poll_id = $1 AND username = ANY($2)",
+		pollID, pq.Array(usernames))
+	if err != nil {
+		return nil, fmt.Errorf("从主库查询用户票数失败: %w", err)
+	}
+	defer rows.Close()
+
+	var userVotes []*model.UserVote
+	for rows.Next() {
+		var userVote model.UserVote
+		if err := rows.Scan(&userVote.PollID, &userVote.Username, &userVote.Votes, &userVote.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("扫描用户票数失败: %w", err)
+		}
+		userVotes = append(userVotes, &userVote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("迭代用户票数失败: %w", err)
+	}
+	return userVotes, nil
+}
+
+// IncrementVotes 增加投票事件中各用户的票数并记录投票日志，返回本次实际生效的票数
+// 投票日志以(event_id, event_index)去重，重复投递的事件不会重复计票
+func (r *PostgresRepository) IncrementVotes(event *model.VoteEvent) (int, error) {
+	return r.writeVoteLogs(event, true)
+}
+
+// writeVoteLogs 写入投票日志，countVotes为true时同时增加新写入日志对应用户的票数
+func (r *PostgresRepository) writeVoteLogs(event *model.VoteEvent, countVotes bool) (int, error) {
+	pollID := event.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 消息已经落库过，说明是消费者重启或分区重新分配后的重放
+	replayed, err := pgClaimConsumerOffset(tx, event)
+	if err != nil {
+		return 0, err
+	}
+	if replayed {
+		return 0, nil
+	}
+
+	// 撤销事件不写入投票日志，标记被撤销的日志并扣减票数
+	if event.Retraction != nil {
+		applied, err := pgApplyRetractionTx(tx, event)
+		if err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("提交事务失败: %w", err)
+		}
+		return applied, nil
+	}
+
+	// 幂等键已被其他投票事件使用，说明是客户端重试产生的重复投票，不再计票
+	duplicate, err := pgClaimIdempotencyKey(tx, event, pollID)
+	if err != nil {
+		return 0, err
+	}
+	if duplicate {
+		return 0, nil
+	}
+
+	logStmt := tx.Stmt(r.logStmt)
+	defer logStmt.Close()
+	incrementStmt := tx.Stmt(r.incrementStmt)
+	defer incrementStmt.Close()
+
+	applied := 0
+	for i, username := range event.Usernames {
+		result, err := logStmt.Exec(event.EventID, event.Index+i, pollID, username, event.TicketVersion,
+			event.Audit.Actor, event.Audit.SourceIP, event.Audit.UserAgent, event.Shadow)
+		if err != nil {
+			return 0, fmt.Errorf("记录用户 %s 投票日志失败: %w", username, err)
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("获取投票日志写入结果失败: %w", err)
+		}
+		if inserted == 0 {
+			continue
+		}
+
+		// 影子投票只记录日志，不计入票数
+		if countVotes && !event.Shadow {
+			if _, err := incrementStmt.Exec(pollID, username); err != nil {
+				return 0, fmt.Errorf("更新用户 %s 票数失败: %w", username, err)
+			}
+		}
+		applied++
+	}
+
+	// 未经发件箱扣减过的事件在同一事务中扣减票据剩余次数，事件溯源模式下由投影任务推导
+	if countVotes {
+		if err := pgDecrementTicketUsageTx(tx, event, applied); err != nil {
+			return 0, err
+		}
+	}
+	// 事件溯源模式下结果同样直接从投票日志统计，不必等投影
+	if applied > 0 && !event.Shadow {
+		if err := pgBumpResultsVersionTx(tx, pollID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return applied, nil
+}
+
+// pgDecrementTicketUsageTx 在计票事务中扣减一次票据剩余次数，一次投票只由index为0的事件扣减
+func pgDecrementTicketUsageTx(tx *sql.Tx, event *model.VoteEvent, applied int) error {
+	if applied == 0 || event.Index != 0 || event.TicketConsumed {
+		return nil
+	}
+	if _, err := tx.Exec("UPDATE tickets SET remaining_usages = GREATEST(remaining_usages - 1, 0) WHERE version = $1",
+		event.TicketVersion); err != nil {
+		return fmt.Errorf("扣减票据 %s 使用次数失败: %w", event.TicketVersion, err)
+	}
+	return nil
+}
+
+// DeleteVoteLogsByEventID 删除一次投票的投票日志，返回删除的行数
+func (r *PostgresRepository) DeleteVoteLogsByEventID(eventID string) (int64, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 结果从投票日志统计，删除日志同样改变票数
+	pollIDs, err := eventPollIDs(tx, "SELECT DISTINCT poll_id FROM vote_logs WHERE event_id = $1 AND NOT shadow", eventID)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("DELETE FROM vote_logs WHERE event_id = $1", eventID)
+	if err != nil {
+		return 0, fmt.Errorf("删除投票日志失败: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取投票日志删除结果失败: %w", err)
+	}
+	if err := pgBumpResultsVersionTx(tx, pollIDs...); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return deleted, nil
+}
+
+// GetVoteLogsByEventID 查询同一次投票写入的投票日志，读主库以确认已持久化
+func (r *PostgresRepository) GetVoteLogsByEventID(eventID string) ([]*model.VoteLog, error) {
+	rows, err := r.masterDB.Query(`SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs WHERE event_id = $1`, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	return scanVoteLogs(rows)
+}
+
+// GetReplicaLatestVoteLogID 返回投票活动在从库中最新投票日志的id，pollID为空时不限制投票活动，与从库上的导出保持一致
+func (r *PostgresRepository) GetReplicaLatestVoteLogID(pollID string) (int64, error) {
+	return pgLatestVoteLogID(r.slaveDB, pollID)
+}
+
+func pgLatestVoteLogID(db *sql.DB, pollID string) (int64, error) {
+	// 撤销投票不写入投票日志，撤销记录的id一并计入；自增id可能乱序提交，删除日志也不改变最大id，
+	// 因此再计入在同一事务中递增的结果版本号，之后版本号同样会变化
+	logs := "SELECT COALESCE(MAX(id), 0) FROM vote_logs"
+	retractions := "SELECT COALESCE(MAX(id), 0) FROM vote_retractions"
+	versions := "SELECT COALESCE(SUM(version), 0) FROM poll_results_versions"
+	var args []interface{}
+	if pollID != "" {
+		logs += " WHERE poll_id = $1"
+		retractions += " WHERE poll_id = $1"
+		versions += " WHERE poll_id = $1"
+		args = append(args, pollID)
+	}
+	query := "SELECT (" + logs + ") + (" + retractions + ") + (" + versions + ")"
+
+	var id int64
+	if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("查询最新投票日志id失败: %w", err)
+	}
+	return id, nil
+}
+
+// GetVoteLogsAfter 按id顺序返回id大于afterID的投票日志，pollID为空时不限制投票活动
+func (r *PostgresRepository) GetVoteLogsAfter(pollID string, afterID int64, limit int) ([]*model.VoteLog, error) {
+	query := `SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs WHERE id > $1`
+	args := []interface{}{afterID}
+	if pollID != "" {
+		args = append(args, pollID)
+		query += fmt.Sprintf(" AND poll_id = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	return scanVoteLogs(rows)
+}
+
+// QueryVoteLogs 按条件从从库查询投票日志，按id从新到旧排列
+func (r *PostgresRepository) QueryVoteLogs(filter *model.VoteLogFilter) ([]*model.VoteLog, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if filter.Username != "" {
+		addCondition("username = $%d", filter.Username)
+	}
+	if filter.TicketVersion != "" {
+		addCondition("ticket_version = $%d", filter.TicketVersion)
+	}
+	if !filter.From.IsZero() {
+		addCondition("voted_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("voted_at < $%d", filter.To)
+	}
+	if filter.BeforeID > 0 {
+		addCondition("id < $%d", filter.BeforeID)
+	}
+
+	query := `SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	return scanVoteLogs(rows)
+}
+
+// scanVoteLogs 读取投票日志查询的全部结果并关闭rows
+func scanVoteLogs(rows *sql.Rows) ([]*model.VoteLog, error) {
+	defer rows.Close()
+
+	var logs []*model.VoteLog
+	for rows.Next() {
+		var voteLog model.VoteLog
+		var retractedAt sql.NullTime
+		if err := rows.Scan(&voteLog.ID, &voteLog.EventID, &voteLog.PollID, &voteLog.Username, &voteLog.TicketVersion,
+			&voteLog.Actor, &voteLog.SourceIP, &voteLog.UserAgent, &voteLog.VotedAt, &voteLog.Shadow, &retractedAt); err != nil {
+			return nil, fmt.Errorf("扫描投票日志失败: %w", err)
+		}
+		if retractedAt.Valid {
+			voteLog.RetractedAt = &retractedAt.Time
+		}
+		logs = append(logs, &voteLog)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历投票日志失败: %w", err)
+	}
+	return logs, nil
+}
+
+// SaveTicketHistory 保存票据历史
+func (r *PostgresRepository) SaveTicketHistory(ticketHistory *model.TicketHistory) error {
+	_, err := r.masterDB.Exec("INSERT INTO ticket_history (version, ticket_value, created_at, expired_at) VALUES ($1, $2, $3, $4)",
+		ticketHistory.Version, ticketHistory.TicketValue, ticketHistory.CreatedAt, ticketHistory.ExpiredAt)
+	if err != nil {
+		return fmt.Errorf("保存票据历史失败: %w", err)
+	}
+	return nil
+}
+
+// SaveTicket 保存当前活跃票据
+func (r *PostgresRepository) SaveTicket(ticket *model.Ticket) error {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO ticket_fences (poll_id, token) VALUES ($1, 0)
+		ON CONFLICT (poll_id) DO NOTHING`, ticket.PollID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("补齐投票活动 %s 的防护令牌失败: %w", ticket.PollID, err)
+	}
+	var latest int64
+	if err := tx.QueryRow("SELECT token FROM ticket_fences WHERE poll_id = $1 FOR UPDATE", ticket.PollID).Scan(&latest); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("查询投票活动 %s 的防护令牌失败: %w", ticket.PollID, err)
+	}
+	if ticket.FencingToken < latest {
+		tx.Rollback()
+		return fmt.Errorf("%w, 票据令牌: %d, 最新令牌: %d", ErrStaleFencingToken, ticket.FencingToken, latest)
+	}
+	if _, err := tx.Exec("UPDATE ticket_fences SET token = $1 WHERE poll_id = $2", ticket.FencingToken, ticket.PollID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("更新投票活动 %s 的防护令牌失败: %w", ticket.PollID, err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO tickets (version, poll_id, value, remaining_usages, expires_at, created_at, fencing_token)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (version) DO UPDATE SET
+			value = EXCLUDED.value,
+			remaining_usages = EXCLUDED.remaining_usages,
+			expires_at = EXCLUDED.expires_at,
+			fencing_token = EXCLUDED.fencing_token`,
+		ticket.Version, ticket.PollID, ticket.Value, ticket.RemainingUsages, ticket.ExpiresAt, ticket.CreatedAt,
+		ticket.FencingToken); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("保存票据到PostgreSQL失败: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredTickets 分批删除过期时间早于before的票据，archive为true时先归档到ticket_history
+// 返回本批次删除的记录数
+func (r *PostgresRepository) PurgeExpiredTickets(before time.Time, batchSize int, archive bool) (int64, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 先锁定本批次要清理的票据，保证归档与删除的是同一批记录
+	rows, err := tx.Query(`SELECT version FROM tickets
+		WHERE expires_at < $1
+		ORDER BY expires_at
+		LIMIT $2 FOR UPDATE`, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("查询过期票据失败: %w", err)
+	}
+
+	var versions []string
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描过期票据失败: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("迭代过期票据失败: %w", err)
+	}
+
+	if len(versions) == 0 {
+		return 0, nil
+	}
+
+	if archive {
+		// 签发时已经写入历史的票据不再重复归档
+		if _, err := tx.Exec(`INSERT INTO ticket_history (version, ticket_value, created_at, expired_at)
+			SELECT t.version, t.value, t.created_at, t.expires_at FROM tickets t
+			WHERE t.version = ANY($1)
+			AND NOT EXISTS (SELECT 1 FROM ticket_history h WHERE h.version = t.version)`, pq.Array(versions)); err != nil {
+			return 0, fmt.Errorf("归档过期票据失败: %w", err)
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM tickets WHERE version = ANY($1)", pq.Array(versions))
+	if err != nil {
+		return 0, fmt.Errorf("删除过期票据失败: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取删除结果失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return deleted, nil
+}
+
+// PurgeTicketHistory 删除一批过期时间早于before的票据历史，返回删除的记录数
+func (r *PostgresRepository) PurgeTicketHistory(before time.Time, batchSize int) (int64, error) {
+	result, err := r.masterDB.Exec(`DELETE FROM ticket_history WHERE id IN (
+		SELECT id FROM ticket_history WHERE expired_at < $1 ORDER BY expired_at LIMIT $2)`, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("删除票据历史失败: %w", err)
+	}
+	return pgRowsDeleted(result)
+}
+
+// GetTicket 获取当前活跃票据
+func (r *PostgresRepository) GetTicket(version string) (*model.Ticket, error) {
+	var ticket model.Ticket
+	err := r.slaveDB.QueryRow(`SELECT version, poll_id, value, remaining_usages, expires_at, created_at
+		FROM tickets WHERE version = $1`, version).Scan(
+		&ticket.Version, &ticket.PollID, &ticket.Value, &ticket.RemainingUsages, &ticket.ExpiresAt, &ticket.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("票据不存在")
+		}
+		return nil, fmt.Errorf("获取票据失败: %w", err)
+	}
+	return &ticket, nil
+}
+
+// GetNewestTicketVersion 获取投票活动最新的票据版本
+func (r *PostgresRepository) GetNewestTicketVersion(pollID string) (string, error) {
+	var version string
+	err := r.slaveDB.QueryRow(`SELECT version FROM tickets
+		WHERE poll_id = $1 AND expires_at > NOW() AND created_at <= NOW()
+		ORDER BY created_at DESC
+		LIMIT 1`, pollID).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil // 没有有效票据
+		}
+		return "", fmt.Errorf("获取最新票据版本失败: %w", err)
+	}
+	return version, nil
+}
+
+// ReconcileUserVotes 以投票日志和管理员的票数调整为准修正用户票数，返回修正的记录数
+func (r *PostgresRepository) ReconcileUserVotes() (int64, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 补齐有投票日志但没有票数记录的用户，补齐的记录票数为0，随后按日志修正并计入修正数；影子投票不计入
+	// 补齐的记录使这些用户出现在结果中，同样需要递增结果版本号
+	inserted, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes)
+		SELECT DISTINCT poll_id, username, 0 FROM vote_logs WHERE NOT shadow
+		ON CONFLICT (poll_id, username) DO NOTHING`)
+	if err != nil {
+		return 0, fmt.Errorf("补齐用户票数记录失败: %w", err)
+	}
+	added, err := inserted.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取补齐结果失败: %w", err)
+	}
+
+	result, err := tx.Exec(`UPDATE user_votes u
+		SET votes = c.votes, updated_at = NOW()
+		FROM (SELECT u2.poll_id, u2.username, COUNT(l.id) + COALESCE((SELECT SUM(a.delta) FROM admin_actions a
+				WHERE a.poll_id = u2.poll_id AND a.username = u2.username), 0) AS votes
+			FROM user_votes u2 LEFT JOIN vote_logs l ON l.poll_id = u2.poll_id AND l.username = u2.username AND NOT l.shadow AND l.retracted_at IS NULL
+			GROUP BY u2.poll_id, u2.username) c
+		WHERE c.poll_id = u.poll_id AND c.username = u.username AND u.votes <> c.votes`)
+	if err != nil {
+		return 0, fmt.Errorf("对账用户票数失败: %w", err)
+	}
+	reconciled, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取对账结果失败: %w", err)
+	}
+	if added > 0 || reconciled > 0 {
+		if err := pgBumpAllResultsVersionsTx(tx); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return reconciled, nil
+}
+
+// CountPollVotes 从主库的投票日志统计投票活动中各用户的票数，不含影子投票，计入管理员的票数调整
+func (r *PostgresRepository) CountPollVotes(pollID string) ([]*model.UserVote, error) {
+	rows, err := r.masterDB.Query(`SELECT u.username, COUNT(l.id) + COALESCE((SELECT SUM(a.delta) FROM admin_actions a
+			WHERE a.poll_id = $1 AND a.username = u.username), 0)
+		FROM user_votes u
+		LEFT JOIN vote_logs l ON l.poll_id = u.poll_id AND l.username = u.username AND NOT l.shadow AND l.retracted_at IS NULL
+		WHERE u.poll_id = $1
+		GROUP BY u.username
+		ORDER BY u.username`, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("统计投票活动票数失败: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var results []*model.UserVote
+	for rows.Next() {
+		userVote := &model.UserVote{PollID: pollID, UpdatedAt: now}
+		if err := rows.Scan(&userVote.Username, &userVote.Votes); err != nil {
+			return nil, fmt.Errorf("扫描投票活动票数失败: %w", err)
+		}
+		results = append(results, userVote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历投票活动票数失败: %w", err)
+	}
+
+	return results, nil
+}
+
+// SavePollResults 写入投票活动的结果快照，快照已存在时返回ErrPollFinalized
+func (r *PostgresRepository) SavePollResults(pollResults *model.PollResults) error {
+	data, err := json.Marshal(pollResults.Results)
+	if err != nil {
+		return fmt.Errorf("序列化结果快照失败: %w", err)
+	}
+
+	// lib/pq把[]byte作为bytea发送，JSONB字段需要传字符串
+	result, err := r.masterDB.Exec(`INSERT INTO poll_results
+		(poll_id, results, total_votes, reconciled_rows, signature, finalized_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (poll_id) DO NOTHING`,
+		pollResults.PollID, string(data), pollResults.TotalVotes, pollResults.Reconciled,
+		pollResults.Signature, pollResults.FinalizedAt)
+	if err != nil {
+		return fmt.Errorf("保存结果快照失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取保存结果失败: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrPollFinalized
+	}
+	return nil
+}
+
+// GetPollResults 获取投票活动的结果快照，未定稿时返回nil
+func (r *PostgresRepository) GetPollResults(pollID string) (*model.PollResults, error) {
+	var data []byte
+	var finalizedAt time.Time
+	pollResults := &model.PollResults{PollID: pollID, Finalized: true}
+	err := r.masterDB.QueryRow(`SELECT results, total_votes, reconciled_rows, signature, finalized_at
+		FROM poll_results WHERE poll_id = $1`, pollID).Scan(
+		&data, &pollResults.TotalVotes, &pollResults.Reconciled, &pollResults.Signature, &finalizedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询结果快照失败: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &pollResults.Results); err != nil {
+		return nil, fmt.Errorf("解析结果快照失败: %w", err)
+	}
+	pollResults.FinalizedAt = &finalizedAt
+	return pollResults, nil
+}
+
+// ListFinalizedPollIDs 获取所有已定稿的投票活动
+func (r *PostgresRepository) ListFinalizedPollIDs() ([]string, error) {
+	rows, err := r.masterDB.Query("SELECT poll_id FROM poll_results")
+	if err != nil {
+		return nil, fmt.Errorf("查询已定稿的投票活动失败: %w", err)
+	}
+	defer rows.Close()
+
+	var pollIDs []string
+	for rows.Next() {
+		var pollID string
+		if err := rows.Scan(&pollID); err != nil {
+			return nil, fmt.Errorf("扫描已定稿的投票活动失败: %w", err)
+		}
+		pollIDs = append(pollIDs, pollID)
+	}
+	return pollIDs, rows.Err()
+}
+
+// SaveResultSnapshot 保存排名快照
+func (r *PostgresRepository) SaveResultSnapshot(snapshot *model.ResultSnapshot) error {
+	data, err := json.Marshal(snapshot.Standings)
+	if err != nil {
+		return fmt.Errorf("序列化排名快照失败: %w", err)
+	}
+
+	// PostgreSQL不支持LastInsertId，通过RETURNING取回自增id
+	err = r.masterDB.QueryRow("INSERT INTO result_snapshots (taken_at, total_votes, standings) VALUES ($1, $2, $3) RETURNING id",
+		snapshot.TakenAt, snapshot.TotalVotes, string(data)).Scan(&snapshot.ID)
+	if err != nil {
+		return fmt.Errorf("保存排名快照失败: %w", err)
+	}
+	return nil
+}
+
+// GetResultSnapshots 按时间顺序查询[since, until]内的排名快照，零值表示不限制
+func (r *PostgresRepository) GetResultSnapshots(since, until time.Time, limit int) ([]*model.ResultSnapshot, error) {
+	query := "SELECT id, taken_at, total_votes, standings FROM result_snapshots WHERE 1 = 1"
+	var args []interface{}
+	if !since.IsZero() {
+		args = append(args, since)
+		query += fmt.Sprintf(" AND taken_at >= $%d", len(args))
+	}
+	if !until.IsZero() {
+		args = append(args, until)
+		query += fmt.Sprintf(" AND taken_at <= $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY taken_at LIMIT $%d", len(args))
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询排名快照失败: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*model.ResultSnapshot
+	for rows.Next() {
+		var snapshot model.ResultSnapshot
+		var data []byte
+		if err := rows.Scan(&snapshot.ID, &snapshot.TakenAt, &snapshot.TotalVotes, &data); err != nil {
+			return nil, fmt.Errorf("扫描排名快照失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &snapshot.Standings); err != nil {
+			return nil, fmt.Errorf("解析排名快照失败: %w", err)
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历排名快照失败: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// Ping 检查主库是否可用
+func (r *PostgresRepository) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return r.masterDB.PingContext(ctx)
+}
+
+// Close 关闭预编译语句和数据库连接
+func (r *PostgresRepository) Close() {
+	for _, stmt := range []*sql.Stmt{r.incrementStmt, r.logStmt, r.selectUserStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	if r.masterDB != nil {
+		r.masterDB.Close()
+	}
+	if r.slaveDB != nil && r.slaveDB != r.masterDB {
+		r.slaveDB.Close()
+	}
+}
+
+// SaveTicketStats 记录新票据签发的使用次数
+func (r *PostgresRepository) SaveTicketStats(ticket *model.Ticket) error {
+	_, err := r.masterDB.Exec(`INSERT INTO ticket_stats (version, poll_id, issued, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (version) DO NOTHING`,
+		ticket.Version, ticket.PollID, ticket.RemainingUsages, ticket.CreatedAt, ticket.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("保存票据利用率失败: %w", err)
+	}
+	return nil
+}
+
+// RecordTicketConsumption 票据轮换时按剩余使用次数记录实际消耗的次数，每个版本只记录一次
+func (r *PostgresRepository) RecordTicketConsumption(version string, remaining int, rotatedAt time.Time) error {
+	_, err := r.masterDB.Exec(`UPDATE ticket_stats
+		SET consumed = GREATEST(issued - $1, 0), rotated_at = $2
+		WHERE version = $3 AND rotated_at IS NULL`,
+		remaining, rotatedAt, version)
+	if err != nil {
+		return fmt.Errorf("记录票据 %s 的消耗次数失败: %w", version, err)
+	}
+	return nil
+}
+
+// GetTicketStats 按签发时间倒序查询票据利用率，pollID为空时查询所有投票活动
+func (r *PostgresRepository) GetTicketStats(pollID string, limit int) ([]*model.TicketStats, error) {
+	query := "SELECT version, poll_id, issued, consumed, created_at, expires_at, rotated_at FROM ticket_stats"
+	var args []interface{}
+	if pollID != "" {
+		args = append(args, pollID)
+		query += " WHERE poll_id = $1"
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(args))
+
+	rows, err := r.slaveDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询票据利用率失败: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*model.TicketStats
+	for rows.Next() {
+		var s model.TicketStats
+		var consumed sql.NullInt64
+		var rotatedAt sql.NullTime
+		if err := rows.Scan(&s.Version, &s.PollID, &s.Issued, &consumed, &s.CreatedAt, &s.ExpiresAt, &rotatedAt); err != nil {
+			return nil, fmt.Errorf("扫描票据利用率失败: %w", err)
+		}
+		if consumed.Valid {
+			value := int(consumed.Int64)
+			s.Consumed = &value
+		}
+		if rotatedAt.Valid {
+			s.RotatedAt = &rotatedAt.Time
+		}
+		stats = append(stats, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历票据利用率失败: %w", err)
+	}
+
+	return stats, nil
+}
+
+// PurgeTicketStats 删除签发时间早于before的票据利用率记录，返回删除的行数
+func (r *PostgresRepository) PurgeTicketStats(before time.Time, batchSize int) (int64, error) {
+	result, err := r.masterDB.Exec(`DELETE FROM ticket_stats WHERE version IN (
+		SELECT version FROM ticket_stats WHERE created_at < $1 ORDER BY created_at LIMIT $2)`, before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("删除票据利用率失败: %w", err)
+	}
+	return pgRowsDeleted(result)
+}
+
+func pgRowsDeleted(result sql.Result) (int64, error) {
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取删除结果失败: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// SetUserVotes 与MySQLRepository.SetUserVotes相同，用于PostgreSQL
+func (r *PostgresRepository) SetUserVotes(action *model.AdminAction) error {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes) VALUES ($1, $2, 0)
+		ON CONFLICT (poll_id, username) DO NOTHING`, action.PollID, action.Username); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("补齐用户 %s 票数记录失败: %w", action.Username, err)
+	}
+	if err := tx.QueryRow("SELECT votes FROM user_votes WHERE poll_id = $1 AND username = $2 FOR UPDATE",
+		action.PollID, action.Username).Scan(&action.PreviousVotes); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("查询用户 %s 票数失败: %w", action.Username, err)
+	}
+	action.Delta = action.Votes - action.PreviousVotes
+
+	if _, err := tx.Exec("UPDATE user_votes SET votes = $1, updated_at = NOW() WHERE poll_id = $2 AND username = $3",
+		action.Votes, action.PollID, action.Username); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("设置用户 %s 票数失败: %w", action.Username, err)
+	}
+	if err := pgBumpResultsVersionTx(tx, action.PollID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	action.CreatedAt = time.Now()
+	if err := tx.QueryRow(`INSERT INTO admin_actions (action, actor, poll_id, username, previous_votes, votes, delta, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`, action.Action, action.Actor, action.PollID, action.Username,
+		action.PreviousVotes, action.Votes, action.Delta, action.CreatedAt).Scan(&action.ID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("记录管理操作失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// CreateAPIKey 保存API密钥的哈希，写入后回填ID和创建时间
+func (r *PostgresRepository) CreateAPIKey(key *model.APIKey) error {
+	err := r.masterDB.QueryRow(`INSERT INTO api_keys (name, key_prefix, key_hash, scope, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`, key.Name, key.Prefix, key.KeyHash, key.Scope, key.CreatedAt).Scan(&key.ID)
+	if err != nil {
+		return fmt.Errorf("保存API密钥失败: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash 按哈希查询API密钥，包括已吊销的，不存在时返回nil；读主库以便创建后立即可用
+func (r *PostgresRepository) GetAPIKeyByHash(hash string) (*model.APIKey, error) {
+	key, err := scanAPIKey(r.masterDB.QueryRow(selectAPIKeySQL+" WHERE key_hash = $1", hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询API密钥失败: %w", err)
+	}
+	return key, nil
+}
+
+// RevokeAPIKey 吊销API密钥并返回吊销后的记录，不存在或已吊销时返回ErrAPIKeyNotFound
+func (r *PostgresRepository) RevokeAPIKey(id int64) (*model.APIKey, error) {
+	key, err := scanAPIKey(r.masterDB.QueryRow(`UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING id, name, key_prefix, key_hash, scope, created_at, revoked_at`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("吊销API密钥失败: %w", err)
+	}
+	return key, nil
+}
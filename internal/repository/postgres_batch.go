@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// pgMaxBatchLogRows 批量写入投票日志时单条语句最多包含的行数，每行9个参数，不超过PostgreSQL的参数上限
+const pgMaxBatchLogRows = 1000
+
+// IncrementVotesBatch 在一个事务中处理一批投票事件，返回每个事件实际生效的票数
+// 投票日志以多行INSERT ... RETURNING写入并得到新写入的行，各用户新增的票数合并后一次更新
+func (r *PostgresRepository) IncrementVotesBatch(events []*model.VoteEvent) ([]int, error) {
+	return r.writeVoteEventsBatch(events, true)
+}
+
+// AppendVoteLogsBatch 事件溯源模式下在一个事务中追加一批投票事件的投票日志，返回每个事件新写入的日志数
+func (r *PostgresRepository) AppendVoteLogsBatch(events []*model.VoteEvent) ([]int, error) {
+	return r.writeVoteEventsBatch(events, false)
+}
+
+// pgBatchLogRow 一条待写入的投票日志及其所属的事件
+type pgBatchLogRow struct {
+	event    int // 在批次中的序号
+	index    int // event_index
+	pollID   string
+	username string
+}
+
+func (r *PostgresRepository) writeVoteEventsBatch(events []*model.VoteEvent, countVotes bool) ([]int, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 重放或幂等键重复的事件跳过，不影响同一批的其他事件
+	var rows []pgBatchLogRow
+	applied := make([]int, len(events))
+	increments := make(voteIncrements)
+	var pollIDs []string
+	for i, event := range events {
+		pollID := event.PollID
+		if pollID == "" {
+			pollID = model.DefaultPollID
+		}
+		replayed, err := pgClaimConsumerOffset(tx, event)
+		if err != nil {
+			return nil, err
+		}
+		if replayed {
+			continue
+		}
+		// 撤销事件标记被撤销的日志，扣减的一票与同一批新增的票数合并更新
+		if event.Retraction != nil {
+			retracted, key, err := pgRetractVoteTx(tx, event)
+			if err != nil {
+				return nil, err
+			}
+			if retracted {
+				applied[i] = 1
+			}
+			if key != nil {
+				increments[*key]--
+				pollIDs = append(pollIDs, key.pollID)
+			}
+			continue
+		}
+		duplicate, err := pgClaimIdempotencyKey(tx, event, pollID)
+		if err != nil {
+			return nil, err
+		}
+		if duplicate {
+			continue
+		}
+		for j, username := range event.Usernames {
+			rows = append(rows, pgBatchLogRow{event: i, index: event.Index + j, pollID: pollID, username: username})
+		}
+	}
+
+	for start := 0; start < len(rows); start += pgMaxBatchLogRows {
+		chunk := rows[start:min(start+pgMaxBatchLogRows, len(rows))]
+		values := make([]string, 0, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*9)
+		byKey := make(map[string]pgBatchLogRow, len(chunk))
+		for _, row := range chunk {
+			event := events[row.event]
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9))
+			args = append(args, event.EventID, row.index, row.pollID, row.username, event.TicketVersion,
+				event.Audit.Actor, event.Audit.SourceIP, event.Audit.UserAgent, event.Shadow)
+			// 同一批中重复投递的事件只有第一次出现的日志会被写入
+			key := fmt.Sprintf("%s:%d", event.EventID, row.index)
+			if _, ok := byKey[key]; !ok {
+				byKey[key] = row
+			}
+		}
+
+		inserted, err := tx.Query(`INSERT INTO vote_logs (event_id, event_index, poll_id, username, ticket_version, actor, source_ip, user_agent, shadow)
+			VALUES `+strings.Join(values, ", ")+` ON CONFLICT (event_id, event_index) DO NOTHING RETURNING event_id, event_index`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("批量记录 %d 条投票日志失败: %w", len(chunk), err)
+		}
+		for inserted.Next() {
+			var eventID string
+			var index int
+			if err := inserted.Scan(&eventID, &index); err != nil {
+				inserted.Close()
+				return nil, fmt.Errorf("扫描投票日志写入结果失败: %w", err)
+			}
+			row := byKey[fmt.Sprintf("%s:%d", eventID, index)]
+			applied[row.event]++
+			// 影子投票只记录日志，不计入票数
+			if events[row.event].Shadow {
+				continue
+			}
+			if countVotes {
+				increments[voteKey{pollID: row.pollID, username: row.username}]++
+			}
+			pollIDs = append(pollIDs, row.pollID)
+		}
+		inserted.Close()
+		if err := inserted.Err(); err != nil {
+			return nil, fmt.Errorf("获取投票日志写入结果失败: %w", err)
+		}
+	}
+
+	// 事件溯源模式下increments只包含撤销扣减的票数
+	keys := increments.sortedKeys()
+	for start := 0; start < len(keys); start += maxBatchUpsertRows {
+		chunk := keys[start:min(start+maxBatchUpsertRows, len(keys))]
+		values := make([]string, 0, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*3)
+		for _, key := range chunk {
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d)", n+1, n+2, n+3))
+			args = append(args, key.pollID, key.username, increments[key])
+		}
+		if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes) VALUES `+strings.Join(values, ", ")+`
+			ON CONFLICT (poll_id, username) DO UPDATE SET votes = user_votes.votes + EXCLUDED.votes, updated_at = NOW()`,
+			args...); err != nil {
+			return nil, fmt.Errorf("批量更新 %d 个用户的票数失败: %w", len(chunk), err)
+		}
+	}
+
+	// 未经发件箱扣减过的事件在同一事务中扣减票据剩余次数
+	if countVotes {
+		for i, event := range events {
+			if event.Retraction != nil {
+				continue
+			}
+			if err := pgDecrementTicketUsageTx(tx, event, applied[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := pgBumpResultsVersionTx(tx, pollIDs...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// CreateCandidate 登记候选人，已登记时返回ErrCandidateExists
+func (r *PostgresRepository) CreateCandidate(candidate *model.Candidate) error {
+	result, err := r.masterDB.Exec("INSERT INTO candidates (name, created_at) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING",
+		candidate.Name, candidate.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("登记候选人失败: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取候选人写入结果失败: %w", err)
+	}
+	if inserted == 0 {
+		return fmt.Errorf("%w: %s", ErrCandidateExists, candidate.Name)
+	}
+	return nil
+}
+
+// ListCandidates 按名称排序返回所有登记的候选人，读主库以便登记后立即可用
+func (r *PostgresRepository) ListCandidates() ([]*model.Candidate, error) {
+	rows, err := r.masterDB.Query("SELECT name, created_at FROM candidates ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("查询候选人失败: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []*model.Candidate
+	for rows.Next() {
+		var candidate model.Candidate
+		if err := rows.Scan(&candidate.Name, &candidate.CreatedAt); err != nil {
+			return nil, fmt.Errorf("读取候选人失败: %w", err)
+		}
+		candidates = append(candidates, &candidate)
+	}
+	return candidates, rows.Err()
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// pgClaimConsumerOffset 与claimConsumerOffset相同，在落库事务内推进投票事件来源分区的已落库偏移量
+func pgClaimConsumerOffset(tx *sql.Tx, event *model.VoteEvent) (bool, error) {
+	if event.Source == nil {
+		return false, nil
+	}
+
+	result, err := tx.Exec(`INSERT INTO consumer_offsets (topic, partition_id, last_offset) VALUES ($1, $2, $3)
+		ON CONFLICT (topic, partition_id) DO UPDATE SET last_offset = EXCLUDED.last_offset, updated_at = NOW()
+		WHERE consumer_offsets.last_offset < EXCLUDED.last_offset`,
+		event.Source.Topic, event.Source.Partition, event.Source.Offset)
+	if err != nil {
+		return false, fmt.Errorf("登记消费偏移量失败: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("获取消费偏移量登记结果失败: %w", err)
+	}
+	return affected == 0, nil
+}
+
+// GetConsumerOffsets 查询主题各分区已落库的最大偏移量，读主库
+func (r *PostgresRepository) GetConsumerOffsets(topic string) (map[int]int64, error) {
+	rows, err := r.masterDB.Query("SELECT partition_id, last_offset FROM consumer_offsets WHERE topic = $1", topic)
+	if err != nil {
+		return nil, fmt.Errorf("查询消费偏移量失败: %w", err)
+	}
+	defer rows.Close()
+	return scanConsumerOffsets(rows)
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// pgClaimIdempotencyKey 与claimIdempotencyKey相同，在落库事务内登记投票事件的幂等键
+func pgClaimIdempotencyKey(tx *sql.Tx, event *model.VoteEvent, pollID string) (bool, error) {
+	if event.IdempotencyKey == "" {
+		return false, nil
+	}
+
+	// 并发登记同一个键时，ON CONFLICT会等待另一个事务结束后再判断冲突
+	result, err := tx.Exec(`INSERT INTO vote_idempotency_keys (idempotency_key, event_id, poll_id, ticket_version)
+		VALUES ($1, $2, $3, $4) ON CONFLICT (idempotency_key) DO NOTHING`,
+		event.IdempotencyKey, event.EventID, pollID, event.TicketVersion)
+	if err != nil {
+		return false, fmt.Errorf("登记幂等键失败: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("获取幂等键登记结果失败: %w", err)
+	}
+	if inserted > 0 {
+		return false, nil
+	}
+
+	var eventID string
+	err = tx.QueryRow("SELECT event_id FROM vote_idempotency_keys WHERE idempotency_key = $1 FOR SHARE",
+		event.IdempotencyKey).Scan(&eventID)
+	if err != nil {
+		return false, fmt.Errorf("查询幂等键失败: %w", err)
+	}
+	return eventID != event.EventID, nil
+}
+
+// GetVoteIdempotencyKey 查询幂等键的登记记录，读主库以确认已持久化，不存在时返回nil
+func (r *PostgresRepository) GetVoteIdempotencyKey(key string) (*model.VoteIdempotencyRecord, error) {
+	record := &model.VoteIdempotencyRecord{Key: key}
+	err := r.masterDB.QueryRow(`SELECT event_id, poll_id, ticket_version, created_at
+		FROM vote_idempotency_keys WHERE idempotency_key = $1`, key).
+		Scan(&record.EventID, &record.PollID, &record.TicketVersion, &record.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询幂等键失败: %w", err)
+	}
+	return record, nil
+}
+
+// PurgeVoteIdempotencyKeys 删除登记时间早于before的幂等键，返回删除的行数
+func (r *PostgresRepository) PurgeVoteIdempotencyKeys(before time.Time, batchSize int) (int64, error) {
+	result, err := r.masterDB.Exec(`DELETE FROM vote_idempotency_keys WHERE idempotency_key IN (
+		SELECT idempotency_key FROM vote_idempotency_keys WHERE created_at < $1 ORDER BY created_at LIMIT $2)`,
+		before, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("删除幂等键失败: %w", err)
+	}
+	return pgRowsDeleted(result)
+}
+
+// EnqueueVoteEvent 在同一个事务中扣减票据剩余次数，并把投票事件写入发件箱，由中继任务异步发送到Kafka
+// consumeTicket为false时只写入发件箱，事件溯源模式下票据剩余次数由投影任务推导
+func (r *PostgresRepository) EnqueueVoteEvent(event *model.VoteEvent, consumeTicket bool) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化投票事件失败: %w", err)
+	}
+
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if consumeTicket {
+		if _, err := tx.Exec("UPDATE tickets SET remaining_usages = GREATEST(remaining_usages - 1, 0) WHERE version = $1",
+			event.TicketVersion); err != nil {
+			return fmt.Errorf("扣减票据 %s 使用次数失败: %w", event.TicketVersion, err)
+		}
+	}
+
+	if _, err := tx.Exec("INSERT INTO outbox (event_id, payload) VALUES ($1, $2)", event.EventID, string(payload)); err != nil {
+		return fmt.Errorf("写入发件箱失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// DrainOutbox 按写入顺序取出一批投票事件交给publish发送，发送成功后从发件箱删除，返回发送的事件数
+// 已被其他实例锁定的行直接跳过，多个实例可以同时中继；无法解析的行标记为失败后不再取出
+func (r *PostgresRepository) DrainOutbox(batchSize int, publish func([]*model.VoteEvent) error) (int, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, payload FROM outbox WHERE failed_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED", batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("查询发件箱失败: %w", err)
+	}
+
+	var ids []int64
+	var events []*model.VoteEvent
+	var failed []outboxFailure
+	for rows.Next() {
+		var (
+			id      int64
+			payload []byte
+		)
+		if err := rows.Scan(&id, &payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描发件箱失败: %w", err)
+		}
+
+		var event model.VoteEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			failed = append(failed, outboxFailure{id: id, err: err})
+			continue
+		}
+		ids = append(ids, id)
+		events = append(events, &event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("遍历发件箱失败: %w", err)
+	}
+
+	// 无法解析的事件标记为失败后跳过，不阻塞后面的事件
+	for _, f := range failed {
+		if err := markOutboxFailed(tx, true, f.id, f.err); err != nil {
+			return 0, err
+		}
+		r.logger.Error("发件箱中的投票事件无法解析，已标记为失败", "id", f.id, "error", f.err)
+	}
+
+	if len(events) > 0 {
+		if err := publish(events); err != nil {
+			return 0, err
+		}
+
+		if _, err := tx.Exec("DELETE FROM outbox WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+			return 0, fmt.Errorf("删除已发送的发件箱事件失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return len(events), nil
+}
+
+// GetOutboxStats 统计发件箱中尚未发送到Kafka的投票事件数、最早一条的写入时间和标记为失败的事件数
+func (r *PostgresRepository) GetOutboxStats() (*model.OutboxStats, error) {
+	var (
+		stats  model.OutboxStats
+		oldest sql.NullTime
+	)
+	if err := r.masterDB.QueryRow("SELECT COUNT(*), MIN(created_at) FROM outbox WHERE failed_at IS NULL").Scan(&stats.Backlog, &oldest); err != nil {
+		return nil, fmt.Errorf("统计发件箱失败: %w", err)
+	}
+	if oldest.Valid {
+		stats.OldestAt = &oldest.Time
+	}
+	if err := r.masterDB.QueryRow("SELECT COUNT(*) FROM outbox WHERE failed_at IS NOT NULL").Scan(&stats.Failed); err != nil {
+		return nil, fmt.Errorf("统计发件箱失败事件失败: %w", err)
+	}
+	return &stats, nil
+}
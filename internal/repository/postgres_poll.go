@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// CreatePoll 创建投票活动，并为每个候选人插入票数为0的记录，ID已被使用时返回ErrPollExists
+func (r *PostgresRepository) CreatePoll(poll *model.Poll) error {
+	candidates, err := json.Marshal(poll.Candidates)
+	if err != nil {
+		return fmt.Errorf("序列化候选人列表失败: %w", err)
+	}
+
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO polls (id, title, candidates, starts_at, ends_at, shadow, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING`,
+		poll.ID, poll.Title, string(candidates), poll.StartsAt, poll.EndsAt, poll.Shadow, poll.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("创建投票活动失败: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取投票活动写入结果失败: %w", err)
+	}
+	if inserted == 0 {
+		return fmt.Errorf("%w: %s", ErrPollExists, poll.ID)
+	}
+
+	for _, username := range poll.Candidates {
+		if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes) VALUES ($1, $2, 0)
+			ON CONFLICT (poll_id, username) DO NOTHING`, poll.ID, username); err != nil {
+			return fmt.Errorf("插入候选人 %s 失败: %w", username, err)
+		}
+	}
+	if err := pgBumpResultsVersionTx(tx, poll.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// GetPoll 查询投票活动，不存在时返回nil，读主库以便创建后立即可见
+func (r *PostgresRepository) GetPoll(pollID string) (*model.Poll, error) {
+	poll, err := scanPoll(r.masterDB.QueryRow(selectPollSQL+" WHERE id = $1", pollID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动失败: %w", err)
+	}
+	return poll, nil
+}
+
+// SetPollShadow 开启或关闭投票活动的影子模式，活动不存在时不做修改
+func (r *PostgresRepository) SetPollShadow(pollID string, shadow bool) error {
+	if _, err := r.masterDB.Exec("UPDATE polls SET shadow = $1 WHERE id = $2", shadow, pollID); err != nil {
+		return fmt.Errorf("更新投票活动 %s 的影子模式失败: %w", pollID, err)
+	}
+	return nil
+}
+
+// ListPolls 查询所有投票活动，按ID排序
+func (r *PostgresRepository) ListPolls() ([]*model.Poll, error) {
+	rows, err := r.slaveDB.Query(selectPollSQL + " ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动失败: %w", err)
+	}
+	return scanPolls(rows)
+}
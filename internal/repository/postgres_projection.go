@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// AppendVoteLogs 只写入投票事件的投票日志，不更新票数，返回本次新写入的日志条数
+func (r *PostgresRepository) AppendVoteLogs(event *model.VoteEvent) (int, error) {
+	return r.writeVoteLogs(event, false)
+}
+
+// ApplyVoteProjection 按id顺序把投影进度之后的一批投票日志应用到user_votes和tickets
+// 只投影写入超过settleDelay的日志，遇到尚未稳定的日志即停止，避免序列号乱序提交时跳过日志
+func (r *PostgresRepository) ApplyVoteProjection(batchSize int, settleDelay time.Duration) (*ProjectionBatch, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastLogID int64
+	err = tx.QueryRow("SELECT last_log_id FROM projection_state WHERE name = $1 FOR UPDATE", VoteProjectionName).Scan(&lastLogID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("投影进度 %s 不存在", VoteProjectionName)
+		}
+		return nil, fmt.Errorf("查询投影进度失败: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT id, poll_id, username, ticket_version, event_index, shadow,
+			voted_at < NOW() - make_interval(secs => $1) AS settled
+		FROM vote_logs WHERE id > $2 ORDER BY id LIMIT $3`,
+		settleDelay.Seconds(), lastLogID, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("查询待投影的投票日志失败: %w", err)
+	}
+
+	batch := &ProjectionBatch{LastLogID: lastLogID}
+	votes := make(map[PollCandidate]int)
+	ticketUses := make(map[string]int)
+	for rows.Next() {
+		var (
+			id            int64
+			candidate     PollCandidate
+			ticketVersion string
+			eventIndex    int
+			shadow        bool
+			settled       bool
+		)
+		if err := rows.Scan(&id, &candidate.PollID, &candidate.Username, &ticketVersion, &eventIndex, &shadow, &settled); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描投票日志失败: %w", err)
+		}
+		if !settled {
+			break
+		}
+
+		// 影子投票只消耗票据，不计入票数
+		if !shadow {
+			votes[candidate]++
+		}
+		// 一次投票只消耗一次票据，由第一条日志计入
+		if eventIndex == 0 {
+			ticketUses[ticketVersion]++
+		}
+		batch.LastLogID = id
+		batch.Applied++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历投票日志失败: %w", err)
+	}
+
+	if batch.Applied == 0 {
+		return batch, nil
+	}
+
+	var pollIDs []string
+	for candidate, count := range votes {
+		if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes) VALUES ($1, $2, $3)
+			ON CONFLICT (poll_id, username) DO UPDATE SET votes = user_votes.votes + EXCLUDED.votes, updated_at = NOW()`,
+			candidate.PollID, candidate.Username, count); err != nil {
+			return nil, fmt.Errorf("投影投票活动 %s 用户 %s 票数失败: %w", candidate.PollID, candidate.Username, err)
+		}
+		batch.Candidates = append(batch.Candidates, candidate)
+		pollIDs = append(pollIDs, candidate.PollID)
+	}
+	if err := pgBumpResultsVersionTx(tx, pollIDs...); err != nil {
+		return nil, err
+	}
+
+	for version, uses := range ticketUses {
+		if _, err := tx.Exec("UPDATE tickets SET remaining_usages = GREATEST(remaining_usages - $1, 0) WHERE version = $2",
+			uses, version); err != nil {
+			return nil, fmt.Errorf("投影票据 %s 使用次数失败: %w", version, err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE projection_state SET last_log_id = $1, updated_at = NOW() WHERE name = $2",
+		batch.LastLogID, VoteProjectionName); err != nil {
+		return nil, fmt.Errorf("更新投影进度失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return batch, nil
+}
+
+// GetVoteProjectionProgress 查询投影进度，即已应用到user_votes的最大投票日志id，读主库
+func (r *PostgresRepository) GetVoteProjectionProgress() (int64, error) {
+	var lastLogID int64
+	err := r.masterDB.QueryRow("SELECT last_log_id FROM projection_state WHERE name = $1", VoteProjectionName).Scan(&lastLogID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("查询投影进度失败: %w", err)
+	}
+	return lastLogID, nil
+}
+
+// RebuildVoteProjection 丢弃当前投影，从全部投票日志和管理员的票数调整重新计算user_votes和tickets的剩余次数
+func (r *PostgresRepository) RebuildVoteProjection() (int64, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 锁住投影进度，重建期间投影任务等待
+	var lastLogID int64
+	err = tx.QueryRow("SELECT last_log_id FROM projection_state WHERE name = $1 FOR UPDATE", VoteProjectionName).Scan(&lastLogID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("查询投影进度失败: %w", err)
+	}
+
+	var maxLogID int64
+	if err := tx.QueryRow("SELECT COALESCE(MAX(id), 0) FROM vote_logs").Scan(&maxLogID); err != nil {
+		return 0, fmt.Errorf("查询投票日志最大id失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes)
+		SELECT DISTINCT poll_id, username, 0 FROM vote_logs WHERE id <= $1 AND NOT shadow
+		ON CONFLICT (poll_id, username) DO NOTHING`, maxLogID); err != nil {
+		return 0, fmt.Errorf("补齐用户票数记录失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE user_votes u
+		SET votes = (SELECT COUNT(*) FROM vote_logs l
+				WHERE l.poll_id = u.poll_id AND l.username = u.username AND l.id <= $1 AND NOT l.shadow AND l.retracted_at IS NULL)
+				+ COALESCE((SELECT SUM(a.delta) FROM admin_actions a WHERE a.poll_id = u.poll_id AND a.username = u.username), 0),
+			updated_at = NOW()`, maxLogID); err != nil {
+		return 0, fmt.Errorf("重建用户票数失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE tickets t
+		SET remaining_usages = GREATEST(s.issued - (SELECT COUNT(*) FROM vote_logs l
+			WHERE l.ticket_version = t.version AND l.id <= $1 AND l.event_index = 0), 0)
+		FROM ticket_stats s
+		WHERE s.version = t.version`, maxLogID); err != nil {
+		return 0, fmt.Errorf("重建票据剩余次数失败: %w", err)
+	}
+
+	if err := pgBumpAllResultsVersionsTx(tx); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO projection_state (name, last_log_id) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET last_log_id = EXCLUDED.last_log_id, updated_at = NOW()`,
+		VoteProjectionName, maxLogID); err != nil {
+		return 0, fmt.Errorf("更新投影进度失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return maxLogID, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// pgBumpResultsVersionTx 与bumpResultsVersionTx相同，用于PostgreSQL
+func pgBumpResultsVersionTx(tx *sql.Tx, pollIDs ...string) error {
+	sort.Strings(pollIDs)
+	for i, pollID := range pollIDs {
+		if i > 0 && pollID == pollIDs[i-1] {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO poll_results_versions (poll_id, version) VALUES ($1, 1)
+			ON CONFLICT (poll_id) DO UPDATE SET version = poll_results_versions.version + 1`, pollID); err != nil {
+			return fmt.Errorf("递增投票活动 %s 的结果版本号失败: %w", pollID, err)
+		}
+	}
+	return nil
+}
+
+// pgBumpAllResultsVersionsTx 与bumpAllResultsVersionsTx相同，用于PostgreSQL
+func pgBumpAllResultsVersionsTx(tx *sql.Tx) error {
+	if _, err := tx.Exec(`INSERT INTO poll_results_versions (poll_id, version)
+		SELECT DISTINCT poll_id, 1 FROM user_votes
+		ON CONFLICT (poll_id) DO UPDATE SET version = poll_results_versions.version + 1`); err != nil {
+		return fmt.Errorf("递增结果版本号失败: %w", err)
+	}
+	return nil
+}
+
+// GetResultsVersion 返回投票活动的结果版本号，读主库；尚未计票的投票活动为0
+func (r *PostgresRepository) GetResultsVersion(pollID string) (int64, error) {
+	var version int64
+	err := r.masterDB.QueryRow("SELECT version FROM poll_results_versions WHERE poll_id = $1", pollID).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("查询投票活动 %s 的结果版本号失败: %w", pollID, err)
+	}
+	return version, nil
+}
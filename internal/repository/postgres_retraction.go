@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// GetVoteLog 从主库查询一条投票日志，撤销投票前以最新状态校验
+func (r *PostgresRepository) GetVoteLog(id int64) (*model.VoteLog, error) {
+	rows, err := r.masterDB.Query(`SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	logs, err := scanVoteLogs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, ErrVoteLogNotFound
+	}
+	return logs[0], nil
+}
+
+// pgRetractVoteTx 与retractVoteTx相同，用于PostgreSQL
+func pgRetractVoteTx(tx *sql.Tx, event *model.VoteEvent) (bool, *voteKey, error) {
+	retraction := event.Retraction
+	var key voteKey
+	var shadow bool
+	err := tx.QueryRow("SELECT poll_id, username, shadow FROM vote_logs WHERE id = $1 FOR UPDATE",
+		retraction.VoteLogID).Scan(&key.pollID, &key.username, &shadow)
+	if err == sql.ErrNoRows {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("查询待撤销的投票日志 %d 失败: %w", retraction.VoteLogID, err)
+	}
+	if key.username != retraction.Username {
+		return false, nil, nil
+	}
+
+	result, err := tx.Exec(`INSERT INTO vote_retractions (vote_log_id, event_id, poll_id, actor)
+		VALUES ($1, $2, $3, $4) ON CONFLICT (vote_log_id) DO NOTHING`,
+		retraction.VoteLogID, event.EventID, key.pollID, event.Audit.Actor)
+	if err != nil {
+		return false, nil, fmt.Errorf("登记投票日志 %d 的撤销记录失败: %w", retraction.VoteLogID, err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, nil, fmt.Errorf("获取撤销记录写入结果失败: %w", err)
+	}
+	if inserted == 0 {
+		return false, nil, nil
+	}
+
+	if _, err := tx.Exec("UPDATE vote_logs SET retracted_at = NOW() WHERE id = $1", retraction.VoteLogID); err != nil {
+		return false, nil, fmt.Errorf("标记投票日志 %d 已撤销失败: %w", retraction.VoteLogID, err)
+	}
+	if shadow {
+		return true, nil, nil
+	}
+	return true, &key, nil
+}
+
+// pgApplyRetractionTx 与applyRetractionTx相同，用于PostgreSQL
+func pgApplyRetractionTx(tx *sql.Tx, event *model.VoteEvent) (int, error) {
+	applied, key, err := pgRetractVoteTx(tx, event)
+	if err != nil || !applied {
+		return 0, err
+	}
+	if key != nil {
+		if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes) VALUES ($1, $2, -1)
+			ON CONFLICT (poll_id, username) DO UPDATE SET votes = user_votes.votes - 1, updated_at = NOW()`,
+			key.pollID, key.username); err != nil {
+			return 0, fmt.Errorf("扣减用户 %s 票数失败: %w", key.username, err)
+		}
+		if err := pgBumpResultsVersionTx(tx, key.pollID); err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
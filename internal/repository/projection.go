@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// VoteProjectionName 票数投影在projection_state中的名称
+const VoteProjectionName = "votes"
+
+// ProjectionBatch 一次投影的结果
+type ProjectionBatch struct {
+	LastLogID  int64           // 投影后的进度
+	Applied    int             // 本次投影的投票日志条数
+	Candidates []PollCandidate // 票数发生变化的候选人
+}
+
+// PollCandidate 投票活动中的一个候选人
+type PollCandidate struct {
+	PollID   string
+	Username string
+}
+
+// AppendVoteLogs 只写入投票事件的投票日志，不更新票数，返回本次新写入的日志条数
+// 事件溯源模式下使用，票数由投影任务从投票日志推导
+func (r *MySQLRepository) AppendVoteLogs(event *model.VoteEvent) (int, error) {
+	pollID := event.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+
+	// 消息已经落库过，说明是消费者重启或分区重新分配后的重放
+	replayed, err := claimConsumerOffset(tx, event)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if replayed {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	// 撤销事件不写入投票日志，标记被撤销的日志并扣减票数
+	if event.Retraction != nil {
+		applied, err := applyRetractionTx(tx, event)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, fmt.Errorf("提交事务失败: %w", err)
+		}
+		return applied, nil
+	}
+
+	// 幂等键已被其他投票事件使用，说明是客户端重试产生的重复投票，不再计票
+	duplicate, err := claimIdempotencyKey(tx, event, pollID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if duplicate {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	logStmt := tx.Stmt(r.logStmt)
+	defer logStmt.Close()
+
+	applied := 0
+	for i, username := range event.Usernames {
+		result, err := logStmt.Exec(event.EventID, event.Index+i, pollID, username, event.TicketVersion,
+			event.Audit.Actor, event.Audit.SourceIP, event.Audit.UserAgent, event.Shadow)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("记录用户 %s 投票日志失败: %w", username, err)
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("获取投票日志写入结果失败: %w", err)
+		}
+		applied += int(inserted)
+	}
+
+	// 结果直接从投票日志统计，不必等投影
+	if applied > 0 && !event.Shadow {
+		if err := bumpResultsVersionTx(tx, pollID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return applied, nil
+}
+
+// ApplyVoteProjection 按id顺序把投影进度之后的一批投票日志应用到user_votes和tickets
+// 只投影写入超过settleDelay的日志，遇到尚未稳定的日志即停止，避免自增id乱序提交时跳过日志
+// 投影进度行加锁，多个实例同时执行时依次进行，不会重复计票
+func (r *MySQLRepository) ApplyVoteProjection(batchSize int, settleDelay time.Duration) (*ProjectionBatch, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastLogID int64
+	err = tx.QueryRow("SELECT last_log_id FROM projection_state WHERE name = ? FOR UPDATE", VoteProjectionName).Scan(&lastLogID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("投影进度 %s 不存在", VoteProjectionName)
+		}
+		return nil, fmt.Errorf("查询投影进度失败: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT id, poll_id, username, ticket_version, event_index, shadow,
+			voted_at < DATE_SUB(NOW(), INTERVAL ? SECOND) AS settled
+		FROM vote_logs WHERE id > ? ORDER BY id LIMIT ?`,
+		int(settleDelay/time.Second), lastLogID, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("查询待投影的投票日志失败: %w", err)
+	}
+
+	batch := &ProjectionBatch{LastLogID: lastLogID}
+	votes := make(map[PollCandidate]int)
+	ticketUses := make(map[string]int)
+	for rows.Next() {
+		var (
+			id            int64
+			candidate     PollCandidate
+			ticketVersion string
+			eventIndex    int
+			shadow        bool
+			settled       bool
+		)
+		if err := rows.Scan(&id, &candidate.PollID, &candidate.Username, &ticketVersion, &eventIndex, &shadow, &settled); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描投票日志失败: %w", err)
+		}
+		if !settled {
+			break
+		}
+
+		// 影子投票只消耗票据，不计入票数
+		if !shadow {
+			votes[candidate]++
+		}
+		// 一次投票只消耗一次票据，由第一条日志计入
+		if eventIndex == 0 {
+			ticketUses[ticketVersion]++
+		}
+		batch.LastLogID = id
+		batch.Applied++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历投票日志失败: %w", err)
+	}
+
+	if batch.Applied == 0 {
+		return batch, nil
+	}
+
+	var pollIDs []string
+	for candidate, count := range votes {
+		if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE votes = votes + VALUES(votes)`, candidate.PollID, candidate.Username, count); err != nil {
+			return nil, fmt.Errorf("投影投票活动 %s 用户 %s 票数失败: %w", candidate.PollID, candidate.Username, err)
+		}
+		batch.Candidates = append(batch.Candidates, candidate)
+		pollIDs = append(pollIDs, candidate.PollID)
+	}
+	// 投影可能为新的候选人补齐票数记录，结果中随之出现该候选人
+	if err := bumpResultsVersionTx(tx, pollIDs...); err != nil {
+		return nil, err
+	}
+
+	// 已清理的票据不再需要更新剩余次数
+	for version, uses := range ticketUses {
+		if _, err := tx.Exec("UPDATE tickets SET remaining_usages = GREATEST(remaining_usages - ?, 0) WHERE version = ?",
+			uses, version); err != nil {
+			return nil, fmt.Errorf("投影票据 %s 使用次数失败: %w", version, err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE projection_state SET last_log_id = ? WHERE name = ?", batch.LastLogID, VoteProjectionName); err != nil {
+		return nil, fmt.Errorf("更新投影进度失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return batch, nil
+}
+
+// GetVoteProjectionProgress 查询投影进度，即已应用到user_votes的最大投票日志id，读主库
+func (r *MySQLRepository) GetVoteProjectionProgress() (int64, error) {
+	var lastLogID int64
+	err := r.masterDB.QueryRow("SELECT last_log_id FROM projection_state WHERE name = ?", VoteProjectionName).Scan(&lastLogID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("查询投影进度失败: %w", err)
+	}
+	return lastLogID, nil
+}
+
+// RebuildVoteProjection 丢弃当前投影，从全部投票日志和管理员的票数调整重新计算user_votes和tickets的剩余次数
+// 票据的签发次数取自ticket_stats，没有签发记录的票据保持不变；返回重建后的投影进度
+func (r *MySQLRepository) RebuildVoteProjection() (int64, error) {
+	tx, err := r.masterDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 锁住投影进度，重建期间投影任务等待
+	var lastLogID int64
+	err = tx.QueryRow("SELECT last_log_id FROM projection_state WHERE name = ? FOR UPDATE", VoteProjectionName).Scan(&lastLogID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("查询投影进度失败: %w", err)
+	}
+
+	var maxLogID int64
+	if err := tx.QueryRow("SELECT COALESCE(MAX(id), 0) FROM vote_logs").Scan(&maxLogID); err != nil {
+		return 0, fmt.Errorf("查询投票日志最大id失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`INSERT IGNORE INTO user_votes (poll_id, username, votes)
+		SELECT DISTINCT poll_id, username, 0 FROM vote_logs WHERE id <= ? AND shadow = 0`, maxLogID); err != nil {
+		return 0, fmt.Errorf("补齐用户票数记录失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE user_votes u
+		LEFT JOIN (SELECT poll_id, username, COUNT(*) AS votes FROM vote_logs WHERE id <= ? AND shadow = 0 AND retracted_at IS NULL GROUP BY poll_id, username) l
+			ON l.poll_id = u.poll_id AND l.username = u.username
+		LEFT JOIN (SELECT poll_id, username, SUM(delta) AS delta FROM admin_actions GROUP BY poll_id, username) a
+			ON a.poll_id = u.poll_id AND a.username = u.username
+		SET u.votes = COALESCE(l.votes, 0) + COALESCE(a.delta, 0)`, maxLogID); err != nil {
+		return 0, fmt.Errorf("重建用户票数失败: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE tickets t
+		JOIN ticket_stats s ON s.version = t.version
+		LEFT JOIN (SELECT ticket_version, COUNT(*) AS used FROM vote_logs
+			WHERE id <= ? AND event_index = 0 GROUP BY ticket_version) l
+			ON l.ticket_version = t.version
+		SET t.remaining_usages = GREATEST(s.issued - COALESCE(l.used, 0), 0)`, maxLogID); err != nil {
+		return 0, fmt.Errorf("重建票据剩余次数失败: %w", err)
+	}
+
+	if err := bumpAllResultsVersionsTx(tx); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO projection_state (name, last_log_id) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE last_log_id = VALUES(last_log_id)`, VoteProjectionName, maxLogID); err != nil {
+		return 0, fmt.Errorf("更新投影进度失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return maxLogID, nil
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// TakeRateLimitTokens 从subject的令牌桶中取出cost个令牌，令牌每秒补充rate个，最多burst个
+// 令牌足够时返回0，否则不扣减并返回令牌补足所需的时长
+func (r *RedisRepository) TakeRateLimitTokens(subject string, rate float64, burst, cost int) (time.Duration, error) {
+	result, err := r.evalScript("takeRateLimitTokens", TakeRateLimitTokensScript,
+		[]string{RateLimitKey + subject}, rate, burst, time.Now().UnixMilli(), cost)
+	if err != nil {
+		return 0, fmt.Errorf("扣减 %s 的投票限流令牌失败: %w", subject, err)
+	}
+
+	wait, _ := result.(int64)
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -3,21 +3,55 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
 	"github.com/lvdashuaibi/littlevote/internal/model"
 )
 
 const (
 	// Redis键前缀
 	UserVoteKey       = "user:vote:"
+	UserVoteLastKey   = "user:vote:last"
+	UserVoteAllKey    = "user:vote:all"
 	TicketKey         = "ticket:"
 	TicketVersionKey  = "ticket:newest:version"
 	TicketLockKey     = "ticket:lock:"
 	TicketProducerKey = "ticket:producer:lock"
+	ProducerInfoKey   = "ticket:producer:info"
+	TicketBudgetKey   = "ticket:budget:"
+	VoteDedupKey      = "vote:dedup:"
+	VoteIdemKey       = "vote:idem:"
+	// 票据流水线中预生成、尚未生效的票据版本，以及轮换后仍在重叠窗口内的上一个版本
+	TicketPendingVersionKey  = "ticket:pending:version"
+	TicketPreviousVersionKey = "ticket:previous:version"
+	// 两阶段投票的预约，以及按过期时间排序的待释放预约
+	VoteReservationKey       = "vote:reservation:"
+	VoteReservationExpiryKey = "vote:reservation:expiry"
+	// 已从票据扣减、等待投票受理后确认的使用次数，以及按过期时间排序的待释放占用
+	TicketHoldKey       = "ticket:hold:"
+	TicketHoldExpiryKey = "ticket:hold:expiry"
+	// 票据校验失败计数，以及失败次数过多被暂时禁止使用票据的客户端
+	TicketFailureKey = "ticket:failures:"
+	TicketBlockKey   = "ticket:blocked:"
+	// 按票数排序的排行榜，以及各用户票数的最后更新时间
+	LeaderboardKey        = "leaderboard:votes"
+	LeaderboardUpdatedKey = "leaderboard:updated"
+	// 按客户端IP限制投票频率的令牌桶
+	RateLimitKey = "ratelimit:vote:"
+
+	CandidatesKey = "candidates"
+
+	// PollClosedVersion 投票活动结束后最新票据版本被置为该值，所有票据随之失效
+	PollClosedVersion = "closed"
 
 	// Lua脚本
 	DecrementTicketUsageScript = `
@@ -29,7 +63,7 @@ const (
 		
 		-- 检查剩余使用次数
 		if remaining <= 0 then
-			return {-1, "票据使用次数已耗尽"}
+			return {-2, "票据使用次数已耗尽"}
 		end
 		
 		-- 减少使用次数并更新
@@ -39,17 +73,263 @@ const (
 		-- 返回更新后的剩余次数
 		return {0, remaining}
 	`
+
+	// 依次为每张票据扣减一次使用次数并登记占用，返回与各票据一一对应的结果：扣减后的剩余次数，-1表示票据数据损坏，-2表示使用次数已耗尽
+	// KEYS[1]为按过期时间排序的待释放占用，之后每张票据依次为票据键和占用键；ARGV[1]为过期时间毫秒数，ARGV[2]为占用键的保留毫秒数，
+	// 之后每张票据依次为占用ID、票据版本和客户端绑定模式下扣减了配额的客户端（可为空）。同一张票据出现多次时按顺序扣减，一项失败不影响其他项
+	HoldTicketUsagesScript = `
+		local results = {}
+		local n = (#KEYS - 1) / 2
+		for i = 1, n do
+			local ticketKey = KEYS[2 * i]
+			local holdKey = KEYS[2 * i + 1]
+			local remaining = tonumber(redis.call('HGET', ticketKey, 'remainingUsages'))
+			if not remaining then
+				results[i] = -1
+			elseif remaining <= 0 then
+				results[i] = -2
+			else
+				remaining = remaining - 1
+				redis.call('HSET', ticketKey, 'remainingUsages', remaining)
+				redis.call('HSET', holdKey, 'version', ARGV[3 * i + 1], 'holder', ARGV[3 * i + 2])
+				redis.call('PEXPIRE', holdKey, ARGV[2])
+				redis.call('ZADD', KEYS[1], ARGV[1], ARGV[3 * i])
+				results[i] = remaining
+			end
+		end
+		return results
+	`
+
+	// 释放一次票据使用次数的占用，归还票据使用次数和客户端配额；占用已确认或已释放时返回0
+	// KEYS[1]为占用键，KEYS[2]为待释放占用；ARGV[1]为占用ID，ARGV[2]为票据键前缀，与占用中的版本拼接为票据键
+	ReleaseTicketUsageScript = `
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		local hold = redis.call('HMGET', KEYS[1], 'version', 'holder')
+		if not hold[1] then
+			return 0
+		end
+		redis.call('DEL', KEYS[1])
+		local ticketKey = ARGV[2] .. hold[1]
+		if redis.call('EXISTS', ticketKey) == 0 then
+			return 0
+		end
+		redis.call('HINCRBY', ticketKey, 'remainingUsages', 1)
+		if hold[2] and hold[2] ~= '' and redis.call('HEXISTS', ticketKey, 'holder:' .. hold[2]) == 1 then
+			redis.call('HINCRBY', ticketKey, 'holder:' .. hold[2], 1)
+		end
+		return 1
+	`
+
+	// 从投票活动的总预算中申请票据使用次数，返回实际批准的次数
+	ReserveTicketBudgetScript = `
+		local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+		local want = tonumber(ARGV[1])
+		local budget = tonumber(ARGV[2])
+		local granted = math.min(want, budget - used)
+		if granted <= 0 then
+			return 0
+		end
+		redis.call('INCRBY', KEYS[1], granted)
+		return granted
+	`
+
+	// 投票活动未结束时才更新最新票据版本，返回0表示活动已结束
+	// ARGV[3]大于0时被替换的版本在该毫秒数内记为上一个版本；新版本是预生成的版本时清除预生成记录
+	SetNewestTicketVersionScript = `
+		local current = redis.call('GET', KEYS[1])
+		if current == ARGV[2] then
+			return 0
+		end
+		redis.call('SET', KEYS[1], ARGV[1])
+		if current and current ~= ARGV[1] and tonumber(ARGV[3]) > 0 then
+			redis.call('SET', KEYS[2], current, 'PX', ARGV[3])
+		end
+		if redis.call('GET', KEYS[3]) == ARGV[1] then
+			redis.call('DEL', KEYS[3])
+		end
+		return 1
+	`
+
+	// 取出投票预约，confirm模式只取未过期的预约，expire模式只取已过期的预约
+	// 预约数据已丢失时返回空字符串，预约不存在或不符合模式时返回nil
+	TakeVoteReservationScript = `
+		local score = redis.call('ZSCORE', KEYS[2], ARGV[1])
+		if not score then
+			return false
+		end
+		local expired = tonumber(score) <= tonumber(ARGV[2])
+		if (ARGV[3] == 'expire') ~= expired then
+			return false
+		end
+		redis.call('ZREM', KEYS[2], ARGV[1])
+		local data = redis.call('GET', KEYS[1])
+		redis.call('DEL', KEYS[1])
+		return data or ''
+	`
+
+	// 归还一次票据使用次数，票据已不存在时不做处理
+	RestoreTicketUsageScript = `
+		if redis.call('EXISTS', KEYS[1]) == 0 then
+			return 0
+		end
+		redis.call('HINCRBY', KEYS[1], 'remainingUsages', 1)
+		return 1
+	`
+
+	// 记录一次票据校验失败，窗口内失败次数达到阈值时禁止该客户端使用票据
+	// 返回 {窗口内失败次数, 本次是否新加入禁止名单}，加入禁止名单后清空计数，解禁后重新计算
+	RecordTicketFailureScript = `
+		local failures = redis.call('INCR', KEYS[1])
+		if failures == 1 then
+			redis.call('PEXPIRE', KEYS[1], ARGV[1])
+		end
+		local blocked = 0
+		local threshold = tonumber(ARGV[2])
+		if threshold > 0 and failures >= threshold then
+			if redis.call('SET', KEYS[2], failures, 'NX', 'PX', ARGV[3]) then
+				blocked = 1
+				redis.call('DEL', KEYS[1])
+			end
+		end
+		return {failures, blocked}
+	`
+
+	// 把票据绑定到客户端，已绑定时保留原有配额，返回客户端在该票据上的剩余使用次数
+	// 配额作为票据哈希的字段保存，随票据一起过期；票据不存在时返回-1
+	BindTicketHolderScript = `
+		if redis.call('EXISTS', KEYS[1]) == 0 then
+			return -1
+		end
+		redis.call('HSETNX', KEYS[1], ARGV[1], ARGV[2])
+		return tonumber(redis.call('HGET', KEYS[1], ARGV[1]))
+	`
+
+	// 调整客户端在票据上的剩余使用次数，未绑定时返回-1，扣减后会小于0时返回-2
+	AddTicketHolderUsageScript = `
+		local remaining = tonumber(redis.call('HGET', KEYS[1], ARGV[1]))
+		if not remaining then
+			return -1
+		end
+		local delta = tonumber(ARGV[2])
+		if remaining + delta < 0 then
+			return -2
+		end
+		return redis.call('HINCRBY', KEYS[1], ARGV[1], delta)
+	`
+
+	// 实例在票据上的签发次数加1，计数作为票据哈希的字段保存，随票据一起过期
+	// 票据不存在时返回-1，已达到配额时不再增加并返回-2
+	AddTicketIssuedScript = `
+		if redis.call('EXISTS', KEYS[1]) == 0 then
+			return -1
+		end
+		local issued = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+		if issued >= tonumber(ARGV[2]) then
+			return -2
+		end
+		return redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+	`
+
+	// 排行榜存在时为每个用户加1票并记录更新时间，排行榜不存在时不写入，等待下次查询或对账时从数据库重建
+	IncrLeaderboardScript = `
+		if redis.call('EXISTS', KEYS[1]) == 0 then
+			return 0
+		end
+		for i = 2, #ARGV do
+			redis.call('ZINCRBY', KEYS[1], 1, ARGV[i])
+			redis.call('HSET', KEYS[2], ARGV[i], ARGV[1])
+		end
+		return 1
+	`
+
+	// 候选人集合存在时返回ARGV中未登记的名称，集合不存在时返回-1，由调用方从数据库加载
+	// 集合中始终有一个空字符串成员，没有登记任何候选人时也能与未缓存区分
+	GetUnregisteredCandidatesScript = `
+		if redis.call('EXISTS', KEYS[1]) == 0 then
+			return -1
+		end
+		local unregistered = {}
+		for i = 1, #ARGV do
+			if redis.call('SISMEMBER', KEYS[1], ARGV[i]) == 0 then
+				table.insert(unregistered, ARGV[i])
+			end
+		end
+		return unregistered
+	`
+
+	// 候选人集合存在时加入新登记的候选人，集合不存在时不写入，等待下次校验时从数据库加载
+	AddCandidateScript = `
+		if redis.call('EXISTS', KEYS[1]) == 0 then
+			return 0
+		end
+		return redis.call('SADD', KEYS[1], ARGV[1])
+	`
+
+	// 从令牌桶中取出ARGV[4]个令牌，令牌按每秒ARGV[1]个补充，最多ARGV[2]个，ARGV[3]为当前毫秒时间戳
+	// 令牌足够时返回0，否则不扣减并返回令牌补足所需的毫秒数；桶闲置到补满后过期
+	TakeRateLimitTokensScript = `
+		local rate = tonumber(ARGV[1])
+		local burst = tonumber(ARGV[2])
+		local now = tonumber(ARGV[3])
+		local cost = tonumber(ARGV[4])
+		local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+		local tokens = tonumber(bucket[1]) or burst
+		local ts = tonumber(bucket[2]) or now
+		if now > ts then
+			tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+			ts = now
+		end
+		local wait = 0
+		if tokens >= cost then
+			tokens = tokens - cost
+		else
+			wait = math.ceil((cost - tokens) * 1000 / rate)
+		end
+		redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+		redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+		return wait
+	`
 )
 
+// ErrTicketExpired 票据已超过过期时间（含时钟偏差容忍）
+var ErrTicketExpired = errors.New("TICKET_EXPIRED: 票据已过期")
+
+// ErrTicketExhausted 票据使用次数或投票活动的票据预算已耗尽
+var ErrTicketExhausted = errors.New("TICKET_EXHAUSTED: 票据使用次数已耗尽")
+
+// ErrTicketInvalid 票据不存在、票据值不匹配或不属于该投票活动，可能是在猜测票据值
+var ErrTicketInvalid = errors.New("TICKET_INVALID: 票据无效")
+
+// ErrTicketNotHolder 客户端绑定模式下，票据未绑定到提交投票的客户端
+var ErrTicketNotHolder = errors.New("TICKET_NOT_HOLDER: 票据未绑定到该客户端，请先获取票据")
+
+// ErrClientQuotaExhausted 客户端绑定模式下，客户端在该票据上的使用次数已用完
+var ErrClientQuotaExhausted = errors.New("CLIENT_QUOTA_EXHAUSTED: 该客户端在当前票据上的使用次数已用完")
+
+// ErrInstanceQuotaExhausted 本实例在当前票据上的签发次数已达到ticket.instance_issue_quota
+var ErrInstanceQuotaExhausted = errors.New("INSTANCE_QUOTA_EXHAUSTED: 本实例在当前票据上的签发次数已达上限，请稍后重试")
+
+// ErrPollClosed 投票活动已结束，不再签发和接受票据
+var ErrPollClosed = errors.New("POLL_CLOSED: 投票活动已结束")
+
 type RedisRepository struct {
 	client       *redis.Client
 	ctx          context.Context
 	scriptHashes map[string]string // 存储脚本SHA1哈希值
+	validated    *validatedTicketCache
+	ttls         atomic.Pointer[cacheTTLs] // 缓存有效期，配置热加载时替换
+	logger       *slog.Logger
 }
 
-func NewRedisRepository() (*RedisRepository, error) {
+func NewRedisRepository(logger *slog.Logger) (*RedisRepository, error) {
 	ctx := context.Background()
 
+	switch cacheStrategy() {
+	case CacheStrategyCacheAside, CacheStrategyWriteThrough:
+	default:
+		return nil, fmt.Errorf("不支持的缓存策略: %s", config.AppConfig.Cache.Strategy)
+	}
+
 	// 创建Redis客户端（普通客户端，用于数据存储）
 	client := redis.NewClient(&redis.Options{
 		Addr:         config.AppConfig.Redis.DataAddress,
@@ -71,7 +351,10 @@ func NewRedisRepository() (*RedisRepository, error) {
 		client:       client,
 		ctx:          ctx,
 		scriptHashes: make(map[string]string),
+		validated:    newValidatedTicketCache(),
+		logger:       logging.Component(logger, "redis"),
 	}
+	repo.ttls.Store(newCacheTTLs(config.AppConfig.Cache))
 
 	// 预加载Lua脚本
 	if err := repo.preloadScripts(); err != nil {
@@ -90,13 +373,143 @@ func (r *RedisRepository) preloadScripts() error {
 	}
 	r.scriptHashes["decrementTicketUsage"] = sha1
 
+	sha1, err = r.client.ScriptLoad(r.ctx, HoldTicketUsagesScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载票据使用次数占用脚本失败: %w", err)
+	}
+	r.scriptHashes["holdTicketUsages"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, ReleaseTicketUsageScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载释放票据使用次数占用脚本失败: %w", err)
+	}
+	r.scriptHashes["releaseTicketUsage"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, ReserveTicketBudgetScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载票据预算脚本失败: %w", err)
+	}
+	r.scriptHashes["reserveTicketBudget"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, SetNewestTicketVersionScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载票据版本脚本失败: %w", err)
+	}
+	r.scriptHashes["setNewestTicketVersion"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, TakeVoteReservationScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载投票预约脚本失败: %w", err)
+	}
+	r.scriptHashes["takeVoteReservation"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, RestoreTicketUsageScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载归还票据使用次数脚本失败: %w", err)
+	}
+	r.scriptHashes["restoreTicketUsage"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, RecordTicketFailureScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载票据校验失败计数脚本失败: %w", err)
+	}
+	r.scriptHashes["recordTicketFailure"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, BindTicketHolderScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载票据绑定脚本失败: %w", err)
+	}
+	r.scriptHashes["bindTicketHolder"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, AddTicketHolderUsageScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载客户端票据配额脚本失败: %w", err)
+	}
+	r.scriptHashes["addTicketHolderUsage"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, AddTicketIssuedScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载实例签发配额脚本失败: %w", err)
+	}
+	r.scriptHashes["addTicketIssued"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, IncrLeaderboardScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载排行榜脚本失败: %w", err)
+	}
+	r.scriptHashes["incrLeaderboard"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, GetUnregisteredCandidatesScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载候选人校验脚本失败: %w", err)
+	}
+	r.scriptHashes["getUnregisteredCandidates"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, AddCandidateScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载候选人登记脚本失败: %w", err)
+	}
+	r.scriptHashes["addCandidate"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, TakeRateLimitTokensScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载投票限流脚本失败: %w", err)
+	}
+	r.scriptHashes["takeRateLimitTokens"] = sha1
+
+	sha1, err = r.client.ScriptLoad(r.ctx, SetUserVoteIfNewerScript).Result()
+	if err != nil {
+		return fmt.Errorf("加载用户票数缓存脚本失败: %w", err)
+	}
+	r.scriptHashes["setUserVoteIfNewer"] = sha1
+
 	return nil
 }
 
-// GetUserVote 从缓存获取用户票数
-func (r *RedisRepository) GetUserVote(username string) (*model.UserVote, bool, error) {
-	key := UserVoteKey + username
-	data, err := r.client.Get(r.ctx, key).Result()
+// evalScript 执行预加载的Lua脚本，脚本缓存丢失时重新加载后重试
+func (r *RedisRepository) evalScript(name, script string, keys []string, args ...interface{}) (interface{}, error) {
+	sha1, ok := r.scriptHashes[name]
+	if !ok {
+		return nil, fmt.Errorf("脚本 %s 未预加载", name)
+	}
+
+	result, err := r.client.EvalSha(r.ctx, sha1, keys, args...).Result()
+	if err == nil || !strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		return result, err
+	}
+
+	sha1, err = r.client.ScriptLoad(r.ctx, script).Result()
+	if err != nil {
+		return nil, fmt.Errorf("重新加载脚本 %s 失败: %w", name, err)
+	}
+	r.scriptHashes[name] = sha1
+	return r.client.EvalSha(r.ctx, sha1, keys, args...).Result()
+}
+
+// ticketVersionKey 投票活动最新票据版本的键，默认活动沿用原有键名
+func ticketVersionKey(pollID string) string {
+	return pollScopedKey(TicketVersionKey, pollID)
+}
+
+// pollScopedKey 按投票活动区分的键，默认活动沿用原有键名
+func pollScopedKey(key, pollID string) string {
+	if pollID == "" || pollID == model.DefaultPollID {
+		return key
+	}
+	return key + ":" + pollID
+}
+
+// userVoteKey 投票活动中用户票数缓存的键，默认活动沿用原有键名
+func userVoteKey(pollID, username string) string {
+	if pollID == "" || pollID == model.DefaultPollID {
+		return UserVoteKey + username
+	}
+	return UserVoteKey + pollID + ":" + username
+}
+
+// GetUserVote 从缓存获取投票活动中用户的票数
+func (r *RedisRepository) GetUserVote(pollID, username string) (*model.UserVote, bool, error) {
+	data, err := r.client.Get(r.ctx, userVoteKey(pollID, username)).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, false, nil // 缓存未命中
@@ -114,32 +527,138 @@ func (r *RedisRepository) GetUserVote(username string) (*model.UserVote, bool, e
 
 // SetUserVote 设置用户票数缓存
 func (r *RedisRepository) SetUserVote(userVote *model.UserVote) error {
-	key := UserVoteKey + userVote.Username
 	data, err := json.Marshal(userVote)
 	if err != nil {
 		return fmt.Errorf("序列化用户票数失败: %w", err)
 	}
 
-	// 设置缓存，有效期1小时
-	if err := r.client.Set(r.ctx, key, data, time.Hour).Err(); err != nil {
+	// write_through策略下缓存由投票落库时从主库回写，查询回填的只读副本数据可能更旧，不能覆盖较新的票数
+	if CacheWriteThrough() {
+		return r.setUserVoteIfNewer(userVote)
+	}
+
+	// 设置缓存，有效期为cache.user_vote_ttl；同时保存一份不过期的最近已知票数，供数据库不可用时降级使用
+	pipe := r.client.Pipeline()
+	pipe.Set(r.ctx, userVoteKey(userVote.PollID, userVote.Username), data, r.userVoteCacheTTL())
+	pipe.HSet(r.ctx, pollScopedKey(UserVoteLastKey, userVote.PollID), userVote.Username, data)
+	if _, err := pipe.Exec(r.ctx); err != nil {
 		return fmt.Errorf("设置用户票数缓存失败: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteUserVoteCache 删除用户票数缓存
-func (r *RedisRepository) DeleteUserVoteCache(username string) error {
-	key := UserVoteKey + username
-	if err := r.client.Del(r.ctx, key).Err(); err != nil {
+// SaveLastKnownUserVotes 保存从数据库读取到的投票活动用户票数，作为最近已知票数
+func (r *RedisRepository) SaveLastKnownUserVotes(pollID string, userVotes []*model.UserVote) error {
+	if len(userVotes) == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{}, len(userVotes))
+	for _, userVote := range userVotes {
+		data, err := json.Marshal(userVote)
+		if err != nil {
+			return fmt.Errorf("序列化用户票数失败: %w", err)
+		}
+		values[userVote.Username] = data
+	}
+
+	if err := r.client.HSet(r.ctx, pollScopedKey(UserVoteLastKey, pollID), values).Err(); err != nil {
+		return fmt.Errorf("保存最近已知票数失败: %w", err)
+	}
+	return nil
+}
+
+// GetLastKnownUserVote 获取投票活动中用户的最近已知票数，不存在时返回false
+func (r *RedisRepository) GetLastKnownUserVote(pollID, username string) (*model.UserVote, bool, error) {
+	data, err := r.client.HGet(r.ctx, pollScopedKey(UserVoteLastKey, pollID), username).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("获取最近已知票数失败: %w", err)
+	}
+
+	var userVote model.UserVote
+	if err := json.Unmarshal([]byte(data), &userVote); err != nil {
+		return nil, false, fmt.Errorf("解析最近已知票数失败: %w", err)
+	}
+	return &userVote, true, nil
+}
+
+// GetAllLastKnownUserVotes 获取投票活动所有用户的最近已知票数，按用户名排序
+func (r *RedisRepository) GetAllLastKnownUserVotes(pollID string) ([]*model.UserVote, error) {
+	data, err := r.client.HGetAll(r.ctx, pollScopedKey(UserVoteLastKey, pollID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取最近已知票数失败: %w", err)
+	}
+
+	userVotes := make([]*model.UserVote, 0, len(data))
+	for _, value := range data {
+		var userVote model.UserVote
+		if err := json.Unmarshal([]byte(value), &userVote); err != nil {
+			return nil, fmt.Errorf("解析最近已知票数失败: %w", err)
+		}
+		userVotes = append(userVotes, &userVote)
+	}
+	sort.Slice(userVotes, func(i, j int) bool {
+		return userVotes[i].Username < userVotes[j].Username
+	})
+	return userVotes, nil
+}
+
+// GetAllUserVotesCache 获取投票活动所有用户票数的聚合缓存
+func (r *RedisRepository) GetAllUserVotesCache(pollID string) ([]*model.UserVote, bool, error) {
+	data, err := r.client.Get(r.ctx, pollScopedKey(UserVoteAllKey, pollID)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil // 缓存未命中
+		}
+		return nil, false, fmt.Errorf("获取所有用户票数缓存失败: %w", err)
+	}
+
+	var userVotes []*model.UserVote
+	if err := json.Unmarshal([]byte(data), &userVotes); err != nil {
+		return nil, false, fmt.Errorf("解析所有用户票数缓存失败: %w", err)
+	}
+	return userVotes, true, nil
+}
+
+// SetAllUserVotesCache 设置投票活动所有用户票数的聚合缓存
+func (r *RedisRepository) SetAllUserVotesCache(pollID string, userVotes []*model.UserVote, ttl time.Duration) error {
+	data, err := json.Marshal(userVotes)
+	if err != nil {
+		return fmt.Errorf("序列化所有用户票数失败: %w", err)
+	}
+
+	if err := r.client.Set(r.ctx, pollScopedKey(UserVoteAllKey, pollID), data, ttl).Err(); err != nil {
+		return fmt.Errorf("设置所有用户票数缓存失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserVoteCache 删除用户票数缓存，同时使该投票活动所有用户票数的聚合缓存失效
+func (r *RedisRepository) DeleteUserVoteCache(pollID, username string) error {
+	if err := r.client.Del(r.ctx, userVoteKey(pollID, username), pollScopedKey(UserVoteAllKey, pollID)).Err(); err != nil {
 		return fmt.Errorf("删除用户票数缓存失败: %w", err)
 	}
+	r.publishInvalidation(&CacheInvalidation{Kind: InvalidateUserVote, PollID: pollID, Usernames: []string{username}})
 	return nil
 }
 
-// GetNewestTicketVersion 获取最新票据版本
-func (r *RedisRepository) GetNewestTicketVersion() (string, error) {
-	version, err := r.client.Get(r.ctx, TicketVersionKey).Result()
+// InvalidateAdjustedUserVote 管理员调整票数后删除用户票数缓存和聚合缓存，并广播票数调整通知
+// 调整可能减少票数，不能像计票那样回写缓存，否则SetUserVoteIfNewerScript会保留调整前较高的票数
+func (r *RedisRepository) InvalidateAdjustedUserVote(pollID, username string) error {
+	if err := r.client.Del(r.ctx, userVoteKey(pollID, username), pollScopedKey(UserVoteAllKey, pollID)).Err(); err != nil {
+		return fmt.Errorf("删除用户票数缓存失败: %w", err)
+	}
+	r.publishInvalidation(&CacheInvalidation{Kind: InvalidateVoteAdjustment, PollID: pollID, Usernames: []string{username}})
+	return nil
+}
+
+// GetNewestTicketVersion 获取投票活动的最新票据版本
+func (r *RedisRepository) GetNewestTicketVersion(pollID string) (string, error) {
+	version, err := r.client.Get(r.ctx, ticketVersionKey(pollID)).Result()
 	if err != nil {
 		if err == redis.Nil {
 			return "", nil // 版本不存在
@@ -149,11 +668,149 @@ func (r *RedisRepository) GetNewestTicketVersion() (string, error) {
 	return version, nil
 }
 
-// SetNewestTicketVersion 设置最新票据版本
-func (r *RedisRepository) SetNewestTicketVersion(version string) error {
-	if err := r.client.Set(r.ctx, TicketVersionKey, version, 0).Err(); err != nil {
+// SetNewestTicketVersion 设置投票活动的最新票据版本，活动已结束时返回ErrPollClosed
+func (r *RedisRepository) SetNewestTicketVersion(pollID, version string) error {
+	keys := []string{ticketVersionKey(pollID), pollScopedKey(TicketPreviousVersionKey, pollID),
+		pollScopedKey(TicketPendingVersionKey, pollID)}
+	result, err := r.evalScript("setNewestTicketVersion", SetNewestTicketVersionScript,
+		keys, version, PollClosedVersion, ticketOverlapGrace().Milliseconds())
+	if err != nil {
 		return fmt.Errorf("设置最新票据版本失败: %w", err)
 	}
+	r.publishInvalidation(&CacheInvalidation{Kind: InvalidateTicketVersion, PollID: pollID})
+	if updated, _ := result.(int64); updated == 0 {
+		return ErrPollClosed
+	}
+	return nil
+}
+
+// ClosePoll 结束投票活动，此后该活动的票据全部失效且不再生成新票据
+func (r *RedisRepository) ClosePoll(pollID string) error {
+	if err := r.client.Set(r.ctx, ticketVersionKey(pollID), PollClosedVersion, 0).Err(); err != nil {
+		return fmt.Errorf("结束投票活动失败: %w", err)
+	}
+	r.publishInvalidation(&CacheInvalidation{Kind: InvalidateTicketVersion, PollID: pollID})
+	return nil
+}
+
+// ReserveTicketBudget 从投票活动的总预算中申请usages次票据使用次数，返回实际批准的次数，预算用完时返回0
+func (r *RedisRepository) ReserveTicketBudget(pollID string, usages, budget int) (int, error) {
+	result, err := r.evalScript("reserveTicketBudget", ReserveTicketBudgetScript,
+		[]string{TicketBudgetKey + pollID}, usages, budget)
+	if err != nil {
+		return 0, fmt.Errorf("执行票据预算脚本失败: %w", err)
+	}
+
+	granted, ok := result.(int64)
+	if !ok {
+		return 0, fmt.Errorf("LUA脚本返回类型错误")
+	}
+	return int(granted), nil
+}
+
+// GetTicketBudgetUsed 获取投票活动已发放的票据使用次数
+func (r *RedisRepository) GetTicketBudgetUsed(pollID string) (int, error) {
+	used, err := r.client.Get(r.ctx, TicketBudgetKey+pollID).Int()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("获取票据预算使用量失败: %w", err)
+	}
+	return used, nil
+}
+
+// ClaimVoteRequest 在ttl内占用投票请求，返回false表示相同请求已在处理或已处理
+// key为完整的Redis键：重复请求抑制使用VoteDedupKey前缀，幂等键使用VoteIdemKey前缀
+func (r *RedisRepository) ClaimVoteRequest(key string, ttl time.Duration) (bool, error) {
+	claimed, err := r.client.SetNX(r.ctx, key, "", ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("占用投票请求失败: %w", err)
+	}
+	return claimed, nil
+}
+
+// GetVoteResponse 获取首次请求的投票结果，found为false表示请求已被释放，response为nil表示仍在处理中
+func (r *RedisRepository) GetVoteResponse(key string) (response *model.VoteResponse, found bool, err error) {
+	data, err := r.client.Get(r.ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("获取投票结果失败: %w", err)
+	}
+	if data == "" {
+		return nil, true, nil
+	}
+
+	var voteResponse model.VoteResponse
+	if err := json.Unmarshal([]byte(data), &voteResponse); err != nil {
+		return nil, false, fmt.Errorf("解析投票结果失败: %w", err)
+	}
+	return &voteResponse, true, nil
+}
+
+// SaveVoteResponse 保存首次请求的投票结果，ttl内的重复请求直接返回该结果
+func (r *RedisRepository) SaveVoteResponse(key string, response *model.VoteResponse, ttl time.Duration) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("序列化投票结果失败: %w", err)
+	}
+	if err := r.client.Set(r.ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("保存投票结果失败: %w", err)
+	}
+	return nil
+}
+
+// ReleaseVoteRequest 释放投票请求，首次请求失败时允许客户端立即重试
+func (r *RedisRepository) ReleaseVoteRequest(key string) error {
+	if err := r.client.Del(r.ctx, key).Err(); err != nil {
+		return fmt.Errorf("释放投票请求失败: %w", err)
+	}
+	return nil
+}
+
+// GetProducerInfo 获取当前票据生产者信息，不存在时返回nil
+func (r *RedisRepository) GetProducerInfo() (*model.ProducerInfo, error) {
+	data, err := r.client.Get(r.ctx, ProducerInfoKey).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取票据生产者信息失败: %w", err)
+	}
+
+	var info model.ProducerInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return nil, fmt.Errorf("解析票据生产者信息失败: %w", err)
+	}
+	return &info, nil
+}
+
+// SetProducerInfo 设置当前票据生产者信息，生产者需在ttl内续期
+func (r *RedisRepository) SetProducerInfo(info *model.ProducerInfo, ttl time.Duration) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("序列化票据生产者信息失败: %w", err)
+	}
+	if err := r.client.Set(r.ctx, ProducerInfoKey, data, ttl).Err(); err != nil {
+		return fmt.Errorf("设置票据生产者信息失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteProducerInfo 当生产者信息属于指定实例时将其删除
+func (r *RedisRepository) DeleteProducerInfo(instanceID int) error {
+	info, err := r.GetProducerInfo()
+	if err != nil {
+		return err
+	}
+	if info == nil || info.InstanceID != instanceID {
+		return nil
+	}
+	if err := r.client.Del(r.ctx, ProducerInfoKey).Err(); err != nil {
+		return fmt.Errorf("删除票据生产者信息失败: %w", err)
+	}
 	return nil
 }
 
@@ -166,15 +823,24 @@ func (r *RedisRepository) GetTicket(version string) (*model.Ticket, error) {
 		return nil, fmt.Errorf("获取票据失败: %w", err)
 	}
 
+	return parseTicket(version, data)
+}
+
+// parseTicket 将票据哈希解析为票据
+func parseTicket(version string, data map[string]string) (*model.Ticket, error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("票据不存在")
 	}
 
 	// 解析票据数据
 	ticket := &model.Ticket{
+		PollID:  data["pollId"],
 		Version: version,
 		Value:   data["value"],
 	}
+	if ticket.PollID == "" {
+		ticket.PollID = model.DefaultPollID
+	}
 
 	// 解析剩余使用次数
 	if data["remainingUsages"] != "" {
@@ -203,28 +869,41 @@ func (r *RedisRepository) GetTicket(version string) (*model.Ticket, error) {
 		ticket.CreatedAt = createdAt
 	}
 
+	// 解析防护令牌，升级前写入的票据没有该字段
+	if data["fencingToken"] != "" {
+		if _, err := fmt.Sscanf(data["fencingToken"], "%d", &ticket.FencingToken); err != nil {
+			return nil, fmt.Errorf("解析票据防护令牌失败: %w", err)
+		}
+	}
+
+	// 解析签发时的最大使用次数，升级前写入的票据没有该字段
+	if data["maxUsages"] != "" {
+		if _, err := fmt.Sscanf(data["maxUsages"], "%d", &ticket.MaxUsages); err != nil {
+			return nil, fmt.Errorf("解析票据最大使用次数失败: %w", err)
+		}
+	}
+
 	return ticket, nil
 }
 
 // CreateTicket 创建新票据
 func (r *RedisRepository) CreateTicket(ticket *model.Ticket) error {
 	key := TicketKey + ticket.Version
-	fmt.Println("CreateTicket key:", key)
 	// 准备票据数据
 	data := map[string]interface{}{
+		"pollId":          ticket.PollID,
 		"value":           ticket.Value,
 		"remainingUsages": ticket.RemainingUsages,
-		"expiresAt":       ticket.ExpiresAt.Format(time.RFC3339),
-		"createdAt":       ticket.CreatedAt.Format(time.RFC3339),
+		"expiresAt":       ticket.ExpiresAt.Format(time.RFC3339Nano),
+		"createdAt":       ticket.CreatedAt.Format(time.RFC3339Nano),
+		"fencingToken":    ticket.FencingToken,
+		"maxUsages":       ticket.MaxUsages,
 	}
 
-	// Redis 过期时间设置为10s
-	expires := time.Second * 10
-
-	// 设置票据，并设置过期时间
+	// 设置票据，Redis中的保留时长为cache.ticket_ttl
 	pipe := r.client.Pipeline()
 	pipe.HMSet(r.ctx, key, data)
-	pipe.Expire(r.ctx, key, expires)
+	pipe.Expire(r.ctx, key, r.ticketCacheTTL())
 	_, err := pipe.Exec(r.ctx)
 	if err != nil {
 		return fmt.Errorf("创建票据失败: %w", err)
@@ -242,6 +921,11 @@ func (r *RedisRepository) UpdateTicketRemainingUsages(version string, remainingU
 	return nil
 }
 
+// Ping 检查数据Redis是否可用
+func (r *RedisRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 // Close 关闭Redis连接
 func (r *RedisRepository) Close() error {
 	return r.client.Close()
@@ -249,65 +933,106 @@ func (r *RedisRepository) Close() error {
 
 // ValidateTicket 校验票据有效性
 func (r *RedisRepository) ValidateTicket(ticket *model.Ticket) (bool, error) {
-	// 获取最新版本
-	newestVersion, err := r.GetNewestTicketVersion()
-	if err != nil {
-		return false, fmt.Errorf("获取最新票据版本失败: %w", err)
+	pollID := ticket.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+
+	// 该票据此前已校验通过且仍在有效期内，只需确认它仍是最新版本或重叠窗口内的上一个版本
+	if cached, ok := r.validated.load(ticket.Version, ticket.Value); ok && cached.pollID == pollID {
+		newestVersion, err := r.GetNewestTicketVersion(pollID)
+		if err != nil {
+			return false, fmt.Errorf("获取最新票据版本失败: %w", err)
+		}
+		if _, err := r.checkTicketVersion(pollID, ticket.Version, newestVersion); err != nil {
+			return false, err
+		}
+		if err := checkTicketUsages(ticket, cached.maxUsages); err != nil {
+			return false, err
+		}
+		return true, nil
 	}
 
-	// 检查版本是否一致
-	if ticket.Version != newestVersion {
-		return false, fmt.Errorf("票据版本已过期，当前: %s, 最新: %s", ticket.Version, newestVersion)
+	// 最新版本与票据哈希在同一次往返中读取
+	pipe := r.client.Pipeline()
+	versionCmd := pipe.Get(r.ctx, ticketVersionKey(pollID))
+	ticketCmd := pipe.HGetAll(r.ctx, TicketKey+ticket.Version)
+	if _, err := pipe.Exec(r.ctx); err != nil && err != redis.Nil {
+		return false, fmt.Errorf("获取票据失败: %w", err)
+	}
+
+	newestVersion, err := versionCmd.Result()
+	if err != nil && err != redis.Nil {
+		return false, fmt.Errorf("获取最新票据版本失败: %w", err)
+	}
+	previous, err := r.checkTicketVersion(pollID, ticket.Version, newestVersion)
+	if err != nil {
+		return false, err
 	}
 
 	// 获取票据
-	storedTicket, err := r.GetTicket(ticket.Version)
+	storedTicket, err := parseTicket(ticket.Version, ticketCmd.Val())
 	if err != nil {
-		return false, fmt.Errorf("获取票据失败: %w", err)
+		return false, fmt.Errorf("%w: %v", ErrTicketInvalid, err)
 	}
 
 	// 检查票据值是否一致
 	if ticket.Value != storedTicket.Value {
-		return false, fmt.Errorf("票据值不匹配")
+		return false, fmt.Errorf("%w: 票据值不匹配", ErrTicketInvalid)
+	}
+
+	// 票据只能用于签发它的投票活动
+	if storedTicket.PollID != pollID {
+		return false, fmt.Errorf("%w: 票据不属于投票活动 %s", ErrTicketInvalid, pollID)
+	}
+
+	if err := checkTicketUsages(ticket, storedTicket.MaxUsages); err != nil {
+		return false, err
+	}
+
+	// 以服务端存储的过期时间为准，允许一定的时钟偏差；上一个版本在重叠窗口内仍可使用
+	deadline := storedTicket.ExpiresAt.Add(config.AppConfig.Ticket.ClockSkew)
+	if previous {
+		deadline = deadline.Add(ticketOverlapGrace())
+	}
+	if !storedTicket.ExpiresAt.IsZero() && time.Now().After(deadline) {
+		return false, fmt.Errorf("%w, 过期时间: %s", ErrTicketExpired, storedTicket.ExpiresAt.Format(time.RFC3339))
+	}
+
+	if !storedTicket.ExpiresAt.IsZero() {
+		r.validated.store(ticket.Version, ticket.Value, storedTicket.PollID, storedTicket.MaxUsages, deadline)
 	}
 
 	return true, nil
 }
 
+// checkTicketUsages 客户端提交的剩余使用次数不能超过票据签发时的最大使用次数，maxUsages为0（升级前签发的票据）时不检查
+// 以票据自身记录的上限为准，调低ticket.max_usage_count不会拒绝此前签发的票据
+func checkTicketUsages(ticket *model.Ticket, maxUsages int) error {
+	if maxUsages > 0 && ticket.RemainingUsages > maxUsages {
+		return fmt.Errorf("%w: 剩余使用次数超过票据的最大使用次数%d", ErrTicketInvalid, maxUsages)
+	}
+	return nil
+}
+
+// checkNewestVersion 校验票据版本仍是投票活动的最新版本
+func checkNewestVersion(version, newestVersion string) error {
+	if newestVersion == PollClosedVersion {
+		return ErrPollClosed
+	}
+	if version != newestVersion {
+		return fmt.Errorf("%w, 票据版本已轮换，当前: %s, 最新: %s", ErrTicketExpired, version, newestVersion)
+	}
+	return nil
+}
+
 // DecrementTicketUsage 使用预加载的Lua脚本减少票据的使用次数，保证原子性
 func (r *RedisRepository) DecrementTicketUsage(version string) (int, error) {
 	key := TicketKey + version
 
-	// 获取预加载脚本的SHA1哈希值
-	sha1, ok := r.scriptHashes["decrementTicketUsage"]
-	if !ok {
-		return 0, fmt.Errorf("脚本未预加载")
-	}
-
-	// 使用EVALSHA执行脚本
-	var result interface{}
-	var err error
-
-	// 尝试使用EVALSHA执行
-	result, err = r.client.EvalSha(r.ctx, sha1, []string{key, TicketVersionKey}, version).Result()
-	if err != nil {
-		// 如果脚本不存在，重新加载并再次尝试
-		if err.Error() == "NOSCRIPT No matching script. Please use EVAL." {
-			// 重新加载脚本
-			sha1, err = r.client.ScriptLoad(r.ctx, DecrementTicketUsageScript).Result()
-			if err != nil {
-				return 0, fmt.Errorf("重新加载票据使用次数脚本失败: %w", err)
-			}
-			r.scriptHashes["decrementTicketUsage"] = sha1
-
-			// 再次尝试执行
-			result, err = r.client.EvalSha(r.ctx, sha1, []string{key, TicketVersionKey}, version).Result()
-			if err != nil {
-				return 0, fmt.Errorf("执行票据使用次数脚本失败: %w", err)
-			}
-		} else {
-			return 0, fmt.Errorf("执行票据使用次数脚本失败: %w", err)
-		}
+	result, err := r.evalScript("decrementTicketUsage", DecrementTicketUsageScript, []string{key, TicketVersionKey}, version)
+	if err != nil {
+		return 0, fmt.Errorf("执行票据使用次数脚本失败: %w", err)
 	}
 
 	// 解析结果
@@ -328,6 +1053,9 @@ func (r *RedisRepository) DecrementTicketUsage(version string) (int, error) {
 	}
 
 	// 如果状态码不为0，表示出错
+	if status == -2 {
+		return 0, ErrTicketExhausted
+	}
 	if status != 0 {
 		errorMsg, _ := resultSlice[1].(string)
 		return 0, fmt.Errorf("%s", errorMsg)
@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/migrations"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// VoteRepository 投票数据的持久化存储，由MySQLRepository和PostgresRepository实现
+// VoteService只依赖该接口，单元测试可以替换为模拟实现，也可以接入其他存储
+type VoteRepository interface {
+	// 投票写入：发件箱、计票、事件溯源模式下的投票日志
+	EnqueueVoteEvent(event *model.VoteEvent, consumeTicket bool) error
+	IncrementVotes(event *model.VoteEvent) (int, error)
+	AppendVoteLogs(event *model.VoteEvent) (int, error)
+	// 批量消费模式下在一个事务中写入一批事件，返回每个事件实际生效的票数
+	IncrementVotesBatch(events []*model.VoteEvent) ([]int, error)
+	AppendVoteLogsBatch(events []*model.VoteEvent) ([]int, error)
+	GetVoteIdempotencyKey(key string) (*model.VoteIdempotencyRecord, error)
+
+	// 投票活动
+	CreatePoll(poll *model.Poll) error
+	GetPoll(pollID string) (*model.Poll, error)
+	SetPollShadow(pollID string, shadow bool) error
+
+	// 登记的候选人，CreateCandidate在候选人已登记时返回ErrCandidateExists
+	CreateCandidate(candidate *model.Candidate) error
+	ListCandidates() ([]*model.Candidate, error)
+
+	// 票数和投票日志查询，pollID为空时GetAllUserVotes返回所有投票活动的票数
+	GetUserVote(pollID, username string) (*model.UserVote, error)
+	GetAllUserVotes(pollID string) ([]*model.UserVote, error)
+	GetUserVotesFromMaster(pollID string, usernames []string) ([]*model.UserVote, error)
+	GetVoteLog(id int64) (*model.VoteLog, error)
+	GetVoteLogsByEventID(eventID string) ([]*model.VoteLog, error)
+	GetVoteLogsAfter(pollID string, afterID int64, limit int) ([]*model.VoteLog, error)
+	QueryVoteLogs(filter *model.VoteLogFilter) ([]*model.VoteLog, error)
+	GetReplicaLatestVoteLogID(pollID string) (int64, error)
+	GetResultsVersion(pollID string) (int64, error)
+	GetVoteProjectionProgress() (int64, error)
+
+	// SetUserVotes 管理员直接设置用户票数，同时记录审计
+	SetUserVotes(action *model.AdminAction) error
+
+	// 投票活动结果和排名快照
+	CountPollVotes(pollID string) ([]*model.UserVote, error)
+	ReconcileUserVotes() (int64, error)
+	SavePollResults(pollResults *model.PollResults) error
+	GetPollResults(pollID string) (*model.PollResults, error)
+	GetResultSnapshots(since, until time.Time, limit int) ([]*model.ResultSnapshot, error)
+
+	// Ping 检查存储是否可用
+	Ping() error
+}
+
+// TicketRepository 票据的持久化存储，由MySQLRepository和PostgresRepository实现，TicketService只依赖该接口
+type TicketRepository interface {
+	SaveTicket(ticket *model.Ticket) error
+	GetTicket(version string) (*model.Ticket, error)
+	GetNewestTicketVersion(pollID string) (string, error)
+	// SaveTicketHistory 签发票据时记录历史，保留到cleanup.history_retention
+	SaveTicketHistory(ticketHistory *model.TicketHistory) error
+
+	// 票据利用率统计
+	SaveTicketStats(ticket *model.Ticket) error
+	RecordTicketConsumption(version string, remaining int, rotatedAt time.Time) error
+	GetTicketStats(pollID string, limit int) ([]*model.TicketStats, error)
+
+	// ListFinalizedPollIDs 已定稿的投票活动不再签发票据
+	ListFinalizedPollIDs() ([]string, error)
+	// ListPolls 各实例据此为新创建的投票活动签发票据
+	ListPolls() ([]*model.Poll, error)
+}
+
+// CacheRepository 票据、票数、投票去重和统计的缓存，由RedisRepository实现
+// 票据使用次数的扣减、预算和预约也在缓存中原子完成，实现方需要保证这些操作的原子性
+type CacheRepository interface {
+	// 票据
+	CreateTicket(ticket *model.Ticket) error
+	GetTicket(version string) (*model.Ticket, error)
+	ValidateTicket(ticket *model.Ticket) (bool, error)
+	DecrementTicketUsage(version string) (int, error)
+	HoldTicketUsage(hold *TicketHold, ttl time.Duration) (int, error)
+	HoldTicketUsages(holds []*TicketHold, ttl time.Duration) ([]int, []error, error)
+	ConfirmTicketUsage(holdID string) (bool, error)
+	ReleaseTicketUsage(holdID string) (bool, error)
+	RestoreTicketUsage(version string) (bool, error)
+	GetNewestTicketVersion(pollID string) (string, error)
+	SetNewestTicketVersion(pollID, version string) error
+	GetPendingTicketVersion(pollID string) (string, error)
+	SetPendingTicketVersion(pollID, version string) error
+	ReserveTicketBudget(pollID string, usages, budget int) (int, error)
+	GetTicketBudgetUsed(pollID string) (int, error)
+	ClosePoll(pollID string) error
+
+	// 票据校验失败计数和禁止名单
+	RecordTicketFailure(subject string, window time.Duration, threshold int, blockFor time.Duration) (failures int, blocked bool, err error)
+	GetTicketBlockTTL(subjects ...string) (time.Duration, error)
+
+	// 客户端绑定模式下客户端在票据上的配额
+	BindTicketHolder(version, holder string, quota int) (int, error)
+	AddTicketHolderUsage(version, holder string, delta int) (int, error)
+
+	// 实例在票据上的签发次数
+	AddTicketIssued(version string, instanceID, quota int) (int, error)
+
+	// 按票数排序的排行榜，按投票活动区分
+	IncrLeaderboard(pollID string, usernames []string) error
+	GetLeaderboard(pollID string, limit int) ([]*model.UserVote, bool, error)
+	ReplaceLeaderboard(pollID string, userVotes []*model.UserVote) error
+
+	// 按客户端IP的投票限流
+	TakeRateLimitTokens(subject string, rate float64, burst, cost int) (time.Duration, error)
+
+	// 票据生产者
+	GetProducerInfo() (*model.ProducerInfo, error)
+	SetProducerInfo(info *model.ProducerInfo, ttl time.Duration) error
+	DeleteProducerInfo(instanceID int) error
+
+	// 登记的候选人集合，集合未缓存时found为false
+	GetUnregisteredCandidates(names []string) (unregistered []string, found bool, err error)
+	SetCandidates(names []string, ttl time.Duration) error
+	AddCandidate(name string) error
+
+	// 用户票数缓存，按投票活动区分
+	GetUserVote(pollID, username string) (*model.UserVote, bool, error)
+	SetUserVote(userVote *model.UserVote) error
+	DeleteUserVoteCache(pollID, username string) error
+	InvalidateAdjustedUserVote(pollID, username string) error
+	WriteThroughUserVotes(pollID string, userVotes []*model.UserVote) error
+	GetAllUserVotesCache(pollID string) ([]*model.UserVote, bool, error)
+	SetAllUserVotesCache(pollID string, userVotes []*model.UserVote, ttl time.Duration) error
+	GetLastKnownUserVote(pollID, username string) (*model.UserVote, bool, error)
+	GetAllLastKnownUserVotes(pollID string) ([]*model.UserVote, error)
+	SaveLastKnownUserVotes(pollID string, userVotes []*model.UserVote) error
+
+	// 投票去重和幂等
+	ClaimVoteRequest(key string, ttl time.Duration) (bool, error)
+	GetVoteResponse(key string) (response *model.VoteResponse, found bool, err error)
+	SaveVoteResponse(key string, response *model.VoteResponse, ttl time.Duration) error
+	ReleaseVoteRequest(key string) error
+
+	// 两阶段投票的预约
+	SaveVoteReservation(reservation *model.VoteReservation) error
+	ConfirmVoteReservation(token string) (*model.VoteReservation, error)
+
+	// 投票活动统计
+	RecordPollVotes(pollID string, votes int, voter string, votedAt time.Time, ticketUsed bool) error
+	RecordVoteRejection(pollID, reasonCode string) error
+	RecordTicketsIssued(pollID string, usages int) error
+	GetPollStats(pollID string) (*model.PollStats, error)
+}
+
+// Storage 持久化存储的完整方法集，由storage.driver选择MySQLRepository或PostgresRepository
+// 除服务层使用的VoteRepository和TicketRepository外，还包括发件箱、投影、快照和清理任务使用的方法
+type Storage interface {
+	VoteRepository
+	TicketRepository
+
+	// 发件箱中继
+	DrainOutbox(batchSize int, publish func([]*model.VoteEvent) error) (int, error)
+	GetOutboxStats() (*model.OutboxStats, error)
+
+	// GetConsumerOffsets 计票消费者各分区已落库的最大偏移量，消费者启动时从其后继续读取
+	GetConsumerOffsets(topic string) (map[int]int64, error)
+
+	// 事件溯源模式的投影
+	ApplyVoteProjection(batchSize int, settleDelay time.Duration) (*ProjectionBatch, error)
+	RebuildVoteProjection() (int64, error)
+
+	// API密钥，GetAPIKeyByHash在密钥不存在时返回nil
+	CreateAPIKey(key *model.APIKey) error
+	GetAPIKeyByHash(hash string) (*model.APIKey, error)
+	RevokeAPIKey(id int64) (*model.APIKey, error)
+
+	// DeleteVoteLogsByEventID 删除一次投票的投票日志，只用于清理selfcheck写入的探测投票
+	DeleteVoteLogsByEventID(eventID string) (int64, error)
+
+	// 排名快照
+	SaveResultSnapshot(snapshot *model.ResultSnapshot) error
+
+	// 过期数据清理，每次删除一批并返回删除的行数
+	PurgeExpiredTickets(before time.Time, batchSize int, archive bool) (int64, error)
+	PurgeTicketHistory(before time.Time, batchSize int) (int64, error)
+	PurgeTicketStats(before time.Time, batchSize int) (int64, error)
+	PurgeVoteIdempotencyKeys(before time.Time, batchSize int) (int64, error)
+
+	Close()
+}
+
+// 存储驱动
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+)
+
+// NewStorage 按storage.driver创建持久化存储
+func NewStorage(logger *slog.Logger) (Storage, error) {
+	// 创建失败时返回nil接口，而不是包含nil指针的接口
+	switch driver := config.AppConfig.Storage.Driver; driver {
+	case "", DriverMySQL:
+		repo, err := NewMySQLRepository(logger)
+		if err != nil {
+			return nil, err
+		}
+		return repo, nil
+	case DriverPostgres:
+		repo, err := NewPostgresRepository(logger)
+		if err != nil {
+			return nil, err
+		}
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("不支持的存储驱动: %s", driver)
+	}
+}
+
+// OpenMigrator 按storage.driver连接主库并创建迁移执行器，用于migrate子命令；返回的函数关闭数据库连接
+// 与NewStorage不同，不会在连接后自动执行迁移
+func OpenMigrator(logger *slog.Logger) (*migrations.Migrator, func() error, error) {
+	driver, dsn := DriverMySQL, config.AppConfig.MySQL.Master
+	switch config.AppConfig.Storage.Driver {
+	case "", DriverMySQL:
+	case DriverPostgres:
+		driver, dsn = DriverPostgres, config.AppConfig.Postgres.Master
+	default:
+		return nil, nil, fmt.Errorf("不支持的存储驱动: %s", config.AppConfig.Storage.Driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("连接主数据库失败: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("主数据库连接测试失败: %w", err)
+	}
+	migrator, err := migrations.New(db, driver, logger)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return migrator, db.Close, nil
+}
+
+// migrate 启动时执行尚未执行的内置迁移脚本，多个实例同时启动时依次执行
+func migrate(db *sql.DB, driver string, logger *slog.Logger) error {
+	migrator, err := migrations.New(db, driver, logger)
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		return fmt.Errorf("执行数据库迁移失败: %w", err)
+	}
+	return nil
+}
+
+// 编译期检查具体实现满足接口
+var (
+	_ Storage         = (*MySQLRepository)(nil)
+	_ Storage         = (*PostgresRepository)(nil)
+	_ CacheRepository = (*RedisRepository)(nil)
+)
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// reservationRetention 预约数据在过期时间之后的保留时长，释放任务短暂不可用时仍能找到预约归还票据使用次数
+const reservationRetention = 10 * time.Minute
+
+// SaveVoteReservation 保存投票预约，并按过期时间登记到待释放集合
+func (r *RedisRepository) SaveVoteReservation(reservation *model.VoteReservation) error {
+	data, err := json.Marshal(reservation)
+	if err != nil {
+		return fmt.Errorf("序列化投票预约失败: %w", err)
+	}
+
+	ttl := time.Until(reservation.ExpiresAt) + reservationRetention
+	_, err = r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(r.ctx, VoteReservationKey+reservation.Token, data, ttl)
+		pipe.ZAdd(r.ctx, VoteReservationExpiryKey, &redis.Z{
+			Score:  float64(reservation.ExpiresAt.UnixMilli()),
+			Member: reservation.Token,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("保存投票预约失败: %w", err)
+	}
+	return nil
+}
+
+// ConfirmVoteReservation 取出未过期的投票预约用于确认，预约不存在、已确认或已过期时返回nil
+func (r *RedisRepository) ConfirmVoteReservation(token string) (*model.VoteReservation, error) {
+	return r.takeVoteReservation(token, "confirm")
+}
+
+// ExpireVoteReservation 取出已过期的投票预约用于释放，已被确认或其他实例释放时返回nil
+func (r *RedisRepository) ExpireVoteReservation(token string) (*model.VoteReservation, error) {
+	return r.takeVoteReservation(token, "expire")
+}
+
+func (r *RedisRepository) takeVoteReservation(token, mode string) (*model.VoteReservation, error) {
+	result, err := r.evalScript("takeVoteReservation", TakeVoteReservationScript,
+		[]string{VoteReservationKey + token, VoteReservationExpiryKey},
+		token, time.Now().UnixMilli(), mode)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("取出投票预约失败: %w", err)
+	}
+
+	data, _ := result.(string)
+	if data == "" {
+		return nil, nil
+	}
+
+	var reservation model.VoteReservation
+	if err := json.Unmarshal([]byte(data), &reservation); err != nil {
+		return nil, fmt.Errorf("解析投票预约失败: %w", err)
+	}
+	return &reservation, nil
+}
+
+// GetExpiredVoteReservations 获取过期时间早于before的投票预约令牌，最多limit个
+func (r *RedisRepository) GetExpiredVoteReservations(before time.Time, limit int) ([]string, error) {
+	tokens, err := r.client.ZRangeByScore(r.ctx, VoteReservationExpiryKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(before.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取过期的投票预约失败: %w", err)
+	}
+	return tokens, nil
+}
+
+// RestoreTicketUsage 归还一次票据使用次数，返回false表示票据已不存在
+func (r *RedisRepository) RestoreTicketUsage(version string) (bool, error) {
+	result, err := r.evalScript("restoreTicketUsage", RestoreTicketUsageScript, []string{TicketKey + version})
+	if err != nil {
+		return false, fmt.Errorf("归还票据使用次数失败: %w", err)
+	}
+	restored, _ := result.(int64)
+	return restored == 1, nil
+}
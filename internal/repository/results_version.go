@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// bumpResultsVersionTx 在改变票数的事务中递增投票活动的结果版本号，与票数一起提交
+// 按投票活动ID排序加锁，同一事务涉及多个投票活动时不会与其他事务互相等待
+func bumpResultsVersionTx(tx *sql.Tx, pollIDs ...string) error {
+	sort.Strings(pollIDs)
+	for i, pollID := range pollIDs {
+		if i > 0 && pollID == pollIDs[i-1] {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO poll_results_versions (poll_id, version) VALUES (?, 1)
+			ON DUPLICATE KEY UPDATE version = version + 1`, pollID); err != nil {
+			return fmt.Errorf("递增投票活动 %s 的结果版本号失败: %w", pollID, err)
+		}
+	}
+	return nil
+}
+
+// bumpAllResultsVersionsTx 递增所有投票活动的结果版本号，用于对账和重建投影这类不区分投票活动的修正
+func bumpAllResultsVersionsTx(tx *sql.Tx) error {
+	if _, err := tx.Exec(`INSERT INTO poll_results_versions (poll_id, version)
+		SELECT DISTINCT poll_id, 1 FROM user_votes
+		ON DUPLICATE KEY UPDATE version = poll_results_versions.version + 1`); err != nil {
+		return fmt.Errorf("递增结果版本号失败: %w", err)
+	}
+	return nil
+}
+
+// GetResultsVersion 返回投票活动的结果版本号，读主库；尚未计票的投票活动为0
+// 每个改变票数的事务都会递增版本号，版本号不变时投票活动的结果也不变，可作为HTTP缓存的版本号
+func (r *MySQLRepository) GetResultsVersion(pollID string) (int64, error) {
+	var version int64
+	err := r.masterDB.QueryRow("SELECT version FROM poll_results_versions WHERE poll_id = ?", pollID).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("查询投票活动 %s 的结果版本号失败: %w", pollID, err)
+	}
+	return version, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// ErrVoteLogNotFound 撤销投票时投票日志不存在
+var ErrVoteLogNotFound = errors.New("VOTE_LOG_NOT_FOUND: 投票日志不存在")
+
+// GetVoteLog 从主库查询一条投票日志，撤销投票前以最新状态校验
+func (r *MySQLRepository) GetVoteLog(id int64) (*model.VoteLog, error) {
+	rows, err := r.masterDB.Query(`SELECT id, event_id, poll_id, username, ticket_version, actor, source_ip, user_agent, voted_at, shadow, retracted_at
+		FROM vote_logs WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	logs, err := scanVoteLogs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, ErrVoteLogNotFound
+	}
+	return logs[0], nil
+}
+
+// retractVoteTx 在计票事务中应用撤销事件：登记撤销记录并标记投票日志，返回是否生效和需要扣减一票的用户
+// 投票日志不存在、与事件中的用户不一致或已撤销时不生效；影子投票未计入票数，只标记不扣减
+func retractVoteTx(tx *sql.Tx, event *model.VoteEvent) (bool, *voteKey, error) {
+	retraction := event.Retraction
+	var key voteKey
+	var shadow bool
+	err := tx.QueryRow("SELECT poll_id, username, shadow FROM vote_logs WHERE id = ? FOR UPDATE",
+		retraction.VoteLogID).Scan(&key.pollID, &key.username, &shadow)
+	if err == sql.ErrNoRows {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("查询待撤销的投票日志 %d 失败: %w", retraction.VoteLogID, err)
+	}
+	if key.username != retraction.Username {
+		return false, nil, nil
+	}
+
+	result, err := tx.Exec(`INSERT IGNORE INTO vote_retractions (vote_log_id, event_id, poll_id, actor)
+		VALUES (?, ?, ?, ?)`, retraction.VoteLogID, event.EventID, key.pollID, event.Audit.Actor)
+	if err != nil {
+		return false, nil, fmt.Errorf("登记投票日志 %d 的撤销记录失败: %w", retraction.VoteLogID, err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, nil, fmt.Errorf("获取撤销记录写入结果失败: %w", err)
+	}
+	if inserted == 0 {
+		return false, nil, nil
+	}
+
+	if _, err := tx.Exec("UPDATE vote_logs SET retracted_at = NOW() WHERE id = ?", retraction.VoteLogID); err != nil {
+		return false, nil, fmt.Errorf("标记投票日志 %d 已撤销失败: %w", retraction.VoteLogID, err)
+	}
+	if shadow {
+		return true, nil, nil
+	}
+	return true, &key, nil
+}
+
+// applyRetractionTx 在计票事务中应用撤销事件并扣减一票，返回生效的撤销数
+// 事件溯源模式下同样直接扣减，投影任务此前或之后计入的一票与之抵消
+func applyRetractionTx(tx *sql.Tx, event *model.VoteEvent) (int, error) {
+	applied, key, err := retractVoteTx(tx, event)
+	if err != nil || !applied {
+		return 0, err
+	}
+	if key != nil {
+		if _, err := tx.Exec(`INSERT INTO user_votes (poll_id, username, votes) VALUES (?, ?, -1)
+			ON DUPLICATE KEY UPDATE votes = votes - 1`, key.pollID, key.username); err != nil {
+			return 0, fmt.Errorf("扣减用户 %s 票数失败: %w", key.username, err)
+		}
+		if err := bumpResultsVersionTx(tx, key.pollID); err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
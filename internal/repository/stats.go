@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// 投票活动统计的Redis键前缀，完整键为 前缀 + pollID
+const (
+	PollStatsTotalKey      = "stats:votes:"      // 计入的票数
+	PollStatsHourlyKey     = "stats:hourly:"     // 按小时统计的票数，字段为整点时间的Unix秒
+	PollStatsVotersKey     = "stats:voters:"     // 投票者的HyperLogLog
+	PollStatsIssuedKey     = "stats:issued:"     // 签发的票据使用次数
+	PollStatsUsedKey       = "stats:used:"       // 实际使用的票据次数
+	PollStatsRejectionsKey = "stats:rejections:" // 按原因码统计的拒绝次数
+)
+
+// RecordPollVotes 记录一次已落库的投票，ticketUsed表示该投票消耗了一次票据
+func (r *RedisRepository) RecordPollVotes(pollID string, votes int, voter string, votedAt time.Time, ticketUsed bool) error {
+	hour := strconv.FormatInt(votedAt.Truncate(time.Hour).Unix(), 10)
+
+	pipe := r.client.Pipeline()
+	pipe.IncrBy(r.ctx, PollStatsTotalKey+pollID, int64(votes))
+	pipe.HIncrBy(r.ctx, PollStatsHourlyKey+pollID, hour, int64(votes))
+	if voter != "" {
+		pipe.PFAdd(r.ctx, PollStatsVotersKey+pollID, voter)
+	}
+	if ticketUsed {
+		pipe.Incr(r.ctx, PollStatsUsedKey+pollID)
+	}
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return fmt.Errorf("记录投票活动统计失败: %w", err)
+	}
+	return nil
+}
+
+// RecordTicketsIssued 记录签发的票据使用次数
+func (r *RedisRepository) RecordTicketsIssued(pollID string, usages int) error {
+	if err := r.client.IncrBy(r.ctx, PollStatsIssuedKey+pollID, int64(usages)).Err(); err != nil {
+		return fmt.Errorf("记录票据签发次数失败: %w", err)
+	}
+	return nil
+}
+
+// RecordVoteRejection 记录一次被拒绝的投票
+func (r *RedisRepository) RecordVoteRejection(pollID, reasonCode string) error {
+	if err := r.client.HIncrBy(r.ctx, PollStatsRejectionsKey+pollID, reasonCode, 1).Err(); err != nil {
+		return fmt.Errorf("记录投票拒绝次数失败: %w", err)
+	}
+	return nil
+}
+
+// GetPollStats 读取投票活动的统计数据，利用率等派生指标由调用方计算
+func (r *RedisRepository) GetPollStats(pollID string) (*model.PollStats, error) {
+	pipe := r.client.Pipeline()
+	totalCmd := pipe.Get(r.ctx, PollStatsTotalKey+pollID)
+	hourlyCmd := pipe.HGetAll(r.ctx, PollStatsHourlyKey+pollID)
+	votersCmd := pipe.PFCount(r.ctx, PollStatsVotersKey+pollID)
+	issuedCmd := pipe.Get(r.ctx, PollStatsIssuedKey+pollID)
+	usedCmd := pipe.Get(r.ctx, PollStatsUsedKey+pollID)
+	rejectionsCmd := pipe.HGetAll(r.ctx, PollStatsRejectionsKey+pollID)
+	if _, err := pipe.Exec(r.ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("获取投票活动统计失败: %w", err)
+	}
+
+	stats := &model.PollStats{
+		PollID:       pollID,
+		UniqueVoters: votersCmd.Val(),
+	}
+	stats.TotalVotes, _ = totalCmd.Int64()
+	stats.TicketsIssued, _ = issuedCmd.Int64()
+	stats.TicketsUsed, _ = usedCmd.Int64()
+
+	for field, value := range hourlyCmd.Val() {
+		hour, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		votes, _ := strconv.ParseInt(value, 10, 64)
+		stats.VotesPerHour = append(stats.VotesPerHour, &model.HourlyVotes{
+			Hour:  time.Unix(hour, 0),
+			Votes: votes,
+		})
+	}
+	sort.Slice(stats.VotesPerHour, func(i, j int) bool {
+		return stats.VotesPerHour[i].Hour.Before(stats.VotesPerHour[j].Hour)
+	})
+
+	for reasonCode, value := range rejectionsCmd.Val() {
+		count, _ := strconv.ParseInt(value, 10, 64)
+		stats.Rejections = append(stats.Rejections, &model.RejectionCount{
+			ReasonCode: reasonCode,
+			Count:      count,
+		})
+	}
+	sort.Slice(stats.Rejections, func(i, j int) bool {
+		return stats.Rejections[i].ReasonCode < stats.Rejections[j].ReasonCode
+	})
+
+	return stats, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// validatedTicketSweepInterval 清理已过期缓存条目的最小间隔
+const validatedTicketSweepInterval = time.Minute
+
+// validatedTicketCache 进程内缓存校验通过的票据，票据的值、所属活动和过期时间在签发后不再变化，
+// 因此同一票据在有效期内重复投票时无需再从Redis读取完整的票据哈希
+type validatedTicketCache struct {
+	mu        sync.RWMutex
+	entries   map[validatedTicketKey]validatedTicket
+	lastSweep time.Time
+}
+
+type validatedTicketKey struct {
+	version string
+	value   string
+}
+
+type validatedTicket struct {
+	pollID    string
+	maxUsages int
+	expiresAt time.Time
+}
+
+func newValidatedTicketCache() *validatedTicketCache {
+	return &validatedTicketCache{
+		entries:   make(map[validatedTicketKey]validatedTicket),
+		lastSweep: time.Now(),
+	}
+}
+
+// load 返回缓存的校验结果，票据过期后的条目视为未命中
+func (c *validatedTicketCache) load(version, value string) (validatedTicket, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[validatedTicketKey{version: version, value: value}]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return validatedTicket{}, false
+	}
+	return entry, true
+}
+
+// store 缓存校验结果直到expiresAt，并顺带清理已过期的条目
+func (c *validatedTicketCache) store(version, value, pollID string, maxUsages int, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= validatedTicketSweepInterval {
+		for key, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[validatedTicketKey{version: version, value: value}] = validatedTicket{
+		pollID:    pollID,
+		maxUsages: maxUsages,
+		expiresAt: expiresAt,
+	}
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RecordTicketFailure 记录客户端的一次票据校验失败，窗口从第一次失败开始计算
+// 窗口内失败次数达到threshold时禁止该客户端使用票据blockFor时长，blocked表示本次调用新加入禁止名单
+func (r *RedisRepository) RecordTicketFailure(subject string, window time.Duration, threshold int, blockFor time.Duration) (failures int, blocked bool, err error) {
+	result, err := r.evalScript("recordTicketFailure", RecordTicketFailureScript,
+		[]string{TicketFailureKey + subject, TicketBlockKey + subject},
+		window.Milliseconds(), threshold, blockFor.Milliseconds())
+	if err != nil {
+		return 0, false, fmt.Errorf("记录票据校验失败次数失败: %w", err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, false, fmt.Errorf("票据校验失败计数脚本返回格式错误: %v", result)
+	}
+	count, _ := values[0].(int64)
+	newlyBlocked, _ := values[1].(int64)
+	return int(count), newlyBlocked == 1, nil
+}
+
+// GetTicketBlockTTL 返回客户端被禁止使用票据的剩余时长，多个标识中取最长的一个，均未被禁止时为0
+func (r *RedisRepository) GetTicketBlockTTL(subjects ...string) (time.Duration, error) {
+	if len(subjects) == 0 {
+		return 0, nil
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.DurationCmd, len(subjects))
+	for i, subject := range subjects {
+		cmds[i] = pipe.PTTL(r.ctx, TicketBlockKey+subject)
+	}
+	if _, err := pipe.Exec(r.ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("查询票据禁止名单失败: %w", err)
+	}
+
+	var longest time.Duration
+	for _, cmd := range cmds {
+		// 键不存在时PTTL返回负值
+		if ttl := cmd.Val(); ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ticketHoldRetention 占用记录在过期时间之后的保留时长，释放任务短暂不可用时仍能找到占用归还使用次数
+const ticketHoldRetention = 10 * time.Minute
+
+// TicketHold 从票据扣减、等待投票受理后确认的一次使用次数
+// 受理失败时释放占用归还使用次数；既未确认也未释放的占用在过期后由释放任务归还
+type TicketHold struct {
+	ID      string
+	Version string
+	Holder  string // 客户端绑定模式下同时扣减了该客户端的配额，释放时一并归还
+}
+
+// HoldTicketUsages 在一次Lua脚本执行中为每个占用扣减对应票据的一次使用次数并登记占用，占用在ttl后过期
+// 返回与holds一一对应的剩余次数和错误，票据已耗尽时对应的错误为ErrTicketExhausted，不影响其他票据；
+// 脚本执行失败时返回err，此时没有票据被扣减
+func (r *RedisRepository) HoldTicketUsages(holds []*TicketHold, ttl time.Duration) ([]int, []error, error) {
+	keys := make([]string, 0, 1+2*len(holds))
+	keys = append(keys, TicketHoldExpiryKey)
+	args := make([]interface{}, 0, 2+3*len(holds))
+	args = append(args, time.Now().Add(ttl).UnixMilli(), (ttl + ticketHoldRetention).Milliseconds())
+	for _, hold := range holds {
+		keys = append(keys, TicketKey+hold.Version, TicketHoldKey+hold.ID)
+		args = append(args, hold.ID, hold.Version, hold.Holder)
+	}
+
+	result, err := r.evalScript("holdTicketUsages", HoldTicketUsagesScript, keys, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("执行票据使用次数占用脚本失败: %w", err)
+	}
+	resultSlice, ok := result.([]interface{})
+	if !ok || len(resultSlice) != len(holds) {
+		return nil, nil, fmt.Errorf("LUA脚本返回格式错误")
+	}
+
+	remaining := make([]int, len(holds))
+	errs := make([]error, len(holds))
+	for i, value := range resultSlice {
+		n, ok := value.(int64)
+		switch {
+		case !ok:
+			errs[i] = fmt.Errorf("LUA脚本返回剩余次数类型错误")
+		case n == -2:
+			errs[i] = ErrTicketExhausted
+		case n < 0:
+			errs[i] = fmt.Errorf("票据数据损坏")
+		default:
+			remaining[i] = int(n)
+		}
+	}
+	return remaining, errs, nil
+}
+
+// HoldTicketUsage 扣减票据的一次使用次数并登记占用，返回扣减后的剩余次数
+func (r *RedisRepository) HoldTicketUsage(hold *TicketHold, ttl time.Duration) (int, error) {
+	remaining, errs, err := r.HoldTicketUsages([]*TicketHold{hold}, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return remaining[0], errs[0]
+}
+
+// ConfirmTicketUsage 投票受理后确认占用，使用次数不再归还；返回false表示占用已过期被释放
+func (r *RedisRepository) ConfirmTicketUsage(holdID string) (bool, error) {
+	var deleted *redis.IntCmd
+	_, err := r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.Del(r.ctx, TicketHoldKey+holdID)
+		pipe.ZRem(r.ctx, TicketHoldExpiryKey, holdID)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("确认票据使用次数占用失败: %w", err)
+	}
+	return deleted.Val() == 1, nil
+}
+
+// ReleaseTicketUsage 释放占用，归还票据使用次数和客户端配额；返回false表示占用已确认、已释放或票据已不存在
+// 与确认并发时只有一方生效
+func (r *RedisRepository) ReleaseTicketUsage(holdID string) (bool, error) {
+	result, err := r.evalScript("releaseTicketUsage", ReleaseTicketUsageScript,
+		[]string{TicketHoldKey + holdID, TicketHoldExpiryKey}, holdID, TicketKey)
+	if err != nil {
+		return false, fmt.Errorf("释放票据使用次数占用失败: %w", err)
+	}
+	released, _ := result.(int64)
+	return released == 1, nil
+}
+
+// GetExpiredTicketHolds 获取过期时间早于before的占用ID，最多limit个
+func (r *RedisRepository) GetExpiredTicketHolds(before time.Time, limit int) ([]string, error) {
+	ids, err := r.client.ZRangeByScore(r.ctx, TicketHoldExpiryKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(before.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("获取过期的票据使用次数占用失败: %w", err)
+	}
+	return ids, nil
+}
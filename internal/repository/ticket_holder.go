@@ -0,0 +1,41 @@
+package repository
+
+import "fmt"
+
+// ticketHolderField 客户端配额在票据哈希中的字段名
+func ticketHolderField(holder string) string {
+	return "holder:" + holder
+}
+
+// BindTicketHolder 把票据绑定到客户端，首次绑定时配额为quota，返回客户端在该票据上的剩余使用次数
+func (r *RedisRepository) BindTicketHolder(version, holder string, quota int) (int, error) {
+	result, err := r.evalScript("bindTicketHolder", BindTicketHolderScript,
+		[]string{TicketKey + version}, ticketHolderField(holder), quota)
+	if err != nil {
+		return 0, fmt.Errorf("绑定票据 %s 到客户端失败: %w", version, err)
+	}
+
+	remaining, _ := result.(int64)
+	if remaining < 0 {
+		return 0, fmt.Errorf("票据 %s 不存在", version)
+	}
+	return int(remaining), nil
+}
+
+// AddTicketHolderUsage 调整客户端在票据上的剩余使用次数，delta为-1时扣减一次，为1时归还一次
+func (r *RedisRepository) AddTicketHolderUsage(version, holder string, delta int) (int, error) {
+	result, err := r.evalScript("addTicketHolderUsage", AddTicketHolderUsageScript,
+		[]string{TicketKey + version}, ticketHolderField(holder), delta)
+	if err != nil {
+		return 0, fmt.Errorf("调整客户端票据配额失败: %w", err)
+	}
+
+	remaining, _ := result.(int64)
+	switch remaining {
+	case -1:
+		return 0, ErrTicketNotHolder
+	case -2:
+		return 0, ErrClientQuotaExhausted
+	}
+	return int(remaining), nil
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ticketIssuedField 实例签发计数在票据哈希中的字段名
+func ticketIssuedField(instanceID int) string {
+	return "issued:" + strconv.Itoa(instanceID)
+}
+
+// AddTicketIssued 实例在票据上的签发次数加1，返回加1后的次数，已达到quota时返回ErrInstanceQuotaExhausted
+func (r *RedisRepository) AddTicketIssued(version string, instanceID, quota int) (int, error) {
+	result, err := r.evalScript("addTicketIssued", AddTicketIssuedScript,
+		[]string{TicketKey + version}, ticketIssuedField(instanceID), quota)
+	if err != nil {
+		return 0, fmt.Errorf("更新实例 %d 在票据 %s 上的签发次数失败: %w", instanceID, version, err)
+	}
+
+	issued, _ := result.(int64)
+	switch issued {
+	case -1:
+		return 0, fmt.Errorf("票据 %s 不存在", version)
+	case -2:
+		return 0, ErrInstanceQuotaExhausted
+	}
+	return int(issued), nil
+}
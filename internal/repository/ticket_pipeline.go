@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+// ticketOverlapGrace 票据轮换后上一个版本仍可使用的时长，未开启票据流水线时为0
+func ticketOverlapGrace() time.Duration {
+	if !config.AppConfig.Ticket.Pipeline.Enabled {
+		return 0
+	}
+	return config.AppConfig.Ticket.Pipeline.Grace
+}
+
+// GetPendingTicketVersion 获取投票活动预生成、尚未生效的票据版本，没有时返回空字符串
+func (r *RedisRepository) GetPendingTicketVersion(pollID string) (string, error) {
+	version, err := r.client.Get(r.ctx, pollScopedKey(TicketPendingVersionKey, pollID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("获取预生成的票据版本失败: %w", err)
+	}
+	return version, nil
+}
+
+// SetPendingTicketVersion 记录投票活动预生成的票据版本，该版本生效时由SetNewestTicketVersion清除
+func (r *RedisRepository) SetPendingTicketVersion(pollID, version string) error {
+	if err := r.client.Set(r.ctx, pollScopedKey(TicketPendingVersionKey, pollID), version, 0).Err(); err != nil {
+		return fmt.Errorf("记录预生成的票据版本失败: %w", err)
+	}
+	return nil
+}
+
+// checkTicketVersion 校验票据版本是投票活动的最新版本，或是重叠窗口内的上一个版本，返回是否为上一个版本
+// 只有票据不是最新版本时才读取上一个版本，不增加正常校验的Redis往返
+func (r *RedisRepository) checkTicketVersion(pollID, version, newestVersion string) (bool, error) {
+	err := checkNewestVersion(version, newestVersion)
+	if err == nil || errors.Is(err, ErrPollClosed) || ticketOverlapGrace() <= 0 {
+		return false, err
+	}
+
+	previousVersion, getErr := r.client.Get(r.ctx, pollScopedKey(TicketPreviousVersionKey, pollID)).Result()
+	if getErr != nil && !errors.Is(getErr, redis.Nil) {
+		return false, fmt.Errorf("获取上一个票据版本失败: %w", getErr)
+	}
+	if previousVersion != version {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// defaultProcessedVoteChannel 未配置push.channel时已落库投票事件使用的Redis频道
+const defaultProcessedVoteChannel = "littlevote:votes:processed"
+
+// processedVoteChannel 已落库投票事件使用的Redis频道
+func processedVoteChannel() string {
+	if config.AppConfig.Push.Channel != "" {
+		return config.AppConfig.Push.Channel
+	}
+	return defaultProcessedVoteChannel
+}
+
+// PublishProcessedVote 把落库的投票事件发布到所有实例，由各实例推送给WebSocket客户端
+func (r *RedisRepository) PublishProcessedVote(vote *model.ProcessedVote) error {
+	data, err := json.Marshal(vote)
+	if err != nil {
+		return fmt.Errorf("序列化投票事件失败: %w", err)
+	}
+	if err := r.client.Publish(r.ctx, processedVoteChannel(), data).Err(); err != nil {
+		return fmt.Errorf("发布投票事件失败: %w", err)
+	}
+	return nil
+}
+
+// SubscribeProcessedVotes 接收各实例落库后发布的投票事件，直到ctx取消
+// 连接断开后由客户端自动重连并重新订阅，断开期间的事件会丢失
+func (r *RedisRepository) SubscribeProcessedVotes(ctx context.Context, handle func(*model.ProcessedVote)) error {
+	pubsub := r.client.Subscribe(ctx, processedVoteChannel())
+	defer pubsub.Close()
+	// 等待订阅确认，频道不可用时立即返回错误
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("订阅投票事件失败: %w", err)
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var vote model.ProcessedVote
+			if err := json.Unmarshal([]byte(msg.Payload), &vote); err != nil {
+				r.logger.Warn("解析投票事件失败", "error", err)
+				continue
+			}
+			handle(&vote)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package requestctx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// Info 请求级别的上下文信息，由HTTP中间件构建后放入请求上下文，所有解析器通过ctx获取
+type Info struct {
+	// RequestID 请求ID，优先使用客户端或网关传入的X-Request-ID
+	RequestID string
+	// ClientID 发起请求的客户端标识
+	ClientID string
+	// Actor 已认证的调用方，由认证中间件填充，未认证时为空
+	Actor string
+	// SourceIP 客户端IP，来自可信代理的请求取X-Forwarded-For中最右侧的不可信地址
+	SourceIP string
+	// UserAgent 客户端User-Agent
+	UserAgent string
+	// Roles 调用方拥有的角色，由认证中间件填充，未认证时为空
+	Roles []string
+	// Tenant 租户标识，未指定时为空
+	Tenant string
+	// Locale 客户端首选的语言区域
+	Locale string
+}
+
+// HasRole 调用方是否拥有指定角色
+func (i *Info) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// With 返回携带请求信息的上下文
+func With(ctx context.Context, info *Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// From 获取上下文中的请求信息，不存在时返回空的Info，调用方无需判空
+func From(ctx context.Context) *Info {
+	if info, ok := ctx.Value(contextKey{}).(*Info); ok && info != nil {
+		return info
+	}
+	return &Info{}
+}
+
+// VoteAudit 投票日志中记录的来源信息
+func (i *Info) VoteAudit() model.VoteAudit {
+	return model.VoteAudit{
+		Actor:     i.Actor,
+		SourceIP:  i.SourceIP,
+		UserAgent: i.UserAgent,
+		RequestID: i.RequestID,
+	}
+}
+
+// NewRequestID 生成随机的请求ID
+func NewRequestID() string {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(bytes)
+}
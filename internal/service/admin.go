@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// SetUserVotes 管理员把用户票数直接设置为votes：写入主库并追加审计记录，随后删除Redis缓存并广播票数调整通知
+// 调整量记录在admin_actions中，对账、定稿统计和投影重建都会计入，不会被投票日志覆盖；已定稿的投票活动不能调整
+// 排行榜中的分数在下一次排行榜对账时修正
+func (s *VoteService) SetUserVotes(ctx context.Context, pollID, username string, votes int, actor string) (*model.AdminAction, error) {
+	if err := s.validateCandidates(pollID, []string{username}); err != nil {
+		return nil, err
+	}
+	results, err := s.voteRepo.GetPollResults(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if results != nil {
+		return nil, fmt.Errorf("%w，不能再调整票数: %s", repository.ErrPollFinalized, pollID)
+	}
+
+	action := &model.AdminAction{
+		Action:   model.AdminActionSetUserVotes,
+		Actor:    actor,
+		PollID:   pollID,
+		Username: username,
+		Votes:    votes,
+	}
+	if err := s.voteRepo.SetUserVotes(action); err != nil {
+		return nil, err
+	}
+	// 票数已落库，缓存失效失败时旧票数最多保留到缓存过期
+	if err := s.cacheRepo.InvalidateAdjustedUserVote(pollID, username); err != nil {
+		s.logger.WarnContext(ctx, "调整用户票数后删除缓存失败", "poll_id", pollID, "username", username, "error", err)
+	}
+
+	s.logger.InfoContext(ctx, "管理员调整票数", "actor", actor, "poll_id", pollID, "username", username,
+		"previous_votes", action.PreviousVotes, "votes", action.Votes)
+	return action, nil
+}
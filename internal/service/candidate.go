@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// defaultCandidateCacheTTL 未配置vote.candidate_cache_ttl时候选人集合在Redis中的缓存时长
+const defaultCandidateCacheTTL = time.Minute
+
+// RegisterCandidate 登记候选人，vote.candidate_validator为registry时登记后即可给该候选人投票
+// 已缓存的候选人集合立即加入新候选人；加入失败时候选人在集合过期重新加载后生效
+func (s *VoteService) RegisterCandidate(name string) (*model.Candidate, error) {
+	candidate := &model.Candidate{Name: name, CreatedAt: time.Now().Truncate(time.Second)}
+	if err := s.voteRepo.CreateCandidate(candidate); err != nil {
+		return nil, err
+	}
+	if err := s.cacheRepo.AddCandidate(name); err != nil {
+		s.logger.Warn("缓存新登记的候选人失败，候选人集合过期后生效", "name", name, "error", err)
+	}
+	s.logger.Info("已登记候选人", "name", name)
+	return candidate, nil
+}
+
+// ListCandidates 按名称排序返回所有登记的候选人
+func (s *VoteService) ListCandidates() ([]*model.Candidate, error) {
+	return s.voteRepo.ListCandidates()
+}
+
+// checkRegistered registry模式下校验用户名都是登记过的候选人，pattern模式下不检查
+// 优先查询Redis中的候选人集合，集合未缓存或Redis不可用时从数据库加载
+func (s *VoteService) checkRegistered(usernames []string) error {
+	validator, err := validation.CandidateValidator()
+	if err != nil {
+		return err
+	}
+	if validator != validation.CandidateValidatorRegistry || len(usernames) == 0 {
+		return nil
+	}
+
+	unregistered, found, err := s.cacheRepo.GetUnregisteredCandidates(usernames)
+	if err != nil {
+		s.logger.Warn("读取候选人集合缓存失败，改为查询数据库", "error", err)
+	}
+	if err != nil || !found {
+		if unregistered, err = s.loadUnregisteredCandidates(usernames); err != nil {
+			return err
+		}
+	}
+	if len(unregistered) > 0 {
+		return fmt.Errorf("%w: %s 不是登记的候选人", ErrInvalidCandidate, strings.Join(unregistered, ", "))
+	}
+	return nil
+}
+
+// loadUnregisteredCandidates 从数据库加载登记的候选人并写入Redis，返回usernames中未登记的名称
+// 同时未命中缓存的请求只查询一次数据库
+func (s *VoteService) loadUnregisteredCandidates(usernames []string) ([]string, error) {
+	loaded, err, _ := s.candidateLoads.Do("candidates", func() (interface{}, error) {
+		candidates, err := s.voteRepo.ListCandidates()
+		if err != nil {
+			return nil, fmt.Errorf("查询候选人失败: %w", err)
+		}
+		names := make([]string, len(candidates))
+		registered := make(map[string]bool, len(candidates))
+		for i, candidate := range candidates {
+			names[i] = candidate.Name
+			registered[candidate.Name] = true
+		}
+		if err := s.cacheRepo.SetCandidates(names, candidateCacheTTL()); err != nil {
+			s.logger.Warn("缓存候选人集合失败", "error", err)
+		}
+		return registered, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	registered := loaded.(map[string]bool)
+	var unregistered []string
+	for _, username := range usernames {
+		if !registered[username] {
+			unregistered = append(unregistered, username)
+		}
+	}
+	return unregistered, nil
+}
+
+// candidateCacheTTL 候选人集合在Redis中的缓存时长
+func candidateCacheTTL() time.Duration {
+	if ttl := config.AppConfig.Vote.CandidateCacheTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultCandidateCacheTTL
+}
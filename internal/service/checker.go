@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/kafka"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// consistencyLagTimeout 一致性检查查询消费积压的超时
+const consistencyLagTimeout = 30 * time.Second
+
+// ConsistencyChecker 检查票数在各存储之间是否一致，由check-consistency子命令、定期检查任务和checkConsistency查询使用
+type ConsistencyChecker struct {
+	store     repository.Storage
+	cacheRepo repository.CacheRepository
+	logger    *slog.Logger
+}
+
+// NewConsistencyChecker 创建一致性检查器，cacheRepo应直接读取Redis，经过进程内缓存时检查的是本实例的缓存
+func NewConsistencyChecker(store repository.Storage, cacheRepo repository.CacheRepository, logger *slog.Logger) *ConsistencyChecker {
+	return &ConsistencyChecker{
+		store:     store,
+		cacheRepo: cacheRepo,
+		logger:    logging.Component(logger, "consistency"),
+	}
+}
+
+// Check 检查投票活动的票数与投票日志、Redis缓存与主库是否一致，并统计各分区的消费积压；pollID为空时检查所有投票活动
+// repair时以投票日志为准修正票数，并删除票数不一致和缓存不一致的用户的缓存，下次查询时从主库重新加载
+// 消费积压查询失败不影响票数的检查，原因记录在LagError中
+func (c *ConsistencyChecker) Check(ctx context.Context, pollID string, repair bool) (*model.ConsistencyReport, error) {
+	pollIDs, err := c.pollIDs(pollID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ConsistencyReport{CheckedAt: time.Now()}
+	for _, id := range pollIDs {
+		voteMismatches, err := c.CheckVoteCounts(id)
+		if err != nil {
+			return nil, fmt.Errorf("检查投票活动 %s 的票数失败: %w", id, err)
+		}
+		cacheMismatches, err := c.CheckCache(id)
+		if err != nil {
+			return nil, fmt.Errorf("检查投票活动 %s 的票数缓存失败: %w", id, err)
+		}
+		report.VoteMismatches = append(report.VoteMismatches, voteMismatches...)
+		report.CacheMismatches = append(report.CacheMismatches, cacheMismatches...)
+	}
+
+	lagCtx, cancel := context.WithTimeout(ctx, consistencyLagTimeout)
+	report.Lags, err = kafka.GroupLag(lagCtx, c.store)
+	cancel()
+	if err != nil {
+		c.logger.Warn("查询消费积压失败", "error", err)
+		report.LagError = err.Error()
+	}
+	for _, lag := range report.Lags {
+		report.TotalLag += lag.Lag
+	}
+	c.updateMetrics(report)
+
+	if repair && !report.Consistent() {
+		if err := c.repair(report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// pollIDs 待检查的投票活动，pollID为空时为所有投票活动
+func (c *ConsistencyChecker) pollIDs(pollID string) ([]string, error) {
+	if pollID != "" {
+		return []string{pollID}, nil
+	}
+	polls, err := c.store.ListPolls()
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动失败: %w", err)
+	}
+	pollIDs := make([]string, len(polls))
+	for i, poll := range polls {
+		pollIDs[i] = poll.ID
+	}
+	return pollIDs, nil
+}
+
+// CheckVoteCounts 比较投票活动user_votes中的票数与主库中按投票日志统计的票数，返回不一致的用户
+// 两次查询之间落库的投票可能造成短暂的不一致；事件溯源模式下尚未投影的投票日志同样表现为不一致
+func (c *ConsistencyChecker) CheckVoteCounts(pollID string) ([]*model.VoteCountMismatch, error) {
+	counted, err := c.store.CountPollVotes(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if len(counted) == 0 {
+		return nil, nil
+	}
+
+	usernames := make([]string, len(counted))
+	for i, userVote := range counted {
+		usernames[i] = userVote.Username
+	}
+	stored, err := c.store.GetUserVotesFromMaster(pollID, usernames)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动 %s 的票数失败: %w", pollID, err)
+	}
+	votes := make(map[string]int, len(stored))
+	for _, userVote := range stored {
+		votes[userVote.Username] = userVote.Votes
+	}
+
+	var mismatches []*model.VoteCountMismatch
+	for _, userVote := range counted {
+		if votes[userVote.Username] != userVote.Votes {
+			mismatches = append(mismatches, &model.VoteCountMismatch{
+				PollID:      pollID,
+				Username:    userVote.Username,
+				Votes:       votes[userVote.Username],
+				LoggedVotes: userVote.Votes,
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+// CheckCache 比较Redis中缓存的用户票数（单个用户的缓存和所有用户的聚合缓存）与主库user_votes中的票数，返回不一致的用户
+// 未缓存的用户不检查；计票在写入主库之后才更新缓存，检查期间落库的投票可能造成短暂的不一致
+func (c *ConsistencyChecker) CheckCache(pollID string) ([]*model.CacheMismatch, error) {
+	all, err := c.store.GetAllUserVotes(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	usernames := make([]string, len(all))
+	for i, userVote := range all {
+		usernames[i] = userVote.Username
+	}
+	stored, err := c.store.GetUserVotesFromMaster(pollID, usernames)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动 %s 的票数失败: %w", pollID, err)
+	}
+	votes := make(map[string]int, len(stored))
+	for _, userVote := range stored {
+		votes[userVote.Username] = userVote.Votes
+	}
+
+	var mismatches []*model.CacheMismatch
+	flagged := make(map[string]bool)
+	for _, username := range usernames {
+		cached, found, err := c.cacheRepo.GetUserVote(pollID, username)
+		if err != nil {
+			return nil, err
+		}
+		if found && cached.Votes != votes[username] {
+			flagged[username] = true
+			mismatches = append(mismatches, &model.CacheMismatch{
+				PollID:      pollID,
+				Username:    username,
+				CachedVotes: cached.Votes,
+				Votes:       votes[username],
+			})
+		}
+	}
+
+	aggregate, found, err := c.cacheRepo.GetAllUserVotesCache(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		for _, cached := range aggregate {
+			if flagged[cached.Username] || cached.Votes == votes[cached.Username] {
+				continue
+			}
+			flagged[cached.Username] = true
+			mismatches = append(mismatches, &model.CacheMismatch{
+				PollID:      pollID,
+				Username:    cached.Username,
+				CachedVotes: cached.Votes,
+				Votes:       votes[cached.Username],
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+// repair 修正票数并删除不一致的缓存，先修正票数，避免删除后的缓存重新加载到修正前的票数
+func (c *ConsistencyChecker) repair(report *model.ConsistencyReport) error {
+	if len(report.VoteMismatches) > 0 {
+		repaired, err := c.RepairVoteCounts()
+		if err != nil {
+			return fmt.Errorf("修正用户票数失败: %w", err)
+		}
+		report.RepairedVotes = repaired
+	}
+
+	invalidated := make(map[[2]string]bool)
+	invalidate := func(pollID, username string) {
+		key := [2]string{pollID, username}
+		if invalidated[key] {
+			return
+		}
+		if err := c.cacheRepo.DeleteUserVoteCache(pollID, username); err != nil {
+			c.logger.Warn("删除用户缓存失败", "poll_id", pollID, "username", username, "error", err)
+			return
+		}
+		invalidated[key] = true
+	}
+	for _, m := range report.VoteMismatches {
+		invalidate(m.PollID, m.Username)
+	}
+	for _, m := range report.CacheMismatches {
+		invalidate(m.PollID, m.Username)
+	}
+	report.Repaired = true
+	report.InvalidatedCaches = len(invalidated)
+	c.logger.Info("已修正不一致的票数和缓存", "vote_mismatches", len(report.VoteMismatches),
+		"cache_mismatches", len(report.CacheMismatches), "repaired_votes", report.RepairedVotes, "invalidated_caches", report.InvalidatedCaches)
+	return nil
+}
+
+// RepairVoteCounts 以投票日志和管理员的票数调整为准修正所有投票活动的user_votes，返回修正的记录数
+func (c *ConsistencyChecker) RepairVoteCounts() (int64, error) {
+	repaired, err := c.store.ReconcileUserVotes()
+	if err != nil {
+		return 0, err
+	}
+	c.logger.Info("已按投票日志修正用户票数", "repaired", repaired)
+	return repaired, nil
+}
+
+// updateMetrics 按检查结果更新不一致数和消费积压指标
+func (c *ConsistencyChecker) updateMetrics(report *model.ConsistencyReport) {
+	metrics.ConsistencyMismatches.WithLabelValues("votes").Set(float64(len(report.VoteMismatches)))
+	metrics.ConsistencyMismatches.WithLabelValues("cache").Set(float64(len(report.CacheMismatches)))
+	for _, lag := range report.Lags {
+		metrics.ConsumerGroupLag.WithLabelValues(lag.Topic, strconv.Itoa(lag.Partition)).Set(float64(lag.Lag))
+	}
+}
+
+// ConsistencyJob 票据生产者定期执行一致性检查，发现不一致时记录日志，开启consistency_check.auto_repair时自动修正
+type ConsistencyJob struct {
+	checker  *ConsistencyChecker
+	logger   *slog.Logger
+	stopChan chan struct{}
+}
+
+func NewConsistencyJob(checker *ConsistencyChecker, logger *slog.Logger) *ConsistencyJob {
+	return &ConsistencyJob{
+		checker:  checker,
+		logger:   logging.Component(logger, "consistency"),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动定期检查，间隔为0时不启动
+func (j *ConsistencyJob) Start() {
+	interval := config.AppConfig.ConsistencyCheck.Interval
+	if interval <= 0 {
+		j.logger.Info("未配置一致性检查间隔，不定期检查")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				j.RunOnce()
+			case <-j.stopChan:
+				j.logger.Info("一致性检查任务已停止")
+				return
+			}
+		}
+	}()
+
+	j.logger.Info("一致性检查任务已启动", "interval", interval, "auto_repair", config.AppConfig.ConsistencyCheck.AutoRepair)
+}
+
+// Stop 停止定期检查
+func (j *ConsistencyJob) Stop() {
+	close(j.stopChan)
+}
+
+// RunOnce 检查所有投票活动
+func (j *ConsistencyJob) RunOnce() {
+	report, err := j.checker.Check(context.Background(), "", config.AppConfig.ConsistencyCheck.AutoRepair)
+	if err != nil {
+		j.logger.Error("一致性检查失败", "error", err)
+		return
+	}
+	if report.Consistent() {
+		j.logger.Debug("票数和缓存一致", "total_lag", report.TotalLag)
+		return
+	}
+	j.logger.Warn("发现不一致的票数或缓存", "vote_mismatches", len(report.VoteMismatches),
+		"cache_mismatches", len(report.CacheMismatches), "repaired", report.Repaired, "total_lag", report.TotalLag)
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+const (
+	// defaultStrongReadTimeout 未配置vote.strong_read_timeout时等待投票落库的最长时间
+	defaultStrongReadTimeout = 5 * time.Second
+	// strongReadPollInterval 等待投票落库时查询投票日志的间隔
+	strongReadPollInterval = 50 * time.Millisecond
+)
+
+// GetUserVoteStrong 以STRONG一致性获取投票活动中用户的票数：不经过缓存和从库，直接读主库
+// afterEventID不为空时先等待该投票事件落库（事件溯源模式下还要等待投影），最多等待vote.strong_read_timeout，
+// 超时后仍返回主库中的票数并标记为stale；投票活动定稿后返回结果快照
+func (s *VoteService) GetUserVoteStrong(ctx context.Context, pollID, username, afterEventID string) (*model.UserVote, error) {
+	if err := validation.ValidateUsername("username", username); err != nil {
+		return nil, err
+	}
+
+	if snapshot := s.pollSnapshot(pollID); snapshot != nil {
+		for _, userVote := range snapshot.Results {
+			if userVote.Username == username {
+				return userVote, nil
+			}
+		}
+		return nil, fmt.Errorf("获取用户 %s 票数失败: 结果快照中不存在该用户", username)
+	}
+
+	applied := true
+	if afterEventID != "" {
+		var err error
+		if applied, err = s.waitVoteApplied(ctx, afterEventID); err != nil {
+			return nil, fmt.Errorf("获取用户 %s 票数失败: %w", username, err)
+		}
+		if !applied {
+			s.logger.InfoContext(ctx, "等待投票落库超时，返回主库中的当前票数", "poll_id", pollID,
+				"username", username, "event_id", afterEventID)
+		}
+	}
+
+	userVotes, err := s.voteRepo.GetUserVotesFromMaster(pollID, []string{username})
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %s 票数失败: %w", username, err)
+	}
+	if len(userVotes) == 0 {
+		return nil, fmt.Errorf("获取用户 %s 票数失败: %w: %s", username, repository.ErrUserNotFound, username)
+	}
+	userVote := userVotes[0]
+	userVote.Stale = !applied
+	return userVote, nil
+}
+
+// waitVoteApplied 等待投票事件计入user_votes，超时或请求取消时返回false
+func (s *VoteService) waitVoteApplied(ctx context.Context, eventID string) (bool, error) {
+	timeout := config.AppConfig.Vote.StrongReadTimeout
+	if timeout <= 0 {
+		timeout = defaultStrongReadTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(strongReadPollInterval)
+	defer ticker.Stop()
+	for {
+		applied, err := s.voteApplied(eventID)
+		if err != nil {
+			return false, err
+		}
+		if applied {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// voteApplied 投票事件已写入投票日志时返回true，事件溯源模式下还要求投影进度已越过这些日志
+func (s *VoteService) voteApplied(eventID string) (bool, error) {
+	logs, err := s.voteRepo.GetVoteLogsByEventID(eventID)
+	if err != nil {
+		return false, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+	if len(logs) == 0 {
+		return false, nil
+	}
+	if !config.AppConfig.Projection.Enabled {
+		return true, nil
+	}
+
+	progress, err := s.voteRepo.GetVoteProjectionProgress()
+	if err != nil {
+		return false, err
+	}
+	for _, voteLog := range logs {
+		if voteLog.ID > progress {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/receipt"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+const (
+	// dedupPollInterval 重复请求等待首次请求结果时的轮询间隔
+	dedupPollInterval = 20 * time.Millisecond
+
+	// idempotencyClaimTTL 携带幂等键的请求处理中标记的有效期，也是重试请求等待首次结果的最长时间
+	// 实例在处理中崩溃时，超过该时长后客户端可以使用相同的键重试
+	idempotencyClaimTTL = 30 * time.Second
+
+	// defaultIdempotencyTTL 未配置时携带幂等键的投票结果在Redis中的保留时长
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// onceOptions 合并重复请求的参数
+type onceOptions struct {
+	key         string        // 完整的Redis键
+	claimTTL    time.Duration // 处理中标记的有效期，也是重复请求等待首次结果的最长时间
+	responseTTL time.Duration // 首次请求结果的保留时长
+	run         func(context.Context, *model.VoteRequest) (*model.VoteResponse, error)
+}
+
+// voteOnce 相同的请求在保留时长内只执行一次，重复请求直接返回首次请求的结果
+func (s *VoteService) voteOnce(ctx context.Context, request *model.VoteRequest, opts onceOptions) (*model.VoteResponse, error) {
+	claimed, err := s.cacheRepo.ClaimVoteRequest(opts.key, opts.claimTTL)
+	if err != nil {
+		// Redis不可用时不抑制，直接投票
+		s.logger.WarnContext(ctx, "抑制重复投票请求失败", "error", err)
+		return opts.run(ctx, request)
+	}
+	if !claimed {
+		return s.awaitFirstResponse(ctx, request, opts)
+	}
+
+	response, err := opts.run(ctx, request)
+	if err != nil {
+		if releaseErr := s.cacheRepo.ReleaseVoteRequest(opts.key); releaseErr != nil {
+			s.logger.WarnContext(ctx, "释放重复投票请求标记失败", "error", releaseErr)
+		}
+		return response, err
+	}
+
+	if err := s.cacheRepo.SaveVoteResponse(opts.key, response, opts.responseTTL); err != nil {
+		s.logger.WarnContext(ctx, "保存投票请求结果失败", "error", err)
+	}
+	return response, nil
+}
+
+// awaitFirstResponse 等待首次请求完成并返回其结果，首次请求失败时重新执行本次请求
+func (s *VoteService) awaitFirstResponse(ctx context.Context, request *model.VoteRequest, opts onceOptions) (*model.VoteResponse, error) {
+	deadline := time.Now().Add(opts.claimTTL)
+	for time.Now().Before(deadline) {
+		response, found, err := s.cacheRepo.GetVoteResponse(opts.key)
+		if err != nil {
+			s.logger.WarnContext(ctx, "读取首次投票请求结果失败，重新执行本次请求", "error", err)
+			return opts.run(ctx, request)
+		}
+		if !found {
+			return opts.run(ctx, request)
+		}
+		if response != nil {
+			return response, nil
+		}
+		time.Sleep(dedupPollInterval)
+	}
+
+	return &model.VoteResponse{
+		Success:   false,
+		Message:   "投票失败",
+		Usernames: request.Usernames,
+		Timestamp: time.Now(),
+	}, ErrDuplicateVote
+}
+
+// dedupKey 由客户端、票据版本和用户名集合计算重复请求的键
+func dedupKey(request *model.VoteRequest) string {
+	usernames := append([]string(nil), request.Usernames...)
+	sort.Strings(usernames)
+
+	sum := sha256.Sum256([]byte(request.ClientID + "|" + request.Ticket.Version + "|" + strings.Join(usernames, ",")))
+	return repository.VoteDedupKey + hex.EncodeToString(sum[:])
+}
+
+// idempotencyTTL 携带幂等键的投票结果在Redis中的保留时长
+func idempotencyTTL() time.Duration {
+	if ttl := config.AppConfig.Vote.IdempotencyTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultIdempotencyTTL
+}
+
+// voteIdempotent 先查询幂等键的落库记录，已落库时返回首次投票的结果，否则执行投票
+// Redis中的结果过期后由MySQL中的记录兜底
+func (s *VoteService) voteIdempotent(ctx context.Context, request *model.VoteRequest) (*model.VoteResponse, error) {
+	record, err := s.voteRepo.GetVoteIdempotencyKey(request.IdempotencyKey)
+	if err != nil {
+		// 查询失败时照常投票，落库时仍会按幂等键去重
+		s.logger.WarnContext(ctx, "查询幂等键的落库记录失败", "error", err)
+		return s.vote(ctx, request)
+	}
+	if record == nil {
+		return s.vote(ctx, request)
+	}
+
+	receiptToken, err := receipt.Sign(&receipt.Receipt{
+		EventID:       record.EventID,
+		TicketVersion: record.TicketVersion,
+		Usernames:     request.Usernames,
+	})
+	if err != nil && !errors.Is(err, receipt.ErrNotConfigured) {
+		s.logger.ErrorContext(ctx, "签发投票回执失败", "event_id", record.EventID, "error", err)
+	}
+
+	return &model.VoteResponse{
+		Success:   true,
+		Message:   "投票成功",
+		Usernames: request.Usernames,
+		Timestamp: record.CreatedAt,
+		Receipt:   receiptToken,
+		EventID:   record.EventID,
+	}, nil
+}
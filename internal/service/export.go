@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// ExportVoteLogs 按id顺序导出id大于afterID的一批投票日志，pollID为空时导出所有投票活动
+func (s *VoteService) ExportVoteLogs(pollID string, afterID int64, limit int) ([]*model.VoteLog, error) {
+	return s.voteRepo.GetVoteLogsAfter(pollID, afterID, limit)
+}
+
+// QueryVoteLogs 按用户名、票据版本和投票时间查询投票日志，用于审计投票的发起者
+func (s *VoteService) QueryVoteLogs(filter *model.VoteLogFilter) ([]*model.VoteLog, error) {
+	return s.voteRepo.QueryVoteLogs(filter)
+}
+
+// VoteLogExportVersion 投票日志导出内容的版本号，与导出读取同一个从库
+// 需要在读取数据之前获取，保证版本号不会比返回的数据新
+func (s *VoteService) VoteLogExportVersion(pollID string) (string, error) {
+	latestID, err := s.voteRepo.GetReplicaLatestVoteLogID(pollID)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("logs-%s-%d", pollID, latestID), nil
+}
+
+// PollResultsVersion 投票活动结果的版本号：定稿后取自结果签名，未定稿时取自计票、撤销、管理员调整和投影递增的结果版本号
+// 需要在读取结果之前获取，保证版本号不会比返回的结果新；finalized为true时结果不会再变化
+func (s *VoteService) PollResultsVersion(pollID string) (version string, finalized bool, err error) {
+	snapshot, err := s.frozenResults(pollID)
+	if err != nil {
+		return "", false, err
+	}
+	if snapshot != nil {
+		return "final-" + snapshot.Signature, true, nil
+	}
+
+	resultsVersion, err := s.voteRepo.GetResultsVersion(pollID)
+	if err != nil {
+		return "", false, err
+	}
+	return fmt.Sprintf("results-%s-%d", pollID, resultsVersion), false, nil
+}
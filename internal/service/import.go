@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+)
+
+// importEventSize 导入时每个投票事件最多包含的票数，票数更多的行拆分为共享eventId、以index区分的多个事件
+const importEventSize = 500
+
+// ImportOptions 投票导入的选项
+type ImportOptions struct {
+	ImportID string          // 导入批次，为空时取文件内容的哈希，同一文件重复导入不会重复计票
+	PollID   string          // 文件中没有poll_id列或该列为空时导入的投票活动
+	DryRun   bool            // 只校验不导入
+	Audit    model.VoteAudit // 写入投票日志的来源信息
+}
+
+// VoteImporter 把旧系统导出的投票结果导入为投票事件，与正常投票一样经发件箱、Kafka和消费者写入投票日志并计票
+// 每一行的eventId由导入批次和行号决定，重复导入同一批次时消费者按(eventId, index)去重
+type VoteImporter struct {
+	voteRepo repository.VoteRepository
+	outbox   *OutboxRelay
+	logger   *slog.Logger
+}
+
+// NewVoteImporter 创建投票导入器
+func NewVoteImporter(voteRepo repository.VoteRepository, outbox *OutboxRelay, logger *slog.Logger) *VoteImporter {
+	return &VoteImporter{voteRepo: voteRepo, outbox: outbox, logger: logging.Component(logger, "import")}
+}
+
+// Import 校验并导入CSV格式的投票结果，任一行不合法时不导入任何投票
+// 导入的投票以合成的票据版本import-<批次>写入投票日志，不扣减任何票据的剩余次数
+func (im *VoteImporter) Import(ctx context.Context, data []byte, opts ImportOptions) (*model.VoteImport, error) {
+	importID, err := validation.ValidateImportID("importId", &opts.ImportID)
+	if err != nil {
+		return nil, err
+	}
+	if importID == "" {
+		sum := sha256.Sum256(data)
+		importID = hex.EncodeToString(sum[:16])
+	}
+	pollID, err := validation.ValidatePollID("pollId", opts.PollID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := validation.ParseVoteImport(bytes.NewReader(data), pollID)
+	if err != nil {
+		return nil, err
+	}
+	if err := im.checkPolls(rows); err != nil {
+		return nil, err
+	}
+
+	result := &model.VoteImport{
+		ID:            importID,
+		TicketVersion: "import-" + importID,
+		DryRun:        opts.DryRun,
+		Rows:          len(rows),
+	}
+	for _, row := range rows {
+		result.Votes += row.Votes
+		result.Events += (row.Votes + importEventSize - 1) / importEventSize
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	now := time.Now()
+	for _, row := range rows {
+		eventID := fmt.Sprintf("import-%s-%d", importID, row.Line)
+		for offset := 0; offset < row.Votes; offset += importEventSize {
+			usernames := make([]string, min(importEventSize, row.Votes-offset))
+			for i := range usernames {
+				usernames[i] = row.Username
+			}
+			event := &model.VoteEvent{
+				EventID:       eventID,
+				Index:         offset,
+				PollID:        row.PollID,
+				Usernames:     usernames,
+				TicketVersion: result.TicketVersion,
+				Audit:         opts.Audit,
+				VotedAt:       now,
+				// 合成的票据版本没有对应的票据，消费时不扣减剩余次数
+				TicketConsumed: true,
+			}
+			if err := im.voteRepo.EnqueueVoteEvent(event, false); err != nil {
+				return nil, fmt.Errorf("导入第%d行失败，此前的行已写入发件箱，以相同批次重新导入即可: %w", row.Line, err)
+			}
+		}
+	}
+	im.outbox.Notify()
+
+	im.logger.InfoContext(ctx, "导入投票完成", "import_id", importID, "rows", result.Rows, "votes", result.Votes, "events", result.Events)
+	return result, nil
+}
+
+// checkPolls 校验导入的投票活动存在且尚未定稿，创建时指定了候选人的活动只能导入候选人的票数
+// vote.candidate_validator为registry时只能导入登记过的候选人的票数
+func (im *VoteImporter) checkPolls(rows []validation.ImportRow) error {
+	type pollState struct {
+		poll  *model.Poll
+		found bool
+	}
+	polls := make(map[string]*pollState)
+
+	registered, err := im.registeredCandidates()
+	if err != nil {
+		return err
+	}
+
+	var errs validation.Errors
+	for _, row := range rows {
+		state, ok := polls[row.PollID]
+		if !ok {
+			poll, err := im.voteRepo.GetPoll(row.PollID)
+			if err != nil {
+				return err
+			}
+			results, err := im.voteRepo.GetPollResults(row.PollID)
+			if err != nil {
+				return err
+			}
+			if results != nil {
+				return fmt.Errorf("%w，不能再导入投票: %s", repository.ErrPollFinalized, row.PollID)
+			}
+			_, configured := config.AppConfig.Ticket.Polls[row.PollID]
+			state = &pollState{poll: poll, found: poll != nil || configured || row.PollID == model.DefaultPollID}
+			polls[row.PollID] = state
+		}
+
+		switch {
+		case !state.found:
+			errs = append(errs, validation.FieldError{
+				Field:   validation.ImportField(row.Line, "poll_id"),
+				Message: fmt.Sprintf("投票活动 %s 不存在", row.PollID),
+			})
+		case state.poll != nil && !state.poll.HasCandidate(row.Username):
+			errs = append(errs, validation.FieldError{
+				Field:   validation.ImportField(row.Line, "username"),
+				Message: fmt.Sprintf("不是投票活动 %s 的候选人", row.PollID),
+			})
+		case registered != nil && !registered[row.Username]:
+			errs = append(errs, validation.FieldError{
+				Field:   validation.ImportField(row.Line, "username"),
+				Message: "不是登记的候选人",
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// registeredCandidates registry模式下返回登记的候选人集合，pattern模式下返回nil，不检查
+// import子命令不连接Redis，直接以数据库中登记的候选人为准
+func (im *VoteImporter) registeredCandidates() (map[string]bool, error) {
+	validator, err := validation.CandidateValidator()
+	if err != nil {
+		return nil, err
+	}
+	if validator != validation.CandidateValidatorRegistry {
+		return nil, nil
+	}
+
+	candidates, err := im.voteRepo.ListCandidates()
+	if err != nil {
+		return nil, fmt.Errorf("查询候选人失败: %w", err)
+	}
+	registered := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		registered[candidate.Name] = true
+	}
+	return registered, nil
+}
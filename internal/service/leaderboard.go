@@ -0,0 +1,113 @@
+package service
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+)
+
+// GetLeaderboard 获取投票活动票数最高的limit个用户
+// 优先读取Redis中的排行榜，排行榜尚未建立时从数据库加载并建立，Redis不可用时直接查询数据库
+func (s *VoteService) GetLeaderboard(pollID string, limit int) ([]*model.UserVote, error) {
+	// 投票活动定稿后以结果快照为准
+	if snapshot := s.pollSnapshot(pollID); snapshot != nil {
+		return topUserVotes(snapshot.Results, limit), nil
+	}
+
+	userVotes, found, err := s.cacheRepo.GetLeaderboard(pollID, limit)
+	if err != nil {
+		s.logger.Warn("读取排行榜缓存失败，改为查询数据库", "poll_id", pollID, "error", err)
+	} else if found {
+		return userVotes, nil
+	}
+
+	userVotes, err = s.voteRepo.GetAllUserVotes(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cacheRepo.ReplaceLeaderboard(pollID, userVotes); err != nil {
+		s.logger.Warn("建立排行榜失败", "poll_id", pollID, "error", err)
+	}
+	return topUserVotes(userVotes, limit), nil
+}
+
+// topUserVotes 按票数排序后返回前limit个用户，不修改传入的切片
+func topUserVotes(userVotes []*model.UserVote, limit int) []*model.UserVote {
+	ranked := make([]*model.UserVote, len(userVotes))
+	copy(ranked, userVotes)
+	model.RankUserVotes(ranked)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// LeaderboardJob 定期用数据库中的票数重建各投票活动的排行榜
+type LeaderboardJob struct {
+	store         repository.Storage
+	cacheRepo     repository.CacheRepository
+	ticketService *ticket.TicketService
+	logger        *slog.Logger
+	stopChan      chan struct{}
+}
+
+func NewLeaderboardJob(store repository.Storage, cacheRepo repository.CacheRepository, ticketService *ticket.TicketService, logger *slog.Logger) *LeaderboardJob {
+	return &LeaderboardJob{
+		store:         store,
+		cacheRepo:     cacheRepo,
+		ticketService: ticketService,
+		logger:        logging.Component(logger, "leaderboard"),
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// Start 启动定期对账，间隔为0时不启动
+func (j *LeaderboardJob) Start() {
+	interval := config.AppConfig.Leaderboard.ReconcileInterval
+	if interval <= 0 {
+		j.logger.Info("未配置排行榜对账间隔，排行榜只随投票更新")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				j.RunOnce()
+			case <-j.stopChan:
+				j.logger.Info("排行榜对账任务已停止")
+				return
+			}
+		}
+	}()
+
+	j.logger.Info("排行榜对账任务已启动", "interval", interval)
+}
+
+// Stop 停止定期对账
+func (j *LeaderboardJob) Stop() {
+	close(j.stopChan)
+}
+
+// RunOnce 重建所有投票活动的排行榜，单个活动失败时继续处理其他活动
+// 读取数据库与替换排行榜之间落库的投票可能被覆盖，在下一次对账时修正
+func (j *LeaderboardJob) RunOnce() {
+	for _, pollID := range j.ticketService.PollIDs() {
+		userVotes, err := j.store.GetAllUserVotes(pollID)
+		if err != nil {
+			j.logger.Error("排行榜对账查询投票活动的票数失败", "poll_id", pollID, "error", err)
+			continue
+		}
+		if err := j.cacheRepo.ReplaceLeaderboard(pollID, userVotes); err != nil {
+			j.logger.Error("排行榜对账重建排行榜失败", "poll_id", pollID, "error", err)
+		}
+	}
+}
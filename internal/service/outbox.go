@@ -0,0 +1,177 @@
+package service
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/control"
+	"github.com/lvdashuaibi/littlevote/internal/kafka"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+const (
+	defaultOutboxInterval  = 200 * time.Millisecond
+	defaultOutboxBatchSize = 500
+)
+
+// OutboxRelay 把发件箱中已提交的投票事件按写入顺序发送到Kafka
+// 每个可写实例都运行中继，各实例跳过其他实例正在发送的行
+type OutboxRelay struct {
+	store    repository.Storage
+	producer *kafka.Producer
+	control  *control.PauseControl
+	logger   *slog.Logger
+	notify   chan struct{}
+	stopChan chan struct{}
+	doneChan chan struct{}
+
+	mu        sync.Mutex
+	relayed   int64 // 本实例启动以来发送的事件数
+	lastRelay *time.Time
+}
+
+func NewOutboxRelay(store repository.Storage, producer *kafka.Producer, logger *slog.Logger) *OutboxRelay {
+	return &OutboxRelay{
+		store:    store,
+		producer: producer,
+		logger:   logging.Component(logger, "outbox"),
+		notify:   make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// SetControl 设置集群范围的中继开关，需要在Start之前调用
+func (r *OutboxRelay) SetControl(c *control.PauseControl) {
+	r.control = c
+}
+
+// Start 启动中继，发件箱为空时按间隔轮询，写入投票事件后由Notify立即唤醒；中继暂停期间不发送
+func (r *OutboxRelay) Start() {
+	interval := config.AppConfig.Outbox.Interval
+	if interval <= 0 {
+		interval = defaultOutboxInterval
+	}
+
+	go func() {
+		defer close(r.doneChan)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-r.notify:
+			case <-r.stopChan:
+				r.logger.Info("发件箱中继已停止")
+				return
+			}
+
+			if r.control != nil && r.control.Paused() {
+				continue
+			}
+			if _, err := r.RunOnce(); err != nil {
+				r.logger.Error("发送发件箱中的投票事件失败", "error", err)
+			}
+		}
+	}()
+
+	r.logger.Info("发件箱中继已启动", "interval", interval)
+}
+
+// Stop 停止中继，等待正在发送的批次完成，未发送的事件留在发件箱中由其他实例或重启后继续发送
+func (r *OutboxRelay) Stop() {
+	close(r.stopChan)
+	<-r.doneChan
+}
+
+// Notify 唤醒中继立即发送，不阻塞调用方
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce 发送发件箱中的所有投票事件，返回发送的事件数
+func (r *OutboxRelay) RunOnce() (int, error) {
+	batchSize := config.AppConfig.Outbox.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultOutboxBatchSize
+	}
+
+	total := 0
+	for {
+		sent, err := r.store.DrainOutbox(batchSize, func(events []*model.VoteEvent) error {
+			return r.producer.SendVoteEvents(events)
+		})
+		total += sent
+		r.recordRelayed(sent)
+		if err != nil {
+			return total, err
+		}
+		if sent < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// Flush 立即发送发件箱中的所有投票事件，中继暂停时同样执行，用于故障恢复后由运维确认发送
+func (r *OutboxRelay) Flush() (int, error) {
+	sent, err := r.RunOnce()
+	r.logger.Info("强制发送发件箱完成", "sent", sent)
+	return sent, err
+}
+
+// Status 返回发件箱积压、中继的暂停状态和本实例的发送进度，同时更新积压指标
+func (r *OutboxRelay) Status() (*model.OutboxStatus, error) {
+	stats, err := r.store.GetOutboxStats()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	updateOutboxAge(stats, now)
+
+	status := &model.OutboxStatus{
+		OutboxStats: *stats,
+		InstanceID:  config.AppConfig.Server.InstanceID,
+		CheckedAt:   now,
+	}
+	if r.control != nil {
+		status.Pause = *r.control.State()
+	}
+
+	r.mu.Lock()
+	status.Relayed = r.relayed
+	status.LastRelay = r.lastRelay
+	r.mu.Unlock()
+	return status, nil
+}
+
+func (r *OutboxRelay) recordRelayed(sent int) {
+	if sent == 0 {
+		return
+	}
+	metrics.OutboxRelayed.Add(float64(sent))
+
+	now := time.Now()
+	r.mu.Lock()
+	r.relayed += int64(sent)
+	r.lastRelay = &now
+	r.mu.Unlock()
+}
+
+// updateOutboxAge 按最早一条未发送事件的写入时间更新等待时长指标
+func updateOutboxAge(stats *model.OutboxStats, now time.Time) {
+	age := 0.0
+	if stats.OldestAt != nil {
+		age = now.Sub(*stats.OldestAt).Seconds()
+	}
+	metrics.OutboxOldestAge.Set(age)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// CreatePoll 创建投票活动，本实例立即开始签发票据，其他实例在下一次同步投票活动后开始签发
+// vote.candidate_validator为registry时候选人必须都已登记
+func (s *VoteService) CreatePoll(poll *model.Poll) (*model.Poll, error) {
+	if err := s.checkRegistered(poll.Candidates); err != nil {
+		return nil, err
+	}
+	poll.CreatedAt = time.Now().Truncate(time.Second)
+	if err := s.voteRepo.CreatePoll(poll); err != nil {
+		return nil, err
+	}
+	s.ticketService.RegisterPoll(poll)
+	return poll, nil
+}
+
+// GetPoll 查询投票活动，只在配置文件中配置的活动返回只有ID的定义
+func (s *VoteService) GetPoll(pollID string) (*model.Poll, error) {
+	poll, err := s.voteRepo.GetPoll(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll != nil {
+		return poll, nil
+	}
+	if policy, ok := s.ticketService.Policy(pollID); ok {
+		return &model.Poll{ID: pollID, Title: pollID, Shadow: policy.Shadow()}, nil
+	}
+	return nil, fmt.Errorf("投票活动 %s 不存在", pollID)
+}
+
+// SetPollShadow 开启或关闭投票活动的影子模式，本实例立即生效，其他实例在下一次同步投票活动后生效
+// 只在配置文件中配置的活动通过ticket.polls.<id>.shadow设置
+func (s *VoteService) SetPollShadow(pollID string, shadow bool) (*model.Poll, error) {
+	if err := s.voteRepo.SetPollShadow(pollID, shadow); err != nil {
+		return nil, err
+	}
+	poll, err := s.voteRepo.GetPoll(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if poll == nil {
+		return nil, fmt.Errorf("投票活动 %s 不存在", pollID)
+	}
+	s.ticketService.RegisterPoll(poll)
+	return poll, nil
+}
+
+// validateCandidates 校验用户名列表非空、每个用户名都符合vote.username_*配置的规则，registry模式下都已登记，且都是投票活动的候选人
+func (s *VoteService) validateCandidates(pollID string, usernames []string) error {
+	if err := validateUsernames(usernames); err != nil {
+		return err
+	}
+	if err := s.checkRegistered(usernames); err != nil {
+		return err
+	}
+
+	policy, ok := s.ticketService.Policy(pollID)
+	if !ok || policy.Poll == nil {
+		return nil
+	}
+	for _, username := range usernames {
+		if !policy.Poll.HasCandidate(username) {
+			return fmt.Errorf("%w: %s 不是投票活动 %s 的候选人", ErrInvalidCandidate, username, pollID)
+		}
+	}
+	return nil
+}
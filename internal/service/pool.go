@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// ErrVoteQueueFull 投票排队已满，请求被直接拒绝
+var ErrVoteQueueFull = errors.New("VOTE_QUEUE_FULL: 投票请求过多，请稍后重试")
+
+// votePool 固定数量的worker执行投票，突发流量在有界队列中排队，
+// 使同时进行的Redis/Kafka操作数量可预期
+type votePool struct {
+	jobs     chan *voteJob
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+type voteJob struct {
+	ctx     context.Context
+	request *model.VoteRequest
+	done    chan voteResult
+}
+
+type voteResult struct {
+	response *model.VoteResponse
+	err      error
+}
+
+// newVotePool 启动concurrency个worker，队列最多容纳queueLength个等待中的请求
+func newVotePool(concurrency, queueLength int, handle func(context.Context, *model.VoteRequest) (*model.VoteResponse, error)) *votePool {
+	p := &votePool{
+		jobs:     make(chan *voteJob, queueLength),
+		stopChan: make(chan struct{}),
+	}
+
+	for i := 0; i < concurrency; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case job := <-p.jobs:
+					metrics.VotePoolQueued.Dec()
+					response, err := handle(job.ctx, job.request)
+					job.done <- voteResult{response: response, err: err}
+				case <-p.stopChan:
+					return
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// submit 将投票请求放入队列并等待执行结果，队列已满时立即返回ErrVoteQueueFull
+func (p *votePool) submit(ctx context.Context, request *model.VoteRequest) (*model.VoteResponse, error) {
+	job := &voteJob{ctx: ctx, request: request, done: make(chan voteResult, 1)}
+
+	select {
+	case p.jobs <- job:
+		metrics.VotePoolQueued.Inc()
+	default:
+		metrics.VotePoolRejected.Inc()
+		return &model.VoteResponse{
+			Success:   false,
+			Message:   "投票失败",
+			Usernames: request.Usernames,
+			Timestamp: time.Now(),
+		}, ErrVoteQueueFull
+	}
+
+	result := <-job.done
+	return result.response, result.err
+}
+
+// stop 停止所有worker，等待正在执行的投票完成
+func (p *votePool) stop() {
+	close(p.stopChan)
+	p.wg.Wait()
+}
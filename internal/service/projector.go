@@ -0,0 +1,96 @@
+package service
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+const (
+	defaultProjectionInterval  = time.Second
+	defaultProjectionBatchSize = 5000
+)
+
+// Projector 事件溯源模式下的投影任务，按id顺序把投票日志应用到user_votes和票据剩余次数
+type Projector struct {
+	store     repository.Storage
+	redisRepo *repository.RedisRepository
+	logger    *slog.Logger
+	stopChan  chan struct{}
+}
+
+func NewProjector(store repository.Storage, redisRepo *repository.RedisRepository, logger *slog.Logger) *Projector {
+	return &Projector{
+		store:     store,
+		redisRepo: redisRepo,
+		logger:    logging.Component(logger, "projector"),
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start 启动定期投影，未开启事件溯源模式时不启动
+func (p *Projector) Start() {
+	if !config.AppConfig.Projection.Enabled {
+		return
+	}
+
+	interval := config.AppConfig.Projection.Interval
+	if interval <= 0 {
+		interval = defaultProjectionInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := p.RunOnce(); err != nil {
+					p.logger.Error("投影投票日志失败", "error", err)
+				}
+			case <-p.stopChan:
+				p.logger.Info("投票日志投影任务已停止")
+				return
+			}
+		}
+	}()
+
+	p.logger.Info("投票日志投影任务已启动", "interval", interval)
+}
+
+// Stop 停止定期投影
+func (p *Projector) Stop() {
+	close(p.stopChan)
+}
+
+// RunOnce 投影所有已稳定的投票日志，返回投影的日志条数
+func (p *Projector) RunOnce() (int, error) {
+	batchSize := config.AppConfig.Projection.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultProjectionBatchSize
+	}
+
+	total := 0
+	for {
+		batch, err := p.store.ApplyVoteProjection(batchSize, config.AppConfig.Projection.SettleDelay)
+		if err != nil {
+			return total, err
+		}
+		total += batch.Applied
+
+		// 票数已变化，清除用户缓存
+		for _, candidate := range batch.Candidates {
+			if err := p.redisRepo.DeleteUserVoteCache(candidate.PollID, candidate.Username); err != nil {
+				p.logger.Warn("投影后删除用户缓存失败", "poll_id", candidate.PollID, "username", candidate.Username, "error", err)
+			}
+		}
+
+		if batch.Applied < batchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// VotePublisher 发布已落库的投票事件，供各实例推送给WebSocket客户端，由RedisRepository实现
+type VotePublisher interface {
+	PublishProcessedVote(vote *model.ProcessedVote) error
+}
+
+// SetVotePublisher 设置已落库投票事件的发布渠道，需要在启动消费者之前调用，未设置时不发布
+func (s *VoteService) SetVotePublisher(publisher VotePublisher) {
+	s.publisher = publisher
+}
+
+// publishProcessedVote 发布落库生效的投票事件，发布失败只记录日志，不影响计票
+func (s *VoteService) publishProcessedVote(ctx context.Context, event *model.VoteEvent, applied int) {
+	if s.publisher == nil {
+		return
+	}
+
+	pollID := event.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+	vote := &model.ProcessedVote{
+		EventID:     event.EventID,
+		PollID:      pollID,
+		Usernames:   event.Usernames,
+		Applied:     applied,
+		VotedAt:     event.VotedAt,
+		ProcessedAt: time.Now(),
+	}
+	if event.Retraction != nil {
+		vote.Usernames = []string{event.Retraction.Username}
+		vote.Retracted = true
+	}
+
+	if err := s.publisher.PublishProcessedVote(vote); err != nil {
+		s.logger.WarnContext(ctx, "发布已落库的投票事件失败", "event_id", event.EventID, "error", err)
+	}
+}
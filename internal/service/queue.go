@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/kafka"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+const (
+	defaultLagCheckInterval = 15 * time.Second
+	lagCheckTimeout         = 5 * time.Second
+)
+
+// QueueInspector 统计本实例投票处理管道中尚未落库的积压，回答“为什么我的投票还没显示”
+type QueueInspector struct {
+	producer *kafka.Producer
+	consumer *kafka.Consumer
+	store    repository.Storage
+	logger   *slog.Logger
+	stopChan chan struct{}
+}
+
+func NewQueueInspector(producer *kafka.Producer, consumer *kafka.Consumer, store repository.Storage, logger *slog.Logger) *QueueInspector {
+	return &QueueInspector{
+		producer: producer,
+		consumer: consumer,
+		store:    store,
+		logger:   logging.Component(logger, "queue"),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 定期刷新积压指标
+func (q *QueueInspector) Start() {
+	interval := config.AppConfig.Kafka.LagCheckInterval
+	if interval <= 0 {
+		interval = defaultLagCheckInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), lagCheckTimeout)
+				if _, err := q.Inspect(ctx); err != nil {
+					q.logger.Warn("统计投票队列积压失败", "error", err)
+				}
+				cancel()
+			case <-q.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止刷新积压指标
+func (q *QueueInspector) Stop() {
+	close(q.stopChan)
+}
+
+// Inspect 统计当前积压并同步更新指标
+func (q *QueueInspector) Inspect(ctx context.Context) (*model.QueueStatus, error) {
+	lags, err := q.consumer.Lag(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	outbox, err := q.store.GetOutboxStats()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	updateOutboxAge(outbox, now)
+
+	// 投票依次经过发件箱、生产者和Kafka分区后落库
+	depths := append([]*model.QueueDepth{{
+		Source: model.QueueSourceOutbox,
+		Depth:  outbox.Backlog,
+	}, {
+		Source: model.QueueSourceProducer,
+		Depth:  q.producer.Pending(),
+	}}, lags...)
+
+	status := &model.QueueStatus{
+		InstanceID: config.AppConfig.Server.InstanceID,
+		Depths:     depths,
+		CheckedAt:  now,
+	}
+	for _, depth := range depths {
+		status.Total += depth.Depth
+
+		partition := ""
+		if depth.Partition != nil {
+			partition = strconv.Itoa(*depth.Partition)
+		}
+		metrics.VoteQueueDepth.WithLabelValues(depth.Source, partition).Set(float64(depth.Depth))
+	}
+
+	return status, nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// ErrRateLimited 客户端IP投票过于频繁
+var ErrRateLimited = errors.New("RATE_LIMITED: 投票过于频繁，请稍后重试")
+
+// RateLimiter 按客户端IP限制投票频率，令牌桶保存在Redis中，所有实例共享同一个限额
+type RateLimiter struct {
+	cacheRepo repository.CacheRepository
+	cfg       atomic.Pointer[config.RateLimitConfig] // 限额，配置热加载时替换
+	logger    *slog.Logger
+}
+
+// NewRateLimiter 创建投票限流器，限额读取ratelimit配置
+func NewRateLimiter(cacheRepo repository.CacheRepository, logger *slog.Logger) *RateLimiter {
+	limiter := &RateLimiter{cacheRepo: cacheRepo, logger: logging.Component(logger, "ratelimit")}
+	cfg := config.AppConfig.RateLimit
+	limiter.cfg.Store(&cfg)
+	return limiter
+}
+
+// ReloadConfig 配置热加载的回调，之后的投票按新的限额扣减令牌，Redis中已有的令牌桶保留剩余令牌
+func (l *RateLimiter) ReloadConfig(prev, next *config.Config) {
+	if prev.RateLimit == next.RateLimit {
+		return
+	}
+	cfg := next.RateLimit
+	l.cfg.Store(&cfg)
+	l.logger.Info("投票限流配置已修改", "enabled", cfg.Enabled, "rate", cfg.Rate, "burst", cfg.Burst)
+}
+
+// Enabled 是否开启了投票限流
+func (l *RateLimiter) Enabled() bool {
+	return rateLimitEnabled(l.cfg.Load())
+}
+
+func rateLimitEnabled(cfg *config.RateLimitConfig) bool {
+	return cfg.Enabled && cfg.Rate > 0 && cfg.Burst > 0
+}
+
+// Allow 为ip的cost次投票扣减令牌，超出限额时返回ErrRateLimited和建议的重试等待时间
+// 未开启限流或ip为空时放行；Redis不可用时放行，不因限流器故障拒绝投票
+func (l *RateLimiter) Allow(ip string, cost int) (time.Duration, error) {
+	cfg := l.cfg.Load()
+	if !rateLimitEnabled(cfg) || ip == "" || cost <= 0 {
+		return 0, nil
+	}
+
+	if cost > cfg.Burst {
+		metrics.RateLimitRejected.Inc()
+		return 0, fmt.Errorf("%w: 单个请求包含 %d 次投票，超过上限 %d", ErrRateLimited, cost, cfg.Burst)
+	}
+
+	wait, err := l.cacheRepo.TakeRateLimitTokens(ip, cfg.Rate, cfg.Burst, cost)
+	if err != nil {
+		l.logger.Warn("扣减限流令牌失败，本次不限流", "error", err)
+		return 0, nil
+	}
+	if wait > 0 {
+		metrics.RateLimitRejected.Inc()
+		return wait, ErrRateLimited
+	}
+	return 0, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+	"github.com/lvdashuaibi/littlevote/internal/ticket"
+)
+
+var (
+	// ErrInvalidCandidate 投票的用户名列表为空或包含不合法的候选人
+	ErrInvalidCandidate = errors.New("INVALID_CANDIDATE: 候选人不合法")
+	// ErrDuplicateVote 相同的投票请求正在处理中
+	ErrDuplicateVote = errors.New("DUPLICATE: 相同的投票请求正在处理中，请稍后重试")
+)
+
+// VoteReasonCode 返回投票失败错误对应的原因码，无法归类时为空
+func VoteReasonCode(err error) model.VoteReasonCode {
+	switch {
+	case errors.Is(err, repository.ErrTicketExpired):
+		return model.VoteReasonTicketExpired
+	case errors.Is(err, repository.ErrTicketExhausted), errors.Is(err, repository.ErrClientQuotaExhausted):
+		return model.VoteReasonTicketExhausted
+	case errors.Is(err, repository.ErrPollClosed), errors.Is(err, repository.ErrPollFinalized),
+		errors.Is(err, ticket.ErrPollNotStarted):
+		return model.VoteReasonWindowClosed
+	case errors.Is(err, ErrInvalidCandidate):
+		return model.VoteReasonInvalidCandidate
+	case errors.Is(err, ErrDuplicateVote):
+		return model.VoteReasonDuplicate
+	case errors.Is(err, ErrVoteQueueFull), errors.Is(err, ticket.ErrClientBlocked),
+		errors.Is(err, repository.ErrInstanceQuotaExhausted), errors.Is(err, ErrRateLimited):
+		return model.VoteReasonRateLimited
+	case errors.Is(err, ErrReservationExpired):
+		return model.VoteReasonReservationExpired
+	}
+	return ""
+}
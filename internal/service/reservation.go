@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+const (
+	defaultReservationTTL           = 2 * time.Minute
+	defaultReservationSweepInterval = 5 * time.Second
+	reservationSweepBatchSize       = 500
+)
+
+// ErrReservationExpired 投票预约不存在、已确认或已超时释放
+var ErrReservationExpired = errors.New("RESERVATION_EXPIRED: 投票预约不存在、已确认或已过期")
+
+// ReserveVote 两阶段投票第一步：校验候选人和票据并占用一次使用次数，返回预约令牌
+// 超过vote.reservation_ttl未确认的预约由释放任务归还占用的使用次数
+func (s *VoteService) ReserveVote(ctx context.Context, request *model.VoteRequest) (*model.VoteReservation, error) {
+	reservation, err := s.reserveVote(ctx, request)
+	if err != nil {
+		s.stats.RecordRejection(request.Ticket.PollID, VoteReasonCode(err))
+	}
+	return reservation, err
+}
+
+func (s *VoteService) reserveVote(ctx context.Context, request *model.VoteRequest) (*model.VoteReservation, error) {
+	if err := s.validateCandidates(request.Ticket.PollID, request.Usernames); err != nil {
+		return nil, err
+	}
+
+	token, err := newReservationToken()
+	if err != nil {
+		return nil, fmt.Errorf("生成预约令牌失败: %w", err)
+	}
+
+	usage, err := s.ticketService.UseTicket(&request.Ticket, requesterOf(request))
+	if err != nil {
+		return nil, fmt.Errorf("使用票据失败: %w", err)
+	}
+
+	reservation := &model.VoteReservation{
+		Token:           token,
+		PollID:          request.Ticket.PollID,
+		Usernames:       request.Usernames,
+		TicketVersion:   request.Ticket.Version,
+		RemainingUsages: usage.Remaining,
+		Audit:           request.Audit,
+		IdempotencyKey:  request.IdempotencyKey,
+		ExpiresAt:       time.Now().Add(reservationTTL()),
+	}
+	if config.AppConfig.Ticket.ClientBinding.Enabled {
+		reservation.Holder = request.Audit.Principal()
+	}
+	if err := s.cacheRepo.SaveVoteReservation(reservation); err != nil {
+		// 预约未保存，立即归还占用的使用次数和客户端配额
+		usage.Release()
+		return nil, err
+	}
+	// 保存预约后使用次数改由预约管理，超时未确认时由释放任务归还
+	usage.Confirm()
+	return reservation, nil
+}
+
+// ConfirmVote 两阶段投票第二步：确认预约，投票按预约时的票据计入
+// 确认时不再校验票据是否为最新版本，预约期间票据轮换不影响确认
+func (s *VoteService) ConfirmVote(ctx context.Context, token string) (*model.VoteResponse, error) {
+	reservation, err := s.cacheRepo.ConfirmVoteReservation(token)
+	if err == nil && reservation == nil {
+		err = ErrReservationExpired
+	}
+	if err != nil {
+		return &model.VoteResponse{
+			Success:    false,
+			Message:    "投票失败",
+			Usernames:  []string{},
+			Timestamp:  time.Now(),
+			ReasonCode: VoteReasonCode(err),
+		}, err
+	}
+
+	response, err := s.confirmVote(ctx, reservation)
+	if err != nil {
+		reasonCode := VoteReasonCode(err)
+		response.ReasonCode = reasonCode
+		s.stats.RecordRejection(reservation.PollID, reasonCode)
+	}
+	return response, err
+}
+
+func (s *VoteService) confirmVote(ctx context.Context, reservation *model.VoteReservation) (*model.VoteResponse, error) {
+	// 预约期间投票活动已结束时不再计入
+	newestVersion, err := s.cacheRepo.GetNewestTicketVersion(reservation.PollID)
+	if err == nil && newestVersion == repository.PollClosedVersion {
+		err = repository.ErrPollClosed
+	}
+	if err != nil {
+		if !errors.Is(err, repository.ErrPollClosed) {
+			s.restoreReservation(ctx, reservation)
+		}
+		return &model.VoteResponse{
+			Success:   false,
+			Message:   "投票失败",
+			Usernames: reservation.Usernames,
+			Timestamp: time.Now(),
+		}, fmt.Errorf("确认投票预约失败: %w", err)
+	}
+
+	response, err := s.accept(ctx, &model.VoteRequest{
+		Usernames: reservation.Usernames,
+		Ticket: model.Ticket{
+			PollID:  reservation.PollID,
+			Version: reservation.TicketVersion,
+		},
+		Audit:          reservation.Audit,
+		IdempotencyKey: reservation.IdempotencyKey,
+	}, reservation.RemainingUsages)
+	if err != nil {
+		// 写入失败时放回预约，客户端可在过期前重试确认
+		s.restoreReservation(ctx, reservation)
+	}
+	return response, err
+}
+
+// restoreReservation 确认失败时放回预约，已过期的预约随后由释放任务处理
+func (s *VoteService) restoreReservation(ctx context.Context, reservation *model.VoteReservation) {
+	if err := s.cacheRepo.SaveVoteReservation(reservation); err != nil {
+		s.logger.ErrorContext(ctx, "放回投票预约失败", "error", err)
+	}
+}
+
+func reservationTTL() time.Duration {
+	if ttl := config.AppConfig.Vote.ReservationTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultReservationTTL
+}
+
+func newReservationToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// ReservationSweeper 释放超时未确认的投票预约和票据使用次数占用，归还占用的票据使用次数
+type ReservationSweeper struct {
+	redisRepo *repository.RedisRepository
+	logger    *slog.Logger
+	stopChan  chan struct{}
+}
+
+func NewReservationSweeper(redisRepo *repository.RedisRepository, logger *slog.Logger) *ReservationSweeper {
+	return &ReservationSweeper{
+		redisRepo: redisRepo,
+		logger:    logging.Component(logger, "reservation"),
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Start 定期释放过期的投票预约
+func (j *ReservationSweeper) Start() {
+	interval := config.AppConfig.Vote.ReservationSweepInterval
+	if interval <= 0 {
+		interval = defaultReservationSweepInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := j.RunOnce(); err != nil {
+					j.logger.Error("释放过期的投票预约和票据使用次数占用失败", "error", err)
+				}
+			case <-j.stopChan:
+				j.logger.Info("投票预约释放任务已停止")
+				return
+			}
+		}
+	}()
+
+	j.logger.Info("投票预约释放任务已启动", "interval", interval)
+}
+
+// Stop 停止释放任务
+func (j *ReservationSweeper) Stop() {
+	close(j.stopChan)
+}
+
+// RunOnce 释放所有已过期的投票预约和票据使用次数占用，返回归还的使用次数
+func (j *ReservationSweeper) RunOnce() (int, error) {
+	restored, err := j.releaseExpiredReservations()
+	if err != nil {
+		return restored, err
+	}
+	released, err := j.releaseExpiredHolds()
+	return restored + released, err
+}
+
+// releaseExpiredReservations 释放所有已过期的投票预约，返回归还的使用次数
+func (j *ReservationSweeper) releaseExpiredReservations() (int, error) {
+	restored := 0
+	for {
+		tokens, err := j.redisRepo.GetExpiredVoteReservations(time.Now(), reservationSweepBatchSize)
+		if err != nil {
+			return restored, err
+		}
+
+		for _, token := range tokens {
+			// 与确认并发时只有一方能取出预约
+			reservation, err := j.redisRepo.ExpireVoteReservation(token)
+			if err != nil {
+				return restored, err
+			}
+			if reservation == nil {
+				continue
+			}
+
+			ok, err := j.redisRepo.RestoreTicketUsage(reservation.TicketVersion)
+			if err != nil {
+				return restored, err
+			}
+			if ok {
+				restored++
+				restoreHolderUsage(context.Background(), j.logger, j.redisRepo, reservation)
+			}
+		}
+
+		if len(tokens) < reservationSweepBatchSize {
+			break
+		}
+	}
+
+	if restored > 0 {
+		j.logger.Info("已释放过期的投票预约", "restored", restored)
+	}
+	return restored, nil
+}
+
+// releaseExpiredHolds 释放过期未确认的票据使用次数占用，这些投票所在的实例在受理前宕机或与Redis断开，返回归还的使用次数
+func (j *ReservationSweeper) releaseExpiredHolds() (int, error) {
+	released := 0
+	for {
+		ids, err := j.redisRepo.GetExpiredTicketHolds(time.Now(), reservationSweepBatchSize)
+		if err != nil {
+			return released, err
+		}
+
+		for _, id := range ids {
+			// 与确认并发时只有一方生效
+			ok, err := j.redisRepo.ReleaseTicketUsage(id)
+			if err != nil {
+				return released, err
+			}
+			if ok {
+				released++
+			}
+		}
+
+		if len(ids) < reservationSweepBatchSize {
+			break
+		}
+	}
+
+	if released > 0 {
+		j.logger.Warn("已归还过期未确认的票据使用次数", "released", released)
+	}
+	return released, nil
+}
+
+// restoreHolderUsage 客户端绑定模式下归还预约占用的客户端配额，票据已过期时不再归还
+func restoreHolderUsage(ctx context.Context, logger *slog.Logger, cacheRepo repository.CacheRepository, reservation *model.VoteReservation) {
+	if reservation.Holder == "" {
+		return
+	}
+	if _, err := cacheRepo.AddTicketHolderUsage(reservation.TicketVersion, reservation.Holder, 1); err != nil &&
+		!errors.Is(err, repository.ErrTicketNotHolder) {
+		logger.ErrorContext(ctx, "归还客户端在票据上的使用次数失败", "client_id", reservation.Holder,
+			"ticket_version", reservation.TicketVersion, "error", err)
+	}
+}
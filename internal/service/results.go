@@ -0,0 +1,174 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/receipt"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+const (
+	defaultFinalizeGrace = 5 * time.Second
+	// snapshotMissTTL 未定稿的查询结果缓存时长，避免每次查询票数都访问MySQL
+	snapshotMissTTL = 5 * time.Second
+)
+
+// snapshotCache 缓存已定稿的结果快照，快照不可变因此可以永久缓存
+type snapshotCache struct {
+	mu        sync.RWMutex
+	snapshots map[string]*model.PollResults
+	misses    map[string]time.Time
+}
+
+func newSnapshotCache() *snapshotCache {
+	return &snapshotCache{
+		snapshots: make(map[string]*model.PollResults),
+		misses:    make(map[string]time.Time),
+	}
+}
+
+// FinalizePoll 结束投票活动，对账后生成签名的结果快照，此后该活动的结果查询都返回快照
+func (s *VoteService) FinalizePoll(pollID string) (*model.PollResults, error) {
+	if config.AppConfig.Vote.ResultsSecret == "" {
+		return nil, receipt.ErrResultsNotConfigured
+	}
+
+	existing, err := s.voteRepo.GetPollResults(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, repository.ErrPollFinalized
+	}
+
+	// 步骤1: 结束投票，该活动的票据立即失效
+	if err := s.ticketService.ClosePoll(pollID); err != nil {
+		return nil, err
+	}
+
+	// 步骤2: 等待已受理的投票经Kafka落库
+	grace := config.AppConfig.Vote.FinalizeGrace
+	if grace <= 0 {
+		grace = defaultFinalizeGrace
+	}
+	s.logger.Info("投票活动已结束，等待已受理的投票落库后定稿", "poll_id", pollID, "grace", grace)
+	time.Sleep(grace)
+
+	// 步骤3: 以投票日志为准对账用户票数
+	reconciled, err := s.voteRepo.ReconcileUserVotes()
+	if err != nil {
+		return nil, err
+	}
+	if reconciled > 0 {
+		s.logger.Warn("投票活动定稿前对账修正了用户票数", "poll_id", pollID, "reconciled", reconciled)
+	}
+
+	// 步骤4: 统计并签名结果快照
+	results, err := s.voteRepo.CountPollVotes(pollID)
+	if err != nil {
+		return nil, err
+	}
+	finalizedAt := time.Now().Truncate(time.Second)
+	snapshot := &model.PollResults{
+		PollID:      pollID,
+		Results:     results,
+		Finalized:   true,
+		FinalizedAt: &finalizedAt,
+		Reconciled:  reconciled,
+	}
+	for _, userVote := range results {
+		userVote.UpdatedAt = finalizedAt
+		snapshot.TotalVotes += int64(userVote.Votes)
+	}
+	if snapshot.Signature, err = receipt.SignResults(snapshot); err != nil {
+		return nil, fmt.Errorf("签名结果快照失败: %w", err)
+	}
+
+	// 步骤5: 写入不可变的结果快照
+	if err := s.voteRepo.SavePollResults(snapshot); err != nil {
+		return nil, err
+	}
+	s.snapshots.store(snapshot)
+
+	// 对账可能修正了票数，清除用户票数缓存
+	for _, userVote := range results {
+		if err := s.cacheRepo.DeleteUserVoteCache(pollID, userVote.Username); err != nil {
+			s.logger.Warn("定稿后删除用户缓存失败", "poll_id", pollID, "username", userVote.Username, "error", err)
+		}
+	}
+
+	s.logger.Info("投票活动已定稿", "poll_id", pollID, "total_votes", snapshot.TotalVotes)
+	return snapshot, nil
+}
+
+// GetPollResults 获取投票活动的结果，已定稿时返回快照，否则实时统计投票日志
+func (s *VoteService) GetPollResults(pollID string) (*model.PollResults, error) {
+	snapshot, err := s.frozenResults(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		return snapshot, nil
+	}
+
+	results, err := s.voteRepo.CountPollVotes(pollID)
+	if err != nil {
+		return nil, err
+	}
+	live := &model.PollResults{PollID: pollID, Results: results}
+	for _, userVote := range results {
+		live.TotalVotes += int64(userVote.Votes)
+	}
+	return live, nil
+}
+
+// frozenResults 获取投票活动的结果快照，未定稿时返回nil
+func (s *VoteService) frozenResults(pollID string) (*model.PollResults, error) {
+	if snapshot, cached := s.snapshots.load(pollID); cached {
+		return snapshot, nil
+	}
+
+	snapshot, err := s.voteRepo.GetPollResults(pollID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		s.snapshots.miss(pollID)
+		return nil, nil
+	}
+	s.snapshots.store(snapshot)
+	return snapshot, nil
+}
+
+// load 返回缓存的快照，cached为false表示需要查询MySQL
+func (c *snapshotCache) load(pollID string) (snapshot *model.PollResults, cached bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if snapshot, ok := c.snapshots[pollID]; ok {
+		return snapshot, true
+	}
+	if missedAt, ok := c.misses[pollID]; ok && time.Since(missedAt) < snapshotMissTTL {
+		return nil, true
+	}
+	return nil, false
+}
+
+func (c *snapshotCache) store(snapshot *model.PollResults) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.snapshots[snapshot.PollID] = snapshot
+	delete(c.misses, snapshot.PollID)
+}
+
+func (c *snapshotCache) miss(pollID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.misses[pollID] = time.Now()
+}
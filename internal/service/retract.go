@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/receipt"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+var (
+	// ErrVoteNotOwned 撤销他人的投票
+	ErrVoteNotOwned = errors.New("VOTE_NOT_OWNED: 只能撤销自己的投票")
+	// ErrVoteRetracted 投票已撤销
+	ErrVoteRetracted = errors.New("VOTE_ALREADY_RETRACTED: 该投票已撤销")
+)
+
+// RetractVote 撤销一条投票日志对应的一票：校验后把补偿事件写入发件箱，经Kafka落库时标记日志并扣减票数
+// admin为false时只能撤销投票时调用方与audit相同的投票：已认证时比较API密钥的调用方，否则比较客户端IP；已定稿的投票活动不能撤销
+// 并发撤销同一票时都可能受理，落库时只有第一个补偿事件生效
+func (s *VoteService) RetractVote(voteLogID int64, audit model.VoteAudit, admin bool) (*model.RetractVoteResponse, error) {
+	voteLog, err := s.voteRepo.GetVoteLog(voteLogID)
+	if err != nil {
+		return nil, err
+	}
+	if !admin {
+		if owner := audit.Principal(); owner == "" || voteLog.Principal() != owner {
+			return nil, ErrVoteNotOwned
+		}
+	}
+	if voteLog.RetractedAt != nil {
+		return nil, ErrVoteRetracted
+	}
+	results, err := s.voteRepo.GetPollResults(voteLog.PollID)
+	if err != nil {
+		return nil, err
+	}
+	if results != nil {
+		return nil, fmt.Errorf("%w，不能再撤销投票: %s", repository.ErrPollFinalized, voteLog.PollID)
+	}
+
+	eventID, err := receipt.NewEventID()
+	if err != nil {
+		return nil, fmt.Errorf("生成投票事件ID失败: %w", err)
+	}
+	event := &model.VoteEvent{
+		EventID:       eventID,
+		PollID:        voteLog.PollID,
+		TicketVersion: voteLog.TicketVersion,
+		Audit:         audit,
+		VotedAt:       time.Now(),
+		// 撤销不归还票据使用次数
+		TicketConsumed: true,
+		Retraction:     &model.VoteRetraction{VoteLogID: voteLog.ID, Username: voteLog.Username},
+	}
+	if err := s.voteRepo.EnqueueVoteEvent(event, false); err != nil {
+		return nil, fmt.Errorf("写入撤销投票事件失败: %w", err)
+	}
+	s.outbox.Notify()
+
+	return &model.RetractVoteResponse{
+		VoteLogID: voteLog.ID,
+		EventID:   eventID,
+		PollID:    voteLog.PollID,
+		Username:  voteLog.Username,
+	}, nil
+}
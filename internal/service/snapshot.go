@@ -0,0 +1,85 @@
+package service
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// SnapshotJob 定期保存各候选人的票数，用于展示票数随时间的变化
+type SnapshotJob struct {
+	store    repository.Storage
+	logger   *slog.Logger
+	stopChan chan struct{}
+}
+
+func NewSnapshotJob(store repository.Storage, logger *slog.Logger) *SnapshotJob {
+	return &SnapshotJob{
+		store:    store,
+		logger:   logging.Component(logger, "snapshot"),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动定期快照，间隔为0时不启动
+func (j *SnapshotJob) Start() {
+	interval := config.AppConfig.Snapshot.Interval
+	if interval <= 0 {
+		j.logger.Info("未配置排名快照间隔，不保存排名快照")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := j.RunOnce(); err != nil {
+					j.logger.Error("保存排名快照失败", "error", err)
+				}
+			case <-j.stopChan:
+				j.logger.Info("排名快照任务已停止")
+				return
+			}
+		}
+	}()
+
+	j.logger.Info("排名快照任务已启动", "interval", interval)
+}
+
+// Stop 停止定期快照
+func (j *SnapshotJob) Stop() {
+	close(j.stopChan)
+}
+
+// RunOnce 保存一次默认活动的当前排名
+func (j *SnapshotJob) RunOnce() (*model.ResultSnapshot, error) {
+	standings, err := j.store.GetAllUserVotes(model.DefaultPollID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &model.ResultSnapshot{
+		TakenAt:   time.Now(),
+		Standings: standings,
+	}
+	for _, userVote := range standings {
+		snapshot.TotalVotes += int64(userVote.Votes)
+	}
+
+	if err := j.store.SaveResultSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetSnapshots 按时间顺序查询排名快照
+func (s *VoteService) GetSnapshots(since, until time.Time, limit int) ([]*model.ResultSnapshot, error) {
+	return s.voteRepo.GetResultSnapshots(since, until, limit)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// rejectionOther 无法归类的投票失败在统计中使用的原因码
+const rejectionOther = "OTHER"
+
+// StatsService 汇总投票活动的统计数据，计入的票数由投票事件流驱动，统计保存在Redis中供所有实例共享
+type StatsService struct {
+	cacheRepo repository.CacheRepository
+	logger    *slog.Logger
+}
+
+func NewStatsService(cacheRepo repository.CacheRepository, logger *slog.Logger) *StatsService {
+	return &StatsService{cacheRepo: cacheRepo, logger: logging.Component(logger, "stats")}
+}
+
+// RecordVote 记录一个已落库的投票事件，applied为实际计入的票数
+func (s *StatsService) RecordVote(ctx context.Context, event *model.VoteEvent, applied int) {
+	voter := event.Audit.Actor
+	if voter == "" {
+		voter = event.Audit.SourceIP
+	}
+
+	// 一次投票只消耗一次票据，拆分后的事件只由第一条计入
+	if err := s.cacheRepo.RecordPollVotes(pollIDOf(event.PollID), applied, voter, event.VotedAt, event.Index == 0); err != nil {
+		s.logger.WarnContext(ctx, "记录投票统计失败", "poll_id", event.PollID, "error", err)
+	}
+}
+
+// RecordRejection 记录一次被拒绝的投票
+func (s *StatsService) RecordRejection(pollID string, reasonCode model.VoteReasonCode) {
+	code := string(reasonCode)
+	if code == "" {
+		code = rejectionOther
+	}
+	if err := s.cacheRepo.RecordVoteRejection(pollIDOf(pollID), code); err != nil {
+		s.logger.Warn("记录投票失败统计失败", "poll_id", pollID, "reason_code", code, "error", err)
+	}
+}
+
+// GetPollStats 查询投票活动的统计数据
+func (s *StatsService) GetPollStats(pollID string) (*model.PollStats, error) {
+	stats, err := s.cacheRepo.GetPollStats(pollIDOf(pollID))
+	if err != nil {
+		return nil, fmt.Errorf("查询投票活动 %s 的统计失败: %w", pollID, err)
+	}
+	if stats.TicketsIssued > 0 {
+		stats.TicketUtilization = float64(stats.TicketsUsed) / float64(stats.TicketsIssued)
+	}
+	return stats, nil
+}
+
+func pollIDOf(pollID string) string {
+	if pollID == "" {
+		return model.DefaultPollID
+	}
+	return pollID
+}
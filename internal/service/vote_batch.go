@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// VoteBatch 批量投票，返回与requests一一对应的投票结果，一项失败不影响其他项，失败项的响应中带有原因码
+// 同一批次的投票视为同一个客户端发起，票据在一次Lua脚本执行中原子扣减，不经过投票worker和重复请求抑制；
+// 携带幂等键的投票仍逐个按vote执行，保证整批重试时只计票一次
+func (s *VoteService) VoteBatch(ctx context.Context, requests []*model.VoteRequest) []*model.VoteResponse {
+	responses := make([]*model.VoteResponse, len(requests))
+	var tickets []*model.Ticket
+	var pending []int // 等待使用票据的投票下标
+	for i, request := range requests {
+		if request.IdempotencyKey != "" {
+			response, err := s.Vote(ctx, request)
+			if err != nil {
+				response = failedBatchResponse(request, err)
+			}
+			responses[i] = response
+			continue
+		}
+		if err := s.validateCandidates(request.Ticket.PollID, request.Usernames); err != nil {
+			responses[i] = s.rejectBatchItem(request, err)
+			continue
+		}
+		tickets = append(tickets, &request.Ticket)
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return responses
+	}
+
+	uses := s.ticketService.UseTickets(tickets, requesterOf(requests[pending[0]]))
+	for j, i := range pending {
+		request := requests[i]
+		if err := uses[j].Err; err != nil {
+			responses[i] = s.rejectBatchItem(request, fmt.Errorf("使用票据失败: %w", err))
+			continue
+		}
+		response, err := s.accept(ctx, request, uses[j].Remaining)
+		if err != nil {
+			uses[j].Release()
+			responses[i] = s.rejectBatchItem(request, err)
+			continue
+		}
+		uses[j].Confirm()
+		responses[i] = response
+	}
+	return responses
+}
+
+// rejectBatchItem 记录批量投票中一项的失败原因并返回失败响应
+func (s *VoteService) rejectBatchItem(request *model.VoteRequest, err error) *model.VoteResponse {
+	response := failedBatchResponse(request, err)
+	s.stats.RecordRejection(request.Ticket.PollID, response.ReasonCode)
+	return response
+}
+
+// failedBatchResponse 批量投票中一项的失败响应，失败原因写入message
+func failedBatchResponse(request *model.VoteRequest, err error) *model.VoteResponse {
+	return &model.VoteResponse{
+		Success:    false,
+		Message:    fmt.Sprintf("投票失败: %v", err),
+		Usernames:  request.Usernames,
+		Timestamp:  time.Now(),
+		ReasonCode: VoteReasonCode(err),
+	}
+}
@@ -1,44 +1,132 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"github.com/lvdashuaibi/littlevote/config"
 	"github.com/lvdashuaibi/littlevote/internal/kafka"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
 	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/receipt"
 	"github.com/lvdashuaibi/littlevote/internal/repository"
 	"github.com/lvdashuaibi/littlevote/internal/ticket"
+	"github.com/lvdashuaibi/littlevote/internal/validation"
+	"golang.org/x/sync/singleflight"
 )
 
 type VoteService struct {
-	mysqlRepo     *repository.MySQLRepository
-	redisRepo     *repository.RedisRepository
+	voteRepo      repository.VoteRepository
+	cacheRepo     repository.CacheRepository
 	ticketService *ticket.TicketService
-	kafkaProducer *kafka.Producer
+	outbox        *OutboxRelay
+	snapshots     *snapshotCache
+	pool          *votePool
+	stats         *StatsService
+	publisher     VotePublisher
+	logger        *slog.Logger
+
+	// candidateLoads 合并同时从数据库加载候选人集合的请求
+	candidateLoads singleflight.Group
 }
 
+// NewVoteService 创建投票服务，存储通过接口注入，生产环境传入MySQLRepository和RedisRepository
 func NewVoteService(
-	mysqlRepo *repository.MySQLRepository,
-	redisRepo *repository.RedisRepository,
+	voteRepo repository.VoteRepository,
+	cacheRepo repository.CacheRepository,
 	ticketService *ticket.TicketService,
-	kafkaProducer *kafka.Producer,
+	outbox *OutboxRelay,
+	logger *slog.Logger,
 ) *VoteService {
-	return &VoteService{
-		mysqlRepo:     mysqlRepo,
-		redisRepo:     redisRepo,
+	logger = logging.Component(logger, "vote")
+	s := &VoteService{
+		voteRepo:      voteRepo,
+		cacheRepo:     cacheRepo,
 		ticketService: ticketService,
-		kafkaProducer: kafkaProducer,
+		outbox:        outbox,
+		snapshots:     newSnapshotCache(),
+		stats:         NewStatsService(cacheRepo, logger),
+		logger:        logger,
+	}
+
+	// 配置了并发上限时，投票由固定数量的worker执行
+	if concurrency := config.AppConfig.Vote.Concurrency; concurrency > 0 {
+		s.pool = newVotePool(concurrency, config.AppConfig.Vote.QueueLength, s.submitVote)
+		logger.Info("投票并发上限", "concurrency", concurrency, "queue_length", config.AppConfig.Vote.QueueLength)
+	}
+	return s
+}
+
+// Stop 停止投票worker，等待正在执行的投票完成
+func (s *VoteService) Stop() {
+	if s.pool != nil {
+		s.pool.stop()
+	}
+}
+
+// GetTicket 获取投票活动的当前票据，客户端绑定模式下绑定到holder（见model.VoteAudit.Principal）
+func (s *VoteService) GetTicket(pollID, holder string) (*model.Ticket, error) {
+	return s.ticketService.GetCurrentTicket(pollID, holder)
+}
+
+// Vote 投票，抑制窗口内的重复请求直接返回首次请求的结果，失败时响应中带有原因码
+// ctx携带的请求ID附加到投票过程中的日志
+func (s *VoteService) Vote(ctx context.Context, request *model.VoteRequest) (*model.VoteResponse, error) {
+	var response *model.VoteResponse
+	var err error
+
+	if s.pool != nil {
+		response, err = s.pool.submit(ctx, request)
+	} else {
+		response, err = s.submitVote(ctx, request)
+	}
+
+	if err != nil {
+		reasonCode := VoteReasonCode(err)
+		if response != nil {
+			response.ReasonCode = reasonCode
+		}
+		s.stats.RecordRejection(request.Ticket.PollID, reasonCode)
+	}
+	return response, err
+}
+
+// GetPollStats 查询投票活动的统计数据
+func (s *VoteService) GetPollStats(pollID string) (*model.PollStats, error) {
+	if _, ok := s.ticketService.Policy(pollID); !ok {
+		return nil, fmt.Errorf("投票活动 %s 不存在", pollID)
 	}
+	return s.stats.GetPollStats(pollID)
 }
 
-// GetTicket 获取票据
-func (s *VoteService) GetTicket(clientID string) (*model.Ticket, error) {
-	return s.ticketService.GetCurrentTicket(clientID)
+// submitVote 执行一次投票请求，携带幂等键时同一个键只投票一次，否则配置了抑制窗口时合并重复请求
+func (s *VoteService) submitVote(ctx context.Context, request *model.VoteRequest) (*model.VoteResponse, error) {
+	if request.IdempotencyKey != "" {
+		return s.voteOnce(ctx, request, onceOptions{
+			key:         repository.VoteIdemKey + request.IdempotencyKey,
+			claimTTL:    idempotencyClaimTTL,
+			responseTTL: idempotencyTTL(),
+			run:         s.voteIdempotent,
+		})
+	}
+
+	window := config.AppConfig.Vote.DedupWindow
+	if window <= 0 || request.ClientID == "" {
+		return s.vote(ctx, request)
+	}
+	return s.voteOnce(ctx, request, onceOptions{
+		key:         dedupKey(request),
+		claimTTL:    window,
+		responseTTL: window,
+		run:         s.vote,
+	})
 }
 
-// Vote 投票
-func (s *VoteService) Vote(request *model.VoteRequest) (*model.VoteResponse, error) {
+// vote 执行投票
+func (s *VoteService) vote(ctx context.Context, request *model.VoteRequest) (*model.VoteResponse, error) {
 	failedResponse := &model.VoteResponse{
 		Success:   false,
 		Message:   "投票失败",
@@ -46,70 +134,166 @@ func (s *VoteService) Vote(request *model.VoteRequest) (*model.VoteResponse, err
 		Timestamp: time.Now(),
 	}
 
-	// 验证用户名列表非空
-	if len(request.Usernames) == 0 {
-		return failedResponse, fmt.Errorf("用户名列表不能为空")
+	if err := s.validateCandidates(request.Ticket.PollID, request.Usernames); err != nil {
+		return failedResponse, err
 	}
 
-	// 验证用户名是否符合规范（A-Z）
-	for _, username := range request.Usernames {
-		if len(username) != 1 || username[0] < 'A' || username[0] > 'Z' {
-			return failedResponse, fmt.Errorf("无效的用户名: %s, 用户名必须是A-Z之间的单个字母", username)
-		}
+	// 使用票据，投票受理后确认占用的使用次数，受理失败时归还
+	usage, err := s.ticketService.UseTicket(&request.Ticket, requesterOf(request))
+	if err != nil {
+		return failedResponse, fmt.Errorf("使用票据失败: %w", err)
 	}
 
-	// 使用票据
-	used, err := s.ticketService.UseTicket(&request.Ticket)
+	response, err := s.accept(ctx, request, usage.Remaining)
 	if err != nil {
-		return failedResponse, fmt.Errorf("使用票据失败: %w", err)
+		usage.Release()
+		return response, err
 	}
-	if !used {
-		return failedResponse, fmt.Errorf("票据使用失败")
+	usage.Confirm()
+	return response, nil
+}
+
+// requesterOf 返回投票请求的客户端标识，用于统计票据校验失败次数
+func requesterOf(request *model.VoteRequest) ticket.Requester {
+	return ticket.Requester{ClientID: request.ClientID, SourceIP: request.Audit.SourceIP, Holder: request.Audit.Principal()}
+}
+
+// validateUsernames 校验用户名列表非空且每个用户名都符合vote.username_*配置的规则
+func validateUsernames(usernames []string) error {
+	err := validation.ValidateUsernames("usernames", usernames)
+	var fieldErrs validation.Errors
+	if errors.As(err, &fieldErrs) {
+		return fmt.Errorf("%w: %v", ErrInvalidCandidate, err)
 	}
+	return err
+}
 
-	// 创建投票事件并发送到Kafka
+// accept 受理已使用票据的投票：写入发件箱并签发回执
+func (s *VoteService) accept(ctx context.Context, request *model.VoteRequest, remainingUsages int) (*model.VoteResponse, error) {
+	failedResponse := &model.VoteResponse{
+		Success:   false,
+		Message:   "投票失败",
+		Usernames: request.Usernames,
+		Timestamp: time.Now(),
+	}
+
+	eventID, err := receipt.NewEventID()
+	if err != nil {
+		return failedResponse, fmt.Errorf("生成投票事件ID失败: %w", err)
+	}
+
+	// 创建投票事件，写入发件箱后由中继发送到Kafka
 	voteEvent := &model.VoteEvent{
+		EventID:       eventID,
+		PollID:        request.Ticket.PollID,
 		Usernames:     request.Usernames,
 		TicketVersion: request.Ticket.Version,
+		Audit:         request.Audit,
 		VotedAt:       time.Now(),
+		// 携带幂等键时，落库前发现该键已被其他投票事件使用则不再计票
+		IdempotencyKey: request.IdempotencyKey,
+		// 事件溯源模式下票据剩余次数由投影任务推导，不在写入发件箱时扣减
+		TicketConsumed: !config.AppConfig.Projection.Enabled,
+	}
+	// 影子模式以受理时为准，活动转为正式后之前的演练投票仍不计入票数
+	if policy, ok := s.ticketService.Policy(request.Ticket.PollID); ok {
+		voteEvent.Shadow = policy.Shadow()
 	}
 
-	if err := s.kafkaProducer.SendVoteEvent(voteEvent); err != nil {
-		log.Printf("发送投票事件到Kafka失败: %v", err)
-		// 即使消息发送失败，我们也直接更新数据库，以确保数据一致性
-		// 同步更新数据库
-		if err := s.mysqlRepo.IncrementVotes(request.Usernames, request.Ticket.Version); err != nil {
-			return failedResponse, fmt.Errorf("更新数据库失败: %w", err)
-		}
+	// 票据扣减与投票事件在同一个事务中提交，写入成功即视为投票已受理，不会出现只写Kafka或只写数据库的情况
+	if err := s.voteRepo.EnqueueVoteEvent(voteEvent, voteEvent.TicketConsumed); err != nil {
+		return failedResponse, fmt.Errorf("写入投票事件失败: %w", err)
+	}
+	s.outbox.Notify()
 
-		// 清除用户缓存，确保下次读取时获取最新数据
-		for _, username := range request.Usernames {
-			if err := s.redisRepo.DeleteUserVoteCache(username); err != nil {
-				log.Printf("删除用户 %s 缓存失败: %v", username, err)
-			}
-		}
+	// 签发投票回执，未配置密钥时不返回回执
+	receiptToken, err := receipt.Sign(&receipt.Receipt{
+		EventID:       eventID,
+		TicketVersion: request.Ticket.Version,
+		Usernames:     request.Usernames,
+	})
+	if err != nil && !errors.Is(err, receipt.ErrNotConfigured) {
+		s.logger.ErrorContext(ctx, "签发投票回执失败", "event_id", eventID, "error", err)
 	}
 
 	// 返回投票结果
 	return &model.VoteResponse{
-		Success:   true,
-		Message:   "投票成功",
-		Usernames: request.Usernames,
-		Timestamp: time.Now(),
+		Success:         true,
+		Message:         "投票成功",
+		Usernames:       request.Usernames,
+		Timestamp:       time.Now(),
+		RemainingUsages: &remainingUsages,
+		Receipt:         receiptToken,
+		EventID:         eventID,
 	}, nil
 }
 
-// GetUserVote 获取用户票数
-func (s *VoteService) GetUserVote(username string) (*model.UserVote, error) {
-	// 验证用户名是否符合规范（A-Z）
-	if len(username) != 1 || username[0] < 'A' || username[0] > 'Z' {
-		return nil, fmt.Errorf("无效的用户名: %s, 用户名必须是A-Z之间的单个字母", username)
+// VerifyReceipt 校验投票回执签名，并确认回执中的投票已写入vote_logs
+func (s *VoteService) VerifyReceipt(token string) (*model.ReceiptVerification, error) {
+	r, err := receipt.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := s.voteRepo.GetVoteLogsByEventID(r.EventID)
+	if err != nil {
+		return nil, fmt.Errorf("查询投票日志失败: %w", err)
+	}
+
+	verification := &model.ReceiptVerification{
+		EventID:       r.EventID,
+		TicketVersion: r.TicketVersion,
+		Usernames:     r.Usernames,
+	}
+
+	// 回执中的每个用户都要有对应的投票日志，消息重复消费时日志可能多于回执
+	logged := make(map[string]int, len(logs))
+	for _, voteLog := range logs {
+		if voteLog.TicketVersion != r.TicketVersion {
+			continue
+		}
+		logged[voteLog.Username]++
+		if verification.RecordedAt == nil || voteLog.VotedAt.After(*verification.RecordedAt) {
+			votedAt := voteLog.VotedAt
+			verification.RecordedAt = &votedAt
+		}
+	}
+	verification.Recorded = len(logs) > 0
+	for _, username := range r.Usernames {
+		if logged[username] == 0 {
+			verification.Recorded = false
+			break
+		}
+		logged[username]--
+	}
+	if !verification.Recorded {
+		verification.RecordedAt = nil
+	}
+
+	return verification, nil
+}
+
+// GetUserVote 获取投票活动中用户的票数
+func (s *VoteService) GetUserVote(pollID, username string) (*model.UserVote, error) {
+	// 验证用户名是否符合规范
+	if err := validation.ValidateUsername("username", username); err != nil {
+		return nil, err
+	}
+
+	// 投票活动定稿后返回结果快照
+	if snapshot := s.pollSnapshot(pollID); snapshot != nil {
+		for _, userVote := range snapshot.Results {
+			if userVote.Username == username {
+				return userVote, nil
+			}
+		}
+		return nil, fmt.Errorf("获取用户 %s 票数失败: 结果快照中不存在该用户", username)
 	}
 
-	// 先从缓存获取
-	userVote, found, err := s.redisRepo.GetUserVote(username)
+	// 先从缓存获取，缓存不可用时查询数据库
+	userVote, found, err := s.cacheRepo.GetUserVote(pollID, username)
 	if err != nil {
-		//log.Printf("获取用户 %s 缓存失败: %v", username, err)
+		s.logger.Warn("读取用户票数缓存失败，改为查询数据库", "poll_id", pollID, "username", username, "error", err)
 	}
 
 	if found && userVote != nil {
@@ -117,58 +301,248 @@ func (s *VoteService) GetUserVote(username string) (*model.UserVote, error) {
 	}
 
 	// 缓存未命中，从数据库获取
-	userVote, err = s.mysqlRepo.GetUserVote(username)
+	userVote, err = s.voteRepo.GetUserVote(pollID, username)
 	if err != nil {
-		return nil, fmt.Errorf("获取用户 %s 票数失败: %w", username, err)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, fmt.Errorf("获取用户 %s 票数失败: %w", username, err)
+		}
+
+		// 数据库不可用时降级为最近已知票数
+		lastKnown, found, lastErr := s.cacheRepo.GetLastKnownUserVote(pollID, username)
+		if lastErr != nil {
+			s.logger.Warn("读取最近已知票数失败", "poll_id", pollID, "username", username, "error", lastErr)
+		}
+		if lastErr != nil || !found {
+			return nil, fmt.Errorf("获取用户 %s 票数失败: %w", username, err)
+		}
+		s.logger.Warn("查询用户票数失败，返回最近已知票数", "poll_id", pollID, "username", username, "error", err)
+		lastKnown.Stale = true
+		return lastKnown, nil
 	}
 
-	// 更新缓存
-	if err := s.redisRepo.SetUserVote(userVote); err != nil {
-		//log.Printf("更新用户 %s 缓存失败: %v", username, err)
+	// 更新缓存，失败时下次查询仍从数据库读取
+	if err := s.cacheRepo.SetUserVote(userVote); err != nil {
+		s.logger.Warn("更新用户票数缓存失败", "poll_id", pollID, "username", username, "error", err)
 	}
 
 	return userVote, nil
 }
 
-// GetAllUserVotes 获取所有用户票数
-func (s *VoteService) GetAllUserVotes() ([]*model.UserVote, error) {
-	return s.mysqlRepo.GetAllUserVotes()
+// GetAllUserVotes 获取投票活动所有用户的票数
+func (s *VoteService) GetAllUserVotes(pollID string) ([]*model.UserVote, error) {
+	// 投票活动定稿后返回结果快照
+	if snapshot := s.pollSnapshot(pollID); snapshot != nil {
+		return snapshot.Results, nil
+	}
+
+	// 聚合缓存在投票落库时失效，有效期很短，避免每次查询都全表扫描
+	cacheTTL := config.AppConfig.Vote.AllVotesCacheTTL
+	if cacheTTL > 0 {
+		userVotes, found, err := s.cacheRepo.GetAllUserVotesCache(pollID)
+		if err != nil {
+			s.logger.Warn("读取所有用户票数缓存失败", "poll_id", pollID, "error", err)
+		} else if found {
+			return userVotes, nil
+		}
+	}
+
+	userVotes, err := s.voteRepo.GetAllUserVotes(pollID)
+	if err != nil {
+		// 数据库不可用时降级为最近已知票数
+		lastKnown, lastErr := s.cacheRepo.GetAllLastKnownUserVotes(pollID)
+		if lastErr != nil || len(lastKnown) == 0 {
+			return nil, err
+		}
+		s.logger.Warn("查询所有用户票数失败，返回最近已知票数", "poll_id", pollID, "error", err)
+		for _, userVote := range lastKnown {
+			userVote.Stale = true
+		}
+		return lastKnown, nil
+	}
+
+	if err := s.cacheRepo.SaveLastKnownUserVotes(pollID, userVotes); err != nil {
+		s.logger.Warn("保存最近已知票数失败", "poll_id", pollID, "error", err)
+	}
+	if cacheTTL > 0 {
+		if err := s.cacheRepo.SetAllUserVotesCache(pollID, userVotes, cacheTTL); err != nil {
+			s.logger.Warn("写入所有用户票数缓存失败", "poll_id", pollID, "error", err)
+		}
+	}
+	return userVotes, nil
 }
 
-// ProcessVoteEvent 处理投票事件（消费者使用）
-func (s *VoteService) ProcessVoteEvent(event *model.VoteEvent) error {
-	// 更新数据库
-	if err := s.mysqlRepo.IncrementVotes(event.Usernames, event.TicketVersion); err != nil {
-		return fmt.Errorf("处理投票事件更新数据库失败: %w", err)
+// pollSnapshot 投票活动的结果快照，未定稿或查询失败时返回nil
+func (s *VoteService) pollSnapshot(pollID string) *model.PollResults {
+	snapshot, err := s.frozenResults(pollID)
+	if err != nil {
+		s.logger.Error("查询投票活动结果快照失败", "poll_id", pollID, "error", err)
+		return nil
 	}
-	if _, err := s.mysqlRepo.DecrementTicketUsage(event.TicketVersion); err != nil {
-		return fmt.Errorf("处理投票事件减少票据使用次数失败: %w", err)
+	return snapshot
+}
+
+// ProcessVoteEvent 处理投票事件（消费者使用），ctx携带受理投票时的请求ID
+func (s *VoteService) ProcessVoteEvent(ctx context.Context, event *model.VoteEvent) error {
+	if err := ensureEventID(event); err != nil {
+		return err
 	}
 
-	// 清除用户缓存
-	for _, username := range event.Usernames {
-		if err := s.redisRepo.DeleteUserVoteCache(username); err != nil {
-			log.Printf("处理投票事件删除用户 %s 缓存失败: %v", username, err)
+	// 更新数据库
+	applied, err := s.applyVoteEvent(event)
+	if err != nil {
+		return s.applyError(err)
+	}
+	s.afterVoteEvent(ctx, event, applied)
+	return nil
+}
+
+// ProcessVoteEventBatch 在一个数据库事务中处理一批投票事件（批量消费模式使用），提交后逐个更新统计和缓存
+// 任一事件写入失败时整批回滚，由消费者重试或逐条处理
+func (s *VoteService) ProcessVoteEventBatch(ctx context.Context, events []*model.VoteEvent) error {
+	for _, event := range events {
+		if err := ensureEventID(event); err != nil {
+			return err
 		}
 	}
 
-	//log.Printf("处理投票事件成功: 票据版本=%s, 用户=%v", event.TicketVersion, event.Usernames)
+	var applied []int
+	var err error
+	if config.AppConfig.Projection.Enabled {
+		applied, err = s.voteRepo.AppendVoteLogsBatch(events)
+	} else {
+		applied, err = s.voteRepo.IncrementVotesBatch(events)
+	}
+	if err != nil {
+		return s.applyError(err)
+	}
+	for i, event := range events {
+		s.afterVoteEvent(logging.WithRequestID(ctx, event.Audit.RequestID), event, applied[i])
+	}
+	return nil
+}
+
+// ensureEventID 升级前产生的事件没有eventId，补充一个以免与其他事件的投票日志冲突
+func ensureEventID(event *model.VoteEvent) error {
+	if event.EventID != "" {
+		return nil
+	}
+	eventID, err := receipt.NewEventID()
+	if err != nil {
+		return fmt.Errorf("生成投票事件ID失败: %w", err)
+	}
+	event.EventID = eventID
 	return nil
 }
 
-// TicketAndVote 获取票据并立即投票
-func (s *VoteService) TicketAndVote(usernames []string) (*model.VoteResponse, error) {
-	// 生成客户端ID
-	clientID := fmt.Sprintf("client-%d", time.Now().UnixNano())
+// applyError 数据库不可用时保留消息等待恢复，不丢弃已受理的投票
+func (s *VoteService) applyError(err error) error {
+	if pingErr := s.voteRepo.Ping(); pingErr != nil {
+		return fmt.Errorf("%w: 处理投票事件更新数据库失败: %w", kafka.ErrRetryable, err)
+	}
+	return fmt.Errorf("处理投票事件更新数据库失败: %w", err)
+}
+
+// afterVoteEvent 投票事件落库后发布给推送客户端，并更新统计、用户缓存和排行榜，applied为实际生效的票数
+func (s *VoteService) afterVoteEvent(ctx context.Context, event *model.VoteEvent, applied int) {
+	if applied == 0 {
+		// 事件已处理过
+		return
+	}
+	// 影子模式下的投票不对外推送
+	if !event.Shadow {
+		s.publishProcessedVote(ctx, event, applied)
+	}
+	// 撤销事件只删除被撤销用户的票数缓存，排行榜中的分数由对账任务修正
+	if event.Retraction != nil {
+		if err := s.cacheRepo.DeleteUserVoteCache(event.PollID, event.Retraction.Username); err != nil {
+			s.logger.WarnContext(ctx, "处理撤销投票事件删除用户缓存失败", "event_id", event.EventID,
+				"username", event.Retraction.Username, "error", err)
+		}
+		return
+	}
+	// 影子模式下的投票不计入统计，也不影响票数缓存
+	if !event.Shadow {
+		s.stats.RecordVote(ctx, event, applied)
+	}
+
+	// 事件溯源模式下票数和票据剩余次数由投影任务推导
+	if config.AppConfig.Projection.Enabled {
+		return
+	}
+
+	// 更新用户缓存
+	if event.Shadow {
+		return
+	}
+	if !repository.CacheWriteThrough() || !s.writeThroughUserVotes(ctx, event) {
+		for _, username := range event.Usernames {
+			if err := s.cacheRepo.DeleteUserVoteCache(event.PollID, username); err != nil {
+				s.logger.WarnContext(ctx, "处理投票事件删除用户缓存失败", "event_id", event.EventID, "username", username, "error", err)
+			}
+		}
+	}
+
+	// 更新排行榜；事件中部分投票此前已落库时无法确定各用户的增量，留给对账修正
+	if applied == len(event.Usernames) {
+		if err := s.cacheRepo.IncrLeaderboard(event.PollID, event.Usernames); err != nil {
+			s.logger.WarnContext(ctx, "处理投票事件更新排行榜失败", "event_id", event.EventID, "error", err)
+		}
+	}
+
+	s.logger.DebugContext(ctx, "处理投票事件成功", "event_id", event.EventID, "ticket_version", event.TicketVersion,
+		"usernames", event.Usernames)
+}
+
+// writeThroughUserVotes write_through策略下从主库读取事件中各用户的最新票数写入缓存，
+// 失败时返回false，由调用方改为删除缓存，避免缓存中留下旧票数
+func (s *VoteService) writeThroughUserVotes(ctx context.Context, event *model.VoteEvent) bool {
+	pollID := event.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+	userVotes, err := s.voteRepo.GetUserVotesFromMaster(pollID, event.Usernames)
+	if err != nil {
+		s.logger.WarnContext(ctx, "处理投票事件读取最新票数失败，改为删除用户缓存", "event_id", event.EventID, "error", err)
+		return false
+	}
+	if err := s.cacheRepo.WriteThroughUserVotes(pollID, userVotes); err != nil {
+		s.logger.WarnContext(ctx, "处理投票事件回写用户缓存失败，改为删除用户缓存", "event_id", event.EventID, "error", err)
+		return false
+	}
+	return true
+}
+
+// applyVoteEvent 将投票事件写入数据库，返回实际生效的票数
+// 事件溯源模式下只追加投票日志，否则同时更新票数
+func (s *VoteService) applyVoteEvent(event *model.VoteEvent) (int, error) {
+	if config.AppConfig.Projection.Enabled {
+		return s.voteRepo.AppendVoteLogs(event)
+	}
+	return s.voteRepo.IncrementVotes(event)
+}
+
+// TicketAndVote 获取投票活动的票据并立即投票
+func (s *VoteService) TicketAndVote(ctx context.Context, pollID, clientID string, audit model.VoteAudit, usernames []string) (*model.VoteResponse, error) {
+	// 候选人不合法时不获取票据
+	if err := s.validateCandidates(pollID, usernames); err != nil {
+		return &model.VoteResponse{
+			Success:    false,
+			Message:    fmt.Sprintf("投票失败: %v", err),
+			Usernames:  usernames,
+			Timestamp:  time.Now(),
+			ReasonCode: VoteReasonCode(err),
+		}, nil
+	}
 
 	// 步骤1: 获取票据
-	ticket, err := s.ticketService.GetCurrentTicket(clientID)
+	ticket, err := s.ticketService.GetCurrentTicket(pollID, audit.Principal())
 	if err != nil {
 		return &model.VoteResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("获取票据失败: %v", err),
-			Usernames: usernames,
-			Timestamp: time.Now(),
+			Success:    false,
+			Message:    fmt.Sprintf("获取票据失败: %v", err),
+			Usernames:  usernames,
+			Timestamp:  time.Now(),
+			ReasonCode: VoteReasonCode(err),
 		}, nil
 	}
 
@@ -176,7 +550,9 @@ func (s *VoteService) TicketAndVote(usernames []string) (*model.VoteResponse, er
 	voteRequest := &model.VoteRequest{
 		Usernames: usernames,
 		Ticket:    *ticket,
+		ClientID:  clientID,
+		Audit:     audit,
 	}
 
-	return s.Vote(voteRequest)
+	return s.Vote(ctx, voteRequest)
 }
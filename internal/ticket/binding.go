@@ -0,0 +1,61 @@
+package ticket
+
+import (
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// bindHolder 客户端绑定模式下把票据绑定到获取它的调用方，返回的剩余使用次数不超过该调用方的配额
+// holder由服务端根据API密钥或客户端IP确定，客户端不能通过更换X-Client-ID冒充其他调用方或重复领取配额
+func (s *TicketService) bindHolder(policy *Policy, ticket *model.Ticket, holder string) error {
+	cfg := config.AppConfig.Ticket.ClientBinding
+	if !cfg.Enabled {
+		return nil
+	}
+	if holder == "" {
+		return fmt.Errorf("%w: 无法确定调用方", repository.ErrTicketNotHolder)
+	}
+
+	quota := cfg.MaxPerClient
+	if quota <= 0 {
+		quota = ticket.MaxUsages
+	}
+	if quota <= 0 {
+		quota = policy.MaxUsageCount
+	}
+	remaining, err := s.cacheRepo.BindTicketHolder(ticket.Version, holder, quota)
+	if err != nil {
+		return fmt.Errorf("获取票据失败: %w", err)
+	}
+
+	ticket.Holder = holder
+	if remaining < ticket.RemainingUsages {
+		ticket.RemainingUsages = remaining
+	}
+	if ticket.RemainingUsages <= 0 {
+		return fmt.Errorf("%w, 票据: %s", repository.ErrClientQuotaExhausted, ticket.Version)
+	}
+	return nil
+}
+
+// consumeHolder 客户端绑定模式下扣减客户端在票据上的一次使用次数，返回的函数用于在后续步骤失败时归还
+func (s *TicketService) consumeHolder(ticket *model.Ticket, requester Requester) (func(), error) {
+	if !config.AppConfig.Ticket.ClientBinding.Enabled {
+		return func() {}, nil
+	}
+	if ticket.Holder != "" && ticket.Holder != requester.Holder {
+		return nil, repository.ErrTicketNotHolder
+	}
+
+	if _, err := s.cacheRepo.AddTicketHolderUsage(ticket.Version, requester.Holder, -1); err != nil {
+		return nil, err
+	}
+	return func() {
+		if _, err := s.cacheRepo.AddTicketHolderUsage(ticket.Version, requester.Holder, 1); err != nil {
+			s.logger.Error("归还客户端在票据上的使用次数失败", "holder", requester.Holder, "version", ticket.Version, "error", err)
+		}
+	}, nil
+}
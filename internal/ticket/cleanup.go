@@ -0,0 +1,170 @@
+package ticket
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/lock"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// CleanupLockName 清理任务的选主锁，集群内同一时刻只有持有该锁的实例执行清理
+const CleanupLockName = "ticket:cleanup:lock"
+
+const (
+	defaultCleanupInterval  = time.Minute
+	defaultTicketRetention  = 10 * time.Minute
+	defaultCleanupBatchSize = 1000
+)
+
+// CleanupJob 定期清理tickets表中早已过期的票据，保持表和最新版本查询足够小
+// 所有实例都可以启动清理任务，每轮清理前通过分布式锁选出一个实例执行，票据生产者切换后清理不会中断
+type CleanupJob struct {
+	store    repository.Storage
+	locker   lock.Lock
+	logger   *slog.Logger
+	stopChan chan struct{}
+}
+
+// NewCleanupJob 创建清理任务，locker为nil时不选主，每轮都直接清理
+func NewCleanupJob(store repository.Storage, locker lock.Lock, logger *slog.Logger) *CleanupJob {
+	return &CleanupJob{
+		store:    store,
+		locker:   locker,
+		logger:   logging.Component(logger, "cleanup"),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start 启动定期清理
+func (j *CleanupJob) Start() {
+	interval := config.AppConfig.Cleanup.Interval
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				j.runAsLeader()
+			case <-j.stopChan:
+				j.logger.Info("过期票据清理任务已停止")
+				return
+			}
+		}
+	}()
+
+	j.logger.Info("过期票据清理任务已启动", "interval", interval)
+}
+
+// Stop 停止定期清理
+func (j *CleanupJob) Stop() {
+	close(j.stopChan)
+}
+
+// runAsLeader 获取到选主锁时执行一轮清理，锁被其他实例持有时跳过本轮
+func (j *CleanupJob) runAsLeader() {
+	if j.locker != nil {
+		handle, err := j.locker.AcquireLock(CleanupLockName, config.AppConfig.Ticket.LockTimeout)
+		if err != nil {
+			j.logger.Error("获取清理任务锁失败", "error", err)
+			return
+		}
+		if handle == nil {
+			return
+		}
+		defer func() {
+			if err := handle.Release(); err != nil {
+				j.logger.Error("释放清理任务锁失败", "error", err)
+			}
+		}()
+	}
+
+	if _, err := j.RunOnce(); err != nil {
+		j.logger.Error("清理过期票据失败", "error", err)
+	}
+}
+
+// RunOnce 按保留策略清理过期票据、投票幂等键和票据历史，返回清理的记录总数
+func (j *CleanupJob) RunOnce() (int64, error) {
+	retention := config.AppConfig.Cleanup.TicketRetention
+	if retention <= 0 {
+		retention = defaultTicketRetention
+	}
+
+	// 先清理票据，归档产生的历史记录再按历史保留策略清理
+	archive := config.AppConfig.Cleanup.Archive
+	tickets, err := j.purge("tickets", func(batchSize int) (int64, error) {
+		return j.store.PurgeExpiredTickets(time.Now().Add(-retention), batchSize, archive)
+	})
+	if err != nil {
+		return tickets, err
+	}
+
+	keys, err := j.purgeIdempotencyKeys()
+	if err != nil {
+		return tickets + keys, err
+	}
+
+	historyRetention := config.AppConfig.Cleanup.HistoryRetention
+	if historyRetention <= 0 {
+		return tickets + keys, nil
+	}
+	history, err := j.purge("ticket_history", func(batchSize int) (int64, error) {
+		return j.store.PurgeTicketHistory(time.Now().Add(-historyRetention), batchSize)
+	})
+	if err != nil {
+		return tickets + keys + history, err
+	}
+
+	// 票据利用率与票据历史使用相同的保留时长
+	stats, err := j.purge("ticket_stats", func(batchSize int) (int64, error) {
+		return j.store.PurgeTicketStats(time.Now().Add(-historyRetention), batchSize)
+	})
+	return tickets + keys + history + stats, err
+}
+
+// purgeIdempotencyKeys 按保留时长清理投票幂等键，未配置保留时长时不清理
+func (j *CleanupJob) purgeIdempotencyKeys() (int64, error) {
+	retention := config.AppConfig.Cleanup.IdempotencyRetention
+	if retention <= 0 {
+		return 0, nil
+	}
+	return j.purge("vote_idempotency_keys", func(batchSize int) (int64, error) {
+		return j.store.PurgeVoteIdempotencyKeys(time.Now().Add(-retention), batchSize)
+	})
+}
+
+// purge 分批执行清理直到没有更多可清理的记录，并记录清理指标
+func (j *CleanupJob) purge(table string, purgeBatch func(batchSize int) (int64, error)) (int64, error) {
+	batchSize := config.AppConfig.Cleanup.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCleanupBatchSize
+	}
+
+	var total int64
+	for {
+		purged, err := purgeBatch(batchSize)
+		total += purged
+		metrics.CleanupPurgedRows.WithLabelValues(table).Add(float64(purged))
+		if err != nil {
+			return total, fmt.Errorf("清理%s失败: %w", table, err)
+		}
+		if purged < int64(batchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		j.logger.Info("已清理过期记录", "table", table, "rows", total)
+	}
+	return total, nil
+}
@@ -0,0 +1,229 @@
+package ticket
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/lock"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// leadership 记录本实例持有票据生产者身份的状态
+type leadership struct {
+	mu      sync.Mutex
+	leading bool
+	since   time.Time
+
+	// 通过监听生产者锁观察到的持有者，非生产者实例据此更新状态
+	observedHolder string
+	observedAt     time.Time
+}
+
+// markAcquired 记录获得生产者锁，首次获得时输出选举事件，并续期共享的生产者信息，返回是否为首次获得
+func (s *TicketService) markAcquired() bool {
+	s.leader.mu.Lock()
+	defer s.leader.mu.Unlock()
+
+	now := time.Now()
+	acquired := !s.leader.leading
+	if acquired {
+		previous, err := s.cacheRepo.GetProducerInfo()
+		if err != nil {
+			s.logger.Warn("获取上一任票据生产者信息失败", "error", err)
+		}
+		if previous != nil && previous.InstanceID != s.instanceID {
+			metrics.ProducerTakeovers.Inc()
+			s.logger.Info("producer_election", "event", "takeover", "instance", s.instanceID, "previous", previous.InstanceID,
+				"previous_since", previous.Since.Format(time.RFC3339), "at", now.Format(time.RFC3339))
+		}
+
+		s.leader.leading = true
+		s.leader.since = now
+		metrics.ProducerAcquisitions.Inc()
+		metrics.ProducerIsLeader.Set(1)
+		s.logger.Info("producer_election", "event", "acquired", "instance", s.instanceID, "at", now.Format(time.RFC3339))
+	}
+
+	info := &model.ProducerInfo{
+		InstanceID: s.instanceID,
+		Since:      s.leader.since,
+		RenewedAt:  now,
+	}
+	if err := s.cacheRepo.SetProducerInfo(info, config.AppConfig.Ticket.LockTimeout); err != nil {
+		s.logger.Warn("续期票据生产者信息失败", "error", err)
+	}
+	return acquired
+}
+
+// markLost 记录生产者锁被其他实例持有
+func (s *TicketService) markLost() {
+	s.endLeadership("lost")
+}
+
+// markReleased 记录主动释放生产者身份，并清除共享的生产者信息
+func (s *TicketService) markReleased() {
+	if s.endLeadership("released") {
+		if err := s.cacheRepo.DeleteProducerInfo(s.instanceID); err != nil {
+			s.logger.Warn("清除票据生产者信息失败", "error", err)
+		}
+	}
+}
+
+// endLeadership 结束当前持有的生产者身份，返回之前是否持有
+func (s *TicketService) endLeadership(event string) bool {
+	s.leader.mu.Lock()
+	defer s.leader.mu.Unlock()
+
+	if !s.leader.leading {
+		return false
+	}
+
+	now := time.Now()
+	held := now.Sub(s.leader.since)
+	s.leader.leading = false
+	if event == "lost" {
+		metrics.ProducerLosses.Inc()
+	}
+	metrics.ProducerIsLeader.Set(0)
+	metrics.ProducerHoldDuration.Observe(held.Seconds())
+	s.logger.Info("producer_election", "event", event, "instance", s.instanceID, "at", now.Format(time.RFC3339), "held", held)
+	return true
+}
+
+// IsLeading 本实例当前是否持有票据生产者身份
+func (s *TicketService) IsLeading() bool {
+	s.leader.mu.Lock()
+	defer s.leader.mu.Unlock()
+	return s.leader.leading
+}
+
+// CurrentProducer 获取集群当前的票据生产者，没有生产者时返回nil
+func (s *TicketService) CurrentProducer() (*model.ProducerInfo, error) {
+	info, err := s.cacheRepo.GetProducerInfo()
+	if err != nil || info != nil {
+		return info, err
+	}
+
+	// 生产者尚未发布信息时，使用监听到的锁持有者
+	s.leader.mu.Lock()
+	defer s.leader.mu.Unlock()
+	instanceID, convErr := strconv.Atoi(s.leader.observedHolder)
+	if convErr != nil {
+		return nil, nil
+	}
+	return &model.ProducerInfo{
+		InstanceID: instanceID,
+		Since:      s.leader.observedAt,
+		RenewedAt:  s.leader.observedAt,
+	}, nil
+}
+
+// JoinElection 参与票据生产者选举并监听领导者变化，当选后开始生成票据，失去领导者身份后停止
+// 生产者实例宕机后其他实例自动当选，无需重启；onGained、onLost在本服务处理后调用，用于启停只在生产者上运行的任务
+// StopTicketProducer后让出领导者身份
+func (s *TicketService) JoinElection(election lock.Election, onGained, onLost func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-s.stopChan
+		cancel()
+	}()
+
+	if err := election.Observe(ctx, s.onProducerChange); err != nil {
+		s.logger.Warn("监听票据生产者变化失败", "error", err)
+	}
+	election.Run(ctx, func() {
+		s.startTerm()
+		onGained()
+	}, func() {
+		s.endTerm()
+		onLost()
+	})
+}
+
+// startTerm 开始担任票据生产者，维持生产者锁，首次获得锁时补齐缺失的票据
+func (s *TicketService) startTerm() {
+	s.mu.Lock()
+	if s.term != nil {
+		s.mu.Unlock()
+		return
+	}
+	term := make(chan struct{})
+	s.term = term
+	s.mu.Unlock()
+
+	s.isProducer.Store(true)
+	go s.maintainProducerLock(term)
+}
+
+// endTerm 结束担任票据生产者，不再生成票据并释放尚未使用的生产者锁
+func (s *TicketService) endTerm() {
+	s.mu.Lock()
+	term := s.term
+	s.term = nil
+	s.mu.Unlock()
+	if term == nil {
+		return
+	}
+
+	s.isProducer.Store(false)
+	close(term)
+	s.releasePendingProducerLock()
+	s.markReleased()
+}
+
+// onProducerChange 生产者变化时更新状态并立即刷新票据缓存
+func (s *TicketService) onProducerChange(holder string) {
+	s.leader.mu.Lock()
+	previous := s.leader.observedHolder
+	s.leader.observedHolder = holder
+	s.leader.observedAt = time.Now()
+	s.leader.mu.Unlock()
+
+	s.logger.Info("producer_election", "event", "changed", "instance", s.instanceID, "previous", previous, "current", holder,
+		"at", time.Now().Format(time.RFC3339))
+
+	if holder != "" {
+		s.refreshTicketCache()
+	}
+}
+
+// refreshTicketCache 以MySQL为准刷新Redis中各投票活动的最新票据，避免新生产者上任前读到过期缓存
+func (s *TicketService) refreshTicketCache() {
+	for _, pollID := range s.PollIDs() {
+		s.refreshPollTicketCache(pollID)
+	}
+}
+
+func (s *TicketService) refreshPollTicketCache(pollID string) {
+	version, err := s.ticketRepo.GetNewestTicketVersion(pollID)
+	if err != nil {
+		s.logger.Error("刷新票据缓存时获取最新票据版本失败", "poll_id", pollID, "error", err)
+		return
+	}
+	if version == "" {
+		return
+	}
+
+	// 版本号为等长的纳秒时间戳，可以直接按字符串比较新旧
+	cached, err := s.cacheRepo.GetNewestTicketVersion(pollID)
+	if err == nil && cached >= version {
+		return
+	}
+
+	ticket, err := s.ticketRepo.GetTicket(version)
+	if err != nil {
+		s.logger.Error("刷新票据缓存时获取票据失败", "poll_id", pollID, "version", version, "error", err)
+		return
+	}
+	if err := s.cacheRepo.CreateTicket(ticket); err != nil {
+		s.logger.Error("刷新票据缓存时写入Redis失败", "poll_id", pollID, "version", version, "error", err)
+		return
+	}
+	if err := s.cacheRepo.SetNewestTicketVersion(pollID, version); err != nil {
+		s.logger.Error("刷新票据缓存时更新最新版本失败", "poll_id", pollID, "version", version, "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package ticket
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+const (
+	defaultBruteForceWindow        = time.Minute
+	defaultBruteForceBlockDuration = 5 * time.Minute
+)
+
+// ErrClientBlocked 客户端票据校验失败次数过多，暂时禁止使用票据
+var ErrClientBlocked = errors.New("TICKET_BLOCKED: 票据校验失败次数过多，请稍后重试")
+
+// Requester 使用票据的客户端，客户端ID和IP分别统计票据校验失败次数，任一达到阈值都会被禁止
+type Requester struct {
+	ClientID string
+	SourceIP string
+	// Holder 客户端绑定模式下扣减配额的调用方，见model.VoteAudit.Principal
+	Holder string
+}
+
+// subjects 返回客户端参与失败计数的标识
+func (r Requester) subjects() []string {
+	var subjects []string
+	if r.ClientID != "" {
+		subjects = append(subjects, "client:"+r.ClientID)
+	}
+	if r.SourceIP != "" {
+		subjects = append(subjects, "ip:"+r.SourceIP)
+	}
+	return subjects
+}
+
+// checkBlocked 客户端仍在禁止名单中时返回ErrClientBlocked，查询失败时放行
+func (s *TicketService) checkBlocked(requester Requester) error {
+	if config.AppConfig.Ticket.BruteForce.MaxFailures <= 0 {
+		return nil
+	}
+	subjects := requester.subjects()
+	if len(subjects) == 0 {
+		return nil
+	}
+
+	ttl, err := s.cacheRepo.GetTicketBlockTTL(subjects...)
+	if err != nil {
+		s.logger.Warn("查询票据禁用状态失败，本次不拦截", "error", err)
+		return nil
+	}
+	if ttl > 0 {
+		return fmt.Errorf("%w, %s后解除", ErrClientBlocked, ttl.Round(time.Second))
+	}
+	return nil
+}
+
+// recordFailure 票据不存在或票据值不匹配时累计客户端的失败次数，达到阈值的标识加入禁止名单并推送事件
+// 票据过期、版本已轮换等正常客户端也会遇到的失败不计入
+func (s *TicketService) recordFailure(pollID string, requester Requester, err error) {
+	if !errors.Is(err, repository.ErrTicketInvalid) {
+		return
+	}
+	metrics.TicketValidationFailures.WithLabelValues(pollID).Inc()
+
+	cfg := config.AppConfig.Ticket.BruteForce
+	if cfg.MaxFailures <= 0 {
+		return
+	}
+	window := cfg.Window
+	if window <= 0 {
+		window = defaultBruteForceWindow
+	}
+	blockFor := cfg.BlockDuration
+	if blockFor <= 0 {
+		blockFor = defaultBruteForceBlockDuration
+	}
+
+	for _, subject := range requester.subjects() {
+		failures, blocked, err := s.cacheRepo.RecordTicketFailure(subject, window, cfg.MaxFailures, blockFor)
+		if err != nil {
+			s.logger.Warn("记录票据校验失败次数失败", "subject", subject, "error", err)
+			continue
+		}
+		if !blocked {
+			continue
+		}
+
+		kind, _, _ := strings.Cut(subject, ":")
+		metrics.TicketClientsBlocked.WithLabelValues(kind).Inc()
+		s.logger.Warn("票据校验失败次数过多，禁止使用票据", "subject", subject, "window", window, "failures", failures, "block_for", blockFor)
+		if s.notifier != nil {
+			s.notifier.NotifyTicketAbuse(&model.TicketAbuse{
+				PollID:       pollID,
+				ClientID:     requester.ClientID,
+				SourceIP:     requester.SourceIP,
+				Subject:      subject,
+				Failures:     failures,
+				BlockedUntil: time.Now().Add(blockFor),
+			})
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package ticket
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// checkInstanceQuota 本实例在当前票据上返回票据的次数达到ticket.instance_issue_quota后拒绝签发，票据轮换后重新计数
+// Redis不可用时只记录日志，不因配额拒绝签发
+func (s *TicketService) checkInstanceQuota(policy *Policy, ticket *model.Ticket) error {
+	quota := config.AppConfig.Ticket.InstanceIssueQuota
+	if quota <= 0 {
+		return nil
+	}
+
+	instanceID := config.AppConfig.Server.InstanceID
+	if _, err := s.cacheRepo.AddTicketIssued(ticket.Version, instanceID, quota); err != nil {
+		if errors.Is(err, repository.ErrInstanceQuotaExhausted) {
+			metrics.TicketInstanceQuotaRejections.WithLabelValues(policy.PollID).Inc()
+			return fmt.Errorf("%w, 实例: %d, 票据: %s", err, instanceID, ticket.Version)
+		}
+		s.logger.Warn("检查实例签发配额失败，本次不限制", "poll_id", policy.PollID, "error", err)
+	}
+	return nil
+}
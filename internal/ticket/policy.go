@@ -0,0 +1,218 @@
+package ticket
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// ErrPollNotStarted 投票活动尚未到开始时间
+var ErrPollNotStarted = errors.New("POLL_NOT_STARTED: 投票活动尚未开始")
+
+// defaultPollSyncInterval 从数据库同步投票活动的默认间隔
+const defaultPollSyncInterval = 10 * time.Second
+
+// Policy 单个投票活动的票据策略
+type Policy struct {
+	PollID            string
+	MaxUsageCount     int           // 每张票据的最大使用次数
+	RefreshInterval   time.Duration // 票据轮换间隔
+	TotalBudget       int           // 整个活动可发放的票据使用次数上限，0表示不限制
+	LowUsageThreshold int           // 当前票据剩余使用次数降到该值以下时发出预警，0表示不预警
+	Poll              *model.Poll   // 投票活动的定义，只在配置文件中配置的活动为nil
+	shadow            atomic.Bool   // 影子模式，可在运行时开启或关闭
+}
+
+// newPolicy 按生效的配置生成投票活动的票据策略，ticket.polls中未配置的字段继承全局票据配置
+func newPolicy(pollID string) *Policy {
+	global := config.Current().Ticket
+	policy := &Policy{
+		PollID:            pollID,
+		MaxUsageCount:     global.MaxUsageCount,
+		RefreshInterval:   global.RefreshInterval,
+		LowUsageThreshold: global.LowUsageThreshold,
+	}
+
+	pollConfig, ok := global.Polls[pollID]
+	if !ok {
+		return policy
+	}
+	policy.TotalBudget = pollConfig.TotalBudget
+	policy.shadow.Store(pollConfig.Shadow)
+	if pollConfig.MaxUsageCount > 0 {
+		policy.MaxUsageCount = pollConfig.MaxUsageCount
+	}
+	if pollConfig.RefreshInterval > 0 {
+		policy.RefreshInterval = pollConfig.RefreshInterval
+	}
+	if pollConfig.LowUsageThreshold > 0 {
+		policy.LowUsageThreshold = pollConfig.LowUsageThreshold
+	}
+	return policy
+}
+
+// loadPolicies 从配置加载各投票活动的票据策略，数据库中的投票活动在启动后同步
+func loadPolicies() map[string]*Policy {
+	policies := map[string]*Policy{
+		model.DefaultPollID: newPolicy(model.DefaultPollID),
+	}
+	for pollID := range config.AppConfig.Ticket.Polls {
+		policies[pollID] = newPolicy(pollID)
+	}
+	return policies
+}
+
+// checkWindow 投票活动未到开始时间时返回ErrPollNotStarted，已过结束时间时返回repository.ErrPollClosed
+func (p *Policy) checkWindow(now time.Time) error {
+	if p.Poll == nil {
+		return nil
+	}
+	if p.Poll.StartsAt != nil && now.Before(*p.Poll.StartsAt) {
+		return fmt.Errorf("%w, 开始时间: %s", ErrPollNotStarted, p.Poll.StartsAt.Format(time.RFC3339))
+	}
+	if p.Poll.EndsAt != nil && !now.Before(*p.Poll.EndsAt) {
+		return fmt.Errorf("%w, 结束时间: %s", repository.ErrPollClosed, p.Poll.EndsAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Shadow 投票活动是否处于影子模式，影子模式下的投票只记录日志，不计入票数
+func (p *Policy) Shadow() bool {
+	return p.shadow.Load()
+}
+
+// Policy 获取投票活动的票据策略
+func (s *TicketService) Policy(pollID string) (*Policy, bool) {
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	policy, ok := s.policies[pollID]
+	return policy, ok
+}
+
+// PollIDs 返回配置了票据策略的所有投票活动
+func (s *TicketService) PollIDs() []string {
+	s.mu.RLock()
+	pollIDs := make([]string, 0, len(s.policies))
+	for pollID := range s.policies {
+		pollIDs = append(pollIDs, pollID)
+	}
+	s.mu.RUnlock()
+	sort.Strings(pollIDs)
+	return pollIDs
+}
+
+// policyList 返回所有投票活动的票据策略
+func (s *TicketService) policyList() []*Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	policies := make([]*Policy, 0, len(s.policies))
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// RegisterPoll 为投票活动登记票据策略，票据生成器已启动时新活动立即开始签发票据
+func (s *TicketService) RegisterPoll(poll *model.Poll) {
+	s.mu.Lock()
+	existing, ok := s.policies[poll.ID]
+	if ok && existing.Poll != nil {
+		// 投票活动创建后只有影子模式可以修改
+		if existing.Shadow() != poll.Shadow {
+			existing.shadow.Store(poll.Shadow)
+			if poll.Shadow {
+				s.logger.Info("投票活动已开启影子模式，投票不再计入票数", "poll_id", poll.ID)
+			} else {
+				s.logger.Info("投票活动已关闭影子模式，投票开始计入票数", "poll_id", poll.ID)
+			}
+		}
+		s.mu.Unlock()
+		return
+	}
+	policy := newPolicy(poll.ID)
+	policy.Poll = poll
+	policy.shadow.Store(poll.Shadow)
+	s.policies[poll.ID] = policy
+	started := s.started
+	s.mu.Unlock()
+
+	// 配置文件中已有的活动沿用原有的票据生成协程
+	if ok || !started {
+		return
+	}
+	s.logger.Info("投票活动已登记，开始签发票据", "poll_id", poll.ID)
+	go s.runPollProducer(policy)
+	if s.isProducer.Load() {
+		s.catchUp(policy)
+	}
+}
+
+// syncPolls 从数据库加载投票活动并登记票据策略，其他实例创建的活动在下一次同步后开始签发票据
+func (s *TicketService) syncPolls() {
+	polls, err := s.ticketRepo.ListPolls()
+	if err != nil {
+		s.logger.Error("同步投票活动失败", "error", err)
+		return
+	}
+	for _, poll := range polls {
+		s.RegisterPoll(poll)
+	}
+}
+
+// runPollSync 按ticket.poll_sync_interval定期同步投票活动
+func (s *TicketService) runPollSync() {
+	interval := config.AppConfig.Ticket.PollSyncInterval
+	if interval <= 0 {
+		interval = defaultPollSyncInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.syncPolls()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// producerLockName 投票活动的票据生产锁，默认活动沿用原有锁名
+func producerLockName(pollID string) string {
+	if pollID == model.DefaultPollID {
+		return TicketProducerLockName
+	}
+	return TicketProducerLockName + ":" + pollID
+}
+
+// ClosePoll 结束投票活动，该活动的票据立即失效且不再生成新票据
+func (s *TicketService) ClosePoll(pollID string) error {
+	if _, ok := s.Policy(pollID); !ok {
+		return fmt.Errorf("投票活动 %s 不存在", pollID)
+	}
+	return s.cacheRepo.ClosePoll(pollID)
+}
+
+// restoreClosedPolls 以MySQL中的定稿记录为准重新结束投票活动，避免Redis数据丢失后重新签发票据
+func (s *TicketService) restoreClosedPolls() {
+	pollIDs, err := s.ticketRepo.ListFinalizedPollIDs()
+	if err != nil {
+		s.logger.Error("查询已定稿的投票活动失败", "error", err)
+		return
+	}
+	for _, pollID := range pollIDs {
+		if err := s.cacheRepo.ClosePoll(pollID); err != nil {
+			s.logger.Error("关闭已定稿的投票活动失败", "poll_id", pollID, "error", err)
+		}
+	}
+}
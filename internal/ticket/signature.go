@@ -0,0 +1,60 @@
+package ticket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// signatureLength 票据值末尾十六进制签名的长度
+const signatureLength = sha256.Size * 2
+
+// signTicketValue 在随机票据值后附加签名，签名覆盖投票活动、版本、随机值和有效期，未配置密钥时原样返回
+// 签名同样是十六进制，客户端无需区分签名和随机值，原样回传即可
+func signTicketValue(ticket *model.Ticket) string {
+	secret := config.AppConfig.Ticket.SigningSecret
+	if secret == "" {
+		return ticket.Value
+	}
+	return ticket.Value + hex.EncodeToString(ticketSignature(secret, ticket, ticket.Value))
+}
+
+// verifySignature 校验客户端提交的票据签名，未配置密钥时不校验
+// 签名不匹配按票据无效处理，计入客户端的校验失败次数
+func verifySignature(ticket *model.Ticket) error {
+	secret := config.AppConfig.Ticket.SigningSecret
+	if secret == "" {
+		return nil
+	}
+
+	if len(ticket.Value) <= signatureLength {
+		return fmt.Errorf("%w: 缺少签名", repository.ErrTicketInvalid)
+	}
+	split := len(ticket.Value) - signatureLength
+	signature, err := hex.DecodeString(ticket.Value[split:])
+	if err != nil {
+		return fmt.Errorf("%w: 签名格式错误", repository.ErrTicketInvalid)
+	}
+	if !hmac.Equal(signature, ticketSignature(secret, ticket, ticket.Value[:split])) {
+		return fmt.Errorf("%w: 签名不匹配", repository.ErrTicketInvalid)
+	}
+	return nil
+}
+
+// ticketSignature 签名内容: pollId|version|随机值|createdAt|expiresAt，时间精确到秒以匹配RFC3339
+func ticketSignature(secret string, ticket *model.Ticket, nonce string) []byte {
+	pollID := ticket.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(pollID + "|" + ticket.Version + "|" + nonce + "|" +
+		strconv.FormatInt(ticket.CreatedAt.Unix(), 10) + "|" + strconv.FormatInt(ticket.ExpiresAt.Unix(), 10)))
+	return mac.Sum(nil)
+}
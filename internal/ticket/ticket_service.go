@@ -3,12 +3,17 @@ package ticket
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lvdashuaibi/littlevote/config"
 	"github.com/lvdashuaibi/littlevote/internal/lock"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
 	"github.com/lvdashuaibi/littlevote/internal/model"
 	"github.com/lvdashuaibi/littlevote/internal/repository"
 )
@@ -18,69 +23,155 @@ const (
 )
 
 type TicketService struct {
-	redisRepo      *repository.RedisRepository
-	mysqlRepo      *repository.MySQLRepository
+	cacheRepo      repository.CacheRepository
+	ticketRepo     repository.TicketRepository
 	redlock        lock.Lock
-	refreshTicker  *time.Ticker
 	stopChan       chan struct{}
-	maxUsageCount  int
-	isProducer     bool          // 标识该实例是否为票据生产者
-	producerLockCh chan struct{} // 用于同步获取生产者锁的通道
+	mu             sync.RWMutex
+	policies       map[string]*Policy // 各投票活动的票据策略，创建投票活动时增加
+	reloaded       chan struct{}      // 票据配置热加载时关闭并替换，通知票据生成协程重置定时器
+	started        bool               // 票据生成器是否已启动，之后登记的活动需要单独启动生成协程
+	isProducer     atomic.Bool        // 标识该实例是否为票据生产者，参与选举时随领导者身份变化
+	term           chan struct{}      // 本次担任生产者期间维持生产者锁的协程的停止信号，不是生产者时为nil
+	producerLockCh chan producerLock  // 传递maintainProducerLock获取到的生产者锁
+	instanceID     int
+	leader         leadership      // 生产者身份状态，用于选举观测
+	notifier       WarningNotifier // 票据预警和滥用事件的推送渠道，未设置时只更新指标
+	logger         *slog.Logger
 }
 
+// producerLock 生产者锁及获取时的防护令牌，生成的票据带上令牌，保存时拒绝锁已过期的旧生产者
+type producerLock struct {
+	handle lock.LockHandle
+	token  int64
+}
+
+// WarningNotifier 推送票据即将耗尽的预警和疑似穷举票据值的客户端，实现方不能阻塞调用方
+type WarningNotifier interface {
+	NotifyTicketLowUsage(warning *model.TicketWarning)
+	NotifyTicketAbuse(abuse *model.TicketAbuse)
+}
+
+// SetWarningNotifier 设置票据预警和滥用事件的推送渠道，需要在处理投票之前调用
+func (s *TicketService) SetWarningNotifier(notifier WarningNotifier) {
+	s.notifier = notifier
+}
+
+// NewTicketService 创建票据服务，存储通过接口注入，生产环境传入RedisRepository和MySQLRepository
 func NewTicketService(
-	redisRepo *repository.RedisRepository,
-	mysqlRepo *repository.MySQLRepository,
+	cacheRepo repository.CacheRepository,
+	ticketRepo repository.TicketRepository,
 	distributedLock lock.Lock,
 	isProducer bool,
+	logger *slog.Logger,
 ) *TicketService {
-	return &TicketService{
-		redisRepo:      redisRepo,
-		mysqlRepo:      mysqlRepo,
+	s := &TicketService{
+		cacheRepo:      cacheRepo,
+		ticketRepo:     ticketRepo,
 		redlock:        distributedLock,
 		stopChan:       make(chan struct{}),
-		maxUsageCount:  config.AppConfig.Ticket.MaxUsageCount,
-		isProducer:     isProducer,
-		producerLockCh: make(chan struct{}, 1),
+		policies:       loadPolicies(),
+		reloaded:       make(chan struct{}),
+		producerLockCh: make(chan producerLock, 1),
+		instanceID:     config.AppConfig.Server.InstanceID,
+		logger:         logging.Component(logger, "ticket"),
 	}
+	s.isProducer.Store(isProducer)
+	return s
 }
 
-// StartTicketProducer 启动票据生成器
+// StartTicketProducer 启动票据生成器，每个投票活动按各自的刷新间隔生成票据
 func (s *TicketService) StartTicketProducer() {
-	refreshInterval := config.AppConfig.Ticket.RefreshInterval
+	s.restoreClosedPolls()
+	s.syncPolls()
 
-	// 如果不是生产者，仍然启动定时器但不会真正生成票据
-	s.refreshTicker = time.NewTicker(refreshInterval)
+	// 启动时立即生成首张票据，服务开始监听前票据已经可用
+	if s.isProducer.Load() {
+		s.generateInitialTickets()
+	}
+
+	s.mu.Lock()
+	s.started = true
+	s.mu.Unlock()
+	for _, policy := range s.policyList() {
+		go s.runPollProducer(policy)
+	}
+	go s.runPollSync()
+
+	// 启动另一个协程检查生产者状态
+	if s.isProducer.Load() {
+		s.startTerm()
+	}
+}
+
+// ReloadConfig 配置热加载的回调，按新的票据配置重建各投票活动的策略并重置票据生成的定时器
+// 新的使用次数从下一张票据开始生效，已签发的票据不变
+func (s *TicketService) ReloadConfig(prev, next *config.Config) {
+	if prev.Ticket.RefreshInterval == next.Ticket.RefreshInterval &&
+		prev.Ticket.MaxUsageCount == next.Ticket.MaxUsageCount {
+		return
+	}
 
-	go func() {
+	s.mu.Lock()
+	for pollID, policy := range s.policies {
+		updated := newPolicy(pollID)
+		updated.Poll = policy.Poll
+		updated.shadow.Store(policy.Shadow())
+		s.policies[pollID] = updated
+	}
+	close(s.reloaded)
+	s.reloaded = make(chan struct{})
+	s.mu.Unlock()
+
+	s.logger.Info("票据配置已修改", "refresh_interval", next.Ticket.RefreshInterval,
+		"max_usage_count", next.Ticket.MaxUsageCount)
+}
 
-		for {
-			select {
-			case <-s.refreshTicker.C:
-				// 只有被指定为生产者的实例才尝试竞争锁并生成票据
-				if s.isProducer {
-					s.refreshTicket()
+// reloadSignal 返回配置热加载时关闭的通道
+func (s *TicketService) reloadSignal() <-chan struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.reloaded
+}
+
+// runPollProducer 按投票活动的刷新间隔生成票据
+func (s *TicketService) runPollProducer(policy *Policy) {
+	reloaded := s.reloadSignal()
+	// 如果不是生产者，仍然启动定时器但不会真正生成票据
+	refreshTicker := time.NewTicker(policy.RefreshInterval)
+	defer refreshTicker.Stop()
+
+	for {
+		select {
+		case <-reloaded:
+			// 刷新间隔可能已修改，按最新的策略重置定时器
+			reloaded = s.reloadSignal()
+			if current, ok := s.Policy(policy.PollID); ok {
+				if current.RefreshInterval != policy.RefreshInterval {
+					refreshTicker.Reset(current.RefreshInterval)
 				}
-			case <-s.stopChan:
-				s.refreshTicker.Stop()
-				log.Println("票据生成器已停止")
-				return
+				policy = current
 			}
+		case <-refreshTicker.C:
+			// 只有被指定为生产者的实例才尝试竞争锁并生成票据，策略可能已随投票活动同步更新
+			if s.isProducer.Load() {
+				if current, ok := s.Policy(policy.PollID); ok {
+					policy = current
+				}
+				s.refreshTicket(policy)
+			}
+		case <-s.stopChan:
+			s.logger.Info("投票活动的票据生成器已停止", "poll_id", policy.PollID)
+			return
 		}
-	}()
-
-	// 启动另一个协程检查生产者状态
-	if s.isProducer {
-		go s.maintainProducerLock()
 	}
-
-	//log.Printf("票据生成器已启动，刷新间隔: %v, 生产者模式: %v", refreshInterval, s.isProducer)
 }
 
-// maintainProducerLock 维持生产者锁状态
-func (s *TicketService) maintainProducerLock() {
+// maintainProducerLock 维持生产者锁状态，term关闭时停止
+func (s *TicketService) maintainProducerLock(term <-chan struct{}) {
 	// 每隔一半的刷新间隔检查一次生产者状态
-	checkInterval := config.AppConfig.Ticket.RefreshInterval / 2
+	reloaded := s.reloadSignal()
+	checkInterval := config.Current().Ticket.RefreshInterval / 2
 	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop()
 
@@ -89,8 +180,16 @@ func (s *TicketService) maintainProducerLock() {
 
 	for {
 		select {
+		case <-reloaded:
+			reloaded = s.reloadSignal()
+			if interval := config.Current().Ticket.RefreshInterval / 2; interval != checkInterval {
+				checkInterval = interval
+				ticker.Reset(checkInterval)
+			}
 		case <-ticker.C:
 			s.tryAcquireProducerLock()
+		case <-term:
+			return
 		case <-s.stopChan:
 			return
 		}
@@ -99,23 +198,36 @@ func (s *TicketService) maintainProducerLock() {
 
 // tryAcquireProducerLock 尝试获取生产者锁
 func (s *TicketService) tryAcquireProducerLock() {
+	// 锁节点不足多数时不尝试成为生产者
+	if checker, ok := s.redlock.(lock.QuorumChecker); ok && !checker.HasQuorum() {
+		s.logger.Warn("锁节点不足多数，跳过获取票据生成器锁")
+		return
+	}
+
 	// 检查生产者锁是否仍然持有
-	acquired, err := s.redlock.AcquireLock(TicketProducerLockName, config.AppConfig.Ticket.LockTimeout)
+	handle, token, err := s.redlock.AcquireLockWithToken(TicketProducerLockName, config.AppConfig.Ticket.LockTimeout)
 	if err != nil {
-		log.Printf("检查票据生成器锁失败: %v", err)
+		s.logger.Error("检查票据生成器锁失败", "error", err)
 		return
 	}
 
 	// 如果成功获取锁，说明之前的锁已经过期或释放
-	if acquired {
-		//log.Println("重新获取票据生成器锁成功")
-		// 继续保持生产者模式
-		s.isProducer = true
+	if handle != nil {
+		newlyAcquired := s.markAcquired()
 
-		// 通知刷新票据的协程
+		// 将锁交给刷新票据的协程，由其在生成票据后释放
 		select {
-		case s.producerLockCh <- struct{}{}:
+		case s.producerLockCh <- producerLock{handle: handle, token: token}:
 		default:
+			// 已有未使用的锁，释放本次获取的锁
+			if err := handle.Release(); err != nil {
+				s.logger.Error("释放票据生成器锁失败", "error", err)
+			}
+		}
+
+		// 刚成为生产者时补齐缺失的票据
+		if newlyAcquired {
+			go s.catchUpAll()
 		}
 	}
 }
@@ -123,170 +235,564 @@ func (s *TicketService) tryAcquireProducerLock() {
 // StopTicketProducer 停止票据生成器
 func (s *TicketService) StopTicketProducer() {
 	close(s.stopChan)
-	// 释放生产者锁
-	if s.isProducer {
-		s.redlock.ReleaseLock(TicketProducerLockName)
+	// 释放尚未交给刷新协程的生产者锁
+	s.releasePendingProducerLock()
+	s.markReleased()
+}
+
+// releasePendingProducerLock 释放maintainProducerLock获取后尚未交给刷新协程的生产者锁
+func (s *TicketService) releasePendingProducerLock() {
+	select {
+	case held := <-s.producerLockCh:
+		held.handle.Release()
+	default:
 	}
 }
 
-// refreshTicket 刷新票据
-func (s *TicketService) refreshTicket() {
-	var lockAcquired bool
+// refreshTicket 刷新投票活动的票据
+func (s *TicketService) refreshTicket(policy *Policy) {
+	var held producerLock
 	var err error
+	lockName := producerLockName(policy.PollID)
+	isDefaultPoll := policy.PollID == model.DefaultPollID
 
-	// 检查producerLockCh是否有信号
-	select {
-	case <-s.producerLockCh:
-		// 已在maintainProducerLock中获取了锁
-		lockAcquired = true
-	default:
+	// producerLockCh中的锁只对应默认活动，已在maintainProducerLock中获取
+	if isDefaultPoll {
+		select {
+		case held = <-s.producerLockCh:
+		default:
+		}
+	}
+
+	if held.handle == nil {
 		// 尝试获取分布式锁，锁定整个刷新过程
-		lockAcquired, err = s.redlock.AcquireLock(TicketProducerLockName, config.AppConfig.Ticket.LockTimeout)
+		held.handle, held.token, err = s.redlock.AcquireLockWithToken(lockName, config.AppConfig.Ticket.LockTimeout)
 		if err != nil {
-			log.Printf("获取票据生成器锁失败: %v", err)
+			s.logger.Error("获取票据生成器锁失败", "poll_id", policy.PollID, "error", err)
 			return
 		}
 	}
 
-	if !lockAcquired {
-		log.Println("未能获取票据生成器锁，跳过当前刷新")
+	if held.handle == nil {
+		s.logger.Debug("未能获取票据生成器锁，跳过当前刷新", "poll_id", policy.PollID)
+		if isDefaultPoll {
+			s.markLost()
+		}
 		return
 	}
+	if isDefaultPoll {
+		s.markAcquired()
+	}
 
 	// 先执行票据生成逻辑
-	s.generateTicket()
+	s.generateTicket(policy, held.token)
 
 	// 函数结束时释放锁
-	if err := s.redlock.ReleaseLock(TicketProducerLockName); err != nil {
-		log.Printf("释放票据生成器锁失败: %v", err)
+	if err := held.handle.Release(); err != nil {
+		s.logger.Error("释放票据生成器锁失败", "poll_id", policy.PollID, "error", err)
+	}
+}
+
+// ErrProducerBusy 票据生成器锁被占用，票据生产者正在刷新或已预先获取了锁
+var ErrProducerBusy = errors.New("票据生成器锁被占用")
+
+// ProduceTicket 立即为投票活动签发一张新票据并设为最新版本，用于produce-ticket子命令手动轮换票据（如票据值泄露）
+// 与票据生产者竞争同一把锁，锁被占用时返回ErrProducerBusy；旧票据与正常轮换一样在过期前仍然有效
+func (s *TicketService) ProduceTicket(pollID string) (string, error) {
+	s.syncPolls()
+	policy, ok := s.Policy(pollID)
+	if !ok {
+		return "", fmt.Errorf("投票活动 %s 不存在", pollID)
+	}
+
+	handle, token, err := s.redlock.AcquireLockWithToken(producerLockName(policy.PollID), config.AppConfig.Ticket.LockTimeout)
+	if err != nil {
+		return "", fmt.Errorf("获取票据生成器锁失败: %w", err)
+	}
+	if handle == nil {
+		return "", ErrProducerBusy
+	}
+	defer func() {
+		if err := handle.Release(); err != nil {
+			s.logger.Error("释放票据生成器锁失败", "poll_id", policy.PollID, "error", err)
+		}
+	}()
+
+	previous, _ := s.cacheRepo.GetNewestTicketVersion(policy.PollID)
+	s.generateTicket(policy, token)
+	version, err := s.cacheRepo.GetNewestTicketVersion(policy.PollID)
+	if err != nil {
+		return "", fmt.Errorf("查询最新票据版本失败: %w", err)
+	}
+	if version == previous || version == repository.PollClosedVersion {
+		return "", fmt.Errorf("投票活动 %s 未签发新票据（活动已结束、不在投票时间内或票据预算已用完），原因见日志", policy.PollID)
 	}
+	return version, nil
 }
 
-// generateTicket 生成新票据，不包含锁逻辑
-func (s *TicketService) generateTicket() {
-	// 生成新票据
-	version := s.generateVersion()
-	ticketValue := s.generateTicketValue()
+// generateTicket 按投票活动的策略生成新票据，不包含锁逻辑，token为调用方持有的生产者锁的防护令牌
+func (s *TicketService) generateTicket(policy *Policy, token int64) {
+	// 已结束的投票活动不再生成票据
+	previousVersion, err := s.cacheRepo.GetNewestTicketVersion(policy.PollID)
+	if err == nil && previousVersion == repository.PollClosedVersion {
+		return
+	}
+
+	// 未到开始时间的投票活动暂不生成票据，已过结束时间的活动自动结束
+	if err := policy.checkWindow(time.Now()); err != nil {
+		if errors.Is(err, repository.ErrPollClosed) {
+			s.logger.Info("投票活动已过结束时间，不再签发票据", "poll_id", policy.PollID)
+			if err := s.cacheRepo.ClosePoll(policy.PollID); err != nil {
+				s.logger.Error("结束投票活动失败", "poll_id", policy.PollID, "error", err)
+			}
+		}
+		return
+	}
+
+	// 票据流水线模式下优先启用上次轮换时预生成的票据，只需切换最新版本
 	now := time.Now()
-	expiresAt := now.Add(config.AppConfig.Ticket.RefreshInterval)
+	pipeline := config.AppConfig.Ticket.Pipeline.Enabled
+	var ticket *model.Ticket
+	if pipeline {
+		ticket = s.takePendingTicket(policy, now, token)
+	}
+	if ticket == nil {
+		if ticket = s.issueTicket(policy, now, token); ticket == nil {
+			return
+		}
+	}
+
+	// 更新Redis中的最新票据版本
+	if err := s.cacheRepo.SetNewestTicketVersion(policy.PollID, ticket.Version); err != nil {
+		s.logger.Error("设置Redis最新票据版本失败", "poll_id", policy.PollID, "version", ticket.Version, "error", err)
+		// Redis更新失败不影响整体流程，但记录日志
+		return
+	}
+
+	if err := s.ticketRepo.SaveTicketStats(ticket); err != nil {
+		s.logger.Warn("保存票据统计失败", "version", ticket.Version, "error", err)
+	}
+	// 票据历史保留已签发的每一张票据，票据过期并从tickets表清理后仍可追溯
+	if err := s.ticketRepo.SaveTicketHistory(&model.TicketHistory{
+		Version:     ticket.Version,
+		TicketValue: ticket.Value,
+		CreatedAt:   ticket.CreatedAt,
+		ExpiredAt:   ticket.ExpiresAt,
+	}); err != nil {
+		s.logger.Warn("保存票据历史失败", "version", ticket.Version, "error", err)
+	}
+
+	// 票据生效后记录签发的使用次数，用于统计票据利用率
+	if err := s.cacheRepo.RecordTicketsIssued(policy.PollID, ticket.RemainingUsages); err != nil {
+		s.logger.Warn("记录签发的票据使用次数失败", "poll_id", policy.PollID, "error", err)
+	}
+
+	// 上一张票据已被替换，记录其实际消耗的使用次数
+	if previousVersion != "" {
+		s.recordConsumption(previousVersion, now)
+	}
+
+	// 预生成下一张票据，在本张票据过期时生效
+	if pipeline {
+		if next := s.issueTicket(policy, ticket.ExpiresAt, token); next != nil {
+			if err := s.cacheRepo.SetPendingTicketVersion(policy.PollID, next.Version); err != nil {
+				s.logger.Warn("记录预生成的票据失败", "poll_id", policy.PollID, "version", next.Version, "error", err)
+			}
+		}
+	}
+}
+
+// issueTicket 按投票活动的策略生成一张在activatesAt生效的票据，保存到MySQL和Redis，失败时返回nil
+// token小于已保存票据的防护令牌时MySQL拒绝写入，说明本实例的生产者锁已过期
+func (s *TicketService) issueTicket(policy *Policy, activatesAt time.Time, token int64) *model.Ticket {
+	// 有总预算的活动需要先从预算中申请本张票据的使用次数
+	usages := policy.MaxUsageCount
+	if policy.TotalBudget > 0 {
+		granted, err := s.cacheRepo.ReserveTicketBudget(policy.PollID, usages, policy.TotalBudget)
+		if err != nil {
+			s.logger.Error("申请投票活动的票据预算失败", "poll_id", policy.PollID, "error", err)
+			return nil
+		}
+		if granted == 0 {
+			s.logger.Warn("投票活动的票据预算已用完，停止生成票据", "poll_id", policy.PollID)
+			return nil
+		}
+		usages = granted
+	}
 
 	// 创建票据
 	ticket := &model.Ticket{
-		Value:           ticketValue,
-		Version:         version,
-		RemainingUsages: s.maxUsageCount,
-		ExpiresAt:       expiresAt,
-		CreatedAt:       now,
+		PollID:          policy.PollID,
+		Value:           s.generateTicketValue(),
+		Version:         s.generateVersion(),
+		RemainingUsages: usages,
+		ExpiresAt:       activatesAt.Add(policy.RefreshInterval),
+		CreatedAt:       activatesAt,
+		FencingToken:    token,
+		MaxUsages:       usages,
 	}
+	ticket.Value = signTicketValue(ticket)
 
 	// 首先保存票据到MySQL（作为主数据源）
-	if err := s.mysqlRepo.SaveTicket(ticket); err != nil {
-		log.Printf("保存票据到MySQL失败: %v", err)
-		return // 如果MySQL保存失败，不继续执行
+	if err := s.saveTicket(ticket); err != nil {
+		return nil // 如果MySQL保存失败，不继续执行
 	}
 
 	// MySQL保存成功后，同步到Redis（作为缓存）
-	if err := s.redisRepo.CreateTicket(ticket); err != nil {
-		log.Printf("保存票据到Redis失败: %v", err)
+	if err := s.cacheRepo.CreateTicket(ticket); err != nil {
+		s.logger.Warn("保存票据到Redis失败", "version", ticket.Version, "error", err)
 		// Redis保存失败不影响整体流程，但记录日志
 	}
+	return ticket
+}
 
-	// 更新Redis中的最新票据版本
-	if err := s.redisRepo.SetNewestTicketVersion(version); err != nil {
-		log.Printf("设置Redis最新票据版本失败: %v", err)
-		// Redis更新失败不影响整体流程，但记录日志
+// saveTicket 保存票据到MySQL，防护令牌过期时只记录警告，由下一个持有锁的生产者继续生成
+func (s *TicketService) saveTicket(ticket *model.Ticket) error {
+	err := s.ticketRepo.SaveTicket(ticket)
+	if errors.Is(err, repository.ErrStaleFencingToken) {
+		s.logger.Warn("生产者锁已过期，放弃写入票据", "poll_id", ticket.PollID, "version", ticket.Version, "fencing_token", ticket.FencingToken, "error", err)
+	} else if err != nil {
+		s.logger.Error("保存票据到MySQL失败", "poll_id", ticket.PollID, "error", err)
 	}
-
-	//log.Printf("已生成新票据: 版本=%s, 过期时间=%v", version, expiresAt)
+	return err
 }
 
-// GetCurrentTicket 获取当前票据
-func (s *TicketService) GetCurrentTicket(clientID string) (*model.Ticket, error) {
-	// 优先从Redis获取最新票据版本
-	version, err := s.redisRepo.GetNewestTicketVersion()
-	// if err != nil || version == "" {
-	// 	// Redis获取失败或无版本，尝试从MySQL获取
-	// 	log.Printf("从Redis获取最新票据版本失败: %v，尝试从MySQL获取", err)
-	// 	mysqlVersion, mysqlErr := s.mysqlRepo.GetNewestTicketVersion()
-	// 	if mysqlErr != nil {
-	// 		return nil, fmt.Errorf("获取最新票据版本失败: %w", mysqlErr)
-	// 	}
+// takePendingTicket 取出投票活动预生成的票据，没有或已过期时返回nil，由调用方立即生成新票据
+// 票据重新写入Redis以延长保留时长，预生成期间Redis中的票据可能已超过cache.ticket_ttl，此时从MySQL读取
+// 启用前以本次的防护令牌重新写入MySQL，锁已过期的旧生产者不能启用预生成的票据
+func (s *TicketService) takePendingTicket(policy *Policy, now time.Time, token int64) *model.Ticket {
+	version, err := s.cacheRepo.GetPendingTicketVersion(policy.PollID)
+	if err != nil {
+		s.logger.Warn("获取预生成的票据版本失败", "poll_id", policy.PollID, "error", err)
+		return nil
+	}
+	if version == "" {
+		return nil
+	}
 
-	// 	if mysqlVersion == "" {
-	// 		return nil, fmt.Errorf("票据尚未生成")
-	// 	}
+	ticket, err := s.cacheRepo.GetTicket(version)
+	if err != nil {
+		if ticket, err = s.ticketRepo.GetTicket(version); err != nil {
+			s.logger.Warn("获取预生成的票据失败", "poll_id", policy.PollID, "version", version, "error", err)
+			return nil
+		}
+	}
+	if !now.Before(ticket.ExpiresAt) {
+		s.logger.Info("预生成的票据已过期，重新生成", "poll_id", policy.PollID, "version", version)
+		return nil
+	}
+	ticket.FencingToken = token
+	if err := s.saveTicket(ticket); err != nil {
+		return nil
+	}
+	if err := s.cacheRepo.CreateTicket(ticket); err != nil {
+		s.logger.Warn("保存票据到Redis失败", "version", ticket.Version, "error", err)
+	}
+	return ticket
+}
 
-	// 	// 更新Redis中的最新版本
-	// 	if mysqlVersion != "" {
-	// 		if setErr := s.redisRepo.SetNewestTicketVersion(mysqlVersion); setErr != nil {
-	// 			log.Printf("更新Redis最新票据版本失败: %v", setErr)
-	// 		}
-	// 	}
+// GetCurrentTicket 获取投票活动的当前票据，客户端绑定模式下把票据绑定到holder
+func (s *TicketService) GetCurrentTicket(pollID, holder string) (*model.Ticket, error) {
+	policy, ok := s.Policy(pollID)
+	if !ok {
+		return nil, fmt.Errorf("投票活动 %s 不存在", pollID)
+	}
+	if err := policy.checkWindow(time.Now()); err != nil {
+		return nil, err
+	}
 
-	// 	version = mysqlVersion
-	// }
+	// 从Redis获取最新票据版本，查询失败时直接返回错误
+	version, err := s.cacheRepo.GetNewestTicketVersion(policy.PollID)
+	if err != nil {
+		return nil, fmt.Errorf("获取最新票据版本失败: %w", err)
+	}
+	if version == repository.PollClosedVersion {
+		return nil, repository.ErrPollClosed
+	}
+	if version == "" {
+		return nil, fmt.Errorf("投票活动 %s 的票据尚未生成", policy.PollID)
+	}
 
 	// 从Redis获取票据
-	redisTicket, err := s.redisRepo.GetTicket(version)
+	redisTicket, err := s.cacheRepo.GetTicket(version)
 	if err != nil {
 		// Redis查询失败时，尝试从MySQL获取
-		log.Printf("从Redis获取票据失败: %v，尝试从MySQL获取", err)
+		s.logger.Warn("从Redis获取票据失败，尝试从MySQL获取", "version", version, "error", err)
 
-		mysqlTicket, mysqlErr := s.mysqlRepo.GetTicket(version)
+		mysqlTicket, mysqlErr := s.ticketRepo.GetTicket(version)
 		if mysqlErr != nil {
 			// MySQL也失败，返回错误
 			return nil, fmt.Errorf("获取票据失败: %w", mysqlErr)
 		}
 
 		// MySQL查询成功，将数据写回Redis
-		if err := s.redisRepo.CreateTicket(mysqlTicket); err != nil {
-			log.Printf("将MySQL票据同步到Redis失败: %v", err)
+		if err := s.cacheRepo.CreateTicket(mysqlTicket); err != nil {
+			s.logger.Warn("将MySQL票据同步到Redis失败", "version", version, "error", err)
 		}
 
 		// 检查剩余使用次数
 		if mysqlTicket.RemainingUsages <= 0 {
-			return nil, fmt.Errorf("票据 %s 使用次数已耗尽", version)
+			return nil, fmt.Errorf("%w, 票据: %s", repository.ErrTicketExhausted, version)
+		}
+		if err := s.checkBudget(policy, mysqlTicket); err != nil {
+			return nil, err
+		}
+		if err := s.checkInstanceQuota(policy, mysqlTicket); err != nil {
+			return nil, err
+		}
+		if err := s.bindHolder(policy, mysqlTicket, holder); err != nil {
+			return nil, err
 		}
 
-		//log.Printf("客户端 %s 已获取票据(MySQL): 版本=%s", clientID, version)
 		return mysqlTicket, nil
 	}
 
 	// Redis查询成功，检查剩余使用次数
 	if redisTicket.RemainingUsages <= 0 {
-		return nil, fmt.Errorf("票据 %s 使用次数已耗尽", version)
+		return nil, fmt.Errorf("%w, 票据: %s", repository.ErrTicketExhausted, version)
+	}
+	if err := s.checkBudget(policy, redisTicket); err != nil {
+		return nil, err
+	}
+	if err := s.checkInstanceQuota(policy, redisTicket); err != nil {
+		return nil, err
+	}
+	if err := s.bindHolder(policy, redisTicket, holder); err != nil {
+		return nil, err
 	}
 
-	//log.Printf("客户端 %s 已获取票据(Redis): 版本=%s", clientID, version)
 	return redisTicket, nil
 }
 
+// checkBudget 当前票据已过期且活动预算已用完时，不会再有新票据，直接告知客户端
+func (s *TicketService) checkBudget(policy *Policy, ticket *model.Ticket) error {
+	if policy.TotalBudget <= 0 || time.Now().Before(ticket.ExpiresAt) {
+		return nil
+	}
+
+	used, err := s.cacheRepo.GetTicketBudgetUsed(policy.PollID)
+	if err != nil {
+		s.logger.Error("获取投票活动的票据预算失败", "poll_id", policy.PollID, "error", err)
+		return nil
+	}
+	if used >= policy.TotalBudget {
+		return fmt.Errorf("%w, 投票活动 %s 的票据预算已用完", repository.ErrTicketExhausted, policy.PollID)
+	}
+	return nil
+}
+
 // ValidateTicket 验证票据
 func (s *TicketService) ValidateTicket(ticket *model.Ticket) (bool, error) {
-	return s.redisRepo.ValidateTicket(ticket)
+	return s.cacheRepo.ValidateTicket(ticket)
+}
+
+// UseTicket 使用票据，从票据占用一次使用次数，返回的Usage在投票受理后确认，受理失败时释放以归还使用次数
+// 票据校验失败次数过多的客户端在禁止期内直接返回ErrClientBlocked
+func (s *TicketService) UseTicket(ticket *model.Ticket, requester Requester) (*Usage, error) {
+	refund, err := s.checkTicket(ticket, requester)
+	if err != nil {
+		return nil, err
+	}
+
+	hold, err := newHold(ticket, requester)
+	if err != nil {
+		refund()
+		return nil, err
+	}
+
+	// 尝试减少Redis中的票据使用次数并登记占用
+	redisRemaining, err := s.cacheRepo.HoldTicketUsage(hold, usageHoldTTL())
+	if err != nil {
+		refund()
+		return nil, fmt.Errorf("减少Redis票据使用次数失败: %w", err)
+	}
+
+	s.observeRemaining(ticket, redisRemaining)
+	return &Usage{Remaining: redisRemaining, hold: hold, service: s}, nil
 }
 
-// UseTicket 使用票据
-func (s *TicketService) UseTicket(ticket *model.Ticket) (bool, error) {
+// TicketUse 批量使用票据时一张票据的结果，成功时Usage不为nil
+type TicketUse struct {
+	*Usage
+	Err error
+}
+
+// UseTickets 批量使用票据，返回与tickets一一对应的结果，一张票据失败不影响其他票据
+// 每张票据分别校验，通过校验的票据在一次Lua脚本执行中原子扣减使用次数并登记占用
+func (s *TicketService) UseTickets(tickets []*model.Ticket, requester Requester) []TicketUse {
+	uses := make([]TicketUse, len(tickets))
+	refunds := make([]func(), len(tickets))
+	var holds []*repository.TicketHold
+	var pending []int // 通过校验、等待扣减使用次数的票据下标
+	for i, ticket := range tickets {
+		refund, err := s.checkTicket(ticket, requester)
+		if err != nil {
+			uses[i].Err = err
+			continue
+		}
+		hold, err := newHold(ticket, requester)
+		if err != nil {
+			refund()
+			uses[i].Err = err
+			continue
+		}
+		refunds[i] = refund
+		holds = append(holds, hold)
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return uses
+	}
+
+	remaining, errs, err := s.cacheRepo.HoldTicketUsages(holds, usageHoldTTL())
+	for j, i := range pending {
+		useErr := err
+		if useErr == nil {
+			useErr = errs[j]
+		}
+		if useErr != nil {
+			uses[i].Err = fmt.Errorf("减少Redis票据使用次数失败: %w", useErr)
+			refunds[i]()
+			continue
+		}
+		uses[i].Usage = &Usage{Remaining: remaining[j], hold: holds[j], service: s}
+		s.observeRemaining(tickets[i], remaining[j])
+	}
+	return uses
+}
+
+// checkTicket 校验票据并在客户端绑定模式下扣减客户端的配额，返回扣减使用次数失败时归还配额的函数
+// 票据校验失败次数过多的客户端在禁止期内直接返回ErrClientBlocked
+func (s *TicketService) checkTicket(ticket *model.Ticket, requester Requester) (func(), error) {
+	if err := s.checkBlocked(requester); err != nil {
+		return nil, err
+	}
+	if policy, ok := s.Policy(ticket.PollID); ok {
+		if err := policy.checkWindow(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	// 签名不匹配的票据不查询Redis
+	if err := verifySignature(ticket); err != nil {
+		s.recordFailure(ticket.PollID, requester, err)
+		return nil, fmt.Errorf("票据验证失败: %w", err)
+	}
+
 	// 验证票据
 	valid, err := s.ValidateTicket(ticket)
 	if err != nil {
-		return false, fmt.Errorf("票据验证失败: %w", err)
+		s.recordFailure(ticket.PollID, requester, err)
+		return nil, fmt.Errorf("票据验证失败: %w", err)
 	}
 
 	if !valid {
-		return false, fmt.Errorf("票据无效")
+		return nil, fmt.Errorf("票据无效")
 	}
 
-	// 尝试减少Redis中的票据使用次数
-	redisRemaining, err := s.redisRepo.DecrementTicketUsage(ticket.Version)
+	// 客户端绑定模式下先扣减客户端的配额
+	refund, err := s.consumeHolder(ticket, requester)
 	if err != nil {
-		return false, fmt.Errorf("减少Redis票据使用次数失败: %w", err)
+		return nil, fmt.Errorf("票据验证失败: %w", err)
+	}
+	return refund, nil
+}
+
+// observeRemaining 更新剩余使用次数指标，剩余次数刚降到预警值以下时推送预警
+// 使用次数在Redis中原子扣减，每张票据只有一次使用会观测到恰好低于预警值的剩余次数
+func (s *TicketService) observeRemaining(ticket *model.Ticket, remaining int) {
+	metrics.TicketRemainingUsages.WithLabelValues(ticket.PollID).Set(float64(remaining))
+
+	policy, ok := s.Policy(ticket.PollID)
+	if !ok || policy.LowUsageThreshold <= 0 || remaining != policy.LowUsageThreshold-1 {
+		return
 	}
-	redisRemaining++
 
-	//log.Printf("票据 %s 使用成功，剩余使用次数: %d", ticket.Version, redisRemaining)
-	return true, nil
+	metrics.TicketLowUsageAlerts.WithLabelValues(ticket.PollID).Inc()
+	s.logger.Warn("票据剩余使用次数低于预警值", "poll_id", ticket.PollID, "version", ticket.Version,
+		"remaining", remaining, "threshold", policy.LowUsageThreshold)
+	if s.notifier != nil {
+		s.notifier.NotifyTicketLowUsage(&model.TicketWarning{
+			PollID:          ticket.PollID,
+			TicketVersion:   ticket.Version,
+			RemainingUsages: remaining,
+			Threshold:       policy.LowUsageThreshold,
+			ExpiresAt:       ticket.ExpiresAt,
+		})
+	}
+}
+
+// generateInitialTickets 为每个投票活动生成首张票据，与定时刷新一样在生产者锁保护下执行
+func (s *TicketService) generateInitialTickets() {
+	for _, policy := range s.policyList() {
+		s.logger.Info("为投票活动生成初始票据", "poll_id", policy.PollID)
+		s.refreshTicket(policy)
+	}
+}
+
+// catchUpAll 为所有缺少有效票据的投票活动立即生成票据
+func (s *TicketService) catchUpAll() {
+	for _, policy := range s.policyList() {
+		s.catchUp(policy)
+	}
+}
+
+// catchUp 投票活动没有有效票据时立即生成，消除所有实例停机超过票据有效期后getTicket失败的空窗
+func (s *TicketService) catchUp(policy *Policy) {
+	if errors.Is(policy.checkWindow(time.Now()), ErrPollNotStarted) {
+		return
+	}
+
+	// Redis数据丢失时先以MySQL为准恢复最新票据
+	s.refreshPollTicketCache(policy.PollID)
+
+	if s.hasValidTicket(policy.PollID) {
+		return
+	}
+	s.logger.Info("投票活动没有有效票据，立即生成", "poll_id", policy.PollID)
+	s.refreshTicket(policy)
+}
+
+// hasValidTicket 投票活动当前是否有未过期的票据，已结束的活动视为无需生成
+func (s *TicketService) hasValidTicket(pollID string) bool {
+	version, err := s.cacheRepo.GetNewestTicketVersion(pollID)
+	if err != nil {
+		s.logger.Error("获取投票活动的最新票据版本失败", "poll_id", pollID, "error", err)
+		return false
+	}
+	if version == repository.PollClosedVersion {
+		return true
+	}
+	if version == "" {
+		return false
+	}
+
+	ticket, err := s.cacheRepo.GetTicket(version)
+	if err != nil {
+		return false
+	}
+	return time.Now().Before(ticket.ExpiresAt)
+}
+
+// recordConsumption 票据轮换时以Redis中的剩余使用次数为准记录消耗次数，Redis中已不存在时使用MySQL
+func (s *TicketService) recordConsumption(version string, rotatedAt time.Time) {
+	ticket, err := s.cacheRepo.GetTicket(version)
+	if err != nil {
+		ticket, err = s.ticketRepo.GetTicket(version)
+		if err != nil {
+			s.logger.Warn("获取票据的剩余使用次数失败", "version", version, "error", err)
+			return
+		}
+	}
+
+	if err := s.ticketRepo.RecordTicketConsumption(version, ticket.RemainingUsages, rotatedAt); err != nil {
+		s.logger.Warn("记录票据消耗次数失败", "version", version, "error", err)
+	}
+}
+
+// GetTicketStats 按签发时间倒序查询票据利用率
+func (s *TicketService) GetTicketStats(pollID string, limit int) ([]*model.TicketStats, error) {
+	return s.ticketRepo.GetTicketStats(pollID, limit)
 }
 
 // generateVersion 生成票据版本号
@@ -299,7 +805,7 @@ func (s *TicketService) generateVersion() string {
 func (s *TicketService) generateTicketValue() string {
 	bytes := make([]byte, 16)
 	if _, err := rand.Read(bytes); err != nil {
-		log.Printf("生成随机票据值失败: %v", err)
+		s.logger.Error("生成随机票据值失败", "error", err)
 		// 使用时间戳作为备选
 		return fmt.Sprintf("%d", time.Now().UnixNano())
 	}
@@ -0,0 +1,64 @@
+package ticket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+	"github.com/lvdashuaibi/littlevote/internal/repository"
+)
+
+// defaultUsageHoldTTL 未配置ticket.usage_hold_ttl时占用等待确认的时长
+const defaultUsageHoldTTL = 30 * time.Second
+
+// Usage 投票从票据占用的一次使用次数
+// 投票受理（写入发件箱）后调用Confirm；受理失败时调用Release立即归还，实例在两者之前退出时由释放任务在占用过期后归还
+type Usage struct {
+	Remaining int // 占用后票据的剩余使用次数
+	hold      *repository.TicketHold
+	service   *TicketService
+}
+
+// Confirm 确认占用，使用次数不再归还
+func (u *Usage) Confirm() {
+	confirmed, err := u.service.cacheRepo.ConfirmTicketUsage(u.hold.ID)
+	if err != nil {
+		// 确认失败时占用过期后会被归还，已受理的投票多返还一次使用次数
+		u.service.logger.Error("确认票据使用次数占用失败", "version", u.hold.Version, "hold_id", u.hold.ID, "error", err)
+		return
+	}
+	if !confirmed {
+		u.service.logger.Warn("票据使用次数的占用在确认前已过期被归还", "version", u.hold.Version, "hold_id", u.hold.ID,
+			"hold_ttl", usageHoldTTL())
+	}
+}
+
+// Release 释放占用，归还票据使用次数和客户端绑定模式下的客户端配额
+func (u *Usage) Release() {
+	if _, err := u.service.cacheRepo.ReleaseTicketUsage(u.hold.ID); err != nil {
+		u.service.logger.Error("归还票据使用次数失败，等待占用过期后归还", "version", u.hold.Version, "hold_id", u.hold.ID, "error", err)
+	}
+}
+
+// newHold 创建一次使用次数的占用，客户端绑定模式下记录扣减了配额的客户端
+func newHold(ticket *model.Ticket, requester Requester) (*repository.TicketHold, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, fmt.Errorf("生成票据使用次数占用ID失败: %w", err)
+	}
+	hold := &repository.TicketHold{ID: hex.EncodeToString(bytes), Version: ticket.Version}
+	if config.AppConfig.Ticket.ClientBinding.Enabled {
+		hold.Holder = requester.Holder
+	}
+	return hold, nil
+}
+
+func usageHoldTTL() time.Duration {
+	if ttl := config.AppConfig.Ticket.UsageHoldTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultUsageHoldTTL
+}
@@ -0,0 +1,11 @@
+package validation
+
+// ValidateVoteCount 校验管理员设置的票数，不能为负数
+func ValidateVoteCount(field string, votes int32) (int, error) {
+	if votes < 0 {
+		var errs Errors
+		errs.add(field, "不能为负数")
+		return 0, errs
+	}
+	return int(votes), nil
+}
@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAPIKeyNameLength 与api_keys.name字段长度保持一致
+const maxAPIKeyNameLength = 64
+
+// ValidateAPIKeyName 校验API密钥的名称，返回去除首尾空白后的名称
+func ValidateAPIKeyName(field, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	var errs Errors
+	switch {
+	case name == "":
+		errs.add(field, "不能为空")
+	case utf8.RuneCountInString(name) > maxAPIKeyNameLength:
+		errs.add(field, "不能超过%d个字符", maxAPIKeyNameLength)
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return name, nil
+}
+
+// ValidateAPIKeyID 校验API密钥的ID
+func ValidateAPIKeyID(field, id string) (int64, error) {
+	value, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || value <= 0 {
+		var errs Errors
+		errs.add(field, "必须为正整数")
+		return 0, errs
+	}
+	return value, nil
+}
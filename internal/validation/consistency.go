@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"strings"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+// maxEventIDLength 与vote_logs.event_id字段长度保持一致
+const maxEventIDLength = 64
+
+// ValidateReadConsistency 校验查询票数的一致性级别，为空时为EVENTUAL，不区分大小写
+// afterEventId只能与STRONG一起使用
+func ValidateReadConsistency(consistency, afterEventID string) (model.ReadConsistency, error) {
+	var errs Errors
+	level := model.ReadConsistency(strings.ToUpper(strings.TrimSpace(consistency)))
+	switch level {
+	case "":
+		level = model.ReadEventual
+	case model.ReadEventual, model.ReadStrong:
+	default:
+		errs.add("consistency", "必须是STRONG或EVENTUAL")
+	}
+
+	if afterEventID != "" {
+		switch {
+		case level != model.ReadStrong:
+			errs.add("afterEventId", "只能在consistency为STRONG时使用")
+		case len(afterEventID) > maxEventIDLength:
+			errs.add("afterEventId", "长度不能超过%d个字符", maxEventIDLength)
+		}
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return level, nil
+}
@@ -0,0 +1,52 @@
+package validation
+
+import "strconv"
+
+const (
+	DefaultVoteLogExportLimit = 1000
+	MaxVoteLogExportLimit     = 10000
+)
+
+// VoteLogExportQuery 投票日志导出的游标和数量
+type VoteLogExportQuery struct {
+	PollID  string // 为空时导出所有投票活动
+	AfterID int64  // 只返回id大于该值的投票日志，为0时从头开始
+	Limit   int
+}
+
+// ValidateVoteLogExportQuery 校验投票日志导出参数，after为上一页返回的游标
+func ValidateVoteLogExportQuery(pollID, after *string, limit *int32) (*VoteLogExportQuery, error) {
+	var errs Errors
+	query := &VoteLogExportQuery{Limit: DefaultVoteLogExportLimit}
+
+	if pollID != nil && *pollID != "" {
+		if !pollIDPattern.MatchString(*pollID) {
+			errs.add("pollId", "只能包含字母、数字、下划线和连字符，长度不超过64")
+		}
+		query.PollID = *pollID
+	}
+
+	if after != nil && *after != "" {
+		id, err := strconv.ParseInt(*after, 10, 64)
+		if err != nil || id < 0 {
+			errs.add("after", "必须是上一页返回的游标")
+		}
+		query.AfterID = id
+	}
+
+	if limit != nil {
+		switch {
+		case *limit <= 0:
+			errs.add("limit", "必须大于0")
+		case *limit > MaxVoteLogExportLimit:
+			errs.add("limit", "不能超过%d", MaxVoteLogExportLimit)
+		default:
+			query.Limit = int(*limit)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return query, nil
+}
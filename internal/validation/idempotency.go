@@ -0,0 +1,28 @@
+package validation
+
+import "regexp"
+
+// MaxIdempotencyKeyLength 与vote_idempotency_keys表字段长度保持一致
+const MaxIdempotencyKeyLength = 128
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// ValidateIdempotencyKey 校验客户端提交的幂等键，未传时返回空字符串
+func ValidateIdempotencyKey(field string, key *string) (string, error) {
+	if key == nil || *key == "" {
+		return "", nil
+	}
+
+	var errs Errors
+	switch {
+	case len(*key) > MaxIdempotencyKeyLength:
+		errs.add(field, "长度不能超过%d", MaxIdempotencyKeyLength)
+	case !idempotencyKeyPattern.MatchString(*key):
+		errs.add(field, "只能包含字母、数字、下划线、点、冒号和连字符")
+	}
+
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return *key, nil
+}
@@ -0,0 +1,26 @@
+package validation
+
+import "github.com/lvdashuaibi/littlevote/config"
+
+// DefaultMaxLeaderboardLimit 未配置leaderboard.max_limit时排行榜查询的limit上限
+const DefaultMaxLeaderboardLimit = 100
+
+// ValidateLeaderboardLimit 校验排行榜查询返回的用户数
+func ValidateLeaderboardLimit(limit int32) (int, error) {
+	maxLimit := config.AppConfig.Leaderboard.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = DefaultMaxLeaderboardLimit
+	}
+
+	var errs Errors
+	switch {
+	case limit <= 0:
+		errs.add("limit", "必须大于0")
+	case int(limit) > maxLimit:
+		errs.add("limit", "不能超过%d", maxLimit)
+	}
+	if len(errs) > 0 {
+		return 0, errs
+	}
+	return int(limit), nil
+}
@@ -0,0 +1,112 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+const (
+	// MaxPollTitleLength 与polls.title字段长度保持一致
+	MaxPollTitleLength = 255
+	// MaxPollCandidates 单个投票活动的候选人数量上限
+	MaxPollCandidates = 1000
+)
+
+// ValidatePollID 校验投票活动ID，为空时返回默认活动
+func ValidatePollID(field, pollID string) (string, error) {
+	if pollID == "" {
+		return model.DefaultPollID, nil
+	}
+	if !pollIDPattern.MatchString(pollID) {
+		var errs Errors
+		errs.add(field, "只能包含字母、数字、下划线和连字符，长度不超过64")
+		return "", errs
+	}
+	return pollID, nil
+}
+
+// PollFields 客户端提交的原始投票活动字段
+type PollFields struct {
+	ID         string
+	Title      string
+	Candidates []string
+	StartsAt   *string
+	EndsAt     *string
+}
+
+// ValidatePoll 校验创建投票活动的字段，全部合法时返回投票活动
+// 候选人需要符合vote.username_*配置的用户名规则且不能重复
+func ValidatePoll(field string, in PollFields) (*model.Poll, error) {
+	rule, err := CurrentUsernameRule()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs Errors
+	if !pollIDPattern.MatchString(in.ID) {
+		errs.add(field+".id", "只能包含字母、数字、下划线和连字符，长度为1到64")
+	}
+
+	title := strings.TrimSpace(in.Title)
+	switch {
+	case title == "":
+		errs.add(field+".title", "不能为空")
+	case utf8.RuneCountInString(title) > MaxPollTitleLength:
+		errs.add(field+".title", "长度不能超过%d", MaxPollTitleLength)
+	}
+
+	switch {
+	case len(in.Candidates) == 0:
+		errs.add(field+".candidates", "不能为空")
+	case len(in.Candidates) > MaxPollCandidates:
+		errs.add(field+".candidates", "不能超过%d个", MaxPollCandidates)
+	}
+	seen := make(map[string]bool, len(in.Candidates))
+	for i, candidate := range in.Candidates {
+		candidateField := fmt.Sprintf("%s.candidates[%d]", field, i)
+		if seen[candidate] {
+			errs.add(candidateField, "候选人%q重复", candidate)
+			continue
+		}
+		seen[candidate] = true
+		rule.check(&errs, candidateField, candidate)
+	}
+
+	startsAt := parseOptionalTime(&errs, field+".startsAt", in.StartsAt)
+	endsAt := parseOptionalTime(&errs, field+".endsAt", in.EndsAt)
+	if endsAt != nil {
+		if !endsAt.After(time.Now()) {
+			errs.add(field+".endsAt", "必须晚于服务器当前时间")
+		} else if startsAt != nil && !endsAt.After(*startsAt) {
+			errs.add(field+".endsAt", "必须晚于startsAt")
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &model.Poll{
+		ID:         in.ID,
+		Title:      title,
+		Candidates: in.Candidates,
+		StartsAt:   startsAt,
+		EndsAt:     endsAt,
+	}, nil
+}
+
+// parseOptionalTime 解析可选的RFC3339时间，未提供时返回nil
+func parseOptionalTime(errs *Errors, field string, value *string) *time.Time {
+	if value == nil || *value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		errs.add(field, "必须是RFC3339格式的时间")
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,55 @@
+package validation
+
+import "time"
+
+const (
+	DefaultSnapshotLimit = 100
+	MaxSnapshotLimit     = 1000
+)
+
+// SnapshotQuery 结果快照查询的时间范围和数量
+type SnapshotQuery struct {
+	Since time.Time // 为零值时不限制
+	Until time.Time // 为零值时不限制
+	Limit int
+}
+
+// ValidateSnapshotQuery 校验结果快照查询参数，since和until为RFC3339格式的时间
+func ValidateSnapshotQuery(since, until *string, limit *int32) (*SnapshotQuery, error) {
+	var errs Errors
+	query := &SnapshotQuery{Limit: DefaultSnapshotLimit}
+
+	if since != nil && *since != "" {
+		t, err := time.Parse(time.RFC3339, *since)
+		if err != nil {
+			errs.add("since", "必须是RFC3339格式的时间")
+		}
+		query.Since = t
+	}
+	if until != nil && *until != "" {
+		t, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			errs.add("until", "必须是RFC3339格式的时间")
+		}
+		query.Until = t
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && query.Until.Before(query.Since) {
+		errs.add("until", "不能早于since")
+	}
+
+	if limit != nil {
+		switch {
+		case *limit <= 0:
+			errs.add("limit", "必须大于0")
+		case *limit > MaxSnapshotLimit:
+			errs.add("limit", "不能超过%d", MaxSnapshotLimit)
+		default:
+			query.Limit = int(*limit)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return query, nil
+}
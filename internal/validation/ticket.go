@@ -0,0 +1,183 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+const (
+	// 与tickets表字段长度保持一致
+	MaxTicketValueLength   = 128
+	MaxTicketVersionLength = 64
+	MaxTicketHolderLength  = 128
+
+	// 客户端与服务端之间允许的最大时钟偏差
+	MaxClockSkew = 5 * time.Second
+)
+
+var (
+	pollIDPattern        = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	ticketValuePattern   = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	ticketVersionPattern = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors 字段级校验错误集合
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return "参数校验失败: " + strings.Join(msgs, "; ")
+}
+
+// Extensions 将字段错误暴露在GraphQL错误的extensions中
+func (e Errors) Extensions() map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(e))
+	for _, fe := range e {
+		fields = append(fields, map[string]interface{}{
+			"field":   fe.Field,
+			"message": fe.Message,
+		})
+	}
+	return map[string]interface{}{
+		"code":   "INVALID_INPUT",
+		"fields": fields,
+	}
+}
+
+func (e *Errors) add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// TicketFields 客户端提交的原始票据字段
+type TicketFields struct {
+	PollID          string
+	Value           string
+	Version         string
+	RemainingUsages int
+	ExpiresAt       string
+	CreatedAt       string
+	Holder          string // 客户端绑定模式下票据绑定的客户端，可以为空
+}
+
+// ValidateTicket 校验客户端提交的票据字段，全部合法时返回解析后的票据
+func ValidateTicket(field string, in TicketFields) (*model.Ticket, error) {
+	var errs Errors
+	now := time.Now()
+
+	pollID := in.PollID
+	if pollID == "" {
+		pollID = model.DefaultPollID
+	} else if !pollIDPattern.MatchString(pollID) {
+		errs.add(field+".pollId", "只能包含字母、数字、下划线和连字符，长度不超过64")
+	}
+
+	switch {
+	case in.Value == "":
+		errs.add(field+".value", "不能为空")
+	case len(in.Value) > MaxTicketValueLength:
+		errs.add(field+".value", "长度不能超过%d", MaxTicketValueLength)
+	case !ticketValuePattern.MatchString(in.Value):
+		errs.add(field+".value", "格式不正确")
+	}
+
+	switch {
+	case in.Version == "":
+		errs.add(field+".version", "不能为空")
+	case len(in.Version) > MaxTicketVersionLength:
+		errs.add(field+".version", "长度不能超过%d", MaxTicketVersionLength)
+	case !ticketVersionPattern.MatchString(in.Version):
+		errs.add(field+".version", "必须为数字")
+	}
+
+	// 剩余使用次数的上限记录在签发的票据上，在校验票据时与之比较，不使用可能已热加载修改的配置
+	if in.RemainingUsages < 0 {
+		errs.add(field+".remainingUsages", "不能为负数")
+	}
+
+	expiresAt, expiresErr := time.Parse(time.RFC3339, in.ExpiresAt)
+	if expiresErr != nil {
+		errs.add(field+".expiresAt", "必须是RFC3339格式的时间")
+	}
+
+	createdAt, createdErr := time.Parse(time.RFC3339, in.CreatedAt)
+	if createdErr != nil {
+		errs.add(field+".createdAt", "必须是RFC3339格式的时间")
+	} else if createdAt.After(now.Add(MaxClockSkew)) {
+		errs.add(field+".createdAt", "不能晚于服务器当前时间")
+	}
+
+	if expiresErr == nil && createdErr == nil && !expiresAt.After(createdAt) {
+		errs.add(field+".expiresAt", "必须晚于createdAt")
+	}
+
+	if len(in.Holder) > MaxTicketHolderLength {
+		errs.add(field+".holder", "长度不能超过%d", MaxTicketHolderLength)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &model.Ticket{
+		PollID:          pollID,
+		Value:           in.Value,
+		Version:         in.Version,
+		RemainingUsages: in.RemainingUsages,
+		ExpiresAt:       expiresAt,
+		CreatedAt:       createdAt,
+		Holder:          in.Holder,
+	}, nil
+}
+
+const (
+	DefaultTicketStatsLimit = 100
+	MaxTicketStatsLimit     = 1000
+)
+
+// TicketStatsQuery 票据利用率查询参数
+type TicketStatsQuery struct {
+	PollID string // 为空时查询所有投票活动
+	Limit  int
+}
+
+// ValidateTicketStatsQuery 校验票据利用率查询参数
+func ValidateTicketStatsQuery(pollID *string, limit *int32) (*TicketStatsQuery, error) {
+	var errs Errors
+	query := &TicketStatsQuery{Limit: DefaultTicketStatsLimit}
+
+	if pollID != nil && *pollID != "" {
+		if !pollIDPattern.MatchString(*pollID) {
+			errs.add("pollId", "只能包含字母、数字、下划线和连字符，长度不超过64")
+		}
+		query.PollID = *pollID
+	}
+
+	if limit != nil {
+		switch {
+		case *limit <= 0:
+			errs.add("limit", "必须大于0")
+		case *limit > MaxTicketStatsLimit:
+			errs.add("limit", "不能超过%d", MaxTicketStatsLimit)
+		default:
+			query.Limit = int(*limit)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return query, nil
+}
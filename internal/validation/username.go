@@ -0,0 +1,166 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lvdashuaibi/littlevote/config"
+)
+
+const (
+	// MaxUsernameLength 与user_votes.username字段长度保持一致
+	MaxUsernameLength = 64
+
+	// DefaultUsernamePattern 未配置时沿用A-Z之间的单个字母
+	DefaultUsernamePattern = `^[A-Z]$`
+)
+
+// 投票对象的校验方式，由vote.candidate_validator配置
+const (
+	// CandidateValidatorPattern 默认的校验方式，用户名符合vote.username_*规则即可
+	CandidateValidatorPattern = "pattern"
+	// CandidateValidatorRegistry 只能给登记过的候选人投票，用户名只检查长度，是否登记由投票服务校验
+	CandidateValidatorRegistry = "registry"
+)
+
+// usernamePattern 缓存编译后的用户名正则，配置变化时重新编译
+var usernamePattern struct {
+	sync.Mutex
+	source string
+	re     *regexp.Regexp
+}
+
+// UsernameRule 生效的用户名规则
+type UsernameRule struct {
+	Pattern   *regexp.Regexp // registry模式下为nil，不检查格式
+	MinLength int
+	MaxLength int
+}
+
+// CandidateValidator 生效的投票对象校验方式，未配置时为pattern
+func CandidateValidator() (string, error) {
+	switch validator := config.AppConfig.Vote.CandidateValidator; validator {
+	case "":
+		return CandidateValidatorPattern, nil
+	case CandidateValidatorPattern, CandidateValidatorRegistry:
+		return validator, nil
+	default:
+		return "", fmt.Errorf("vote.candidate_validator 只能是 %s 或 %s: %s", CandidateValidatorPattern, CandidateValidatorRegistry, validator)
+	}
+}
+
+// CurrentUsernameRule 按vote.candidate_validator和vote.username_*配置返回用户名规则，未配置的项使用默认值
+func CurrentUsernameRule() (*UsernameRule, error) {
+	validator, err := CandidateValidator()
+	if err != nil {
+		return nil, err
+	}
+	var pattern *regexp.Regexp
+	if validator == CandidateValidatorPattern {
+		if pattern, err = currentUsernamePattern(); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := config.AppConfig.Vote
+	rule := &UsernameRule{Pattern: pattern, MinLength: cfg.UsernameMinLength, MaxLength: cfg.UsernameMaxLength}
+	if rule.MinLength <= 0 {
+		rule.MinLength = 1
+	}
+	if rule.MaxLength <= 0 || rule.MaxLength > MaxUsernameLength {
+		rule.MaxLength = MaxUsernameLength
+	}
+	if rule.MinLength > rule.MaxLength {
+		return nil, fmt.Errorf("vote.username_min_length(%d)不能大于username_max_length(%d)", rule.MinLength, rule.MaxLength)
+	}
+	return rule, nil
+}
+
+// currentUsernamePattern 返回编译后的vote.username_pattern，配置变化时重新编译
+func currentUsernamePattern() (*regexp.Regexp, error) {
+	source := config.AppConfig.Vote.UsernamePattern
+	if source == "" {
+		source = DefaultUsernamePattern
+	}
+
+	usernamePattern.Lock()
+	defer usernamePattern.Unlock()
+	if usernamePattern.re == nil || usernamePattern.source != source {
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("vote.username_pattern不是合法的正则表达式: %w", err)
+		}
+		usernamePattern.source = source
+		usernamePattern.re = re
+	}
+	return usernamePattern.re, nil
+}
+
+// ValidateUsername 校验单个用户名，长度按字符计算
+func ValidateUsername(field, username string) error {
+	rule, err := CurrentUsernameRule()
+	if err != nil {
+		return err
+	}
+	var errs Errors
+	rule.check(&errs, field, username)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateUsernames 校验投票的用户名列表非空且每个用户名都符合规则
+func ValidateUsernames(field string, usernames []string) error {
+	rule, err := CurrentUsernameRule()
+	if err != nil {
+		return err
+	}
+	var errs Errors
+	if len(usernames) == 0 {
+		errs.add(field, "不能为空")
+	}
+	for i, username := range usernames {
+		rule.check(&errs, fmt.Sprintf("%s[%d]", field, i), username)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *UsernameRule) check(errs *Errors, field, username string) {
+	length := utf8.RuneCountInString(username)
+	switch {
+	case length < r.MinLength:
+		errs.add(field, "无效的用户名%q: 长度不能少于%d", username, r.MinLength)
+	case length > r.MaxLength:
+		errs.add(field, "无效的用户名%q: 长度不能超过%d", username, r.MaxLength)
+	case r.Pattern != nil && !r.Pattern.MatchString(username):
+		errs.add(field, "无效的用户名%q: 必须匹配%s", username, r.Pattern)
+	}
+}
+
+// ValidateCandidateName 校验登记的候选人名称，返回去除首尾空白后的名称
+// 名称按当前的用户名规则校验，且不能包含控制字符
+func ValidateCandidateName(field, name string) (string, error) {
+	rule, err := CurrentUsernameRule()
+	if err != nil {
+		return "", err
+	}
+	name = strings.TrimSpace(name)
+	var errs Errors
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		errs.add(field, "无效的候选人名称%q: 不能包含控制字符", name)
+	} else {
+		rule.check(&errs, field, name)
+	}
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return name, nil
+}
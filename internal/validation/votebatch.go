@@ -0,0 +1,26 @@
+package validation
+
+import "github.com/lvdashuaibi/littlevote/config"
+
+// DefaultMaxVoteBatchSize 未配置vote.batch_max_size时一次批量投票最多包含的投票数
+const DefaultMaxVoteBatchSize = 100
+
+// ValidateVoteBatchSize 校验批量投票包含的投票数
+func ValidateVoteBatchSize(field string, size int) error {
+	maxSize := config.AppConfig.Vote.BatchMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxVoteBatchSize
+	}
+
+	var errs Errors
+	switch {
+	case size == 0:
+		errs.add(field, "不能为空")
+	case size > maxSize:
+		errs.add(field, "不能超过%d个", maxSize)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
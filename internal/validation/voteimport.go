@@ -0,0 +1,142 @@
+package validation
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxImportRowVotes 导入文件中一行最多的票数
+	MaxImportRowVotes = 1000000
+	// maxImportErrors 导入文件最多报告的错误数，超出后停止校验
+	maxImportErrors = 100
+)
+
+// 导入批次会拼入eventId和ticket_version，长度受两个字段的长度限制
+var importIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// 导入文件的列
+const (
+	importColumnPollID   = "poll_id"
+	importColumnUsername = "username"
+	importColumnVotes    = "votes"
+)
+
+// ImportRow 导入文件中的一行：用户在投票活动中得到的票数
+type ImportRow struct {
+	Line     int // 在文件中的行号，从1开始，第1行为表头
+	PollID   string
+	Username string
+	Votes    int
+}
+
+// ImportField 导入文件第line行某一列的字段名，用于定位校验错误
+func ImportField(line int, column string) string {
+	return fmt.Sprintf("csv[%d].%s", line, column)
+}
+
+// ValidateImportID 校验导入批次，未传时返回空字符串
+func ValidateImportID(field string, id *string) (string, error) {
+	if id == nil || *id == "" {
+		return "", nil
+	}
+	if !importIDPattern.MatchString(*id) {
+		var errs Errors
+		errs.add(field, "只能包含字母、数字、下划线、点和连字符，长度不超过32")
+		return "", errs
+	}
+	return *id, nil
+}
+
+// ParseVoteImport 解析并校验旧系统导出的投票结果CSV，第1行为表头
+// 必须包含username列；votes列缺省为1；poll_id列缺省为defaultPollID。同一用户可以出现在多行，票数累加
+// 用户名按当前的用户名规则校验，任一行不合法时返回所有行的错误（最多100个）
+func ParseVoteImport(r io.Reader, defaultPollID string) ([]ImportRow, error) {
+	rule, err := CurrentUsernameRule()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs Errors
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			errs.add("csv", "文件为空")
+		} else {
+			errs.add("csv", "格式错误: %v", err)
+		}
+		return nil, errs
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// Excel导出的UTF-8文件以BOM开头
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch name {
+		case importColumnPollID, importColumnUsername, importColumnVotes:
+		default:
+			errs.add(ImportField(1, name), "不支持的列，只能是poll_id、username和votes")
+			continue
+		}
+		if _, ok := columns[name]; ok {
+			errs.add(ImportField(1, name), "列重复")
+		}
+		columns[name] = i
+	}
+	if _, ok := columns[importColumnUsername]; !ok {
+		errs.add("csv[1]", "缺少username列")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var rows []ImportRow
+	for len(errs) < maxImportErrors {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			errs.add(fmt.Sprintf("csv[%d]", line), "格式错误: %v", err)
+			break
+		}
+
+		row := ImportRow{Line: line, PollID: defaultPollID, Votes: 1}
+		if i, ok := columns[importColumnPollID]; ok && record[i] != "" {
+			pollID, err := ValidatePollID(ImportField(line, importColumnPollID), record[i])
+			if err != nil {
+				errs = append(errs, err.(Errors)...)
+			}
+			row.PollID = pollID
+		}
+		row.Username = strings.TrimSpace(record[columns[importColumnUsername]])
+		rule.check(&errs, ImportField(line, importColumnUsername), row.Username)
+		if i, ok := columns[importColumnVotes]; ok {
+			votes, err := strconv.Atoi(strings.TrimSpace(record[i]))
+			switch {
+			case err != nil:
+				errs.add(ImportField(line, importColumnVotes), "必须是整数")
+			case votes <= 0 || votes > MaxImportRowVotes:
+				errs.add(ImportField(line, importColumnVotes), "必须在1到%d之间", MaxImportRowVotes)
+			}
+			row.Votes = votes
+		}
+		rows = append(rows, row)
+	}
+
+	if len(errs) == 0 && len(rows) == 0 {
+		errs.add("csv", "没有可导入的投票")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return rows, nil
+}
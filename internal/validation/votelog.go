@@ -0,0 +1,102 @@
+package validation
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+const (
+	DefaultVoteLogPageSize = 50
+	MaxVoteLogPageSize     = 500
+
+	// maxVoteLogFilterLength 与vote_logs.username、ticket_version字段长度保持一致
+	maxVoteLogFilterLength = 64
+)
+
+// VoteLogArgs voteLogs查询的参数
+type VoteLogArgs struct {
+	Username      *string
+	TicketVersion *string
+	From          *string
+	To            *string
+	First         *int32
+	After         *string
+}
+
+// ValidateVoteLogQuery 校验投票日志审计查询的参数，from和to为RFC3339格式的时间，after为上一页返回的游标
+// 用户名不按当前的用户名规则校验，规则修改之前的投票日志同样可以查询
+func ValidateVoteLogQuery(args VoteLogArgs) (*model.VoteLogFilter, error) {
+	var errs Errors
+	filter := &model.VoteLogFilter{Limit: DefaultVoteLogPageSize}
+
+	filter.Username = voteLogFilterValue(&errs, "username", args.Username)
+	filter.TicketVersion = voteLogFilterValue(&errs, "ticketVersion", args.TicketVersion)
+
+	if args.From != nil && *args.From != "" {
+		t, err := time.Parse(time.RFC3339, *args.From)
+		if err != nil {
+			errs.add("from", "必须是RFC3339格式的时间")
+		}
+		filter.From = t
+	}
+	if args.To != nil && *args.To != "" {
+		t, err := time.Parse(time.RFC3339, *args.To)
+		if err != nil {
+			errs.add("to", "必须是RFC3339格式的时间")
+		}
+		filter.To = t
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.To.After(filter.From) {
+		errs.add("to", "必须晚于from")
+	}
+
+	if args.First != nil {
+		switch {
+		case *args.First <= 0:
+			errs.add("first", "必须大于0")
+		case *args.First > MaxVoteLogPageSize:
+			errs.add("first", "不能超过%d", MaxVoteLogPageSize)
+		default:
+			filter.Limit = int(*args.First)
+		}
+	}
+
+	if args.After != nil && *args.After != "" {
+		id, err := strconv.ParseInt(*args.After, 10, 64)
+		if err != nil || id <= 0 {
+			errs.add("after", "必须是上一页返回的游标")
+		}
+		filter.BeforeID = id
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return filter, nil
+}
+
+func voteLogFilterValue(errs *Errors, field string, value *string) string {
+	if value == nil {
+		return ""
+	}
+	trimmed := strings.TrimSpace(*value)
+	if utf8.RuneCountInString(trimmed) > maxVoteLogFilterLength {
+		errs.add(field, "不能超过%d个字符", maxVoteLogFilterLength)
+	}
+	return trimmed
+}
+
+// ValidateVoteLogID 校验投票日志ID，必须为正整数
+func ValidateVoteLogID(field, id string) (int64, error) {
+	value, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || value <= 0 {
+		var errs Errors
+		errs.add(field, "必须为正整数")
+		return 0, errs
+	}
+	return value, nil
+}
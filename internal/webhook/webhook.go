@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lvdashuaibi/littlevote/config"
+	"github.com/lvdashuaibi/littlevote/internal/logging"
+	"github.com/lvdashuaibi/littlevote/internal/metrics"
+	"github.com/lvdashuaibi/littlevote/internal/model"
+)
+
+const (
+	// EventTicketLowUsage 当前票据剩余使用次数降到预警值以下
+	EventTicketLowUsage = "ticket.low_usage"
+	// EventTicketAbuse 客户端票据校验失败次数过多，已被暂时禁止使用票据
+	EventTicketAbuse = "ticket.abuse"
+
+	defaultTimeout = 3 * time.Second
+
+	// SignatureHeader 请求体签名，格式为sha256=<十六进制HMAC>
+	SignatureHeader = "X-Littlevote-Signature"
+	// EventHeader 事件类型
+	EventHeader = "X-Littlevote-Event"
+)
+
+// Event 推送给订阅方的事件
+type Event struct {
+	Type       string      `json:"type"`
+	InstanceID int         `json:"instanceId"`
+	SentAt     time.Time   `json:"sentAt"`
+	Data       interface{} `json:"data"`
+}
+
+// Publisher 把事件以JSON POST到配置的所有地址，推送在后台进行，不阻塞调用方
+type Publisher struct {
+	client *http.Client
+	urls   []string
+	secret string
+	logger *slog.Logger
+}
+
+func NewPublisher(logger *slog.Logger) *Publisher {
+	timeout := config.AppConfig.Webhook.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Publisher{
+		client: &http.Client{Timeout: timeout},
+		urls:   config.AppConfig.Webhook.URLs,
+		secret: config.AppConfig.Webhook.Secret,
+		logger: logging.Component(logger, "webhook"),
+	}
+}
+
+// NotifyTicketLowUsage 推送票据即将耗尽的预警
+func (p *Publisher) NotifyTicketLowUsage(warning *model.TicketWarning) {
+	p.Publish(EventTicketLowUsage, warning)
+}
+
+// NotifyTicketAbuse 推送疑似穷举票据值的客户端
+func (p *Publisher) NotifyTicketAbuse(abuse *model.TicketAbuse) {
+	p.Publish(EventTicketAbuse, abuse)
+}
+
+// Publish 向所有地址推送事件，失败时只记录日志，不重试
+func (p *Publisher) Publish(eventType string, data interface{}) {
+	if len(p.urls) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(&Event{
+		Type:       eventType,
+		InstanceID: config.AppConfig.Server.InstanceID,
+		SentAt:     time.Now(),
+		Data:       data,
+	})
+	if err != nil {
+		p.logger.Error("序列化webhook事件失败", "event", eventType, "error", err)
+		return
+	}
+
+	for _, url := range p.urls {
+		go func(url string) {
+			result := "success"
+			if err := p.deliver(url, eventType, body); err != nil {
+				result = "failure"
+				p.logger.Warn("推送webhook事件失败", "event", eventType, "url", url, "error", err)
+			}
+			metrics.WebhookDeliveries.WithLabelValues(eventType, result).Inc()
+		}(url)
+	}
+}
+
+func (p *Publisher) deliver(url, eventType string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	if p.secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+sign(p.secret, body))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("响应状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
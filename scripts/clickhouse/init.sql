@@ -0,0 +1,18 @@
+-- 创建分析库
+CREATE DATABASE IF NOT EXISTS littlevote;
+
+-- 创建投票事件表，每行对应vote_logs中的一票
+-- 镜像按批重试可能重复写入，ReplacingMergeTree在合并时按(event_id, event_index)去重，精确统计时使用FINAL
+CREATE TABLE IF NOT EXISTS littlevote.vote_events (
+  event_id String,
+  event_index UInt32,
+  poll_id LowCardinality(String),
+  username LowCardinality(String),
+  ticket_version String,
+  actor String,
+  source_ip String,
+  user_agent String,
+  voted_at DateTime64(3, 'UTC')
+) ENGINE = ReplacingMergeTree
+PARTITION BY toYYYYMM(voted_at)
+ORDER BY (poll_id, event_id, event_index);
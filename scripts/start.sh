@@ -27,4 +27,5 @@ echo "ETCD: localhost:2379"
 # 启动应用
 cd ..
 echo "启动 Little Vote 应用..."
-go run cmd/main.go 
\ No newline at end of file
+# 注入构建信息，可通过/version或serverInfo查询
+go run -ldflags "-X github.com/lvdashuaibi/littlevote/internal/buildinfo.Commit=$(git rev-parse --short HEAD) -X github.com/lvdashuaibi/littlevote/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd